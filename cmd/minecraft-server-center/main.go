@@ -1,38 +1,252 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/activity"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/allowlist"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/autoscale"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/buildinfo"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/centralstate"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/cloud"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/geoip"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/macros"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/mdns"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notify"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/operators"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/preferences"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/proxy"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/retention"
 	"github.com/jsandas/gogo-mc-bedrock-server/internal/server"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/settings"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/timeline"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/timezone"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/tokens"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/transfer"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/twofactor"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/uptime"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/usage"
 )
 
+// version, commit and date are set at build time by goreleaser.
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// build describes this binary in logs, /api/about and the hello.
+var build = buildinfo.New("minecraft-server-center", version, commit, date)
+
 // WrapperConfig represents the configuration for a single Minecraft server wrapper.
 type WrapperConfig struct {
-	ID        string `json:"id"`
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Address   string   `json:"address"`
+	Username  string   `json:"username,omitempty"`
+	Password  string   `json:"password,omitempty"`
+	SharedKey string   `json:"shared_key"`       // Key that must match the wrapper's AUTH_KEY
+	Groups    []string `json:"groups,omitempty"` // Used to grant users access to several wrappers at once
+
+	// Reached through the relay link the wrapper opens, for wrappers behind NAT
+	Relay bool `json:"relay,omitempty"`
+
+	PlaytimeRules []PlaytimeRuleConfig `json:"playtime_rules,omitempty"`
+	Host          *HostConfig          `json:"host,omitempty"`  // VM hosting the wrapper, powered on and off on demand
+	Power         *usage.Rate          `json:"power,omitempty"` // What running the wrapper's host costs, for usage reports
+}
+
+// HostConfig represents the VM hosting a wrapper, powered on before
+// sessions and off when idle. Provider is "webhook", "aws" or "gcp". AWS
+// credentials are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN; GCP tokens from GCP_ACCESS_TOKEN or the metadata
+// server. Durations are Go duration strings.
+type HostConfig struct {
+	Provider       string              `json:"provider"`
+	Webhook        string              `json:"webhook,omitempty"`
+	WebhookHeaders map[string]string   `json:"webhook_headers,omitempty"`
+	Region         string              `json:"region,omitempty"`      // AWS
+	InstanceID     string              `json:"instance_id,omitempty"` // AWS
+	Project        string              `json:"project,omitempty"`     // GCP
+	Zone           string              `json:"zone,omitempty"`        // GCP
+	Instance       string              `json:"instance,omitempty"`    // GCP
+	Sessions       []HostSessionConfig `json:"sessions,omitempty"`
+	Lead           string              `json:"lead,omitempty"` // Powered on this long before a session
+
+	// Powered off after this long without players outside sessions
+	IdleStop string `json:"idle_stop,omitempty"`
+}
+
+// HostSessionConfig represents a time a host is kept powered on. Days are
+// sun..sat, every day if empty; times are HH:MM in the timezone of the
+// central server.
+type HostSessionConfig struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// UserConfig represents a user with their own key. Admins have full access,
+// other users only to the wrappers they are granted.
+type UserConfig struct {
+	Name   string        `json:"name"`
+	Key    string        `json:"key"`
+	Admin  bool          `json:"admin,omitempty"`
+	Grants []GrantConfig `json:"grants,omitempty"`
+}
+
+// GrantConfig represents "view" or "operate" access to wrappers listed by
+// ID or group.
+type GrantConfig struct {
+	All      bool     `json:"all,omitempty"` // Every wrapper
+	Wrappers []string `json:"wrappers,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	Access   string   `json:"access"`
+}
+
+// PlaytimeRuleConfig represents a command run once for each player whose
+// playtime on the wrapper reaches the threshold, a Go duration string.
+type PlaytimeRuleConfig struct {
 	Name      string `json:"name"`
-	Address   string `json:"address"`
-	Username  string `json:"username,omitempty"`
-	Password  string `json:"password,omitempty"`
-	SharedKey string `json:"shared_key"` // Key that must match the wrapper's AUTH_KEY
+	Threshold string `json:"threshold"`
+	Command   string `json:"command"`
+}
+
+// KeepaliveConfig represents the WebSocket keepalive settings used when
+// connecting to wrappers. Values are Go duration strings such as "30s".
+type KeepaliveConfig struct {
+	PingInterval     string `json:"ping_interval,omitempty"`
+	PongWait         string `json:"pong_wait,omitempty"`
+	WriteWait        string `json:"write_wait,omitempty"`
+	HandshakeTimeout string `json:"handshake_timeout,omitempty"`
+}
+
+// HTTPConfig represents the timeouts of the web server, as Go duration
+// strings, and the PEM certificate and key to serve HTTPS and HTTP/2 with.
+type HTTPConfig struct {
+	ReadHeaderTimeout string `json:"read_header_timeout,omitempty"`
+	ReadTimeout       string `json:"read_timeout,omitempty"`
+	WriteTimeout      string `json:"write_timeout,omitempty"`
+	IdleTimeout       string `json:"idle_timeout,omitempty"`
+	TLSCert           string `json:"tls_cert,omitempty"`
+	TLSKey            string `json:"tls_key,omitempty"`
+	SocketMode        string `json:"socket_mode,omitempty"`  // Octal permissions of Unix sockets, e.g. "0660"
+	SocketGroup       string `json:"socket_group,omitempty"` // Group owning Unix sockets, by name or ID
+}
+
+// ClientLimitsConfig caps the consoles of each wrapper connected at once, in
+// all and from one address. Zero is unlimited.
+type ClientLimitsConfig struct {
+	Max   int `json:"max,omitempty"`
+	PerIP int `json:"per_ip,omitempty"`
+}
+
+// GeoIPConfig represents the optional lookup of where players connect from
+// using a local MaxMind database. Countries are ISO 3166-1 codes.
+type GeoIPConfig struct {
+	Database         string   `json:"database,omitempty"`          // Path to a GeoLite2 Country or City .mmdb file
+	AllowedCountries []string `json:"allowed_countries,omitempty"` // Alert on connections from other countries
+	DeniedCountries  []string `json:"denied_countries,omitempty"`  // Alert on connections from these countries
+}
+
+// StatusPageConfig represents the optional public status page. Refresh is a
+// Go duration string.
+type StatusPageConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Title    string   `json:"title,omitempty"`
+	Wrappers []string `json:"wrappers,omitempty"` // IDs of the wrappers shown, all if empty
+	Refresh  string   `json:"refresh,omitempty"`
+}
+
+// SecurityHeadersConfig represents the security headers of the web console.
+// HSTS is always sent over TLS; enable it when a proxy terminates TLS.
+type SecurityHeadersConfig struct {
+	ContentSecurityPolicy string `json:"content_security_policy,omitempty"` // Defaults to a same-origin policy
+	ReportOnly            bool   `json:"report_only,omitempty"`             // Report violations without blocking them
+	ReportURI             string `json:"report_uri,omitempty"`
+	HSTS                  bool   `json:"hsts,omitempty"`
+}
+
+// AutoscaleConfig represents a policy starting another instance from a
+// template when a server with the labels stays at max players, through a
+// provisioning webhook or command. Durations are Go duration strings.
+type AutoscaleConfig struct {
+	Name           string            `json:"name"`
+	Labels         map[string]string `json:"labels,omitempty"` // Wrappers watched, all if empty
+	Sustain        string            `json:"sustain"`          // How long a server must stay full
+	Cooldown       string            `json:"cooldown,omitempty"`
+	MaxInstances   int               `json:"max_instances,omitempty"` // Unlimited if zero
+	Template       string            `json:"template,omitempty"`
+	Webhook        string            `json:"webhook,omitempty"` // Provisioning API, POSTed the request as JSON
+	WebhookHeaders map[string]string `json:"webhook_headers,omitempty"`
+
+	// Provisioning command, e.g. a script running terraform apply
+	Command []string `json:"command,omitempty"`
+
+	Discord string `json:"discord_webhook,omitempty"`
 }
 
 // Config represents the central server configuration.
 type Config struct {
-	ListenAddress string          `json:"listen_address"`
-	AuthKey       string          `json:"auth_key,omitempty"`
-	Wrappers      []WrapperConfig `json:"wrappers"`
+	ListenAddress string `json:"listen_address"` // Comma-separated, e.g. ":8081,[::1]:8082"
+	AuthKey       string `json:"auth_key,omitempty"`
+	DataDir       string `json:"data_dir,omitempty"` // Where the central server keeps its state
+
+	// Block commands and changes, can be switched through the API
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// IANA timezone of host session times, $TZ or the system's if empty
+	Timezone string `json:"timezone,omitempty"`
+
+	// Browser consoles without interaction this long are disconnected, never if empty
+	IdleTimeout string `json:"idle_timeout,omitempty"`
+
+	// Let admins find wrappers advertised on the LAN over mDNS and add them
+	Discovery bool `json:"discovery,omitempty"`
+
+	Keepalive    KeepaliveConfig       `json:"keepalive"`
+	ClientLimits ClientLimitsConfig    `json:"client_limits"`
+	GeoIP        GeoIPConfig           `json:"geoip"`
+	StatusPage   StatusPageConfig      `json:"status_page"`
+	Headers      SecurityHeadersConfig `json:"security_headers"`
+	HTTP         HTTPConfig            `json:"http"`
+	Users        []UserConfig          `json:"users,omitempty"`
+
+	// Bedrock version servers are compared with, looked up if empty
+	LatestVersion string `json:"latest_version,omitempty"`
+
+	JobWorkers int `json:"job_workers,omitempty"` // Wrappers fleet jobs work on at once, 4 if zero
+
+	// Where backup jobs save snapshots, <data_dir>/backups if empty
+	BackupDir string `json:"backup_dir,omitempty"`
+
+	Autoscale     []AutoscaleConfig    `json:"autoscale,omitempty"`
+	Notifications []NotificationConfig `json:"notifications,omitempty"` // Channels alerts are sent to
+	Wrappers      []WrapperConfig      `json:"wrappers"`
 }
 
 var (
 	configFile    = flag.String("config", "config.json", "path to configuration file")
-	listenAddress = flag.String("listen", ":8081", "address for the web server (overrides config file)")
-	authKey       = flag.String("auth-key", "", "pre-shared key for authentication (overrides config file)")
+	listenAddress = flag.String("listen", ":8081",
+		"comma-separated addresses for the web server, e.g. :8081,[::1]:8082 or a Unix socket path (overrides config file)")
+	authKey  = flag.String("auth-key", "", "pre-shared key for authentication (overrides config file)")
+	discover = flag.Bool("discover", false, "list the wrappers advertised on the LAN over mDNS and exit")
 )
 
 func loadConfig(path string) (*Config, error) {
@@ -51,33 +265,531 @@ func loadConfig(path string) (*Config, error) {
 	return &config, nil
 }
 
-func init() {
-	// Set defaults from environment variables if present
-	if envListenAddress := os.Getenv("LISTEN_ADDRESS"); envListenAddress != "" {
-		err := flag.Set("listen", envListenAddress)
+// listDiscovered prints the wrappers advertised on the LAN, to be added to
+// the config file by hand.
+func listDiscovered() {
+	instances, err := mdns.Browse(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error browsing the LAN: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(instances) == 0 {
+		fmt.Println("No wrappers found. Start them with -mdns to advertise them on the LAN.")
+		return
+	}
+
+	for _, instance := range instances {
+		version := instance.TXT["version"]
+		if version == "" {
+			version = "unknown"
+		}
+
+		fmt.Printf("%s\t%s\t(version %s, host %s)\n", instance.Name, instance.Address(), version, instance.Host)
+	}
+}
+
+// saveWrapper adds a wrapper discovered on the LAN to the config file,
+// written back whole.
+func saveWrapper(path string, wrapper server.NewWrapper) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	config, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	config.Wrappers = append(config.Wrappers, newWrapperConfig(wrapper))
+
+	return writeConfig(path, config)
+}
+
+func newWrapperConfig(wrapper server.NewWrapper) WrapperConfig {
+	return WrapperConfig{
+		ID:        wrapper.ID,
+		Name:      wrapper.Name,
+		Address:   wrapper.Address,
+		SharedKey: wrapper.SharedKey,
+	}
+}
+
+// writeConfig replaces the config file atomically, so a crash never leaves
+// it half written.
+func writeConfig(path string, config *Config) error {
+	data, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error encoding config file: %w", err)
+	}
+
+	err = jsonfile.WriteFile(path, append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+
+	return nil
+}
+
+// runSetup serves the first-run setup wizard until it writes the config
+// file. It exits if interrupted first.
+func runSetup(path string) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating setup token: %v\n", err)
+		os.Exit(1)
+	}
+
+	token := hex.EncodeToString(b)
+	addrs := server.SplitListen(*listenAddress)
+
+	setup := server.NewSetupServer(server.SetupConfig{
+		HTTP:  server.DefaultHTTP(),
+		Token: token,
+		Save: func(result server.SetupResult) error {
+			return saveSetup(path, result)
+		},
+	})
+
+	serverError := make(chan error, 1)
+
+	go func() {
+		serverError <- setup.Start(addrs)
+	}()
+
+	fmt.Printf("No configuration at %s. Finish the setup in a browser:\n", path)
+
+	for _, addr := range addrs {
+		if server.IsUnixSocket(addr) {
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "localhost"
+		}
+
+		fmt.Printf("  http://%s/#token=%s\n", net.JoinHostPort(host, port), token)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	select {
+	case <-setup.Done():
+	case err := <-serverError:
+		fmt.Fprintf(os.Stderr, "Setup server error: %v\n", err)
+		os.Exit(1)
+	case <-sigChan:
+		fmt.Println("\nSetup interrupted, no configuration written.")
+		os.Exit(0)
+	}
+
+	err = setup.Stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error stopping setup server: %v\n", err)
+	}
+
+	fmt.Printf("Configuration written to %s\n", path)
+}
+
+// saveSetup writes the config file collected by the setup wizard, refusing
+// to replace one written meanwhile.
+func saveSetup(path string, result server.SetupResult) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	_, err := os.Stat(path)
+	if err == nil {
+		return fmt.Errorf("%s exists already", path)
+	}
+
+	// Users sign in with their own key; the master key stays on the server
+	b := make([]byte, 32)
+
+	_, err = rand.Read(b)
+	if err != nil {
+		return fmt.Errorf("error generating auth key: %w", err)
+	}
+
+	config := &Config{
+		ListenAddress: *listenAddress,
+		AuthKey:       hex.EncodeToString(b),
+		DataDir:       "data",
+		Users:         []UserConfig{{Name: result.AdminName, Key: result.AdminKey, Admin: true}},
+		Wrappers:      []WrapperConfig{},
+	}
+
+	switch result.TLSMode {
+	case server.TLSModeFiles:
+		config.HTTP.TLSCert, config.HTTP.TLSKey = result.TLSCert, result.TLSKey
+	case server.TLSModeProxy:
+		config.Headers.HSTS = true
+	}
+
+	if result.Wrapper != nil {
+		config.Wrappers = append(config.Wrappers, newWrapperConfig(*result.Wrapper))
+	}
+
+	return writeConfig(path, config)
+}
+
+// configMu serializes changes to the config file.
+var configMu sync.Mutex
+
+// parseHTTP converts the web server settings from the config file.
+func parseHTTP(cfg HTTPConfig) (server.HTTPConfig, error) {
+	httpConfig := server.HTTPConfig{TLSCert: cfg.TLSCert, TLSKey: cfg.TLSKey, SocketGroup: cfg.SocketGroup}
+
+	if cfg.SocketMode != "" {
+		mode, err := strconv.ParseUint(cfg.SocketMode, 8, 32)
+		if err != nil {
+			return httpConfig, fmt.Errorf("invalid http.socket_mode: %v", err)
+		}
+
+		httpConfig.SocketMode = fs.FileMode(mode)
+	}
+
+	fields := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"read_header_timeout", cfg.ReadHeaderTimeout, &httpConfig.ReadHeaderTimeout},
+		{"read_timeout", cfg.ReadTimeout, &httpConfig.ReadTimeout},
+		{"write_timeout", cfg.WriteTimeout, &httpConfig.WriteTimeout},
+		{"idle_timeout", cfg.IdleTimeout, &httpConfig.IdleTimeout},
+	}
+
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(f.value)
+		if err != nil {
+			return httpConfig, fmt.Errorf("invalid http.%s: %v", f.name, err)
+		}
+
+		*f.dest = d
+	}
+
+	return httpConfig, httpConfig.Validate()
+}
+
+// parseKeepalive converts the keepalive settings from the config file.
+func parseKeepalive(cfg KeepaliveConfig) (server.KeepaliveConfig, error) {
+	var keepalive server.KeepaliveConfig
+
+	fields := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"ping_interval", cfg.PingInterval, &keepalive.PingInterval},
+		{"pong_wait", cfg.PongWait, &keepalive.PongWait},
+		{"write_wait", cfg.WriteWait, &keepalive.WriteWait},
+		{"handshake_timeout", cfg.HandshakeTimeout, &keepalive.HandshakeTimeout},
+	}
+
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(f.value)
+		if err != nil {
+			return keepalive, fmt.Errorf("invalid keepalive.%s: %v", f.name, err)
+		}
+
+		*f.dest = d
+	}
+
+	return keepalive, keepalive.Validate()
+}
+
+// parseStatusPage converts the status page settings, returning nil if the
+// page is disabled.
+func parseStatusPage(cfg StatusPageConfig) (*server.StatusPageConfig, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	page := &server.StatusPageConfig{
+		Title:    cfg.Title,
+		Wrappers: cfg.Wrappers,
+	}
+
+	if cfg.Refresh != "" {
+		d, err := time.ParseDuration(cfg.Refresh)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status_page.refresh: %v", err)
+		}
+
+		page.Refresh = d
+	}
+
+	return page, nil
+}
+
+// parseUsers converts the users from the config file.
+func parseUsers(cfg []UserConfig) ([]server.User, error) {
+	users := make([]server.User, 0, len(cfg))
+	names := make(map[string]bool)
+
+	for i, u := range cfg {
+		if u.Name == "" || u.Key == "" {
+			return nil, fmt.Errorf("users[%d] needs a name and a key", i)
+		}
+
+		if names[u.Name] {
+			return nil, fmt.Errorf("duplicate user %q", u.Name)
+		}
+
+		names[u.Name] = true
+		user := server.User{Name: u.Name, Key: u.Key, Admin: u.Admin}
+
+		for j, g := range u.Grants {
+			access := server.Access(g.Access)
+			if access != server.AccessView && access != server.AccessOperate {
+				return nil, fmt.Errorf("users[%d].grants[%d].access must be \"view\" or \"operate\"", i, j)
+			}
+
+			user.Grants = append(user.Grants, server.Grant{All: g.All, Wrappers: g.Wrappers, Groups: g.Groups, Access: access})
+		}
+
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// parseAutoscale converts the autoscale policies.
+// NotificationConfig represents a channel alerts are sent to: a webhook
+// POSTed each notification, or digest of them, as JSON with a "text"
+// summary. Severities are info, warning and critical; digest periods are Go
+// duration strings.
+type NotificationConfig struct {
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	MinSeverity string            `json:"min_severity,omitempty"` // Lower severities are dropped
+
+	// Period of the digest batching a severity, e.g. {"warning": "1h"}
+	Digest map[string]string `json:"digest,omitempty"`
+
+	QuietHours *QuietHoursConfig `json:"quiet_hours,omitempty"`
+}
+
+// QuietHoursConfig represents when a channel holds back notifications below
+// a severity, sending them as a digest when quiet hours end. Days are
+// sun..sat, every day if empty; times are HH:MM in the timezone of the
+// central server.
+type QuietHoursConfig struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+	Allow string   `json:"allow,omitempty"` // Lowest severity still sent right away, critical if empty
+}
+
+func parseAutoscale(cfg []AutoscaleConfig) ([]autoscale.Policy, error) {
+	policies := make([]autoscale.Policy, 0, len(cfg))
+
+	for i, a := range cfg {
+		policy := autoscale.Policy{
+			Name:         a.Name,
+			Labels:       a.Labels,
+			MaxInstances: a.MaxInstances,
+			Template:     a.Template,
+			Discord:      a.Discord,
+		}
+
+		sustain, err := time.ParseDuration(a.Sustain)
+		if err != nil {
+			return nil, fmt.Errorf("invalid autoscale[%d].sustain: %v", i, err)
+		}
+
+		policy.Sustain = sustain
+
+		if a.Cooldown != "" {
+			policy.Cooldown, err = time.ParseDuration(a.Cooldown)
+			if err != nil {
+				return nil, fmt.Errorf("invalid autoscale[%d].cooldown: %v", i, err)
+			}
+		}
+
+		switch {
+		case a.Webhook != "" && len(a.Command) > 0:
+			return nil, fmt.Errorf("autoscale[%d] needs a webhook or a command, not both", i)
+		case a.Webhook != "":
+			policy.Provisioner = autoscale.Webhook{URL: a.Webhook, Headers: a.WebhookHeaders}
+		case len(a.Command) > 0:
+			policy.Provisioner = autoscale.Command{Args: a.Command}
+		}
+
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// parseNotifications converts the notification channels, returning nil if
+// there are none.
+func parseNotifications(cfg []NotificationConfig, location *time.Location) (*notify.Notifier, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+
+	channels := make([]notify.Channel, 0, len(cfg))
+
+	for i, c := range cfg {
+		channel := notify.Channel{
+			Name:        c.Name,
+			URL:         c.URL,
+			Headers:     c.Headers,
+			MinSeverity: c.MinSeverity,
+			Location:    location,
+			Digest:      make(map[string]time.Duration, len(c.Digest)),
+		}
+
+		for severity, value := range c.Digest {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid notifications[%d].digest.%s: %v", i, severity, err)
+			}
+
+			channel.Digest[severity] = d
+		}
+
+		if q := c.QuietHours; q != nil {
+			channel.Quiet = &notify.QuietHours{Days: q.Days, Start: q.Start, End: q.End, Allow: q.Allow}
+		}
+
+		channels = append(channels, channel)
+	}
+
+	return notify.New(channels)
+}
+
+// parseHost converts the host of a wrapper.
+func parseHost(cfg HostConfig, location *time.Location) (*cloud.Host, error) {
+	var provider cloud.Provider
+
+	switch cfg.Provider {
+	case "webhook":
+		if cfg.Webhook == "" {
+			return nil, fmt.Errorf("host.webhook is required")
+		}
+
+		provider = cloud.Webhook{URL: cfg.Webhook, Headers: cfg.WebhookHeaders}
+	case "aws":
+		aws := cloud.AWS{Region: cfg.Region, InstanceID: cfg.InstanceID}
+
+		err := aws.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		provider = aws
+	case "gcp":
+		gcp := &cloud.GCP{Project: cfg.Project, Zone: cfg.Zone, Instance: cfg.Instance}
+
+		err := gcp.Validate()
 		if err != nil {
-			fmt.Printf("Error setting listen flag: %v\n", err)
+			return nil, err
 		}
+
+		provider = gcp
+	default:
+		return nil, fmt.Errorf("host.provider must be \"webhook\", \"aws\" or \"gcp\"")
+	}
+
+	policy := cloud.Policy{Location: location}
+
+	for _, s := range cfg.Sessions {
+		policy.Sessions = append(policy.Sessions, cloud.Session{Days: s.Days, Start: s.Start, End: s.End})
 	}
 
-	if envConfigFile := os.Getenv("CONFIG_FILE"); envConfigFile != "" {
-		err := flag.Set("config", envConfigFile)
+	for _, f := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"lead", cfg.Lead, &policy.Lead},
+		{"idle_stop", cfg.IdleStop, &policy.IdleStop},
+	} {
+		if f.value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(f.value)
 		if err != nil {
-			fmt.Printf("Error setting config flag: %v\n", err)
+			return nil, fmt.Errorf("invalid host.%s: %v", f.name, err)
 		}
+
+		*f.dest = d
 	}
 
-	if envAuthKey := os.Getenv("AUTH_KEY"); envAuthKey != "" {
-		err := flag.Set("auth-key", envAuthKey)
+	return cloud.NewHost(provider, policy)
+}
+
+// parsePlaytimeRules converts the playtime rules of a wrapper.
+func parsePlaytimeRules(cfg []PlaytimeRuleConfig) ([]activity.Rule, error) {
+	rules := make([]activity.Rule, 0, len(cfg))
+
+	for i, r := range cfg {
+		threshold, err := time.ParseDuration(r.Threshold)
 		if err != nil {
-			fmt.Printf("Error setting auth-key flag: %v\n", err)
+			return nil, fmt.Errorf("invalid playtime_rules[%d].threshold: %v", i, err)
 		}
+
+		if r.Command == "" {
+			return nil, fmt.Errorf("playtime_rules[%d].command is required", i)
+		}
+
+		name := r.Name
+		if name == "" {
+			name = r.Threshold + ":" + r.Command
+		}
+
+		rules = append(rules, activity.Rule{Name: name, Threshold: threshold, Command: r.Command})
 	}
 
+	return rules, nil
+}
+
+func init() {
 	flag.Parse()
+
+	// Fill in flags from environment variables
+	var err error
+
+	flagSettings, err = settings.Flags(flag.CommandLine, envFlags, os.LookupEnv, secretFields...)
+	if err != nil {
+		exitInvalid(err)
+	}
 }
 
 func main() {
+	if *discover {
+		listDiscovered()
+		return
+	}
+
+	fmt.Printf("Starting %s\n", build)
+
+	// Guide new users through writing the config file
+	_, err := os.Stat(*configFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		runSetup(*configFile)
+	}
+
 	// Load configuration
 	config, err := loadConfig(*configFile)
 	if err != nil {
@@ -85,13 +797,229 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Override listen address if provided via flag
-	if *listenAddress != ":8081" {
-		config.ListenAddress = *listenAddress
+	// Apply an imported state before anything reads it
+	if config.DataDir == "" {
+		config.DataDir = "data"
+	}
+
+	applied, err := centralstate.ApplyStaged(*configFile, config.DataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error applying imported state: %v\n", err)
+		os.Exit(1)
+	}
+
+	if applied {
+		dataDir := config.DataDir
+
+		config, err = loadConfig(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading imported configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		if config.DataDir == "" {
+			config.DataDir = "data"
+		}
+
+		fmt.Printf("Applied imported state to %s and %s\n", *configFile, dataDir)
+
+		if config.DataDir != dataDir {
+			fmt.Fprintf(os.Stderr, "Warning: the imported data was restored to %s, but the imported configuration uses %s\n",
+				dataDir, config.DataDir)
+		}
+	}
+
+	// Apply the flags over the config file and check the result
+	resolveSettings(config)
+
+	keepalive, err := parseKeepalive(config.Keepalive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in keepalive configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	httpConfig, err := parseHTTP(config.HTTP)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in http configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	location, err := timezone.Load(config.Timezone)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in timezone configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	users, err := parseUsers(config.Users)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in user configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	statusPage, err := parseStatusPage(config.StatusPage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in status page configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if config.BackupDir == "" {
+		config.BackupDir = filepath.Join(config.DataDir, "backups")
+	}
+
+	// Player activity across all wrappers
+	activityStore, err := activity.Open(filepath.Join(config.DataDir, "activity.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading player activity: %v\n", err)
+		os.Exit(1)
+	}
+
+	// API tokens for automation
+	tokenStore, err := tokens.Open(filepath.Join(config.DataDir, "tokens.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading API tokens: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Command macros runnable on any wrapper
+	macroStore, err := macros.Open(filepath.Join(config.DataDir, "macros.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading macros: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Shared allowlists synced to the wrappers
+	allowlistStore, err := allowlist.Open(filepath.Join(config.DataDir, "allowlists.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading allowlists: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Where the snapshots saved by backups came from
+	backupIndex, err := transfer.OpenIndex(filepath.Join(config.BackupDir, "index.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading backup index: %v\n", err)
+		os.Exit(1)
+	}
+
+	// How often each wrapper is backed up and how long its backups are kept
+	policyStore, err := retention.Open(filepath.Join(config.DataDir, "backup_policies.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading backup policies: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Canonical operators checked against the permissions of each wrapper
+	operatorStore, err := operators.Open(filepath.Join(config.DataDir, "operators.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading operators: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Web console settings that follow each user across devices
+	preferenceStore, err := preferences.Open(filepath.Join(config.DataDir, "preferences.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading preferences: %v\n", err)
+		os.Exit(1)
+	}
+
+	// TOTP enrollments of users who can send commands or change configuration
+	twoFactorStore, err := twofactor.Open(filepath.Join(config.DataDir, "twofactor.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading two-factor enrollments: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Status samples for uptime reports
+	uptimeStore, err := uptime.Open(filepath.Join(config.DataDir, "uptime.json"), time.Minute)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading uptime samples: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Power and player samples for usage reports
+	usageStore, err := usage.Open(filepath.Join(config.DataDir, "usage.json"), time.Minute)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading usage samples: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Significant events of the fleet for its timeline
+	timelineStore, err := timeline.Open(filepath.Join(config.DataDir, "timeline.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading timeline: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Deny list pushed to the UDP proxies of all wrappers
+	denyList, err := proxy.OpenDenyList(filepath.Join(config.DataDir, "denylist.json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading deny list: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Instances started when servers stay full
+	var scaler *autoscale.Scaler
+
+	if len(config.Autoscale) > 0 {
+		policies, err := parseAutoscale(config.Autoscale)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in autoscale configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		scaler, err = autoscale.Open(filepath.Join(config.DataDir, "autoscale.json"), policies)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading autoscale policies: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Connection origins, only looked up in a local database
+	var geoReader *geoip.Reader
+
+	if config.GeoIP.Database != "" {
+		geoReader, err = geoip.Open(config.GeoIP.Database)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading GeoIP database: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Where alerts are sent, held back during quiet hours
+	notifier, err := parseNotifications(config.Notifications, location)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in notifications configuration: %v\n", err)
+		os.Exit(1)
 	}
 
 	// Create connection manager
-	manager := server.NewConnectionManager()
+	manager := server.NewConnectionManager(server.ConnectionManagerConfig{
+		Keepalive: keepalive,
+		Activity:  activityStore,
+		GeoIP:     geoReader,
+		RegionAlerts: server.RegionAlerts{
+			Allowed: config.GeoIP.AllowedCountries,
+			Denied:  config.GeoIP.DeniedCountries,
+		},
+		DenyList:  denyList,
+		Uptime:    uptimeStore,
+		Usage:     usageStore,
+		Autoscale: scaler,
+		ReadOnly:  config.ReadOnly,
+		Build:     build,
+		Notifier:  notifier,
+		Operators: operatorStore,
+		Timeline:  timelineStore,
+	})
+	go manager.Watchdog(time.Minute)
+	go manager.PlaytimeHooks(time.Minute)
+	go manager.DenyListSync(time.Minute)
+	go manager.UptimeSamples(time.Minute)
+	go manager.LatencySamples(30 * time.Second)
+	go manager.Autoscale(time.Minute)
+	go manager.Hosts(time.Minute)
+	go manager.Notifications(time.Minute)
+	go manager.OperatorChecks(5 * time.Minute)
 
 	// Connect to all configured wrappers
 	var wg sync.WaitGroup
@@ -100,45 +1028,129 @@ func main() {
 
 		go func(w WrapperConfig) {
 			defer wg.Done()
-			// Ensure wrapper has a shared key configured
-			if w.SharedKey == "" {
-				fmt.Fprintf(os.Stderr, "Error: Wrapper %s (%s) is missing a shared_key in config\n", w.Name, w.ID)
+			rules, err := parsePlaytimeRules(w.PlaytimeRules)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Wrapper %s (%s): %v\n", w.Name, w.ID, err)
 				return
 			}
 
+			var host *cloud.Host
+
+			if w.Host != nil {
+				host, err = parseHost(*w.Host, location)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: Wrapper %s (%s): %v\n", w.Name, w.ID, err)
+					return
+				}
+			}
+
+			var rate usage.Rate
+
+			if w.Power != nil {
+				rate = *w.Power
+
+				err = rate.Validate()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: Wrapper %s (%s): %v\n", w.Name, w.ID, err)
+					return
+				}
+			}
+
 			// Attempt to connect but don't fail if connection fails
-			err := manager.Connect(w.ID, w.Name, w.Address, w.Username, w.Password, w.SharedKey)
+			connect := manager.Connect
+			if w.Relay {
+				connect = manager.ConnectRelayed
+			}
+
+			err = connect(w.ID, w.Name, w.Address, w.Username, w.Password, w.SharedKey)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Initial connection to wrapper %s (%s) failed: %v\n", w.Name, w.ID, err)
 				fmt.Fprintf(os.Stderr, "Will attempt to reconnect automatically...\n")
 			}
+
+			wConn, exists := manager.GetConnection(w.ID)
+			if exists {
+				wConn.SetPlaytimeRules(rules)
+				wConn.SetGroups(w.Groups)
+				wConn.SetHost(host)
+				wConn.SetRate(rate)
+			}
 		}(wrapper)
 	}
 
-	// Determine the auth key to use (priority: env/flag > config file)
-	finalAuthKey := config.AuthKey
-	if *authKey != "" {
-		finalAuthKey = *authKey
+	// Create and start HTTP server
+	// Signalled to shut down after a state import
+	restart := make(chan struct{}, 1)
+
+	// Browser consoles left open without anyone at them
+	var idleTimeout time.Duration
+
+	if config.IdleTimeout != "" {
+		idleTimeout, err = time.ParseDuration(config.IdleTimeout)
+		if err != nil || idleTimeout < 0 {
+			fmt.Fprintf(os.Stderr, "Error in idle_timeout: %q is not a positive duration\n", config.IdleTimeout)
+			os.Exit(1)
+		}
 	}
 
-	// Ensure we have an auth key
-	if finalAuthKey == "" {
-		fmt.Fprintf(os.Stderr, "Error: Authentication key is required. Set it using:\n")
-		fmt.Fprintf(os.Stderr, "  1. AUTH_KEY environment variable (recommended)\n")
-		fmt.Fprintf(os.Stderr, "  2. --auth-key command line flag\n")
-		fmt.Fprintf(os.Stderr, "  3. auth_key field in config.json\n")
+	clientLimits := server.ClientLimits{Max: config.ClientLimits.Max, PerIP: config.ClientLimits.PerIP}
+
+	err = clientLimits.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in client limits configuration: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Create and start HTTP server
 	srv := server.NewCentralServer(server.CentralServerConfig{
-		Manager: manager,
-		AuthKey: finalAuthKey,
+		Manager:  manager,
+		AuthKey:  config.AuthKey,
+		Activity: activityStore,
+		Users:    users,
+		Tokens:   tokenStore,
+		Macros:   macroStore,
+
+		Allowlists:  allowlistStore,
+		Preferences: preferenceStore,
+
+		TwoFactor:  twoFactorStore,
+		StatusPage: statusPage,
+		HTTP:       httpConfig,
+		Headers: server.SecurityHeadersConfig{
+			ContentSecurityPolicy: config.Headers.ContentSecurityPolicy,
+			ReportOnly:            config.Headers.ReportOnly,
+			ReportURI:             config.Headers.ReportURI,
+			HSTS:                  config.Headers.HSTS,
+		},
+		LatestVersion: config.LatestVersion,
+		JobWorkers:    config.JobWorkers,
+		BackupDir:     config.BackupDir,
+		BackupIndex:   backupIndex,
+		ConfigPath:    *configFile,
+		DataDir:       config.DataDir,
+		IdleTimeout:   idleTimeout,
+		ClientLimits:  clientLimits,
+		Discovery:     config.Discovery,
+		SaveWrapper: func(wrapper server.NewWrapper) error {
+			return saveWrapper(*configFile, wrapper)
+		},
+		Restart: func() {
+			select {
+			case restart <- struct{}{}:
+			default:
+			}
+		},
+
+		BackupPolicies: policyStore,
 	})
+
+	if config.BackupDir != "" {
+		go srv.BackupPolicies(5 * time.Minute)
+	}
+
 	serverError := make(chan error, 1)
 
 	go func() {
-		err := srv.Start(config.ListenAddress)
+		err := srv.Start(server.SplitListen(config.ListenAddress))
 		if err != nil {
 			serverError <- err
 		}
@@ -154,6 +1166,8 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
 	case <-sigChan:
 		fmt.Println("\nReceived interrupt signal. Shutting down...")
+	case <-restart:
+		fmt.Println("Shutting down to apply the imported state...")
 	}
 
 	// Graceful shutdown
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notify"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/server"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/settings"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/timezone"
+)
+
+// envFlags maps environment variables to the flags they set when the flag
+// isn't given on the command line.
+var envFlags = map[string]string{
+	"LISTEN_ADDRESS": "listen",
+	"CONFIG_FILE":    "config",
+	"AUTH_KEY":       "auth-key",
+}
+
+// secretFields are masked in the settings table, by the last part of their
+// path.
+var secretFields = []string{"auth-key", "auth_key", "key", "shared_key", "password", "Authorization"}
+
+// flagSettings are the flags with where each value came from.
+var flagSettings []settings.Setting
+
+// resolveSettings applies -listen and -auth-key over the config file,
+// prints where each setting came from and exits listing every invalid
+// setting.
+func resolveSettings(config *Config) {
+	raw, err := os.ReadFile(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config file: %v\n", err)
+		os.Exit(1)
+	}
+
+	flags := map[string]settings.Setting{}
+	for _, s := range flagSettings {
+		flags[s.Name] = s
+	}
+
+	listen := flags["listen"]
+
+	overrideListen := listen.Source != settings.SourceDefault || config.ListenAddress == ""
+	if overrideListen {
+		config.ListenAddress = *listenAddress
+	}
+
+	if *authKey != "" {
+		config.AuthKey = *authKey
+	}
+
+	var c settings.Checker
+
+	c.Unknown(config, raw)
+	checkConfig(&c, config)
+
+	resolved, err := settings.File(config, raw, *configFile, secretFields...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if overrideListen {
+		resolved = settings.Override(resolved, settings.Setting{
+			Name:   "listen_address",
+			Value:  *listenAddress,
+			Source: listen.Source,
+			Origin: listen.Origin,
+		})
+	}
+
+	if *authKey != "" {
+		key := flags["auth-key"]
+		resolved = settings.Override(resolved, settings.Setting{
+			Name:   "auth_key",
+			Value:  *authKey,
+			Source: key.Source,
+			Origin: key.Origin,
+			Secret: true,
+		})
+	}
+
+	fmt.Println("Settings:")
+	settings.Print(os.Stdout, append([]settings.Setting{flags["config"]}, resolved...))
+
+	err = c.Err()
+	if err != nil {
+		exitInvalid(err)
+	}
+}
+
+// exitInvalid lists the problems with the settings and exits.
+func exitInvalid(err error) {
+	fmt.Fprintf(os.Stderr, "Error: invalid settings:\n")
+
+	if problems, ok := err.(settings.Errors); ok {
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "       %s\n", p)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "       %v\n", err)
+	}
+
+	os.Exit(1)
+}
+
+// checkConfig checks the config file against what the central server
+// accepts, before anything is started.
+func checkConfig(c *settings.Checker, config *Config) {
+	if c.Required("listen_address", config.ListenAddress) && config.AuthKey == "" {
+		c.Add("auth_key",
+			"is required, set it using the AUTH_KEY environment variable, -auth-key flag or auth_key in the config file")
+	}
+
+	c.Duration("idle_timeout", config.IdleTimeout, 0)
+	c.NotNegative("job_workers", float64(config.JobWorkers))
+	c.NotNegative("client_limits.max", float64(config.ClientLimits.Max))
+	c.NotNegative("client_limits.per_ip", float64(config.ClientLimits.PerIP))
+
+	k := config.Keepalive
+	if checkDurations(c, "keepalive.", map[string]string{
+		"ping_interval":     k.PingInterval,
+		"pong_wait":         k.PongWait,
+		"write_wait":        k.WriteWait,
+		"handshake_timeout": k.HandshakeTimeout,
+	}) {
+		_, err := parseKeepalive(k)
+		c.Invalid("keepalive", err)
+	}
+
+	h := config.HTTP
+	ok := checkDurations(c, "http.", map[string]string{
+		"read_header_timeout": h.ReadHeaderTimeout,
+		"read_timeout":        h.ReadTimeout,
+		"write_timeout":       h.WriteTimeout,
+		"idle_timeout":        h.IdleTimeout,
+	})
+
+	if h.SocketMode != "" {
+		_, err := strconv.ParseUint(h.SocketMode, 8, 32)
+		if err != nil {
+			c.Add("http.socket_mode", "must be octal permissions such as \"0660\", got %q", h.SocketMode)
+			ok = false
+		}
+	}
+
+	if (h.TLSCert == "") != (h.TLSKey == "") {
+		c.Add("http.tls_key", "must be set together with http.tls_cert")
+	} else if ok {
+		_, err := parseHTTP(h)
+		c.Invalid("http", err)
+	}
+
+	location, err := timezone.Load(config.Timezone)
+	if !c.Invalid("timezone", err) {
+		location = time.Local
+	}
+
+	ids := map[string]string{}
+
+	for i, w := range config.Wrappers {
+		path := fmt.Sprintf("wrappers[%d]", i)
+
+		if c.Required(path+".id", w.ID) {
+			c.Unique(path+".id", w.ID, ids)
+		}
+
+		// Relayed wrappers are reached through the link they open
+		if !w.Relay {
+			c.Required(path+".address", w.Address)
+		}
+
+		c.URL(path+".address", w.Address, "ws", "wss")
+		c.Required(path+".shared_key", w.SharedKey)
+
+		for j, r := range w.PlaytimeRules {
+			rulePath := fmt.Sprintf("%s.playtime_rules[%d]", path, j)
+
+			if c.Required(rulePath+".threshold", r.Threshold) {
+				c.Duration(rulePath+".threshold", r.Threshold, 0)
+			}
+
+			c.Required(rulePath+".command", r.Command)
+		}
+
+		if w.Host != nil {
+			_, err := parseHost(*w.Host, location)
+			c.Invalid(path+".host", err)
+		}
+
+		if w.Power != nil {
+			c.Invalid(path+".power", w.Power.Validate())
+		}
+	}
+
+	// References to wrappers by ID
+	knownWrapper := func(path, id string) {
+		if _, ok := ids[id]; !ok {
+			c.Add(path, "%q is not the ID of a configured wrapper", id)
+		}
+	}
+
+	for i, id := range config.StatusPage.Wrappers {
+		knownWrapper(fmt.Sprintf("status_page.wrappers[%d]", i), id)
+	}
+
+	c.Duration("status_page.refresh", config.StatusPage.Refresh, 0)
+
+	names := map[string]string{}
+
+	for i, u := range config.Users {
+		path := fmt.Sprintf("users[%d]", i)
+
+		if c.Required(path+".name", u.Name) {
+			c.Unique(path+".name", u.Name, names)
+		}
+
+		c.Required(path+".key", u.Key)
+
+		for j, g := range u.Grants {
+			grantPath := fmt.Sprintf("%s.grants[%d]", path, j)
+
+			if c.Required(grantPath+".access", g.Access) {
+				c.OneOf(grantPath+".access", g.Access, string(server.AccessView), string(server.AccessOperate))
+			}
+
+			for k, id := range g.Wrappers {
+				knownWrapper(fmt.Sprintf("%s.wrappers[%d]", grantPath, k), id)
+			}
+		}
+	}
+
+	for i, a := range config.Autoscale {
+		path := fmt.Sprintf("autoscale[%d]", i)
+
+		c.Required(path+".name", a.Name)
+
+		if c.Required(path+".sustain", a.Sustain) {
+			c.Duration(path+".sustain", a.Sustain, 0)
+		}
+
+		c.Duration(path+".cooldown", a.Cooldown, 0)
+		c.NotNegative(path+".max_instances", float64(a.MaxInstances))
+		c.URL(path+".webhook", a.Webhook, "http", "https")
+		c.URL(path+".discord_webhook", a.Discord, "http", "https")
+
+		if a.Webhook != "" && len(a.Command) > 0 {
+			c.Add(path, "needs a webhook or a command, not both")
+		}
+	}
+
+	severities := []string{notify.SeverityInfo, notify.SeverityWarning, notify.SeverityCritical}
+
+	for i, n := range config.Notifications {
+		path := fmt.Sprintf("notifications[%d]", i)
+
+		if c.Required(path+".url", n.URL) {
+			c.URL(path+".url", n.URL, "http", "https")
+		}
+
+		c.OneOf(path+".min_severity", n.MinSeverity, severities...)
+
+		for _, severity := range slices.Sorted(maps.Keys(n.Digest)) {
+			c.OneOf(path+".digest", severity, severities...)
+			c.Duration(path+".digest."+severity, n.Digest[severity], 0)
+		}
+
+		if n.QuietHours != nil {
+			c.OneOf(path+".quiet_hours.allow", n.QuietHours.Allow, severities...)
+		}
+	}
+
+	if c.Err() == nil {
+		_, err := parseNotifications(config.Notifications, location)
+		c.Invalid("notifications", err)
+	}
+}
+
+// checkDurations checks the Go duration strings of a section by field
+// name, returning whether all of them are valid.
+func checkDurations(c *settings.Checker, prefix string, fields map[string]string) bool {
+	ok := true
+
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		ok = c.Duration(prefix+name, fields[name], 0) && ok
+	}
+
+	return ok
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/config"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/downloader"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/plugins"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/redact"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/server"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/settings"
+)
+
+// checkTimeout bounds the network checks of -check.
+const checkTimeout = 15 * time.Second
+
+// Statuses of the checks in the -check report. Warnings don't fail it.
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// CheckResult is one check of the -check report.
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// CheckReport is the machine-readable report of -check, for CI to validate
+// deployment manifests with.
+type CheckReport struct {
+	OK      bool          `json:"ok"` // No check failed
+	Version string        `json:"version"`
+	Checks  []CheckResult `json:"checks"`
+}
+
+func (r *CheckReport) add(name, status, format string, args ...any) {
+	r.Checks = append(r.Checks, CheckResult{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+
+	if status == CheckFail {
+		r.OK = false
+	}
+}
+
+// result adds a passing check, or a failing one for err.
+func (r *CheckReport) result(name string, err error, passed string, args ...any) {
+	if err != nil {
+		r.add(name, CheckFail, "%v", err)
+		return
+	}
+
+	r.add(name, CheckPass, passed, args...)
+}
+
+// runCheck validates the deployment without downloading or starting
+// anything, prints the report as JSON and returns the exit code.
+func runCheck(problems settings.Errors) int {
+	report := CheckReport{OK: true, Version: version}
+
+	for _, p := range problems {
+		report.add("settings", CheckFail, "%s", p)
+	}
+
+	if len(problems) == 0 {
+		report.add("settings", CheckPass, "")
+	}
+
+	if os.Getenv("EULA_ACCEPT") == "true" {
+		report.add("eula", CheckPass, "accepted")
+	} else {
+		report.add("eula", CheckFail, "EULA_ACCEPT must be 'true' to accept the Minecraft EULA")
+	}
+
+	workDir := *appDir
+	if workDir == "" {
+		var err error
+
+		workDir, err = os.Getwd()
+		if err != nil {
+			report.add("app-dir", CheckFail, "error getting working directory: %v", err)
+			return printReport(report)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	checkDirectory(&report, "app-dir", workDir)
+	checkVersion(ctx, &report, workDir)
+	props := checkProperties(&report, workDir)
+	checkPorts(&report, props)
+
+	templates := *templatesDir
+	if templates == "" {
+		templates = filepath.Join(workDir, "templates")
+	}
+
+	checkDirectory(&report, "templates-dir", templates)
+
+	if *consoleLogPath != "" {
+		path := *consoleLogPath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workDir, path)
+		}
+
+		checkDirectory(&report, "console-log", filepath.Dir(path))
+	}
+
+	if *instanceConfig != "" {
+		_, err := loadEnvironment(*instanceConfig)
+		report.result("instance-config", err, "loaded %s", *instanceConfig)
+	}
+
+	if *pluginsConfig != "" {
+		_, err := plugins.LoadConfig(*pluginsConfig)
+		report.result("plugins-config", err, "loaded %s", *pluginsConfig)
+	}
+
+	if *redactConfig != "" {
+		_, err := redact.LoadConfig(*redactConfig)
+		report.result("redact-config", err, "loaded %s", *redactConfig)
+	}
+
+	return printReport(report)
+}
+
+// printReport prints the report as JSON, returning 1 if a check failed.
+func printReport(report CheckReport) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(report)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing check report: %v\n", err)
+		return 1
+	}
+
+	if !report.OK {
+		return 1
+	}
+
+	return 0
+}
+
+// checkVersion checks that the Minecraft version can be downloaded, or that
+// a server is installed when no version is given.
+func checkVersion(ctx context.Context, report *CheckReport, workDir string) {
+	manifest, manifestErr := downloader.ReadManifest(workDir)
+
+	if *mcVersion != "" {
+		if manifestErr == nil && manifest.Version == *mcVersion {
+			report.add("version", CheckPass, "version %s is installed", *mcVersion)
+			return
+		}
+
+		err := downloader.VersionAvailable(ctx, *mcVersion, "")
+		report.result("version", err, "version %s is available for download", *mcVersion)
+
+		return
+	}
+
+	serverPath := *command
+	if !filepath.IsAbs(serverPath) {
+		serverPath = filepath.Join(workDir, serverPath)
+	}
+
+	_, err := os.Stat(serverPath)
+	if err != nil {
+		report.add("version", CheckFail, "no server is installed in %s, set MINECRAFT_VER or -mc-version", workDir)
+		return
+	}
+
+	if manifestErr != nil {
+		report.add("version", CheckWarn, "installed server, version unknown")
+		return
+	}
+
+	report.add("version", CheckPass, "installed server version %s", manifest.Version)
+}
+
+// checkProperties checks server.properties with the CFG_ environment
+// variables applied, returning the result.
+func checkProperties(report *CheckReport, workDir string) map[string]string {
+	env := config.PropertiesFromEnv()
+
+	_, err := os.Stat(filepath.Join(workDir, "server.properties"))
+	missing := errors.Is(err, fs.ErrNotExist)
+
+	props, err := config.ReadProperties(workDir)
+	if missing && *mcVersion != "" {
+		// The download brings a server.properties
+		report.add("properties", CheckWarn, "server.properties not found, it comes with version %s", *mcVersion)
+		props = map[string]string{}
+	} else if err != nil {
+		report.add("properties", CheckFail, "%v", err)
+		return env
+	} else {
+		for _, key := range slices.Sorted(maps.Keys(env)) {
+			if _, ok := props[key]; !ok {
+				report.add("properties", CheckWarn, "%s isn't in server.properties, so its CFG_ variable is ignored", key)
+			}
+		}
+	}
+
+	maps.Copy(props, env)
+
+	err = config.CheckProperties(props)
+	if errs, ok := err.(interface{ Unwrap() []error }); ok {
+		// One check for each invalid property
+		for _, err := range errs.Unwrap() {
+			report.add("properties", CheckFail, "%v", err)
+		}
+
+		return props
+	}
+
+	report.result("properties", err, "%d properties checked", len(props))
+
+	return props
+}
+
+// checkPorts checks that the web server, the proxy and bedrock_server can
+// listen on their addresses.
+func checkPorts(report *CheckReport, props map[string]string) {
+	for _, addr := range server.SplitListen(*listenAddress) {
+		name := "listen " + addr
+
+		if server.IsUnixSocket(addr) {
+			checkSocket(report, name, addr)
+			continue
+		}
+
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			report.add(name, CheckFail, "%v", err)
+			continue
+		}
+
+		_ = l.Close()
+		report.add(name, CheckPass, "available")
+	}
+
+	if *proxyListen != "" {
+		checkUDP(report, *proxyListen, CheckFail)
+		checkUDP(report, *proxyUpstream, CheckFail)
+
+		return
+	}
+
+	port := props["server-port"]
+	if port == "" {
+		port = "19132"
+	}
+
+	portv6 := props["server-portv6"]
+	if portv6 == "" {
+		portv6 = "19133"
+	}
+
+	checkUDP(report, net.JoinHostPort("0.0.0.0", port), CheckFail)
+
+	// IPv6 may be disabled on the host, which bedrock_server tolerates
+	checkUDP(report, net.JoinHostPort("::", portv6), CheckWarn)
+}
+
+// checkUDP checks that a UDP address is free, reporting failure with the
+// given status.
+func checkUDP(report *CheckReport, addr, status string) {
+	name := "port " + addr + "/udp"
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		report.add(name, status, "%v", err)
+		return
+	}
+
+	_ = conn.Close()
+	report.add(name, CheckPass, "available")
+}
+
+// checkSocket checks that a Unix socket can be created at path. A socket
+// left behind is replaced at startup, even if a process still listens on
+// it.
+func checkSocket(report *CheckReport, name, path string) {
+	info, err := os.Lstat(path)
+
+	switch {
+	case err == nil && info.Mode()&fs.ModeSocket == 0:
+		report.add(name, CheckFail, "%s exists and isn't a socket", path)
+		return
+	case err == nil:
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			_ = conn.Close()
+			report.add(name, CheckWarn, "another process listens on %s, it would be replaced", path)
+
+			return
+		}
+	}
+
+	err = checkWritable(filepath.Dir(path))
+	report.result(name, err, "available")
+}
+
+// checkDirectory checks that a directory is writable, or can be created.
+func checkDirectory(report *CheckReport, name, dir string) {
+	_, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		parent := dir
+
+		for {
+			parent = filepath.Dir(parent)
+
+			_, err = os.Stat(parent)
+			if err == nil || parent == filepath.Dir(parent) {
+				break
+			}
+		}
+
+		err = checkWritable(parent)
+		report.result(name, err, "%s will be created", dir)
+
+		return
+	}
+
+	err = checkWritable(dir)
+	report.result(name, err, "%s is writable", dir)
+}
+
+// checkWritable checks that a file can be created in dir.
+func checkWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	f, err := os.CreateTemp(dir, ".check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+
+	_ = f.Close()
+
+	return os.Remove(f.Name())
+}
@@ -1,66 +1,378 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/buildinfo"
 	"github.com/jsandas/gogo-mc-bedrock-server/internal/config"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/consolelog"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/contentlog"
 	"github.com/jsandas/gogo-mc-bedrock-server/internal/downloader"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/mdns"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/memlimit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/plugins"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/proxy"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/redact"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rollback"
 	"github.com/jsandas/gogo-mc-bedrock-server/internal/runner"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/selfupdate"
 	"github.com/jsandas/gogo-mc-bedrock-server/internal/server"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/settings"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/timezone"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/trash"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/worlds"
 )
 
+// version, commit and date are set at build time by goreleaser.
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// build describes this binary in logs, /api/about and the hello.
+var build = buildinfo.New("minecraft-server-wrapper", version, commit, date)
+
 var (
 	command       = flag.String("command", "./bedrock_server", "command to execute (used for debugging purposes)")
-	listenAddress = flag.String("listen", ":8080", "address for the web server")
-	appDir        = flag.String("app-dir", "", "directory containing the minecraft server (defaults to current directory)")
-	mcVersion     = flag.String("mc-version", "", "Minecraft version to download (if not already present)")
-	authKey       = flag.String("auth-key", "", "pre-shared key for authentication (use AUTH_KEY env var instead)")
+	listenAddress = flag.String("listen", ":8080",
+		"comma-separated addresses for the web server, e.g. :8080,[::1]:8081 or a Unix socket path")
+	appDir     = flag.String("app-dir", "", "directory containing the minecraft server (defaults to current directory)")
+	mcVersion  = flag.String("mc-version", "", "Minecraft version to download (if not already present)")
+	authKey    = flag.String("auth-key", "", "pre-shared key for authentication (use AUTH_KEY env var instead)")
+	centralKey = flag.String("central-key", "",
+		"key the central server connects with instead of the auth key, so its connection isn't counted against "+
+			"the client limits (use CENTRAL_KEY env var instead)")
+
+	pingInterval = flag.Duration("ws-ping-interval", 54*time.Second, "interval between WebSocket pings")
+	pongWait     = flag.Duration("ws-pong-wait", 60*time.Second,
+		"time to wait for a WebSocket pong before disconnecting")
+	writeWait        = flag.Duration("ws-write-wait", 10*time.Second, "deadline for a single WebSocket write")
+	handshakeTimeout = flag.Duration("ws-handshake-timeout", 10*time.Second, "deadline for the WebSocket handshake")
+	maxClients       = flag.Int("ws-max-clients", 0,
+		"console clients connected at once, turned away with 503 past it (0 is unlimited)")
+	maxClientsPerIP = flag.Int("ws-max-clients-per-ip", 0,
+		"console clients connected at once from one address (0 is unlimited)")
+	idleTimeout = flag.Duration("ws-idle-timeout", 0,
+		"disconnect browser consoles nobody interacted with this long, e.g. 30m (0 disables)")
+
+	readHeaderTimeout = flag.Duration("http-read-header-timeout", 10*time.Second,
+		"deadline for the headers of an HTTP request, which stops slowloris clients")
+	readTimeout = flag.Duration("http-read-timeout", 10*time.Minute,
+		"deadline for a whole HTTP request, including uploads")
+	writeTimeout = flag.Duration("http-write-timeout", 10*time.Minute,
+		"deadline for a whole HTTP response, including downloads")
+	httpIdleTimeout = flag.Duration("http-idle-timeout", 2*time.Minute,
+		"how long idle keep-alive HTTP connections are kept open")
+	tlsCert    = flag.String("tls-cert", "", "PEM certificate to serve HTTPS and HTTP/2 with (plain HTTP if empty)")
+	tlsKey     = flag.String("tls-key", "", "PEM private key of the TLS certificate")
+	socketMode = flag.String("socket-mode", "0660",
+		"permissions of Unix sockets in -listen, whose clients need no auth key")
+	socketGroup = flag.String("socket-group", "", "group, by name or ID, owning Unix sockets in -listen")
+
+	contentLog = flag.Bool("content-log", true, "enable the Bedrock content log so addon errors are reported")
+
+	templatesDir = flag.String("templates-dir", "",
+		"directory of .mcworld world templates (defaults to <app-dir>/templates)")
+	templateURLs = flag.String("template-urls", "", "comma-separated URLs of .mcworld templates to add to the catalog")
+
+	proxyListen   = flag.String("proxy-listen", "", "address for the built-in UDP proxy, e.g. :19132 (disabled if empty)")
+	proxyUpstream = flag.String("proxy-upstream", "127.0.0.1:19134", "address bedrock_server listens on behind the proxy")
+
+	hangSilence = flag.Duration("hang-silence", 10*time.Minute,
+		"restart a server without console output this long whose pings fail (0 disables)")
+	hangPingFailures = flag.Int("hang-ping-failures", 3,
+		"consecutive failed pings before a silent server is considered hung")
+	hangInterval = flag.Duration("hang-check-interval", time.Minute, "interval between hung server checks")
+
+	stopTimeout = flag.Duration("stop-timeout", time.Minute,
+		"how long /api/server/stop waits for bedrock_server to save the world and exit")
+
+	restartPolicy = flag.String("restart-policy", runner.RestartNever,
+		"when the wrapper restarts bedrock_server after it exits: never (the wrapper exits too), on-failure or always")
+	restartBackoff = flag.Duration("restart-backoff", 5*time.Second,
+		"wait before restarting bedrock_server, doubled with each restart in a row")
+	restartMaxBackoff = flag.Duration("restart-max-backoff", 5*time.Minute,
+		"longest wait before restarting bedrock_server")
+
+	instanceConfig = flag.String("instance-config", "",
+		"JSON file with environment variables, ulimits and umask for bedrock_server")
+
+	cpus     = flag.String("cpus", "", "CPU cores bedrock_server may run on, e.g. 0-3,6 (all if empty)")
+	nice     = flag.Int("nice", 0, "niceness of bedrock_server, -20 (favored) to 19")
+	ioClass  = flag.String("io-class", "", "I/O scheduling class of bedrock_server: realtime, best-effort or idle")
+	ioLevel  = flag.Int("io-priority", 4, "I/O priority of bedrock_server within its class, 0 (highest) to 7")
+	cpuQuota = flag.Float64("cpu-quota", 0,
+		"cores worth of CPU time bedrock_server may use, enforced with cgroup v2 (unlimited if 0)")
+
+	memoryLimit = flag.String("memory-limit", "",
+		"memory ceiling of bedrock_server, e.g. 4G, enforced with cgroup v2 (disabled if empty)")
+	memoryWarn    = flag.Float64("memory-warn", 0.85, "share of the memory limit that triggers a warning")
+	memoryRestart = flag.Float64("memory-restart", 0.95, "share of the memory limit that triggers a save and restart")
+
+	csp           = flag.String("csp", "", "Content-Security-Policy of the web console (defaults to a same-origin policy)")
+	cspReportOnly = flag.Bool("csp-report-only", false, "report Content-Security-Policy violations without blocking them")
+	cspReportURI  = flag.String("csp-report-uri", "", "URI browsers send Content-Security-Policy violation reports to")
+	hsts          = flag.Bool("hsts", false, "send HSTS headers, for when a proxy in front of the wrapper terminates TLS")
+
+	pluginsConfig = flag.String("plugins-config", "", "JSON file listing plugin processes to run next to the wrapper")
+
+	mqttBroker = flag.String("mqtt-broker", "",
+		"MQTT broker to publish status and player events to, e.g. tcp://broker:1883 (disabled if empty)")
+	mqttClientID  = flag.String("mqtt-client-id", "", "MQTT client ID (defaults to gogo-mc-bedrock-<hostname>)")
+	mqttUsername  = flag.String("mqtt-username", "", "MQTT username")
+	mqttPassword  = flag.String("mqtt-password", "", "MQTT password (use MQTT_PASSWORD env var instead)")
+	mqttTopic     = flag.String("mqtt-topic", "gogo-mc-bedrock", "prefix of the MQTT topics published to")
+	mqttDiscovery = flag.String("mqtt-discovery", "homeassistant",
+		"Home Assistant MQTT discovery prefix (disabled if empty)")
+	mqttName     = flag.String("mqtt-name", "Minecraft server", "device name of the server in Home Assistant")
+	mqttInterval = flag.Duration("mqtt-interval", time.Minute, "interval between MQTT status updates")
+
+	updateRepo = flag.String("update-repo", selfupdate.DefaultRepository,
+		"GitHub repository whose releases the wrapper updates itself from (disabled if empty)")
+	updatePublicKey = flag.String("update-public-key", "",
+		"base64 ed25519 key the checksums of a release must be signed with (checksums only if empty)")
+
+	labels = flag.String("labels", "",
+		"comma-separated key=value metadata reported to the central server, e.g. owner=alice,environment=prod")
+
+	timezoneName = flag.String("timezone", "",
+		"IANA timezone schedule and announcement times are in, e.g. Europe/Berlin (defaults to $TZ or the system timezone)")
+
+	consoleLogPath = flag.String("console-log", "",
+		"file every console line of bedrock_server is appended to, e.g. logs/console.log relative to the app dir "+
+			"(disabled if empty)")
+	redactConfig = flag.String("redact-config", "",
+		"JSON file of regex rules hiding parts of console lines from web clients and the central server, such as the ip and "+
+			"xuid presets; the console log keeps them whole")
+	collapseRepeats = flag.Duration("collapse-repeats", 0,
+		"hold back repeats of a console line from web clients and summarize them at least this often, e.g. 30s (0 disables)")
+
+	maxLineLength = flag.Int("max-line-length", protocol.DefaultMaxLineLength,
+		"console lines longer than this many bytes are trimmed for web clients, which fetch them whole on demand "+
+			"(negative disables)")
+
+	mdnsEnabled = flag.Bool("mdns", false,
+		"advertise the wrapper on the LAN over mDNS so the central server can discover it")
+	mdnsName = flag.String("mdns-name", "", "name the wrapper is advertised under (defaults to the host name)")
+
+	relayURL = flag.String("relay-url", "",
+		"relay endpoint the wrapper links to when the central server can't connect to it, e.g. behind CGNAT: "+
+			"wss://central.example.com/api/relay (disabled if empty)")
+	relayID = flag.String("relay-id", "", "ID of the wrapper in the central server's config, sent to the relay")
+
+	pairingEnabled = flag.Bool("pairing", false,
+		"print a one-time pairing code and QR code at startup that adds the wrapper in the central server without copying "+
+			"the auth key")
+	pairingAddress = flag.String("pairing-address", "",
+		"WebSocket URL in the pairing code the central server connects to (defaults to the first TCP listen address)")
+
+	fileManager = flag.Bool("file-manager", true, "serve the file manager to the central server (/api/files)")
+	backups     = flag.Bool("backups", true, "serve snapshot export and import to the central server (/api/migration)")
+	schedules   = flag.Bool("schedules", true,
+		"run settings schedules and serve them to the central server (/api/schedules)")
+
+	safetyBackups = flag.Bool("safety-backups", true,
+		"take a verified rollback point before bedrock_server upgrades, snapshot imports and world imports")
+	safetyBackupsKeep = flag.Int("safety-backups-keep", rollback.DefaultKeep,
+		"rollback points kept, the oldest are removed")
+	trashEnabled = flag.Bool("trash", true,
+		"move deleted worlds, removed packs and config files replaced by a rollback to a trash they can be put back from")
+	trashTTL = flag.Duration("trash-ttl", trash.DefaultTTL,
+		"how long items are kept in the trash before they are purged")
+
+	checkMode = flag.Bool("check", false,
+		"check the EULA, Minecraft version, ports, directories and server properties without downloading or starting "+
+			"anything, print a JSON report and exit non-zero on failures")
+)
+
+// Where each setting came from and the invalid ones, printed or reported
+// by -check.
+var (
+	resolvedSettings []settings.Setting
+	settingProblems  settings.Errors
 )
 
 func init() {
-	// Set defaults from environment variables if present
-	if envListenAddress := os.Getenv("LISTEN_ADDRESS"); envListenAddress != "" {
-		err := flag.Set("listen", envListenAddress)
-		if err != nil {
-			fmt.Printf("Error setting listen flag: %v\n", err)
+	flag.Parse()
+
+	// Fill in flags from environment variables and check them all
+	resolvedSettings, settingProblems = resolveFlags()
+}
+
+// InstanceConfig is what bedrock_server is started with besides the
+// wrapper's environment. Ulimits are "soft" or "soft:hard", either of which
+// may be "unlimited"; the umask is octal.
+type InstanceConfig struct {
+	Env     map[string]string `json:"env,omitempty"`
+	Ulimits map[string]string `json:"ulimits,omitempty"` // e.g. "nofile": "65536"
+	Umask   string            `json:"umask,omitempty"`
+}
+
+// loadEnvironment reads the instance config, if any, into the environment
+// bedrock_server starts with. The server's libraries are loaded from its
+// directory unless LD_LIBRARY_PATH is configured.
+func loadEnvironment(path string) (runner.Environment, error) {
+	env := runner.Environment{Vars: map[string]string{"LD_LIBRARY_PATH": "."}}
+
+	if path == "" {
+		return env, nil
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return env, fmt.Errorf("error reading instance config: %w", err)
+	}
+
+	var cfg InstanceConfig
+
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return env, fmt.Errorf("error parsing instance config: %w", err)
+	}
+
+	for name, value := range cfg.Env {
+		env.Vars[name] = value
+	}
+
+	if len(cfg.Ulimits) > 0 {
+		env.Limits = make(map[string]runner.Limit, len(cfg.Ulimits))
+
+		for name, value := range cfg.Ulimits {
+			limit, err := runner.ParseLimit(value)
+			if err != nil {
+				return env, fmt.Errorf("error in %s ulimit: %w", name, err)
+			}
+
+			env.Limits[name] = limit
 		}
 	}
 
-	if envAppDir := os.Getenv("APP_DIR"); envAppDir != "" {
-		err := flag.Set("app-dir", envAppDir)
+	if cfg.Umask != "" {
+		umask, err := runner.ParseUmask(cfg.Umask)
 		if err != nil {
-			fmt.Printf("Error setting app-dir flag: %v\n", err)
+			return env, err
 		}
+
+		env.Umask = &umask
 	}
 
-	if envMcVer := os.Getenv("MINECRAFT_VER"); envMcVer != "" {
-		err := flag.Set("mc-version", envMcVer)
+	return env, nil
+}
+
+// prepareServer downloads bedrock_server and updates its properties, before
+// it is started. Without a version the installed server is run as is. A
+// rollback point is taken before another version is installed, if enabled.
+func prepareServer(workDir string, points *rollback.Store) {
+	if *mcVersion == "" {
+		useInstalledServer(workDir)
+	} else {
+		takeUpgradePoint(workDir, points)
+
+		fmt.Printf("Downloading Minecraft server version %s...\n", *mcVersion)
+
+		err := downloader.DownloadMinecraftServer(*mcVersion, workDir, "")
 		if err != nil {
-			fmt.Printf("Error setting mc-version flag: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error downloading server: %v\n", err)
+			os.Exit(1)
 		}
+
+		err = downloader.WriteManifest(workDir, *mcVersion)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: installed version not recorded: %v\n", err)
+		}
+	}
+
+	// Update server properties from environment variables
+	err := config.UpdateServerProperties(workDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating server properties: %v\n", err)
+		os.Exit(1)
 	}
 
-	if envAuthKey := os.Getenv("AUTH_KEY"); envAuthKey != "" {
-		err := flag.Set("auth-key", envAuthKey)
+	// Enable the content log so pack errors show up on the console
+	if *contentLog {
+		err = config.EnsureProperties(workDir, contentlog.Properties)
 		if err != nil {
-			fmt.Printf("Error setting auth-key flag: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error enabling content log: %v\n", err)
+			os.Exit(1)
 		}
 	}
+}
+
+// useInstalledServer checks there is a server to run when no version is
+// given, exiting otherwise.
+// takeUpgradePoint takes a rollback point before bedrock_server is upgraded
+// or downgraded, exiting if it fails so the worlds are never converted
+// without a backup. Fresh installs and reinstalls of the same version are
+// skipped.
+func takeUpgradePoint(workDir string, points *rollback.Store) {
+	if points == nil {
+		return
+	}
 
-	flag.Parse()
+	manifest, err := downloader.ReadManifest(workDir)
+	if err != nil || manifest.Version == *mcVersion {
+		return
+	}
 
-	// Ensure we have an auth key
-	if *authKey == "" {
-		fmt.Fprintf(os.Stderr, "Error: Authentication key is required.\n")
-		fmt.Fprintf(os.Stderr, "       Set it using the AUTH_KEY environment variable or --auth-key flag\n")
+	p, err := points.Take(workDir, rollback.Point{
+		Reason: rollback.ReasonUpgrade,
+		Detail: fmt.Sprintf("bedrock_server %s to %s", manifest.Version, *mcVersion),
+		Actor:  "wrapper",
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error taking a safety backup before the upgrade (disable with -safety-backups=false): %v\n",
+			err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Rollback point %s taken before upgrading from %s\n", p.ID, manifest.Version)
+}
+
+func useInstalledServer(workDir string) {
+	serverPath := *command
+	if !filepath.IsAbs(serverPath) {
+		serverPath = filepath.Join(workDir, serverPath)
+	}
+
+	_, err := os.Stat(serverPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Minecraft version is required, no server is installed in %s.\n", workDir)
+		fmt.Fprintf(os.Stderr, "       Set it using the MINECRAFT_VER environment variable or --mc-version flag\n")
 		os.Exit(1)
 	}
+
+	manifest, err := downloader.ReadManifest(workDir)
+	if err != nil {
+		fmt.Printf("Running installed Minecraft server, version unknown (%v)\n", err)
+		return
+	}
+
+	fmt.Printf("Running installed Minecraft server version %s\n", manifest.Version)
 }
 
 func main() {
-	_ = os.Setenv("LD_LIBRARY_PATH", ".")
+	// Validate the deployment without downloading or starting anything
+	if *checkMode {
+		os.Exit(runCheck(settingProblems))
+	}
+
+	fmt.Printf("Starting %s\n", build)
+	printSettings(resolvedSettings, settingProblems)
 
 	// Check if EULA_ACCEPT is set to true
 	if eula := os.Getenv("EULA_ACCEPT"); eula != "true" {
@@ -70,9 +382,48 @@ func main() {
 		os.Exit(1)
 	}
 
-	if *mcVersion == "" {
-		fmt.Fprintf(os.Stderr, "Error: Minecraft version is required.\n")
-		fmt.Fprintf(os.Stderr, "       Set it using the MINECRAFT_VER environment variable or --mc-version flag\n")
+	keepalive := server.KeepaliveConfig{
+		PingInterval:     *pingInterval,
+		PongWait:         *pongWait,
+		WriteWait:        *writeWait,
+		HandshakeTimeout: *handshakeTimeout,
+		IdleTimeout:      *idleTimeout,
+	}
+
+	err := keepalive.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in WebSocket keepalive settings: %v\n", err)
+		os.Exit(1)
+	}
+
+	mode, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in socket mode: %v\n", err)
+		os.Exit(1)
+	}
+
+	httpConfig := server.HTTPConfig{
+		ReadHeaderTimeout: *readHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *httpIdleTimeout,
+		TLSCert:           *tlsCert,
+		TLSKey:            *tlsKey,
+		SocketMode:        fs.FileMode(mode),
+		SocketGroup:       *socketGroup,
+	}
+
+	err = httpConfig.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in HTTP settings: %v\n", err)
+		os.Exit(1)
+	}
+
+	clientLimits := server.ClientLimits{Max: *maxClients, PerIP: *maxClientsPerIP}
+
+	err = clientLimits.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in WebSocket client limits: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -90,50 +441,540 @@ func main() {
 		}
 	}
 
-	// Download server
-	fmt.Printf("Downloading Minecraft server version %s...\n", *mcVersion)
+	// A previous wrapper that updated itself hands over a running server
+	cmdRunner := runner.New(*command, *appDir)
 
-	err := downloader.DownloadMinecraftServer(*mcVersion, workDir, "")
+	adopted, err := cmdRunner.Adopt()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error downloading server: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error adopting handed off server: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Update server properties from environment variables
-	err = config.UpdateServerProperties(workDir)
+	var points *rollback.Store
+
+	if *safetyBackups {
+		points, err = rollback.Open(filepath.Join(workDir, server.RollbackDir), *safetyBackupsKeep)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening rollback points: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var bin *trash.Store
+
+	if *trashEnabled {
+		bin, err = trash.Open(filepath.Join(workDir, server.TrashDir), *trashTTL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening trash: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if adopted {
+		fmt.Printf("Wrapper %s took over running server (pid %d)\n", version, cmdRunner.Pid())
+	} else {
+		prepareServer(workDir, points)
+	}
+
+	// Move bedrock_server behind the proxy, which takes over the public port
+	var (
+		denyList *proxy.DenyList
+		udpProxy *proxy.Proxy
+	)
+
+	if *proxyListen != "" {
+		_, port, err := net.SplitHostPort(*proxyUpstream)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in proxy upstream address: %v\n", err)
+			os.Exit(1)
+		}
+
+		portNumber, err := strconv.Atoi(port)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in proxy upstream port: %v\n", err)
+			os.Exit(1)
+		}
+
+		err = config.EnsureProperties(workDir, map[string]string{
+			"server-port":   port,
+			"server-portv6": strconv.Itoa(portNumber + 1),
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error setting server port for the proxy: %v\n", err)
+			os.Exit(1)
+		}
+
+		denyList, err = proxy.OpenDenyList(filepath.Join(workDir, "denylist.json"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading deny list: %v\n", err)
+			os.Exit(1)
+		}
+
+		udpProxy, err = proxy.Listen(*proxyListen, *proxyUpstream, denyList)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting UDP proxy: %v\n", err)
+			os.Exit(1)
+		}
+
+		go func() {
+			err := udpProxy.Serve()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error in UDP proxy: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+
+		fmt.Printf("UDP proxy forwarding %s to %s\n", *proxyListen, *proxyUpstream)
+	}
+
+	// CPU and I/O controls of bedrock_server
+	cpuList, err := runner.ParseCPUs(*cpus)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error updating server properties: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error in CPU list: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Create command runner
-	cmdRunner := runner.New(*command, *appDir)
+	resources := runner.Resources{
+		CPUs:     cpuList,
+		Nice:     *nice,
+		IOClass:  *ioClass,
+		IOLevel:  *ioLevel,
+		CPUQuota: *cpuQuota,
+	}
+
+	err = resources.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in resource settings: %v\n", err)
+		os.Exit(1)
+	}
 
-	// Start the command
-	err = cmdRunner.Start()
+	restarts := runner.RestartConfig{Policy: *restartPolicy, Backoff: *restartBackoff, MaxBackoff: *restartMaxBackoff}
+
+	err = restarts.Validate()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error starting command: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error in restart settings: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Environment, ulimits and umask of bedrock_server
+	env, err := loadEnvironment(*instanceConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading instance config: %v\n", err)
+		os.Exit(1)
+	}
+
+	// An adopted server is restarted with the environment too
+	err = cmdRunner.SetEnvironment(env)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in instance config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !adopted {
+		// Start the command
+		err = cmdRunner.Start()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting command: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(resources.CPUs) > 0 || resources.Nice != 0 || resources.IOClass != "" || resources.CPUQuota > 0 {
+		err = cmdRunner.ApplyResources(resources)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: not all resource settings were applied: %v\n", err)
+		}
+	}
+
+	// World template catalog
+	if *templatesDir == "" {
+		*templatesDir = filepath.Join(workDir, "templates")
+	}
+
+	var urls []string
+
+	for _, u := range strings.Split(*templateURLs, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+
+	templates := worlds.NewCatalog(*templatesDir, urls)
+
+	// Plugins run as processes speaking JSON over stdio
+	var pluginConfigs []plugins.Config
+
+	if *pluginsConfig != "" {
+		pluginConfigs, err = plugins.LoadConfig(*pluginsConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading plugins: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// New wrapper builds from the GitHub releases
+	var update *selfupdate.Config
+
+	if *updateRepo != "" {
+		update = &selfupdate.Config{
+			Repository: *updateRepo,
+			Binary:     "minecraft-server-wrapper",
+			Current:    version,
+		}
+
+		if *updatePublicKey != "" {
+			update.PublicKey, err = selfupdate.ParsePublicKey(*updatePublicKey)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error in update public key: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	wrapperLabels, err := protocol.ParseLabels(*labels)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in labels: %v\n", err)
+		os.Exit(1)
+	}
+
+	location, err := timezone.Load(*timezoneName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in timezone: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Persistent log of the console, which isn't collapsed
+	var consoleLog *consolelog.Log
+
+	if *consoleLogPath != "" {
+		path := *consoleLogPath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workDir, path)
+		}
+
+		consoleLog, err = consolelog.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening console log: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Redaction of console lines shown to clients
+	var redactor *redact.Redactor
+
+	if *redactConfig != "" {
+		redactor, err = redact.LoadConfig(*redactConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading redaction rules: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	relay := server.RelayConfig{URL: *relayURL, ID: *relayID}
+
+	var pairing server.PairingConfig
+
+	if *pairingEnabled {
+		pairing, err = pairingConfig(httpConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in pairing: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	err = relay.Validate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in relay: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Create and start HTTP server
 	srv := server.New(server.ServerConfig{
-		Runner:  cmdRunner,
-		AuthKey: *authKey,
+		Runner:           cmdRunner,
+		AppDir:           workDir,
+		AuthKey:          *authKey,
+		CentralKey:       *centralKey,
+		Keepalive:        keepalive,
+		Templates:        templates,
+		DenyList:         denyList,
+		Proxy:            udpProxy,
+		Plugins:          pluginConfigs,
+		Update:           update,
+		Build:            build,
+		Labels:           wrapperLabels,
+		MaxLineLength:    *maxLineLength,
+		Location:         location,
+		ConsoleLog:       consoleLog,
+		CollapseRepeats:  *collapseRepeats,
+		Redactor:         redactor,
+		ClientLimits:     clientLimits,
+		HTTP:             httpConfig,
+		Relay:            relay,
+		Pairing:          pairing,
+		DisableFiles:     !*fileManager,
+		DisableBackups:   !*backups,
+		DisableSchedules: !*schedules,
+		Rollback:         points,
+		Trash:            bin,
+		StopTimeout:      *stopTimeout,
+		Headers: server.SecurityHeadersConfig{
+			ContentSecurityPolicy: *csp,
+			ReportOnly:            *cspReportOnly,
+			ReportURI:             *cspReportURI,
+			HSTS:                  *hsts,
+		},
 	})
 
 	go func() {
-		err := srv.Start(*listenAddress)
+		err := srv.Start(server.SplitListen(*listenAddress))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error starting web server: %v\n", err)
 			os.Exit(1)
 		}
 	}()
 
-	// Wait for the command to complete
+	if *pairingEnabled {
+		code, err := srv.NewPairingCode()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening pairing code: %v\n", err)
+		} else {
+			fmt.Printf("Add this wrapper in the central server with the pairing code below within %s:\n\n%s\n\n%s\n",
+				server.PairingTTL, code.Code, code.QR)
+		}
+	}
+
+	// Let the central server find the wrapper on the LAN
+	var responder *mdns.Responder
+
+	if *mdnsEnabled {
+		responder, err = advertise(httpConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Not advertising over mDNS: %v\n", err)
+		}
+	}
+
+	// Force restart bedrock_server if it hangs
+	pingAddress := *proxyUpstream
+
+	if udpProxy == nil {
+		port := "19132"
+
+		props, err := config.ReadProperties(workDir)
+		if err == nil && props["server-port"] != "" {
+			port = props["server-port"]
+		}
+
+		pingAddress = net.JoinHostPort("127.0.0.1", port)
+	}
+
+	go srv.RunAnnouncements()
+	go srv.RunRepeats()
+	go srv.RunSchedules(pingAddress)
+	go srv.RunTrash()
+	go srv.RunCapacity(pingAddress)
+
+	// kill -USR2 restarts the wrapper without stopping bedrock_server
+	go restartOnSignal(srv)
+
+	go srv.WatchHangs(server.HangConfig{
+		Silence:      *hangSilence,
+		PingAddress:  pingAddress,
+		PingFailures: *hangPingFailures,
+		Interval:     *hangInterval,
+	})
+
+	// Cap the memory of bedrock_server and restart it in an orderly way
+	// before the kernel OOM-kills it
+	limiter := memlimit.Watch(cmdRunner.Pid())
+
+	if *memoryLimit != "" {
+		limit, err := memlimit.ParseSize(*memoryLimit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in memory limit: %v\n", err)
+			os.Exit(1)
+		}
+
+		limiter, err = memlimit.New(cmdRunner.Pid(), limit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Memory limit not enforced, only watching usage: %v\n", err)
+		}
+
+		go srv.WatchMemory(limiter, server.MemoryConfig{
+			Warn:    *memoryWarn,
+			Restart: *memoryRestart,
+		})
+	}
+
+	// Publish status and player events for home automation
+	if *mqttBroker != "" {
+		srv.StartMQTT(server.MQTTConfig{
+			Broker:      *mqttBroker,
+			ClientID:    *mqttClientID,
+			Username:    *mqttUsername,
+			Password:    *mqttPassword,
+			Topic:       *mqttTopic,
+			Discovery:   *mqttDiscovery,
+			Name:        *mqttName,
+			Interval:    *mqttInterval,
+			PingAddress: pingAddress,
+			Memory:      limiter,
+			Running:     adopted,
+		})
+	}
+
+	// Restart bedrock_server by the restart policy, with the same resource
+	// settings and memory limit
+	restarts.Exited = srv.Restarting
+	restarts.Started = func() {
+		if len(resources.CPUs) > 0 || resources.Nice != 0 || resources.IOClass != "" || resources.CPUQuota > 0 {
+			err := cmdRunner.ApplyResources(resources)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: not all resource settings were applied: %v\n", err)
+			}
+		}
+
+		err := limiter.Follow(cmdRunner.Pid())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error limiting memory of restarted server: %v\n", err)
+		}
+	}
+
+	_ = cmdRunner.SetRestartConfig(restarts)
+
+	// Wait for the command to complete, then for stop requests to be answered
 	err = cmdRunner.Wait()
+
+	srv.WaitStopRequests()
+
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error running command: %v\n", err)
+		srv.Crashed(err)
+		srv.StopPlugins()
+		srv.StopMQTT()
+		_ = responder.Close()
 		os.Exit(1)
 	}
+
+	srv.StopPlugins()
+	srv.StopMQTT()
+	_ = responder.Close()
+}
+
+// advertise advertises the web server on the first TCP listen address over
+// mDNS, under -mdns-name or the host name.
+func advertise(httpConfig server.HTTPConfig) (*mdns.Responder, error) {
+	i := slices.IndexFunc(server.SplitListen(*listenAddress), func(addr string) bool {
+		return !server.IsUnixSocket(addr)
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("no TCP listen address")
+	}
+
+	host, port, err := net.SplitHostPort(server.SplitListen(*listenAddress)[i])
+	if err != nil {
+		return nil, fmt.Errorf("error parsing listen address: %w", err)
+	}
+
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing listen port: %w", err)
+	}
+
+	// A specific IPv4 address is advertised alone, else all of the host's
+	addr := ""
+
+	ip, err := netip.ParseAddr(host)
+	if err == nil && !ip.IsUnspecified() {
+		if !ip.Is4() || ip.IsLoopback() {
+			return nil, fmt.Errorf("listen address %s isn't reachable from the LAN over IPv4", host)
+		}
+
+		addr = host
+	}
+
+	name, err := wrapperName()
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "ws"
+	if httpConfig.TLSCert != "" {
+		scheme = "wss"
+	}
+
+	return mdns.Advertise(mdns.Instance{
+		Name: name,
+		Addr: addr,
+		Port: portNumber,
+		TXT:  map[string]string{"version": version, "scheme": scheme, "path": "/ws"},
+	})
+}
+
+// wrapperName returns the name the wrapper is advertised and paired under,
+// -mdns-name or the host name.
+func wrapperName() (string, error) {
+	if *mdnsName != "" {
+		return *mdnsName, nil
+	}
+
+	name, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("error getting host name: %w", err)
+	}
+
+	return name, nil
+}
+
+// pairingConfig returns the address in pairing codes, -pairing-address or
+// the first TCP listen address. An unspecified host is replaced by the
+// address of the interface with the default route.
+func pairingConfig(httpConfig server.HTTPConfig) (server.PairingConfig, error) {
+	name, err := wrapperName()
+	if err != nil {
+		return server.PairingConfig{}, err
+	}
+
+	if *authKey == "" {
+		return server.PairingConfig{}, fmt.Errorf("pairing hands out the auth key, which isn't set")
+	}
+
+	if *pairingAddress != "" {
+		u, err := url.Parse(*pairingAddress)
+		if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return server.PairingConfig{}, fmt.Errorf("pairing address %q must be a ws:// or wss:// URL", *pairingAddress)
+		}
+
+		return server.PairingConfig{Address: *pairingAddress, Name: name}, nil
+	}
+
+	i := slices.IndexFunc(server.SplitListen(*listenAddress), func(addr string) bool {
+		return !server.IsUnixSocket(addr)
+	})
+	if i < 0 {
+		return server.PairingConfig{}, fmt.Errorf("no TCP listen address, set -pairing-address")
+	}
+
+	host, port, err := net.SplitHostPort(server.SplitListen(*listenAddress)[i])
+	if err != nil {
+		return server.PairingConfig{}, fmt.Errorf("error parsing listen address: %w", err)
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if host == "" || (err == nil && ip.IsUnspecified()) {
+		// Connecting a UDP socket picks the interface without sending anything
+		conn, err := net.Dial("udp", "192.0.2.1:9")
+		if err != nil {
+			return server.PairingConfig{}, fmt.Errorf("error finding the LAN address, set -pairing-address: %w", err)
+		}
+
+		host = conn.LocalAddr().(*net.UDPAddr).IP.String()
+		_ = conn.Close()
+	}
+
+	scheme := "ws"
+	if httpConfig.TLSCert != "" {
+		scheme = "wss"
+	}
+
+	return server.PairingConfig{Address: scheme + "://" + net.JoinHostPort(host, port) + "/ws", Name: name}, nil
 }
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "github.com/jsandas/gogo-mc-bedrock-server/internal/server"
+
+// restartOnSignal does nothing, as there is no SIGUSR2 to restart on.
+func restartOnSignal(srv *server.Server) {}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/server"
+)
+
+// restartOnSignal re-executes the wrapper in place on SIGUSR2, keeping
+// bedrock_server running, e.g. after editing a config file or installing a
+// new build.
+func restartOnSignal(srv *server.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+
+	for range signals {
+		fmt.Println("Received SIGUSR2, restarting wrapper")
+
+		err := srv.Restart()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error restarting wrapper: %v\n", err)
+		}
+	}
+}
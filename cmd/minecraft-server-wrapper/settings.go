@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/runner"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/server"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/settings"
+)
+
+// envFlags maps environment variables to the flags they set when the flag
+// isn't given on the command line.
+var envFlags = map[string]string{
+	"LISTEN_ADDRESS": "listen",
+	"APP_DIR":        "app-dir",
+	"MINECRAFT_VER":  "mc-version",
+	"AUTH_KEY":       "auth-key",
+	"CENTRAL_KEY":    "central-key",
+
+	"WS_PING_INTERVAL":      "ws-ping-interval",
+	"WS_PONG_WAIT":          "ws-pong-wait",
+	"WS_WRITE_WAIT":         "ws-write-wait",
+	"WS_HANDSHAKE_TIMEOUT":  "ws-handshake-timeout",
+	"WS_IDLE_TIMEOUT":       "ws-idle-timeout",
+	"WS_MAX_CLIENTS":        "ws-max-clients",
+	"WS_MAX_CLIENTS_PER_IP": "ws-max-clients-per-ip",
+	"CONTENT_LOG":           "content-log",
+	"TEMPLATES_DIR":         "templates-dir",
+	"TEMPLATE_URLS":         "template-urls",
+	"PROXY_LISTEN":          "proxy-listen",
+	"PROXY_UPSTREAM":        "proxy-upstream",
+	"HANG_SILENCE":          "hang-silence",
+	"HANG_PING_FAILURES":    "hang-ping-failures",
+	"HANG_CHECK_INTERVAL":   "hang-check-interval",
+	"INSTANCE_CONFIG":       "instance-config",
+	"CPUS":                  "cpus",
+	"NICE":                  "nice",
+	"IO_CLASS":              "io-class",
+	"IO_PRIORITY":           "io-priority",
+	"CPU_QUOTA":             "cpu-quota",
+	"MEMORY_LIMIT":          "memory-limit",
+	"MEMORY_WARN":           "memory-warn",
+	"MEMORY_RESTART":        "memory-restart",
+	"CSP":                   "csp",
+	"CSP_REPORT_ONLY":       "csp-report-only",
+	"CSP_REPORT_URI":        "csp-report-uri",
+	"HSTS":                  "hsts",
+	"PLUGINS_CONFIG":        "plugins-config",
+	"MQTT_BROKER":           "mqtt-broker",
+	"MQTT_CLIENT_ID":        "mqtt-client-id",
+	"MQTT_USERNAME":         "mqtt-username",
+	"MQTT_PASSWORD":         "mqtt-password",
+	"MQTT_TOPIC":            "mqtt-topic",
+	"MQTT_DISCOVERY":        "mqtt-discovery",
+	"MQTT_NAME":             "mqtt-name",
+	"MQTT_INTERVAL":         "mqtt-interval",
+	"UPDATE_REPO":           "update-repo",
+	"UPDATE_PUBLIC_KEY":     "update-public-key",
+	"LABELS":                "labels",
+	"CONSOLE_LOG":           "console-log",
+	"COLLAPSE_REPEATS":      "collapse-repeats",
+	"REDACT_CONFIG":         "redact-config",
+
+	"HTTP_READ_HEADER_TIMEOUT": "http-read-header-timeout",
+	"HTTP_READ_TIMEOUT":        "http-read-timeout",
+	"HTTP_WRITE_TIMEOUT":       "http-write-timeout",
+	"HTTP_IDLE_TIMEOUT":        "http-idle-timeout",
+	"TLS_CERT":                 "tls-cert",
+	"TLS_KEY":                  "tls-key",
+	"SOCKET_MODE":              "socket-mode",
+	"SOCKET_GROUP":             "socket-group",
+	"RELAY_URL":                "relay-url",
+	"RELAY_ID":                 "relay-id",
+	"PAIRING":                  "pairing",
+	"PAIRING_ADDRESS":          "pairing-address",
+}
+
+// secretFlags are masked in the settings table.
+var secretFlags = []string{"auth-key", "central-key", "mqtt-password"}
+
+// mqttSchemes are the broker URL schemes the MQTT client connects with.
+var mqttSchemes = []string{"tcp", "ssl", "tls", "mqtt", "mqtts", "ws", "wss"}
+
+// resolveFlags sets the flags from the environment and checks them,
+// returning where each value came from and every invalid setting.
+func resolveFlags() ([]settings.Setting, settings.Errors) {
+	resolved, err := settings.Flags(flag.CommandLine, envFlags, os.LookupEnv, secretFlags...)
+
+	var problems settings.Errors
+
+	if errs, ok := err.(settings.Errors); ok {
+		problems = append(problems, errs...)
+	}
+
+	if errs, ok := checkFlags().(settings.Errors); ok {
+		problems = append(problems, errs...)
+	}
+
+	return resolved, problems
+}
+
+// printSettings prints where each setting came from and exits listing every
+// invalid setting.
+func printSettings(resolved []settings.Setting, problems settings.Errors) {
+	fmt.Println("Settings:")
+	settings.Print(os.Stdout, resolved)
+
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid settings:\n")
+
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "       %s\n", p)
+		}
+
+		os.Exit(1)
+	}
+}
+
+// checkFlags checks the flags against what the wrapper accepts, before
+// anything is started.
+func checkFlags() error {
+	var c settings.Checker
+
+	// Ensure we have an auth key, unless the web server is only reachable
+	// over Unix sockets. The relay checks it too.
+	if c.Required("listen", *listenAddress) {
+		tcp := slices.ContainsFunc(server.SplitListen(*listenAddress), func(addr string) bool {
+			return !server.IsUnixSocket(addr)
+		})
+
+		if *authKey == "" && (tcp || *relayURL != "") {
+			c.Add("auth-key", "is required, set it using the AUTH_KEY environment variable or -auth-key flag")
+		}
+	}
+
+	if *centralKey != "" && *centralKey == *authKey {
+		c.Add("central-key", "must differ from the auth key, or every client would pass for the central server")
+	}
+
+	// Durations of zero disable what they time
+	flag.VisitAll(func(f *flag.Flag) {
+		if d, ok := f.Value.(flag.Getter).Get().(time.Duration); ok {
+			c.Duration(f.Name, d.String(), 0)
+		}
+	})
+
+	c.NotNegative("ws-max-clients", float64(*maxClients))
+	c.NotNegative("ws-max-clients-per-ip", float64(*maxClientsPerIP))
+
+	if *hangSilence > 0 {
+		if *hangPingFailures < 1 {
+			c.Add("hang-ping-failures", "must be at least 1, got %d", *hangPingFailures)
+		}
+
+		if *hangInterval <= 0 {
+			c.Add("hang-check-interval", "must be positive while hang-silence is set")
+		}
+	}
+
+	_, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil {
+		c.Add("socket-mode", "must be octal permissions such as 0660, got %q", *socketMode)
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		c.Add("tls-key", "must be set together with tls-cert")
+	}
+
+	if *proxyListen != "" {
+		_, _, err := net.SplitHostPort(*proxyUpstream)
+		if err != nil {
+			c.Add("proxy-upstream", "must be host:port, got %q", *proxyUpstream)
+		}
+	}
+
+	_, err = runner.ParseCPUs(*cpus)
+	if err != nil {
+		c.Add("cpus", "must be a list of cores such as 0-3,6: %v", err)
+	}
+
+	c.Range("nice", *nice, -20, 19)
+	c.OneOf("io-class", *ioClass, runner.IOClassRealtime, runner.IOClassBestEffort, runner.IOClassIdle)
+	c.Range("io-priority", *ioLevel, 0, 7)
+	c.NotNegative("cpu-quota", *cpuQuota)
+
+	memoryShare := func(name string, share float64) {
+		if share <= 0 || share > 1 {
+			c.Add(name, "must be a share of the memory limit above 0 and up to 1, got %v", share)
+		}
+	}
+
+	memoryShare("memory-warn", *memoryWarn)
+	memoryShare("memory-restart", *memoryRestart)
+
+	if *memoryWarn >= *memoryRestart {
+		c.Add("memory-warn", "must be below memory-restart")
+	}
+
+	i := 0
+
+	for _, u := range strings.Split(*templateURLs, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			c.URL(fmt.Sprintf("template-urls[%d]", i), u, "http", "https")
+			i++
+		}
+	}
+
+	if *mqttBroker != "" {
+		c.URL("mqtt-broker", *mqttBroker, mqttSchemes...)
+
+		if *mqttInterval <= 0 {
+			c.Add("mqtt-interval", "must be positive")
+		}
+	}
+
+	if c.URL("relay-url", *relayURL, "ws", "wss") && *relayURL != "" {
+		c.Required("relay-id", *relayID)
+	}
+
+	c.URL("pairing-address", *pairingAddress, "ws", "wss")
+
+	return c.Err()
+}
@@ -0,0 +1,171 @@
+// Command protocol-conformance checks other implementations of the wrapper
+// protocol for compatibility.
+//
+//	protocol-conformance check -url ws://localhost:8080/ws -auth-key KEY
+//	protocol-conformance wrapper -listen :8080 -auth-key KEY
+//	protocol-conformance fixtures -out DIR
+//
+// check exercises a wrapper, wrapper serves a reference wrapper for a central
+// server to connect to, and fixtures writes the golden frame encodings.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol/conformance"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "check":
+		err = check(os.Args[2:])
+	case "wrapper":
+		err = wrapper(os.Args[2:])
+	case "fixtures":
+		err = fixtures(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: protocol-conformance check|wrapper|fixtures [flags]")
+	os.Exit(2)
+}
+
+// check runs the conformance checks against a wrapper and prints the report
+// as JSON, exiting with status 1 if a check failed.
+func check(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	address := flags.String("url", "ws://localhost:8080/ws", "WebSocket URL of the wrapper")
+	authKey := flags.String("auth-key", os.Getenv("AUTH_KEY"), "pre-shared key of the wrapper (defaults to AUTH_KEY)")
+	wait := flags.Duration("wait", 5*time.Second, "how long to wait for each expected frame")
+	_ = flags.Parse(args)
+
+	header := http.Header{}
+	if *authKey != "" {
+		header.Set("X-Auth-Key", *authKey)
+	}
+
+	report, err := conformance.Check(context.Background(), *address, conformance.Options{Header: header, Wait: *wait})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	err = encoder.Encode(report)
+	if err != nil {
+		return fmt.Errorf("error writing report: %w", err)
+	}
+
+	if !report.Passed() {
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+// wrapper serves a reference wrapper that prints a console line every
+// interval, logging the hello and commands central servers send it.
+func wrapper(args []string) error {
+	flags := flag.NewFlagSet("wrapper", flag.ExitOnError)
+	listen := flags.String("listen", ":8080", "address to serve the reference wrapper on")
+	authKey := flags.String("auth-key", os.Getenv("AUTH_KEY"), "pre-shared key clients must send (defaults to AUTH_KEY)")
+	labels := flags.String("labels", "", "labels sent in the session frame, e.g. environment=test")
+	interval := flags.Duration("interval", time.Second, "interval between console lines")
+	_ = flags.Parse(args)
+
+	w := conformance.NewWrapper(*authKey)
+
+	parsed, err := protocol.ParseLabels(*labels)
+	if err != nil {
+		return err
+	}
+
+	w.Labels = parsed
+
+	go func() {
+		var commands int
+
+		var hello *protocol.Hello
+
+		for n := 1; ; n++ {
+			time.Sleep(*interval)
+			w.Emit(fmt.Sprintf("[%s INFO] Conformance line %d", time.Now().Format("2006-01-02 15:04:05:000"), n))
+
+			if h := w.CentralHello(); h != nil && h != hello {
+				hello = h
+				fmt.Printf("Hello from %s %s, protocol %d, capabilities %v\n", h.Software, h.Version, h.Protocol, h.Capabilities)
+			}
+
+			received := w.Commands()
+			for _, command := range received[commands:] {
+				fmt.Printf("Command: %s\n", command)
+			}
+
+			commands = len(received)
+		}
+	}()
+
+	fmt.Printf("Reference wrapper (epoch %s) listening on %s\n", w.Epoch(), *listen)
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           w,
+		ReadHeaderTimeout: 3 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	return server.ListenAndServe()
+}
+
+// fixtures writes the golden frame encodings to a directory.
+func fixtures(args []string) error {
+	flags := flag.NewFlagSet("fixtures", flag.ExitOnError)
+	out := flags.String("out", "fixtures", "directory to write the fixtures to")
+	_ = flags.Parse(args)
+
+	list, err := conformance.Fixtures()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(*out, 0o755)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", *out, err)
+	}
+
+	for _, fixture := range list {
+		path := filepath.Join(*out, fixture.Name+".json")
+
+		err = os.WriteFile(path, append(fixture.Data, '\n'), 0o644)
+		if err != nil {
+			return fmt.Errorf("error writing %s: %w", path, err)
+		}
+	}
+
+	fmt.Printf("Wrote %d fixtures to %s\n", len(list), *out)
+
+	return nil
+}
@@ -3,6 +3,11 @@ module github.com/jsandas/gogo-mc-bedrock-server
 go 1.24.5
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.5.1
 	github.com/gorilla/websocket v1.5.3
 	github.com/sandertv/go-raknet v1.14.2
+	github.com/yuin/gopher-lua v1.1.2
+	golang.org/x/net v0.44.0
 )
+
+require golang.org/x/sync v0.17.0 // indirect
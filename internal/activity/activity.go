@@ -0,0 +1,362 @@
+// Package activity records player sessions across servers and reports
+// playtime per player and per server.
+package activity
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/events"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// Session is a period a player spent on a server. End is zero while the
+// player is online.
+type Session struct {
+	Server string    `json:"server"`
+	Player string    `json:"player"`
+	XUID   string    `json:"xuid,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end,omitempty"`
+
+	Country     string `json:"country,omitempty"` // Where the player connected from, if GeoIP is enabled
+	CountryName string `json:"country_name,omitempty"`
+	Continent   string `json:"continent,omitempty"`
+}
+
+// duration returns the length of the session, counting open sessions up to now.
+func (s Session) duration(now time.Time) time.Duration {
+	end := s.End
+	if end.IsZero() {
+		end = now
+	}
+
+	if end.Before(s.Start) {
+		return 0
+	}
+
+	return end.Sub(s.Start)
+}
+
+// ServerPlaytime is a player's activity on a single server.
+type ServerPlaytime struct {
+	Server    string        `json:"server"`
+	Sessions  int           `json:"sessions"`
+	Playtime  time.Duration `json:"-"`
+	Seconds   int64         `json:"playtime_seconds"`
+	FirstSeen time.Time     `json:"first_seen"`
+	LastSeen  time.Time     `json:"last_seen"`
+	Online    bool          `json:"online"`
+	Country   string        `json:"country,omitempty"` // Country of the latest located session
+}
+
+// PlayerReport summarizes a player's activity across all servers.
+type PlayerReport struct {
+	Player   string           `json:"player"`
+	XUID     string           `json:"xuid,omitempty"`
+	Playtime time.Duration    `json:"-"`
+	Seconds  int64            `json:"playtime_seconds"`
+	LastSeen time.Time        `json:"last_seen"`
+	Country  string           `json:"country,omitempty"` // Country of the latest located session
+	Servers  []ServerPlaytime `json:"servers"`
+}
+
+// state is the persisted form of the store.
+type state struct {
+	Sessions []Session            `json:"sessions"`
+	Epochs   map[string]string    `json:"epochs"`          // Last known wrapper session epoch per server
+	Latest   map[string]time.Time `json:"last_events"`     // Time of the newest recorded event per server
+	Fired    map[string]bool      `json:"fired,omitempty"` // Playtime rules that ran, by server, rule and player
+}
+
+// Store records player sessions and persists them to a JSON file.
+type Store struct {
+	path  string
+	mu    sync.RWMutex
+	state state
+	now   func() time.Time
+}
+
+// Open loads the store from path, starting empty if the file doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		state: state{
+			Epochs: make(map[string]string),
+			Latest: make(map[string]time.Time),
+		},
+		now: time.Now,
+	}
+
+	err := jsonfile.Load(path, &s.state)
+	if err != nil {
+		return nil, fmt.Errorf("error loading activity store: %w", err)
+	}
+
+	if s.state.Epochs == nil {
+		s.state.Epochs = make(map[string]string)
+	}
+
+	if s.state.Latest == nil {
+		s.state.Latest = make(map[string]time.Time)
+	}
+
+	return s, nil
+}
+
+// save writes the sessions and epochs out. It is called with s.mu held.
+func (s *Store) save() {
+	if s.path == "" {
+		return
+	}
+
+	err := jsonfile.SaveCompact(s.path, s.state)
+	if err != nil {
+		fmt.Printf("Error saving activity store: %v\n", err)
+	}
+}
+
+// openSession returns the index of the player's open session on server, or -1.
+func (s *Store) openSession(server, player string) int {
+	for i := len(s.state.Sessions) - 1; i >= 0; i-- {
+		session := s.state.Sessions[i]
+		if session.Server == server && session.Player == player && session.End.IsZero() {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Record applies a player event seen on server. Events older than the newest
+// recorded one are ignored, so console lines replayed after a reconnect are
+// not counted twice.
+func (s *Store) Record(server string, e events.Event) {
+	t := e.Time
+	if t.IsZero() {
+		t = s.now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t.Before(s.state.Latest[server]) {
+		return
+	}
+
+	s.state.Latest[server] = t
+	open := s.openSession(server, e.Player)
+
+	switch e.Type {
+	case events.TypeJoin:
+		if open >= 0 {
+			return
+		}
+
+		s.state.Sessions = append(s.state.Sessions, Session{Server: server, Player: e.Player, XUID: e.XUID, Start: t})
+	case events.TypeLeave:
+		if open < 0 {
+			return
+		}
+
+		s.state.Sessions[open].End = t
+	}
+
+	s.save()
+}
+
+// ServerEpoch records the session epoch reported by a server's wrapper. When
+// the epoch changes the server process has restarted, so sessions still open
+// on it are closed.
+func (s *Store) ServerEpoch(server, epoch string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.state.Epochs[server]
+	if previous == epoch {
+		return
+	}
+
+	s.state.Epochs[server] = epoch
+
+	if previous != "" {
+		now := s.now()
+
+		for i := range s.state.Sessions {
+			session := &s.state.Sessions[i]
+			if session.Server == server && session.End.IsZero() {
+				session.End = now
+			}
+		}
+	}
+
+	s.save()
+}
+
+// Players returns a report for every recorded player, most playtime first.
+func (s *Store) Players() []PlayerReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	reports := make(map[string]*PlayerReport)
+	servers := make(map[string]map[string]*ServerPlaytime)
+
+	for _, session := range s.state.Sessions {
+		report, ok := reports[session.Player]
+		if !ok {
+			report = &PlayerReport{Player: session.Player}
+			reports[session.Player] = report
+			servers[session.Player] = make(map[string]*ServerPlaytime)
+		}
+
+		if session.XUID != "" {
+			report.XUID = session.XUID
+		}
+
+		sp, ok := servers[session.Player][session.Server]
+		if !ok {
+			sp = &ServerPlaytime{Server: session.Server, FirstSeen: session.Start}
+			servers[session.Player][session.Server] = sp
+		}
+
+		d := session.duration(now)
+		last := session.Start.Add(d)
+
+		sp.Sessions++
+		sp.Playtime += d
+		sp.Online = sp.Online || session.End.IsZero()
+
+		if session.Country != "" {
+			sp.Country = session.Country
+			report.Country = session.Country
+		}
+
+		if session.Start.Before(sp.FirstSeen) {
+			sp.FirstSeen = session.Start
+		}
+
+		if last.After(sp.LastSeen) {
+			sp.LastSeen = last
+		}
+
+		report.Playtime += d
+
+		if last.After(report.LastSeen) {
+			report.LastSeen = last
+		}
+	}
+
+	list := make([]PlayerReport, 0, len(reports))
+
+	for name, report := range reports {
+		for _, sp := range servers[name] {
+			sp.Seconds = int64(sp.Playtime.Seconds())
+			report.Servers = append(report.Servers, *sp)
+		}
+
+		report.Seconds = int64(report.Playtime.Seconds())
+
+		sort.Slice(report.Servers, func(i, j int) bool {
+			return report.Servers[i].Server < report.Servers[j].Server
+		})
+
+		list = append(list, *report)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Playtime != list[j].Playtime {
+			return list[i].Playtime > list[j].Playtime
+		}
+
+		return list[i].Player < list[j].Player
+	})
+
+	return list
+}
+
+// Player returns the report for a single player, matched case-insensitively.
+func (s *Store) Player(name string) (PlayerReport, bool) {
+	for _, report := range s.Players() {
+		if strings.EqualFold(report.Player, name) {
+			return report, true
+		}
+	}
+
+	return PlayerReport{}, false
+}
+
+// PlayerTotal is a player's playtime on one server.
+type PlayerTotal struct {
+	Player   string        `json:"player"`
+	Sessions int           `json:"sessions"`
+	Playtime time.Duration `json:"-"`
+	Seconds  int64         `json:"playtime_seconds"`
+}
+
+// Top returns the players with the most playtime on server. A limit of zero
+// or less returns all of them.
+func (s *Store) Top(server string, limit int) []PlayerTotal {
+	top := []PlayerTotal{}
+
+	for _, report := range s.Players() {
+		for _, sp := range report.Servers {
+			if sp.Server == server {
+				top = append(top, PlayerTotal{
+					Player:   report.Player,
+					Sessions: sp.Sessions,
+					Playtime: sp.Playtime,
+					Seconds:  sp.Seconds,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].Playtime > top[j].Playtime
+	})
+
+	if limit > 0 && len(top) > limit {
+		top = top[:limit]
+	}
+
+	return top
+}
+
+// WriteCSV writes one row per player and server with the session count and
+// playtime in seconds.
+func (s *Store) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"player", "xuid", "server", "sessions", "playtime_seconds", "first_seen", "last_seen"})
+	if err != nil {
+		return err
+	}
+
+	for _, report := range s.Players() {
+		for _, sp := range report.Servers {
+			err = cw.Write([]string{
+				report.Player,
+				report.XUID,
+				sp.Server,
+				strconv.Itoa(sp.Sessions),
+				strconv.FormatInt(sp.Seconds, 10),
+				sp.FirstSeen.Format(time.RFC3339),
+				sp.LastSeen.Format(time.RFC3339),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
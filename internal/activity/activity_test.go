@@ -0,0 +1,153 @@
+package activity
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/events"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/geoip"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "activity.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	base := time.Date(2024, 6, 14, 9, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return base.Add(3 * time.Hour) }
+
+	store.Record("s1", events.Event{Time: base, Type: events.TypeJoin, Player: "Steve", XUID: "1"})
+	store.Record("s1", events.Event{Time: base.Add(time.Hour), Type: events.TypeLeave, Player: "Steve"})
+	store.Record("s2", events.Event{Time: base, Type: events.TypeJoin, Player: "Alex"})
+	store.Record("s2", events.Event{Time: base.Add(time.Hour), Type: events.TypeJoin, Player: "Steve"})
+
+	// A replayed line is ignored
+	store.Record("s1", events.Event{Time: base, Type: events.TypeJoin, Player: "Steve"})
+
+	report, ok := store.Player("steve")
+	if !ok {
+		t.Fatalf("Expected a report for Steve")
+	}
+
+	if report.Playtime != 3*time.Hour || len(report.Servers) != 2 || report.XUID != "1" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	if !report.Servers[1].Online || report.Servers[0].Sessions != 1 {
+		t.Errorf("Unexpected server playtime: %+v", report.Servers)
+	}
+
+	top := store.Top("s2", 1)
+	if len(top) != 1 || top[0].Player != "Alex" || top[0].Playtime != 3*time.Hour {
+		t.Errorf("Unexpected top players: %+v", top)
+	}
+
+	// A restarted server closes its open sessions
+	store.ServerEpoch("s2", "a")
+	store.ServerEpoch("s2", "b")
+
+	report, _ = store.Player("Alex")
+	if report.Servers[0].Online {
+		t.Errorf("Expected Alex's session to be closed after a restart")
+	}
+
+	// The store is persisted
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	if len(reopened.Players()) != 2 {
+		t.Errorf("Expected 2 players after reopening, got %+v", reopened.Players())
+	}
+
+	var buf bytes.Buffer
+
+	err = store.WriteCSV(&buf)
+	if err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(buf.String(), "\nSteve,1,s1,1,3600,") {
+		t.Errorf("Unexpected CSV: %q", buf.String())
+	}
+}
+
+func TestDue(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "activity.json"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	base := time.Date(2024, 6, 14, 9, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return base.Add(2 * time.Hour) }
+
+	store.Record("s1", events.Event{Time: base, Type: events.TypeJoin, Player: "Steve Jobs", XUID: "1"})
+	store.Record("s1", events.Event{Time: base, Type: events.TypeJoin, Player: "Alex"})
+	store.Record("s1", events.Event{Time: base.Add(time.Hour), Type: events.TypeLeave, Player: "Alex"})
+
+	rules := []Rule{
+		{Name: "regular", Threshold: time.Hour, Command: "tag {player} add regular"},
+		{Name: "veteran", Threshold: 10 * time.Hour, Command: "tag {player} add veteran"},
+	}
+
+	// Alex is offline and Steve hasn't reached the veteran threshold
+	due := store.Due("s1", rules)
+	if len(due) != 1 || due[0].Command != `tag "Steve Jobs" add regular` {
+		t.Fatalf("Unexpected triggers: %+v", due)
+	}
+
+	store.Fired("s1", due[0])
+
+	due = store.Due("s1", rules)
+	if len(due) != 0 {
+		t.Errorf("Expected fired rules not to trigger again, got %+v", due)
+	}
+
+	if len(store.Due("s2", rules)) != 0 {
+		t.Errorf("Expected no triggers on another server")
+	}
+}
+
+func TestOrigins(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "activity.json"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	base := time.Date(2024, 6, 14, 9, 0, 0, 0, time.UTC)
+
+	store.Record("s1", events.Event{Time: base, Type: events.TypeJoin, Player: "Steve"})
+	store.Locate("s1", "Steve", geoip.Location{Country: "DE", CountryName: "Germany", Continent: "EU"})
+	store.Record("s1", events.Event{Time: base, Type: events.TypeJoin, Player: "Alex"})
+	store.Locate("s1", "Alex", geoip.Location{Country: "DE", Continent: "EU"})
+	store.Record("s2", events.Event{Time: base, Type: events.TypeJoin, Player: "Herobrine"})
+
+	// Offline players are not located
+	store.Locate("s2", "Steve", geoip.Location{Country: "AU"})
+
+	origins := store.Origins("")
+	if len(origins) != 2 || origins[0].Country != "DE" || origins[0].Players != 2 || origins[0].CountryName != "Germany" {
+		t.Fatalf("Unexpected origins: %+v", origins)
+	}
+
+	if origins[1].Country != "" || origins[1].Sessions != 1 {
+		t.Errorf("Expected one unlocated session, got %+v", origins[1])
+	}
+
+	if len(store.Origins("s2")) != 1 {
+		t.Errorf("Expected origins of s2 only, got %+v", store.Origins("s2"))
+	}
+
+	report, _ := store.Player("Steve")
+	if report.Country != "DE" || report.Servers[0].Country != "DE" {
+		t.Errorf("Unexpected report country: %+v", report)
+	}
+}
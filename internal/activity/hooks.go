@@ -0,0 +1,92 @@
+package activity
+
+import (
+	"strings"
+	"time"
+)
+
+// Rule runs a console command once for each player whose playtime on a
+// server reaches Threshold.
+type Rule struct {
+	Name      string        `json:"name"` // Identifies the rule so it fires only once per player
+	Threshold time.Duration `json:"threshold"`
+	Command   string        `json:"command"` // {player} and {xuid} are replaced
+}
+
+// Trigger is a rule that is due for an online player.
+type Trigger struct {
+	Rule    string
+	Player  string
+	Command string
+}
+
+// firedKey identifies a rule that has fired for a player on a server.
+func firedKey(server, rule, player string) string {
+	return server + "|" + rule + "|" + player
+}
+
+// quotePlayer quotes player names that contain spaces, as required by
+// command selectors.
+func quotePlayer(name string) string {
+	if strings.ContainsAny(name, " \"") {
+		return `"` + strings.ReplaceAll(name, `"`, `\"`) + `"`
+	}
+
+	return name
+}
+
+// Due returns the rules that fire for players currently online on server.
+// Rules are not marked as fired until Fired is called, so a command that
+// couldn't be delivered is retried.
+func (s *Store) Due(server string, rules []Rule) []Trigger {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var due []Trigger
+
+	for _, report := range s.Players() {
+		for _, sp := range report.Servers {
+			if sp.Server != server || !sp.Online {
+				continue
+			}
+
+			for _, rule := range rules {
+				if sp.Playtime < rule.Threshold || s.hasFired(server, rule.Name, report.Player) {
+					continue
+				}
+
+				command := strings.NewReplacer(
+					"{player}", quotePlayer(report.Player),
+					"{xuid}", report.XUID,
+				).Replace(rule.Command)
+
+				due = append(due, Trigger{Rule: rule.Name, Player: report.Player, Command: command})
+			}
+		}
+	}
+
+	return due
+}
+
+// hasFired reports whether a rule already fired for a player on server.
+func (s *Store) hasFired(server, rule, player string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state.Fired[firedKey(server, rule, player)]
+}
+
+// Fired records that a rule's command was sent for a player on server.
+func (s *Store) Fired(server string, t Trigger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state.Fired == nil {
+		s.state.Fired = make(map[string]bool)
+	}
+
+	s.state.Fired[firedKey(server, t.Rule, t.Player)] = true
+
+	s.save()
+}
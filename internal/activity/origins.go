@@ -0,0 +1,85 @@
+package activity
+
+import (
+	"sort"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/geoip"
+)
+
+// Origin is the number of players and sessions seen from one country.
+type Origin struct {
+	Country     string `json:"country"` // Empty for connections that couldn't be located
+	CountryName string `json:"country_name,omitempty"`
+	Continent   string `json:"continent,omitempty"`
+	Players     int    `json:"players"`
+	Sessions    int    `json:"sessions"`
+}
+
+// Locate records where the player's open session on server connects from.
+// Only the coarse location is kept, never the address itself.
+func (s *Store) Locate(server, player string, loc geoip.Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	open := s.openSession(server, player)
+	if open < 0 {
+		return
+	}
+
+	s.state.Sessions[open].Country = loc.Country
+	s.state.Sessions[open].CountryName = loc.CountryName
+	s.state.Sessions[open].Continent = loc.Continent
+
+	s.save()
+}
+
+// Origins returns the countries players connected from, most sessions
+// first. An empty server includes all servers.
+func (s *Store) Origins(server string) []Origin {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	origins := make(map[string]*Origin)
+	players := make(map[string]map[string]bool)
+
+	for _, session := range s.state.Sessions {
+		if server != "" && session.Server != server {
+			continue
+		}
+
+		origin, ok := origins[session.Country]
+		if !ok {
+			origin = &Origin{Country: session.Country}
+			origins[session.Country] = origin
+			players[session.Country] = make(map[string]bool)
+		}
+
+		if session.CountryName != "" {
+			origin.CountryName = session.CountryName
+		}
+
+		if session.Continent != "" {
+			origin.Continent = session.Continent
+		}
+
+		origin.Sessions++
+		players[session.Country][session.Player] = true
+	}
+
+	list := make([]Origin, 0, len(origins))
+
+	for country, origin := range origins {
+		origin.Players = len(players[country])
+		list = append(list, *origin)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Sessions != list[j].Sessions {
+			return list[i].Sessions > list[j].Sessions
+		}
+
+		return list[i].Country < list[j].Country
+	})
+
+	return list
+}
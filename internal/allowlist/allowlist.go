@@ -0,0 +1,288 @@
+// Package allowlist keeps named lists of players that are synchronized to
+// the allowlist.json of several servers, so a family or community can play
+// on all of them.
+package allowlist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// File is the allowlist of bedrock_server in its app directory.
+const File = "allowlist.json"
+
+var (
+	ErrNotFound = errors.New("allowlist not found")
+	ErrInvalid  = errors.New("invalid allowlist")
+
+	namePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// Entry is a player on an allowlist, in the format of allowlist.json.
+type Entry struct {
+	Name               string `json:"name"`
+	XUID               string `json:"xuid,omitempty"`
+	IgnoresPlayerLimit bool   `json:"ignoresPlayerLimit"`
+}
+
+// key identifies the player of an entry. Bedrock matches names without
+// regard to case.
+func (e Entry) key() string {
+	return strings.ToLower(e.Name)
+}
+
+// List is a named list of players.
+type List struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Players     []Entry `json:"players"`
+}
+
+// Validate checks a list, trimming the player names.
+func (l *List) Validate() error {
+	if !namePattern.MatchString(l.Name) {
+		return fmt.Errorf("%w: names may only use letters, digits, _ and -", ErrInvalid)
+	}
+
+	seen := map[string]bool{}
+
+	for i := range l.Players {
+		p := &l.Players[i]
+		p.Name = strings.TrimSpace(p.Name)
+
+		if p.Name == "" || strings.ContainsAny(p.Name, "\r\n") {
+			return fmt.Errorf("%w: player names must be a single non-empty line", ErrInvalid)
+		}
+
+		if seen[p.key()] {
+			return fmt.Errorf("%w: %s is listed twice", ErrInvalid, p.Name)
+		}
+
+		seen[p.key()] = true
+	}
+
+	return nil
+}
+
+// Merge combines the players of several lists, sorted by name. A player on
+// more than one list ignores the player limit if any of them says so.
+func Merge(lists ...List) []Entry {
+	merged := map[string]Entry{}
+
+	for _, l := range lists {
+		for _, p := range l.Players {
+			if existing, ok := merged[p.key()]; ok {
+				p.IgnoresPlayerLimit = p.IgnoresPlayerLimit || existing.IgnoresPlayerLimit
+
+				if p.XUID == "" {
+					p.XUID = existing.XUID
+				}
+			}
+
+			merged[p.key()] = p
+		}
+	}
+
+	return sorted(merged)
+}
+
+// sorted returns the entries sorted by name.
+func sorted(entries map[string]Entry) []Entry {
+	list := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].key() < list[j].key()
+	})
+
+	return list
+}
+
+// Diff is how a server's allowlist differs from the wanted one.
+type Diff struct {
+	Added   []Entry `json:"added,omitempty"`
+	Removed []Entry `json:"removed,omitempty"`
+	Changed []Entry `json:"changed,omitempty"` // Same player, other XUID or player limit
+}
+
+// Empty reports whether the allowlists are the same.
+func (d Diff) Empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Changed) == 0
+}
+
+// Compare returns what changes from current to wanted, and the allowlist
+// to write. With keep, players only on the current allowlist stay on it.
+// An XUID Bedrock filled in is kept unless wanted names another.
+func Compare(current, wanted []Entry, keep bool) (Diff, []Entry) {
+	var diff Diff
+
+	have := map[string]Entry{}
+	for _, e := range current {
+		have[e.key()] = e
+	}
+
+	result := map[string]Entry{}
+
+	for _, e := range wanted {
+		old, ok := have[e.key()]
+
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, e)
+		case e.XUID == "" && old.XUID != "":
+			e.XUID = old.XUID
+			fallthrough
+		default:
+			if e.XUID != old.XUID || e.IgnoresPlayerLimit != old.IgnoresPlayerLimit {
+				diff.Changed = append(diff.Changed, e)
+			}
+		}
+
+		result[e.key()] = e
+	}
+
+	for _, e := range current {
+		if _, ok := result[e.key()]; ok {
+			continue
+		}
+
+		if keep {
+			result[e.key()] = e
+			continue
+		}
+
+		diff.Removed = append(diff.Removed, e)
+	}
+
+	return diff, sorted(result)
+}
+
+// Parse reads an allowlist.json. An empty file is an empty allowlist.
+func Parse(data []byte) ([]Entry, error) {
+	var entries []Entry
+
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return entries, nil
+	}
+
+	err := json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing allowlist: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Store keeps named lists in a JSON file.
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	lists map[string]List
+}
+
+// Open loads the store at path, starting empty if it doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, lists: map[string]List{}}
+
+	var lists []List
+
+	err := jsonfile.Load(path, &lists)
+	if err != nil {
+		return nil, fmt.Errorf("error loading allowlists: %w", err)
+	}
+
+	for _, l := range lists {
+		s.lists[l.Name] = l
+	}
+
+	return s, nil
+}
+
+// list returns the lists sorted by name. The caller must hold the lock.
+func (s *Store) list() []List {
+	lists := make([]List, 0, len(s.lists))
+	for _, l := range s.lists {
+		lists = append(lists, l)
+	}
+
+	sort.Slice(lists, func(i, j int) bool {
+		return lists[i].Name < lists[j].Name
+	})
+
+	return lists
+}
+
+// save writes every list to the store file. The caller holds s.mu.
+func (s *Store) save() error {
+	err := jsonfile.Save(s.path, s.list())
+	if err != nil {
+		return fmt.Errorf("error saving allowlists: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the lists sorted by name.
+func (s *Store) List() []List {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list()
+}
+
+// Get returns a list by name.
+func (s *Store) Get(name string) (List, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lists[name]
+	if !ok {
+		return List{}, ErrNotFound
+	}
+
+	return l, nil
+}
+
+// Set adds a list, or replaces the one with the same name, and reports
+// whether it was added.
+func (s *Store) Set(l List) (List, bool, error) {
+	err := l.Validate()
+	if err != nil {
+		return List{}, false, err
+	}
+
+	if l.Players == nil {
+		l.Players = []Entry{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.lists[l.Name]
+	s.lists[l.Name] = l
+
+	return l, !exists, s.save()
+}
+
+// Delete removes a list.
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lists[name]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.lists, name)
+
+	return s.save()
+}
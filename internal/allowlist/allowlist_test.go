@@ -0,0 +1,122 @@
+package allowlist
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	l := List{Name: "family", Players: []Entry{{Name: " Steve "}, {Name: "Alex"}}}
+
+	err := l.Validate()
+	if err != nil || l.Players[0].Name != "Steve" {
+		t.Fatalf("Expected a valid list with trimmed names, got %v, %+v", err, l.Players)
+	}
+
+	for _, l := range []List{
+		{Name: "bad name"},
+		{Name: "ok", Players: []Entry{{Name: ""}}},
+		{Name: "ok", Players: []Entry{{Name: "Steve"}, {Name: "steve"}}},
+	} {
+		err := l.Validate()
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", l, err)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	family := List{Name: "family", Players: []Entry{{Name: "Steve", XUID: "1"}, {Name: "Alex"}}}
+	friends := List{Name: "friends", Players: []Entry{{Name: "steve", IgnoresPlayerLimit: true}, {Name: "Bob"}}}
+
+	got := Merge(family, friends)
+	want := []Entry{{Name: "Alex"}, {Name: "Bob"}, {Name: "steve", XUID: "1", IgnoresPlayerLimit: true}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	current := []Entry{{Name: "Steve", XUID: "1"}, {Name: "Alex", XUID: "2"}, {Name: "Herobrine"}}
+	wanted := []Entry{{Name: "steve"}, {Name: "Alex", IgnoresPlayerLimit: true}, {Name: "Bob"}}
+
+	diff, result := Compare(current, wanted, false)
+
+	want := Diff{
+		Added:   []Entry{{Name: "Bob"}},
+		Removed: []Entry{{Name: "Herobrine"}},
+		Changed: []Entry{{Name: "Alex", XUID: "2", IgnoresPlayerLimit: true}},
+	}
+
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("Compare() diff = %+v, want %+v", diff, want)
+	}
+
+	wantResult := []Entry{{Name: "Alex", XUID: "2", IgnoresPlayerLimit: true}, {Name: "Bob"}, {Name: "steve", XUID: "1"}}
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("Compare() result = %+v, want %+v", result, wantResult)
+	}
+
+	diff, result = Compare(current, wanted, true)
+	if len(diff.Removed) != 0 || len(result) != 4 {
+		t.Errorf("Expected Herobrine to be kept, got %+v, %+v", diff, result)
+	}
+
+	if diff, _ := Compare(result, result, false); !diff.Empty() {
+		t.Errorf("Expected no changes, got %+v", diff)
+	}
+}
+
+func TestParse(t *testing.T) {
+	entries, err := Parse([]byte(`[{"ignoresPlayerLimit": false, "name": "Steve", "xuid": "1"}]`))
+	if err != nil || !reflect.DeepEqual(entries, []Entry{{Name: "Steve", XUID: "1"}}) {
+		t.Errorf("Unexpected entries %+v, %v", entries, err)
+	}
+
+	entries, err = Parse([]byte(" \n"))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Expected an empty allowlist, got %+v, %v", entries, err)
+	}
+
+	_, err = Parse([]byte("{"))
+	if err == nil {
+		t.Error("Expected invalid JSON to fail")
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlists.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	_, added, err := store.Set(List{Name: "family", Players: []Entry{{Name: "Steve"}}})
+	if err != nil || !added {
+		t.Fatalf("Expected the list to be added, got %v, %v", added, err)
+	}
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	l, err := store.Get("family")
+	if err != nil || len(l.Players) != 1 {
+		t.Errorf("Expected the list to be saved, got %+v, %v", l, err)
+	}
+
+	err = store.Delete("family")
+	if err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+
+	_, err = store.Get("family")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the list to be gone, got %v", err)
+	}
+}
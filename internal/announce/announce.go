@@ -0,0 +1,261 @@
+// Package announce keeps rotating chat announcements and works out when
+// they are due.
+package announce
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rawtext"
+)
+
+const (
+	// ModeSay sends messages with "say", prefixed with [Server].
+	ModeSay = "say"
+
+	// ModeTellraw sends messages with "tellraw @a", without a prefix.
+	// Formatting codes like §e work in both modes.
+	ModeTellraw = "tellraw"
+)
+
+var (
+	ErrNotFound = errors.New("announcement not found")
+	ErrInvalid  = errors.New("invalid announcement")
+)
+
+// Announcement is a set of messages sent in turn on an interval, at times
+// of day, or both.
+type Announcement struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Messages []string `json:"messages"`
+	Mode     string   `json:"mode"`
+	Interval int      `json:"interval_minutes,omitempty"`
+	Times    []string `json:"times,omitempty"` // HH:MM, in the wrapper's timezone
+	Enabled  bool     `json:"enabled"`
+}
+
+// Validate checks an announcement, filling in the default mode.
+func (a *Announcement) Validate() error {
+	if a.Mode == "" {
+		a.Mode = ModeSay
+	}
+
+	if a.Mode != ModeSay && a.Mode != ModeTellraw {
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalid, a.Mode)
+	}
+
+	if len(a.Messages) == 0 {
+		return fmt.Errorf("%w: no messages", ErrInvalid)
+	}
+
+	for _, m := range a.Messages {
+		// A line break would end the console command early and run the
+		// rest as another command
+		if strings.TrimSpace(m) == "" || strings.ContainsAny(m, "\r\n") {
+			return fmt.Errorf("%w: messages must be a single non-empty line", ErrInvalid)
+		}
+	}
+
+	if a.Interval < 0 {
+		return fmt.Errorf("%w: negative interval", ErrInvalid)
+	}
+
+	for _, t := range a.Times {
+		_, err := time.Parse("15:04", t)
+		if err != nil {
+			return fmt.Errorf("%w: time %q isn't HH:MM", ErrInvalid, t)
+		}
+	}
+
+	if a.Interval == 0 && len(a.Times) == 0 {
+		return fmt.Errorf("%w: needs an interval or times", ErrInvalid)
+	}
+
+	return nil
+}
+
+// Command returns the console command that sends a message.
+func (a Announcement) Command(message string) string {
+	if a.Mode == ModeTellraw {
+		commands, err := rawtext.Text(message).Commands()
+		if err == nil {
+			return commands[0]
+		}
+	}
+
+	return "say " + message
+}
+
+// due reports whether an announcement last sent at last (or, if it hasn't
+// been sent, enabled at since) is due at now.
+func (a Announcement) due(now, last, since time.Time) bool {
+	if a.Interval > 0 {
+		from := last
+		if from.IsZero() {
+			from = since
+		}
+
+		if now.Sub(from) >= time.Duration(a.Interval)*time.Minute {
+			return true
+		}
+	}
+
+	minute := now.Truncate(time.Minute)
+
+	for _, t := range a.Times {
+		if now.Format("15:04") == t && last.Before(minute) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// state is when an announcement was last sent and which message is next.
+type state struct {
+	since time.Time
+	last  time.Time
+	next  int
+}
+
+// Store keeps announcements in a JSON file.
+type Store struct {
+	path          string
+	mu            sync.Mutex
+	announcements []Announcement
+	state         map[string]*state
+}
+
+// Open loads the store at path, starting empty if it doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, announcements: []Announcement{}, state: map[string]*state{}}
+
+	err := jsonfile.Load(path, &s.announcements)
+	if err != nil {
+		return nil, fmt.Errorf("error loading announcements: %w", err)
+	}
+
+	return s, nil
+}
+
+// save writes the announcements to path, under the lock.
+func (s *Store) save() error {
+	err := jsonfile.Save(s.path, s.announcements)
+	if err != nil {
+		return fmt.Errorf("error saving announcements: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the announcements.
+func (s *Store) List() []Announcement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Announcement{}, s.announcements...)
+}
+
+// Put adds an announcement, or replaces the one with the same ID. New
+// announcements get an ID.
+func (s *Store) Put(a Announcement) (Announcement, error) {
+	err := a.Validate()
+	if err != nil {
+		return Announcement{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a.ID == "" {
+		b := make([]byte, 6)
+
+		_, err := rand.Read(b)
+		if err != nil {
+			return Announcement{}, fmt.Errorf("error generating ID: %w", err)
+		}
+
+		a.ID = hex.EncodeToString(b)
+		s.announcements = append(s.announcements, a)
+	} else {
+		i := s.index(a.ID)
+		if i < 0 {
+			return Announcement{}, ErrNotFound
+		}
+
+		s.announcements[i] = a
+	}
+
+	// Changes restart the rotation
+	delete(s.state, a.ID)
+
+	return a, s.save()
+}
+
+// Delete removes an announcement.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	s.announcements = append(s.announcements[:i], s.announcements[i+1:]...)
+	delete(s.state, id)
+
+	return s.save()
+}
+
+// index returns the position of an announcement, or -1. The caller must
+// hold the lock.
+func (s *Store) index(id string) int {
+	for i, a := range s.announcements {
+		if a.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Due returns the commands for the announcements due at now, moving each on
+// to its next message. Intervals count from when an announcement was first
+// seen, so nothing is sent right after a restart.
+func (s *Store) Due(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var commands []string
+
+	for _, a := range s.announcements {
+		if !a.Enabled {
+			delete(s.state, a.ID)
+			continue
+		}
+
+		st, ok := s.state[a.ID]
+		if !ok {
+			st = &state{since: now}
+			s.state[a.ID] = st
+		}
+
+		if !a.due(now, st.last, st.since) {
+			continue
+		}
+
+		commands = append(commands, a.Command(a.Messages[st.next%len(a.Messages)]))
+		st.last = now
+		st.next = (st.next + 1) % len(a.Messages)
+	}
+
+	return commands
+}
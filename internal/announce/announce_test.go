@@ -0,0 +1,113 @@
+package announce
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	for _, a := range []Announcement{
+		{Messages: []string{"hi"}},
+		{Messages: []string{"hi\nstop"}, Interval: 5},
+		{Messages: []string{"hi"}, Times: []string{"25:00"}},
+		{Messages: []string{"hi"}, Interval: 5, Mode: "title"},
+		{Interval: 5},
+	} {
+		err := a.Validate()
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", a, err)
+		}
+	}
+
+	a := Announcement{Messages: []string{"hi"}, Interval: 5}
+
+	err := a.Validate()
+	if err != nil || a.Mode != ModeSay {
+		t.Errorf("Expected a valid announcement in say mode, got %v, %q", err, a.Mode)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	say := Announcement{Mode: ModeSay}
+	if got := say.Command("Read the rules"); got != "say Read the rules" {
+		t.Errorf("Unexpected command: %s", got)
+	}
+
+	tellraw := Announcement{Mode: ModeTellraw}
+	if got := tellraw.Command(`Say "hi"`); got != `tellraw @a {"rawtext":[{"text":"Say \"hi\""}]}` {
+		t.Errorf("Unexpected command: %s", got)
+	}
+}
+
+func TestDue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "announcements.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	rules, err := store.Put(Announcement{Name: "rules", Messages: []string{"one", "two"}, Interval: 10, Enabled: true})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	_, err = store.Put(Announcement{
+		Name:     "discord",
+		Messages: []string{"discord"},
+		Times:    []string{"12:00"},
+		Enabled:  true,
+	})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 11, 55, 0, 0, time.Local)
+
+	if got := store.Due(start); len(got) != 0 {
+		t.Errorf("Expected nothing right after starting, got %v", got)
+	}
+
+	if got := store.Due(start.Add(5 * time.Minute)); len(got) != 1 || got[0] != "say discord" {
+		t.Errorf("Expected the 12:00 announcement, got %v", got)
+	}
+
+	if got := store.Due(start.Add(5*time.Minute + 30*time.Second)); len(got) != 0 {
+		t.Errorf("Expected a time to be announced once, got %v", got)
+	}
+
+	if got := store.Due(start.Add(10 * time.Minute)); len(got) != 1 || got[0] != "say one" {
+		t.Errorf("Expected the first message, got %v", got)
+	}
+
+	if got := store.Due(start.Add(20 * time.Minute)); len(got) != 1 || got[0] != "say two" {
+		t.Errorf("Expected the second message, got %v", got)
+	}
+
+	rules.Enabled = false
+
+	_, err = store.Put(rules)
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	if got := store.Due(start.Add(30 * time.Minute)); len(got) != 0 {
+		t.Errorf("Expected disabled announcements not to be sent, got %v", got)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	if list := reopened.List(); len(list) != 2 || list[0].Enabled {
+		t.Errorf("Unexpected announcements: %+v", list)
+	}
+
+	err = reopened.Delete("missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
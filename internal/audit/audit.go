@@ -0,0 +1,116 @@
+// Package audit records changes made through the APIs in an append-only
+// JSON lines log.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is a recorded change.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`  // Who made the change
+	Action string    `json:"action"` // What kind of change, e.g. "file.write"
+	Target string    `json:"target"` // What was changed, e.g. a file path
+	Diff   string    `json:"diff,omitempty"`
+}
+
+// Log is an audit log file.
+type Log struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open returns the audit log at path, which is created on the first entry.
+func Open(path string) *Log {
+	return &Log{path: path}
+}
+
+// Path returns the location of the log.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Record appends an entry, timestamping it if needed.
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error encoding audit entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err = os.MkdirAll(filepath.Dir(l.path), 0750)
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+
+	return nil
+}
+
+// Entries returns up to limit of the newest entries, newest first. A limit of
+// zero returns all of them.
+func (l *Log) Entries(limit int) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := []Entry{}
+
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var e Entry
+
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit log: %w", err)
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
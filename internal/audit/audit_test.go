@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	log := Open(filepath.Join(t.TempDir(), "logs", "audit.log"))
+
+	entries, err := log.Entries(0)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Expected an empty log, got %v, %v", entries, err)
+	}
+
+	for _, target := range []string{"a.json", "b.json", "c.json"} {
+		err = log.Record(Entry{Actor: "alice", Action: "file.write", Target: target})
+		if err != nil {
+			t.Fatalf("Failed to record entry: %v", err)
+		}
+	}
+
+	entries, err = log.Entries(2)
+	if err != nil || len(entries) != 2 || entries[0].Target != "c.json" || entries[1].Target != "b.json" {
+		t.Errorf("Expected the newest two entries, got %+v, %v", entries, err)
+	}
+
+	if entries[0].Time.IsZero() {
+		t.Errorf("Expected entries to be timestamped")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	new := []byte("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n")
+
+	want := `--- a/config.json
++++ b/config.json
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`
+
+	if got := Diff("config.json", old, new); got != want {
+		t.Errorf("Unexpected diff:\n%s", got)
+	}
+
+	created := Diff("new.txt", nil, []byte("hello\n"))
+	if !strings.HasPrefix(created, "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,1 @@\n+hello\n") {
+		t.Errorf("Unexpected diff of a new file:\n%s", created)
+	}
+
+	if Diff("same.txt", old, old) != "" {
+		t.Errorf("Expected no diff for unchanged content")
+	}
+
+	if got := Diff("level.dat", []byte{0, 1}, []byte{0, 1, 2}); got != "Binary file level.dat changed: 2 -> 3 bytes" {
+		t.Errorf("Unexpected binary diff: %s", got)
+	}
+}
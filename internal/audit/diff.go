@@ -0,0 +1,195 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// contextLines are the unchanged lines shown around changes.
+	contextLines = 3
+
+	// maxDiffCells caps the work of comparing two files, beyond which only
+	// their sizes are recorded.
+	maxDiffCells = 4_000_000
+)
+
+// op is a line of a diff.
+type op struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// Diff returns a unified diff between the old and new contents of a file.
+// Binary or very large files are summarized by their sizes.
+func Diff(name string, old, new []byte) string {
+	if isBinary(old) || isBinary(new) {
+		return fmt.Sprintf("Binary file %s changed: %d -> %d bytes", name, len(old), len(new))
+	}
+
+	a, b := splitLines(old), splitLines(new)
+
+	if len(a)*len(b) > maxDiffCells {
+		return fmt.Sprintf("File %s too large to diff: %d -> %d lines", name, len(a), len(b))
+	}
+
+	ops := diffLines(a, b)
+
+	from := "a/" + name
+	if old == nil {
+		from = "/dev/null"
+	}
+
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "--- %s\n+++ b/%s\n", from, name)
+
+	changed := false
+
+	for _, h := range hunks(ops) {
+		changed = true
+
+		out.WriteString(h)
+	}
+
+	if !changed {
+		return ""
+	}
+
+	return out.String()
+}
+
+// isBinary reports whether data doesn't look like text.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffLines returns the edit script from a to b using their longest common
+// subsequence.
+func diffLines(a, b []string) []op {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []op
+
+	i, j := 0, 0
+
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+
+	return ops
+}
+
+// hunks groups the changes of an edit script with their context.
+func hunks(ops []op) []string {
+	var result []string
+
+	start := -1 // First op of the current hunk
+	end := -1   // Op after the last change of the current hunk
+
+	flush := func() {
+		if start < 0 {
+			return
+		}
+
+		stop := min(len(ops), end+contextLines)
+
+		// Line numbers where the hunk starts in a and b
+		aLine, bLine := 1, 1
+
+		for _, o := range ops[:start] {
+			if o.kind != '+' {
+				aLine++
+			}
+
+			if o.kind != '-' {
+				bLine++
+			}
+		}
+
+		var body strings.Builder
+
+		aLen, bLen := 0, 0
+
+		for _, o := range ops[start:stop] {
+			if o.kind != '+' {
+				aLen++
+			}
+
+			if o.kind != '-' {
+				bLen++
+			}
+
+			body.WriteByte(o.kind)
+			body.WriteString(o.text)
+			body.WriteByte('\n')
+		}
+
+		// Empty ranges start on the line before, as in diff -u
+		if aLen == 0 {
+			aLine--
+		}
+
+		if bLen == 0 {
+			bLine--
+		}
+
+		result = append(result, fmt.Sprintf("@@ -%d,%d +%d,%d @@\n%s", aLine, aLen, bLine, bLen, body.String()))
+		start = -1
+	}
+
+	for i, o := range ops {
+		if o.kind == ' ' {
+			continue
+		}
+
+		if start >= 0 && i-end > 2*contextLines {
+			flush()
+		}
+
+		if start < 0 {
+			start = max(0, i-contextLines)
+		}
+
+		end = i + 1
+	}
+
+	flush()
+
+	return result
+}
@@ -0,0 +1,304 @@
+// Package autoscale starts extra server instances for events: when a
+// tagged server stays full for a while, a provisioning webhook or command
+// starts another instance from a template, and its address is posted to
+// Discord.
+package autoscale
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// maxLaunches bounds the launches kept in the state file.
+const maxLaunches = 100
+
+var ErrInvalid = errors.New("invalid autoscale policy")
+
+// Policy starts an instance when a server it watches has been full for the
+// sustain period.
+type Policy struct {
+	Name         string
+	Labels       map[string]string // Wrappers watched, by label; all if empty
+	Sustain      time.Duration     // How long a server must stay full
+	Cooldown     time.Duration     // Between instances started by the policy
+	MaxInstances int               // Instances started at most, unlimited if zero
+	Template     string            // Template the instance is started from
+	Provisioner  Provisioner
+	Discord      string // Discord webhook URL the new address is posted to, if any
+}
+
+// Validate checks a policy.
+func (p Policy) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("%w: no name", ErrInvalid)
+	}
+
+	if p.Sustain <= 0 {
+		return fmt.Errorf("%w: %s: sustain must be positive", ErrInvalid, p.Name)
+	}
+
+	if p.Cooldown < 0 || p.MaxInstances < 0 {
+		return fmt.Errorf("%w: %s: negative cooldown or max instances", ErrInvalid, p.Name)
+	}
+
+	if p.Provisioner == nil {
+		return fmt.Errorf("%w: %s: no provisioner", ErrInvalid, p.Name)
+	}
+
+	return nil
+}
+
+// watches reports whether the policy watches a server with the labels.
+func (p Policy) watches(labels map[string]string) bool {
+	for key, value := range p.Labels {
+		if labels[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Server is a sample of a watched server's players.
+type Server struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Players    int               `json:"players"`
+	MaxPlayers int               `json:"max_players"`
+}
+
+// full reports whether the server has no room for another player.
+func (s Server) full() bool {
+	return s.MaxPlayers > 0 && s.Players >= s.MaxPlayers
+}
+
+// Launch is an instance started, or that failed to start, for a policy.
+type Launch struct {
+	Policy   string    `json:"policy"`
+	Server   string    `json:"server"` // ID of the full server
+	Template string    `json:"template,omitempty"`
+	Time     time.Time `json:"time"`
+	Instance *Instance `json:"instance,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Trigger is a policy due to start an instance for a full server.
+type Trigger struct {
+	Policy Policy
+	Server Server
+	Since  time.Time // When the server became full
+}
+
+// PolicyStatus is a policy with the servers it has seen full.
+type PolicyStatus struct {
+	Name         string               `json:"name"`
+	Labels       map[string]string    `json:"labels,omitempty"`
+	Sustain      string               `json:"sustain"`
+	Cooldown     string               `json:"cooldown"`
+	MaxInstances int                  `json:"max_instances"`
+	Template     string               `json:"template,omitempty"`
+	Started      int                  `json:"started"`
+	Full         map[string]time.Time `json:"full"` // When each server became full, by ID
+}
+
+// Status is the policies and the instances they started.
+type Status struct {
+	Policies []PolicyStatus `json:"policies"`
+	Launches []Launch       `json:"launches"` // Newest first
+}
+
+// Scaler watches servers for the policies and records the launches, which
+// are kept at path to honor cooldowns and limits across restarts.
+type Scaler struct {
+	mu       sync.Mutex
+	path     string
+	policies []Policy
+	full     map[string]map[string]time.Time // When servers became full, by policy and server ID
+	pending  map[string]bool                 // Policies with a launch in progress
+	launches []Launch
+}
+
+// Open loads the launches saved at path, which may not exist yet.
+func Open(path string, policies []Policy) (*Scaler, error) {
+	names := make(map[string]bool)
+
+	for _, p := range policies {
+		err := p.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		if names[p.Name] {
+			return nil, fmt.Errorf("%w: duplicate policy %q", ErrInvalid, p.Name)
+		}
+
+		names[p.Name] = true
+	}
+
+	s := &Scaler{
+		path:     path,
+		policies: policies,
+		full:     make(map[string]map[string]time.Time),
+		pending:  make(map[string]bool),
+		launches: []Launch{},
+	}
+
+	err := jsonfile.Load(path, &s.launches)
+	if err != nil {
+		return nil, fmt.Errorf("error loading autoscale launches: %w", err)
+	}
+
+	return s, nil
+}
+
+// save writes the launches, under the lock.
+func (s *Scaler) save() error {
+	err := jsonfile.Save(s.path, s.launches)
+	if err != nil {
+		return fmt.Errorf("error saving autoscale launches: %w", err)
+	}
+
+	return nil
+}
+
+// Observe records samples of the servers at now and returns the policies
+// due to start an instance: a server they watch has been full for the
+// sustain period, the cooldown since their last launch is over and they
+// are under their instance limit. Each returned trigger must be followed
+// by a call to Launched. Servers not sampled are taken as not full.
+func (s *Scaler) Observe(now time.Time, servers []Server) []Trigger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var triggers []Trigger
+
+	for _, p := range s.policies {
+		full := make(map[string]time.Time)
+
+		var due *Trigger
+
+		for _, server := range servers {
+			if !p.watches(server.Labels) || !server.full() {
+				continue
+			}
+
+			since, ok := s.full[p.Name][server.ID]
+			if !ok {
+				since = now
+			}
+
+			full[server.ID] = since
+
+			if due == nil && now.Sub(since) >= p.Sustain {
+				due = &Trigger{Policy: p, Server: server, Since: since}
+			}
+		}
+
+		s.full[p.Name] = full
+
+		if due == nil || s.pending[p.Name] || !s.allowed(p, now) {
+			continue
+		}
+
+		s.pending[p.Name] = true
+		triggers = append(triggers, *due)
+	}
+
+	return triggers
+}
+
+// allowed reports whether a policy may start another instance at now,
+// under the lock.
+func (s *Scaler) allowed(p Policy, now time.Time) bool {
+	started := 0
+
+	for _, l := range s.launches {
+		if l.Policy != p.Name {
+			continue
+		}
+
+		if l.Instance != nil {
+			started++
+		}
+
+		if now.Sub(l.Time) < p.Cooldown {
+			return false
+		}
+	}
+
+	return p.MaxInstances == 0 || started < p.MaxInstances
+}
+
+// Launched records the outcome of a trigger. A failed launch counts
+// towards the cooldown but not the instance limit. The server has to stay
+// full for the sustain period again before the policy fires again.
+func (s *Scaler) Launched(t Trigger, at time.Time, instance *Instance, launchErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, t.Policy.Name)
+	delete(s.full[t.Policy.Name], t.Server.ID)
+
+	launch := Launch{
+		Policy:   t.Policy.Name,
+		Server:   t.Server.ID,
+		Template: t.Policy.Template,
+		Time:     at,
+		Instance: instance,
+	}
+
+	if launchErr != nil {
+		launch.Error = launchErr.Error()
+	}
+
+	s.launches = append(s.launches, launch)
+
+	if len(s.launches) > maxLaunches {
+		s.launches = s.launches[len(s.launches)-maxLaunches:]
+	}
+
+	return s.save()
+}
+
+// Status returns the policies and the instances they started.
+func (s *Scaler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := Status{Policies: []PolicyStatus{}, Launches: []Launch{}}
+
+	for _, p := range s.policies {
+		ps := PolicyStatus{
+			Name:         p.Name,
+			Labels:       p.Labels,
+			Sustain:      p.Sustain.String(),
+			Cooldown:     p.Cooldown.String(),
+			MaxInstances: p.MaxInstances,
+			Template:     p.Template,
+			Full:         make(map[string]time.Time),
+		}
+
+		for id, since := range s.full[p.Name] {
+			ps.Full[id] = since
+		}
+
+		for _, l := range s.launches {
+			if l.Policy == p.Name && l.Instance != nil {
+				ps.Started++
+			}
+		}
+
+		status.Policies = append(status.Policies, ps)
+	}
+
+	for i := len(s.launches) - 1; i >= 0; i-- {
+		status.Launches = append(status.Launches, s.launches[i])
+	}
+
+	return status
+}
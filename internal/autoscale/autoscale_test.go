@@ -0,0 +1,236 @@
+package autoscale
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixed is a provisioner that always starts the same instance.
+type fixed struct{}
+
+func (fixed) Provision(context.Context, Request) (Instance, error) {
+	return Instance{Address: "play.example.com:19133"}, nil
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, policies := range [][]Policy{
+		{{Sustain: time.Minute, Provisioner: fixed{}}},
+		{{Name: "events", Provisioner: fixed{}}},
+		{{Name: "events", Sustain: time.Minute}},
+		{{Name: "events", Sustain: time.Minute, Cooldown: -time.Minute, Provisioner: fixed{}}},
+		{
+			{Name: "events", Sustain: time.Minute, Provisioner: fixed{}},
+			{Name: "events", Sustain: time.Minute, Provisioner: fixed{}},
+		},
+	} {
+		_, err := Open(filepath.Join(dir, "autoscale.json"), policies)
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", policies, err)
+		}
+	}
+}
+
+func TestScaler_Observe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autoscale.json")
+	policy := Policy{
+		Name:         "events",
+		Labels:       map[string]string{"role": "event"},
+		Sustain:      5 * time.Minute,
+		Cooldown:     30 * time.Minute,
+		MaxInstances: 2,
+		Template:     "lobby",
+		Provisioner:  fixed{},
+	}
+
+	s, err := Open(path, []Policy{policy})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	start := time.Date(2026, 5, 1, 20, 0, 0, 0, time.UTC)
+	event := Server{ID: "a", Labels: map[string]string{"role": "event"}, Players: 10, MaxPlayers: 10}
+	other := Server{ID: "b", Players: 10, MaxPlayers: 10}
+
+	if triggers := s.Observe(start, []Server{event, other}); len(triggers) != 0 {
+		t.Fatalf("Expected no trigger before the sustain period, got %+v", triggers)
+	}
+
+	// Dropping below max players starts the period over
+	event.Players = 9
+	s.Observe(start.Add(2*time.Minute), []Server{event})
+	event.Players = 10
+	s.Observe(start.Add(3*time.Minute), []Server{event})
+
+	if triggers := s.Observe(start.Add(7*time.Minute), []Server{event}); len(triggers) != 0 {
+		t.Fatalf("Expected the period to start over, got %+v", triggers)
+	}
+
+	triggers := s.Observe(start.Add(8*time.Minute), []Server{event, other})
+	if len(triggers) != 1 || triggers[0].Server.ID != "a" || !triggers[0].Since.Equal(start.Add(3*time.Minute)) {
+		t.Fatalf("Expected a trigger for server a, got %+v", triggers)
+	}
+
+	// Only one launch at a time
+	if again := s.Observe(start.Add(9*time.Minute), []Server{event}); len(again) != 0 {
+		t.Fatalf("Expected no trigger while launching, got %+v", again)
+	}
+
+	err = s.Launched(triggers[0], start.Add(9*time.Minute), &Instance{Address: "play.example.com:19133"}, nil)
+	if err != nil {
+		t.Fatalf("Launched failed: %v", err)
+	}
+
+	// Cooldown
+	s.Observe(start.Add(10*time.Minute), []Server{event})
+	if again := s.Observe(start.Add(20*time.Minute), []Server{event}); len(again) != 0 {
+		t.Fatalf("Expected no trigger during the cooldown, got %+v", again)
+	}
+
+	triggers = s.Observe(start.Add(40*time.Minute), []Server{event})
+	if len(triggers) != 1 {
+		t.Fatalf("Expected a trigger after the cooldown, got %+v", triggers)
+	}
+
+	err = s.Launched(triggers[0], start.Add(40*time.Minute), &Instance{Address: "play.example.com:19134"}, nil)
+	if err != nil {
+		t.Fatalf("Launched failed: %v", err)
+	}
+
+	// Instance limit, kept across restarts
+	s, err = Open(path, []Policy{policy})
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	s.Observe(start.Add(2*time.Hour), []Server{event})
+	if again := s.Observe(start.Add(3*time.Hour), []Server{event}); len(again) != 0 {
+		t.Fatalf("Expected no trigger over the instance limit, got %+v", again)
+	}
+
+	status := s.Status()
+	if len(status.Policies) != 1 || status.Policies[0].Started != 2 || len(status.Launches) != 2 {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+
+	if status.Launches[0].Instance.Address != "play.example.com:19134" {
+		t.Errorf("Expected the newest launch first, got %+v", status.Launches)
+	}
+}
+
+func TestScaler_FailedLaunch(t *testing.T) {
+	policy := Policy{Name: "events", Sustain: time.Minute, MaxInstances: 1, Provisioner: fixed{}}
+
+	s, err := Open(filepath.Join(t.TempDir(), "autoscale.json"), []Policy{policy})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	full := Server{ID: "a", Players: 5, MaxPlayers: 5}
+	start := time.Now()
+
+	s.Observe(start, []Server{full})
+
+	triggers := s.Observe(start.Add(time.Minute), []Server{full})
+	if len(triggers) != 1 {
+		t.Fatalf("Expected a trigger, got %+v", triggers)
+	}
+
+	err = s.Launched(triggers[0], start.Add(time.Minute), nil, ErrProvision)
+	if err != nil {
+		t.Fatalf("Launched failed: %v", err)
+	}
+
+	// Without a cooldown, a failed launch is retried once the server has
+	// been full for the sustain period again
+	s.Observe(start.Add(2*time.Minute), []Server{full})
+
+	if triggers = s.Observe(start.Add(3*time.Minute), []Server{full}); len(triggers) != 1 {
+		t.Fatalf("Expected a failed launch not to count towards the limit, got %+v", triggers)
+	}
+
+	if launch := s.Status().Launches[0]; launch.Error == "" || launch.Instance != nil {
+		t.Errorf("Expected the failure to be recorded, got %+v", launch)
+	}
+}
+
+func TestWebhook_Provision(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req Request
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Template != "lobby" || req.Server.ID != "a" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"id":"i-1","address":"10.0.0.5:19132"}`))
+	}))
+	defer srv.Close()
+
+	req := Request{Policy: "events", Template: "lobby", Server: Server{ID: "a"}}
+
+	instance, err := Webhook{
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	}.Provision(context.Background(), req)
+	if err != nil || instance.ID != "i-1" || instance.Address != "10.0.0.5:19132" {
+		t.Fatalf("Unexpected instance %+v, %v", instance, err)
+	}
+
+	_, err = Webhook{URL: srv.URL}.Provision(context.Background(), req)
+	if !errors.Is(err, ErrProvision) || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected a provisioning error, got %v", err)
+	}
+}
+
+func TestCommand_Provision(t *testing.T) {
+	req := Request{Policy: "events", Template: "lobby", Server: Server{ID: "a"}}
+
+	instance, err := Command{Args: []string{
+		"sh", "-c", `cat >/dev/null; echo "applying $AUTOSCALE_TEMPLATE"; echo 10.0.0.6:19132`,
+	}}.Provision(context.Background(), req)
+	if err != nil || instance.Address != "10.0.0.6:19132" {
+		t.Fatalf("Unexpected instance %+v, %v", instance, err)
+	}
+
+	_, err = Command{Args: []string{"sh", "-c", "echo boom >&2; exit 1"}}.Provision(context.Background(), req)
+	if !errors.Is(err, ErrProvision) || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Expected a provisioning error with stderr, got %v", err)
+	}
+
+	_, err = Command{Args: []string{"true"}}.Provision(context.Background(), req)
+	if !errors.Is(err, ErrProvision) {
+		t.Errorf("Expected an error without an address, got %v", err)
+	}
+}
+
+func TestPostDiscord(t *testing.T) {
+	var content string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		content = body["content"]
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	err := PostDiscord(context.Background(), nil, srv.URL, "New server at play.example.com:19133")
+	if err != nil || content != "New server at play.example.com:19133" {
+		t.Errorf("Unexpected result %q, %v", content, err)
+	}
+}
@@ -0,0 +1,185 @@
+package autoscale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// maxResponseSize bounds the response of a provisioner.
+const maxResponseSize = 1 << 20
+
+// ErrProvision is returned when a provisioner fails or its response has no
+// address.
+var ErrProvision = errors.New("provisioning failed")
+
+// Request asks a provisioner for an instance.
+type Request struct {
+	Policy   string `json:"policy"`
+	Template string `json:"template,omitempty"`
+	Server   Server `json:"server"` // The full server
+}
+
+// Instance is a started instance.
+type Instance struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"` // Where players connect, host:port
+}
+
+// Provisioner starts an instance.
+type Provisioner interface {
+	Provision(ctx context.Context, req Request) (Instance, error)
+}
+
+// Webhook provisions through an HTTP API: the request is POSTed as JSON and
+// the response is the instance as JSON.
+type Webhook struct {
+	URL     string
+	Headers map[string]string // e.g. Authorization
+	Client  *http.Client      // http.DefaultClient if nil
+}
+
+// Provision POSTs the request to the webhook.
+func (h Webhook) Provision(ctx context.Context, req Request) (Instance, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Instance{}, fmt.Errorf("error encoding provisioning request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return Instance{}, fmt.Errorf("error creating provisioning request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	for key, value := range h.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return Instance{}, fmt.Errorf("%w: %w", ErrProvision, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return Instance{}, fmt.Errorf("%w: error reading response: %w", ErrProvision, err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return Instance{}, fmt.Errorf("%w: %s: %s", ErrProvision, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return parseInstance(data)
+}
+
+// Command provisions with a program, such as a script running terraform
+// apply. The request is passed as JSON on stdin and in the environment as
+// AUTOSCALE_POLICY, AUTOSCALE_TEMPLATE and AUTOSCALE_SERVER; the program
+// prints the instance as JSON, or just its address.
+type Command struct {
+	Args []string
+	Dir  string
+}
+
+// Provision runs the command.
+func (c Command) Provision(ctx context.Context, req Request) (Instance, error) {
+	if len(c.Args) == 0 {
+		return Instance{}, fmt.Errorf("%w: no command", ErrProvision)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Instance{}, fmt.Errorf("error encoding provisioning request: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...) // #nosec G204
+	cmd.Dir = c.Dir
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"AUTOSCALE_POLICY="+req.Policy,
+		"AUTOSCALE_TEMPLATE="+req.Template,
+		"AUTOSCALE_SERVER="+req.Server.ID,
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return Instance{}, fmt.Errorf("%w: %w: %s", ErrProvision, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseInstance(out)
+}
+
+// parseInstance parses the instance in a provisioner's response: JSON, or
+// the last line of plain text as the address.
+func parseInstance(data []byte) (Instance, error) {
+	text := strings.TrimSpace(string(data))
+
+	var instance Instance
+
+	if strings.HasPrefix(text, "{") {
+		err := json.Unmarshal([]byte(text), &instance)
+		if err != nil {
+			return Instance{}, fmt.Errorf("%w: invalid response: %w", ErrProvision, err)
+		}
+	} else if i := strings.LastIndex(text, "\n"); i >= 0 {
+		instance.Address = strings.TrimSpace(text[i+1:])
+	} else {
+		instance.Address = text
+	}
+
+	if instance.Address == "" {
+		return Instance{}, fmt.Errorf("%w: no address in response", ErrProvision)
+	}
+
+	return instance, nil
+}
+
+// PostDiscord posts a message to a Discord webhook.
+func PostDiscord(ctx context.Context, client *http.Client, url, content string) error {
+	body, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return fmt.Errorf("error encoding Discord message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating Discord request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to Discord: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("error posting to Discord: %s", resp.Status)
+	}
+
+	return nil
+}
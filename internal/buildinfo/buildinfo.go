@@ -0,0 +1,103 @@
+// Package buildinfo describes the build of a binary: the version, git commit
+// and build date set with -ldflags by goreleaser, falling back to what the
+// Go toolchain recorded for builds without them.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// shortCommit is how many characters of the commit String shows.
+const shortCommit = 7
+
+// Info is the build of a binary.
+type Info struct {
+	Software  string `json:"software"` // e.g. "minecraft-server-wrapper"
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`     // RFC 3339
+	Modified  bool   `json:"modified,omitempty"` // Built from a tree with uncommitted changes
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"` // GOOS/GOARCH
+}
+
+// New describes the build of software from the values set with -ldflags,
+// e.g. -X main.version=1.2.3 -X main.commit=... -X main.date=....
+func New(software, version, commit, date string) Info {
+	info := Info{
+		Software:  software,
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.fill(build.Settings)
+
+	return info
+}
+
+// fill takes the commit and date stamped by the Go toolchain, for builds
+// from a checkout without -ldflags.
+func (i *Info) fill(settings []debug.BuildSetting) {
+	stamped := i.Commit == ""
+
+	for _, s := range settings {
+		switch s.Key {
+		case "vcs.revision":
+			if i.Commit == "" {
+				i.Commit = s.Value
+			}
+		case "vcs.time":
+			if i.Date == "" {
+				i.Date = s.Value
+			}
+		case "vcs.modified":
+			// Only trusted for the toolchain's own commit
+			i.Modified = stamped && s.Value == "true"
+		}
+	}
+}
+
+// String describes the build in one line for logs and support questions,
+// e.g. "minecraft-server-wrapper 1.2.3 (commit 0123abc, built 2026-10-01T12:00:00Z)".
+func (i Info) String() string {
+	s := i.Software + " " + i.Version
+
+	var details []string
+
+	if i.Commit != "" {
+		commit := i.Commit
+		if len(commit) > shortCommit {
+			commit = commit[:shortCommit]
+		}
+
+		if i.Modified {
+			commit += "-dirty"
+		}
+
+		details = append(details, "commit "+commit)
+	}
+
+	if i.Date != "" {
+		details = append(details, "built "+i.Date)
+	}
+
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+
+	return s
+}
@@ -0,0 +1,77 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	info := New("minecraft-server-wrapper", "1.2.3", "0123456789abcdef", "2026-10-01T12:00:00Z")
+
+	if info.Software != "minecraft-server-wrapper" || info.Version != "1.2.3" || info.Commit != "0123456789abcdef" ||
+		info.Date != "2026-10-01T12:00:00Z" {
+		t.Errorf("Unexpected info %+v", info)
+	}
+
+	if info.GoVersion != runtime.Version() || info.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Errorf("Unexpected toolchain in %+v", info)
+	}
+
+	if New("minecraft-server-center", "", "", "").Version != "dev" {
+		t.Error("Expected an empty version to be dev")
+	}
+}
+
+func TestFill(t *testing.T) {
+	settings := []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "fedcba9876543210"},
+		{Key: "vcs.time", Value: "2026-09-30T08:00:00Z"},
+		{Key: "vcs.modified", Value: "true"},
+	}
+
+	info := Info{Version: "dev"}
+	info.fill(settings)
+
+	if info.Commit != "fedcba9876543210" || info.Date != "2026-09-30T08:00:00Z" || !info.Modified {
+		t.Errorf("Expected the toolchain's stamp, got %+v", info)
+	}
+
+	info = Info{Version: "1.2.3", Commit: "0123456789abcdef", Date: "2026-10-01T12:00:00Z"}
+	info.fill(settings)
+
+	if info.Commit != "0123456789abcdef" || info.Date != "2026-10-01T12:00:00Z" || info.Modified {
+		t.Errorf("Expected -ldflags values to win, got %+v", info)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		info Info
+		want string
+	}{
+		{
+			Info{
+				Software: "minecraft-server-wrapper",
+				Version:  "1.2.3",
+				Commit:   "0123456789abcdef",
+				Date:     "2026-10-01T12:00:00Z",
+			},
+			"minecraft-server-wrapper 1.2.3 (commit 0123456, built 2026-10-01T12:00:00Z)",
+		},
+		{
+			Info{Software: "minecraft-server-center", Version: "dev", Commit: "abc", Modified: true},
+			"minecraft-server-center dev (commit abc-dirty)",
+		},
+		{
+			Info{Software: "minecraft-server-center", Version: "dev"},
+			"minecraft-server-center dev",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.info.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
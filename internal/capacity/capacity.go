@@ -0,0 +1,330 @@
+// Package capacity enforces a soft player limit below max-players, for
+// servers whose hardware can't keep up with a full server: players joining
+// over the limit can be warned or kicked, and operators alerted.
+package capacity
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rawtext"
+)
+
+const (
+	// DefaultWarning is whispered to players joining over the limit.
+	DefaultWarning = "The server is busy and may lag, please bear with us"
+
+	// DefaultKickMessage is shown to players kicked over the limit.
+	DefaultKickMessage = "The server is full, please try again later"
+)
+
+var ErrInvalid = errors.New("invalid capacity policy")
+
+// Policy is what happens when more players are online than the soft limit.
+// Players on allowlist.json, and those exempted by name or XUID, are never
+// kicked.
+type Policy struct {
+	Enabled     bool     `json:"enabled"`
+	Limit       int      `json:"limit"`                  // Soft limit on players online
+	Warn        bool     `json:"warn"`                   // Whisper a warning to players joining over the limit
+	Warning     string   `json:"warning,omitempty"`      // DefaultWarning if empty
+	Kick        bool     `json:"kick"`                   // Kick players joining over the limit
+	KickMessage string   `json:"kick_message,omitempty"` // DefaultKickMessage if empty
+	Alert       bool     `json:"alert"`                  // Alert operators when the limit is exceeded
+	Exempt      []string `json:"exempt,omitempty"`       // Player names or XUIDs never kicked
+}
+
+// Validate checks a policy.
+func (p *Policy) Validate() error {
+	if p.Limit < 0 {
+		return fmt.Errorf("%w: negative limit", ErrInvalid)
+	}
+
+	if p.Enabled && p.Limit == 0 {
+		return fmt.Errorf("%w: no limit", ErrInvalid)
+	}
+
+	// A line break would end the console command early and run the rest
+	// as another command
+	if strings.ContainsAny(p.Warning, "\r\n") || strings.ContainsAny(p.KickMessage, "\r\n") {
+		return fmt.Errorf("%w: messages must be a single line", ErrInvalid)
+	}
+
+	for _, e := range p.Exempt {
+		if strings.TrimSpace(e) == "" {
+			return fmt.Errorf("%w: empty exemption", ErrInvalid)
+		}
+	}
+
+	return nil
+}
+
+// exempt reports whether a player is exempted by the policy.
+func (p Policy) exempt(player, xuid string) bool {
+	for _, e := range p.Exempt {
+		if strings.EqualFold(e, player) || (xuid != "" && e == xuid) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowlistEntry is an entry of allowlist.json.
+type allowlistEntry struct {
+	Name string `json:"name"`
+	XUID string `json:"xuid"`
+}
+
+// Allowlisted reports whether a player is on the allowlist.json at path,
+// by XUID or name. A missing allowlist has nobody on it.
+func Allowlisted(path, player, xuid string) (bool, error) {
+	var entries []allowlistEntry
+
+	err := jsonfile.Load(path, &entries)
+	if err != nil {
+		return false, fmt.Errorf("error loading allowlist: %w", err)
+	}
+
+	for _, e := range entries {
+		if (xuid != "" && e.XUID == xuid) || strings.EqualFold(e.Name, player) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Status is the policy with the players online.
+type Status struct {
+	Policy  Policy   `json:"policy"`
+	Online  int      `json:"online"`
+	Players []string `json:"players"` // Seen joining, sorted
+	Over    bool     `json:"over"`    // More players online than the limit
+}
+
+// Decision is what to do about a change in the players online.
+type Decision struct {
+	Online   int
+	Commands []string // Console commands, such as a whisper or a kick
+	Alert    string   // Alert for operators, if any
+}
+
+// Monitor counts the players online and applies the policy to them.
+type Monitor struct {
+	mu       sync.Mutex
+	path     string
+	policy   Policy
+	players  map[string]string // XUID by player name
+	reported int               // Players online in the last ping
+	alerted  bool              // Alerted since going over the limit
+}
+
+// Open loads the policy saved at path, which may not exist yet.
+func Open(path string) (*Monitor, error) {
+	m := &Monitor{path: path, players: map[string]string{}}
+
+	err := jsonfile.Load(path, &m.policy)
+	if err != nil {
+		return nil, fmt.Errorf("error loading capacity policy: %w", err)
+	}
+
+	return m, nil
+}
+
+// Status returns the policy and the players online.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	players := make([]string, 0, len(m.players))
+	for name := range m.players {
+		players = append(players, name)
+	}
+
+	sort.Strings(players)
+
+	online := m.online()
+
+	return Status{
+		Policy:  m.policy,
+		Online:  online,
+		Players: players,
+		Over:    m.policy.Enabled && online > m.policy.Limit,
+	}
+}
+
+// SetPolicy validates and saves a policy. Going over the limit is alerted
+// again under the new policy.
+func (m *Monitor) SetPolicy(policy Policy) (Policy, error) {
+	err := policy.Validate()
+	if err != nil {
+		return Policy{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.policy
+	m.policy = policy
+
+	err = m.save()
+	if err != nil {
+		m.policy = old
+		return Policy{}, err
+	}
+
+	m.alerted = false
+
+	return policy, nil
+}
+
+// save writes the policy, under the lock.
+func (m *Monitor) save() error {
+	err := jsonfile.Save(m.path, m.policy)
+	if err != nil {
+		return fmt.Errorf("error saving capacity policy: %w", err)
+	}
+
+	return nil
+}
+
+// Join counts a player joining and decides what to do when that puts the
+// server over the limit: the player is warned, or kicked unless
+// allowlisted or exempt. A kicked player isn't counted.
+func (m *Monitor) Join(player, xuid string, allowlisted bool) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.players[player] = xuid
+
+	p := m.policy
+	d := Decision{Online: m.online()}
+
+	if !p.Enabled || d.Online <= p.Limit {
+		return d, nil
+	}
+
+	if p.Kick && !allowlisted && !p.exempt(player, xuid) {
+		d.Alert = m.alert(fmt.Sprintf("kicked %s", player))
+		d.Commands = append(d.Commands, fmt.Sprintf("kick %q %s", player, or(p.KickMessage, DefaultKickMessage)))
+
+		delete(m.players, player)
+		d.Online = m.online()
+
+		return d, nil
+	}
+
+	if p.Warn {
+		message := rawtext.Message{
+			Target: player,
+			Parts:  []rawtext.Part{{Text: or(p.Warning, DefaultWarning), Color: "yellow"}},
+		}
+
+		commands, err := message.Commands()
+		if err != nil {
+			return d, fmt.Errorf("error warning %s: %w", player, err)
+		}
+
+		d.Commands = append(d.Commands, commands...)
+	}
+
+	d.Alert = m.alert(fmt.Sprintf("%s joined", player))
+
+	return d, nil
+}
+
+// Leave counts a player leaving.
+func (m *Monitor) Leave(player string) Decision {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.players, player)
+
+	if m.reported > 0 {
+		m.reported--
+	}
+
+	m.rearm()
+
+	return Decision{Online: m.online()}
+}
+
+// Observe records the players online reported by a ping, which counts
+// players who joined before the monitor started, and alerts when that is
+// over the limit.
+func (m *Monitor) Observe(count int) Decision {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reported = count
+
+	// Nobody is online, so players who left unseen aren't either
+	if count == 0 {
+		clear(m.players)
+	}
+
+	d := Decision{Online: m.online()}
+
+	if m.policy.Enabled && d.Online > m.policy.Limit {
+		d.Alert = m.alert("")
+	}
+
+	m.rearm()
+
+	return d
+}
+
+// Reset forgets the players online, as when the server restarts.
+func (m *Monitor) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clear(m.players)
+	m.reported = 0
+	m.alerted = false
+}
+
+// online returns the players online: those seen joining, or more if a ping
+// reported more, under the lock.
+func (m *Monitor) online() int {
+	return max(len(m.players), m.reported)
+}
+
+// alert returns an alert for going over the limit, once until the server
+// is back under it, under the lock.
+func (m *Monitor) alert(detail string) string {
+	if !m.policy.Alert || m.alerted {
+		return ""
+	}
+
+	m.alerted = true
+
+	text := fmt.Sprintf("%d players online, over the soft limit of %d", m.online(), m.policy.Limit)
+	if detail != "" {
+		text += " (" + detail + ")"
+	}
+
+	return text
+}
+
+// rearm allows another alert once the server is back under the limit,
+// under the lock.
+func (m *Monitor) rearm() {
+	if m.online() <= m.policy.Limit {
+		m.alerted = false
+	}
+}
+
+// or returns value, or fallback if it is empty.
+func or(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
@@ -0,0 +1,205 @@
+package capacity
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func open(t *testing.T, policy Policy) *Monitor {
+	t.Helper()
+
+	m, err := Open(filepath.Join(t.TempDir(), "capacity.json"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	_, err = m.SetPolicy(policy)
+	if err != nil {
+		t.Fatalf("SetPolicy failed: %v", err)
+	}
+
+	return m
+}
+
+func TestValidate(t *testing.T) {
+	for _, p := range []Policy{
+		{Limit: -1},
+		{Enabled: true},
+		{Enabled: true, Limit: 5, Warning: "busy\nstop"},
+		{Enabled: true, Limit: 5, Exempt: []string{" "}},
+	} {
+		err := p.Validate()
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", p, err)
+		}
+	}
+
+	p := Policy{Enabled: true, Limit: 5, Kick: true, Exempt: []string{"Steve"}}
+
+	err := p.Validate()
+	if err != nil {
+		t.Errorf("Expected a valid policy, got %v", err)
+	}
+}
+
+func TestMonitor_Warn(t *testing.T) {
+	m := open(t, Policy{Enabled: true, Limit: 1, Warn: true, Alert: true})
+
+	d, err := m.Join("Steve", "1", false)
+	if err != nil || len(d.Commands) != 0 || d.Alert != "" {
+		t.Fatalf("Expected nothing under the limit, got %+v, %v", d, err)
+	}
+
+	d, err = m.Join("Alex Smith", "2", false)
+	if err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+
+	if len(d.Commands) != 1 || !strings.HasPrefix(d.Commands[0], `tellraw "Alex Smith" `) ||
+		!strings.Contains(d.Commands[0], DefaultWarning) {
+		t.Errorf("Expected a whisper to Alex Smith, got %q", d.Commands)
+	}
+
+	if !strings.Contains(d.Alert, "2 players online, over the soft limit of 1") {
+		t.Errorf("Expected an alert, got %q", d.Alert)
+	}
+
+	// Alerted once until back under the limit
+	d, _ = m.Join("Notch", "3", false)
+	if d.Online != 3 || d.Alert != "" {
+		t.Errorf("Expected no second alert, got %+v", d)
+	}
+
+	m.Leave("Notch")
+	m.Leave("Alex Smith")
+
+	d, _ = m.Join("Alex Smith", "2", false)
+	if d.Alert == "" {
+		t.Error("Expected an alert after going back over the limit")
+	}
+
+	if status := m.Status(); status.Online != 2 || !status.Over || len(status.Players) != 2 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestMonitor_Kick(t *testing.T) {
+	m := open(t, Policy{Enabled: true, Limit: 1, Kick: true, Warn: true, Exempt: []string{"notch"}})
+
+	m.Join("Steve", "1", false)
+
+	d, _ := m.Join("Alex", "2", false)
+	if len(d.Commands) != 1 || d.Commands[0] != `kick "Alex" `+DefaultKickMessage {
+		t.Errorf("Expected Alex to be kicked, got %q", d.Commands)
+	}
+
+	if d.Online != 1 {
+		t.Errorf("Expected the kicked player not to count, got %d online", d.Online)
+	}
+
+	// Allowlisted and exempt players are warned instead
+	for _, join := range []struct {
+		player      string
+		allowlisted bool
+	}{{"Herobrine", true}, {"Notch", false}} {
+		d, _ = m.Join(join.player, "", join.allowlisted)
+		if len(d.Commands) != 1 || !strings.HasPrefix(d.Commands[0], "tellraw") {
+			t.Errorf("Expected %s to be warned, got %q", join.player, d.Commands)
+		}
+	}
+}
+
+func TestMonitor_Observe(t *testing.T) {
+	m := open(t, Policy{Enabled: true, Limit: 2, Alert: true})
+
+	m.Join("Steve", "1", false)
+
+	// Players who joined before the monitor started count too
+	d := m.Observe(3)
+	if d.Online != 3 || d.Alert == "" {
+		t.Errorf("Expected an alert for 3 players, got %+v", d)
+	}
+
+	if d = m.Leave("Steve"); d.Online != 2 {
+		t.Errorf("Expected 2 players online, got %d", d.Online)
+	}
+
+	m.Join("Alex", "2", false)
+
+	if d = m.Observe(0); d.Online != 0 || len(m.Status().Players) != 0 {
+		t.Errorf("Expected nobody online, got %+v", m.Status())
+	}
+
+	m.Join("Steve", "1", false)
+	m.Reset()
+
+	if m.Status().Online != 0 {
+		t.Error("Expected Reset to forget the players")
+	}
+}
+
+func TestMonitor_Disabled(t *testing.T) {
+	m := open(t, Policy{Limit: 1, Kick: true, Alert: true})
+
+	m.Join("Steve", "1", false)
+
+	d, _ := m.Join("Alex", "2", false)
+	if len(d.Commands) != 0 || d.Alert != "" || d.Online != 2 {
+		t.Errorf("Expected a disabled policy to only count, got %+v", d)
+	}
+}
+
+func TestOpen_Saved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capacity.json")
+
+	m, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	_, err = m.SetPolicy(Policy{Enabled: true, Limit: 10, Warn: true})
+	if err != nil {
+		t.Fatalf("SetPolicy failed: %v", err)
+	}
+
+	m, err = Open(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	if p := m.Status().Policy; !p.Enabled || p.Limit != 10 || !p.Warn {
+		t.Errorf("Expected the policy to be saved, got %+v", p)
+	}
+}
+
+func TestAllowlisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.json")
+
+	ok, err := Allowlisted(path, "Steve", "1")
+	if err != nil || ok {
+		t.Errorf("Expected nobody on a missing allowlist, got %v, %v", ok, err)
+	}
+
+	err = os.WriteFile(path, []byte(`[{"ignoresPlayerLimit":false,"name":"Steve","xuid":"1"},{"name":"Alex"}]`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		player, xuid string
+		want         bool
+	}{
+		{"steve", "", true},
+		{"Renamed", "1", true},
+		{"Alex", "2", true},
+		{"Notch", "3", false},
+	} {
+		ok, err := Allowlisted(path, c.player, c.xuid)
+		if err != nil || ok != c.want {
+			t.Errorf("Allowlisted(%s, %s) = %v, %v, want %v", c.player, c.xuid, ok, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// Package centralstate archives the state of the central server, its
+// configuration file and data directory, along with the schedules of its
+// wrappers, into a single zip for backups and for moving it to another host.
+package centralstate
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// ErrInvalid is returned for archives that can't be imported.
+var ErrInvalid = errors.New("invalid state archive")
+
+const (
+	// manifestName, configName and the prefixes are the layout of an
+	// archive.
+	manifestName   = "manifest.json"
+	configName     = "config.json"
+	dataPrefix     = "data/"
+	wrappersPrefix = "wrappers/"
+	schedulesName  = "schedules.json"
+
+	// StagedName is the file in the data directory an imported archive
+	// waits in until the central server starts again.
+	StagedName = "import.zip"
+
+	// maxFileSize bounds a file extracted from an archive.
+	maxFileSize = 256 << 20
+)
+
+// Manifest describes an archive.
+type Manifest struct {
+	Version  string    `json:"version"` // Version of the central server that wrote it
+	Created  time.Time `json:"created"`
+	Data     []string  `json:"data"`     // Files of the data directory
+	Wrappers []string  `json:"wrappers"` // Wrappers whose schedules are included
+}
+
+// Archive is the state of the central server.
+type Archive struct {
+	Manifest  Manifest
+	Config    []byte                     // The configuration file, with users and their keys
+	Data      map[string][]byte          // Files of the data directory by name
+	Schedules map[string]json.RawMessage // Schedules of each wrapper by ID, as a JSON array
+}
+
+// Collect reads the configuration file and the JSON files at the top of the
+// data directory, which hold the tokens, macros, two-factor enrollments,
+// user preferences, deny list and reports.
+func Collect(configPath, dataDir string) (*Archive, error) {
+	config, err := os.ReadFile(configPath) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	a := &Archive{Config: config, Data: make(map[string][]byte), Schedules: make(map[string]json.RawMessage)}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading data directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !dataFile(entry.Name()) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dataDir, entry.Name())) // #nosec G304
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", entry.Name(), err)
+		}
+
+		a.Data[entry.Name()] = data
+	}
+
+	return a, nil
+}
+
+// dataFile reports whether name is a file of the data directory that
+// belongs in an archive.
+func dataFile(name string) bool {
+	return strings.HasSuffix(name, ".json") && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
+
+// Write writes the archive as a zip to w.
+func (a *Archive) Write(w io.Writer, version string, created time.Time) error {
+	a.Manifest = Manifest{
+		Version:  version,
+		Created:  created.UTC(),
+		Data:     sortedKeys(a.Data),
+		Wrappers: sortedKeys(a.Schedules),
+	}
+
+	manifest, err := json.MarshalIndent(a.Manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+
+	files := []entry{{manifestName, manifest}, {configName, a.Config}}
+
+	for _, name := range a.Manifest.Data {
+		files = append(files, entry{dataPrefix + name, a.Data[name]})
+	}
+
+	for _, id := range a.Manifest.Wrappers {
+		files = append(files, entry{wrappersPrefix + id + "/" + schedulesName, a.Schedules[id]})
+	}
+
+	for _, f := range files {
+		dest, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: created})
+		if err != nil {
+			return fmt.Errorf("error adding %s to archive: %w", f.name, err)
+		}
+
+		_, err = dest.Write(f.data)
+		if err != nil {
+			return fmt.Errorf("error adding %s to archive: %w", f.name, err)
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return fmt.Errorf("error finishing archive: %w", err)
+	}
+
+	return nil
+}
+
+// entry is a file of an archive.
+type entry struct {
+	name string
+	data []byte
+}
+
+// sortedKeys returns the keys of a map in order.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Read parses an archive of size bytes. Every file must be valid JSON, and
+// files outside the archive layout are rejected.
+func Read(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	a := &Archive{Data: make(map[string][]byte), Schedules: make(map[string]json.RawMessage)}
+	manifest := false
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		data, err := readFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		if !json.Valid(data) {
+			return nil, fmt.Errorf("%w: %s isn't valid JSON", ErrInvalid, f.Name)
+		}
+
+		name := path.Clean(f.Name)
+
+		switch {
+		case name == manifestName:
+			err = json.Unmarshal(data, &a.Manifest)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid manifest: %w", ErrInvalid, err)
+			}
+
+			manifest = true
+		case name == configName:
+			a.Config = data
+		case strings.HasPrefix(name, dataPrefix) && dataFile(strings.TrimPrefix(name, dataPrefix)):
+			a.Data[strings.TrimPrefix(name, dataPrefix)] = data
+		case strings.HasPrefix(name, wrappersPrefix) && path.Base(name) == schedulesName &&
+			path.Dir(path.Dir(name)) == path.Clean(wrappersPrefix):
+			a.Schedules[path.Base(path.Dir(name))] = data
+		default:
+			return nil, fmt.Errorf("%w: unexpected file %s", ErrInvalid, f.Name)
+		}
+	}
+
+	if !manifest || a.Config == nil {
+		return nil, fmt.Errorf("%w: missing %s or %s", ErrInvalid, manifestName, configName)
+	}
+
+	return a, nil
+}
+
+// readFile reads a file of an archive, up to maxFileSize bytes.
+func readFile(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxFileSize {
+		return nil, fmt.Errorf("%w: %s is too large", ErrInvalid, f.Name)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: error reading %s: %w", ErrInvalid, f.Name, err)
+	}
+
+	if len(data) > maxFileSize {
+		return nil, fmt.Errorf("%w: %s is too large", ErrInvalid, f.Name)
+	}
+
+	return data, nil
+}
+
+// Stage saves the archive in the data directory to be applied when the
+// central server starts again, as its stores would overwrite files
+// replaced while it runs.
+func (a *Archive) Stage(dataDir string) error {
+	var buf bytes.Buffer
+
+	err := a.Write(&buf, a.Manifest.Version, a.Manifest.Created)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(dataDir, StagedName), buf.Bytes())
+}
+
+// ApplyStaged applies an archive staged in the data directory, if any, and
+// removes it. It reports whether one was applied.
+func ApplyStaged(configPath, dataDir string) (bool, error) {
+	staged := filepath.Join(dataDir, StagedName)
+
+	data, err := os.ReadFile(staged) // #nosec G304
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error reading staged import: %w", err)
+	}
+
+	a, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false, err
+	}
+
+	err = a.Apply(configPath, dataDir)
+	if err != nil {
+		return false, err
+	}
+
+	err = os.Remove(staged)
+	if err != nil {
+		return false, fmt.Errorf("error removing staged import: %w", err)
+	}
+
+	return true, nil
+}
+
+// Apply replaces the configuration file and the files of the data directory
+// in the archive. Other files of the data directory are left alone.
+func (a *Archive) Apply(configPath, dataDir string) error {
+	err := writeFile(configPath, a.Config)
+	if err != nil {
+		return err
+	}
+
+	for name, data := range a.Data {
+		err = writeFile(filepath.Join(dataDir, name), data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFile atomically replaces a file only the owner can read, as the state
+// holds keys and secrets.
+func writeFile(file string, data []byte) error {
+	err := jsonfile.WriteFile(file, data)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", filepath.Base(file), err)
+	}
+
+	return nil
+}
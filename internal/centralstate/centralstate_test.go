@@ -0,0 +1,130 @@
+package centralstate
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchive_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	dataDir := filepath.Join(dir, "data")
+
+	files := map[string]string{
+		configPath:                                  `{"auth_key":"k","wrappers":[]}`,
+		filepath.Join(dataDir, "tokens.json"):       `[{"name":"ci"}]`,
+		filepath.Join(dataDir, "macros.json"):       `[]`,
+		filepath.Join(dataDir, "uptime.json.tmp"):   `[`,
+		filepath.Join(dataDir, "backups", "x.json"): `{}`,
+	}
+
+	for file, content := range files {
+		err := os.MkdirAll(filepath.Dir(file), 0750)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(file, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, err := Collect(configPath, dataDir)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	a.Schedules["server1"] = json.RawMessage(`[{"id":"abc","name":"nights"}]`)
+
+	var buf bytes.Buffer
+
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	err = a.Write(&buf, "1.2.3", created)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	read, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if read.Manifest.Version != "1.2.3" || !read.Manifest.Created.Equal(created) || len(read.Manifest.Data) != 2 {
+		t.Errorf("Unexpected manifest %+v", read.Manifest)
+	}
+
+	if string(read.Data["tokens.json"]) != `[{"name":"ci"}]` ||
+		string(read.Schedules["server1"]) != `[{"id":"abc","name":"nights"}]` {
+		t.Errorf("Unexpected archive %+v", read)
+	}
+
+	// Restore on another host
+	target := t.TempDir()
+	targetConfig := filepath.Join(target, "config.json")
+	targetData := filepath.Join(target, "data")
+
+	err = read.Stage(targetData)
+	if err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+
+	applied, err := ApplyStaged(targetConfig, targetData)
+	if err != nil || !applied {
+		t.Fatalf("ApplyStaged failed: %v, %v", applied, err)
+	}
+
+	if data, _ := os.ReadFile(targetConfig); string(data) != `{"auth_key":"k","wrappers":[]}` {
+		t.Errorf("Unexpected config %s", data)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(targetData, "tokens.json")); string(data) != `[{"name":"ci"}]` {
+		t.Errorf("Unexpected tokens %s", data)
+	}
+
+	_, err = os.Stat(filepath.Join(targetData, StagedName))
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected the staged import to be removed, got %v", err)
+	}
+
+	applied, err = ApplyStaged(targetConfig, targetData)
+	if applied || err != nil {
+		t.Errorf("Expected nothing to apply, got %v, %v", applied, err)
+	}
+}
+
+func TestRead_Invalid(t *testing.T) {
+	for name, files := range map[string]map[string]string{
+		"no manifest":  {"config.json": `{}`},
+		"unknown file": {"manifest.json": `{}`, "config.json": `{}`, "../etc/passwd.json": `{}`},
+		"nested data":  {"manifest.json": `{}`, "config.json": `{}`, "data/sub/x.json": `{}`},
+		"not json":     {"manifest.json": `{}`, "config.json": `{`},
+	} {
+		var buf bytes.Buffer
+
+		zw := zip.NewWriter(&buf)
+
+		for file, content := range files {
+			w, err := zw.Create(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _ = w.Write([]byte(content))
+		}
+
+		_ = zw.Close()
+
+		_, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected an invalid archive, got %v", name, err)
+		}
+	}
+}
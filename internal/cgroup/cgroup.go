@@ -0,0 +1,45 @@
+// Package cgroup moves bedrock_server into its own cgroup v2 group so the
+// wrapper can cap its memory and CPU.
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrUnsupported is returned without cgroup v2.
+var ErrUnsupported = errors.New("resource limits need cgroup v2 on Linux")
+
+// parsePath returns the cgroup v2 path from /proc/<pid>/cgroup.
+func parsePath(r io.Reader) (string, bool) {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		path, ok := strings.CutPrefix(scanner.Text(), "0::")
+		if ok {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+// controllers returns the controllers that settings such as "memory.max"
+// belong to.
+func controllers(settings map[string]string) []string {
+	seen := make(map[string]bool)
+
+	var list []string
+
+	for file := range settings {
+		controller, _, ok := strings.Cut(file, ".")
+		if ok && !seen[controller] {
+			seen[controller] = true
+			list = append(list, controller)
+		}
+	}
+
+	return list
+}
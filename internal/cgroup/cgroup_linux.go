@@ -0,0 +1,95 @@
+package cgroup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+const root = "/sys/fs/cgroup"
+
+// Attach moves a process into a "bedrock" cgroup next to a "wrapper" cgroup
+// for the calling process, as cgroup v2 only lets leaf cgroups hold
+// processes, and applies settings such as "memory.max" to it. It can be
+// called again to add settings. The wrapper's cgroup must be delegated to
+// it, for example with Delegate= in its systemd unit. It returns the
+// directory of the cgroup.
+func Attach(pid int, settings map[string]string) (string, error) {
+	_, err := os.Stat(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return "", ErrUnsupported
+	}
+
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", fmt.Errorf("error reading cgroup: %w", err)
+	}
+	defer f.Close()
+
+	path, ok := parsePath(f)
+	if !ok {
+		return "", ErrUnsupported
+	}
+
+	base := filepath.Join(root, filepath.Clean("/"+path))
+
+	// Setting up the split a second time finds the wrapper already moved
+	if filepath.Base(base) == "wrapper" {
+		base = filepath.Dir(base)
+	}
+
+	wrapper := filepath.Join(base, "wrapper")
+	bedrock := filepath.Join(base, "bedrock")
+
+	for _, dir := range []string{wrapper, bedrock} {
+		err = os.MkdirAll(dir, 0750)
+		if err != nil {
+			return "", fmt.Errorf("error creating cgroup: %w", err)
+		}
+	}
+
+	err = write(filepath.Join(wrapper, "cgroup.procs"), strconv.Itoa(os.Getpid()))
+	if err != nil {
+		return "", err
+	}
+
+	for _, controller := range controllers(settings) {
+		err = write(filepath.Join(base, "cgroup.subtree_control"), "+"+controller)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	files := make([]string, 0, len(settings))
+	for file := range settings {
+		files = append(files, file)
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		err = write(filepath.Join(bedrock, file), settings[file])
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = write(filepath.Join(bedrock, "cgroup.procs"), strconv.Itoa(pid))
+	if err != nil {
+		return "", err
+	}
+
+	return bedrock, nil
+}
+
+// write sets a cgroup file.
+func write(file, value string) error {
+	err := os.WriteFile(file, []byte(value), 0600)
+	if err != nil {
+		return fmt.Errorf("error configuring cgroup (is it delegated?): %w", err)
+	}
+
+	return nil
+}
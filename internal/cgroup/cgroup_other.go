@@ -0,0 +1,8 @@
+//go:build !linux
+
+package cgroup
+
+// Attach always fails outside Linux.
+func Attach(pid int, settings map[string]string) (string, error) {
+	return "", ErrUnsupported
+}
@@ -0,0 +1,27 @@
+package cgroup
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	path, ok := parsePath(strings.NewReader("4:memory:/old\n0::/system.slice/minecraft-server-wrapper.service\n"))
+	if !ok || path != "/system.slice/minecraft-server-wrapper.service" {
+		t.Errorf("Unexpected cgroup path: %q, %v", path, ok)
+	}
+
+	if _, ok := parsePath(strings.NewReader("4:memory:/old\n")); ok {
+		t.Errorf("Expected no cgroup v2 path")
+	}
+}
+
+func TestControllers(t *testing.T) {
+	got := controllers(map[string]string{"memory.max": "1G", "memory.high": "900M", "cpu.max": "200000 100000"})
+	sort.Strings(got)
+
+	if strings.Join(got, ",") != "cpu,memory" {
+		t.Errorf("Unexpected controllers: %v", got)
+	}
+}
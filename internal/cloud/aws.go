@@ -0,0 +1,220 @@
+package cloud
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ec2Version is the version of the EC2 query API used.
+const ec2Version = "2016-11-15"
+
+// AWS powers an EC2 instance on and off through the EC2 query API. Without
+// credentials, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN are used.
+type AWS struct {
+	Region          string
+	InstanceID      string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Endpoint        string       // https://ec2.<region>.amazonaws.com/ if empty
+	Client          *http.Client // http.DefaultClient if nil
+}
+
+// Start starts the instance.
+func (a AWS) Start(ctx context.Context) error {
+	_, err := a.call(ctx, "StartInstances", url.Values{"InstanceId.1": {a.InstanceID}})
+	return err
+}
+
+// Stop stops the instance.
+func (a AWS) Stop(ctx context.Context) error {
+	_, err := a.call(ctx, "StopInstances", url.Values{"InstanceId.1": {a.InstanceID}})
+	return err
+}
+
+// State returns the state of the instance.
+func (a AWS) State(ctx context.Context) (string, error) {
+	data, err := a.call(ctx, "DescribeInstances", url.Values{"InstanceId.1": {a.InstanceID}})
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Reservations []struct {
+			Instances []struct {
+				ID    string `xml:"instanceId"`
+				State string `xml:"instanceState>name"`
+			} `xml:"instancesSet>item"`
+		} `xml:"reservationSet>item"`
+	}
+
+	err = xml.Unmarshal(data, &resp)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid DescribeInstances response: %w", ErrProvider, err)
+	}
+
+	for _, r := range resp.Reservations {
+		for _, i := range r.Instances {
+			if i.ID == a.InstanceID {
+				return ec2State(i.State), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("%w: instance %s not found", ErrProvider, a.InstanceID)
+}
+
+// ec2State maps an EC2 instance state to a host state.
+func ec2State(state string) string {
+	switch state {
+	case "pending":
+		return StateStarting
+	case "running":
+		return StateRunning
+	case "stopping", "shutting-down":
+		return StateStopping
+	case "stopped", "terminated":
+		return StateStopped
+	default:
+		return StateUnknown
+	}
+}
+
+// call sends a signed EC2 query API request and returns the response.
+func (a AWS) call(ctx context.Context, action string, params url.Values) ([]byte, error) {
+	keyID, secret, token := a.AccessKeyID, a.SecretAccessKey, a.SessionToken
+	if keyID == "" {
+		keyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		secret = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		token = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	if keyID == "" || secret == "" {
+		return nil, fmt.Errorf("%w: no AWS credentials", ErrProvider)
+	}
+
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = "https://ec2." + a.Region + ".amazonaws.com/"
+	}
+
+	params.Set("Action", action)
+	params.Set("Version", ec2Version)
+	body := params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating EC2 request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	if token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	signV4(req, body, keyID, secret, a.Region, "ec2", time.Now())
+
+	data, err := do(a.Client, req)
+	if err != nil {
+		return nil, ec2Error(data, err)
+	}
+
+	return data, nil
+}
+
+// ec2Error returns the message of the EC2 error response in data, if any,
+// or err.
+func ec2Error(data []byte, err error) error {
+	var resp struct {
+		Errors []struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Errors>Error"`
+	}
+
+	if xml.Unmarshal(data, &resp) != nil || len(resp.Errors) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("%w: %s: %s", ErrProvider, resp.Errors[0].Code, resp.Errors[0].Message)
+}
+
+// signV4 signs a request with AWS Signature Version 4.
+func signV4(req *http.Request, body, keyID, secret, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := []string{"content-type", "host", "x-amz-date"}
+	if req.Header.Get("X-Amz-Security-Token") != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+
+	var canonical strings.Builder
+
+	for _, h := range headers {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+
+		canonical.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	signed := strings.Join(headers, ";")
+	request := strings.Join([]string{req.Method, path, req.URL.RawQuery, canonical.String(), signed, hashHex(body)}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hashHex(request)}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(signingKey(secret, date, region, service), toSign))
+
+	req.Header.Set("Authorization",
+		fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", keyID, scope, signed, signature))
+}
+
+// signingKey derives the Signature Version 4 signing key.
+func signingKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+func hashHex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// Validate checks the AWS settings.
+func (a AWS) Validate() error {
+	if a.Region == "" || a.InstanceID == "" {
+		return fmt.Errorf("%w: aws needs a region and an instance ID", ErrInvalid)
+	}
+
+	return nil
+}
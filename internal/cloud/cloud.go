@@ -0,0 +1,338 @@
+// Package cloud powers the VMs hosting wrappers on and off: before
+// scheduled sessions and when they have been idle, through a generic
+// webhook or the AWS and GCP APIs.
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// States of a host, as reported by its provider.
+const (
+	StateUnknown  = "unknown"
+	StateStarting = "starting"
+	StateRunning  = "running"
+	StateStopping = "stopping"
+	StateStopped  = "stopped"
+)
+
+// Actions taken on a host.
+const (
+	ActionStart = "start"
+	ActionStop  = "stop"
+)
+
+var days = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+var (
+	ErrInvalid  = errors.New("invalid host configuration")
+	ErrProvider = errors.New("cloud provider error")
+)
+
+// Provider powers a VM on and off.
+type Provider interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	State(ctx context.Context) (string, error) // One of the State constants
+}
+
+// Session is a time the host is kept powered on, in the timezone of its
+// policy. An end at or before the start is on the next day.
+type Session struct {
+	Days  []string // sun..sat, every day if empty
+	Start string   // HH:MM
+	End   string   // HH:MM
+}
+
+// validate checks a session.
+func (s Session) validate() error {
+	for _, day := range s.Days {
+		if dayIndex(day) < 0 {
+			return fmt.Errorf("%w: unknown day %q", ErrInvalid, day)
+		}
+	}
+
+	for _, t := range []string{s.Start, s.End} {
+		_, err := time.Parse("15:04", t)
+		if err != nil {
+			return fmt.Errorf("%w: session time %q isn't HH:MM", ErrInvalid, t)
+		}
+	}
+
+	return nil
+}
+
+// around returns the end of the session t falls in, if any, with the host
+// powered on lead before the session starts.
+func (s Session) around(t time.Time, lead time.Duration) (time.Time, bool) {
+	start, _ := time.Parse("15:04", s.Start)
+	end, _ := time.Parse("15:04", s.End)
+
+	for _, offset := range []int{-1, 0, 1} {
+		day := t.AddDate(0, 0, offset)
+		if !s.onDay(day.Weekday()) {
+			continue
+		}
+
+		midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, t.Location())
+		from := midnight.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+		to := midnight.Add(time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute)
+
+		if !to.After(from) {
+			to = to.AddDate(0, 0, 1)
+		}
+
+		if !t.Before(from.Add(-lead)) && t.Before(to) {
+			return to, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// onDay reports whether the session starts on a day.
+func (s Session) onDay(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+
+	for _, d := range s.Days {
+		if dayIndex(d) == int(day) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Policy is when a host is powered on and off automatically.
+type Policy struct {
+	Sessions []Session
+	Lead     time.Duration  // Powered on this long before a session
+	IdleStop time.Duration  // Stopped after this long without players outside sessions, never if zero
+	Location *time.Location // Timezone of session times, time.Local if nil
+}
+
+// Validate checks a policy.
+func (p Policy) Validate() error {
+	if p.Lead < 0 || p.IdleStop < 0 {
+		return fmt.Errorf("%w: negative lead or idle stop", ErrInvalid)
+	}
+
+	for _, s := range p.Sessions {
+		err := s.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// location returns the timezone of session times.
+func (p Policy) location() *time.Location {
+	if p.Location == nil {
+		return time.Local
+	}
+
+	return p.Location
+}
+
+// session returns the end of the session t falls in, if any.
+func (p Policy) session(t time.Time) (time.Time, bool) {
+	var (
+		end time.Time
+		in  bool
+	)
+
+	t = t.In(p.location())
+
+	for _, s := range p.Sessions {
+		if to, ok := s.around(t, p.Lead); ok && to.After(end) {
+			end, in = to, true
+		}
+	}
+
+	return end, in
+}
+
+// Action is an action taken on a host.
+type Action struct {
+	Action string    `json:"action"`
+	Actor  string    `json:"actor"` // "policy" when taken automatically
+	Time   time.Time `json:"time"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Status is the state of a host, distinct from whether its wrapper is
+// connected.
+type Status struct {
+	State      string     `json:"state"`
+	Checked    time.Time  `json:"checked"`
+	Error      string     `json:"error,omitempty"` // Of the last state check
+	InSession  bool       `json:"in_session"`
+	SessionEnd *time.Time `json:"session_end,omitempty"`
+	Timezone   string     `json:"timezone"` // IANA name of the timezone of session times
+	IdleSince  *time.Time `json:"idle_since,omitempty"`
+	LastAction *Action    `json:"last_action,omitempty"`
+}
+
+// Host is a VM hosting a wrapper, powered on and off by its policy or on
+// request.
+type Host struct {
+	provider Provider
+	policy   Policy
+
+	mu         sync.Mutex
+	state      string
+	checked    time.Time
+	err        error
+	idleSince  time.Time
+	skipUntil  time.Time // A session stopped on request isn't started again
+	lastAction *Action
+}
+
+// NewHost returns a host powered on and off by a provider.
+func NewHost(provider Provider, policy Policy) (*Host, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("%w: no provider", ErrInvalid)
+	}
+
+	err := policy.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Host{provider: provider, policy: policy, state: StateUnknown}, nil
+}
+
+// Refresh asks the provider for the state of the host.
+func (h *Host) Refresh(ctx context.Context) string {
+	state, err := h.provider.State(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checked = time.Now().UTC()
+	h.err = err
+
+	if err != nil {
+		h.state = StateUnknown
+	} else {
+		h.state = state
+	}
+
+	return h.state
+}
+
+// Due returns the action the policy calls for at now: starting a stopped
+// host in a session, or stopping a running host that has had no players
+// for the idle stop period outside sessions. Players is the number of
+// players online, or negative if unknown, which doesn't count as idle.
+func (h *Host) Due(now time.Time, players int) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if players != 0 || h.state != StateRunning {
+		h.idleSince = time.Time{}
+	} else if h.idleSince.IsZero() {
+		h.idleSince = now
+	}
+
+	_, in := h.policy.session(now)
+
+	switch {
+	case in && h.state == StateStopped && !now.Before(h.skipUntil):
+		return ActionStart
+	case !in && h.policy.IdleStop > 0 && !h.idleSince.IsZero() && now.Sub(h.idleSince) >= h.policy.IdleStop:
+		return ActionStop
+	}
+
+	return ""
+}
+
+// Apply starts or stops the host for an actor at now. A host stopped
+// during a session isn't started again by the policy until it ends.
+func (h *Host) Apply(ctx context.Context, now time.Time, action, actor string) error {
+	var err error
+
+	switch action {
+	case ActionStart:
+		err = h.provider.Start(ctx)
+	case ActionStop:
+		err = h.provider.Stop(ctx)
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalid, action)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastAction = &Action{Action: action, Actor: actor, Time: now.UTC()}
+
+	if err != nil {
+		h.lastAction.Error = err.Error()
+		return err
+	}
+
+	h.idleSince = time.Time{}
+
+	if action == ActionStart {
+		h.state = StateStarting
+		h.skipUntil = time.Time{}
+	} else {
+		h.state = StateStopping
+
+		if end, in := h.policy.session(now); in {
+			h.skipUntil = end
+		}
+	}
+
+	return nil
+}
+
+// Status returns the state of the host at now.
+func (h *Host) Status(now time.Time) Status {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := Status{State: h.state, Checked: h.checked, Timezone: h.policy.location().String()}
+
+	if h.err != nil {
+		status.Error = h.err.Error()
+	}
+
+	if end, in := h.policy.session(now); in {
+		end = end.UTC()
+		status.InSession = true
+		status.SessionEnd = &end
+	}
+
+	if !h.idleSince.IsZero() {
+		since := h.idleSince.UTC()
+		status.IdleSince = &since
+	}
+
+	if h.lastAction != nil {
+		action := *h.lastAction
+		status.LastAction = &action
+	}
+
+	return status
+}
+
+// dayIndex returns the index of a day name, or -1.
+func dayIndex(day string) int {
+	for i, d := range days {
+		if strings.EqualFold(d, day) {
+			return i
+		}
+	}
+
+	return -1
+}
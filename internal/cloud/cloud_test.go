@@ -0,0 +1,361 @@
+package cloud
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProvider records actions and reports a fixed state.
+type fakeProvider struct {
+	state   string
+	actions []string
+	err     error
+}
+
+func (f *fakeProvider) Start(context.Context) error {
+	f.actions = append(f.actions, ActionStart)
+	return f.err
+}
+
+func (f *fakeProvider) Stop(context.Context) error {
+	f.actions = append(f.actions, ActionStop)
+	return f.err
+}
+
+func (f *fakeProvider) State(context.Context) (string, error) {
+	return f.state, f.err
+}
+
+func TestNewHost_Invalid(t *testing.T) {
+	for _, policy := range []Policy{
+		{Lead: -time.Minute},
+		{Sessions: []Session{{Start: "8pm", End: "23:00"}}},
+		{Sessions: []Session{{Days: []string{"someday"}, Start: "20:00", End: "23:00"}}},
+	} {
+		_, err := NewHost(&fakeProvider{}, policy)
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", policy, err)
+		}
+	}
+
+	_, err := NewHost(nil, Policy{})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected a host without a provider to be invalid, got %v", err)
+	}
+}
+
+func TestHost_Sessions(t *testing.T) {
+	provider := &fakeProvider{state: StateStopped}
+
+	host, err := NewHost(provider, Policy{
+		Sessions: []Session{{Days: []string{"fri"}, Start: "20:00", End: "01:00"}},
+		Lead:     15 * time.Minute,
+		IdleStop: 30 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewHost failed: %v", err)
+	}
+
+	friday := time.Date(2026, 5, 1, 19, 40, 0, 0, time.Local) // A Friday
+	host.Refresh(context.Background())
+
+	if action := host.Due(friday, -1); action != "" {
+		t.Errorf("Expected nothing before the lead time, got %q", action)
+	}
+
+	if action := host.Due(friday.Add(5*time.Minute), -1); action != ActionStart {
+		t.Fatalf("Expected a start in the lead time, got %q", action)
+	}
+
+	// Past midnight, the session is still on
+	provider.state = StateRunning
+	host.Refresh(context.Background())
+
+	late := friday.Add(5 * time.Hour) // 00:40 on Saturday
+	if action := host.Due(late, 0); action != "" {
+		t.Errorf("Expected no idle stop in a session, got %q", action)
+	}
+
+	if status := host.Status(late); !status.InSession || status.SessionEnd == nil || status.SessionEnd.Hour() != 1 {
+		t.Errorf("Expected the session to end at 01:00, got %+v", status)
+	}
+
+	// Idle time in the session counts once it is over
+	if action := host.Due(late.Add(20*time.Minute), 0); action != "" {
+		t.Errorf("Expected no stop before the idle period, got %q", action)
+	}
+
+	if action := host.Due(late.Add(50*time.Minute), 2); action != "" {
+		t.Errorf("Expected players to reset the idle period, got %q", action)
+	}
+
+	host.Due(late.Add(time.Hour), 0)
+
+	if action := host.Due(late.Add(90*time.Minute), 0); action != ActionStop {
+		t.Errorf("Expected an idle stop, got %q", action)
+	}
+}
+
+func TestHost_StoppedInSession(t *testing.T) {
+	provider := &fakeProvider{state: StateRunning}
+
+	host, err := NewHost(provider, Policy{Sessions: []Session{{Start: "20:00", End: "23:00"}}})
+	if err != nil {
+		t.Fatalf("NewHost failed: %v", err)
+	}
+
+	evening := time.Date(2026, 5, 1, 21, 0, 0, 0, time.Local)
+	host.Refresh(context.Background())
+
+	err = host.Apply(context.Background(), evening, ActionStop, "alice")
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	provider.state = StateStopped
+	host.Refresh(context.Background())
+
+	if action := host.Due(evening.Add(time.Hour), -1); action != "" {
+		t.Errorf("Expected a host stopped by hand to stay off for the session, got %q", action)
+	}
+
+	if action := host.Due(evening.Add(23*time.Hour), -1); action != ActionStart {
+		t.Errorf("Expected a start in the next session, got %q", action)
+	}
+
+	status := host.Status(evening)
+	if status.LastAction == nil || status.LastAction.Actor != "alice" || status.LastAction.Action != ActionStop {
+		t.Errorf("Expected the stop to be recorded, got %+v", status.LastAction)
+	}
+
+	provider.err = errors.New("quota exceeded")
+
+	err = host.Apply(context.Background(), evening, ActionStart, "bob")
+	if err == nil {
+		t.Fatal("Expected the start to fail")
+	}
+
+	if status = host.Status(evening); status.LastAction.Error != "quota exceeded" {
+		t.Errorf("Expected the failure to be recorded, got %+v", status.LastAction)
+	}
+
+	if state := host.Refresh(context.Background()); state != StateUnknown || host.Status(evening).Error == "" {
+		t.Errorf("Expected an unknown state with the error, got %q", state)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var actions []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		actions = append(actions, req["action"])
+
+		if req["action"] == "state" {
+			_, _ = w.Write([]byte(`{"state":"running"}`))
+		}
+	}))
+	defer srv.Close()
+
+	hook := Webhook{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}
+
+	state, err := hook.State(context.Background())
+	if err != nil || state != StateRunning {
+		t.Fatalf("Unexpected state %q, %v", state, err)
+	}
+
+	err = hook.Stop(context.Background())
+	if err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	if strings.Join(actions, ",") != "state,stop" {
+		t.Errorf("Unexpected actions %v", actions)
+	}
+
+	err = (Webhook{URL: srv.URL}).Start(context.Background())
+	if !errors.Is(err, ErrProvider) {
+		t.Errorf("Expected a provider error, got %v", err)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+
+	if got := hex.EncodeToString(key); got != "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d" {
+		t.Errorf("Unexpected signing key %s", got)
+	}
+}
+
+func TestAWS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(auth, "/eu-west-1/ec2/aws4_request") {
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+
+		_ = r.ParseForm()
+
+		if r.Form.Get("InstanceId.1") != "i-0abc" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`<Response><Errors><Error><Code>InvalidInstanceID.NotFound</Code><Message>The instance ID ` +
+				`does not exist</Message></Error></Errors></Response>`))
+
+			return
+		}
+
+		switch r.Form.Get("Action") {
+		case "DescribeInstances":
+			_, _ = w.Write([]byte(`<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+				<instanceId>i-0abc</instanceId><instanceState><code>80</code><name>stopped</name></instanceState>
+			</item></instancesSet></item></reservationSet></DescribeInstancesResponse>`))
+		case "StartInstances":
+			_, _ = w.Write([]byte(`<StartInstancesResponse/>`))
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	aws := AWS{
+		Region:          "eu-west-1",
+		InstanceID:      "i-0abc",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		Endpoint:        srv.URL + "/",
+	}
+
+	state, err := aws.State(context.Background())
+	if err != nil || state != StateStopped {
+		t.Fatalf("Unexpected state %q, %v", state, err)
+	}
+
+	err = aws.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	aws.InstanceID = "i-missing"
+
+	_, err = aws.State(context.Background())
+	if !errors.Is(err, ErrProvider) || !strings.Contains(err.Error(), "InvalidInstanceID.NotFound") {
+		t.Errorf("Expected the EC2 error, got %v", err)
+	}
+}
+
+func TestGCP(t *testing.T) {
+	tokens := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				http.Error(w, "missing header", http.StatusForbidden)
+				return
+			}
+
+			tokens++
+			_, _ = w.Write([]byte(`{"access_token":"ya29.token","expires_in":3600}`))
+
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer ya29.token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/projects/games/zones/europe-west1-b/instances/mc-1":
+			_, _ = w.Write([]byte(`{"status":"TERMINATED"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/projects/games/zones/europe-west1-b/instances/mc-1/start":
+			_, _ = w.Write([]byte(`{"kind":"compute#operation"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	gcp := &GCP{
+		Project:  "games",
+		Zone:     "europe-west1-b",
+		Instance: "mc-1",
+		Endpoint: srv.URL + "/",
+		TokenURL: srv.URL + "/token",
+	}
+
+	state, err := gcp.State(context.Background())
+	if err != nil || state != StateStopped {
+		t.Fatalf("Unexpected state %q, %v", state, err)
+	}
+
+	err = gcp.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	if tokens != 1 {
+		t.Errorf("Expected the token to be cached, got %d token requests", tokens)
+	}
+
+	err = gcp.Stop(context.Background())
+	if !errors.Is(err, ErrProvider) {
+		t.Errorf("Expected a provider error, got %v", err)
+	}
+}
+
+func TestSession_Days(t *testing.T) {
+	s := Session{Days: []string{"Sat"}, Start: "10:00", End: "12:00"}
+
+	saturday := time.Date(2026, 5, 2, 11, 0, 0, 0, time.UTC)
+	if _, ok := s.around(saturday, 0); !ok {
+		t.Error("Expected Saturday 11:00 to be in the session")
+	}
+
+	if _, ok := s.around(saturday.AddDate(0, 0, 1), 0); ok {
+		t.Error("Expected Sunday 11:00 not to be in the session")
+	}
+}
+
+func TestPolicy_Location(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := NewHost(&fakeProvider{state: StateStopped}, Policy{
+		Sessions: []Session{{Days: []string{"sat"}, Start: "10:00", End: "12:00"}},
+		Location: tokyo,
+	})
+	if err != nil {
+		t.Fatalf("NewHost failed: %v", err)
+	}
+
+	// Saturday 11:00 in Tokyo is still Saturday 02:00 in UTC
+	now := time.Date(2026, 5, 2, 2, 0, 0, 0, time.UTC)
+
+	status := host.Status(now)
+	if !status.InSession || status.Timezone != "Asia/Tokyo" {
+		t.Fatalf("Expected the session to be evaluated in Tokyo time, got %+v", status)
+	}
+
+	if want := time.Date(2026, 5, 2, 3, 0, 0, 0, time.UTC); !status.SessionEnd.Equal(want) ||
+		status.SessionEnd.Location() != time.UTC {
+		t.Errorf("Expected the session to end at %v, got %v", want, status.SessionEnd)
+	}
+}
@@ -0,0 +1,176 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// gcpEndpoint is the Compute Engine API.
+	gcpEndpoint = "https://compute.googleapis.com/compute/v1/"
+
+	// gcpTokenURL returns tokens of the default service account of the VM
+	// the central server runs on.
+	gcpTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// GCP powers a Compute Engine instance on and off. Without an access
+// token, GCP_ACCESS_TOKEN or a token of the service account of the VM the
+// central server runs on is used.
+type GCP struct {
+	Project     string
+	Zone        string
+	Instance    string
+	AccessToken string
+	Endpoint    string       // gcpEndpoint if empty
+	TokenURL    string       // gcpTokenURL if empty
+	Client      *http.Client // http.DefaultClient if nil
+
+	token gcpToken // Cached metadata server token
+}
+
+// gcpToken caches an access token until it expires.
+type gcpToken struct {
+	mu      sync.Mutex
+	value   string
+	expires time.Time
+}
+
+// Validate checks the GCP settings.
+func (g *GCP) Validate() error {
+	if g.Project == "" || g.Zone == "" || g.Instance == "" {
+		return fmt.Errorf("%w: gcp needs a project, a zone and an instance", ErrInvalid)
+	}
+
+	return nil
+}
+
+// Start starts the instance.
+func (g *GCP) Start(ctx context.Context) error {
+	_, err := g.call(ctx, http.MethodPost, "/start")
+	return err
+}
+
+// Stop stops the instance.
+func (g *GCP) Stop(ctx context.Context) error {
+	_, err := g.call(ctx, http.MethodPost, "/stop")
+	return err
+}
+
+// State returns the state of the instance.
+func (g *GCP) State(ctx context.Context) (string, error) {
+	data, err := g.call(ctx, http.MethodGet, "")
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Status string `json:"status"`
+	}
+
+	err = json.Unmarshal(data, &resp)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid instance response: %w", ErrProvider, err)
+	}
+
+	return gceState(resp.Status), nil
+}
+
+// gceState maps a Compute Engine instance status to a host state.
+func gceState(status string) string {
+	switch status {
+	case "PROVISIONING", "STAGING", "REPAIRING":
+		return StateStarting
+	case "RUNNING":
+		return StateRunning
+	case "STOPPING", "SUSPENDING":
+		return StateStopping
+	case "TERMINATED", "SUSPENDED":
+		return StateStopped
+	default:
+		return StateUnknown
+	}
+}
+
+// call sends an authorized request for the instance, or one of its
+// methods, and returns the response.
+func (g *GCP) call(ctx context.Context, method, suffix string) ([]byte, error) {
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = gcpEndpoint
+	}
+
+	path := fmt.Sprintf("projects/%s/zones/%s/instances/%s%s",
+		url.PathEscape(g.Project), url.PathEscape(g.Zone), url.PathEscape(g.Instance), suffix)
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Compute Engine request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return do(g.Client, req)
+}
+
+// accessToken returns the configured token, or one from the metadata
+// server, cached until shortly before it expires.
+func (g *GCP) accessToken(ctx context.Context) (string, error) {
+	if g.AccessToken != "" {
+		return g.AccessToken, nil
+	}
+
+	if token := os.Getenv("GCP_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	g.token.mu.Lock()
+	defer g.token.mu.Unlock()
+
+	if g.token.value != "" && time.Now().Before(g.token.expires) {
+		return g.token.value, nil
+	}
+
+	tokenURL := g.TokenURL
+	if tokenURL == "" {
+		tokenURL = gcpTokenURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating token request: %w", err)
+	}
+
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	data, err := do(g.Client, req)
+	if err != nil {
+		return "", fmt.Errorf("error getting a GCP access token: %w", err)
+	}
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+
+	err = json.Unmarshal(data, &resp)
+	if err != nil || resp.AccessToken == "" {
+		return "", fmt.Errorf("%w: invalid token response", ErrProvider)
+	}
+
+	g.token.value = resp.AccessToken
+	g.token.expires = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+
+	return g.token.value, nil
+}
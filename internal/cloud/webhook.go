@@ -0,0 +1,106 @@
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxResponseSize bounds the response of a provider API.
+const maxResponseSize = 1 << 20
+
+// Webhook powers a host on and off through an HTTP API of your own, such
+// as a serverless function. It is POSTed {"action": "start"}, "stop" or
+// "state", and answers state requests with {"state": "running"}, using
+// the State constants.
+type Webhook struct {
+	URL     string
+	Headers map[string]string // e.g. Authorization
+	Client  *http.Client      // http.DefaultClient if nil
+}
+
+// Start asks the webhook to power the host on.
+func (h Webhook) Start(ctx context.Context) error {
+	_, err := h.post(ctx, ActionStart)
+	return err
+}
+
+// Stop asks the webhook to power the host off.
+func (h Webhook) Stop(ctx context.Context) error {
+	_, err := h.post(ctx, ActionStop)
+	return err
+}
+
+// State asks the webhook for the state of the host.
+func (h Webhook) State(ctx context.Context) (string, error) {
+	data, err := h.post(ctx, "state")
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		State string `json:"state"`
+	}
+
+	err = json.Unmarshal(data, &resp)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid state response: %w", ErrProvider, err)
+	}
+
+	switch resp.State {
+	case StateStarting, StateRunning, StateStopping, StateStopped:
+		return resp.State, nil
+	default:
+		return "", fmt.Errorf("%w: unknown state %q", ErrProvider, resp.State)
+	}
+}
+
+// post sends an action to the webhook and returns the response.
+func (h Webhook) post(ctx context.Context, action string) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{"action": action})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding webhook request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for key, value := range h.Headers {
+		req.Header.Set(key, value)
+	}
+
+	return do(h.Client, req)
+}
+
+// do sends a request and returns the body of the response, with an error
+// if it isn't successful.
+func do(client *http.Client, req *http.Request) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProvider, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: error reading response: %w", ErrProvider, err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return data, fmt.Errorf("%w: %s: %s", ErrProvider, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// propertyRules check the values of the server.properties keys bedrock_server
+// rejects or misreads when malformed. Other keys aren't checked.
+var propertyRules = map[string]func(string) error{
+	"server-name":                     nonEmpty,
+	"level-name":                      nonEmpty,
+	"server-port":                     intRange(1, 65535),
+	"server-portv6":                   intRange(1, 65535),
+	"max-players":                     intRange(1, 1000),
+	"view-distance":                   intRange(5, 96),
+	"tick-distance":                   intRange(4, 12),
+	"player-idle-timeout":             intRange(0, 1<<31-1),
+	"max-threads":                     intRange(0, 1024),
+	"compression-threshold":           intRange(0, 65535),
+	"gamemode":                        oneOf("survival", "creative", "adventure", "0", "1", "2"),
+	"difficulty":                      oneOf("peaceful", "easy", "normal", "hard", "0", "1", "2", "3"),
+	"default-player-permission-level": oneOf("visitor", "member", "operator"),
+	"compression-algorithm":           oneOf("zlib", "snappy"),
+	"allow-cheats":                    boolean,
+	"online-mode":                     boolean,
+	"allow-list":                      boolean,
+	"white-list":                      boolean,
+	"texturepack-required":            boolean,
+	"content-log-file-enabled":        boolean,
+	"enable-lan-visibility":           boolean,
+	"disable-custom-skins":            boolean,
+}
+
+// CheckProperties checks the values of known server.properties keys,
+// returning all problems found.
+func CheckProperties(props map[string]string) error {
+	var errs []error
+
+	for _, key := range slices.Sorted(maps.Keys(props)) {
+		rule, ok := propertyRules[key]
+		if !ok {
+			continue
+		}
+
+		err := rule(strings.TrimSpace(props[key]))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %w", key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func nonEmpty(value string) error {
+	if value == "" {
+		return errors.New("must not be empty")
+	}
+
+	return nil
+}
+
+func intRange(min, max int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < min || n > max {
+			return fmt.Errorf("must be a number from %d to %d, got %q", min, max, value)
+		}
+
+		return nil
+	}
+}
+
+func oneOf(values ...string) func(string) error {
+	return func(value string) error {
+		if !slices.Contains(values, value) {
+			return fmt.Errorf("must be one of %s, got %q", strings.Join(values, ", "), value)
+		}
+
+		return nil
+	}
+}
+
+func boolean(value string) error {
+	if value != "true" && value != "false" {
+		return fmt.Errorf("must be true or false, got %q", value)
+	}
+
+	return nil
+}
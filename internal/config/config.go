@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -14,6 +15,19 @@ func UpdateServerProperties(appDir string) error {
 	propsFile := filepath.Join(appDir, "server.properties")
 
 	// Get all relevant environment variables first
+	envVars := PropertiesFromEnv()
+
+	// Don't even open the file if there are no variables to process
+	if len(envVars) == 0 {
+		return nil
+	}
+
+	return setProperties(propsFile, envVars, false)
+}
+
+// PropertiesFromEnv returns the properties set by environment variables
+// prefixed with CFG_, e.g. CFG_MAX_PLAYERS for max-players.
+func PropertiesFromEnv() map[string]string {
 	envVars := make(map[string]string)
 
 	for _, env := range os.Environ() {
@@ -32,19 +46,51 @@ func UpdateServerProperties(appDir string) error {
 		envVars[key] = value
 	}
 
-	// Don't even open the file if there are no variables to process
-	if len(envVars) == 0 {
-		return nil
-	}
+	return envVars
+}
 
+// EnsureProperties sets the given properties in the server.properties file,
+// appending any that are not present yet.
+func EnsureProperties(appDir string, values map[string]string) error {
+	return setProperties(filepath.Join(appDir, "server.properties"), values, true)
+}
+
+// setProperties updates the properties file with the given values. When
+// appendMissing is set, values for keys not present in the file are appended.
+func setProperties(propsFile string, values map[string]string, appendMissing bool) error {
 	// Read the current server.properties file
 	lines, err := readPropertiesFile(propsFile)
 	if err != nil {
 		return fmt.Errorf("error reading properties file: %v", err)
 	}
 
+	newLines, updated := applyProperties(lines, values, appendMissing)
+
+	// Only write the file if we found actual changes
+	if updated {
+		err := writePropertiesFile(propsFile, newLines)
+		if err != nil {
+			return fmt.Errorf("error writing properties file: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// UpdateProperties returns the contents of a server.properties file with the
+// given values set, appending those not present.
+func UpdateProperties(data []byte, values map[string]string) []byte {
+	lines, _ := applyProperties(splitLines(data), values, true)
+
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// applyProperties returns the lines of a properties file with the given
+// values set and whether anything changed.
+func applyProperties(lines []string, values map[string]string, appendMissing bool) ([]string, bool) {
 	// Update the properties
 	updated := false
+	seen := make(map[string]bool)
 	newLines := make([]string, len(lines))
 	copy(newLines, lines)
 
@@ -60,7 +106,9 @@ func UpdateServerProperties(appDir string) error {
 		}
 
 		key := strings.TrimSpace(parts[0])
-		if newValue, exists := envVars[key]; exists {
+		seen[key] = true
+
+		if newValue, exists := values[key]; exists {
 			currentValue := strings.TrimSpace(parts[1])
 			if currentValue != newValue {
 				newLines[i] = fmt.Sprintf("%s=%s", key, newValue)
@@ -71,15 +119,70 @@ func UpdateServerProperties(appDir string) error {
 		}
 	}
 
-	// Only write the file if we found actual changes
-	if updated {
-		err := writePropertiesFile(propsFile, newLines)
-		if err != nil {
-			return fmt.Errorf("error writing properties file: %v", err)
+	if appendMissing {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			if !seen[key] {
+				keys = append(keys, key)
+			}
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			newLines = append(newLines, fmt.Sprintf("%s=%s", key, values[key]))
+			updated = true
+
+			fmt.Printf("Adding %s=%s\n", key, values[key])
 		}
 	}
 
-	return nil
+	return newLines, updated
+}
+
+// ReadProperties returns the properties set in the server.properties file.
+func ReadProperties(appDir string) (map[string]string, error) {
+	lines, err := readPropertiesFile(filepath.Join(appDir, "server.properties"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading properties file: %v", err)
+	}
+
+	return parseLines(lines), nil
+}
+
+// ParseProperties returns the properties set in the contents of a
+// server.properties file.
+func ParseProperties(data []byte) map[string]string {
+	return parseLines(splitLines(data))
+}
+
+func parseLines(lines []string) map[string]string {
+	props := make(map[string]string)
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		props[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return props
+}
+
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(text, "\n")
 }
 
 func readPropertiesFile(filePath string) ([]string, error) {
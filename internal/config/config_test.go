@@ -128,3 +128,134 @@ gamemode=survival
 func contains(content, substr string) bool {
 	return strings.Contains(content, substr)
 }
+
+func TestEnsureProperties(t *testing.T) {
+	tempDir := t.TempDir()
+
+	propsContent := `# Minecraft server properties
+server-name=Dedicated Server
+content-log-file-enabled=false
+`
+
+	propsFile := filepath.Join(tempDir, "server.properties")
+
+	err := os.WriteFile(propsFile, []byte(propsContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test properties file: %v", err)
+	}
+
+	err = EnsureProperties(tempDir, map[string]string{
+		"content-log-file-enabled":           "true",
+		"content-log-console-output-enabled": "true",
+	})
+	if err != nil {
+		t.Fatalf("EnsureProperties failed: %v", err)
+	}
+
+	content, err := os.ReadFile(propsFile)
+	if err != nil {
+		t.Fatalf("Failed to read updated properties file: %v", err)
+	}
+
+	for _, expected := range []string{
+		"server-name=Dedicated Server",
+		"content-log-file-enabled=true",
+		"content-log-console-output-enabled=true",
+	} {
+		if !contains(string(content), expected) {
+			t.Errorf("Expected to find '%s' in properties file", expected)
+		}
+	}
+
+	if contains(string(content), "content-log-file-enabled=false") {
+		t.Error("Expected existing property to be updated in place")
+	}
+}
+
+func TestReadProperties(t *testing.T) {
+	tempDir := t.TempDir()
+
+	propsContent := `# Minecraft server properties
+server-name=Dedicated Server
+level-name = My World
+# comment=ignored
+invalid line
+`
+
+	err := os.WriteFile(filepath.Join(tempDir, "server.properties"), []byte(propsContent), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create test properties file: %v", err)
+	}
+
+	props, err := ReadProperties(tempDir)
+	if err != nil {
+		t.Fatalf("ReadProperties failed: %v", err)
+	}
+
+	if len(props) != 2 {
+		t.Errorf("Expected 2 properties, got %v", props)
+	}
+
+	if props["level-name"] != "My World" {
+		t.Errorf("Expected level-name 'My World', got %q", props["level-name"])
+	}
+}
+
+func TestUpdateProperties(t *testing.T) {
+	data := []byte("# comment\r\nserver-name=Staging\ndifficulty=easy\n")
+
+	updated := UpdateProperties(data, map[string]string{"difficulty": "hard", "view-distance": "32"})
+
+	want := "# comment\nserver-name=Staging\ndifficulty=hard\nview-distance=32\n"
+	if string(updated) != want {
+		t.Errorf("UpdateProperties() = %q, want %q", updated, want)
+	}
+
+	props := ParseProperties(updated)
+	if len(props) != 3 || props["difficulty"] != "hard" {
+		t.Errorf("Unexpected properties %v", props)
+	}
+}
+
+func TestCheckProperties(t *testing.T) {
+	valid := map[string]string{
+		"server-name":  "Dedicated Server",
+		"server-port":  "19132",
+		"gamemode":     "survival",
+		"difficulty":   "2",
+		"allow-cheats": "false",
+		"custom-key":   "anything",
+	}
+
+	err := CheckProperties(valid)
+	if err != nil {
+		t.Errorf("Expected valid properties, got %v", err)
+	}
+
+	invalid := map[string]string{
+		"server-port":   "70000",
+		"gamemode":      "hardcore",
+		"online-mode":   "yes",
+		"level-name":    " ",
+		"max-players":   "ten",
+		"custom-key":    "",
+		"tick-distance": "4",
+	}
+
+	err = CheckProperties(invalid)
+	if err == nil {
+		t.Fatal("Expected invalid properties to fail")
+	}
+
+	want := []string{
+		`gamemode must be one of survival, creative, adventure, 0, 1, 2, got "hardcore"`,
+		"level-name must not be empty",
+		`max-players must be a number from 1 to 1000, got "ten"`,
+		`online-mode must be true or false, got "yes"`,
+		`server-port must be a number from 1 to 65535, got "70000"`,
+	}
+
+	if got := strings.Split(err.Error(), "\n"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Unexpected problems:\n%s", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Package consolelog keeps bedrock_server's console output usable when a
+// pack spams the same error every tick: repeated lines are collapsed for
+// the console buffer and clients, while a persistent log keeps every line.
+package consolelog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/logtime"
+)
+
+// Log is a persistent log of console lines, one per line prefixed with
+// when it was read.
+type Log struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+}
+
+// Open opens the log at path for appending, creating it if needed.
+func Open(path string) (*Log, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return nil, fmt.Errorf("error creating console log directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("error opening console log: %w", err)
+	}
+
+	return &Log{path: path, f: f}, nil
+}
+
+// Path returns the location of the log.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Write appends a line read at t.
+func (l *Log) Write(t time.Time, text string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := fmt.Fprintf(l.f, "%s %s\n", t.UTC().Format("2006-01-02T15:04:05.000Z"), text)
+	if err != nil {
+		return fmt.Errorf("error writing console log: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.f.Close()
+}
+
+// Collapser holds back lines repeating the previous one, which only differ
+// in their Bedrock timestamp, and summarizes them as "Last message repeated
+// N times" once a different line arrives or the repeats have gone on for a
+// while. It is safe for concurrent use.
+type Collapser struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	last  string    // Previous line without its timestamp
+	count int       // Repeats held back
+	since time.Time // When the repeats held back started
+}
+
+// NewCollapser returns a collapser that summarizes repeats at least every
+// window.
+func NewCollapser(window time.Duration) *Collapser {
+	return &Collapser{window: window}
+}
+
+// Add returns the summary of the repeats held back to show before a line
+// read at t, if any, and whether the line is itself a repeat to hold back.
+func (c *Collapser) Add(text string, t time.Time) (string, bool) {
+	key := logtime.Strip(text)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key != c.last {
+		summary := c.summary()
+		c.last, c.count = key, 0
+
+		return summary, false
+	}
+
+	if c.count == 0 {
+		c.since = t
+	}
+
+	c.count++
+
+	return "", true
+}
+
+// Due returns the summary of the repeats held back for a window by now, if
+// any, for lines repeating without end or that stopped repeating with no
+// line after them.
+func (c *Collapser) Due(now time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.count == 0 || now.Sub(c.since) < c.window {
+		return ""
+	}
+
+	return c.summary()
+}
+
+// summary returns the summary of the repeats held back, if any, and starts
+// counting again.
+func (c *Collapser) summary() string {
+	if c.count == 0 {
+		return ""
+	}
+
+	summary := fmt.Sprintf("Last message repeated %d times", c.count)
+	if c.count == 1 {
+		summary = "Last message repeated once"
+	}
+
+	c.count = 0
+
+	return summary
+}
@@ -0,0 +1,81 @@
+package consolelog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog_Write(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "console.log")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	read := time.Date(2024, 6, 14, 9, 2, 1, 123000000, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		err := l.Write(read, "[ERROR] [Scripting] boom")
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	err = l.Close()
+	if err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Repeat("2024-06-14T09:02:01.123Z [ERROR] [Scripting] boom\n", 2)
+	if string(data) != want {
+		t.Errorf("Expected every line to be logged, got %q", data)
+	}
+}
+
+func TestCollapser(t *testing.T) {
+	c := NewCollapser(time.Minute)
+	start := time.Date(2024, 6, 14, 9, 0, 0, 0, time.UTC)
+
+	line := func(i int) string {
+		return fmt.Sprintf("[2024-06-14 09:00:%02d:000 ERROR] [Scripting] boom", i)
+	}
+
+	if summary, repeated := c.Add(line(0), start); summary != "" || repeated {
+		t.Errorf("Expected the first line to be shown, got %q, %v", summary, repeated)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, repeated := c.Add(line(i), start.Add(time.Duration(i)*time.Second)); !repeated {
+			t.Errorf("Expected repeat %d to be held back", i)
+		}
+	}
+
+	if summary := c.Due(start.Add(30 * time.Second)); summary != "" {
+		t.Errorf("Expected no summary within the window, got %q", summary)
+	}
+
+	summary, repeated := c.Add("Player connected: Steve", start.Add(40*time.Second))
+	if summary != "Last message repeated 3 times" || repeated {
+		t.Errorf("Expected the repeats to be summarized before a different line, got %q, %v", summary, repeated)
+	}
+
+	c.Add("Player connected: Steve", start.Add(41*time.Second))
+
+	if summary := c.Due(start.Add(2 * time.Minute)); summary != "Last message repeated once" {
+		t.Errorf("Expected the repeats to be summarized after the window, got %q", summary)
+	}
+
+	if summary := c.Due(start.Add(3 * time.Minute)); summary != "" {
+		t.Errorf("Expected nothing left to summarize, got %q", summary)
+	}
+}
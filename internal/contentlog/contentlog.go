@@ -0,0 +1,202 @@
+// Package contentlog parses Bedrock content log entries (behavior and resource
+// pack errors) from the server console and keeps a deduplicated list of them.
+package contentlog
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/logtime"
+)
+
+const (
+	LevelWarning = "WARN"
+	LevelError   = "ERROR"
+
+	// maxIssues caps how many distinct issues are kept.
+	maxIssues = 500
+)
+
+// Properties are the server.properties settings that make Bedrock write its
+// content log to the console, where the wrapper can pick it up.
+var Properties = map[string]string{
+	"content-log-file-enabled":           "true",
+	"content-log-console-output-enabled": "true",
+}
+
+// entryPattern matches content log lines such as
+// "[2024-06-14 09:02:01:123 ERROR] [Json] | pack_manifest | missing field".
+var entryPattern = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?::\d{3})?) (WARN|ERROR)\] ` +
+	`\[([^\]]+)\] ?(.*)$`)
+
+// Entry is a single parsed content log line.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Area    string    `json:"area"` // Content area such as Json, Scripting or Molang
+	Message string    `json:"message"`
+}
+
+// Parse parses a console line as a content log entry.
+func Parse(line string) (Entry, bool) {
+	m := entryPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return Entry{}, false
+	}
+
+	return Entry{
+		Time:    ParseTimestamp(m[1]),
+		Level:   m[2],
+		Area:    m[3],
+		Message: strings.TrimSpace(strings.TrimPrefix(m[4], "|")),
+	}, true
+}
+
+// ParseTimestamp parses Bedrock's "2006-01-02 15:04:05:000" timestamps in
+// the local timezone. It returns the zero time if s is not a timestamp.
+func ParseTimestamp(s string) time.Time {
+	return logtime.ParseTimestamp(s, time.Local)
+}
+
+// Issue is a distinct content log message with the number of times it occurred.
+type Issue struct {
+	Level     string    `json:"level"`
+	Area      string    `json:"area"`
+	Message   string    `json:"message"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+type issueKey struct {
+	level, area, message string
+}
+
+// Log collects content log issues. The zero value is ready to use.
+type Log struct {
+	mu     sync.RWMutex
+	issues map[issueKey]*Issue
+}
+
+// Add records a content log entry.
+func (l *Log) Add(e Entry) {
+	now := e.Time.UTC()
+	if e.Time.IsZero() {
+		now = time.Now().UTC()
+	}
+
+	key := issueKey{e.Level, e.Area, e.Message}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.issues == nil {
+		l.issues = make(map[issueKey]*Issue)
+	}
+
+	if issue, ok := l.issues[key]; ok {
+		issue.Count++
+		issue.LastSeen = now
+
+		return
+	}
+
+	if len(l.issues) >= maxIssues {
+		l.evictOldest()
+	}
+
+	l.issues[key] = &Issue{
+		Level:     e.Level,
+		Area:      e.Area,
+		Message:   e.Message,
+		Count:     1,
+		FirstSeen: now,
+		LastSeen:  now,
+	}
+}
+
+// AddLine parses a console line and records it if it is a content log entry.
+func (l *Log) AddLine(line string) bool {
+	entry, ok := Parse(line)
+	if ok {
+		l.Add(entry)
+	}
+
+	return ok
+}
+
+// evictOldest removes the issue that was seen least recently. Must be called
+// with the lock held.
+func (l *Log) evictOldest() {
+	var (
+		oldestKey issueKey
+		oldest    *Issue
+	)
+
+	for key, issue := range l.issues {
+		if oldest == nil || issue.LastSeen.Before(oldest.LastSeen) {
+			oldestKey, oldest = key, issue
+		}
+	}
+
+	delete(l.issues, oldestKey)
+}
+
+// Issues returns the recorded issues, errors first and then by most recent.
+func (l *Log) Issues() []Issue {
+	l.mu.RLock()
+
+	issues := make([]Issue, 0, len(l.issues))
+	for _, issue := range l.issues {
+		issues = append(issues, *issue)
+	}
+
+	l.mu.RUnlock()
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Level != issues[j].Level {
+			return issues[i].Level == LevelError
+		}
+
+		return issues[i].LastSeen.After(issues[j].LastSeen)
+	})
+
+	return issues
+}
+
+// Counts returns the total number of occurrences per level.
+func (l *Log) Counts() map[string]int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	counts := map[string]int{
+		LevelError:   0,
+		LevelWarning: 0,
+	}
+
+	for _, issue := range l.issues {
+		counts[issue.Level] += issue.Count
+	}
+
+	return counts
+}
+
+// Clear removes all recorded issues.
+func (l *Log) Clear() {
+	l.mu.Lock()
+	l.issues = nil
+	l.mu.Unlock()
+}
+
+// scriptPattern matches console lines written by the script engine, such as
+// "[2024-06-14 09:02:01:123 INFO] [Scripting] hello from main.js".
+var scriptPattern = regexp.MustCompile(`^\[[^\]]* (?:INFO|WARN|ERROR)\] \[(?:Scripting|GameTest)\]`)
+
+// IsScriptLine reports whether a console line was written by the script
+// engine (console.log output, script errors or GameTest results).
+func IsScriptLine(line string) bool {
+	return scriptPattern.MatchString(strings.TrimSpace(line))
+}
@@ -0,0 +1,113 @@
+package contentlog
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line    string
+		ok      bool
+		level   string
+		area    string
+		message string
+	}{
+		{
+			line:    "[2024-06-14 09:02:01:123 ERROR] [Json] | pack_manifest | missing field",
+			ok:      true,
+			level:   LevelError,
+			area:    "Json",
+			message: "pack_manifest | missing field",
+		},
+		{
+			line:    "[2024-06-14 09:02:01:123 WARN] [Scripting] Plugin [My Pack] - module not found",
+			ok:      true,
+			level:   LevelWarning,
+			area:    "Scripting",
+			message: "Plugin [My Pack] - module not found",
+		},
+		{
+			line: "[2024-06-14 09:02:01:123 INFO] Server started.",
+			ok:   false,
+		},
+		{
+			line: "[2024-06-14 09:02:01:123 ERROR] Unscoped error",
+			ok:   false,
+		},
+		{
+			line: "NO LOG FILE! - setting up server logging...",
+			ok:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		entry, ok := Parse(tt.line)
+		if ok != tt.ok {
+			t.Errorf("Parse(%q): expected ok=%v, got %v", tt.line, tt.ok, ok)
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		if entry.Level != tt.level || entry.Area != tt.area || entry.Message != tt.message {
+			t.Errorf("Parse(%q): got %+v", tt.line, entry)
+		}
+
+		if entry.Time.IsZero() {
+			t.Errorf("Parse(%q): expected timestamp to be parsed", tt.line)
+		}
+	}
+}
+
+func TestLog_DeduplicatesAndCounts(t *testing.T) {
+	var l Log
+
+	lines := []string{
+		"[2024-06-14 09:02:01:123 ERROR] [Json] bad manifest",
+		"[2024-06-14 09:02:02:123 ERROR] [Json] bad manifest",
+		"[2024-06-14 09:02:03:123 WARN] [Molang] unknown query",
+		"[2024-06-14 09:02:04:123 INFO] Server started.",
+	}
+
+	for _, line := range lines {
+		l.AddLine(line)
+	}
+
+	issues := l.Issues()
+	if len(issues) != 2 {
+		t.Fatalf("Expected 2 issues, got %d", len(issues))
+	}
+
+	if issues[0].Level != LevelError || issues[0].Count != 2 {
+		t.Errorf("Expected first issue to be the repeated error, got %+v", issues[0])
+	}
+
+	counts := l.Counts()
+	if counts[LevelError] != 2 || counts[LevelWarning] != 1 {
+		t.Errorf("Unexpected counts: %v", counts)
+	}
+
+	l.Clear()
+
+	if len(l.Issues()) != 0 {
+		t.Error("Expected no issues after Clear")
+	}
+}
+
+func TestIsScriptLine(t *testing.T) {
+	tests := map[string]bool{
+		"[2024-06-14 09:02:01:123 INFO] [Scripting] hello from main.js":         true,
+		"[2024-06-14 09:02:01:123 ERROR] [Scripting] TypeError: not a function": true,
+		"[2024-06-14 09:02:01:123 WARN] [GameTest] test failed: my:test":        true,
+		"[2024-06-14 09:02:01:123 ERROR] [Json] bad manifest":                   false,
+		"[2024-06-14 09:02:01:123 INFO] Server started.":                        false,
+	}
+
+	for line, expected := range tests {
+		if got := IsScriptLine(line); got != expected {
+			t.Errorf("IsScriptLine(%q): expected %v, got %v", line, expected, got)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // DownloadMinecraftServer downloads and extracts the Minecraft Bedrock server
@@ -23,14 +24,41 @@ func DownloadMinecraftServer(minecraftVer string, appDir string, baseURL string)
 	defer os.Remove(tmpFile.Name()) // Clean up temp file
 
 	// Download the server
-	defaultBaseURL := "https://www.minecraft.net/bedrockdedicatedserver/bin-linux"
+	err = fetch(context.Background(), serverURL(minecraftVer, baseURL), tmpFile)
+	if err != nil {
+		return fmt.Errorf("failed to download server: %w", err)
+	}
+
+	// Ensure the temp file is closed before unzipping
+	err = tmpFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	return Extract(tmpFile.Name(), appDir)
+}
+
+// DefaultBaseURL is where the Linux server builds are downloaded from.
+const DefaultBaseURL = "https://www.minecraft.net/bedrockdedicatedserver/bin-linux"
+
+// serverURL returns the download URL of a server version, from baseURL or
+// DefaultBaseURL if empty.
+func serverURL(minecraftVer string, baseURL string) string {
 	if baseURL == "" {
-		baseURL = defaultBaseURL
+		baseURL = DefaultBaseURL
 	}
 
-	url := fmt.Sprintf("%s/bedrock-server-%s.zip", baseURL, minecraftVer)
+	return fmt.Sprintf("%s/bedrock-server-%s.zip", baseURL, minecraftVer)
+}
+
+// VersionAvailable checks that a server version can be downloaded, without
+// downloading it. baseURL is an optional URL to check instead (used for
+// testing).
+func VersionAvailable(ctx context.Context, minecraftVer string, baseURL string) error {
+	url := serverURL(minecraftVer, baseURL)
 
-	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+	// A GET whose body isn't read, as the download site may not answer HEAD
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -39,41 +67,85 @@ func DownloadMinecraftServer(minecraftVer string, appDir string, baseURL string)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to download server: %w", err)
+		return fmt.Errorf("failed to reach %s: %w", url, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download server, status code: %d", resp.StatusCode)
+		return fmt.Errorf("version %s not available at %s, status code: %d", minecraftVer, url, resp.StatusCode)
 	}
 
-	// Copy the response body to the temp file
-	_, err = io.Copy(tmpFile, resp.Body)
+	return nil
+}
+
+// DownloadFile downloads url to the file at dest, replacing it only once the
+// download has completed.
+func DownloadFile(ctx context.Context, url string, dest string) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(dest), ".download-*")
 	if err != nil {
-		return fmt.Errorf("failed to save download: %w", err)
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name()) // Clean up temp file if the rename didn't happen
+
+	err = fetch(ctx, url, tmpFile)
+	if err != nil {
+		_ = tmpFile.Close()
+		return err
 	}
 
-	// Ensure the temp file is closed before unzipping
 	err = tmpFile.Close()
 	if err != nil {
 		return fmt.Errorf("failed to close temp file: %w", err)
 	}
 
+	return os.Rename(tmpFile.Name(), dest)
+}
+
+// fetch downloads url and writes the response body to w.
+func fetch(ctx context.Context, url string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s, status code: %d", url, resp.StatusCode)
+	}
+
+	// Copy the response body to the destination
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to save download: %w", err)
+	}
+
+	return nil
+}
+
+// Extract extracts the zip file at zipPath into destDir, creating it if needed.
+func Extract(zipPath string, destDir string) error {
 	// Create the app directory if it doesn't exist
-	err = os.MkdirAll(appDir, 0750)
+	err := os.MkdirAll(destDir, 0750)
 	if err != nil {
 		return fmt.Errorf("failed to create app directory: %w", err)
 	}
 
 	// Extract the zip file
-	zipReader, err := zip.OpenReader(tmpFile.Name())
+	zipReader, err := zip.OpenReader(zipPath)
 	if err != nil {
 		return fmt.Errorf("failed to open zip file: %w", err)
 	}
 	defer zipReader.Close()
 
 	for _, file := range zipReader.File {
-		err := extractFile(file, appDir)
+		err := extractFile(file, destDir)
 		if err != nil {
 			return fmt.Errorf("failed to extract file %s: %w", file.Name, err)
 		}
@@ -83,16 +155,21 @@ func DownloadMinecraftServer(minecraftVer string, appDir string, baseURL string)
 }
 
 func extractFile(file *zip.File, destDir string) error {
-	// Create the destination path
+	// Create the destination path, refusing entries that escape destDir
 	destPath := filepath.Join(destDir, file.Name) // #nosec G305
 
+	rel, err := filepath.Rel(destDir, destPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return fmt.Errorf("illegal file path %s", file.Name)
+	}
+
 	// Handle directories
 	if file.FileInfo().IsDir() {
 		return os.MkdirAll(destPath, file.Mode())
 	}
 
 	// Create parent directories if they don't exist
-	err := os.MkdirAll(filepath.Dir(destPath), 0750)
+	err = os.MkdirAll(filepath.Dir(destPath), 0750)
 	if err != nil {
 		return err
 	}
@@ -3,10 +3,12 @@ package downloader
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -129,3 +131,25 @@ func TestExtractFile(t *testing.T) {
 	// Would need to create a zip.File mock and verify extraction
 	t.Skip("Implementation needed")
 }
+
+func TestVersionAvailable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bedrock-server-1.21.0.03.zip" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte("zip"))
+	}))
+	defer ts.Close()
+
+	err := VersionAvailable(context.Background(), "1.21.0.03", ts.URL)
+	if err != nil {
+		t.Errorf("Expected version to be available, got %v", err)
+	}
+
+	err = VersionAvailable(context.Background(), "9.9.9", ts.URL)
+	if err == nil || !strings.Contains(err.Error(), "status code: 404") {
+		t.Errorf("Expected missing version to fail with 404, got %v", err)
+	}
+}
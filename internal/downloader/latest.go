@@ -0,0 +1,63 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// LinksURL lists the current download links of Minecraft, including the
+// Bedrock dedicated server.
+const LinksURL = "https://net-secondary.web.minecraft-services.net/api/v1.0/download/links"
+
+// linuxServer is the download type of the Linux Bedrock server.
+const linuxServer = "serverBedrockLinux"
+
+var versionRe = regexp.MustCompile(`bedrock-server-([0-9.]+)\.zip`)
+
+// LatestVersion returns the newest Bedrock server version available for
+// download. linksURL is an optional URL to query instead of LinksURL (used
+// for testing).
+func LatestVersion(ctx context.Context, linksURL string) (string, error) {
+	if linksURL == "" {
+		linksURL = LinksURL
+	}
+
+	var buf bytes.Buffer
+
+	err := fetch(ctx, linksURL, &buf)
+	if err != nil {
+		return "", err
+	}
+
+	var links struct {
+		Result struct {
+			Links []struct {
+				DownloadType string `json:"downloadType"`
+				DownloadURL  string `json:"downloadUrl"`
+			} `json:"links"`
+		} `json:"result"`
+	}
+
+	err = json.Unmarshal(buf.Bytes(), &links)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse download links: %w", err)
+	}
+
+	for _, link := range links.Result.Links {
+		if link.DownloadType != linuxServer {
+			continue
+		}
+
+		m := versionRe.FindStringSubmatch(link.DownloadURL)
+		if m == nil {
+			return "", fmt.Errorf("no version in download link %s", link.DownloadURL)
+		}
+
+		return m[1], nil
+	}
+
+	return "", fmt.Errorf("no %s download link", linuxServer)
+}
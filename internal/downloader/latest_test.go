@@ -0,0 +1,41 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLatestVersion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result":{"links":[
+			{"downloadType":"serverBedrockWindows",
+				"downloadUrl":"https://www.minecraft.net/bedrockdedicatedserver/bin-win/bedrock-server-1.21.50.07.zip"},
+			{"downloadType":"serverBedrockLinux",
+				"downloadUrl":"https://www.minecraft.net/bedrockdedicatedserver/bin-linux/bedrock-server-1.21.50.07.zip"}
+		]}}`))
+	}))
+	defer ts.Close()
+
+	version, err := LatestVersion(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("LatestVersion failed: %v", err)
+	}
+
+	if version != "1.21.50.07" {
+		t.Errorf("Expected version 1.21.50.07, got %s", version)
+	}
+}
+
+func TestLatestVersionMissing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result":{"links":[]}}`))
+	}))
+	defer ts.Close()
+
+	_, err := LatestVersion(context.Background(), ts.URL)
+	if err == nil {
+		t.Error("Expected an error without a Linux server link")
+	}
+}
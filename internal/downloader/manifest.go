@@ -0,0 +1,50 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// ManifestFile records which server version is installed in an app
+// directory.
+const ManifestFile = "installed.json"
+
+// Manifest is the installed server version.
+type Manifest struct {
+	Version     string    `json:"version"`
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// WriteManifest records that version was installed in appDir.
+func WriteManifest(appDir, version string) error {
+	err := jsonfile.Save(filepath.Join(appDir, ManifestFile), Manifest{Version: version, InstalledAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// ReadManifest returns the server version installed in appDir. The error
+// wraps os.ErrNotExist if none was recorded, as for servers installed by
+// older wrappers.
+func ReadManifest(appDir string) (Manifest, error) {
+	var m Manifest
+
+	data, err := os.ReadFile(filepath.Join(appDir, ManifestFile)) // #nosec G304
+	if err != nil {
+		return m, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return m, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	return m, nil
+}
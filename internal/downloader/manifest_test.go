@@ -0,0 +1,34 @@
+package downloader
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := ReadManifest(dir)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected os.ErrNotExist without a manifest, got %v", err)
+	}
+
+	err = WriteManifest(dir, "1.21.50.07")
+	if err != nil {
+		t.Fatalf("WriteManifest failed: %v", err)
+	}
+
+	m, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("ReadManifest failed: %v", err)
+	}
+
+	if m.Version != "1.21.50.07" {
+		t.Errorf("Expected version 1.21.50.07, got %s", m.Version)
+	}
+
+	if m.InstalledAt.IsZero() {
+		t.Error("Expected the install time to be recorded")
+	}
+}
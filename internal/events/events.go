@@ -0,0 +1,95 @@
+// Package events parses player events from the Bedrock server console.
+package events
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/contentlog"
+)
+
+const (
+	TypeJoin  = "join"
+	TypeLeave = "leave"
+)
+
+var (
+	// timestampPattern matches the "[2024-06-14 09:02:01:123 INFO] " prefix.
+	timestampPattern = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?::\d{3})?) [A-Z]+\]`)
+
+	// playerPattern matches "Player connected: Steve, xuid: 2535..." and the
+	// matching disconnect line.
+	playerPattern = regexp.MustCompile(`Player (connected|disconnected): (.+?), xuid: ?(\d*)`)
+
+	// addressPattern matches the client address some server versions and
+	// proxies append to connection lines, e.g. "ip: 203.0.113.7|19132".
+	addressPattern = regexp.MustCompile(`(?i)\b(?:ip|address): ?(\S+)`)
+)
+
+// Event is a player joining or leaving the server.
+type Event struct {
+	Time   time.Time `json:"time"` // Zero if the line had no timestamp
+	Type   string    `json:"type"`
+	Player string    `json:"player"`
+	XUID   string    `json:"xuid,omitempty"`
+	IP     string    `json:"ip,omitempty"` // Client address, if the line included one
+}
+
+// Parse parses a console line as a player event.
+func Parse(line string) (Event, bool) {
+	line = strings.TrimSpace(line)
+
+	m := playerPattern.FindStringSubmatch(line)
+	if m == nil {
+		return Event{}, false
+	}
+
+	e := Event{
+		Type:   TypeJoin,
+		Player: m[2],
+		XUID:   m[3],
+	}
+
+	if m[1] == "disconnected" {
+		e.Type = TypeLeave
+	}
+
+	addr := addressPattern.FindStringSubmatch(line)
+	if addr != nil {
+		e.IP = parseAddress(addr[1])
+	}
+
+	ts := timestampPattern.FindStringSubmatch(line)
+	if ts != nil {
+		e.Time = contentlog.ParseTimestamp(ts[1])
+	}
+
+	return e, true
+}
+
+// parseAddress returns the IP of an address that may carry a port, as in
+// "203.0.113.7:19132", "203.0.113.7|19132" or "[2001:db8::1]:19132", or an
+// empty string if it isn't an IP address.
+func parseAddress(addr string) string {
+	addr = strings.TrimRight(addr, ",;")
+
+	host, _, ok := strings.Cut(addr, "|")
+	if ok {
+		addr = host
+	}
+
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String()
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			return ip.String()
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,72 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line   string
+		ok     bool
+		typ    string
+		player string
+		xuid   string
+		timed  bool
+	}{
+		{
+			"[2024-06-14 09:02:01:123 INFO] Player connected: Steve Jobs, xuid: 2535412345678901", true, TypeJoin, "Steve Jobs",
+			"2535412345678901", true,
+		},
+		{
+			"[2024-06-14 09:32:01:123 INFO] Player disconnected: Alex, xuid: 2535400000000001, pxuid: 12ab", true, TypeLeave,
+			"Alex", "2535400000000001", true,
+		},
+		{"[INFO] Player connected: Alex, xuid: ", true, TypeJoin, "Alex", "", false},
+		{"[2024-06-14 09:02:01:123 INFO] Server started.", false, "", "", "", false},
+	}
+
+	for _, tt := range tests {
+		e, ok := Parse(tt.line)
+		if ok != tt.ok {
+			t.Errorf("Parse(%q): expected ok=%v, got %v", tt.line, tt.ok, ok)
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		if e.Type != tt.typ || e.Player != tt.player || e.XUID != tt.xuid {
+			t.Errorf("Parse(%q): unexpected event %+v", tt.line, e)
+		}
+
+		if e.Time.IsZero() == tt.timed {
+			t.Errorf("Parse(%q): expected timestamp=%v, got %v", tt.line, tt.timed, e.Time)
+		}
+	}
+
+	e, _ := Parse("[2024-06-14 09:02:01:123 INFO] Player connected: Steve, xuid: 1")
+
+	want := time.Date(2024, 6, 14, 9, 2, 1, 123*int(time.Millisecond), time.Local)
+	if !e.Time.Equal(want) {
+		t.Errorf("Expected time %v, got %v", want, e.Time)
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := map[string]string{
+		"[2024-06-14 09:02:01:123 INFO] Player connected: Steve, xuid: 1, ip: 203.0.113.7|19132": "203.0.113.7",
+		"[INFO] Player connected: Steve, xuid: 1, address: [2001:db8::1]:19132":                  "2001:db8::1",
+		"[INFO] Player connected: Steve, xuid: 1, ip: 198.51.100.1:19132":                        "198.51.100.1",
+		"[INFO] Player connected: Steve, xuid: 1, ip: unknown":                                   "",
+		"[INFO] Player connected: Steve, xuid: 1":                                                "",
+	}
+
+	for line, want := range tests {
+		e, ok := Parse(line)
+		if !ok || e.IP != want {
+			t.Errorf("Parse(%q): expected IP %q, got %q", line, want, e.IP)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Package files gives restricted access to the files of a server directory.
+// Paths can't leave the directory, and files matching deny patterns, such
+// as the server binary, can't be read or written at all.
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxSize is the largest file that can be uploaded.
+const MaxSize = 32 << 20
+
+// DefaultDeny matches the server binary and libraries.
+var DefaultDeny = []string{"bedrock_server", "bedrock_server_symbols.debug", "*.so", "*.so.*", "*.exe", "*.dll"}
+
+var (
+	ErrInvalidPath = errors.New("invalid path")
+	ErrDenied      = errors.New("access to this file is denied")
+	ErrNotFound    = errors.New("file not found")
+	ErrIsDir       = errors.New("path is a directory")
+	ErrTooLarge    = errors.New("file too large")
+)
+
+// Entry is a file or directory in a listing.
+type Entry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"` // Relative to the root
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Root is a directory files are accessed in.
+type Root struct {
+	dir  string
+	deny []string
+}
+
+// New returns the root of dir with the given deny patterns, matched against
+// both file names and paths relative to dir.
+func New(dir string, deny []string) *Root {
+	return &Root{dir: dir, deny: deny}
+}
+
+// denied reports whether a relative path, or a directory it's in, matches a
+// deny pattern.
+func (r *Root) denied(rel string) bool {
+	for p := rel; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		for _, pattern := range r.deny {
+			if ok, _ := path.Match(pattern, path.Base(p)); ok {
+				return true
+			}
+
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// resolve returns the cleaned relative path and the absolute path of rel.
+// Symlinks are followed and must stay inside the root, and the path they
+// lead to is checked against the deny patterns as well.
+func (r *Root) resolve(rel string) (string, string, error) {
+	if strings.Contains(rel, "\\") || strings.ContainsRune(rel, 0) {
+		return "", "", ErrInvalidPath
+	}
+
+	rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+
+	if rel != "" && r.denied(rel) {
+		return "", "", ErrDenied
+	}
+
+	root, err := filepath.EvalSymlinks(r.dir)
+	if err != nil {
+		return "", "", fmt.Errorf("error resolving root: %w", err)
+	}
+
+	abs := filepath.Join(root, filepath.FromSlash(rel))
+
+	// Files that don't exist yet are checked through their directory
+	check := abs
+	for {
+		_, err := os.Lstat(check)
+		if err == nil || check == root {
+			break
+		}
+
+		check = filepath.Dir(check)
+	}
+
+	real, err := filepath.EvalSymlinks(check)
+	if err != nil {
+		return "", "", fmt.Errorf("error resolving path: %w", err)
+	}
+
+	if real != root && !strings.HasPrefix(real, root+string(filepath.Separator)) {
+		return "", "", ErrInvalidPath
+	}
+
+	// A symlink can lead to a denied file under another name
+	resolved, err := filepath.Rel(root, real)
+	if err != nil {
+		return "", "", fmt.Errorf("error resolving path: %w", err)
+	}
+
+	tail, err := filepath.Rel(check, abs)
+	if err != nil {
+		return "", "", fmt.Errorf("error resolving path: %w", err)
+	}
+
+	if r.denied(filepath.ToSlash(filepath.Join(resolved, tail))) {
+		return "", "", ErrDenied
+	}
+
+	return rel, abs, nil
+}
+
+// List returns the entries of a directory, directories first. Denied files
+// are left out.
+func (r *Root) List(rel string) ([]Entry, error) {
+	rel, abs, err := r.resolve(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	dirEntries, err := os.ReadDir(abs)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error listing directory: %w", err)
+	}
+
+	entries := []Entry{}
+
+	for _, d := range dirEntries {
+		p := path.Join(rel, d.Name())
+		if r.denied(p) {
+			continue
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, Entry{
+			Name:    d.Name(),
+			Path:    p,
+			Dir:     d.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime().UTC(),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Dir != entries[j].Dir {
+			return entries[i].Dir
+		}
+
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, nil
+}
+
+// IsDir reports whether rel is a directory.
+func (r *Root) IsDir(rel string) (bool, error) {
+	_, abs, err := r.resolve(rel)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(abs)
+	if os.IsNotExist(err) {
+		return false, ErrNotFound
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error reading file: %w", err)
+	}
+
+	return info.IsDir(), nil
+}
+
+// Open opens a file for reading.
+func (r *Root) Open(rel string) (*os.File, os.FileInfo, error) {
+	_, abs, err := r.resolve(rel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(abs) // #nosec G304 -- resolved inside the root
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("error opening file: %w", err)
+	}
+
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, ErrIsDir
+	}
+
+	return f, info, nil
+}
+
+// Write replaces or creates a file with the contents of src and returns the
+// previous contents, nil for a new file, so the change can be audited.
+// Parent directories are created as needed.
+func (r *Root) Write(rel string, src io.Reader) (old, new []byte, err error) {
+	rel, abs, err := r.resolve(rel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if rel == "" {
+		return nil, nil, ErrIsDir
+	}
+
+	new, err = io.ReadAll(io.LimitReader(src, MaxSize+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading upload: %w", err)
+	}
+
+	if len(new) > MaxSize {
+		return nil, nil, ErrTooLarge
+	}
+
+	info, err := os.Stat(abs)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, nil, ErrIsDir
+	case err == nil:
+		old, err = os.ReadFile(abs) // #nosec G304 -- resolved inside the root
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading file: %w", err)
+		}
+	case !os.IsNotExist(err):
+		return nil, nil, fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(abs), 0750)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating directory: %w", err)
+	}
+
+	mode := os.FileMode(0644)
+	if info != nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp := abs + ".tmp"
+
+	err = os.WriteFile(tmp, new, mode)
+	if err == nil {
+		err = os.Rename(tmp, abs)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp)
+		return nil, nil, fmt.Errorf("error writing file: %w", err)
+	}
+
+	if old == nil && info != nil {
+		old = []byte{}
+	}
+
+	return old, new, nil
+}
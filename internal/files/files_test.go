@@ -0,0 +1,115 @@
+package files
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRoot(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+
+	for name, content := range map[string]string{
+		"server.properties":      "level-name=world\n",
+		"bedrock_server":         "ELF",
+		"libfoo.so.1":            "ELF",
+		"worlds/world/level.dat": "data",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(path), 0750)
+
+		err := os.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	_ = os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600)
+	_ = os.Symlink(outside, filepath.Join(dir, "escape"))
+
+	root := New(dir, DefaultDeny)
+
+	entries, err := root.List("/")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+
+	if strings.Join(names, ",") != "worlds,escape,server.properties" {
+		t.Errorf("Unexpected listing: %v", names)
+	}
+
+	for _, path := range []string{"bedrock_server", "libfoo.so.1"} {
+		_, _, err := root.Open(path)
+		if !errors.Is(err, ErrDenied) {
+			t.Errorf("Expected %s to be denied, got %v", path, err)
+		}
+	}
+
+	// Denying a directory denies everything in it
+	_, _, err = New(dir, []string{"worlds"}).Open("worlds/world/level.dat")
+	if !errors.Is(err, ErrDenied) {
+		t.Errorf("Expected files in a denied directory to be denied, got %v", err)
+	}
+
+	// Symlinks are checked against the patterns where they lead
+	_ = os.Symlink(filepath.Join(dir, "bedrock_server"), filepath.Join(dir, "server-link"))
+	_ = os.Symlink("worlds", filepath.Join(dir, "maps"))
+
+	_, _, err = root.Open("server-link")
+	if !errors.Is(err, ErrDenied) {
+		t.Errorf("Expected a symlink to a denied file to be denied, got %v", err)
+	}
+
+	_, _, err = New(dir, []string{"worlds"}).Open("maps/world/level.dat")
+	if !errors.Is(err, ErrDenied) {
+		t.Errorf("Expected files through a symlink to a denied directory to be denied, got %v", err)
+	}
+
+	for _, path := range []string{"escape/secret", "../" + filepath.Base(outside) + "/secret"} {
+		_, _, err := root.Open(path)
+		if err == nil {
+			t.Errorf("Expected %s to be refused", path)
+		}
+	}
+
+	_, _, err = root.Write("escape/new.txt", strings.NewReader("x"))
+	if !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Expected writes through a symlink out of the root to be refused, got %v", err)
+	}
+
+	f, _, err := root.Open("worlds/world/level.dat")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	data, _ := io.ReadAll(f)
+	f.Close()
+
+	if string(data) != "data" {
+		t.Errorf("Unexpected contents: %q", data)
+	}
+
+	old, new, err := root.Write("server.properties", strings.NewReader("level-name=other\n"))
+	if err != nil || string(old) != "level-name=world\n" || string(new) != "level-name=other\n" {
+		t.Errorf("Unexpected write result: %q, %q, %v", old, new, err)
+	}
+
+	old, _, err = root.Write("config/new.json", strings.NewReader("{}"))
+	if err != nil || old != nil {
+		t.Errorf("Expected a new file without previous contents, got %q, %v", old, err)
+	}
+
+	_, _, err = root.Write("bedrock_server", strings.NewReader("x"))
+	if !errors.Is(err, ErrDenied) {
+		t.Errorf("Expected writing the binary to be denied, got %v", err)
+	}
+}
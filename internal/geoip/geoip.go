@@ -0,0 +1,407 @@
+// Package geoip resolves IP addresses to coarse locations using a local
+// MaxMind DB (.mmdb) file such as GeoLite2-Country or GeoLite2-City. Lookups
+// never leave the machine.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+var (
+	metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+	ErrInvalidDatabase = errors.New("invalid MaxMind database")
+)
+
+// maxMetadataSize bounds how far from the end of the file the metadata is searched.
+const maxMetadataSize = 128 * 1024
+
+// Location is the coarse location of an IP address.
+type Location struct {
+	Country     string `json:"country,omitempty"`      // ISO 3166-1 code, e.g. "DE"
+	CountryName string `json:"country_name,omitempty"` // English name
+	Continent   string `json:"continent,omitempty"`    // Continent code, e.g. "EU"
+	City        string `json:"city,omitempty"`         // Only with city databases
+}
+
+// Reader looks up addresses in a MaxMind database loaded into memory.
+type Reader struct {
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dataStart  uint
+	ipv4Start  uint
+}
+
+// Open loads the database at path.
+func Open(path string) (*Reader, error) {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("error reading GeoIP database: %w", err)
+	}
+
+	return New(data)
+}
+
+// New parses a database from memory.
+func New(data []byte) (*Reader, error) {
+	searchFrom := 0
+	if len(data) > maxMetadataSize {
+		searchFrom = len(data) - maxMetadataSize
+	}
+
+	idx := bytes.LastIndex(data[searchFrom:], metadataMarker)
+	if idx < 0 {
+		return nil, ErrInvalidDatabase
+	}
+
+	metaStart := uint(searchFrom + idx + len(metadataMarker))
+
+	meta, _, err := decoder{data: data, base: metaStart}.decode(metaStart, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding metadata: %w", err)
+	}
+
+	m, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+
+	r := &Reader{
+		data:       data,
+		nodeCount:  toUint(m["node_count"]),
+		recordSize: toUint(m["record_size"]),
+		ipVersion:  toUint(m["ip_version"]),
+	}
+
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, r.recordSize)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	r.dataStart = treeSize + 16
+
+	if r.dataStart > metaStart {
+		return nil, ErrInvalidDatabase
+	}
+
+	// IPv4 addresses live under ::/96 in IPv6 databases
+	if r.ipVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+
+	return r, nil
+}
+
+// toUint converts a decoded metadata number.
+func toUint(v interface{}) uint {
+	switch n := v.(type) {
+	case uint64:
+		return uint(n)
+	case int32:
+		return uint(n)
+	default:
+		return 0
+	}
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a search tree node.
+func (r *Reader) record(node uint, bit uint) uint {
+	size := r.recordSize / 4 // Node size in bytes
+	b := r.data[node*size : node*size+size]
+
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Lookup returns the location of ip, or false if the database has none.
+func (r *Reader) Lookup(ip net.IP) (Location, bool) {
+	node := uint(0)
+	addr := ip.To16()
+
+	if v4 := ip.To4(); v4 != nil {
+		addr = v4
+		node = r.ipv4Start
+	} else if r.ipVersion == 4 {
+		return Location{}, false
+	}
+
+	if addr == nil {
+		return Location{}, false
+	}
+
+	for i := 0; i < len(addr)*8 && node < r.nodeCount; i++ {
+		bit := uint(addr[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+
+	if node <= r.nodeCount {
+		return Location{}, false
+	}
+
+	offset := r.dataStart + node - r.nodeCount - 16
+
+	value, _, err := decoder{data: r.data, base: r.dataStart}.decode(offset, 0)
+	if err != nil {
+		return Location{}, false
+	}
+
+	record, ok := value.(map[string]interface{})
+	if !ok {
+		return Location{}, false
+	}
+
+	loc := Location{
+		Country:     lookupString(record, "country", "iso_code"),
+		CountryName: lookupString(record, "country", "names", "en"),
+		Continent:   lookupString(record, "continent", "code"),
+		City:        lookupString(record, "city", "names", "en"),
+	}
+
+	return loc, loc.Country != "" || loc.Continent != ""
+}
+
+// lookupString follows a path of map keys to a string value.
+func lookupString(v interface{}, path ...string) string {
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+
+		v = m[key]
+	}
+
+	s, _ := v.(string)
+
+	return s
+}
+
+// Data section types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEnd
+	typeBool
+	typeFloat
+)
+
+// maxDepth guards against pointer loops in corrupt databases.
+const maxDepth = 32
+
+// decoder decodes values from a MaxMind data section.
+type decoder struct {
+	data []byte
+	base uint // Start of the data section, pointers are relative to it
+}
+
+// bytes returns n bytes at offset.
+func (d decoder) bytes(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.data)) || offset+n < offset {
+		return nil, ErrInvalidDatabase
+	}
+
+	return d.data[offset : offset+n], nil
+}
+
+// decode decodes the value at offset and returns it with the offset after it.
+func (d decoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, ErrInvalidDatabase
+	}
+
+	ctrl, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset++
+	typ := uint(ctrl[0] >> 5)
+
+	if typ == typePointer {
+		return d.decodePointer(ctrl[0], offset, depth)
+	}
+
+	if typ == typeExtended {
+		ext, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		typ = 7 + uint(ext[0])
+		offset++
+	}
+
+	size := uint(ctrl[0] & 0x1f)
+
+	if size >= 29 {
+		n := size - 28
+
+		b, err := d.bytes(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		offset += n
+
+		switch n {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+
+	return d.decodeValue(typ, size, offset, depth)
+}
+
+// decodePointer follows a pointer and returns the value it points to with
+// the offset after the pointer itself.
+func (d decoder) decodePointer(ctrl byte, offset uint, depth int) (interface{}, uint, error) {
+	n := uint((ctrl>>3)&0x3) + 1
+
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	v := uint(ctrl & 0x7)
+
+	var target uint
+
+	switch n {
+	case 1:
+		target = v<<8 | uint(b[0])
+	case 2:
+		target = (v<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		target = (v<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		target = uint(binary.BigEndian.Uint32(b))
+	}
+
+	value, _, err := d.decode(d.base+target, depth+1)
+
+	return value, offset + n, err
+}
+
+// decodeValue decodes a value of the given type and size.
+func (d decoder) decodeValue(typ, size, offset uint, depth int) (interface{}, uint, error) {
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, ErrInvalidDatabase
+			}
+
+			m[k] = value
+			offset = next
+		}
+
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			a = append(a, value)
+			offset = next
+		}
+
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	b, err := d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset += size
+
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+
+		return n, offset, nil
+	case typeInt32:
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+
+		return int32(n), offset, nil // #nosec G115
+	case typeBytes, typeUint128:
+		return b, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unsupported data type %d", ErrInvalidDatabase, typ)
+	}
+}
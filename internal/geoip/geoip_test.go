@@ -0,0 +1,178 @@
+package geoip
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// encode encodes a value in the MaxMind data section format. Only the types
+// needed by the tests are supported.
+func encode(buf *bytes.Buffer, v interface{}) {
+	control := func(typ, size int) {
+		if typ > 7 {
+			buf.WriteByte(byte(size))
+			buf.WriteByte(byte(typ - 7))
+
+			return
+		}
+
+		buf.WriteByte(byte(typ<<5 | size))
+	}
+
+	switch v := v.(type) {
+	case string:
+		control(typeString, len(v))
+		buf.WriteString(v)
+	case uint16:
+		control(typeUint16, 2)
+		buf.Write([]byte{byte(v >> 8), byte(v)})
+	case uint32:
+		control(typeUint32, 4)
+		buf.Write([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+	case map[string]interface{}:
+		control(typeMap, len(v))
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			encode(buf, k)
+			encode(buf, v[k])
+		}
+	}
+}
+
+// buildDatabase builds an IPv4 database with 24 bit records mapping each
+// network to a record.
+func buildDatabase(t *testing.T, networks map[string]map[string]interface{}) []byte {
+	t.Helper()
+
+	type node [2]int
+
+	nodes := []node{{-1, -1}}
+	leaves := map[[2]int]int{} // node/bit -> data offset
+
+	var dataSection bytes.Buffer
+
+	for cidr, record := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("Failed to parse network: %v", err)
+		}
+
+		ones, _ := network.Mask.Size()
+		ip := network.IP.To4()
+		current := 0
+
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+
+			if i == ones-1 {
+				leaves[[2]int{current, bit}] = dataSection.Len()
+				break
+			}
+
+			if nodes[current][bit] < 0 {
+				nodes = append(nodes, node{-1, -1})
+				nodes[current][bit] = len(nodes) - 1
+			}
+
+			current = nodes[current][bit]
+		}
+
+		encode(&dataSection, record)
+	}
+
+	count := len(nodes)
+
+	var out bytes.Buffer
+
+	for i, n := range nodes {
+		for bit, child := range n {
+			value := count // Empty
+
+			if offset, ok := leaves[[2]int{i, bit}]; ok {
+				value = count + 16 + offset
+			} else if child >= 0 {
+				value = child
+			}
+
+			out.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+
+	out.Write(make([]byte, 16))
+	out.Write(dataSection.Bytes())
+	out.Write(metadataMarker)
+
+	encode(&out, map[string]interface{}{
+		"node_count":    uint32(count), // #nosec G115
+		"record_size":   uint16(24),
+		"ip_version":    uint16(4),
+		"database_type": "Test-Country",
+	})
+
+	return out.Bytes()
+}
+
+func TestLookup(t *testing.T) {
+	country := func(iso, name, continent string) map[string]interface{} {
+		return map[string]interface{}{
+			"country": map[string]interface{}{
+				"iso_code": iso,
+				"names":    map[string]interface{}{"en": name},
+			},
+			"continent": map[string]interface{}{"code": continent},
+		}
+	}
+
+	data := buildDatabase(t, map[string]map[string]interface{}{
+		"81.0.0.0/8":     country("DE", "Germany", "EU"),
+		"203.0.113.0/24": country("AU", "Australia", "OC"),
+	})
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+
+	err := os.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatalf("Failed to write database: %v", err)
+	}
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	loc, ok := reader.Lookup(net.ParseIP("81.2.3.4"))
+	if !ok || loc.Country != "DE" || loc.CountryName != "Germany" || loc.Continent != "EU" {
+		t.Errorf("Unexpected location for 81.2.3.4: %+v, %v", loc, ok)
+	}
+
+	loc, ok = reader.Lookup(net.ParseIP("203.0.113.7"))
+	if !ok || loc.Country != "AU" {
+		t.Errorf("Unexpected location for 203.0.113.7: %+v, %v", loc, ok)
+	}
+
+	_, ok = reader.Lookup(net.ParseIP("10.0.0.1"))
+	if ok {
+		t.Errorf("Expected no location for 10.0.0.1")
+	}
+
+	_, ok = reader.Lookup(net.ParseIP("2001:db8::1"))
+	if ok {
+		t.Errorf("Expected no location for an IPv6 address in an IPv4 database")
+	}
+
+	_, err = New([]byte("not a database"))
+	if err == nil {
+		t.Errorf("Expected an error for an invalid database")
+	}
+}
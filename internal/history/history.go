@@ -0,0 +1,252 @@
+// Package history keeps revisions of configuration files so changes can be
+// reviewed and rolled back.
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// keepRevisions is how many revisions are kept per file.
+const keepRevisions = 50
+
+// Patterns match the file names whose history is kept.
+var Patterns = []string{"*.properties", "*.json"}
+
+var ErrNotFound = errors.New("revision not found")
+
+// Revision is a version of a file.
+type Revision struct {
+	ID    int       `json:"id"`
+	Path  string    `json:"path"`
+	Actor string    `json:"actor"`
+	Time  time.Time `json:"time"`
+	Note  string    `json:"note,omitempty"`
+	Hash  string    `json:"hash"` // SHA-256 of the contents
+	Size  int       `json:"size"`
+	Diff  string    `json:"diff,omitempty"` // From the previous revision
+}
+
+// Store keeps revisions in a directory: an index and the contents by hash.
+type Store struct {
+	dir       string
+	mu        sync.Mutex
+	revisions []Revision
+	next      int
+}
+
+// Tracked reports whether the history of a file is kept.
+func Tracked(rel string) bool {
+	for _, pattern := range Patterns {
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Open loads the store in dir, starting empty if it doesn't exist.
+func Open(dir string) (*Store, error) {
+	s := &Store{dir: dir, next: 1}
+
+	err := jsonfile.Load(filepath.Join(dir, "index.json"), &s.revisions)
+	if err != nil {
+		return nil, fmt.Errorf("error loading history: %w", err)
+	}
+
+	for _, r := range s.revisions {
+		s.next = max(s.next, r.ID+1)
+	}
+
+	return s, nil
+}
+
+// latest returns the newest revision of a file. The caller must hold the
+// lock.
+func (s *Store) latest(rel string) (Revision, bool) {
+	for i := len(s.revisions) - 1; i >= 0; i-- {
+		if s.revisions[i].Path == rel {
+			return s.revisions[i], true
+		}
+	}
+
+	return Revision{}, false
+}
+
+// content reads the contents of a revision.
+func (s *Store) content(r Revision) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, "blobs", r.Hash)) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("error reading revision %d: %w", r.ID, err)
+	}
+
+	return data, nil
+}
+
+// Track records a change of a file from old to new contents. The first time
+// a file changes, its old contents are kept as a baseline revision so the
+// change can be rolled back. Nothing is recorded if new matches the newest
+// revision.
+func (s *Store) Track(rel, actor, note string, old, new []byte) (Revision, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.latest(rel); !ok && old != nil {
+		_, _, err := s.record(rel, "baseline", "", old)
+		if err != nil {
+			return Revision{}, false, err
+		}
+	}
+
+	return s.record(rel, actor, note, new)
+}
+
+// record adds a revision. The caller must hold the lock.
+func (s *Store) record(rel, actor, note string, data []byte) (Revision, bool, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	var previous []byte
+
+	latest, ok := s.latest(rel)
+	if ok {
+		if latest.Hash == hash {
+			return latest, false, nil
+		}
+
+		var err error
+
+		previous, err = s.content(latest)
+		if err != nil {
+			return Revision{}, false, err
+		}
+	}
+
+	err := os.MkdirAll(filepath.Join(s.dir, "blobs"), 0750)
+	if err != nil {
+		return Revision{}, false, fmt.Errorf("error saving revision: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(s.dir, "blobs", hash), data, 0600)
+	if err != nil {
+		return Revision{}, false, fmt.Errorf("error saving revision: %w", err)
+	}
+
+	r := Revision{
+		ID:    s.next,
+		Path:  rel,
+		Actor: actor,
+		Time:  time.Now().UTC(),
+		Note:  note,
+		Hash:  hash,
+		Size:  len(data),
+	}
+
+	if ok {
+		r.Diff = audit.Diff(rel, previous, data)
+	}
+
+	s.next++
+	s.revisions = append(s.revisions, r)
+	s.prune(rel)
+
+	return r, true, s.save()
+}
+
+// prune drops the oldest revisions of a file beyond the limit and contents
+// no revision refers to any more. The caller must hold the lock.
+func (s *Store) prune(rel string) {
+	count := 0
+	for _, r := range s.revisions {
+		if r.Path == rel {
+			count++
+		}
+	}
+
+	if count <= keepRevisions {
+		return
+	}
+
+	drop := count - keepRevisions
+	kept := s.revisions[:0]
+	dropped := map[string]bool{}
+
+	for _, r := range s.revisions {
+		if r.Path == rel && drop > 0 {
+			drop--
+			dropped[r.Hash] = true
+
+			continue
+		}
+
+		kept = append(kept, r)
+	}
+
+	s.revisions = kept
+
+	for _, r := range s.revisions {
+		delete(dropped, r.Hash)
+	}
+
+	for hash := range dropped {
+		_ = os.Remove(filepath.Join(s.dir, "blobs", hash))
+	}
+}
+
+// save writes the index. The caller must hold the lock.
+func (s *Store) save() error {
+	err := jsonfile.Save(filepath.Join(s.dir, "index.json"), s.revisions)
+	if err != nil {
+		return fmt.Errorf("error saving history: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the revisions of a file, or of all files if rel is empty,
+// newest first.
+func (s *Store) List(rel string) []Revision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []Revision{}
+
+	for _, r := range s.revisions {
+		if rel == "" || r.Path == rel {
+			list = append(list, r)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID > list[j].ID
+	})
+
+	return list
+}
+
+// Get returns a revision and its contents.
+func (s *Store) Get(id int) (Revision, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.revisions {
+		if r.ID == id {
+			data, err := s.content(r)
+			return r, data, err
+		}
+	}
+
+	return Revision{}, nil, ErrNotFound
+}
@@ -0,0 +1,70 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "config-history")
+
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	v1 := []byte("max-players=10\n")
+	v2 := []byte("max-players=20\n")
+
+	r, recorded, err := store.Track("server.properties", "alice", "", v1, v2)
+	if err != nil || !recorded || r.Actor != "alice" {
+		t.Fatalf("Unexpected revision: %+v, %v, %v", r, recorded, err)
+	}
+
+	if !strings.Contains(r.Diff, "-max-players=10\n+max-players=20\n") {
+		t.Errorf("Expected a diff from the baseline, got:\n%s", r.Diff)
+	}
+
+	// Unchanged contents aren't recorded again
+	if _, recorded, _ := store.Track("server.properties", "startup", "", nil, v2); recorded {
+		t.Errorf("Expected unchanged contents not to be recorded")
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	list := reopened.List("server.properties")
+	if len(list) != 2 || list[1].Actor != "baseline" {
+		t.Fatalf("Expected the change and its baseline, got %+v", list)
+	}
+
+	baseline, data, err := reopened.Get(list[1].ID)
+	if err != nil || string(data) != string(v1) || baseline.Path != "server.properties" {
+		t.Errorf("Unexpected baseline: %+v, %q, %v", baseline, data, err)
+	}
+
+	_, _, err = reopened.Get(99)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	for i := 0; i < keepRevisions+5; i++ {
+		_, _, err = reopened.Track("permissions.json", "bob", "", nil, []byte(fmt.Sprintf("[%d]", i)))
+		if err != nil {
+			t.Fatalf("Track failed: %v", err)
+		}
+	}
+
+	if n := len(reopened.List("permissions.json")); n != keepRevisions {
+		t.Errorf("Expected %d revisions to be kept, got %d", keepRevisions, n)
+	}
+
+	if !Tracked("worlds/world/world_behavior_packs.json") || Tracked("worlds/world/level.dat") {
+		t.Errorf("Unexpected tracked files")
+	}
+}
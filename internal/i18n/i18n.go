@@ -0,0 +1,135 @@
+// Package i18n translates the user-facing strings of the web consoles and
+// the API. Catalogs live in locales/<language>.json, keyed by message ID;
+// messages missing from a catalog fall back to English. Messages may hold
+// {name} placeholders, which the consoles fill in, or the wrapper for the
+// notices it says in-game.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the language used when the client accepts none of Languages.
+const Default = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// catalogs are the messages of each language by key.
+var catalogs = loadCatalogs()
+
+// Languages are the supported languages, as ISO 639-1 codes.
+var Languages = languages()
+
+func loadCatalogs() map[string]map[string]string {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("error reading locales: %v", err))
+	}
+
+	catalogs := make(map[string]map[string]string, len(entries))
+
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic(fmt.Sprintf("error reading locale %s: %v", entry.Name(), err))
+		}
+
+		var messages map[string]string
+
+		err = json.Unmarshal(data, &messages)
+		if err != nil {
+			panic(fmt.Sprintf("invalid locale %s: %v", entry.Name(), err))
+		}
+
+		catalogs[strings.TrimSuffix(entry.Name(), ".json")] = messages
+	}
+
+	return catalogs
+}
+
+func languages() []string {
+	list := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		list = append(list, lang)
+	}
+
+	sort.Strings(list)
+
+	return list
+}
+
+// Supported reports whether there is a catalog for lang.
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// T returns the message with key in lang, falling back to English and then
+// to the key itself.
+func T(lang, key string) string {
+	if msg, ok := catalogs[lang][key]; ok {
+		return msg
+	}
+
+	if msg, ok := catalogs[Default][key]; ok {
+		return msg
+	}
+
+	return key
+}
+
+// Messages returns every message in lang, with English for those it lacks.
+func Messages(lang string) map[string]string {
+	messages := make(map[string]string, len(catalogs[Default]))
+
+	for key, msg := range catalogs[Default] {
+		messages[key] = msg
+	}
+
+	for key, msg := range catalogs[lang] {
+		messages[key] = msg
+	}
+
+	return messages
+}
+
+// Negotiate picks the language for a client: preferred if supported, such
+// as one stored with its session, otherwise the best match of its
+// Accept-Language header. Regional variants match their base language, so
+// pt-BR gets pt.
+func Negotiate(preferred, acceptLanguage string) string {
+	if Supported(preferred) {
+		return preferred
+	}
+
+	best, bestQ := Default, 0.0
+
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		q := 1.0
+
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+
+			q = parsed
+		}
+
+		base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+
+		if q > bestQ && Supported(base) {
+			best, bestQ = base, q
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,81 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestCatalogs(t *testing.T) {
+	for _, lang := range []string{"en", "es", "de", "pt"} {
+		if !slices.Contains(Languages, lang) {
+			t.Errorf("Expected %s to be supported, got %v", lang, Languages)
+		}
+	}
+
+	placeholder := regexp.MustCompile(`\{[a-z_]+\}`)
+
+	for _, lang := range Languages {
+		for key, msg := range catalogs[lang] {
+			english, ok := catalogs[Default][key]
+			if !ok {
+				t.Errorf("%s: %s isn't an English message", lang, key)
+				continue
+			}
+
+			want := placeholder.FindAllString(english, -1)
+			got := placeholder.FindAllString(msg, -1)
+
+			slices.Sort(want)
+			slices.Sort(got)
+
+			if !slices.Equal(got, want) {
+				t.Errorf("%s: %s has placeholders %v, expected %v", lang, key, got, want)
+			}
+		}
+
+		for key := range catalogs[Default] {
+			if _, ok := catalogs[lang][key]; !ok {
+				t.Errorf("%s: missing %s", lang, key)
+			}
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("de", "console.connected"); got != "Verbunden" {
+		t.Errorf("Unexpected German message %q", got)
+	}
+
+	if got := T("fr", "console.connected"); got != "Connected" {
+		t.Errorf("Expected English for an unsupported language, got %q", got)
+	}
+
+	if got := T("es", "no.such.key"); got != "no.such.key" {
+		t.Errorf("Expected the key of an unknown message, got %q", got)
+	}
+
+	if messages := Messages("pt"); messages["common.send"] != "Enviar" || len(messages) != len(catalogs[Default]) {
+		t.Errorf("Unexpected Portuguese messages %v", messages)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		preferred, accept, want string
+	}{
+		{"", "", "en"},
+		{"", "es-MX,es;q=0.9,en;q=0.8", "es"},
+		{"", "fr-FR,fr;q=0.9,de;q=0.7,en;q=0.5", "de"},
+		{"", "pt-BR", "pt"},
+		{"", "en;q=0.2, DE;q=0.8", "de"},
+		{"", "fr, ja", "en"},
+		{"", "es;q=bad, pt;q=0.1", "pt"},
+		{"de", "es", "de"},
+		{"fr", "es", "es"},
+	} {
+		if got := Negotiate(tc.preferred, tc.accept); got != tc.want {
+			t.Errorf("Negotiate(%q, %q) = %q, expected %q", tc.preferred, tc.accept, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+// Package jobs tracks long-running operations such as downloads, backups
+// and migrations, with their progress and logs, and lets them be cancelled.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job states.
+const (
+	Running   = "running"
+	Done      = "done"
+	Failed    = "failed"
+	Cancelled = "cancelled"
+)
+
+const (
+	// maxLogs is how many log lines are kept per job.
+	maxLogs = 200
+
+	// maxFinished is how many finished jobs are kept to be queried.
+	maxFinished = 100
+
+	// progressInterval limits how often progress changes are published.
+	progressInterval = 500 * time.Millisecond
+)
+
+var (
+	// ErrNotFound is returned when cancelling a job that doesn't exist.
+	ErrNotFound = errors.New("job not found")
+
+	// ErrFinished is returned when cancelling a job that already finished.
+	ErrFinished = errors.New("job already finished")
+)
+
+// Progress counts the work done, bytes or items, out of a total. Total is
+// zero when unknown.
+type Progress struct {
+	Done  int64 `json:"done"`
+	Total int64 `json:"total"`
+}
+
+// Job is a snapshot of a long-running operation.
+type Job struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind"` // e.g. "backup", "migration"
+	Description string    `json:"description,omitempty"`
+	Actor       string    `json:"actor,omitempty"` // Who started it
+	State       string    `json:"state"`
+	Progress    Progress  `json:"progress"`
+	Logs        []string  `json:"logs"`
+	Error       string    `json:"error,omitempty"`
+	Detail      any       `json:"detail,omitempty"` // Kind specific state, replaced as a whole
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at,omitempty"`
+}
+
+// Func is the work of a job. It should return once ctx is cancelled.
+type Func func(ctx context.Context, h *Handle) error
+
+// entry is a job and how to cancel it.
+type entry struct {
+	job       Job
+	cancel    context.CancelFunc
+	cancelled bool
+	published time.Time // When progress was last published
+}
+
+// Manager runs jobs and keeps them to be queried.
+type Manager struct {
+	mu       sync.Mutex
+	items    map[string]*entry
+	onUpdate func(Job)
+}
+
+// NewManager returns a manager that calls onUpdate, if given, with a
+// snapshot of a job whenever it changes. It is called under the manager's
+// lock, so updates arrive in order, and must not call into the manager.
+func NewManager(onUpdate func(Job)) *Manager {
+	return &Manager{
+		items:    make(map[string]*entry),
+		onUpdate: onUpdate,
+	}
+}
+
+// Start runs fn in the background as a new job and returns its snapshot.
+func (m *Manager) Start(kind, description, actor string, fn Func) Job {
+	h, ctx := m.add(context.Background(), kind, description, actor)
+
+	job, _ := m.Get(h.id)
+
+	go func() {
+		h.finish(fn(ctx, h))
+	}()
+
+	return job
+}
+
+// Run runs fn as a new job until it returns, for operations tied to a
+// request. The job is cancelled along with ctx.
+func (m *Manager) Run(ctx context.Context, kind, description, actor string, fn Func) error {
+	h, ctx := m.add(ctx, kind, description, actor)
+
+	err := fn(ctx, h)
+	h.finish(err)
+
+	return err
+}
+
+// add registers a running job.
+func (m *Manager) add(parent context.Context, kind, description, actor string) (*Handle, context.Context) {
+	ctx, cancel := context.WithCancel(parent)
+
+	e := &entry{
+		job: Job{
+			ID:          newID(),
+			Kind:        kind,
+			Description: description,
+			Actor:       actor,
+			State:       Running,
+			Logs:        []string{},
+			StartedAt:   time.Now().UTC(),
+		},
+		cancel: cancel,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items[e.job.ID] = e
+	m.prune()
+	m.publish(e)
+
+	return &Handle{m: m, id: e.job.ID, ctx: ctx}, ctx
+}
+
+// List returns snapshots of the jobs an actor started, all of them if actor
+// is empty, newest first.
+func (m *Manager) List(actor string) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := []Job{}
+
+	for _, e := range m.items {
+		if actor == "" || e.job.Actor == actor {
+			list = append(list, snapshot(e))
+		}
+	}
+
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].StartedAt.After(list[b].StartedAt)
+	})
+
+	return list
+}
+
+// Get returns a snapshot of a job.
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.items[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return snapshot(e), true
+}
+
+// Cancel cancels a running job. The job is marked cancelled once its work
+// returns.
+func (m *Manager) Cancel(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.items[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if !e.job.FinishedAt.IsZero() {
+		return ErrFinished
+	}
+
+	e.cancelled = true
+	e.cancel()
+
+	e.job.Logs = appendLog(e.job.Logs, "cancel requested")
+	m.publish(e)
+
+	return nil
+}
+
+// update applies a change to a job and publishes it, unless the change
+// returns false.
+func (m *Manager) update(id string, change func(*entry) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.items[id]
+	if !ok || !change(e) {
+		return
+	}
+
+	m.publish(e)
+}
+
+// publish passes a snapshot of a job to onUpdate, under the lock.
+func (m *Manager) publish(e *entry) {
+	if m.onUpdate != nil {
+		m.onUpdate(snapshot(e))
+	}
+}
+
+// prune drops the oldest finished jobs beyond maxFinished, under the lock.
+func (m *Manager) prune() {
+	var finished []*entry
+
+	for _, e := range m.items {
+		if !e.job.FinishedAt.IsZero() {
+			finished = append(finished, e)
+		}
+	}
+
+	if len(finished) <= maxFinished {
+		return
+	}
+
+	sort.Slice(finished, func(a, b int) bool {
+		return finished[a].job.FinishedAt.Before(finished[b].job.FinishedAt)
+	})
+
+	for _, e := range finished[:len(finished)-maxFinished] {
+		delete(m.items, e.job.ID)
+	}
+}
+
+// snapshot copies a job so it can be used outside the lock.
+func snapshot(e *entry) Job {
+	job := e.job
+	job.Logs = append([]string{}, e.job.Logs...)
+
+	return job
+}
+
+// appendLog appends a line, dropping the oldest beyond maxLogs.
+func appendLog(logs []string, line string) []string {
+	logs = append(logs, line)
+	if len(logs) > maxLogs {
+		logs = append([]string{}, logs[len(logs)-maxLogs:]...)
+	}
+
+	return logs
+}
+
+// Handle lets the work of a job report on it.
+type Handle struct {
+	m   *Manager
+	id  string
+	ctx context.Context
+}
+
+// ID returns the ID of the job.
+func (h *Handle) ID() string {
+	return h.id
+}
+
+// Logf adds a line to the log of the job.
+func (h *Handle) Logf(format string, args ...any) {
+	line := fmt.Sprintf(format, args...)
+
+	h.m.update(h.id, func(e *entry) bool {
+		e.job.Logs = appendLog(e.job.Logs, line)
+		return true
+	})
+}
+
+// Progress sets the work done out of total, zero if unknown. Changes are
+// published at most every progressInterval, and once the work is complete.
+func (h *Handle) Progress(done, total int64) {
+	h.m.update(h.id, func(e *entry) bool {
+		e.job.Progress = Progress{Done: done, Total: total}
+
+		if time.Since(e.published) < progressInterval && (total == 0 || done < total) {
+			return false
+		}
+
+		e.published = time.Now()
+
+		return true
+	})
+}
+
+// SetDetail replaces the kind specific state of the job. The value must not
+// be changed afterwards.
+func (h *Handle) SetDetail(detail any) {
+	h.m.update(h.id, func(e *entry) bool {
+		e.job.Detail = detail
+		return true
+	})
+}
+
+// Reader returns a reader that counts the bytes read from r as progress out
+// of total, and fails once the job is cancelled.
+func (h *Handle) Reader(r io.Reader, total int64) io.Reader {
+	return &progressReader{r: r, h: h, total: total}
+}
+
+// Writer returns a writer that counts the bytes written to w as progress
+// out of total, and fails once the job is cancelled.
+func (h *Handle) Writer(w io.Writer, total int64) io.Writer {
+	return &progressWriter{w: w, h: h, total: total}
+}
+
+// finish records the outcome of the job and releases its context.
+func (h *Handle) finish(err error) {
+	h.m.update(h.id, func(e *entry) bool {
+		e.job.FinishedAt = time.Now().UTC()
+
+		switch {
+		case e.cancelled:
+			e.job.State = Cancelled
+		case err != nil:
+			e.job.State = Failed
+			e.job.Error = err.Error()
+		default:
+			e.job.State = Done
+		}
+
+		e.cancel()
+
+		return true
+	})
+}
+
+type progressReader struct {
+	r     io.Reader
+	h     *Handle
+	total int64
+	n     int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	err := p.h.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	p.h.Progress(p.n, p.total)
+
+	return n, err
+}
+
+type progressWriter struct {
+	w     io.Writer
+	h     *Handle
+	total int64
+	n     int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	err := p.h.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	p.h.Progress(p.n, p.total)
+
+	return n, err
+}
+
+// newID returns a random job identifier.
+func newID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,209 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFinished polls until a job finishes.
+func waitFinished(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		job, ok := m.Get(id)
+		if !ok {
+			t.Fatalf("Job %s not found", id)
+		}
+
+		if !job.FinishedAt.IsZero() {
+			return job
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Job %s didn't finish", id)
+
+	return Job{}
+}
+
+func TestManager_Start(t *testing.T) {
+	m := NewManager(nil)
+
+	job := m.Start("backup", "world", "alice", func(ctx context.Context, h *Handle) error {
+		h.Logf("copying %d files", 2)
+		h.Progress(2, 2)
+
+		return nil
+	})
+
+	if job.State != Running {
+		t.Errorf("Expected the job to start running, got %s", job.State)
+	}
+
+	job = waitFinished(t, m, job.ID)
+
+	if job.State != Done {
+		t.Errorf("Expected state %s, got %s", Done, job.State)
+	}
+
+	if job.Progress != (Progress{Done: 2, Total: 2}) {
+		t.Errorf("Unexpected progress %+v", job.Progress)
+	}
+
+	if len(job.Logs) != 1 || job.Logs[0] != "copying 2 files" {
+		t.Errorf("Unexpected logs %v", job.Logs)
+	}
+}
+
+func TestManager_Failed(t *testing.T) {
+	m := NewManager(nil)
+
+	job := m.Start("backup", "", "", func(ctx context.Context, h *Handle) error {
+		return errors.New("disk full")
+	})
+
+	job = waitFinished(t, m, job.ID)
+
+	if job.State != Failed || job.Error != "disk full" {
+		t.Errorf("Expected a failed job with its error, got %s %q", job.State, job.Error)
+	}
+}
+
+func TestManager_Cancel(t *testing.T) {
+	m := NewManager(nil)
+
+	job := m.Start("download", "", "", func(ctx context.Context, h *Handle) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := m.Cancel(job.ID)
+	if err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+
+	job = waitFinished(t, m, job.ID)
+
+	if job.State != Cancelled {
+		t.Errorf("Expected state %s, got %s", Cancelled, job.State)
+	}
+
+	err = m.Cancel(job.ID)
+	if !errors.Is(err, ErrFinished) {
+		t.Errorf("Expected ErrFinished, got %v", err)
+	}
+
+	err = m.Cancel("missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestManager_RunReader(t *testing.T) {
+	m := NewManager(nil)
+
+	var out bytes.Buffer
+
+	err := m.Run(context.Background(), "import", "", "", func(ctx context.Context, h *Handle) error {
+		_, err := io.Copy(&out, h.Reader(strings.NewReader("snapshot"), 8))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	list := m.List("")
+	if len(list) != 1 {
+		t.Fatalf("Expected 1 job, got %d", len(list))
+	}
+
+	if list[0].State != Done || list[0].Progress.Done != 8 {
+		t.Errorf("Unexpected job %+v", list[0])
+	}
+}
+
+func TestManager_WriterCancelled(t *testing.T) {
+	m := NewManager(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := m.Run(ctx, "export", "", "", func(ctx context.Context, h *Handle) error {
+		_, err := h.Writer(io.Discard, 0).Write([]byte("data"))
+		return err
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestManager_ListByActor(t *testing.T) {
+	m := NewManager(nil)
+
+	noop := func(ctx context.Context, h *Handle) error { return nil }
+
+	_ = m.Run(context.Background(), "backup", "", "alice", noop)
+	_ = m.Run(context.Background(), "backup", "", "bob", noop)
+
+	if n := len(m.List("alice")); n != 1 {
+		t.Errorf("Expected 1 job for alice, got %d", n)
+	}
+
+	if n := len(m.List("")); n != 2 {
+		t.Errorf("Expected 2 jobs, got %d", n)
+	}
+}
+
+func TestManager_OnUpdate(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		states []string
+	)
+
+	m := NewManager(func(job Job) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		states = append(states, job.State)
+	})
+
+	_ = m.Run(context.Background(), "backup", "", "", func(ctx context.Context, h *Handle) error {
+		h.Logf("working")
+		return nil
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	want := []string{Running, Running, Done}
+	if strings.Join(states, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected updates %v, got %v", want, states)
+	}
+}
+
+func TestManager_LogsCapped(t *testing.T) {
+	m := NewManager(nil)
+
+	_ = m.Run(context.Background(), "backup", "", "", func(ctx context.Context, h *Handle) error {
+		for i := 0; i < maxLogs+10; i++ {
+			h.Logf("line %d", i)
+		}
+
+		return nil
+	})
+
+	job := m.List("")[0]
+
+	if len(job.Logs) != maxLogs || job.Logs[0] != "line 10" {
+		t.Errorf("Expected the last %d lines, got %d starting with %q", maxLogs, len(job.Logs), job.Logs[0])
+	}
+}
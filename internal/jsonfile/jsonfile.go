@@ -0,0 +1,76 @@
+// Package jsonfile reads and writes the JSON files of the stores. Files are
+// replaced atomically, through a temporary file renamed over the old one, so
+// a crash never leaves one half written. They are only readable by their
+// owner, as many hold keys.
+package jsonfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Load decodes the file at path into v. A file that doesn't exist yet leaves
+// v alone, so stores start out with the defaults they set.
+func Load(path string, v any) error {
+	data, err := os.ReadFile(path) // #nosec G304
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("error decoding JSON: %w", err)
+	}
+
+	return nil
+}
+
+// Save writes v to path as indented JSON, creating its directory.
+func Save(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %w", err)
+	}
+
+	return WriteFile(path, data)
+}
+
+// SaveCompact writes v to path as JSON without indentation, for stores that
+// grow large such as samples and events.
+func SaveCompact(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %w", err)
+	}
+
+	return WriteFile(path, data)
+}
+
+// WriteFile replaces path with data, creating its directory.
+func WriteFile(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package jsonfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "store.json")
+
+	err := Save(path, map[string]int{"a": 1})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read the file: %v", err)
+	}
+
+	if string(data) != "{\n  \"a\": 1\n}" {
+		t.Errorf("Expected indented JSON, got %q", data)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat the file: %v", err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	err = SaveCompact(path, []int{1, 2})
+	if err != nil {
+		t.Fatalf("SaveCompact failed: %v", err)
+	}
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read the file: %v", err)
+	}
+
+	if string(data) != "[1,2]" {
+		t.Errorf("Expected compact JSON, got %q", data)
+	}
+
+	_, err = os.Stat(path + ".tmp")
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected no temporary file left, got %v", err)
+	}
+}
+
+func TestSave_Unencodable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	err := Save(path, func() {})
+	if err == nil {
+		t.Fatal("Expected an error encoding a function")
+	}
+
+	_, err = os.Stat(path)
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written, got %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	v := map[string]int{"default": 1}
+
+	err := Load(filepath.Join(dir, "missing.json"), &v)
+	if err != nil {
+		t.Fatalf("Load of a missing file failed: %v", err)
+	}
+
+	if v["default"] != 1 {
+		t.Errorf("Expected a missing file to leave the value alone, got %v", v)
+	}
+
+	path := filepath.Join(dir, "store.json")
+
+	err = Save(path, map[string]int{"a": 2})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	var got map[string]int
+
+	err = Load(path, &got)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if got["a"] != 2 {
+		t.Errorf("Expected the saved value, got %v", got)
+	}
+
+	err = os.WriteFile(path, []byte("{"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write the file: %v", err)
+	}
+
+	err = Load(path, &got)
+	if err == nil {
+		t.Error("Expected an error decoding a truncated file")
+	}
+}
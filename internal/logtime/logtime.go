@@ -0,0 +1,141 @@
+// Package logtime reads the timestamps Bedrock starts its console lines
+// with, which are in the server's local time, and reconciles them with when
+// the wrapper read the lines, so lines of servers in different timezones, or
+// with a clock set to the wrong zone, can be put in order.
+package logtime
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	timestampLayout = "2006-01-02 15:04:05"
+
+	// offsetStep is what offsets between the server's clock and the
+	// wrapper's are rounded to. Timezones are offset from UTC by multiples
+	// of 15 minutes, and lines are read well within half of that.
+	offsetStep = 15 * time.Minute
+
+	// confirmLines is how many lines in a row must agree on a new offset
+	// before it's used, so a line read late doesn't shift the others.
+	confirmLines = 3
+)
+
+// prefixPattern matches the "[2024-06-14 09:02:01:123 INFO] " prefix.
+var prefixPattern = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?::\d{3})?) [A-Z]+\]`)
+
+// ParseTimestamp parses Bedrock's "2006-01-02 15:04:05:000" timestamps in
+// loc. Their millisecond separator is a colon that time.Parse doesn't
+// understand. It returns the zero time if s is not a timestamp.
+func ParseTimestamp(s string, loc *time.Location) time.Time {
+	base, millis := s, ""
+	if len(s) > len(timestampLayout) {
+		base, millis = s[:len(timestampLayout)], s[len(timestampLayout)+1:]
+	}
+
+	t, err := time.ParseInLocation(timestampLayout, base, loc)
+	if err != nil {
+		return time.Time{}
+	}
+
+	ms, err := strconv.Atoi(millis)
+	if err == nil {
+		t = t.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	return t
+}
+
+// Parse returns the timestamp a console line starts with, in loc.
+func Parse(line string, loc *time.Location) (time.Time, bool) {
+	m := prefixPattern.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	t := ParseTimestamp(m[1], loc)
+
+	return t, !t.IsZero()
+}
+
+// Strip returns a console line without its timestamp, keeping the level,
+// so lines logged at different times can be compared.
+func Strip(line string) string {
+	m := prefixPattern.FindStringSubmatchIndex(line)
+	if m == nil {
+		return line
+	}
+
+	// Drop the timestamp and the space after it
+	return line[:m[2]] + line[m[3]+1:]
+}
+
+// Clock reconciles the timestamps of a server's console lines with when
+// they were read. It is safe for concurrent use.
+type Clock struct {
+	loc *time.Location
+
+	mu        sync.Mutex
+	offset    time.Duration // Added to the server's timestamps
+	candidate time.Duration // Offset the latest lines agree on
+	agreed    int           // Lines in a row that agree on candidate
+}
+
+// NewClock returns a clock for a server logging in loc, time.Local if nil.
+func NewClock(loc *time.Location) *Clock {
+	if loc == nil {
+		loc = time.Local
+	}
+
+	return &Clock{loc: loc}
+}
+
+// Reconcile returns when a console line read at read was logged, in UTC:
+// its timestamp corrected by the offset between the server's clock and the
+// wrapper's, and never after it was read. It returns false if the line has
+// no timestamp.
+func (c *Clock) Reconcile(line string, read time.Time) (time.Time, bool) {
+	t, ok := Parse(line, c.loc)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	offset := read.Sub(t).Round(offsetStep)
+
+	c.mu.Lock()
+
+	switch {
+	case offset == c.offset:
+		c.agreed = 0
+	case offset == c.candidate:
+		c.agreed++
+	default:
+		c.candidate, c.agreed = offset, 1
+	}
+
+	if c.agreed >= confirmLines {
+		c.offset, c.agreed = c.candidate, 0
+	}
+
+	t = t.Add(c.offset)
+
+	c.mu.Unlock()
+
+	if t.After(read) {
+		t = read
+	}
+
+	return t.UTC(), true
+}
+
+// Offset returns what is added to the server's timestamps, e.g. -2h for a
+// server whose clock is two hours ahead of the wrapper's.
+func (c *Clock) Offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.offset
+}
@@ -0,0 +1,88 @@
+package logtime
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("No timezone data: %v", err)
+	}
+
+	got, ok := Parse("[2024-06-14 09:02:01:123 INFO] Server started.", tokyo)
+	if !ok {
+		t.Fatal("Expected the timestamp to be parsed")
+	}
+
+	want := time.Date(2024, 6, 14, 0, 2, 1, 123000000, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, got.UTC())
+	}
+
+	if _, ok := Parse("Player connected: Steve", tokyo); ok {
+		t.Error("Expected no timestamp in a line without one")
+	}
+}
+
+func TestStrip(t *testing.T) {
+	got := Strip("[2024-06-14 09:02:01:123 ERROR] [Scripting] boom")
+	if got != "[ERROR] [Scripting] boom" {
+		t.Errorf("Expected the timestamp to be dropped, got %q", got)
+	}
+
+	if got := Strip("Player connected: Steve"); got != "Player connected: Steve" {
+		t.Errorf("Expected a line without a timestamp unchanged, got %q", got)
+	}
+}
+
+func TestClock_Reconcile(t *testing.T) {
+	c := NewClock(time.UTC)
+	read := time.Date(2024, 6, 14, 9, 2, 1, 500000000, time.UTC)
+
+	line := func(t time.Time) string {
+		return fmt.Sprintf("[%s:%03d INFO] Running AutoCompaction...", t.Format(timestampLayout), t.Nanosecond()/1e6)
+	}
+
+	got, ok := c.Reconcile(line(read.Add(-200*time.Millisecond)), read)
+	if !ok || !got.Equal(read.Add(-200*time.Millisecond)) {
+		t.Errorf("Expected the line's own timestamp, got %v", got)
+	}
+
+	// A server logging two hours ahead of the wrapper is corrected once a
+	// few lines agree
+	ahead := func(read time.Time) string { return line(read.Add(2 * time.Hour)) }
+
+	for i := 0; i < confirmLines; i++ {
+		read = read.Add(time.Second)
+
+		got, _ = c.Reconcile(ahead(read), read)
+		if !got.Equal(read) {
+			t.Errorf("Expected a timestamp after the read time to be capped, got %v", got)
+		}
+	}
+
+	if c.Offset() != -2*time.Hour {
+		t.Fatalf("Expected an offset of -2h, got %v", c.Offset())
+	}
+
+	read = read.Add(time.Second)
+
+	got, _ = c.Reconcile(line(read.Add(2*time.Hour-300*time.Millisecond)), read)
+	if !got.Equal(read.Add(-300 * time.Millisecond)) {
+		t.Errorf("Expected the corrected timestamp, got %v", got)
+	}
+
+	// A single line read late doesn't shift the offset
+	c.Reconcile(line(read.Add(2*time.Hour-20*time.Minute)), read)
+
+	if c.Offset() != -2*time.Hour {
+		t.Errorf("Expected the offset to be kept, got %v", c.Offset())
+	}
+
+	if _, ok := c.Reconcile("NO LOG FILE! - setting up server logging...", read); ok {
+		t.Error("Expected no time for a line without a timestamp")
+	}
+}
@@ -0,0 +1,265 @@
+// Package macros keeps named command sequences with placeholders that are
+// filled in when they run.
+package macros
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// Who may run a macro, besides admins.
+const (
+	RunView    = "view"    // Users who can view the wrapper
+	RunOperate = "operate" // Users who can send commands to the wrapper
+	RunAdmin   = "admin"   // Admins only
+)
+
+// Built-in variables, filled in for each wrapper a macro runs on.
+const (
+	VarServer  = "server"  // Wrapper name
+	VarWrapper = "wrapper" // Wrapper ID
+)
+
+var (
+	ErrNotFound = errors.New("macro not found")
+	ErrInvalid  = errors.New("invalid macro")
+
+	namePattern        = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	placeholderPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+)
+
+// Macro is a named sequence of commands. Placeholders like {player} are
+// replaced with variables given when it runs; {server} and {wrapper} are
+// the wrapper it runs on.
+type Macro struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Commands    []string `json:"commands"`
+	Run         string   `json:"run"`             // Access needed to run it, operate if empty
+	Users       []string `json:"users,omitempty"` // Limits who may run it, if set
+}
+
+// Validate checks a macro, filling in the default access.
+func (m *Macro) Validate() error {
+	if m.Run == "" {
+		m.Run = RunOperate
+	}
+
+	if !namePattern.MatchString(m.Name) {
+		return fmt.Errorf("%w: names may only use letters, digits, _ and -", ErrInvalid)
+	}
+
+	if m.Run != RunView && m.Run != RunOperate && m.Run != RunAdmin {
+		return fmt.Errorf("%w: unknown run access %q", ErrInvalid, m.Run)
+	}
+
+	if len(m.Commands) == 0 {
+		return fmt.Errorf("%w: no commands", ErrInvalid)
+	}
+
+	for _, c := range m.Commands {
+		if strings.TrimSpace(c) == "" || strings.ContainsAny(c, "\r\n") {
+			return fmt.Errorf("%w: commands must be a single non-empty line", ErrInvalid)
+		}
+	}
+
+	return nil
+}
+
+// Variables returns the variables a macro needs, besides the built-ins.
+func (m Macro) Variables() []string {
+	seen := map[string]bool{VarServer: true, VarWrapper: true}
+	vars := []string{}
+
+	for _, c := range m.Commands {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(c, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				vars = append(vars, match[1])
+			}
+		}
+	}
+
+	return vars
+}
+
+// Allows reports whether a user may run the macro, by name.
+func (m Macro) Allows(user string) bool {
+	if len(m.Users) == 0 {
+		return true
+	}
+
+	for _, u := range m.Users {
+		if u == user {
+			return true
+		}
+	}
+
+	return false
+}
+
+// quote quotes values with spaces, as required for player names and other
+// command arguments.
+func quote(value string) string {
+	if strings.ContainsAny(value, " \"") {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+
+	return value
+}
+
+// Expand returns the commands with placeholders replaced. Values with spaces
+// are quoted, so they stay a single argument.
+func (m Macro) Expand(vars map[string]string) ([]string, error) {
+	var missing []string
+
+	for _, v := range m.Variables() {
+		if _, ok := vars[v]; !ok {
+			missing = append(missing, v)
+		}
+	}
+
+	for _, v := range []string{VarServer, VarWrapper} {
+		if _, ok := vars[v]; !ok {
+			missing = append(missing, v)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: missing variables %s", ErrInvalid, strings.Join(missing, ", "))
+	}
+
+	for name, value := range vars {
+		if value == "" || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("%w: variable %s must be a single non-empty line", ErrInvalid, name)
+		}
+	}
+
+	commands := make([]string, 0, len(m.Commands))
+
+	for _, c := range m.Commands {
+		commands = append(commands, placeholderPattern.ReplaceAllStringFunc(c, func(p string) string {
+			value, ok := vars[p[1:len(p)-1]]
+			if !ok {
+				return p
+			}
+
+			return quote(value)
+		}))
+	}
+
+	return commands, nil
+}
+
+// Store keeps macros in a JSON file.
+type Store struct {
+	path   string
+	mu     sync.Mutex
+	macros map[string]Macro
+}
+
+// Open loads the store at path, starting empty if it doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, macros: map[string]Macro{}}
+
+	var list []Macro
+
+	err := jsonfile.Load(path, &list)
+	if err != nil {
+		return nil, fmt.Errorf("error loading macros: %w", err)
+	}
+
+	for _, m := range list {
+		s.macros[m.Name] = m
+	}
+
+	return s, nil
+}
+
+// list returns the macros sorted by name. The caller must hold the lock.
+func (s *Store) list() []Macro {
+	list := make([]Macro, 0, len(s.macros))
+	for _, m := range s.macros {
+		list = append(list, m)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// save writes the macros sorted by name. s.mu must be held.
+func (s *Store) save() error {
+	err := jsonfile.Save(s.path, s.list())
+	if err != nil {
+		return fmt.Errorf("error saving macros: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the macros sorted by name.
+func (s *Store) List() []Macro {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list()
+}
+
+// Get returns a macro by name.
+func (s *Store) Get(name string) (Macro, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.macros[name]
+	if !ok {
+		return Macro{}, ErrNotFound
+	}
+
+	return m, nil
+}
+
+// Put adds a macro, or replaces the one with the same name.
+func (s *Store) Put(m Macro) (Macro, error) {
+	m, _, err := s.Set(m)
+	return m, err
+}
+
+// Set adds a macro, or replaces the one with the same name, and reports
+// whether it was added.
+func (s *Store) Set(m Macro) (Macro, bool, error) {
+	err := m.Validate()
+	if err != nil {
+		return Macro{}, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.macros[m.Name]
+	s.macros[m.Name] = m
+
+	return m, !exists, s.save()
+}
+
+// Delete removes a macro.
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.macros[name]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.macros, name)
+
+	return s.save()
+}
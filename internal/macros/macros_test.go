@@ -0,0 +1,99 @@
+package macros
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	m := Macro{
+		Name:     "welcome",
+		Commands: []string{"tp {player} 0 64 0", "say Welcome to {server}, {player}", "give {player} {item}"},
+	}
+
+	err := m.Validate()
+	if err != nil || m.Run != RunOperate {
+		t.Fatalf("Expected a valid macro run by operators, got %v, %q", err, m.Run)
+	}
+
+	if vars := m.Variables(); !reflect.DeepEqual(vars, []string{"player", "item"}) {
+		t.Errorf("Unexpected variables: %v", vars)
+	}
+
+	got, err := m.Expand(map[string]string{
+		"player":   "Steve Two",
+		"item":     "bread",
+		VarServer:  "Survival",
+		VarWrapper: "w1",
+	})
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+
+	want := []string{`tp "Steve Two" 0 64 0`, `say Welcome to Survival, "Steve Two"`, "give \"Steve Two\" bread"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expand() = %q, want %q", got, want)
+	}
+
+	_, err = m.Expand(map[string]string{VarServer: "s", VarWrapper: "w"})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected missing variables to be refused, got %v", err)
+	}
+
+	vars := map[string]string{"player": "Steve\nstop", "item": "x", VarServer: "s", VarWrapper: "w"}
+
+	_, err = m.Expand(vars)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected line breaks in variables to be refused, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, m := range []Macro{
+		{Name: "bad name", Commands: []string{"list"}},
+		{Name: "ok", Commands: []string{"list\nstop"}},
+		{Name: "ok", Commands: []string{"list"}, Run: "everyone"},
+		{Name: "ok"},
+	} {
+		err := m.Validate()
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", m, err)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "macros.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	_, err = store.Put(Macro{Name: "players", Commands: []string{"list"}, Run: RunView, Users: []string{"alice"}})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	m, err := reopened.Get("players")
+	if err != nil || !m.Allows("alice") || m.Allows("bob") {
+		t.Errorf("Unexpected macro: %+v, %v", m, err)
+	}
+
+	err = reopened.Delete("players")
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	_, err = reopened.Get("players")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+// Package mcfunction parses and validates .mcfunction scripts and keeps a
+// library of them.
+package mcfunction
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+const (
+	// Dir is the directory in the app directory the library is kept in.
+	Dir = "wrapper_functions"
+
+	// MaxLines is the most commands a function may have, the same as
+	// Bedrock's limit for functions in packs.
+	MaxLines = 10000
+
+	maxSize = 1 << 20
+	ext     = ".mcfunction"
+)
+
+var (
+	ErrInvalidName = errors.New("invalid function name")
+	ErrNotFound    = errors.New("function not found")
+	ErrTooLarge    = errors.New("function too large")
+	ErrInvalid     = errors.New("invalid function")
+
+	namePattern = regexp.MustCompile(`^[a-z0-9_-]+(/[a-z0-9_-]+)*$`)
+)
+
+// Commands are the Bedrock commands functions may use. stop isn't one of
+// them, since it would end the run along with the server.
+var Commands = map[string]bool{}
+
+func init() {
+	for _, c := range strings.Fields(`
+		allowlist camera camerashake clear clearspawnpoint clone damage daylock
+		deop dialogue difficulty effect enchant event execute fill fog function
+		gamemode gamerule give help hud inputpermission kick kill list locate
+		loot me mobevent msg music op particle permission place playanimation
+		playsound recipe reload replaceitem ride save say schedule scoreboard
+		scriptevent setblock setmaxplayers setworldspawn spawnpoint
+		spreadplayers stopsound structure summon tag teleport tell tellraw
+		testfor testforblock testforblocks tickingarea time title titleraw
+		toggledownfall tp transfer w weather whitelist xp`) {
+		Commands[c] = true
+	}
+}
+
+// Line is a command in a function.
+type Line struct {
+	Number  int    `json:"line"`
+	Command string `json:"command"`
+}
+
+// LineError is a problem with a line of a function.
+type LineError struct {
+	Number  int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Number, e.Message)
+}
+
+// ValidationError lists the problems with a function.
+type ValidationError struct {
+	Errors []LineError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, le := range e.Errors {
+		msgs = append(msgs, le.Error())
+	}
+
+	return fmt.Sprintf("%s: %s", ErrInvalid, strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalid
+}
+
+// Parse returns the commands of a function, skipping blank lines and
+// comments, or a *ValidationError listing unknown commands.
+func Parse(data []byte) ([]Line, error) {
+	var (
+		lines    []Line
+		problems []LineError
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSize)
+
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		text = strings.TrimPrefix(text, "/")
+		name, _, _ := strings.Cut(text, " ")
+
+		if !Commands[strings.ToLower(name)] {
+			problems = append(problems, LineError{Number: n, Message: fmt.Sprintf("unknown command %q", name)})
+			continue
+		}
+
+		lines = append(lines, Line{Number: n, Command: text})
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading function: %w", err)
+	}
+
+	if len(lines)+len(problems) > MaxLines {
+		problems = append(problems, LineError{Number: MaxLines + 1, Message: fmt.Sprintf("more than %d commands", MaxLines)})
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Errors: problems}
+	}
+
+	return lines, nil
+}
+
+// Function is a function in the library.
+type Function struct {
+	Name    string    `json:"name"` // e.g. "events/reset_arena"
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// path returns the file path of a function.
+func path(appDir, name string) (string, error) {
+	if !namePattern.MatchString(name) {
+		return "", ErrInvalidName
+	}
+
+	return filepath.Join(appDir, Dir, filepath.FromSlash(name)+ext), nil
+}
+
+// List returns the functions in the library, sorted by name.
+func List(appDir string) ([]Function, error) {
+	root := filepath.Join(appDir, Dir)
+	functions := []Function{}
+
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == root {
+				return filepath.SkipDir
+			}
+
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(p, ext) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		functions = append(functions, Function{
+			Name:    strings.TrimSuffix(filepath.ToSlash(rel), ext),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing functions: %w", err)
+	}
+
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Name < functions[j].Name
+	})
+
+	return functions, nil
+}
+
+// Read returns the contents of a function.
+func Read(appDir, name string) ([]byte, error) {
+	p, err := path(appDir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(p) // #nosec G304
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading function: %w", err)
+	}
+
+	return data, nil
+}
+
+// Save validates a function and adds it to the library, replacing any
+// function with the same name. It returns the previous contents, nil if the
+// function is new.
+func Save(appDir, name string, data []byte) ([]byte, error) {
+	p, err := path(appDir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	_, err = Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := os.ReadFile(p) // #nosec G304
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading function: %w", err)
+	}
+
+	err = jsonfile.WriteFile(p, data)
+	if err != nil {
+		return nil, fmt.Errorf("error saving function: %w", err)
+	}
+
+	return old, nil
+}
+
+// Delete removes a function from the library.
+func Delete(appDir, name string) error {
+	p, err := path(appDir, name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("error deleting function: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package mcfunction
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	lines, err := Parse([]byte("# Reset the arena\n\n/fill 0 64 0 10 70 10 air\r\n  say Arena reset\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	want := []Line{{Number: 3, Command: "fill 0 64 0 10 70 10 air"}, {Number: 4, Command: "say Arena reset"}}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("Parse() = %+v, want %+v", lines, want)
+	}
+
+	_, err = Parse([]byte("say hi\nfly @a\nstop\n"))
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) || !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+
+	if len(verr.Errors) != 2 || verr.Errors[0].Number != 2 || verr.Errors[1].Number != 3 {
+		t.Errorf("Unexpected problems: %+v", verr.Errors)
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	dir := t.TempDir()
+
+	functions, err := List(dir)
+	if err != nil || len(functions) != 0 {
+		t.Fatalf("Expected an empty library, got %+v, %v", functions, err)
+	}
+
+	old, err := Save(dir, "events/reset", []byte("say one\n"))
+	if err != nil || old != nil {
+		t.Fatalf("Save failed: %v, %q", err, old)
+	}
+
+	old, err = Save(dir, "events/reset", []byte("say two\n"))
+	if err != nil || string(old) != "say one\n" {
+		t.Fatalf("Expected the previous contents, got %q, %v", old, err)
+	}
+
+	_, err = Save(dir, "bad", []byte("nope\n"))
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected invalid functions to be refused, got %v", err)
+	}
+
+	for _, name := range []string{"../escape", "Upper", "a//b", ""} {
+		_, err := Save(dir, name, []byte("say hi\n"))
+		if !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Expected %q to be an invalid name, got %v", name, err)
+		}
+	}
+
+	functions, err = List(dir)
+	if err != nil || len(functions) != 1 || functions[0].Name != "events/reset" {
+		t.Fatalf("Unexpected functions: %+v, %v", functions, err)
+	}
+
+	data, err := Read(dir, "events/reset")
+	if err != nil || string(data) != "say two\n" {
+		t.Errorf("Unexpected contents: %q, %v", data, err)
+	}
+
+	err = Delete(dir, "events/reset")
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	_, err = Read(dir, "events/reset")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,465 @@
+// Package mdns advertises wrappers on the LAN with multicast DNS (DNS-SD)
+// and finds them from the central server, so home users can add servers to
+// the dashboard without looking up their addresses.
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Service is the DNS-SD service type wrappers are advertised under.
+const Service = "_gogo-mc._tcp.local."
+
+const (
+	// BrowseTimeout is how long Browse waits for answers unless its context
+	// has an earlier deadline.
+	BrowseTimeout = 2 * time.Second
+
+	recordTTL     = 120 // Seconds the records are cached for
+	announcements = 2   // Unsolicited answers sent when advertising starts
+	maxPacket     = 9000
+)
+
+// ErrInvalid is returned for instances that can't be advertised.
+var ErrInvalid = errors.New("invalid mDNS instance")
+
+// groupAddr is the IPv4 multicast group and port of mDNS.
+var groupAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Instance is a wrapper advertised on the LAN.
+type Instance struct {
+	Name string            `json:"name"`          // Shown in the dashboard, e.g. "Survival"
+	Host string            `json:"host"`          // e.g. "minecraft.local."
+	Addr string            `json:"addr"`          // IP address the wrapper is reached on
+	Port int               `json:"port"`          // Of the wrapper's web server
+	TXT  map[string]string `json:"txt,omitempty"` // "version", "scheme" (ws or wss) and "path"
+}
+
+// Address returns the WebSocket URL of the wrapper, as the central server
+// connects to it.
+func (i Instance) Address() string {
+	scheme := "ws"
+	if i.TXT["scheme"] == "wss" {
+		scheme = "wss"
+	}
+
+	path := i.TXT["path"]
+	if !strings.HasPrefix(path, "/") {
+		path = "/ws"
+	}
+
+	return scheme + "://" + net.JoinHostPort(i.Addr, strconv.Itoa(i.Port)) + path
+}
+
+// instanceName returns the DNS name of an instance named name. Dots can't be
+// part of a label, and labels are at most 63 bytes.
+func instanceName(name string) string {
+	label := strings.ReplaceAll(name, ".", " ")
+	for len(label) > 63 {
+		_, size := utf8.DecodeLastRuneInString(label)
+		label = label[:len(label)-size]
+	}
+
+	return label + "." + Service
+}
+
+// Responder answers mDNS queries for an instance until it's closed.
+type Responder struct {
+	conn     *net.UDPConn
+	instance Instance
+	addrs    []netip.Addr // Advertised in A records
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Advertise starts answering queries for the instance on the LAN. The host
+// defaults to the host name, and the A records to the instance's address, or
+// all IPv4 addresses of the host if it has none.
+func Advertise(instance Instance) (*Responder, error) {
+	if strings.TrimSpace(instance.Name) == "" {
+		return nil, fmt.Errorf("%w: name is empty", ErrInvalid)
+	}
+
+	if instance.Port <= 0 || instance.Port > 65535 {
+		return nil, fmt.Errorf("%w: port %d", ErrInvalid, instance.Port)
+	}
+
+	if instance.Host == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("error getting host name: %w", err)
+		}
+
+		instance.Host, _, _ = strings.Cut(hostname, ".")
+	}
+
+	if !strings.HasSuffix(instance.Host, ".") {
+		instance.Host += ".local."
+	}
+
+	_, err := dnsmessage.NewName(instance.Host)
+	if err != nil {
+		return nil, fmt.Errorf("%w: host %q: %v", ErrInvalid, instance.Host, err)
+	}
+
+	addrs, err := advertisedAddrs(instance.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, groupAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error joining mDNS group: %w", err)
+	}
+
+	r := &Responder{
+		conn:     conn,
+		instance: instance,
+		addrs:    addrs,
+		done:     make(chan struct{}),
+	}
+
+	r.wg.Add(2)
+
+	go r.serve()
+	go r.announce()
+
+	return r, nil
+}
+
+// advertisedAddrs returns addr, or the IPv4 addresses of the host's
+// interfaces other than loopback if it's empty.
+func advertisedAddrs(addr string) ([]netip.Addr, error) {
+	if addr != "" {
+		ip, err := netip.ParseAddr(addr)
+		if err != nil || !ip.Is4() {
+			return nil, fmt.Errorf("%w: %q is not an IPv4 address", ErrInvalid, addr)
+		}
+
+		return []netip.Addr{ip}, nil
+	}
+
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("error listing addresses: %w", err)
+	}
+
+	var addrs []netip.Addr
+
+	for _, a := range ifaceAddrs {
+		prefix, err := netip.ParsePrefix(a.String())
+		if err != nil {
+			continue
+		}
+
+		ip := prefix.Addr()
+		if ip.Is4() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() {
+			addrs = append(addrs, ip)
+		}
+	}
+
+	return addrs, nil
+}
+
+// Close stops answering queries, telling the LAN the instance is gone. It
+// does nothing on a nil responder.
+func (r *Responder) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	select {
+	case <-r.done:
+		return nil
+	default:
+	}
+
+	close(r.done)
+
+	// A TTL of zero makes caches drop the records
+	goodbye := r.response(0)
+
+	packed, err := goodbye.Pack()
+	if err == nil {
+		_, _ = r.conn.WriteToUDP(packed, groupAddr)
+	}
+
+	err = r.conn.Close()
+	r.wg.Wait()
+
+	return err
+}
+
+// serve answers the queries for the instance. Queries sent from a port
+// other than 5353 are one-shot ones, answered to the sender only.
+func (r *Responder) serve() {
+	defer r.wg.Done()
+
+	buf := make([]byte, maxPacket)
+
+	for {
+		n, src, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		var query dnsmessage.Message
+
+		err = query.Unpack(buf[:n])
+		if err != nil || query.Header.Response || !r.matches(query.Questions) {
+			continue
+		}
+
+		resp := r.response(recordTTL)
+		dest := groupAddr
+
+		if src.Port != groupAddr.Port {
+			resp.Header.ID = query.Header.ID
+			resp.Questions = query.Questions
+			dest = src
+		}
+
+		packed, err := resp.Pack()
+		if err != nil {
+			continue
+		}
+
+		_, _ = r.conn.WriteToUDP(packed, dest)
+	}
+}
+
+// announce sends the records unsolicited when advertising starts, so
+// browsers already listening see the instance.
+func (r *Responder) announce() {
+	defer r.wg.Done()
+
+	for i := range announcements {
+		if i > 0 {
+			select {
+			case <-time.After(time.Second):
+			case <-r.done:
+				return
+			}
+		}
+
+		resp := r.response(recordTTL)
+
+		packed, err := resp.Pack()
+		if err != nil {
+			return
+		}
+
+		_, _ = r.conn.WriteToUDP(packed, groupAddr)
+	}
+}
+
+// matches reports whether any of the questions asks for the records of the
+// instance.
+func (r *Responder) matches(questions []dnsmessage.Question) bool {
+	names := []string{Service, instanceName(r.instance.Name), r.instance.Host}
+
+	for _, q := range questions {
+		for _, name := range names {
+			if strings.EqualFold(q.Name.String(), name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// response returns the answer with all records of the instance.
+func (r *Responder) response(ttl uint32) dnsmessage.Message {
+	service := dnsmessage.MustNewName(Service)
+	instance := dnsmessage.MustNewName(instanceName(r.instance.Name))
+	host := dnsmessage.MustNewName(r.instance.Host)
+
+	header := func(name dnsmessage.Name, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Type: typ, Class: dnsmessage.ClassINET, TTL: ttl}
+	}
+
+	var txt []string
+
+	for _, key := range sortedKeys(r.instance.TXT) {
+		txt = append(txt, key+"="+r.instance.TXT[key])
+	}
+
+	if len(txt) == 0 {
+		txt = []string{""} // A TXT record needs at least one string
+	}
+
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: []dnsmessage.Resource{
+			{Header: header(service, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: instance}},
+			{Header: header(instance, dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{
+				Target: host,
+				Port:   uint16(r.instance.Port), // #nosec G115 -- Checked by Advertise
+			}},
+			{Header: header(instance, dnsmessage.TypeTXT), Body: &dnsmessage.TXTResource{TXT: txt}},
+		},
+	}
+
+	for _, ip := range r.addrs {
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{
+			Header: header(host, dnsmessage.TypeA),
+			Body:   &dnsmessage.AResource{A: ip.As4()},
+		})
+	}
+
+	return msg
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+// Browse asks the LAN for wrappers and returns those that answered before
+// ctx is done, or BrowseTimeout passed, sorted by name.
+func Browse(ctx context.Context) ([]Instance, error) {
+	ctx, cancel := context.WithTimeout(ctx, BrowseTimeout)
+	defer cancel()
+
+	// A query from a port other than 5353 is answered to the port directly
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("error browsing for wrappers: %w", err)
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	query := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(Service),
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("error browsing for wrappers: %w", err)
+	}
+
+	_, err = conn.WriteToUDP(packed, groupAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error browsing for wrappers: %w", err)
+	}
+
+	found := map[string]Instance{}
+	buf := make([]byte, maxPacket)
+
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+
+		var msg dnsmessage.Message
+
+		err = msg.Unpack(buf[:n])
+		if err != nil || !msg.Header.Response {
+			continue
+		}
+
+		for name, instance := range parseResponse(msg, src.IP.String()) {
+			found[name] = instance
+		}
+	}
+
+	instances := make([]Instance, 0, len(found))
+	for _, instance := range found {
+		instances = append(instances, instance)
+	}
+
+	slices.SortFunc(instances, func(a, b Instance) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return instances, nil
+}
+
+// parseResponse returns the instances in an answer from src, by DNS name.
+// They're reached on the address that answered, which is routable from
+// here unlike some of the advertised ones.
+func parseResponse(msg dnsmessage.Message, src string) map[string]Instance {
+	instances := map[string]Instance{}
+
+	records := append(slices.Clone(msg.Answers), msg.Additionals...)
+
+	for _, rr := range records {
+		if ptr, ok := rr.Body.(*dnsmessage.PTRResource); ok && strings.EqualFold(rr.Header.Name.String(), Service) {
+			name := ptr.PTR.String()
+			label := strings.TrimSuffix(name, "."+Service)
+
+			instances[strings.ToLower(name)] = Instance{Name: label, Addr: src}
+		}
+	}
+
+	for _, rr := range records {
+		key := strings.ToLower(rr.Header.Name.String())
+
+		instance, ok := instances[key]
+		if !ok {
+			continue
+		}
+
+		switch body := rr.Body.(type) {
+		case *dnsmessage.SRVResource:
+			instance.Host = body.Target.String()
+			instance.Port = int(body.Port)
+		case *dnsmessage.TXTResource:
+			instance.TXT = parseTXT(body.TXT)
+		}
+
+		instances[key] = instance
+	}
+
+	for key, instance := range instances {
+		if instance.Port == 0 {
+			delete(instances, key)
+		}
+	}
+
+	return instances
+}
+
+// parseTXT returns the key/value pairs of a TXT record.
+func parseTXT(txt []string) map[string]string {
+	values := map[string]string{}
+
+	for _, s := range txt {
+		key, value, _ := strings.Cut(s, "=")
+		if key != "" {
+			values[strings.ToLower(key)] = value
+		}
+	}
+
+	return values
+}
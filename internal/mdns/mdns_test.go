@@ -0,0 +1,166 @@
+package mdns
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestInstanceAddress(t *testing.T) {
+	for _, tc := range []struct {
+		instance Instance
+		want     string
+	}{
+		{Instance{Addr: "192.168.1.20", Port: 8080}, "ws://192.168.1.20:8080/ws"},
+		{
+			Instance{Addr: "192.168.1.20", Port: 8443, TXT: map[string]string{"scheme": "wss", "path": "/mc/ws"}},
+			"wss://192.168.1.20:8443/mc/ws",
+		},
+		{
+			Instance{Addr: "fe80::1", Port: 8080, TXT: map[string]string{"scheme": "http", "path": "ws"}},
+			"ws://[fe80::1]:8080/ws",
+		},
+	} {
+		if got := tc.instance.Address(); got != tc.want {
+			t.Errorf("Address() of %+v = %q, want %q", tc.instance, got, tc.want)
+		}
+	}
+}
+
+func TestInstanceName(t *testing.T) {
+	if got := instanceName("My.Server"); got != "My Server."+Service {
+		t.Errorf("Expected dots to be replaced, got %q", got)
+	}
+
+	label := strings.TrimSuffix(instanceName(strings.Repeat("é", 40)), "."+Service)
+	if len(label) > 63 || !strings.HasPrefix(strings.Repeat("é", 40), label) {
+		t.Errorf("Expected the label to be cut on a rune at 63 bytes, got %q (%d bytes)", label, len(label))
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	r := &Responder{
+		instance: Instance{
+			Name: "Survival Server",
+			Host: "minecraft.local.",
+			Port: 8080,
+			TXT:  map[string]string{"version": "1.2.3", "path": "/ws"},
+		},
+		addrs: []netip.Addr{netip.MustParseAddr("192.168.1.20")},
+	}
+
+	resp := r.response(recordTTL)
+
+	packed, err := resp.Pack()
+	if err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+
+	var msg dnsmessage.Message
+
+	err = msg.Unpack(packed)
+	if err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+
+	instances := parseResponse(msg, "10.0.0.5")
+	if len(instances) != 1 {
+		t.Fatalf("Expected one instance, got %+v", instances)
+	}
+
+	for _, instance := range instances {
+		if instance.Name != "Survival Server" || instance.Host != "minecraft.local." || instance.Port != 8080 {
+			t.Errorf("Unexpected instance %+v", instance)
+		}
+
+		if instance.Addr != "10.0.0.5" {
+			t.Errorf("Expected the address that answered, got %q", instance.Addr)
+		}
+
+		if instance.TXT["version"] != "1.2.3" {
+			t.Errorf("Expected the TXT values, got %v", instance.TXT)
+		}
+	}
+}
+
+func TestResponderMatches(t *testing.T) {
+	r := &Responder{instance: Instance{Name: "Survival", Host: "minecraft.local."}}
+
+	question := func(name string) []dnsmessage.Question {
+		return []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		}}
+	}
+
+	if !r.matches(question("_GOGO-MC._tcp.local.")) || !r.matches(question("Survival."+Service)) ||
+		!r.matches(question("minecraft.local.")) {
+		t.Error("Expected queries for the service, instance and host to match")
+	}
+
+	if r.matches(question("_http._tcp.local.")) {
+		t.Error("Expected other services not to match")
+	}
+}
+
+func TestAdvertiseAnswersOneShotQueries(t *testing.T) {
+	r, err := Advertise(Instance{Name: "Survival", Host: "minecraft", Addr: "127.0.0.1", Port: 8080})
+	if err != nil {
+		t.Skipf("mDNS unavailable: %v", err)
+	}
+	defer r.Close()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer conn.Close()
+
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 42},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(Service),
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+
+	packed, err := query.Pack()
+	if err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+
+	_, err = conn.WriteToUDP(packed, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: groupAddr.Port})
+	if err != nil {
+		t.Fatalf("WriteToUDP failed: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	buf := make([]byte, maxPacket)
+
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Skipf("No answer on loopback: %v", err)
+		}
+
+		var msg dnsmessage.Message
+		if msg.Unpack(buf[:n]) != nil || msg.Header.ID != 42 {
+			continue
+		}
+
+		for _, instance := range parseResponse(msg, src.IP.String()) {
+			if instance.Address() != "ws://127.0.0.1:8080/ws" {
+				t.Errorf("Expected the wrapper's address, got %q", instance.Address())
+			}
+
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package memlimit caps the memory of a process with a cgroup v2 memory
+// controller and reports its usage, so it can be restarted before the
+// kernel OOM-kills it.
+package memlimit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/cgroup"
+)
+
+// ErrUnsupported is returned where usage can't be reported.
+var ErrUnsupported = errors.New("memory usage is only reported on Linux")
+
+// Limiter reports the memory usage of a process and, when the limit could be
+// enforced, caps it with a cgroup.
+type Limiter struct {
+	pid   atomic.Int64
+	limit int64
+	group string // cgroup directory of the process, empty if not enforced
+}
+
+// Watch returns a Limiter that only reports the usage of a process.
+func Watch(pid int) *Limiter {
+	l := &Limiter{}
+	l.pid.Store(int64(pid))
+
+	return l
+}
+
+// Follow switches to a new process, such as the restarted bedrock_server,
+// moving it into the cgroup when the limit is enforced.
+func (l *Limiter) Follow(pid int) error {
+	l.pid.Store(int64(pid))
+
+	if l.group == "" {
+		return nil
+	}
+
+	_, err := cgroup.Attach(pid, map[string]string{"memory.max": strconv.FormatInt(l.limit, 10)})
+
+	return err
+}
+
+// Limit returns the configured limit in bytes.
+func (l *Limiter) Limit() int64 {
+	return l.limit
+}
+
+// Enforced reports whether the kernel enforces the limit.
+func (l *Limiter) Enforced() bool {
+	return l.group != ""
+}
+
+// units are the multipliers of size suffixes, checked longest first.
+var units = []struct {
+	suffix string
+	factor int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// ParseSize parses a size such as "4G", "512MiB" or "1073741824" in bytes.
+// Units are binary.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	factor := int64(1)
+
+	for _, u := range units {
+		if strings.HasSuffix(value, u.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, u.suffix))
+			factor = u.factor
+
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return int64(n * float64(factor)), nil
+}
+
+// FormatSize formats bytes for alerts.
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.0f MiB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%d KiB", n>>10)
+	}
+}
+
+// parseField returns a numeric field of a "key value" file such as
+// memory.events, or a "Key: value kB" line of /proc/<pid>/status in bytes.
+func parseField(r io.Reader, key string) (int64, bool) {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fields := strings.Fields(strings.Replace(scanner.Text(), ":", " ", 1))
+		if len(fields) < 2 || fields[0] != key {
+			continue
+		}
+
+		n, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+
+		if len(fields) > 2 && fields[2] == "kB" {
+			n <<= 10
+		}
+
+		return n, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,71 @@
+package memlimit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/cgroup"
+)
+
+// New limits the memory of a running process to limit bytes by moving it
+// into its own cgroup. If that fails, for example without cgroup v2 or a
+// delegated cgroup, the returned Limiter still reports usage from /proc
+// together with the reason.
+func New(pid int, limit int64) (*Limiter, error) {
+	l := &Limiter{limit: limit}
+	l.pid.Store(int64(pid))
+
+	group, err := cgroup.Attach(pid, map[string]string{"memory.max": strconv.FormatInt(limit, 10)})
+	if err != nil {
+		return l, err
+	}
+
+	l.group = group
+
+	return l, nil
+}
+
+// Usage returns the memory used by the process, from its cgroup when the
+// limit is enforced and its resident set size otherwise.
+func (l *Limiter) Usage() (int64, error) {
+	if l.group != "" {
+		data, err := os.ReadFile(filepath.Join(l.group, "memory.current")) // #nosec G304
+		if err != nil {
+			return 0, fmt.Errorf("error reading memory usage: %w", err)
+		}
+
+		return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	}
+
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", l.pid.Load()))
+	if err != nil {
+		return 0, fmt.Errorf("error reading memory usage: %w", err)
+	}
+
+	rss, ok := parseField(bytes.NewReader(data), "VmRSS")
+	if !ok {
+		return 0, fmt.Errorf("no memory usage for process %d", l.pid.Load())
+	}
+
+	return rss, nil
+}
+
+// OOMKills returns how many times the kernel OOM-killed in the cgroup.
+func (l *Limiter) OOMKills() int64 {
+	if l.group == "" {
+		return 0
+	}
+
+	data, err := os.ReadFile(filepath.Join(l.group, "memory.events")) // #nosec G304
+	if err != nil {
+		return 0
+	}
+
+	n, _ := parseField(bytes.NewReader(data), "oom_kill")
+
+	return n
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package memlimit
+
+// New returns a Limiter that can neither enforce the limit nor report usage
+// outside Linux.
+func New(pid int, limit int64) (*Limiter, error) {
+	l := &Limiter{limit: limit}
+	l.pid.Store(int64(pid))
+
+	return l, ErrUnsupported
+}
+
+// Usage always fails outside Linux.
+func (l *Limiter) Usage() (int64, error) {
+	return 0, ErrUnsupported
+}
+
+// OOMKills always returns zero outside Linux.
+func (l *Limiter) OOMKills() int64 {
+	return 0
+}
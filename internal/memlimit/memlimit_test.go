@@ -0,0 +1,46 @@
+package memlimit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"4G":         4 << 30,
+		"512MiB":     512 << 20,
+		"1.5 gb":     3 << 29,
+		"1073741824": 1 << 30,
+		"64k":        64 << 10,
+	}
+
+	for input, want := range tests {
+		got, err := ParseSize(input)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"", "lots", "-1G", "0"} {
+		_, err := ParseSize(input)
+		if err == nil {
+			t.Errorf("Expected ParseSize(%q) to fail", input)
+		}
+	}
+
+	if got := FormatSize(3 << 29); got != "1.5 GiB" {
+		t.Errorf("Unexpected formatted size: %s", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	rss, ok := parseField(strings.NewReader("Name:\tbedrock_server\nVmRSS:\t  2048 kB\n"), "VmRSS")
+	if !ok || rss != 2048<<10 {
+		t.Errorf("Unexpected RSS: %d, %v", rss, ok)
+	}
+
+	kills, ok := parseField(strings.NewReader("low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n"), "oom_kill")
+	if !ok || kills != 1 {
+		t.Errorf("Unexpected OOM kills: %d, %v", kills, ok)
+	}
+}
@@ -0,0 +1,79 @@
+// Package mergepatch applies JSON merge patches (RFC 7386) to resources,
+// so API clients can change some fields of a resource without sending it
+// whole.
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalid is returned for a patch or document that isn't valid JSON.
+var ErrInvalid = errors.New("invalid merge patch")
+
+// Apply returns doc with patch merged in: fields of patch objects replace
+// those of doc, recursively, and null fields remove them.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target, changes any
+
+	err := json.Unmarshal(patch, &changes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	if len(doc) > 0 {
+		err = json.Unmarshal(doc, &target)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid document: %w", ErrInvalid, err)
+		}
+	}
+
+	return json.Marshal(merge(target, changes))
+}
+
+// merge merges patch into target.
+func merge(target, patch any) any {
+	changes, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	doc, ok := target.(map[string]any)
+	if !ok {
+		doc = make(map[string]any)
+	}
+
+	for key, value := range changes {
+		if value == nil {
+			delete(doc, key)
+			continue
+		}
+
+		doc[key] = merge(doc[key], value)
+	}
+
+	return doc
+}
+
+// Resource applies patch to a copy of v, a resource, and returns it.
+func Resource[T any](v T, patch []byte) (T, error) {
+	var patched T
+
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return patched, fmt.Errorf("error encoding resource: %w", err)
+	}
+
+	doc, err = Apply(doc, patch)
+	if err != nil {
+		return patched, err
+	}
+
+	err = json.Unmarshal(doc, &patched)
+	if err != nil {
+		return patched, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	return patched, nil
+}
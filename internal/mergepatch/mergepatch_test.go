@@ -0,0 +1,79 @@
+package mergepatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	// Examples from RFC 7386, appendix A
+	for _, tc := range []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		got, err := Apply([]byte(tc.doc), []byte(tc.patch))
+		if err != nil {
+			t.Errorf("Apply(%s, %s) failed: %v", tc.doc, tc.patch, err)
+			continue
+		}
+
+		if string(got) != tc.want {
+			t.Errorf("Apply(%s, %s) = %s, expected %s", tc.doc, tc.patch, got, tc.want)
+		}
+	}
+
+	_, err := Apply([]byte(`{}`), []byte(`{`))
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an invalid patch, got %v", err)
+	}
+}
+
+func TestResource(t *testing.T) {
+	type resource struct {
+		ID       string            `json:"id"`
+		Name     string            `json:"name"`
+		Days     []string          `json:"days,omitempty"`
+		Settings map[string]string `json:"settings,omitempty"`
+	}
+
+	current := resource{
+		ID:       "nights",
+		Name:     "Nights",
+		Days:     []string{"fri"},
+		Settings: map[string]string{"difficulty": "hard", "gamemode": "survival"},
+	}
+
+	patched, err := Resource(current, []byte(`{"name":"Late nights","days":null,"settings":{"gamemode":null}}`))
+	if err != nil {
+		t.Fatalf("Resource failed: %v", err)
+	}
+
+	want := resource{ID: "nights", Name: "Late nights", Settings: map[string]string{"difficulty": "hard"}}
+	if !reflect.DeepEqual(patched, want) {
+		t.Errorf("Unexpected resource %+v", patched)
+	}
+
+	if current.Name != "Nights" || len(current.Settings) != 2 {
+		t.Errorf("Expected the resource not to change, got %+v", current)
+	}
+
+	_, err = Resource(current, []byte(`{"days":"fri"}`))
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected a patch of the wrong type to be invalid, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+// Package motd validates the two lines a Bedrock server shows in the server
+// list, server-name and level-name, and renders them like the game does.
+package motd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength is the most visible characters of a line. Longer lines are cut
+// off in the server list.
+const MaxLength = 64
+
+// ErrInvalid is returned for lines the server can't use.
+var ErrInvalid = errors.New("invalid MOTD")
+
+// levelNameIllegal are the characters Bedrock doesn't allow in level-name,
+// which is also the name of the world directory.
+const levelNameIllegal = "/\\`?*<>|\":"
+
+// colors maps formatting codes to the colors Bedrock renders them in.
+var colors = map[rune]string{
+	'0': "#000000",
+	'1': "#0000AA",
+	'2': "#00AA00",
+	'3': "#00AAAA",
+	'4': "#AA0000",
+	'5': "#AA00AA",
+	'6': "#FFAA00",
+	'7': "#C6C6C6",
+	'8': "#555555",
+	'9': "#5555FF",
+	'a': "#55FF55",
+	'b': "#55FFFF",
+	'c': "#FF5555",
+	'd': "#FF55FF",
+	'e': "#FFFF55",
+	'f': "#FFFFFF",
+	'g': "#DDD605",
+	'h': "#E3D4D1",
+	'i': "#CECACA",
+	'j': "#443A3B",
+	'm': "#971607",
+	'n': "#B4684D",
+	'p': "#DEB12D",
+	'q': "#47A036",
+	's': "#2CBAA8",
+	't': "#21497B",
+	'u': "#9A5CC6",
+}
+
+// DefaultColor is the color of text without a color code.
+const DefaultColor = "#FFFFFF"
+
+// MOTD is the two lines shown in the server list.
+type MOTD struct {
+	ServerName string `json:"server_name"` // server-name, the first line
+	LevelName  string `json:"level_name"`  // level-name, the second line and the world directory
+}
+
+// Segment is a run of text rendered with the same formatting.
+type Segment struct {
+	Text       string `json:"text"`
+	Color      string `json:"color"` // e.g. "#FFAA00"
+	Bold       bool   `json:"bold,omitempty"`
+	Italic     bool   `json:"italic,omitempty"`
+	Obfuscated bool   `json:"obfuscated,omitempty"`
+}
+
+// Preview is an MOTD rendered like the server list.
+type Preview struct {
+	ServerName []Segment `json:"server_name"`
+	LevelName  []Segment `json:"level_name"`
+}
+
+// Validate checks both lines, returning all problems joined.
+func (m MOTD) Validate() error {
+	var errs []error
+
+	err := validateLine("server-name", m.ServerName)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateLine("level-name", m.LevelName)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if i := strings.IndexAny(m.LevelName, levelNameIllegal); i != -1 {
+		errs = append(errs, fmt.Errorf("%w: level-name can't contain %q", ErrInvalid, m.LevelName[i]))
+	}
+
+	if strings.HasPrefix(m.LevelName, ".") {
+		errs = append(errs, fmt.Errorf("%w: level-name can't start with '.'", ErrInvalid))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Preview renders both lines.
+func (m MOTD) Preview() Preview {
+	return Preview{ServerName: Render(m.ServerName), LevelName: Render(m.LevelName)}
+}
+
+// validateLine checks the characters, formatting codes and length of a line.
+func validateLine(name, line string) error {
+	if strings.TrimSpace(Strip(line)) == "" {
+		return fmt.Errorf("%w: %s is empty", ErrInvalid, name)
+	}
+
+	if !utf8.ValidString(line) {
+		return fmt.Errorf("%w: %s isn't valid UTF-8", ErrInvalid, name)
+	}
+
+	// Semicolons separate the fields of the pong
+	if strings.Contains(line, ";") {
+		return fmt.Errorf("%w: %s can't contain ';'", ErrInvalid, name)
+	}
+
+	runes := []rune(line)
+
+	for i, r := range runes {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w: %s can't contain control characters", ErrInvalid, name)
+		}
+
+		if r == '§' && (i == len(runes)-1 || !validCode(runes[i+1])) {
+			return fmt.Errorf("%w: %s has an invalid formatting code at character %d", ErrInvalid, name, i+1)
+		}
+	}
+
+	if n := utf8.RuneCountInString(Strip(line)); n > MaxLength {
+		return fmt.Errorf("%w: %s is %d characters long, at most %d are shown", ErrInvalid, name, n, MaxLength)
+	}
+
+	return nil
+}
+
+// validCode reports whether c follows '§' in a formatting code.
+func validCode(c rune) bool {
+	_, ok := colors[c]
+
+	return ok || c == 'l' || c == 'o' || c == 'k' || c == 'r'
+}
+
+// Strip removes the formatting codes from a line.
+func Strip(line string) string {
+	var b strings.Builder
+
+	runes := []rune(line)
+
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '§' && i+1 < len(runes) {
+			i++
+			continue
+		}
+
+		b.WriteRune(runes[i])
+	}
+
+	return b.String()
+}
+
+// Render splits a line into segments the way the server list formats it:
+// a color code sets the color, §l, §o and §k add bold, italic and
+// obfuscated, and §r resets both. Unlike Java Edition, a color code keeps
+// the style.
+func Render(line string) []Segment {
+	segments := []Segment{}
+	current := Segment{Color: DefaultColor}
+
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			current.Text = text.String()
+			segments = append(segments, current)
+			text.Reset()
+		}
+	}
+
+	runes := []rune(line)
+
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '§' || i+1 == len(runes) {
+			text.WriteRune(runes[i])
+			continue
+		}
+
+		flush()
+
+		i++
+		code := runes[i]
+
+		switch {
+		case colors[code] != "":
+			current.Color = colors[code]
+		case code == 'l':
+			current.Bold = true
+		case code == 'o':
+			current.Italic = true
+		case code == 'k':
+			current.Obfuscated = true
+		case code == 'r':
+			current = Segment{Color: DefaultColor}
+		}
+	}
+
+	flush()
+
+	return segments
+}
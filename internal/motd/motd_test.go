@@ -0,0 +1,72 @@
+package motd
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		motd  MOTD
+		valid bool
+	}{
+		{"plain", MOTD{"Dedicated Server", "Bedrock level"}, true},
+		{"formatted", MOTD{"§6§lGold §r§aServer", "Survival §7world"}, true},
+		{"empty server name", MOTD{"", "Bedrock level"}, false},
+		{"only codes", MOTD{"§a§l", "Bedrock level"}, false},
+		{"semicolon", MOTD{"One; Two", "Bedrock level"}, false},
+		{"newline", MOTD{"One\nTwo", "Bedrock level"}, false},
+		{"dangling code", MOTD{"Server§", "Bedrock level"}, false},
+		{"unknown code", MOTD{"§xServer", "Bedrock level"}, false},
+		{"slash in level name", MOTD{"Server", "worlds/other"}, false},
+		{"dot level name", MOTD{"Server", ".hidden"}, false},
+		{"too long", MOTD{strings.Repeat("a", MaxLength+1), "Bedrock level"}, false},
+		{"codes don't count", MOTD{strings.Repeat("§aa", MaxLength), "Bedrock level"}, true},
+	}
+
+	for _, tt := range tests {
+		err := tt.motd.Validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+
+		if err != nil && !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestValidate_Joined(t *testing.T) {
+	err := MOTD{"", "a:b"}.Validate()
+	if err == nil || !strings.Contains(err.Error(), "server-name") || !strings.Contains(err.Error(), "level-name") {
+		t.Errorf("Expected problems with both lines, got %v", err)
+	}
+}
+
+func TestStrip(t *testing.T) {
+	if got := Strip("§6§lGold§r Server§"); got != "Gold Server§" {
+		t.Errorf("Strip = %q", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	got := Render("Plain §6Gold §lBold §cRed §rReset")
+	want := []Segment{
+		{Text: "Plain ", Color: DefaultColor},
+		{Text: "Gold ", Color: "#FFAA00"},
+		{Text: "Bold ", Color: "#FFAA00", Bold: true},
+		{Text: "Red ", Color: "#FF5555", Bold: true},
+		{Text: "Reset", Color: DefaultColor},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Render = %+v, want %+v", got, want)
+	}
+
+	if got := Render(""); len(got) != 0 {
+		t.Errorf("Expected no segments, got %+v", got)
+	}
+}
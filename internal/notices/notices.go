@@ -0,0 +1,226 @@
+// Package notices words the messages said in-game before the server
+// restarts or stops, such as the countdown to a scheduled restart. Each
+// kind of notice is a template with placeholders, worded in the wrapper's
+// language unless it is replaced, for the wrapper or for a single
+// scheduled task.
+package notices
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/i18n"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// Kinds of notices.
+const (
+	Restart     = "restart"     // Right before a restart, {reason} says why
+	Countdown   = "countdown"   // The time left before a restart
+	Stop        = "stop"        // Right before the server stops for good
+	Maintenance = "maintenance" // Before restarting into a restored or rolled back world
+)
+
+// Reasons for a restart, which fill {reason} in the wrapper's language.
+// Any other reason is used as is.
+const (
+	ReasonMemory     = "memory"      // Freeing memory
+	ReasonServerName = "server_name" // Applying a new server name
+	ReasonSchedule   = "schedule"    // A scheduled restart
+	ReasonImport     = "import"      // A snapshot import
+	ReasonRollback   = "rollback"    // A rollback
+	ReasonOperator   = "operator"    // A restart requested through the API
+)
+
+var (
+	ErrInvalid = errors.New("invalid notices")
+
+	// Kinds are the kinds of notices.
+	Kinds = []string{Restart, Countdown, Stop, Maintenance}
+
+	// Placeholders are those templates may hold: the time left in whole
+	// minutes, in seconds and in words, the reason and the server-name.
+	Placeholders = []string{"{minutes}", "{seconds}", "{time}", "{reason}", "{server}"}
+
+	placeholderPattern = regexp.MustCompile(`\{[a-z_]+\}`)
+)
+
+// Config words a wrapper's notices.
+type Config struct {
+	Language  string            `json:"language,omitempty"`  // Of the default templates and reasons, English if empty
+	Templates map[string]string `json:"templates,omitempty"` // By kind, replacing the defaults
+}
+
+// Values fill the placeholders of a notice.
+type Values struct {
+	Left   time.Duration // Until the restart, for {minutes}, {seconds} and {time}
+	Reason string        // One of the reasons, or one of its own
+	Server string        // server-name
+}
+
+// ValidateTemplate checks a template: a single line, since a line break
+// would end the say command early and run the rest as another command,
+// holding only known placeholders.
+func ValidateTemplate(template string) error {
+	if strings.ContainsAny(template, "\r\n") {
+		return fmt.Errorf("%w: templates must be single lines", ErrInvalid)
+	}
+
+	for _, p := range placeholderPattern.FindAllString(template, -1) {
+		if !slices.Contains(Placeholders, p) {
+			return fmt.Errorf("%w: unknown placeholder %s, expected one of %s", ErrInvalid, p, strings.Join(Placeholders, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Validate checks a config.
+func (c Config) Validate() error {
+	if c.Language != "" && !i18n.Supported(c.Language) {
+		return fmt.Errorf("%w: unsupported language %q, expected one of %s", ErrInvalid, c.Language,
+			strings.Join(i18n.Languages, ", "))
+	}
+
+	for kind, template := range c.Templates {
+		if !slices.Contains(Kinds, kind) {
+			return fmt.Errorf("%w: unknown notice %q, expected one of %s", ErrInvalid, kind, strings.Join(Kinds, ", "))
+		}
+
+		err := ValidateTemplate(template)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// language returns the language notices are worded in.
+func (c Config) language() string {
+	if c.Language == "" {
+		return i18n.Default
+	}
+
+	return c.Language
+}
+
+// Defaults returns the default template of each kind in the config's
+// language.
+func (c Config) Defaults() map[string]string {
+	defaults := make(map[string]string, len(Kinds))
+	for _, kind := range Kinds {
+		defaults[kind] = i18n.T(c.language(), "notice."+kind)
+	}
+
+	return defaults
+}
+
+// Render returns the notice of a kind filled in with v: from override, such
+// as a scheduled task's own wording, if set, otherwise the configured
+// template or the default.
+func (c Config) Render(kind, override string, v Values) string {
+	lang := c.language()
+
+	template := override
+	if template == "" {
+		template = c.Templates[kind]
+	}
+
+	if template == "" {
+		template = i18n.T(lang, "notice."+kind)
+	}
+
+	reason := v.Reason
+	if key := "notice.reason." + reason; reason != "" && i18n.T(lang, key) != key {
+		reason = i18n.T(lang, key)
+	}
+
+	seconds := int(v.Left.Round(time.Second) / time.Second)
+
+	return strings.NewReplacer(
+		"{minutes}", strconv.Itoa((seconds+30)/60),
+		"{seconds}", strconv.Itoa(seconds),
+		"{time}", timeLeft(lang, seconds),
+		"{reason}", reason,
+		"{server}", v.Server,
+	).Replace(template)
+}
+
+// timeLeft words a time left in lang: in minutes from a minute on,
+// otherwise in seconds.
+func timeLeft(lang string, seconds int) string {
+	key, n := "notice.seconds", seconds
+	if seconds >= 60 {
+		key, n = "notice.minutes", (seconds+30)/60
+	}
+
+	if n == 1 {
+		key = strings.TrimSuffix(key, "s")
+	}
+
+	return strings.ReplaceAll(i18n.T(lang, key), "{n}", strconv.Itoa(n))
+}
+
+// Store keeps a wrapper's notices config in a JSON file.
+type Store struct {
+	mu     sync.Mutex
+	path   string
+	config Config
+}
+
+// Open loads the config saved at path, which may not exist yet.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+
+	err := jsonfile.Load(path, &s.config)
+	if err != nil {
+		return nil, fmt.Errorf("error loading notices: %w", err)
+	}
+
+	return s, nil
+}
+
+// Config returns the config.
+func (s *Store) Config() Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.config
+}
+
+// Render returns a notice worded with the config, see Config.Render, or
+// with the defaults in English if s is nil.
+func (s *Store) Render(kind, override string, v Values) string {
+	if s == nil {
+		return Config{}.Render(kind, override, v)
+	}
+
+	return s.Config().Render(kind, override, v)
+}
+
+// Set validates and saves a config.
+func (s *Store) Set(config Config) (Config, error) {
+	err := config.Validate()
+	if err != nil {
+		return Config{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = jsonfile.Save(s.path, config)
+	if err != nil {
+		return Config{}, fmt.Errorf("error saving notices: %w", err)
+	}
+
+	s.config = config
+
+	return config, nil
+}
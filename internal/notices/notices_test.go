@@ -0,0 +1,93 @@
+package notices
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	for _, c := range []Config{
+		{Language: "xx"},
+		{Templates: map[string]string{"reboot": "Rebooting"}},
+		{Templates: map[string]string{Countdown: "Restart in {time}\nstop"}},
+		{Templates: map[string]string{Countdown: "Restart in {hours}"}},
+	} {
+		err := c.Validate()
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", c, err)
+		}
+	}
+
+	c := Config{Language: "de", Templates: map[string]string{Countdown: "{server} restarts in {minutes} min"}}
+
+	err := c.Validate()
+	if err != nil {
+		t.Errorf("Expected a valid config, got %v", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	for _, c := range []struct {
+		config   Config
+		kind     string
+		override string
+		v        Values
+		want     string
+	}{
+		{Config{}, Countdown, "", Values{Left: 5 * time.Minute}, "Server restarting in 5 minutes"},
+		{Config{}, Countdown, "", Values{Left: time.Second}, "Server restarting in 1 second"},
+		{Config{Language: "de"}, Countdown, "", Values{Left: 30 * time.Second}, "Server startet in 30 Sekunden neu"},
+		{Config{}, Restart, "", Values{Reason: ReasonMemory}, "Server restarting (to free memory), the world is being saved"},
+		{
+			Config{}, Restart, "", Values{Reason: "a custom reason"},
+			"Server restarting (a custom reason), the world is being saved",
+		},
+		{
+			Config{Templates: map[string]string{Countdown: "{server}: {minutes} min ({seconds}s) left"}},
+			Countdown, "", Values{Left: 90 * time.Second, Server: "Survival"}, "Survival: 2 min (90s) left",
+		},
+		{
+			Config{Templates: map[string]string{Countdown: "Configured"}},
+			Countdown, "Nightly restart in {time}", Values{Left: time.Minute}, "Nightly restart in 1 minute",
+		},
+	} {
+		if got := c.config.Render(c.kind, c.override, c.v); got != c.want {
+			t.Errorf("Render(%s, %q) = %q, want %q", c.kind, c.override, got, c.want)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notices.json")
+
+	var missing *Store
+	if got := missing.Render(Stop, "", Values{}); got != "Server stopping, the world is being saved" {
+		t.Errorf("Expected the English default without a store, got %q", got)
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	_, err = s.Set(Config{Language: "xx"})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an invalid config to be rejected, got %v", err)
+	}
+
+	_, err = s.Set(Config{Language: "es"})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	if got := s.Render(Countdown, "", Values{Left: 10 * time.Minute}); got != "El servidor se reinicia en 10 minutos" {
+		t.Errorf("Expected the saved language, got %q", got)
+	}
+}
@@ -0,0 +1,383 @@
+// Package notify delivers alerts to notification channels, holding back
+// those below a severity during quiet hours and batching some severities
+// into periodic digests, so flapping connections don't wake anyone while
+// crashes still get through right away.
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severities of notifications, from lowest to highest.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Severities lists the severities from lowest to highest.
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+var ErrInvalid = errors.New("invalid notification channel")
+
+// days are the names of the days of the week in QuietHours.Days.
+var days = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Notification is an alert about the fleet or one of its wrappers.
+type Notification struct {
+	Time     time.Time `json:"time"`
+	Severity string    `json:"severity"`
+	Wrapper  string    `json:"wrapper,omitempty"` // Name, empty for the central server
+	Text     string    `json:"text"`
+}
+
+// QuietHours is when a channel holds back notifications below a severity,
+// in the timezone of its channel. An end at or before the start is on the
+// next day.
+type QuietHours struct {
+	Days  []string // sun..sat, the day quiet hours start; every day if empty
+	Start string   // HH:MM
+	End   string   // HH:MM
+	Allow string   // Lowest severity still delivered right away, SeverityCritical if empty
+}
+
+// Channel is where notifications are delivered.
+type Channel struct {
+	Name        string
+	URL         string            // Webhook POSTed each Message
+	Headers     map[string]string // e.g. Authorization
+	MinSeverity string            // Lower severities are dropped, none if empty
+	Quiet       *QuietHours
+	Location    *time.Location // Timezone of quiet hours, time.Local if nil
+
+	// Digest batches the notifications of a severity into one message per
+	// period, by severity. Severities without a period are sent right away.
+	Digest map[string]time.Duration
+}
+
+// Validate checks a channel.
+func (c Channel) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("%w: no name", ErrInvalid)
+	}
+
+	if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+		return fmt.Errorf("%w: %s: the URL must be http or https", ErrInvalid, c.Name)
+	}
+
+	if c.MinSeverity != "" && rank(c.MinSeverity) < 0 {
+		return fmt.Errorf("%w: %s: unknown severity %q", ErrInvalid, c.Name, c.MinSeverity)
+	}
+
+	for severity, period := range c.Digest {
+		if rank(severity) < 0 {
+			return fmt.Errorf("%w: %s: unknown severity %q", ErrInvalid, c.Name, severity)
+		}
+
+		if period < 0 {
+			return fmt.Errorf("%w: %s: negative digest period", ErrInvalid, c.Name)
+		}
+	}
+
+	if c.Quiet == nil {
+		return nil
+	}
+
+	for _, day := range c.Quiet.Days {
+		if dayIndex(day) < 0 {
+			return fmt.Errorf("%w: %s: unknown day %q", ErrInvalid, c.Name, day)
+		}
+	}
+
+	for _, t := range []string{c.Quiet.Start, c.Quiet.End} {
+		_, err := time.Parse("15:04", t)
+		if err != nil {
+			return fmt.Errorf("%w: %s: quiet hours time %q isn't HH:MM", ErrInvalid, c.Name, t)
+		}
+	}
+
+	if c.Quiet.Allow != "" && rank(c.Quiet.Allow) < 0 {
+		return fmt.Errorf("%w: %s: unknown severity %q", ErrInvalid, c.Name, c.Quiet.Allow)
+	}
+
+	return nil
+}
+
+// quiet reports whether t falls in the channel's quiet hours.
+func (c Channel) quiet(t time.Time) bool {
+	if c.Quiet == nil {
+		return false
+	}
+
+	loc := c.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	t = t.In(loc)
+
+	start, _ := time.Parse("15:04", c.Quiet.Start)
+	end, _ := time.Parse("15:04", c.Quiet.End)
+
+	length := end.Sub(start)
+	if length <= 0 {
+		length += 24 * time.Hour
+	}
+
+	// Quiet hours containing t started today or, past midnight, yesterday
+	for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+		from := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+
+		if onDay(c.Quiet.Days, from.Weekday()) && !t.Before(from) && t.Before(from.Add(length)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// held reports whether a notification is held back at t rather than sent
+// right away.
+func (c Channel) held(n Notification, t time.Time) bool {
+	if c.Digest[n.Severity] > 0 {
+		return true
+	}
+
+	allow := SeverityCritical
+	if c.Quiet != nil && c.Quiet.Allow != "" {
+		allow = c.Quiet.Allow
+	}
+
+	return rank(n.Severity) < rank(allow) && c.quiet(t)
+}
+
+// Message is what a channel is sent: a single notification, or a digest of
+// those held back.
+type Message struct {
+	Channel       string         `json:"channel"`
+	Digest        bool           `json:"digest"`
+	Text          string         `json:"text"` // Summary for chat webhooks
+	Notifications []Notification `json:"notifications"`
+}
+
+// pending is a notification held back, and when it is due.
+type pending struct {
+	Notification
+	due time.Time
+}
+
+// Notifier works out what to send to each channel and when.
+type Notifier struct {
+	channels []Channel
+
+	mu      sync.Mutex
+	pending map[string][]pending // By channel name
+}
+
+// New returns a notifier for channels.
+func New(channels []Channel) (*Notifier, error) {
+	names := make(map[string]bool, len(channels))
+
+	for _, c := range channels {
+		err := c.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		if names[c.Name] {
+			return nil, fmt.Errorf("%w: duplicate channel %q", ErrInvalid, c.Name)
+		}
+
+		names[c.Name] = true
+	}
+
+	return &Notifier{channels: channels, pending: make(map[string][]pending)}, nil
+}
+
+// Channels returns the channels.
+func (n *Notifier) Channels() []Channel {
+	return n.channels
+}
+
+// Notify returns the messages to send right away for a notification, and
+// holds it back for the channels that batch its severity or are in quiet
+// hours.
+func (n *Notifier) Notify(notification Notification) []Message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var messages []Message
+
+	for _, c := range n.channels {
+		if rank(notification.Severity) < rank(c.MinSeverity) {
+			continue
+		}
+
+		if !c.held(notification, notification.Time) {
+			messages = append(messages, Message{
+				Channel:       c.Name,
+				Text:          line(notification),
+				Notifications: []Notification{notification},
+			})
+
+			continue
+		}
+
+		// Notifications held for quiet hours only are due when they end
+		due := notification.Time.Add(c.Digest[notification.Severity])
+		n.pending[c.Name] = append(n.pending[c.Name], pending{notification, due})
+	}
+
+	return messages
+}
+
+// Due returns the digests due at now: the notifications held back by each
+// channel outside quiet hours, once the first of them is due.
+func (n *Notifier) Due(now time.Time) []Message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var messages []Message
+
+	for _, c := range n.channels {
+		held := n.pending[c.Name]
+		if len(held) == 0 || c.quiet(now) {
+			continue
+		}
+
+		due := false
+
+		for _, p := range held {
+			if !now.Before(p.due) {
+				due = true
+				break
+			}
+		}
+
+		if !due {
+			continue
+		}
+
+		notifications := make([]Notification, 0, len(held))
+		for _, p := range held {
+			notifications = append(notifications, p.Notification)
+		}
+
+		sort.SliceStable(notifications, func(i, j int) bool {
+			return notifications[i].Time.Before(notifications[j].Time)
+		})
+
+		messages = append(messages, Message{
+			Channel:       c.Name,
+			Digest:        true,
+			Text:          digestText(notifications),
+			Notifications: notifications,
+		})
+
+		delete(n.pending, c.Name)
+	}
+
+	return messages
+}
+
+// ChannelStatus is the state of a channel.
+type ChannelStatus struct {
+	Name    string `json:"name"`
+	Quiet   bool   `json:"quiet"`   // In quiet hours
+	Pending int    `json:"pending"` // Notifications held back for the next digest
+}
+
+// Status returns the state of the channels at now.
+func (n *Notifier) Status(now time.Time) []ChannelStatus {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	status := make([]ChannelStatus, 0, len(n.channels))
+	for _, c := range n.channels {
+		status = append(status, ChannelStatus{Name: c.Name, Quiet: c.quiet(now), Pending: len(n.pending[c.Name])})
+	}
+
+	return status
+}
+
+// line formats a notification as a line of text.
+func line(n Notification) string {
+	if n.Wrapper == "" {
+		return fmt.Sprintf("[%s] %s", n.Severity, n.Text)
+	}
+
+	return fmt.Sprintf("[%s] %s: %s", n.Severity, n.Wrapper, n.Text)
+}
+
+// digestText summarizes notifications, counting them by severity before
+// listing them.
+func digestText(notifications []Notification) string {
+	counts := make(map[string]int)
+	for _, n := range notifications {
+		counts[n.Severity]++
+	}
+
+	var parts []string
+
+	for i := len(Severities) - 1; i >= 0; i-- {
+		if c := counts[Severities[i]]; c > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c, Severities[i]))
+		}
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Digest of %d notification(s): %s", len(notifications), strings.Join(parts, ", "))
+
+	for _, n := range notifications {
+		fmt.Fprintf(&b, "\n%s %s", n.Time.UTC().Format(time.RFC3339), line(n))
+	}
+
+	return b.String()
+}
+
+// rank returns the position of a severity from lowest to highest, -1 if
+// it's unknown. The empty severity ranks lowest.
+func rank(severity string) int {
+	if severity == "" {
+		return 0
+	}
+
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// onDay reports whether quiet hours start on a day.
+func onDay(list []string, day time.Weekday) bool {
+	if len(list) == 0 {
+		return true
+	}
+
+	for _, d := range list {
+		if dayIndex(d) == int(day) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func dayIndex(day string) int {
+	for i, d := range days {
+		if strings.EqualFold(d, day) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	invalid := []Channel{
+		{URL: "https://example.com"},
+		{Name: "phone", URL: "ftp://example.com"},
+		{Name: "phone", URL: "https://example.com", MinSeverity: "loud"},
+		{Name: "phone", URL: "https://example.com", Digest: map[string]time.Duration{"loud": time.Hour}},
+		{Name: "phone", URL: "https://example.com", Digest: map[string]time.Duration{SeverityInfo: -time.Hour}},
+		{Name: "phone", URL: "https://example.com", Quiet: &QuietHours{Start: "23", End: "07:00"}},
+		{
+			Name:  "phone",
+			URL:   "https://example.com",
+			Quiet: &QuietHours{Days: []string{"someday"}, Start: "23:00", End: "07:00"},
+		},
+		{Name: "phone", URL: "https://example.com", Quiet: &QuietHours{Start: "23:00", End: "07:00", Allow: "loud"}},
+	}
+
+	for _, c := range invalid {
+		err := c.Validate()
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", c, err)
+		}
+	}
+
+	channel := Channel{Name: "phone", URL: "https://example.com"}
+
+	_, err := New([]Channel{channel, channel})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected duplicate channels to be refused, got %v", err)
+	}
+}
+
+func TestNotify_QuietHours(t *testing.T) {
+	n, err := New([]Channel{{
+		Name:     "phone",
+		URL:      "https://example.com",
+		Quiet:    &QuietHours{Start: "23:00", End: "07:00"},
+		Location: time.UTC,
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	night := time.Date(2026, 5, 2, 3, 0, 0, 0, time.UTC)
+
+	if msgs := n.Notify(Notification{Time: night, Severity: SeverityWarning, Wrapper: "survival",
+		Text: "connection lost"}); len(msgs) != 0 {
+		t.Errorf("Expected warnings to be held during quiet hours, got %+v", msgs)
+	}
+
+	msgs := n.Notify(Notification{Time: night, Severity: SeverityCritical, Wrapper: "survival", Text: "server crashed"})
+	if len(msgs) != 1 || msgs[0].Digest || msgs[0].Text != "[critical] survival: server crashed" {
+		t.Errorf("Expected critical notifications to be sent right away, got %+v", msgs)
+	}
+
+	if msgs := n.Due(night.Add(time.Hour)); len(msgs) != 0 {
+		t.Errorf("Expected nothing to be sent during quiet hours, got %+v", msgs)
+	}
+
+	msgs = n.Due(time.Date(2026, 5, 2, 7, 0, 0, 0, time.UTC))
+	if len(msgs) != 1 || !msgs[0].Digest || len(msgs[0].Notifications) != 1 {
+		t.Fatalf("Expected a digest when quiet hours end, got %+v", msgs)
+	}
+
+	if status := n.Status(night); !status[0].Quiet || status[0].Pending != 0 {
+		t.Errorf("Expected a quiet channel emptied by the digest, got %+v", status)
+	}
+}
+
+func TestNotify_Digest(t *testing.T) {
+	n, err := New([]Channel{{
+		Name:        "chat",
+		URL:         "https://example.com",
+		MinSeverity: SeverityWarning,
+		Digest:      map[string]time.Duration{SeverityWarning: time.Hour},
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	start := time.Date(2026, 5, 2, 12, 0, 0, 0, time.UTC)
+
+	if msgs := n.Notify(Notification{Time: start, Severity: SeverityInfo, Text: "connection restored"}); len(msgs) != 0 {
+		t.Errorf("Expected info to be dropped below the minimum severity, got %+v", msgs)
+	}
+
+	for i := 0; i < 3; i++ {
+		if msgs := n.Notify(Notification{Time: start.Add(time.Duration(i) * 10 * time.Minute), Severity: SeverityWarning,
+			Text: "connection lost"}); len(msgs) != 0 {
+			t.Errorf("Expected warnings to be batched, got %+v", msgs)
+		}
+	}
+
+	if msgs := n.Due(start.Add(59 * time.Minute)); len(msgs) != 0 {
+		t.Errorf("Expected no digest before the period, got %+v", msgs)
+	}
+
+	msgs := n.Due(start.Add(time.Hour))
+	if len(msgs) != 1 || len(msgs[0].Notifications) != 3 {
+		t.Fatalf("Expected one digest of 3 notifications, got %+v", msgs)
+	}
+
+	if !strings.HasPrefix(msgs[0].Text, "Digest of 3 notification(s): 3 warning") {
+		t.Errorf("Unexpected digest text %q", msgs[0].Text)
+	}
+
+	if msgs := n.Notify(Notification{Time: start, Severity: SeverityCritical, Text: "server crashed"}); len(msgs) != 1 {
+		t.Errorf("Expected critical notifications to be sent right away, got %+v", msgs)
+	}
+}
+
+func TestSend(t *testing.T) {
+	var got Message
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+
+		_ = json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer ts.Close()
+
+	c := Channel{Name: "chat", URL: ts.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}
+	msg := Message{Channel: "chat", Text: "[critical] server crashed"}
+
+	err := c.Send(context.Background(), nil, msg)
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if got.Text != msg.Text {
+		t.Errorf("Expected %q to be posted, got %q", msg.Text, got.Text)
+	}
+
+	c.Headers = nil
+
+	err = c.Send(context.Background(), nil, msg)
+	if err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Expected the webhook error, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+// Package operators keeps the fleet's canonical list of player permissions
+// and compares it with the permissions.json of each server, so operator
+// grants nobody remembers making are caught.
+package operators
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// File is the permissions file of bedrock_server in its app directory.
+const File = "permissions.json"
+
+// Permission levels of permissions.json.
+const (
+	PermissionVisitor  = "visitor"
+	PermissionMember   = "member"
+	PermissionOperator = "operator"
+)
+
+var ErrInvalid = errors.New("invalid operator list")
+
+// Entry is an entry of permissions.json.
+type Entry struct {
+	Permission string `json:"permission"`
+	XUID       string `json:"xuid"`
+}
+
+// Operator is a player's permission on the servers of the fleet.
+type Operator struct {
+	XUID       string   `json:"xuid"`
+	Name       string   `json:"name,omitempty"`   // Who the XUID belongs to, for people reading the list
+	Permission string   `json:"permission"`       // Operator if empty
+	Groups     []string `json:"groups,omitempty"` // Only servers in these groups, all if empty
+}
+
+// Validate checks a list, filling in the default permission.
+func Validate(ops []Operator) error {
+	seen := map[string]bool{}
+
+	for i := range ops {
+		op := &ops[i]
+		op.XUID = strings.TrimSpace(op.XUID)
+
+		if op.Permission == "" {
+			op.Permission = PermissionOperator
+		}
+
+		if op.XUID == "" || strings.Trim(op.XUID, "0123456789") != "" {
+			return fmt.Errorf("%w: XUIDs must be numbers, got %q", ErrInvalid, op.XUID)
+		}
+
+		switch op.Permission {
+		case PermissionVisitor, PermissionMember, PermissionOperator:
+		default:
+			return fmt.Errorf("%w: unknown permission %q for %s", ErrInvalid, op.Permission, op.XUID)
+		}
+
+		if seen[op.XUID] {
+			return fmt.Errorf("%w: %s is listed twice", ErrInvalid, op.XUID)
+		}
+
+		seen[op.XUID] = true
+	}
+
+	return nil
+}
+
+// Wanted returns the permissions.json entries of a server in the given
+// groups, sorted by XUID.
+func Wanted(ops []Operator, groups []string) []Entry {
+	entries := []Entry{}
+
+	for _, op := range ops {
+		if len(op.Groups) > 0 && !slices.ContainsFunc(op.Groups, func(g string) bool { return slices.Contains(groups, g) }) {
+			continue
+		}
+
+		entries = append(entries, Entry{Permission: op.Permission, XUID: op.XUID})
+	}
+
+	sortEntries(entries)
+
+	return entries
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].XUID < entries[j].XUID
+	})
+}
+
+// Diff is how a server's permissions.json drifted from the wanted one.
+type Diff struct {
+	Added   []Entry `json:"added,omitempty"`   // Granted on the server only
+	Missing []Entry `json:"missing,omitempty"` // Wanted, but not on the server
+	Changed []Entry `json:"changed,omitempty"` // Another permission on the server, as it is there
+}
+
+// Empty reports whether there is no drift.
+func (d Diff) Empty() bool {
+	return len(d.Added)+len(d.Missing)+len(d.Changed) == 0
+}
+
+// Compare returns how current drifted from wanted.
+func Compare(current, wanted []Entry) Diff {
+	var diff Diff
+
+	want := map[string]Entry{}
+	for _, e := range wanted {
+		want[e.XUID] = e
+	}
+
+	have := map[string]bool{}
+
+	for _, e := range current {
+		have[e.XUID] = true
+
+		w, ok := want[e.XUID]
+
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, e)
+		case w.Permission != e.Permission:
+			diff.Changed = append(diff.Changed, e)
+		}
+	}
+
+	for _, e := range wanted {
+		if !have[e.XUID] {
+			diff.Missing = append(diff.Missing, e)
+		}
+	}
+
+	sortEntries(diff.Added)
+	sortEntries(diff.Missing)
+	sortEntries(diff.Changed)
+
+	return diff
+}
+
+// String describes the drift in one line, e.g. "2 extra, 1 missing".
+func (d Diff) String() string {
+	var parts []string
+
+	for _, p := range []struct {
+		n    int
+		what string
+	}{
+		{len(d.Added), "extra"},
+		{len(d.Missing), "missing"},
+		{len(d.Changed), "changed"},
+	} {
+		if p.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", p.n, p.what))
+		}
+	}
+
+	if len(parts) == 0 {
+		return "in sync"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Parse reads a permissions.json. An empty file has no entries.
+func Parse(data []byte) ([]Entry, error) {
+	var entries []Entry
+
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return entries, nil
+	}
+
+	err := json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing permissions: %w", err)
+	}
+
+	return entries, nil
+}
+
+// Store keeps the operator list in a JSON file.
+type Store struct {
+	path string
+	mu   sync.Mutex
+	ops  []Operator
+}
+
+// Open loads the store at path, starting empty if it doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, ops: []Operator{}}
+
+	err := jsonfile.Load(path, &s.ops)
+	if err != nil {
+		return nil, fmt.Errorf("error loading operators: %w", err)
+	}
+
+	return s, nil
+}
+
+// List returns the operators.
+func (s *Store) List() []Operator {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.ops)
+}
+
+// Replace validates and saves a new operator list, sorted by XUID.
+func (s *Store) Replace(ops []Operator) ([]Operator, error) {
+	ops = slices.Clone(ops)
+
+	err := Validate(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	if ops == nil {
+		ops = []Operator{}
+	}
+
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].XUID < ops[j].XUID
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = jsonfile.Save(s.path, ops)
+	if err != nil {
+		return nil, fmt.Errorf("error saving operators: %w", err)
+	}
+
+	s.ops = ops
+
+	return slices.Clone(ops), nil
+}
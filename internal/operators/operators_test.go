@@ -0,0 +1,116 @@
+package operators
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	ops := []Operator{{XUID: " 1 "}, {XUID: "2", Permission: PermissionMember}}
+
+	err := Validate(ops)
+	if err != nil || ops[0].XUID != "1" || ops[0].Permission != PermissionOperator {
+		t.Fatalf("Expected a valid list with defaults, got %v, %+v", err, ops)
+	}
+
+	for _, ops := range [][]Operator{
+		{{XUID: ""}},
+		{{XUID: "Steve"}},
+		{{XUID: "1", Permission: "owner"}},
+		{{XUID: "1"}, {XUID: "1"}},
+	} {
+		err := Validate(ops)
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", ops, err)
+		}
+	}
+}
+
+func TestWanted(t *testing.T) {
+	ops := []Operator{
+		{XUID: "3", Permission: PermissionOperator},
+		{XUID: "1", Permission: PermissionOperator, Groups: []string{"test"}},
+		{XUID: "2", Permission: PermissionMember, Groups: []string{"survival", "creative"}},
+	}
+
+	got := Wanted(ops, []string{"survival"})
+	want := []Entry{{Permission: PermissionMember, XUID: "2"}, {Permission: PermissionOperator, XUID: "3"}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wanted() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	current := []Entry{
+		{Permission: PermissionOperator, XUID: "9"}, {Permission: PermissionOperator, XUID: "2"},
+		{Permission: PermissionOperator, XUID: "3"},
+	}
+	wanted := []Entry{
+		{Permission: PermissionMember, XUID: "2"}, {Permission: PermissionOperator, XUID: "3"},
+		{Permission: PermissionOperator, XUID: "4"},
+	}
+
+	diff := Compare(current, wanted)
+
+	want := Diff{
+		Added:   []Entry{{Permission: PermissionOperator, XUID: "9"}},
+		Missing: []Entry{{Permission: PermissionOperator, XUID: "4"}},
+		Changed: []Entry{{Permission: PermissionOperator, XUID: "2"}},
+	}
+
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("Compare() = %+v, want %+v", diff, want)
+	}
+
+	if s := diff.String(); s != "1 extra, 1 missing, 1 changed" {
+		t.Errorf("Unexpected description %q", s)
+	}
+
+	if diff := Compare(wanted, wanted); !diff.Empty() || diff.String() != "in sync" {
+		t.Errorf("Expected no drift, got %+v", diff)
+	}
+}
+
+func TestParse(t *testing.T) {
+	entries, err := Parse([]byte(`[{"permission": "operator", "xuid": "1"}]`))
+	if err != nil || !reflect.DeepEqual(entries, []Entry{{Permission: PermissionOperator, XUID: "1"}}) {
+		t.Errorf("Unexpected entries %+v, %v", entries, err)
+	}
+
+	entries, err = Parse(nil)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Expected no entries, got %+v, %v", entries, err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "operators.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	_, err = store.Replace([]Operator{{XUID: "x"}})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an invalid list to be refused, got %v", err)
+	}
+
+	_, err = store.Replace([]Operator{{XUID: "2", Name: "Alex"}, {XUID: "1", Name: "Steve"}})
+	if err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	ops := store.List()
+	if len(ops) != 2 || ops[0].Name != "Steve" || ops[1].Permission != PermissionOperator {
+		t.Errorf("Expected the sorted list to be saved, got %+v", ops)
+	}
+}
@@ -0,0 +1,155 @@
+// Package oplock keeps operations that must not overlap, such as a backup
+// during an upgrade or two restores at once, from running on a server
+// instance at the same time.
+package oplock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Operations that take the lock.
+const (
+	Backup      = "backup"       // Snapshot of the worlds and configuration
+	Restore     = "restore"      // Snapshot import
+	Upgrade     = "upgrade"      // Wrapper self-update
+	Restart     = "restart"      // Wrapper restart in place
+	WorldCreate = "world-create" // New world from a template
+	Delete      = "delete"       // World or pack removal, or putting one back from the trash
+	Stop        = "stop"         // Graceful shutdown of bedrock_server
+	Reboot      = "reboot"       // Restart of bedrock_server, leaving the wrapper up
+)
+
+// ErrBusy is returned when another operation holds the lock.
+var ErrBusy = errors.New("another operation is in progress")
+
+// Holder is an operation holding or waiting for the lock.
+type Holder struct {
+	Operation string    `json:"operation"`
+	Actor     string    `json:"actor,omitempty"`
+	Since     time.Time `json:"since"` // When it took the lock, or started waiting
+}
+
+// Status is the holder of the lock and the operations queued for it.
+type Status struct {
+	Holder *Holder  `json:"holder"` // nil when the lock is free
+	Queued []Holder `json:"queued"`
+}
+
+// Lock is held by one operation at a time. Others either wait their turn
+// or are rejected.
+type Lock struct {
+	mu       sync.Mutex
+	holder   *Holder
+	queued   []*Holder
+	released chan struct{} // Closed when the holder releases the lock
+}
+
+// Acquire takes the lock for an operation. If another operation holds it,
+// Acquire waits for it with wait, until ctx is done, and otherwise fails
+// with ErrBusy naming the holder. The returned function releases the lock.
+func (l *Lock) Acquire(ctx context.Context, operation, actor string, wait bool) (func(), error) {
+	h := &Holder{Operation: operation, Actor: actor, Since: time.Now().UTC()}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.holder != nil {
+		if !wait {
+			return nil, busy(*l.holder)
+		}
+
+		released := l.released
+		l.enqueue(h)
+
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+		}
+
+		l.mu.Lock()
+
+		if ctx.Err() != nil {
+			l.dequeue(h)
+
+			if l.holder == nil {
+				return nil, ctx.Err()
+			}
+
+			return nil, fmt.Errorf("%w while waiting: %w", ctx.Err(), busy(*l.holder))
+		}
+	}
+
+	l.dequeue(h)
+
+	h.Since = time.Now().UTC()
+	l.holder = h
+	l.released = make(chan struct{})
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.holder = nil
+			close(l.released)
+		})
+	}, nil
+}
+
+// Status returns the holder of the lock and the operations waiting for it,
+// longest waiting first.
+func (l *Lock) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := Status{Queued: []Holder{}}
+
+	if l.holder != nil {
+		holder := *l.holder
+		status.Holder = &holder
+	}
+
+	for _, h := range l.queued {
+		status.Queued = append(status.Queued, *h)
+	}
+
+	return status
+}
+
+// enqueue adds a waiting operation, under the lock.
+func (l *Lock) enqueue(h *Holder) {
+	for _, q := range l.queued {
+		if q == h {
+			return
+		}
+	}
+
+	l.queued = append(l.queued, h)
+}
+
+// dequeue removes a waiting operation, under the lock.
+func (l *Lock) dequeue(h *Holder) {
+	for i, q := range l.queued {
+		if q == h {
+			l.queued = append(l.queued[:i], l.queued[i+1:]...)
+			return
+		}
+	}
+}
+
+// busy returns an ErrBusy naming the holder.
+func busy(h Holder) error {
+	if h.Actor == "" {
+		return fmt.Errorf("%w: %s since %s", ErrBusy, h.Operation, h.Since.Format(time.RFC3339))
+	}
+
+	return fmt.Errorf("%w: %s by %s since %s", ErrBusy, h.Operation, h.Actor, h.Since.Format(time.RFC3339))
+}
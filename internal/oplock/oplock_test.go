@@ -0,0 +1,117 @@
+package oplock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLock_Reject(t *testing.T) {
+	var l Lock
+
+	release, err := l.Acquire(context.Background(), Upgrade, "alice", false)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	_, err = l.Acquire(context.Background(), Backup, "bob", false)
+	if !errors.Is(err, ErrBusy) {
+		t.Fatalf("Expected ErrBusy, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "upgrade by alice") {
+		t.Errorf("Expected the error to name the holder, got %q", err)
+	}
+
+	status := l.Status()
+	if status.Holder == nil || status.Holder.Operation != Upgrade {
+		t.Errorf("Expected the upgrade to hold the lock, got %+v", status.Holder)
+	}
+
+	release()
+	release() // Releasing twice is harmless
+
+	if l.Status().Holder != nil {
+		t.Error("Expected the lock to be free")
+	}
+
+	release, err = l.Acquire(context.Background(), Backup, "bob", false)
+	if err != nil {
+		t.Fatalf("Acquire after release failed: %v", err)
+	}
+
+	release()
+}
+
+func TestLock_Queue(t *testing.T) {
+	var l Lock
+
+	release, err := l.Acquire(context.Background(), Restore, "alice", false)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	acquired := make(chan error, 1)
+
+	go func() {
+		release, err := l.Acquire(context.Background(), Restart, "bob", true)
+		if err == nil {
+			release()
+		}
+
+		acquired <- err
+	}()
+
+	// Wait for the restart to queue
+	deadline := time.Now().Add(5 * time.Second)
+	for len(l.Status().Queued) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Restart wasn't queued")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if queued := l.Status().Queued[0]; queued.Operation != Restart || queued.Actor != "bob" {
+		t.Errorf("Unexpected queued operation %+v", queued)
+	}
+
+	release()
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("Queued Acquire failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Queued operation didn't get the lock")
+	}
+
+	if len(l.Status().Queued) != 0 {
+		t.Error("Expected the queue to be empty")
+	}
+}
+
+func TestLock_QueueCancelled(t *testing.T) {
+	var l Lock
+
+	release, err := l.Acquire(context.Background(), Backup, "", false)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = l.Acquire(ctx, Restore, "", true)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrBusy) {
+		t.Errorf("Expected a deadline error naming the holder, got %v", err)
+	}
+
+	if len(l.Status().Queued) != 0 {
+		t.Error("Expected the cancelled operation to leave the queue")
+	}
+}
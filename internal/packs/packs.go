@@ -0,0 +1,324 @@
+// Package packs scans the behavior and resource pack directories of a Bedrock
+// server and keeps a world's pack lists in sync with them.
+package packs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	KindBehavior = "behavior"
+	KindResource = "resource"
+)
+
+// Pack is an installed behavior or resource pack.
+type Pack struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	UUID    string `json:"uuid"`
+	Version [3]int `json:"version"`
+	Dir     string `json:"dir"` // Directory name under the packs directory
+}
+
+// WorldPack is an entry of a world's world_behavior_packs.json or
+// world_resource_packs.json file.
+type WorldPack struct {
+	PackID  string `json:"pack_id"`
+	Version [3]int `json:"version"`
+}
+
+// Change describes how a world's pack list was changed.
+type Change struct {
+	Pack   Pack   `json:"pack"`
+	Action string `json:"action"` // "added" or "updated"
+}
+
+type manifest struct {
+	Header struct {
+		Name    string `json:"name"`
+		UUID    string `json:"uuid"`
+		Version [3]int `json:"version"`
+	} `json:"header"`
+}
+
+// packsDir returns the directory holding packs of the given kind.
+func packsDir(appDir, kind string) string {
+	return filepath.Join(appDir, kind+"_packs")
+}
+
+// WorldFile returns the pack list file of a world for packs of the given
+// kind, relative to the app directory.
+func WorldFile(levelName, kind string) string {
+	return filepath.Join("worlds", levelName, "world_"+kind+"_packs.json")
+}
+
+// worldFile returns the pack list file of a world for packs of the given kind.
+func worldFile(appDir, levelName, kind string) string {
+	return filepath.Join(appDir, WorldFile(levelName, kind))
+}
+
+// Scan returns the packs of the given kind installed under appDir. Directories
+// without a readable manifest are skipped.
+func Scan(appDir, kind string) ([]Pack, error) {
+	entries, err := os.ReadDir(packsDir(appDir, kind))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("error reading %s packs: %w", kind, err)
+	}
+
+	var packs []Pack
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(packsDir(appDir, kind), entry.Name(), "manifest.json")) // #nosec G304
+		if err != nil {
+			continue
+		}
+
+		var m manifest
+
+		err = json.Unmarshal(data, &m)
+		if err != nil || m.Header.UUID == "" {
+			fmt.Printf("Skipping %s pack %s: invalid manifest\n", kind, entry.Name())
+			continue
+		}
+
+		packs = append(packs, Pack{
+			Kind:    kind,
+			Name:    m.Header.Name,
+			UUID:    m.Header.UUID,
+			Version: m.Header.Version,
+			Dir:     entry.Name(),
+		})
+	}
+
+	sort.Slice(packs, func(i, j int) bool {
+		return packs[i].Dir < packs[j].Dir
+	})
+
+	return packs, nil
+}
+
+// SyncWorld adds every installed pack to the world's pack lists and updates
+// the versions of packs already listed. Entries for packs that aren't
+// installed are left alone since they may be bundled with the world.
+func SyncWorld(appDir, levelName string) ([]Change, error) {
+	var changes []Change
+
+	for _, kind := range []string{KindBehavior, KindResource} {
+		installed, err := Scan(appDir, kind)
+		if err != nil {
+			return changes, err
+		}
+
+		kindChanges, err := syncWorldFile(worldFile(appDir, levelName, kind), installed)
+		if err != nil {
+			return changes, err
+		}
+
+		changes = append(changes, kindChanges...)
+	}
+
+	return changes, nil
+}
+
+// Path returns the pack's directory relative to the app directory.
+func (p Pack) Path() string {
+	return filepath.Join(p.Kind+"_packs", p.Dir)
+}
+
+// WorldPacks returns the installed packs the world's pack lists refer to.
+// Listed packs that aren't installed are bundled with the world or missing
+// and left out.
+func WorldPacks(appDir, levelName string) ([]Pack, error) {
+	var used []Pack
+
+	for _, kind := range []string{KindBehavior, KindResource} {
+		installed, err := Scan(appDir, kind)
+		if err != nil {
+			return nil, err
+		}
+
+		world, err := readWorldFile(worldFile(appDir, levelName, kind))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pack := range installed {
+			for _, wp := range world {
+				if wp.PackID == pack.UUID {
+					used = append(used, pack)
+					break
+				}
+			}
+		}
+	}
+
+	return used, nil
+}
+
+// Install moves the packs in the pack directories under srcDir into appDir,
+// replacing installed packs with the same UUID, and returns them. srcDir
+// should be on the same filesystem as appDir.
+func Install(appDir, srcDir string) ([]Pack, error) {
+	var moved []Pack
+
+	for _, kind := range []string{KindBehavior, KindResource} {
+		incoming, err := Scan(srcDir, kind)
+		if err != nil {
+			return moved, err
+		}
+
+		if len(incoming) == 0 {
+			continue
+		}
+
+		installed, err := Scan(appDir, kind)
+		if err != nil {
+			return moved, err
+		}
+
+		err = os.MkdirAll(packsDir(appDir, kind), 0750)
+		if err != nil {
+			return moved, fmt.Errorf("error creating %s packs directory: %w", kind, err)
+		}
+
+		for _, pack := range incoming {
+			for _, old := range installed {
+				if old.UUID != pack.UUID && old.Dir != pack.Dir {
+					continue
+				}
+
+				err = os.RemoveAll(filepath.Join(appDir, old.Path()))
+				if err != nil {
+					return moved, fmt.Errorf("error removing %s pack %s: %w", kind, old.Dir, err)
+				}
+			}
+
+			err = os.Rename(filepath.Join(srcDir, pack.Path()), filepath.Join(appDir, pack.Path()))
+			if err != nil {
+				return moved, fmt.Errorf("error installing %s pack %s: %w", kind, pack.Dir, err)
+			}
+
+			moved = append(moved, pack)
+		}
+	}
+
+	return moved, nil
+}
+
+// Unlink removes a pack from the world's pack list of its kind, reporting
+// whether it was listed.
+func Unlink(appDir, levelName string, pack Pack) (bool, error) {
+	path := worldFile(appDir, levelName, pack.Kind)
+
+	world, err := readWorldFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	kept := world[:0]
+
+	for _, wp := range world {
+		if wp.PackID != pack.UUID {
+			kept = append(kept, wp)
+		}
+	}
+
+	if len(kept) == len(world) {
+		return false, nil
+	}
+
+	data, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return false, err
+	}
+
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return false, fmt.Errorf("error writing %s: %w", filepath.Base(path), err)
+	}
+
+	return true, nil
+}
+
+// readWorldFile reads a world's pack list. A missing one is empty.
+func readWorldFile(path string) ([]WorldPack, error) {
+	var world []WorldPack
+
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading %s: %w", filepath.Base(path), err)
+	}
+
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &world)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	return world, nil
+}
+
+func syncWorldFile(path string, installed []Pack) ([]Change, error) {
+	world, err := readWorldFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+
+	for _, pack := range installed {
+		found := false
+
+		for i := range world {
+			if world[i].PackID != pack.UUID {
+				continue
+			}
+
+			found = true
+
+			if world[i].Version != pack.Version {
+				world[i].Version = pack.Version
+				changes = append(changes, Change{Pack: pack, Action: "updated"})
+			}
+		}
+
+		if !found {
+			world = append(world, WorldPack{PackID: pack.UUID, Version: pack.Version})
+			changes = append(changes, Change{Pack: pack, Action: "added"})
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.MarshalIndent(world, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return nil, fmt.Errorf("error creating world directory: %w", err)
+	}
+
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error writing %s: %w", filepath.Base(path), err)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,282 @@
+package packs
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeManifest creates a pack directory with a minimal manifest.
+func writeManifest(t *testing.T, appDir, kind, dir, uuid string, version [3]int) {
+	t.Helper()
+
+	packDir := filepath.Join(appDir, kind+"_packs", dir)
+
+	err := os.MkdirAll(packDir, 0755)
+	if err != nil {
+		t.Fatalf("Failed to create pack directory: %v", err)
+	}
+
+	manifest := map[string]interface{}{
+		"format_version": 2,
+		"header": map[string]interface{}{
+			"name":    dir,
+			"uuid":    uuid,
+			"version": version,
+		},
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Failed to encode manifest: %v", err)
+	}
+
+	err = os.WriteFile(filepath.Join(packDir, "manifest.json"), data, 0644)
+	if err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	appDir := t.TempDir()
+
+	writeManifest(t, appDir, KindBehavior, "b_pack", "uuid-b", [3]int{1, 2, 3})
+	writeManifest(t, appDir, KindBehavior, "a_pack", "uuid-a", [3]int{1, 0, 0})
+
+	// A directory without a manifest is skipped
+	err := os.MkdirAll(filepath.Join(appDir, "behavior_packs", "empty"), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	packs, err := Scan(appDir, KindBehavior)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if len(packs) != 2 {
+		t.Fatalf("Expected 2 packs, got %d", len(packs))
+	}
+
+	if packs[0].UUID != "uuid-a" || packs[1].Version != [3]int{1, 2, 3} {
+		t.Errorf("Unexpected packs: %+v", packs)
+	}
+
+	packs, err = Scan(appDir, KindResource)
+	if err != nil || len(packs) != 0 {
+		t.Errorf("Expected no resource packs and no error, got %v, %v", packs, err)
+	}
+}
+
+func TestSyncWorld(t *testing.T) {
+	appDir := t.TempDir()
+	level := "Bedrock level"
+
+	writeManifest(t, appDir, KindBehavior, "existing", "uuid-existing", [3]int{2, 0, 0})
+	writeManifest(t, appDir, KindBehavior, "new", "uuid-new", [3]int{1, 0, 0})
+
+	worldDir := filepath.Join(appDir, "worlds", level)
+
+	err := os.MkdirAll(worldDir, 0755)
+	if err != nil {
+		t.Fatalf("Failed to create world directory: %v", err)
+	}
+
+	existing := `[{"pack_id":"uuid-existing","version":[1,0,0]},{"pack_id":"uuid-bundled","version":[1,0,0]}]`
+
+	err = os.WriteFile(filepath.Join(worldDir, "world_behavior_packs.json"), []byte(existing), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write world packs: %v", err)
+	}
+
+	changes, err := SyncWorld(appDir, level)
+	if err != nil {
+		t.Fatalf("SyncWorld failed: %v", err)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %+v", changes)
+	}
+
+	data, err := os.ReadFile(filepath.Join(worldDir, "world_behavior_packs.json"))
+	if err != nil {
+		t.Fatalf("Failed to read world packs: %v", err)
+	}
+
+	var world []WorldPack
+
+	err = json.Unmarshal(data, &world)
+	if err != nil {
+		t.Fatalf("Failed to parse world packs: %v", err)
+	}
+
+	if len(world) != 3 {
+		t.Fatalf("Expected 3 world packs, got %+v", world)
+	}
+
+	if world[0].Version != [3]int{2, 0, 0} {
+		t.Errorf("Expected existing pack to be updated to 2.0.0, got %v", world[0].Version)
+	}
+
+	if world[1].PackID != "uuid-bundled" {
+		t.Errorf("Expected bundled pack to be kept, got %+v", world[1])
+	}
+
+	// A second sync has nothing to do
+	changes, err = SyncWorld(appDir, level)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes on second sync, got %+v, %v", changes, err)
+	}
+}
+
+func TestWorldPacks(t *testing.T) {
+	appDir := t.TempDir()
+	level := "Bedrock level"
+
+	writeManifest(t, appDir, KindBehavior, "used", "uuid-used", [3]int{1, 0, 0})
+	writeManifest(t, appDir, KindBehavior, "vanilla", "uuid-vanilla", [3]int{1, 0, 0})
+	writeManifest(t, appDir, KindResource, "textures", "uuid-textures", [3]int{1, 0, 0})
+
+	worldDir := filepath.Join(appDir, "worlds", level)
+
+	err := os.MkdirAll(worldDir, 0755)
+	if err != nil {
+		t.Fatalf("Failed to create world directory: %v", err)
+	}
+
+	for file, content := range map[string]string{
+		"world_behavior_packs.json": `[{"pack_id":"uuid-used","version":[1,0,0]},` +
+			`{"pack_id":"uuid-bundled","version":[1,0,0]}]`,
+		"world_resource_packs.json": `[{"pack_id":"uuid-textures","version":[1,0,0]}]`,
+	} {
+		err = os.WriteFile(filepath.Join(worldDir, file), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("Failed to write world packs: %v", err)
+		}
+	}
+
+	used, err := WorldPacks(appDir, level)
+	if err != nil {
+		t.Fatalf("WorldPacks failed: %v", err)
+	}
+
+	if len(used) != 2 || used[0].Path() != filepath.Join("behavior_packs", "used") ||
+		used[1].Path() != filepath.Join("resource_packs", "textures") {
+		t.Errorf("Expected the used packs only, got %+v", used)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	appDir := t.TempDir()
+	srcDir := t.TempDir()
+
+	writeManifest(t, appDir, KindBehavior, "addon_1.0", "uuid-addon", [3]int{1, 0, 0})
+	writeManifest(t, appDir, KindBehavior, "other", "uuid-other", [3]int{1, 0, 0})
+	writeManifest(t, srcDir, KindBehavior, "addon_2.0", "uuid-addon", [3]int{2, 0, 0})
+	writeManifest(t, srcDir, KindResource, "textures", "uuid-textures", [3]int{1, 0, 0})
+
+	moved, err := Install(appDir, srcDir)
+	if err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+
+	if len(moved) != 2 {
+		t.Errorf("Expected 2 packs to be installed, got %+v", moved)
+	}
+
+	installed, err := Scan(appDir, KindBehavior)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if len(installed) != 2 || installed[0].Dir != "addon_2.0" || installed[1].Dir != "other" {
+		t.Errorf("Expected the old version to be replaced, got %+v", installed)
+	}
+}
+
+func TestUnlink(t *testing.T) {
+	appDir := t.TempDir()
+	level := "Bedrock level"
+
+	path := filepath.Join(appDir, WorldFile(level, KindBehavior))
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create world directory: %v", err)
+	}
+
+	err = os.WriteFile(path,
+		[]byte(`[{"pack_id":"uuid-a","version":[1,0,0]},{"pack_id":"uuid-b","version":[1,0,0]}]`), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write world packs: %v", err)
+	}
+
+	pack := Pack{Kind: KindBehavior, UUID: "uuid-a", Dir: "a"}
+
+	listed, err := Unlink(appDir, level, pack)
+	if err != nil || !listed {
+		t.Fatalf("Expected the pack to be unlisted, got %v, %v", listed, err)
+	}
+
+	world, err := readWorldFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read world packs: %v", err)
+	}
+
+	if len(world) != 1 || world[0].PackID != "uuid-b" {
+		t.Errorf("Expected only the other pack to remain, got %+v", world)
+	}
+
+	listed, err = Unlink(appDir, level, pack)
+	if err != nil || listed {
+		t.Errorf("Expected an unlisted pack to be left alone, got %v, %v", listed, err)
+	}
+}
+
+func TestStructures(t *testing.T) {
+	appDir := t.TempDir()
+
+	err := SaveStructure(appDir, "house", strings.NewReader("data"))
+	if err != nil {
+		t.Fatalf("SaveStructure failed: %v", err)
+	}
+
+	err = SaveStructure(appDir, "castles:keep", strings.NewReader("more data"))
+	if err != nil {
+		t.Fatalf("SaveStructure failed: %v", err)
+	}
+
+	err = SaveStructure(appDir, "../escape", strings.NewReader("data"))
+	if !errors.Is(err, ErrInvalidStructureName) {
+		t.Errorf("Expected ErrInvalidStructureName, got %v", err)
+	}
+
+	structures, err := ListStructures(appDir)
+	if err != nil {
+		t.Fatalf("ListStructures failed: %v", err)
+	}
+
+	if len(structures) != 2 || structures[0].Name != "castles:keep" || structures[1].Name != "mystructure:house" {
+		t.Errorf("Unexpected structures: %+v", structures)
+	}
+
+	// The structure pack is a valid behavior pack
+	installed, err := Scan(appDir, KindBehavior)
+	if err != nil || len(installed) != 1 || installed[0].Dir != StructurePackDir {
+		t.Errorf("Expected the structure pack to be installed, got %+v, %v", installed, err)
+	}
+
+	f, err := OpenStructure(appDir, "mystructure:house")
+	if err != nil {
+		t.Fatalf("OpenStructure failed: %v", err)
+	}
+	f.Close()
+
+	_, err = OpenStructure(appDir, "missing")
+	if !errors.Is(err, ErrStructureNotFound) {
+		t.Errorf("Expected ErrStructureNotFound, got %v", err)
+	}
+}
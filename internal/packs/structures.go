@@ -0,0 +1,208 @@
+package packs
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// StructurePackDir is the behavior pack the wrapper keeps imported
+	// structures in.
+	StructurePackDir = "wrapper_structures"
+
+	structureExt       = ".mcstructure"
+	defaultNamespace   = "mystructure"
+	maxStructureSize   = 10 << 20
+	structurePackTitle = "Wrapper Structures"
+)
+
+var (
+	ErrInvalidStructureName = errors.New("invalid structure name")
+	ErrStructureNotFound    = errors.New("structure not found")
+	ErrStructureTooLarge    = errors.New("structure file too large")
+
+	structureNamePattern = regexp.MustCompile(`^(?:[a-z0-9_]+:)?[a-z0-9_]+$`)
+)
+
+// Structure is a .mcstructure file in the wrapper's structure pack.
+type Structure struct {
+	Name string `json:"name"` // Identifier as used by /structure load, e.g. "mystructure:house"
+	Size int64  `json:"size"`
+}
+
+// ValidStructureName reports whether name is a valid structure identifier.
+func ValidStructureName(name string) bool {
+	return structureNamePattern.MatchString(name)
+}
+
+// structurePath returns the file path of a structure identifier.
+func structurePath(appDir, name string) (string, error) {
+	if !ValidStructureName(name) {
+		return "", ErrInvalidStructureName
+	}
+
+	namespace, id, ok := strings.Cut(name, ":")
+	if !ok {
+		namespace, id = defaultNamespace, name
+	}
+
+	return filepath.Join(packsDir(appDir, KindBehavior), StructurePackDir, "structures", namespace, id+structureExt), nil
+}
+
+// ensureStructurePack creates the wrapper's structure pack if it doesn't exist.
+func ensureStructurePack(appDir string) error {
+	dir := filepath.Join(packsDir(appDir, KindBehavior), StructurePackDir)
+
+	_, err := os.Stat(filepath.Join(dir, "manifest.json"))
+	if err == nil {
+		return nil
+	}
+
+	err = os.MkdirAll(dir, 0750)
+	if err != nil {
+		return fmt.Errorf("error creating structure pack: %w", err)
+	}
+
+	m := map[string]interface{}{
+		"format_version": 2,
+		"header": map[string]interface{}{
+			"name":               structurePackTitle,
+			"description":        "Structures imported through the wrapper",
+			"uuid":               newUUID(),
+			"version":            [3]int{1, 0, 0},
+			"min_engine_version": [3]int{1, 20, 0},
+		},
+		"modules": []map[string]interface{}{
+			{
+				"type":    "data",
+				"uuid":    newUUID(),
+				"version": [3]int{1, 0, 0},
+			},
+		},
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, "manifest.json"), data, 0600)
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// ListStructures returns the structures in the wrapper's structure pack.
+func ListStructures(appDir string) ([]Structure, error) {
+	root := filepath.Join(packsDir(appDir, KindBehavior), StructurePackDir, "structures")
+	structures := []Structure{}
+
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(d.Name(), structureExt) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		namespace, file := filepath.Split(rel)
+		name := strings.TrimSuffix(file, structureExt)
+
+		if namespace != "" {
+			name = strings.TrimSuffix(namespace, string(os.PathSeparator)) + ":" + name
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		structures = append(structures, Structure{Name: name, Size: info.Size()})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing structures: %w", err)
+	}
+
+	sort.Slice(structures, func(i, j int) bool {
+		return structures[i].Name < structures[j].Name
+	})
+
+	return structures, nil
+}
+
+// OpenStructure opens a structure file for reading.
+func OpenStructure(appDir, name string) (*os.File, error) {
+	path, err := structurePath(appDir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrStructureNotFound
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// SaveStructure writes a structure file into the wrapper's structure pack,
+// creating the pack if needed.
+func SaveStructure(appDir, name string, r io.Reader) error {
+	path, err := structurePath(appDir, name)
+	if err != nil {
+		return err
+	}
+
+	err = ensureStructurePack(appDir)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return fmt.Errorf("error creating structure directory: %w", err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxStructureSize+1))
+	if err != nil {
+		return fmt.Errorf("error reading structure: %w", err)
+	}
+
+	if len(data) > maxStructureSize {
+		return ErrStructureTooLarge
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
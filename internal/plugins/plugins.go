@@ -0,0 +1,276 @@
+// Package plugins runs integrations as external processes next to the
+// wrapper. A plugin speaks newline-delimited JSON over its stdin and stdout:
+// it registers the events it subscribes to, the API routes it serves and the
+// jobs it wants run on a schedule, and may send console commands and log
+// lines back at any time.
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message types. The wrapper sends event, request and job messages; the
+// plugin sends register (first, once per start), response, command and log
+// messages.
+const (
+	TypeRegister = "register"
+	TypeEvent    = "event"
+	TypeRequest  = "request"
+	TypeResponse = "response"
+	TypeJob      = "job"
+	TypeCommand  = "command"
+	TypeLog      = "log"
+)
+
+// MinInterval is the shortest interval a job may run at.
+const MinInterval = 10 * time.Second
+
+var (
+	ErrNotFound    = errors.New("plugin not found")
+	ErrInvalid     = errors.New("invalid plugin")
+	ErrUnavailable = errors.New("plugin not running")
+	ErrTimeout     = errors.New("plugin did not respond in time")
+)
+
+var nameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// Config is how a plugin is started.
+type Config struct {
+	Name    string            `json:"name"` // Also the prefix of its routes, /api/plugins/<name>/
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"` // Added to the wrapper's environment
+	Dir     string            `json:"dir,omitempty"`
+}
+
+// Validate checks the config of a plugin.
+func (c Config) Validate() error {
+	if !nameRe.MatchString(c.Name) {
+		return fmt.Errorf("%w: name %q must be lowercase letters, digits, - and _", ErrInvalid, c.Name)
+	}
+
+	if c.Command == "" {
+		return fmt.Errorf("%w: %s has no command", ErrInvalid, c.Name)
+	}
+
+	return nil
+}
+
+// LoadConfig reads the plugins to start from a JSON file holding a list of
+// configs.
+func LoadConfig(path string) ([]Config, error) {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("error reading plugin config: %w", err)
+	}
+
+	var configs []Config
+
+	err = json.Unmarshal(data, &configs)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing plugin config: %w", err)
+	}
+
+	seen := make(map[string]bool)
+
+	for _, c := range configs {
+		err = c.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[c.Name] {
+			return nil, fmt.Errorf("%w: %s is configured twice", ErrInvalid, c.Name)
+		}
+
+		seen[c.Name] = true
+	}
+
+	return configs, nil
+}
+
+// Event is something that happened on the server, with the event names used
+// by rules and scripts: output, join, leave, start and crash.
+type Event struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Player string    `json:"player,omitempty"`
+	XUID   string    `json:"xuid,omitempty"`
+	Line   string    `json:"line,omitempty"`
+}
+
+// Request is an API call to a route of a plugin.
+type Request struct {
+	Method string              `json:"method"`
+	Route  string              `json:"route"` // The path below /api/plugins/<name>/
+	Query  map[string][]string `json:"query,omitempty"`
+	Actor  string              `json:"actor"`
+	Body   string              `json:"body,omitempty"`
+}
+
+// Response is the answer of a plugin to a request. The status defaults to
+// 200 and the content type to JSON.
+type Response struct {
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// Job is something a plugin wants to be told to do every interval, e.g.
+// "5m".
+type Job struct {
+	Name     string `json:"name"`
+	Interval string `json:"interval"`
+}
+
+// Message is a line of the protocol; which fields are set depends on the
+// type.
+type Message struct {
+	Type     string    `json:"type"`
+	ID       string    `json:"id,omitempty"` // Pairs a request with its response
+	Event    *Event    `json:"event,omitempty"`
+	Request  *Request  `json:"request,omitempty"`
+	Response *Response `json:"response,omitempty"`
+	Job      string    `json:"job,omitempty"`
+	Events   []string  `json:"events,omitempty"` // Register: subscribed event types
+	Routes   []string  `json:"routes,omitempty"` // Register: routes, e.g. "stats" or "stats/top"
+	Jobs     []Job     `json:"jobs,omitempty"`   // Register: scheduled jobs
+	Command  string    `json:"command,omitempty"`
+	Message  string    `json:"message,omitempty"` // Log line
+}
+
+// registration is what a plugin registered, checked.
+type registration struct {
+	events    map[string]bool
+	routes    map[string]bool
+	jobs      []Job
+	intervals []time.Duration
+}
+
+// parseRegister checks a register message.
+func parseRegister(msg Message) (registration, error) {
+	reg := registration{events: make(map[string]bool), routes: make(map[string]bool)}
+
+	if msg.Type != TypeRegister {
+		return reg, fmt.Errorf("%w: expected a register message, got %q", ErrInvalid, msg.Type)
+	}
+
+	for _, e := range msg.Events {
+		reg.events[e] = true
+	}
+
+	for _, route := range msg.Routes {
+		route = strings.Trim(route, "/")
+		if route == "" || strings.Contains(route, "..") {
+			return reg, fmt.Errorf("%w: bad route %q", ErrInvalid, route)
+		}
+
+		reg.routes[route] = true
+	}
+
+	for _, job := range msg.Jobs {
+		interval, err := time.ParseDuration(job.Interval)
+		if err != nil || interval < MinInterval {
+			return reg, fmt.Errorf("%w: job %s must run at an interval of at least %s", ErrInvalid, job.Name, MinInterval)
+		}
+
+		reg.jobs = append(reg.jobs, job)
+		reg.intervals = append(reg.intervals, interval)
+	}
+
+	return reg, nil
+}
+
+// Host is what plugins act on.
+type Host interface {
+	// Command sends a console command on behalf of a plugin.
+	Command(plugin, command string)
+	// Log records a log line of a plugin.
+	Log(plugin, message string)
+}
+
+// Status is the state of a plugin.
+type Status struct {
+	Name     string    `json:"name"`
+	Running  bool      `json:"running"`
+	PID      int       `json:"pid,omitempty"`
+	Started  time.Time `json:"started,omitempty"`
+	Restarts int       `json:"restarts"`
+	Dropped  int       `json:"dropped"` // Events not delivered because the plugin fell behind
+	Events   []string  `json:"events"`
+	Routes   []string  `json:"routes"`
+	Jobs     []Job     `json:"jobs"`
+	Error    string    `json:"error,omitempty"` // Why the plugin last stopped
+}
+
+// Manager runs the configured plugins and restarts them when they exit.
+type Manager struct {
+	plugins map[string]*Plugin
+	names   []string
+}
+
+// Start starts the plugins.
+func Start(configs []Config, host Host) *Manager {
+	m := &Manager{plugins: make(map[string]*Plugin)}
+
+	for _, c := range configs {
+		p := newPlugin(c, host)
+		m.plugins[c.Name] = p
+		m.names = append(m.names, c.Name)
+
+		go p.run()
+	}
+
+	sort.Strings(m.names)
+
+	return m
+}
+
+// List returns the state of each plugin, by name.
+func (m *Manager) List() []Status {
+	list := make([]Status, 0, len(m.names))
+
+	for _, name := range m.names {
+		list = append(list, m.plugins[name].status())
+	}
+
+	return list
+}
+
+// Publish sends an event to the plugins subscribed to it. It doesn't block;
+// a plugin that falls behind misses events.
+func (m *Manager) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	for _, name := range m.names {
+		m.plugins[name].publish(e)
+	}
+}
+
+// Serve passes a request to the plugin serving the route and waits for the
+// response.
+func (m *Manager) Serve(name string, req Request) (Response, error) {
+	p, ok := m.plugins[name]
+	if !ok {
+		return Response{}, ErrNotFound
+	}
+
+	return p.serve(req)
+}
+
+// Stop stops the plugins, giving them a moment to handle what was sent to
+// them.
+func (m *Manager) Stop() {
+	for _, name := range m.names {
+		m.plugins[name].stop()
+	}
+}
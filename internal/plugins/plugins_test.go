@@ -0,0 +1,177 @@
+package plugins
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain turns the test binary into a plugin when PLUGIN_HELPER is set:
+// it greets joining players, echoes requests and logs jobs.
+func TestMain(m *testing.M) {
+	if os.Getenv("PLUGIN_HELPER") != "1" {
+		os.Exit(m.Run())
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	_ = out.Encode(Message{
+		Type:   TypeRegister,
+		Events: []string{"join"},
+		Routes: []string{"echo"},
+		Jobs:   []Job{{Name: "tick", Interval: "10s"}},
+	})
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg Message
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+
+		switch msg.Type {
+		case TypeEvent:
+			_ = out.Encode(Message{Type: TypeCommand, Command: "say Welcome " + msg.Event.Player})
+		case TypeRequest:
+			body := fmt.Sprintf(`{"actor":%q,"body":%q}`, msg.Request.Actor, msg.Request.Body)
+			_ = out.Encode(Message{Type: TypeResponse, ID: msg.ID, Response: &Response{Body: body}})
+		case TypeJob:
+			_ = out.Encode(Message{Type: TypeLog, Message: "ran " + msg.Job})
+		}
+	}
+
+	os.Exit(0)
+}
+
+type host struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (h *host) Command(plugin, command string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.commands = append(h.commands, plugin+": "+command)
+}
+
+func (h *host) Log(plugin, message string) {}
+
+func (h *host) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.commands)
+}
+
+func startHelper(t *testing.T, h Host) *Manager {
+	t.Helper()
+
+	m := Start([]Config{{
+		Name:    "helper",
+		Command: os.Args[0],
+		Env:     map[string]string{"PLUGIN_HELPER": "1"},
+	}}, h)
+	t.Cleanup(m.Stop)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !m.List()[0].Running {
+		if time.Now().After(deadline) {
+			t.Fatalf("plugin did not start: %+v", m.List()[0])
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return m
+}
+
+func TestPlugin(t *testing.T) {
+	h := &host{}
+	m := startHelper(t, h)
+
+	st := m.List()[0]
+	if len(st.Routes) != 1 || st.Routes[0] != "echo" || len(st.Jobs) != 1 {
+		t.Fatalf("unexpected registration: %+v", st)
+	}
+
+	// Only subscribed events are delivered
+	m.Publish(Event{Type: "output", Line: "hello"})
+	m.Publish(Event{Type: "join", Player: "Steve"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for h.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(h.commands) != 1 || h.commands[0] != "helper: say Welcome Steve" {
+		t.Errorf("unexpected commands: %q", h.commands)
+	}
+
+	resp, err := m.Serve("helper", Request{Method: "POST", Route: "/echo/", Actor: "alice", Body: "hi"})
+	if err != nil {
+		t.Fatalf("error serving request: %v", err)
+	}
+
+	if resp.Body != `{"actor":"alice","body":"hi"}` {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	_, err = m.Serve("helper", Request{Route: "missing"})
+	if !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected ErrNoRoute, got %v", err)
+	}
+
+	_, err = m.Serve("other", Request{Route: "echo"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugins.json")
+
+	tests := map[string]string{
+		`[{"name":"stats","command":"./stats"}]`:                                 "",
+		`[{"name":"Stats","command":"./stats"}]`:                                 "name",
+		`[{"name":"stats"}]`:                                                     "command",
+		`[{"name":"stats","command":"a"},{"name":"stats","command":"b"}]`:        "twice",
+		`[{"name":"stats","command":"a"},{"name":"economy","command":"./econ"}]`: "",
+	}
+
+	for data, want := range tests {
+		err := os.WriteFile(path, []byte(data), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = LoadConfig(path)
+		if (want == "") != (err == nil) {
+			t.Errorf("%s: unexpected error %v", data, err)
+		} else if err != nil && !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", data, err)
+		}
+	}
+}
+
+func TestParseRegister(t *testing.T) {
+	_, err := parseRegister(Message{Type: TypeRegister, Jobs: []Job{{Name: "fast", Interval: "1s"}}})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected a too short interval to be rejected, got %v", err)
+	}
+
+	_, err = parseRegister(Message{Type: TypeRegister, Routes: []string{"../etc"}})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected a bad route to be rejected, got %v", err)
+	}
+
+	_, err = parseRegister(Message{Type: TypeLog})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected a non-register message to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,471 @@
+package plugins
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// registerTimeout is how long a started plugin has to register.
+	registerTimeout = 10 * time.Second
+
+	// requestTimeout bounds how long an API request waits for a plugin.
+	requestTimeout = 10 * time.Second
+
+	// stopTimeout is how long a plugin has to exit once its stdin is closed
+	// before it is killed.
+	stopTimeout = 5 * time.Second
+
+	// sendBuffer is how many messages may wait to be written to a plugin.
+	sendBuffer = 256
+
+	// maxBackoff caps the delay between restarts of a plugin that keeps
+	// exiting. A plugin that ran this long starts over at a second.
+	maxBackoff = time.Minute
+
+	// maxMessage is the longest line a plugin may send.
+	maxMessage = 1 << 20
+)
+
+// ErrNoRoute is returned for a route the plugin didn't register.
+var ErrNoRoute = errors.New("plugin route not found")
+
+// Plugin is a plugin process, restarted whenever it exits.
+type Plugin struct {
+	config Config
+	host   Host
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	reg      registration
+	running  bool
+	started  time.Time
+	restarts int
+	dropped  int
+	lastErr  string
+	send     chan []byte // Messages to write to the running process, nil if none
+	pending  map[string]chan Response
+	stopping bool
+
+	stopped chan struct{} // Closed when the plugin is stopped
+	done    chan struct{} // Closed when run returns
+}
+
+func newPlugin(c Config, host Host) *Plugin {
+	return &Plugin{
+		config:  c,
+		host:    host,
+		pending: make(map[string]chan Response),
+		stopped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// run starts the process and restarts it with a growing delay until the
+// plugin is stopped.
+func (p *Plugin) run() {
+	defer close(p.done)
+
+	backoff := time.Second
+
+	for {
+		started := time.Now()
+
+		err := p.runOnce()
+
+		p.mu.Lock()
+		p.running = false
+		p.lastErr = err.Error()
+		stopping := p.stopping
+
+		for id, ch := range p.pending {
+			close(ch)
+			delete(p.pending, id)
+		}
+		p.mu.Unlock()
+
+		if stopping {
+			return
+		}
+
+		if time.Since(started) > maxBackoff {
+			backoff = time.Second
+		}
+
+		p.host.Log(p.config.Name, fmt.Sprintf("stopped (%v), restarting in %s", err, backoff))
+
+		select {
+		case <-p.stopped:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+
+		p.mu.Lock()
+		p.restarts++
+		p.mu.Unlock()
+	}
+}
+
+// runOnce runs the process until it exits.
+func (p *Plugin) runOnce() error {
+	cmd := exec.Command(p.config.Command, p.config.Args...) // #nosec G204
+	cmd.Dir = p.config.Dir
+	cmd.Env = os.Environ()
+
+	for name, value := range p.config.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("error creating stdin pipe: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error creating stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("error creating stderr pipe: %w", err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("error starting plugin: %w", err)
+	}
+
+	p.mu.Lock()
+	p.cmd = cmd
+	p.mu.Unlock()
+
+	// Anything the plugin writes to stderr is logged
+	var logs sync.WaitGroup
+
+	logs.Add(1)
+
+	go func() {
+		defer logs.Done()
+
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			p.host.Log(p.config.Name, scanner.Text())
+		}
+	}()
+
+	messages := make(chan Message)
+
+	go func() {
+		defer close(messages)
+
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), maxMessage)
+
+		for scanner.Scan() {
+			var msg Message
+
+			err := json.Unmarshal(scanner.Bytes(), &msg)
+			if err != nil {
+				p.host.Log(p.config.Name, fmt.Sprintf("invalid message: %v", err))
+				continue
+			}
+
+			messages <- msg
+		}
+	}()
+
+	// finish waits for the process after its stdout closed
+	finish := func(reason error) error {
+		for range messages {
+		}
+
+		logs.Wait()
+
+		err := cmd.Wait()
+		if reason != nil {
+			return reason
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return errors.New("exited")
+	}
+
+	reg, err := p.register(messages)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		return finish(err)
+	}
+
+	send := make(chan []byte, sendBuffer)
+	exited := make(chan struct{})
+
+	go func() {
+		var err error
+
+		for data := range send {
+			if err == nil {
+				_, err = stdin.Write(data)
+			}
+		}
+
+		stdin.Close()
+	}()
+
+	p.mu.Lock()
+	p.reg = reg
+	p.running = true
+	p.started = time.Now()
+	p.send = send
+	p.mu.Unlock()
+
+	for i, job := range reg.jobs {
+		go p.schedule(job.Name, reg.intervals[i], exited)
+	}
+
+	for msg := range messages {
+		p.handle(msg)
+	}
+
+	close(exited)
+
+	p.mu.Lock()
+	if p.send == send {
+		close(send)
+		p.send = nil
+	}
+	p.mu.Unlock()
+
+	return finish(nil)
+}
+
+// register waits for the register message of a started process.
+func (p *Plugin) register(messages <-chan Message) (registration, error) {
+	select {
+	case msg, ok := <-messages:
+		if !ok {
+			return registration{}, errors.New("exited before registering")
+		}
+
+		return parseRegister(msg)
+	case <-time.After(registerTimeout):
+		return registration{}, fmt.Errorf("did not register within %s", registerTimeout)
+	case <-p.stopped:
+		return registration{}, errors.New("stopped")
+	}
+}
+
+// schedule tells the plugin to run a job every interval while the process
+// runs.
+func (p *Plugin) schedule(name string, interval time.Duration, exited <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.enqueue(Message{Type: TypeJob, Job: name})
+			p.mu.Unlock()
+		}
+	}
+}
+
+// handle handles a message from the plugin.
+func (p *Plugin) handle(msg Message) {
+	switch msg.Type {
+	case TypeResponse:
+		p.mu.Lock()
+		ch, ok := p.pending[msg.ID]
+		delete(p.pending, msg.ID)
+		p.mu.Unlock()
+
+		if ok && msg.Response != nil {
+			ch <- *msg.Response
+		}
+	case TypeCommand:
+		command := strings.TrimSpace(msg.Command)
+		if command == "" || strings.ContainsAny(command, "\r\n") {
+			p.host.Log(p.config.Name, fmt.Sprintf("ignored invalid command %q", msg.Command))
+			return
+		}
+
+		p.host.Command(p.config.Name, command)
+	case TypeLog:
+		p.host.Log(p.config.Name, msg.Message)
+	default:
+		p.host.Log(p.config.Name, fmt.Sprintf("ignored unexpected %q message", msg.Type))
+	}
+}
+
+// enqueue queues a message for the running process and reports whether
+// there was room. p.mu must be held.
+func (p *Plugin) enqueue(msg Message) bool {
+	if p.send == nil {
+		return false
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return false
+	}
+
+	select {
+	case p.send <- append(data, '\n'):
+		return true
+	default:
+		return false
+	}
+}
+
+// publish sends an event if the plugin subscribed to it.
+func (p *Plugin) publish(e Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.running || !p.reg.events[e.Type] {
+		return
+	}
+
+	if !p.enqueue(Message{Type: TypeEvent, Event: &e}) {
+		p.dropped++
+	}
+}
+
+// serve passes a request to the plugin and waits for its response.
+func (p *Plugin) serve(req Request) (Response, error) {
+	req.Route = strings.Trim(req.Route, "/")
+
+	p.mu.Lock()
+
+	if !p.running {
+		p.mu.Unlock()
+		return Response{}, ErrUnavailable
+	}
+
+	if !p.reg.routes[req.Route] {
+		p.mu.Unlock()
+		return Response{}, ErrNoRoute
+	}
+
+	id := newID()
+	ch := make(chan Response, 1)
+	p.pending[id] = ch
+
+	if !p.enqueue(Message{Type: TypeRequest, ID: id, Request: &req}) {
+		delete(p.pending, id)
+		p.mu.Unlock()
+
+		return Response{}, ErrTimeout
+	}
+
+	p.mu.Unlock()
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return Response{}, ErrUnavailable
+		}
+
+		return resp, nil
+	case <-time.After(requestTimeout):
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+
+		return Response{}, ErrTimeout
+	}
+}
+
+// status returns the state of the plugin.
+func (p *Plugin) status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := Status{
+		Name:     p.config.Name,
+		Running:  p.running,
+		Restarts: p.restarts,
+		Dropped:  p.dropped,
+		Events:   keys(p.reg.events),
+		Routes:   keys(p.reg.routes),
+		Jobs:     append([]Job{}, p.reg.jobs...),
+	}
+
+	if p.running {
+		st.PID = p.cmd.Process.Pid
+		st.Started = p.started
+	} else {
+		st.Error = p.lastErr
+	}
+
+	return st
+}
+
+// stop closes the stdin of the process so it can exit on its own, and kills
+// it if it doesn't in time.
+func (p *Plugin) stop() {
+	p.mu.Lock()
+	if p.stopping {
+		p.mu.Unlock()
+		return
+	}
+
+	p.stopping = true
+	close(p.stopped)
+
+	if p.send != nil {
+		close(p.send)
+		p.send = nil
+	}
+
+	cmd := p.cmd
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return
+	case <-time.After(stopTimeout):
+	}
+
+	if cmd != nil && cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+
+	<-p.done
+}
+
+func keys(set map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for k := range set {
+		list = append(list, k)
+	}
+
+	sort.Strings(list)
+
+	return list
+}
+
+func newID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
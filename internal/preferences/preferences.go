@@ -0,0 +1,123 @@
+// Package preferences keeps the web console settings of each central server
+// user, so they follow the user across browsers and devices.
+package preferences
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/i18n"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/timezone"
+)
+
+// Themes of the web console.
+const (
+	ThemeSystem = "system" // Follows the browser or operating system
+	ThemeDark   = "dark"
+	ThemeLight  = "light"
+)
+
+// Console font sizes, in pixels.
+const (
+	MinFontSize = 8
+	MaxFontSize = 32
+)
+
+var ErrInvalid = errors.New("invalid preferences")
+
+// Preferences are the web console settings of a user. Empty fields use the
+// console's defaults.
+type Preferences struct {
+	Theme          string `json:"theme,omitempty"`             // ThemeSystem if empty
+	Timezone       string `json:"timezone,omitempty"`          // IANA name such as Europe/Berlin, the browser's if empty
+	DefaultWrapper string `json:"default_wrapper,omitempty"`   // ID of the wrapper whose tab opens first
+	FontSize       int    `json:"console_font_size,omitempty"` // Console font size in pixels
+	Language       string `json:"language,omitempty"`          // Language of the console, the browser's if empty
+}
+
+// Validate checks the preferences.
+func (p Preferences) Validate() error {
+	if p.Theme != "" && p.Theme != ThemeSystem && p.Theme != ThemeDark && p.Theme != ThemeLight {
+		return fmt.Errorf("%w: unknown theme %q", ErrInvalid, p.Theme)
+	}
+
+	if p.Timezone != "" {
+		_, err := timezone.Load(p.Timezone)
+		if err != nil {
+			return fmt.Errorf("%w: unknown timezone %q", ErrInvalid, p.Timezone)
+		}
+	}
+
+	if strings.ContainsAny(p.DefaultWrapper, "\r\n") || len(p.DefaultWrapper) > 256 {
+		return fmt.Errorf("%w: invalid default wrapper", ErrInvalid)
+	}
+
+	if p.FontSize != 0 && (p.FontSize < MinFontSize || p.FontSize > MaxFontSize) {
+		return fmt.Errorf("%w: console font size must be between %d and %d", ErrInvalid, MinFontSize, MaxFontSize)
+	}
+
+	if p.Language != "" && !i18n.Supported(p.Language) {
+		return fmt.Errorf("%w: unsupported language %q", ErrInvalid, p.Language)
+	}
+
+	return nil
+}
+
+// Store keeps the preferences of each user, by name, in a JSON file.
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	users map[string]Preferences
+}
+
+// Open loads the store at path, starting empty if it doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, users: map[string]Preferences{}}
+
+	err := jsonfile.Load(path, &s.users)
+	if err != nil {
+		return nil, fmt.Errorf("error loading preferences: %w", err)
+	}
+
+	return s, nil
+}
+
+// save writes the preferences of all users. The caller holds the lock.
+func (s *Store) save() error {
+	err := jsonfile.Save(s.path, s.users)
+	if err != nil {
+		return fmt.Errorf("error saving preferences: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the preferences of a user, empty if they have none.
+func (s *Store) Get(user string) Preferences {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.users[user]
+}
+
+// Set replaces the preferences of a user. Empty preferences are removed.
+func (s *Store) Set(user string, p Preferences) (Preferences, error) {
+	err := p.Validate()
+	if err != nil {
+		return Preferences{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p == (Preferences{}) {
+		delete(s.users, user)
+	} else {
+		s.users[user] = p
+	}
+
+	return p, s.save()
+}
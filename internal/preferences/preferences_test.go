@@ -0,0 +1,84 @@
+package preferences
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []Preferences{
+		{},
+		{Theme: ThemeDark, Timezone: "Europe/Berlin", DefaultWrapper: "server1", FontSize: 14, Language: "de"},
+		{Theme: ThemeLight, Timezone: "UTC"},
+		{Theme: ThemeSystem, FontSize: MaxFontSize},
+	}
+
+	for _, p := range valid {
+		err := p.Validate()
+		if err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", p, err)
+		}
+	}
+
+	invalid := []Preferences{
+		{Theme: "solarized"},
+		{Timezone: "Mars/Olympus_Mons"},
+		{Timezone: "Local"},
+		{FontSize: 4},
+		{FontSize: 100},
+		{Language: "fr"},
+		{DefaultWrapper: "a\nb"},
+	}
+
+	for _, p := range invalid {
+		err := p.Validate()
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", p, err)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preferences.json")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	if p := s.Get("alice"); p != (Preferences{}) {
+		t.Errorf("Expected no preferences, got %+v", p)
+	}
+
+	want := Preferences{Theme: ThemeLight, Timezone: "America/Sao_Paulo", FontSize: 16}
+
+	_, err = s.Set("alice", want)
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	_, err = s.Set("bob", Preferences{Theme: "neon"})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected invalid preferences to be refused, got %v", err)
+	}
+
+	// Preferences persist across restarts
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	if p := s.Get("alice"); p != want {
+		t.Errorf("Expected %+v, got %+v", want, p)
+	}
+
+	_, err = s.Set("alice", Preferences{})
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if len(s.users) != 0 {
+		t.Errorf("Expected empty preferences to be removed, got %v", s.users)
+	}
+}
@@ -0,0 +1,91 @@
+// Package pregen plans pregenerating the terrain around a point: the area is
+// cut into tiles small enough for a ticking area, which makes
+// bedrock_server generate and load their chunks, nearest first.
+package pregen
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// TileChunks is the width of a tile in chunks; a ticking area holds at
+	// most 100 chunks.
+	TileChunks = 8
+
+	// MaxRadius is the largest radius that can be pregenerated, in blocks.
+	MaxRadius = 10000
+
+	chunkBlocks = 16
+	tileBlocks  = TileChunks * chunkBlocks
+)
+
+var ErrInvalid = errors.New("invalid pregeneration")
+
+// Tile is a square of chunks, in block coordinates, corners included.
+type Tile struct {
+	FromX int `json:"from_x"`
+	FromZ int `json:"from_z"`
+	ToX   int `json:"to_x"`
+	ToZ   int `json:"to_z"`
+}
+
+// Add returns the command loading the tile as a ticking area with the given
+// name. The area is preloaded so its chunks are generated right away.
+func (t Tile) Add(name string) string {
+	return fmt.Sprintf("tickingarea add %d 0 %d %d 0 %d %s true", t.FromX, t.FromZ, t.ToX, t.ToZ, name)
+}
+
+// Remove returns the command unloading the ticking area with the given name.
+func Remove(name string) string {
+	return "tickingarea remove " + name
+}
+
+// Plan returns the tiles covering the square of the given radius in blocks
+// around x, z, aligned to chunks, nearest to the center first.
+func Plan(x, z, radius int) ([]Tile, error) {
+	if radius < 1 || radius > MaxRadius {
+		return nil, fmt.Errorf("%w: the radius must be between 1 and %d blocks", ErrInvalid, MaxRadius)
+	}
+
+	minX, maxX := floorDiv(x-radius, chunkBlocks), floorDiv(x+radius, chunkBlocks)
+	minZ, maxZ := floorDiv(z-radius, chunkBlocks), floorDiv(z+radius, chunkBlocks)
+
+	var tiles []Tile
+
+	for cx := minX; cx <= maxX; cx += TileChunks {
+		for cz := minZ; cz <= maxZ; cz += TileChunks {
+			tiles = append(tiles, Tile{
+				FromX: cx * chunkBlocks,
+				FromZ: cz * chunkBlocks,
+				ToX:   min(cx+TileChunks-1, maxX)*chunkBlocks + chunkBlocks - 1,
+				ToZ:   min(cz+TileChunks-1, maxZ)*chunkBlocks + chunkBlocks - 1,
+			})
+		}
+	}
+
+	distance := func(t Tile) int {
+		dx := (t.FromX+t.ToX)/2 - x
+		dz := (t.FromZ+t.ToZ)/2 - z
+
+		return dx*dx + dz*dz
+	}
+
+	sort.SliceStable(tiles, func(i, j int) bool {
+		return distance(tiles[i]) < distance(tiles[j])
+	})
+
+	return tiles, nil
+}
+
+// floorDiv divides rounding towards negative infinity, as chunk coordinates
+// do.
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+
+	return q
+}
@@ -0,0 +1,59 @@
+package pregen
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	tiles, err := Plan(0, 0, 200)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+
+	// Chunks -13 to 12 on each axis, 26 chunks in 4 tiles
+	if len(tiles) != 16 {
+		t.Fatalf("Expected 16 tiles, got %d: %+v", len(tiles), tiles)
+	}
+
+	chunks := 0
+
+	for _, tile := range tiles {
+		w := (tile.ToX - tile.FromX + 1) / chunkBlocks
+		h := (tile.ToZ - tile.FromZ + 1) / chunkBlocks
+
+		if w*h > 100 || tile.FromX%chunkBlocks != 0 || (tile.ToX+1)%chunkBlocks != 0 {
+			t.Errorf("Tile %+v isn't a ticking area of whole chunks", tile)
+		}
+
+		chunks += w * h
+	}
+
+	if chunks != 26*26 {
+		t.Errorf("Expected the tiles to cover 676 chunks, got %d", chunks)
+	}
+
+	first := tiles[0]
+	if first.FromX > 0 || first.ToX < 0 || first.FromZ > 0 || first.ToZ < 0 {
+		t.Errorf("Expected the first tile to contain the center, got %+v", first)
+	}
+
+	if cmd := first.Add("pregen"); cmd != "tickingarea add -80 0 -80 47 0 47 pregen true" {
+		t.Errorf("Unexpected command %q", cmd)
+	}
+
+	for _, radius := range []int{0, MaxRadius + 1} {
+		_, err := Plan(0, 0, radius)
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected radius %d to be refused, got %v", radius, err)
+		}
+	}
+}
+
+func TestFloorDiv(t *testing.T) {
+	for _, c := range []struct{ a, want int }{{0, 0}, {15, 0}, {16, 1}, {-1, -1}, {-16, -1}, {-17, -2}} {
+		if got := floorDiv(c.a, 16); got != c.want {
+			t.Errorf("floorDiv(%d, 16) = %d, want %d", c.a, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package promote works out what promoting a staging server to production
+// changes: the packs the staging world uses that production lacks or has in
+// another version, and the server.properties settings that differ.
+package promote
+
+import (
+	"sort"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/packs"
+)
+
+// Identity are the properties that set a server apart from its staging copy,
+// which a promotion leaves alone.
+var Identity = []string{"server-name", "server-port", "server-portv6", "level-name", "level-seed"}
+
+// PackChange is a pack promotion installs on production.
+type PackChange struct {
+	Pack packs.Pack `json:"pack"`           // As on staging
+	From *[3]int    `json:"from,omitempty"` // Version on production, nil if it isn't installed
+}
+
+// PropertyChange is a setting promotion changes on production.
+type PropertyChange struct {
+	Key        string `json:"key"`
+	Staging    string `json:"staging"`
+	Production string `json:"production"` // Empty if not set
+}
+
+// Diff is what a promotion changes on production.
+type Diff struct {
+	Packs      []PackChange     `json:"packs"`
+	Properties []PropertyChange `json:"properties"`
+}
+
+// Empty reports whether production already matches staging.
+func (d Diff) Empty() bool {
+	return len(d.Packs)+len(d.Properties) == 0
+}
+
+// ComparePacks returns the packs used on staging that aren't installed on
+// production in the same version, matched by UUID.
+func ComparePacks(staging, production []packs.Pack) []PackChange {
+	installed := map[string]packs.Pack{}
+	for _, p := range production {
+		installed[p.UUID] = p
+	}
+
+	changes := []PackChange{}
+
+	for _, p := range staging {
+		current, ok := installed[p.UUID]
+
+		switch {
+		case !ok:
+			changes = append(changes, PackChange{Pack: p})
+		case current.Version != p.Version:
+			from := current.Version
+			changes = append(changes, PackChange{Pack: p, From: &from})
+		}
+	}
+
+	return changes
+}
+
+// CompareProperties returns the staging settings that differ on production,
+// sorted by key. Identity properties and settings only production has are
+// left out.
+func CompareProperties(staging, production map[string]string) []PropertyChange {
+	changes := []PropertyChange{}
+
+	for key, value := range staging {
+		if isIdentity(key) || production[key] == value {
+			continue
+		}
+
+		changes = append(changes, PropertyChange{Key: key, Staging: value, Production: production[key]})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+// Settings returns the properties to set on production for the changes.
+func Settings(changes []PropertyChange) map[string]string {
+	settings := make(map[string]string, len(changes))
+	for _, c := range changes {
+		settings[c.Key] = c.Staging
+	}
+
+	return settings
+}
+
+func isIdentity(key string) bool {
+	for _, k := range Identity {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
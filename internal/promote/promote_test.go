@@ -0,0 +1,72 @@
+package promote
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/packs"
+)
+
+func TestComparePacks(t *testing.T) {
+	staging := []packs.Pack{
+		{Kind: packs.KindBehavior, UUID: "same", Version: [3]int{1, 0, 0}},
+		{Kind: packs.KindBehavior, UUID: "newer", Version: [3]int{2, 0, 0}},
+		{Kind: packs.KindResource, UUID: "new", Version: [3]int{1, 0, 0}},
+	}
+	production := []packs.Pack{
+		{Kind: packs.KindBehavior, UUID: "same", Version: [3]int{1, 0, 0}},
+		{Kind: packs.KindBehavior, UUID: "newer", Version: [3]int{1, 2, 0}},
+		{Kind: packs.KindBehavior, UUID: "production-only", Version: [3]int{1, 0, 0}},
+	}
+
+	changes := ComparePacks(staging, production)
+
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %+v", changes)
+	}
+
+	if changes[0].Pack.UUID != "newer" || changes[0].From == nil || *changes[0].From != [3]int{1, 2, 0} {
+		t.Errorf("Expected an update from 1.2.0, got %+v", changes[0])
+	}
+
+	if changes[1].Pack.UUID != "new" || changes[1].From != nil {
+		t.Errorf("Expected a new pack, got %+v", changes[1])
+	}
+}
+
+func TestCompareProperties(t *testing.T) {
+	staging := map[string]string{
+		"server-name":   "Staging",
+		"server-port":   "19200",
+		"difficulty":    "hard",
+		"max-players":   "10",
+		"view-distance": "32",
+	}
+	production := map[string]string{
+		"server-name": "Survival",
+		"server-port": "19132",
+		"difficulty":  "normal",
+		"max-players": "10",
+		"online-mode": "true",
+	}
+
+	changes := CompareProperties(staging, production)
+	want := []PropertyChange{
+		{Key: "difficulty", Staging: "hard", Production: "normal"},
+		{Key: "view-distance", Staging: "32"},
+	}
+
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("CompareProperties() = %+v, want %+v", changes, want)
+	}
+
+	settings := Settings(changes)
+	if !reflect.DeepEqual(settings, map[string]string{"difficulty": "hard", "view-distance": "32"}) {
+		t.Errorf("Unexpected settings %v", settings)
+	}
+
+	diff := Diff{Packs: ComparePacks(nil, nil), Properties: CompareProperties(production, production)}
+	if !diff.Empty() {
+		t.Errorf("Expected no changes, got %+v", diff)
+	}
+}
@@ -0,0 +1,465 @@
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+// defaultWait is how long Check waits for an expected frame by default.
+const defaultWait = 5 * time.Second
+
+// Names of the checks run by Check.
+const (
+	CheckSession = "session" // The first frame is a session frame with an epoch
+	CheckHello   = "hello"   // The session frame carries a valid hello
+	CheckReplay  = "replay"  // The buffered lines up to the session's seq are replayed in order
+	CheckResend  = "resend"  // Resend frames are answered with the lines or a gap, after a hello and an unknown frame
+	CheckResume  = "resume"  // A resume token replays only the lines after it
+	CheckFrames  = "frames"  // Every frame received is well formed
+)
+
+// Options configure Check.
+type Options struct {
+	Header http.Header   // Sent when connecting, e.g. X-Auth-Key
+	Wait   time.Duration // How long to wait for each expected frame; defaults to 5s
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// Report is the outcome of checking a wrapper.
+type Report struct {
+	Hello   *protocol.Hello `json:"hello,omitempty"` // As announced by the wrapper
+	Results []Result        `json:"results"`
+}
+
+// Passed reports whether no check failed.
+func (r Report) Passed() bool {
+	for _, result := range r.Results {
+		if !result.Passed && !result.Skipped {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Report) pass(name, detail string) {
+	r.Results = append(r.Results, Result{Name: name, Passed: true, Detail: detail})
+}
+
+func (r *Report) fail(name, format string, args ...any) {
+	r.Results = append(r.Results, Result{Name: name, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (r *Report) skip(name, detail string) {
+	r.Results = append(r.Results, Result{Name: name, Skipped: true, Detail: detail})
+}
+
+// Check connects to the structured WebSocket endpoint of a wrapper, such as
+// "ws://localhost:8080/ws", and checks that it speaks the protocol the way
+// the central server expects. It returns an error only if it can't connect
+// at all; failed checks are in the report.
+func Check(ctx context.Context, address string, opts Options) (Report, error) {
+	var report Report
+
+	if opts.Wait <= 0 {
+		opts.Wait = defaultWait
+	}
+
+	c, err := dial(ctx, address, "", opts)
+	if err != nil {
+		return report, err
+	}
+	defer c.close()
+
+	session, ok := c.session(&report)
+	if !ok {
+		report.Results = append(report.Results, c.frames())
+		return report, nil
+	}
+
+	checkHello(&report, session)
+	checkReplay(&report, c, session)
+	checkResend(&report, c, session)
+
+	c.close()
+
+	resumed, err := dial(ctx, address, protocol.ResumeToken{
+		Epoch: session.Epoch,
+		Seq:   max(session.Seq, 1) - 1,
+	}.String(), opts)
+	if err != nil {
+		report.fail(CheckResume, "error reconnecting: %v", err)
+	} else {
+		checkResume(&report, resumed, session)
+		resumed.close()
+	}
+
+	if resumed != nil {
+		c.problems = append(c.problems, resumed.problems...)
+	}
+
+	report.Results = append(report.Results, c.frames())
+
+	return report, nil
+}
+
+// checkHello checks the hello of the session frame. Wrappers without one
+// predate the handshake and speak protocol.LegacyVersion.
+func checkHello(report *Report, session protocol.Frame) {
+	hello := session.Hello
+	if hello == nil {
+		report.skip(CheckHello, fmt.Sprintf("no hello, the wrapper is treated as protocol %d", protocol.LegacyVersion))
+		return
+	}
+
+	report.Hello = hello
+
+	switch {
+	case hello.Software == "":
+		report.fail(CheckHello, "hello has no software")
+	case hello.Protocol < protocol.Version:
+		report.fail(CheckHello,
+			"hello announces protocol %d, wrappers sending a hello speak at least %d", hello.Protocol, protocol.Version)
+	default:
+		report.pass(CheckHello,
+			fmt.Sprintf("%s %s, protocol %d, negotiated %d", hello.Software, hello.Version, hello.Protocol,
+				protocol.Negotiate(protocol.Hello{Protocol: protocol.Version}, *hello)))
+	}
+}
+
+// checkReplay checks that the lines up to the session frame's seq are
+// replayed, each line or gap following the previous one.
+func checkReplay(report *Report, c *conn, session protocol.Frame) {
+	if session.Seq == 0 {
+		report.skip(CheckReplay, "the wrapper has no console lines")
+		return
+	}
+
+	for c.last < session.Seq {
+		frame, err := c.console()
+		if err != nil {
+			report.fail(CheckReplay, "expected lines up to %d, got up to %d: %v", session.Seq, c.last, err)
+			return
+		}
+
+		if !c.follows(frame) {
+			report.fail(CheckReplay, "%s frame %s doesn't follow line %d", frame.Type, span(frame), c.last)
+			return
+		}
+
+		c.advance(frame)
+	}
+
+	report.pass(CheckReplay, fmt.Sprintf("lines up to %d", session.Seq))
+}
+
+// checkResend sends a hello and a frame of an unknown type, which the
+// wrapper must accept, and then requests the last line of the session.
+func checkResend(report *Report, c *conn, session protocol.Frame) {
+	if session.Seq == 0 {
+		report.skip(CheckResend, "the wrapper has no console lines")
+		return
+	}
+
+	err := c.send(protocol.Frame{Type: protocol.FrameHello, Hello: &protocol.Hello{
+		Software:     "conformance-check",
+		Version:      "reference",
+		Protocol:     protocol.Version,
+		Capabilities: []string{protocol.CapResume},
+	}})
+	if err == nil {
+		err = c.send(protocol.Frame{Type: "conformance-unknown"})
+	}
+
+	if err == nil {
+		err = c.send(protocol.Frame{Type: protocol.FrameResend, From: session.Seq, To: session.Seq})
+	}
+
+	if err != nil {
+		report.fail(CheckResend, "error sending frames: %v", err)
+		return
+	}
+
+	// Lines printed since the session frame may arrive first
+	for {
+		frame, err := c.read()
+		if err != nil {
+			report.fail(CheckResend, "no reply to resending line %d: %v", session.Seq, err)
+			return
+		}
+
+		if frame.Channel != "" {
+			continue
+		}
+
+		switch {
+		case frame.Type == protocol.FrameLine && frame.Seq == session.Seq:
+			report.pass(CheckResend, fmt.Sprintf("line %d", session.Seq))
+			return
+		case frame.Type == protocol.FrameGap && frame.From <= session.Seq && frame.To >= session.Seq:
+			report.pass(CheckResend, fmt.Sprintf("line %d is no longer buffered", session.Seq))
+			return
+		case frame.Type == protocol.FrameLine && frame.Seq > session.Seq:
+			c.advance(frame)
+		default:
+			report.fail(CheckResend, "expected line %d, got %s frame %s", session.Seq, frame.Type, span(frame))
+			return
+		}
+	}
+}
+
+// checkResume checks that reconnecting with a token for the line before the
+// last one of the first session replays only the last one.
+func checkResume(report *Report, c *conn, first protocol.Frame) {
+	session, ok := c.session(nil)
+	if !ok {
+		report.fail(CheckResume, "no session frame after reconnecting")
+		return
+	}
+
+	if session.Epoch != first.Epoch {
+		report.skip(CheckResume, "the wrapper restarted between connections")
+		return
+	}
+
+	if first.Seq == 0 {
+		report.pass(CheckResume, "same session")
+		return
+	}
+
+	frame, err := c.console()
+	if err != nil {
+		report.fail(CheckResume, "expected line %d: %v", first.Seq, err)
+		return
+	}
+
+	switch {
+	case frame.Type == protocol.FrameLine && frame.Seq == first.Seq:
+		report.pass(CheckResume, fmt.Sprintf("resumed after line %d", first.Seq-1))
+	case frame.Type == protocol.FrameGap && frame.From == first.Seq:
+		report.pass(CheckResume, fmt.Sprintf("resumed after line %d, which is no longer buffered", first.Seq-1))
+	default:
+		report.fail(CheckResume, "expected line %d, got %s frame %s", first.Seq, frame.Type, span(frame))
+	}
+}
+
+// conn is a connection to the wrapper under test.
+type conn struct {
+	ws       *websocket.Conn
+	wait     time.Duration
+	started  bool     // Whether the first frame was received
+	last     uint64   // Last console sequence number received
+	problems []string // Malformed frames received
+}
+
+// dial connects to a wrapper for structured frames, resuming after token
+// unless it is empty.
+func dial(ctx context.Context, address, token string, opts Options) (*conn, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+
+	query := u.Query()
+	query.Set("format", protocol.FormatJSON)
+
+	if token != "" {
+		query.Set("resume", token)
+	}
+
+	u.RawQuery = query.Encode()
+
+	dialer := websocket.Dialer{HandshakeTimeout: opts.Wait}
+
+	ws, resp, err := dialer.DialContext(ctx, u.String(), opts.Header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("error connecting to %s: %w (HTTP status %d)", u.Redacted(), err, resp.StatusCode)
+		}
+
+		return nil, fmt.Errorf("error connecting to %s: %w", u.Redacted(), err)
+	}
+
+	return &conn{ws: ws, wait: opts.Wait}, nil
+}
+
+func (c *conn) close() {
+	_ = c.ws.Close()
+}
+
+// read returns the next frame, noting malformed ones.
+func (c *conn) read() (protocol.Frame, error) {
+	for {
+		err := c.ws.SetReadDeadline(time.Now().Add(c.wait))
+		if err != nil {
+			return protocol.Frame{}, err
+		}
+
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return protocol.Frame{}, err
+		}
+
+		frame, err := protocol.Decode(data)
+		if err != nil {
+			c.problem("%v: %s", err, data)
+			continue
+		}
+
+		// Only the first frame may be a session frame
+		if problem := validate(frame); problem != "" && (c.started || frame.Type != protocol.FrameSession) {
+			c.problem("%s: %s", problem, data)
+		}
+
+		c.started = true
+
+		return frame, nil
+	}
+}
+
+// console returns the next console line or gap frame, skipping frames of
+// other channels.
+func (c *conn) console() (protocol.Frame, error) {
+	for {
+		frame, err := c.read()
+		if err != nil {
+			return frame, err
+		}
+
+		if frame.Channel == "" && (frame.Type == protocol.FrameLine || frame.Type == protocol.FrameGap) {
+			return frame, nil
+		}
+	}
+}
+
+// session reads the first frame, which must be a session frame, recording
+// the outcome in report unless it is nil.
+func (c *conn) session(report *Report) (protocol.Frame, bool) {
+	frame, err := c.read()
+
+	switch {
+	case err != nil:
+		if report != nil {
+			report.fail(CheckSession, "no frame received: %v", err)
+		}
+
+		return frame, false
+	case frame.Type != protocol.FrameSession:
+		if report != nil {
+			report.fail(CheckSession, "the first frame is a %s frame", frame.Type)
+		}
+
+		return frame, false
+	case frame.Epoch == "":
+		if report != nil {
+			report.fail(CheckSession, "the session frame has no epoch")
+		}
+
+		return frame, false
+	}
+
+	if report != nil {
+		report.pass(CheckSession, fmt.Sprintf("epoch %s, seq %d", frame.Epoch, frame.Seq))
+	}
+
+	return frame, true
+}
+
+// follows reports whether a console frame continues after the last one.
+// The replay of a new connection starts at the oldest buffered line.
+func (c *conn) follows(frame protocol.Frame) bool {
+	if c.last == 0 {
+		return true
+	}
+
+	if frame.Type == protocol.FrameGap {
+		return frame.From == c.last+1
+	}
+
+	return frame.Seq == c.last+1
+}
+
+// advance records the last console sequence number of a frame.
+func (c *conn) advance(frame protocol.Frame) {
+	if frame.Type == protocol.FrameGap {
+		c.last = frame.To
+		return
+	}
+
+	c.last = frame.Seq
+}
+
+func (c *conn) send(frame protocol.Frame) error {
+	data, err := frame.Encode()
+	if err != nil {
+		return err
+	}
+
+	err = c.ws.SetWriteDeadline(time.Now().Add(c.wait))
+	if err != nil {
+		return err
+	}
+
+	return c.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *conn) problem(format string, args ...any) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+// frames returns the result of the frames check.
+func (c *conn) frames() Result {
+	if len(c.problems) > 0 {
+		return Result{Name: CheckFrames, Detail: strings.Join(c.problems, "; ")}
+	}
+
+	return Result{Name: CheckFrames, Passed: true}
+}
+
+// validate returns what is wrong with a frame sent by a wrapper, or "".
+func validate(f protocol.Frame) string {
+	switch f.Type {
+	case protocol.FrameSession:
+		return "session frame after the first frame"
+	case protocol.FrameLine:
+		if f.Seq == 0 {
+			return "line frame without seq"
+		}
+
+		if f.Channel != "" {
+			return "line frame on channel " + f.Channel + " without subscribing to it"
+		}
+	case protocol.FrameGap:
+		if f.From == 0 || f.To < f.From {
+			return "gap frame with an invalid range"
+		}
+	case protocol.FrameResend, protocol.FrameHello, protocol.FrameActivity:
+		return f.Type + " frame sent by a wrapper"
+	}
+
+	// Peers ignore frame types they don't know
+	return ""
+}
+
+// span formats the sequence numbers of a frame.
+func span(f protocol.Frame) string {
+	if f.Type == protocol.FrameGap || f.Type == protocol.FrameResend {
+		return fmt.Sprintf("%d-%d", f.From, f.To)
+	}
+
+	return fmt.Sprintf("%d", f.Seq)
+}
@@ -0,0 +1,150 @@
+// Package conformance lets other implementations of the wrapper protocol,
+// such as a wrapper written in Python, verify that they are compatible with
+// this one. It ships golden encodings of every frame, Check to exercise a
+// wrapper's /ws endpoint, and Wrapper, a reference wrapper a central server
+// can connect to. The golden fixtures also keep changes to protocol.Frame
+// from silently breaking the encoding.
+package conformance
+
+import (
+	"embed"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+//go:embed fixtures/*.json
+var fixtureFiles embed.FS
+
+// Fixture is the golden encoding of a frame.
+type Fixture struct {
+	Name  string         // File name in fixtures/ without the extension
+	Data  []byte         // The encoding, without a trailing newline
+	Frame protocol.Frame // The frame it decodes to
+}
+
+// lineTime is when the line in the line_stream fixture was read.
+var lineTime = time.Date(2024, 1, 1, 12, 0, 2, 500000000, time.UTC)
+
+// golden are the frames encoded by the fixtures, by name.
+var golden = map[string]protocol.Frame{
+	"session": {
+		Type:   protocol.FrameSession,
+		Seq:    42,
+		Epoch:  "3f2a9c0d1e4b5a6f",
+		Labels: map[string]string{"environment": "prod", "owner": "ops"},
+		Hello: &protocol.Hello{
+			Software: "minecraft-server-wrapper",
+			Version:  "1.4.0",
+			Protocol: protocol.Version,
+			Capabilities: []string{
+				protocol.CapResume, protocol.CapChannels, protocol.CapFiles, protocol.CapBackups, protocol.CapJobs,
+				protocol.CapLocks, protocol.CapLabels,
+			},
+		},
+	},
+	"session_legacy": {
+		Type:  protocol.FrameSession,
+		Seq:   42,
+		Epoch: "3f2a9c0d1e4b5a6f",
+	},
+	"session_empty": {
+		Type:  protocol.FrameSession,
+		Epoch: "3f2a9c0d1e4b5a6f",
+		Hello: &protocol.Hello{
+			Software:     "minecraft-server-wrapper",
+			Version:      "1.4.0",
+			Protocol:     protocol.Version,
+			Capabilities: []string{protocol.CapResume},
+		},
+	},
+	"line": {
+		Type: protocol.FrameLine,
+		Seq:  43,
+		Text: "[2024-01-01 12:00:00:000 INFO] Player connected: Steve, xuid: 2535400000000000",
+	},
+	"line_truncated": {
+		Type:   protocol.FrameLine,
+		Seq:    44,
+		Text:   "[2024-01-01 12:00:01:000 INFO] Pack Stack - [01]",
+		Length: 8192,
+	},
+	"line_stream": {
+		Type:   protocol.FrameLine,
+		Seq:    45,
+		Text:   "[ERR] NO LOG FILE! - setting up server logging...",
+		Stream: "stderr",
+		Time:   &lineTime,
+	},
+	"line_script": {
+		Type:    protocol.FrameLine,
+		Channel: protocol.ChannelScript,
+		Seq:     7,
+		Text:    "[Scripting] world initialized",
+	},
+	"line_jobs": {
+		Type:    protocol.FrameLine,
+		Channel: protocol.ChannelJobs,
+		Seq:     3,
+		Text:    `{"id":"a1b2c3d4","kind":"export","state":"running","progress":{"done":1048576,"total":4194304}}`,
+	},
+	"line_state": {
+		Type:    protocol.FrameLine,
+		Channel: protocol.ChannelState,
+		Seq:     2,
+		Text:    `{"from":"starting","to":"running","time":"2024-01-01T12:00:00Z","pid":4242}`,
+	},
+	"gap": {
+		Type: protocol.FrameGap,
+		From: 1,
+		To:   9,
+	},
+	"resend": {
+		Type: protocol.FrameResend,
+		From: 40,
+		To:   42,
+	},
+	"activity": {
+		Type: protocol.FrameActivity,
+	},
+	"hello": {
+		Type: protocol.FrameHello,
+		Hello: &protocol.Hello{
+			Software:     "minecraft-server-center",
+			Version:      "1.4.0",
+			Protocol:     protocol.Version,
+			Capabilities: []string{protocol.CapResume, protocol.CapLabels, protocol.CapJobs, protocol.CapMetrics},
+		},
+	},
+}
+
+// Fixtures returns the golden fixtures sorted by name.
+func Fixtures() ([]Fixture, error) {
+	fixtures := make([]Fixture, 0, len(golden))
+
+	for name, frame := range golden {
+		data, err := fixtureFiles.ReadFile("fixtures/" + name + ".json")
+		if err != nil {
+			return nil, fmt.Errorf("error reading fixture %s: %w", name, err)
+		}
+
+		fixtures = append(fixtures, Fixture{Name: name, Data: trimNewline(data), Frame: frame})
+	}
+
+	sort.Slice(fixtures, func(i, j int) bool {
+		return fixtures[i].Name < fixtures[j].Name
+	})
+
+	return fixtures, nil
+}
+
+// trimNewline strips the newline ending a fixture file.
+func trimNewline(data []byte) []byte {
+	for len(data) > 0 && (data[len(data)-1] == '\n' || data[len(data)-1] == '\r') {
+		data = data[:len(data)-1]
+	}
+
+	return data
+}
@@ -0,0 +1,263 @@
+package conformance
+
+import (
+	"context"
+	"flag"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden fixtures")
+
+func TestFixtures_Encode(t *testing.T) {
+	if *update {
+		for name, frame := range golden {
+			data, err := frame.Encode()
+			if err != nil {
+				t.Fatalf("Encode %s failed: %v", name, err)
+			}
+
+			err = os.WriteFile(filepath.Join("fixtures", name+".json"), append(data, '\n'), 0o644)
+			if err != nil {
+				t.Fatalf("Error writing fixture %s: %v", name, err)
+			}
+		}
+	}
+
+	fixtures, err := Fixtures()
+	if err != nil {
+		t.Fatalf("Fixtures failed: %v", err)
+	}
+
+	for _, fixture := range fixtures {
+		data, err := fixture.Frame.Encode()
+		if err != nil {
+			t.Fatalf("Encode %s failed: %v", fixture.Name, err)
+		}
+
+		if string(data) != string(fixture.Data) {
+			t.Errorf("%s: encoding changed\n got: %s\nwant: %s", fixture.Name, data, fixture.Data)
+		}
+	}
+}
+
+func TestFixtures_Decode(t *testing.T) {
+	fixtures, err := Fixtures()
+	if err != nil {
+		t.Fatalf("Fixtures failed: %v", err)
+	}
+
+	for _, fixture := range fixtures {
+		frame, err := protocol.Decode(fixture.Data)
+		if err != nil {
+			t.Fatalf("Decode %s failed: %v", fixture.Name, err)
+		}
+
+		if !reflect.DeepEqual(frame, fixture.Frame) {
+			t.Errorf("%s: decoded %+v, want %+v", fixture.Name, frame, fixture.Frame)
+		}
+	}
+}
+
+func TestFixtures_Complete(t *testing.T) {
+	files, err := fs.Glob(fixtureFiles, "fixtures/*.json")
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+
+	if len(files) != len(golden) {
+		t.Errorf("Expected %d fixtures, found %v", len(golden), files)
+	}
+
+	for _, frameType := range []string{
+		protocol.FrameSession, protocol.FrameLine, protocol.FrameGap, protocol.FrameResend, protocol.FrameHello,
+	} {
+		if _, ok := golden[frameType]; !ok {
+			t.Errorf("No fixture for %s frames", frameType)
+		}
+	}
+}
+
+func TestCheck_Wrapper(t *testing.T) {
+	wrapper := NewWrapper("secret")
+	wrapper.Labels = map[string]string{"environment": "test"}
+
+	// More lines than the wrapper buffers
+	for i := 0; i < wrapperBuffer+20; i++ {
+		wrapper.Emit("line")
+	}
+
+	srv := httptest.NewServer(wrapper)
+	defer srv.Close()
+
+	report, err := Check(context.Background(), wsURL(srv)+"/ws", Options{
+		Header: http.Header{"X-Auth-Key": []string{"secret"}},
+		Wait:   time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	if !report.Passed() {
+		t.Fatalf("Expected the reference wrapper to pass, got %+v", report.Results)
+	}
+
+	for _, result := range report.Results {
+		if result.Skipped {
+			t.Errorf("Unexpected skipped check %+v", result)
+		}
+	}
+
+	if report.Hello == nil || report.Hello.Software != "conformance-wrapper" {
+		t.Errorf("Unexpected hello %+v", report.Hello)
+	}
+
+	if hello := wrapper.CentralHello(); hello == nil || hello.Protocol != protocol.Version {
+		t.Errorf("Expected the wrapper to receive a hello, got %+v", hello)
+	}
+
+	if resends := wrapper.Resends(); len(resends) != 1 || resends[0].From != wrapperBuffer+20 {
+		t.Errorf("Unexpected resend frames %+v", resends)
+	}
+}
+
+func TestCheck_Legacy(t *testing.T) {
+	wrapper := NewWrapper("")
+	wrapper.Hello = protocol.Hello{}
+
+	srv := httptest.NewServer(wrapper)
+	defer srv.Close()
+
+	report, err := Check(context.Background(), wsURL(srv), Options{Wait: time.Second})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	if !report.Passed() {
+		t.Fatalf("Expected a legacy wrapper to pass, got %+v", report.Results)
+	}
+
+	if report.Hello != nil {
+		t.Errorf("Expected no hello, got %+v", report.Hello)
+	}
+
+	skipped := map[string]bool{}
+	for _, result := range report.Results {
+		skipped[result.Name] = result.Skipped
+	}
+
+	if !skipped[CheckHello] || !skipped[CheckReplay] || !skipped[CheckResend] {
+		t.Errorf("Expected hello, replay and resend to be skipped, got %+v", report.Results)
+	}
+}
+
+func TestCheck_Broken(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// A line before the session frame, then a line without seq
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"line","seq":1,"text":"hello"}`))
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"line","text":"hello"}`))
+
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer srv.Close()
+
+	report, err := Check(context.Background(), wsURL(srv), Options{Wait: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	if report.Passed() {
+		t.Fatal("Expected the check to fail")
+	}
+
+	if report.Results[0].Name != CheckSession || report.Results[0].Passed {
+		t.Errorf("Expected the session check to fail, got %+v", report.Results[0])
+	}
+}
+
+func TestCheck_Unauthorized(t *testing.T) {
+	srv := httptest.NewServer(NewWrapper("secret"))
+	defer srv.Close()
+
+	_, err := Check(context.Background(), wsURL(srv), Options{Wait: time.Second})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an HTTP 401 error, got %v", err)
+	}
+}
+
+func TestWrapper_Commands(t *testing.T) {
+	wrapper := NewWrapper("secret")
+	wrapper.Emit("first")
+
+	srv := httptest.NewServer(wrapper)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(srv)+"?format=json&auth=secret", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	err = conn.WriteMessage(websocket.TextMessage, []byte("say hi"))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// The session frame and the buffered line, then a live one
+	wrapper.Emit("second")
+
+	var texts []string
+
+	for len(texts) < 2 {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+
+		frame, err := protocol.Decode(data)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+
+		if frame.Type == protocol.FrameLine {
+			texts = append(texts, frame.Text)
+		}
+	}
+
+	if texts[0] != "first" || texts[1] != "second" {
+		t.Errorf("Unexpected lines %v", texts)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(wrapper.Commands()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if commands := wrapper.Commands(); len(commands) != 1 || commands[0] != "say hi" {
+		t.Errorf("Unexpected commands %v", commands)
+	}
+}
+
+func wsURL(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
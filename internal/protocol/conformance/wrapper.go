@@ -0,0 +1,295 @@
+package conformance
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+const (
+	wrapperBuffer = 100 // Console lines a Wrapper keeps for replay
+	peerBuffer    = 256 // Frames queued for a peer before it is dropped
+)
+
+// Wrapper is a reference wrapper serving structured frames on any path. A
+// central server implementation can connect to it to check that it sends a
+// hello, resumes and requests retransmission correctly. Console lines are
+// produced with Emit.
+type Wrapper struct {
+	Labels map[string]string // Sent in the session frame
+	Hello  protocol.Hello    // Sent in the session frame; a zero Hello sends none, like a legacy wrapper
+
+	authKey  string
+	epoch    string
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	seq      uint64
+	lines    []protocol.Frame
+	peers    map[*peer]bool
+	commands []string
+	resends  []protocol.Frame
+	central  *protocol.Hello
+}
+
+// peer is a client connected to a Wrapper.
+type peer struct {
+	send   chan []byte
+	closed bool // Set under the Wrapper's lock when send is closed
+}
+
+// NewWrapper creates a reference wrapper accepting the key in the
+// X-Auth-Key header or the "auth" query parameter. An empty key accepts
+// any client.
+func NewWrapper(authKey string) *Wrapper {
+	return &Wrapper{
+		Hello: protocol.Hello{
+			Software:     "conformance-wrapper",
+			Version:      "reference",
+			Protocol:     protocol.Version,
+			Capabilities: []string{protocol.CapResume, protocol.CapLabels},
+		},
+		authKey: authKey,
+		epoch:   newEpoch(),
+		peers:   make(map[*peer]bool),
+	}
+}
+
+// Epoch returns the session epoch of the wrapper.
+func (w *Wrapper) Epoch() string {
+	return w.epoch
+}
+
+// Emit buffers a console line and sends it to the connected clients.
+func (w *Wrapper) Emit(text string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.seq++
+	line := protocol.Frame{Type: protocol.FrameLine, Seq: w.seq, Text: text}
+
+	w.lines = append(w.lines, line)
+	if len(w.lines) > wrapperBuffer {
+		w.lines = w.lines[len(w.lines)-wrapperBuffer:]
+	}
+
+	for p := range w.peers {
+		w.queue(p, line)
+	}
+}
+
+// Commands returns the plain text messages clients sent, which a real
+// wrapper writes to the server's console.
+func (w *Wrapper) Commands() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]string(nil), w.commands...)
+}
+
+// Resends returns the resend frames clients sent.
+func (w *Wrapper) Resends() []protocol.Frame {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]protocol.Frame(nil), w.resends...)
+}
+
+// CentralHello returns the hello last sent by a client, or nil if none was.
+func (w *Wrapper) CentralHello() *protocol.Hello {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.central
+}
+
+// ServeHTTP authenticates the client and serves it structured frames,
+// starting with a session frame and the buffered lines it hasn't received.
+func (w *Wrapper) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("X-Auth-Key")
+	if key == "" {
+		key = r.URL.Query().Get("auth")
+	}
+
+	if w.authKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(w.authKey)) != 1 {
+		http.Error(rw, "invalid authentication key", http.StatusUnauthorized)
+		return
+	}
+
+	if r.URL.Query().Get("format") != protocol.FormatJSON {
+		http.Error(rw, "the reference wrapper only serves format=json", http.StatusBadRequest)
+		return
+	}
+
+	var resume *protocol.ResumeToken
+
+	if token := r.URL.Query().Get("resume"); token != "" {
+		t, err := protocol.ParseResumeToken(token)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resume = &t
+	}
+
+	conn, err := w.upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	p := &peer{send: make(chan []byte, peerBuffer)}
+
+	w.mu.Lock()
+	w.replay(p, resume)
+	w.peers[p] = true
+	w.mu.Unlock()
+
+	defer func() {
+		w.mu.Lock()
+		w.drop(p)
+		w.mu.Unlock()
+	}()
+
+	go func() {
+		for data := range p.send {
+			err := conn.WriteMessage(websocket.TextMessage, data)
+			if err != nil {
+				_ = conn.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		w.receive(p, message)
+	}
+}
+
+// replay queues the session frame and the lines after the resume token for
+// a new peer, under the lock.
+func (w *Wrapper) replay(p *peer, resume *protocol.ResumeToken) {
+	session := protocol.Frame{Type: protocol.FrameSession, Seq: w.seq, Epoch: w.epoch, Labels: w.Labels}
+	if w.Hello.Protocol != 0 {
+		hello := w.Hello
+		session.Hello = &hello
+	}
+
+	w.queue(p, session)
+
+	var after uint64
+	if resume != nil && resume.Epoch == w.epoch && resume.Seq <= w.seq {
+		after = resume.Seq
+	}
+
+	w.sendRange(p, after+1, w.seq)
+}
+
+// receive handles a message from a peer. Messages that aren't frames are
+// console commands.
+func (w *Wrapper) receive(p *peer, message []byte) {
+	if len(message) == 0 || message[0] != '{' {
+		w.mu.Lock()
+		w.commands = append(w.commands, string(message))
+		w.mu.Unlock()
+
+		return
+	}
+
+	frame, err := protocol.Decode(message)
+	if err != nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch frame.Type {
+	case protocol.FrameResend:
+		w.resends = append(w.resends, frame)
+
+		if frame.From != 0 && frame.To >= frame.From {
+			w.sendRange(p, frame.From, min(frame.To, w.seq))
+		}
+	case protocol.FrameHello:
+		w.central = frame.Hello
+	}
+}
+
+// sendRange queues the buffered lines from..to for a peer, preceded by a gap
+// frame for those no longer buffered, under the lock.
+func (w *Wrapper) sendRange(p *peer, from, to uint64) {
+	if to < from {
+		return
+	}
+
+	oldest := w.seq + 1
+	if len(w.lines) > 0 {
+		oldest = w.lines[0].Seq
+	}
+
+	if from < oldest {
+		w.queue(p, protocol.Frame{Type: protocol.FrameGap, From: from, To: min(to, oldest-1)})
+	}
+
+	for _, line := range w.lines {
+		if line.Seq >= from && line.Seq <= to {
+			w.queue(p, line)
+		}
+	}
+}
+
+// queue sends a frame to a peer, dropping peers that can't keep up so they
+// reconnect and resume, under the lock.
+func (w *Wrapper) queue(p *peer, frame protocol.Frame) {
+	if p.closed {
+		return
+	}
+
+	data, err := frame.Encode()
+	if err != nil {
+		return
+	}
+
+	select {
+	case p.send <- data:
+	default:
+		w.drop(p)
+	}
+}
+
+// drop disconnects a peer, under the lock.
+func (w *Wrapper) drop(p *peer) {
+	if p.closed {
+		return
+	}
+
+	p.closed = true
+	delete(w.peers, p)
+	close(p.send)
+}
+
+// newEpoch returns a random session epoch.
+func newEpoch() string {
+	b := make([]byte, 8)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,90 @@
+package protocol
+
+const (
+	// Version is the version of the protocol spoken by this build. Wrappers
+	// that don't send a hello in their session frame speak LegacyVersion.
+	Version = 2
+
+	// LegacyVersion is the protocol of wrappers that predate the handshake.
+	LegacyVersion = 1
+
+	// FrameHello is sent by the central server in reply to a session frame
+	// carrying a hello, with its own software, protocol and capabilities.
+	// Wrappers speaking LegacyVersion are never sent one.
+	FrameHello = "hello"
+)
+
+// Capabilities a peer may announce.
+const (
+	CapResume     = "resume"      // Resume tokens, gap and resend frames
+	CapChannels   = "channels"    // Extra channels such as script output and jobs
+	CapFiles      = "files"       // File transfer through /api/files
+	CapBackups    = "backups"     // Snapshot export and import through /api/migration
+	CapJobs       = "jobs"        // Long-running jobs through /api/jobs
+	CapLocks      = "locks"       // Operation lock through /api/lock
+	CapSelfUpdate = "self-update" // Wrapper update and restart through /api/update
+	CapDenyList   = "denylist"    // Deny list through /api/denylist
+	CapWorlds     = "worlds"      // World templates through /api/worlds
+	CapLabels     = "labels"      // Labels in session frames
+	CapMetrics    = "metrics"     // Prometheus metrics
+	CapMOTD       = "motd"        // Server list name editing through /api/motd
+	CapSchedules  = "schedules"   // Settings schedules through /api/schedules
+	CapCapacity   = "capacity"    // Soft player limit through /api/capacity
+	CapTruncation = "truncation"  // Output hints in session frames, trimmed lines and /api/console/line
+	CapStreams    = "streams"     // Stream and read time of console lines in line frames
+	CapLogTime    = "logtime"     // Reconciled Bedrock timestamps of console lines in line frames
+	CapProxy      = "proxy"       // Built-in UDP proxy in front of bedrock_server
+	CapRollback   = "rollback"    // Rollback points taken before risky changes through /api/rollback
+
+	// Deleted worlds, removed packs and replaced config files kept for undo
+	// through /api/trash
+	CapTrash = "trash"
+
+	// Snapshots staged for a checksum-verified, resumable transfer through
+	// /api/migration/transfer
+	CapTransfer = "transfer"
+
+	CapNotices = "notices" // Wording of the restart, countdown and stop notices through /api/notices
+	CapRestart = "restart" // Restarts of bedrock_server, and their count, through /api/server/restart
+	CapState   = "state"   // State of bedrock_server through /api/server/status and the state channel
+)
+
+// LegacyCapabilities are assumed for wrappers that predate the handshake.
+var LegacyCapabilities = []string{CapResume, CapFiles, CapBackups}
+
+// Hello identifies a peer and what it supports.
+type Hello struct {
+	Software     string   `json:"software"`             // e.g. "minecraft-server-wrapper"
+	Version      string   `json:"version"`              // Software version
+	Commit       string   `json:"commit,omitempty"`     // Git commit the software was built from
+	BuildDate    string   `json:"build_date,omitempty"` // RFC 3339
+	Protocol     int      `json:"protocol"`
+	Capabilities []string `json:"capabilities"`
+	Timezone     string   `json:"timezone,omitempty"` // IANA name of the timezone a wrapper evaluates schedules in
+}
+
+// LegacyHello describes a wrapper that predates the handshake.
+func LegacyHello() Hello {
+	return Hello{
+		Software:     "minecraft-server-wrapper",
+		Version:      "unknown",
+		Protocol:     LegacyVersion,
+		Capabilities: LegacyCapabilities,
+	}
+}
+
+// Supports reports whether the peer announced a capability.
+func (h Hello) Supports(capability string) bool {
+	for _, c := range h.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Negotiate returns the protocol version both peers speak.
+func Negotiate(local, remote Hello) int {
+	return min(local.Protocol, remote.Protocol)
+}
@@ -0,0 +1,209 @@
+// Package protocol defines the structured WebSocket frames exchanged between
+// a wrapper and the central server.
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// FormatJSON is the value of the "format" query parameter that selects
+	// structured frames instead of plain text lines.
+	FormatJSON = "json"
+
+	// FrameSession is sent first on every structured connection and carries
+	// the wrapper's session epoch, the latest sequence number, the labels
+	// the wrapper is configured with and its hello.
+	FrameSession = "session"
+
+	// FrameLine carries a single console output line. Line frames are numbered
+	// with monotonically increasing sequence numbers starting at 1.
+	FrameLine = "line"
+
+	// FrameGap reports console lines that could not be replayed because they
+	// are no longer in the wrapper's buffer.
+	FrameGap = "gap"
+
+	// FrameResend is sent by a client to request retransmission of the line
+	// frames From..To from the wrapper's buffer.
+	FrameResend = "resend"
+
+	// FrameActivity is sent by browser clients when their user interacts
+	// with the page, so they aren't disconnected as idle.
+	FrameActivity = "activity"
+
+	// ChannelScript carries script engine (GameTest/@minecraft/server) output.
+	// Clients subscribe to it with the "channels" query parameter. Frames
+	// without a channel belong to the console.
+	ChannelScript = "script"
+
+	// ChannelJobs carries updates of long-running jobs such as downloads and
+	// migrations, the text of each line a JSON encoded job.
+	ChannelJobs = "jobs"
+
+	// ChannelState carries the changes of state of bedrock_server: starting,
+	// running, stopping, stopped or crashed, the text of each line a JSON
+	// encoded transition. The latest are replayed to new clients, the last
+	// being the current state.
+	ChannelState = "state"
+)
+
+// CloseIdle is the WebSocket close code of browser clients disconnected
+// for being idle, with a reason to show.
+const CloseIdle = 4000
+
+// DefaultMaxLineLength is the length in bytes past which console lines are
+// trimmed in line frames. The wrapper keeps the whole line, which clients
+// fetch from /api/console/line?seq= while it is buffered.
+const DefaultMaxLineLength = 4096
+
+// Frame is a structured WebSocket message.
+type Frame struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel,omitempty"` // Empty for the console; sequence numbers are per channel
+	Seq     uint64 `json:"seq,omitempty"`
+	Text    string `json:"text,omitempty"`
+	Epoch   string `json:"epoch,omitempty"`
+	From    uint64 `json:"from,omitempty"`   // First sequence number of the range (gap and resend frames)
+	To      uint64 `json:"to,omitempty"`     // Last sequence number of the range (gap and resend frames)
+	Length  int    `json:"length,omitempty"` // Length in bytes of a line trimmed to Text (line frames), zero if whole
+
+	// Origin of console lines (line frames): the stream of bedrock_server
+	// they were read from, "stdout" or "stderr", or empty for the wrapper's
+	// own lines, and when they were read, in arrival order across streams.
+	// Logged is when bedrock_server logged them by their own timestamp, in
+	// the server's local time, reconciled with the read time into UTC
+	Stream string     `json:"stream,omitempty"`
+	Time   *time.Time `json:"time,omitempty"`
+	Logged *time.Time `json:"logged,omitempty"`
+
+	// Output hints (session frames): clients keep at most MaxLines lines,
+	// the lines the wrapper buffers, and lines longer than MaxLineLength
+	// bytes arrive trimmed
+	MaxLines      int `json:"max_lines,omitempty"`
+	MaxLineLength int `json:"max_line_length,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"` // Metadata such as owner or environment (session frames)
+	Hello  *Hello            `json:"hello,omitempty"`  // Software, protocol and capabilities (session and hello frames)
+}
+
+// Encode returns the JSON encoding of the frame.
+func (f Frame) Encode() ([]byte, error) {
+	return json.Marshal(f)
+}
+
+// Decode parses a JSON frame.
+func Decode(data []byte) (Frame, error) {
+	var f Frame
+
+	err := json.Unmarshal(data, &f)
+	if err != nil {
+		return f, fmt.Errorf("invalid frame: %w", err)
+	}
+
+	if f.Type == "" {
+		return f, fmt.Errorf("invalid frame: missing type")
+	}
+
+	return f, nil
+}
+
+// Truncate trims text to at most limit bytes, without splitting a UTF-8
+// sequence, and reports whether it did. A limit of zero or less keeps text
+// whole.
+func Truncate(text string, limit int) (string, bool) {
+	if limit <= 0 || len(text) <= limit {
+		return text, false
+	}
+
+	end := limit
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+
+	return text[:end], true
+}
+
+// TruncatedText returns what clients without structured frames show for a
+// line trimmed to kept from length bytes.
+func TruncatedText(kept string, length int) string {
+	return fmt.Sprintf("%s… [truncated, %d bytes]", kept, length)
+}
+
+// ResumeToken identifies the last console line a client has received.
+type ResumeToken struct {
+	Epoch string
+	Seq   uint64
+}
+
+// String formats the token as "<epoch>:<seq>".
+func (t ResumeToken) String() string {
+	return t.Epoch + ":" + strconv.FormatUint(t.Seq, 10)
+}
+
+// ParseResumeToken parses a token produced by ResumeToken.String.
+func ParseResumeToken(s string) (ResumeToken, error) {
+	var t ResumeToken
+
+	epoch, seq, ok := strings.Cut(s, ":")
+	if !ok || epoch == "" {
+		return t, fmt.Errorf("invalid resume token %q", s)
+	}
+
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return t, fmt.Errorf("invalid resume token %q: %w", s, err)
+	}
+
+	t.Epoch = epoch
+	t.Seq = n
+
+	return t, nil
+}
+
+// ParseLabels parses labels given as "key=value,key=value". Keys consist of
+// letters, digits, '_', '-' and '.', values may be empty.
+func ParseLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+
+		if !ok || !validLabelKey(key) {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+
+		labels[key] = strings.TrimSpace(value)
+	}
+
+	return labels, nil
+}
+
+// validLabelKey reports whether a label key is non-empty and consists of
+// letters, digits, '_', '-' and '.'.
+func validLabelKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
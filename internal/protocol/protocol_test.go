@@ -0,0 +1,203 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResumeToken_RoundTrip(t *testing.T) {
+	token := ResumeToken{Epoch: "abc123", Seq: 42}
+
+	parsed, err := ParseResumeToken(token.String())
+	if err != nil {
+		t.Fatalf("ParseResumeToken failed: %v", err)
+	}
+
+	if parsed != token {
+		t.Errorf("Expected %+v, got %+v", token, parsed)
+	}
+}
+
+func TestParseResumeToken_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"abc",
+		":12",
+		"abc:",
+		"abc:-1",
+		"abc:notanumber",
+	}
+
+	for _, tt := range tests {
+		_, err := ParseResumeToken(tt)
+		if err == nil {
+			t.Errorf("Expected error for token %q", tt)
+		}
+	}
+}
+
+func TestFrame_EncodeDecode(t *testing.T) {
+	frame := Frame{Type: FrameLine, Seq: 7, Text: "Server started."}
+
+	data, err := frame.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, frame) {
+		t.Errorf("Expected %+v, got %+v", frame, decoded)
+	}
+
+	_, err = Decode([]byte(`{"seq":1}`))
+	if err == nil {
+		t.Error("Expected error for frame without type")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, tc := range []struct {
+		text      string
+		limit     int
+		want      string
+		truncated bool
+	}{
+		{"Server started.", 100, "Server started.", false},
+		{"Server started.", 0, "Server started.", false},
+		{"Server started.", 6, "Server", true},
+		{"Spieler grüßt", 11, "Spieler gr", true}, // ü is two bytes
+		{"Spieler grüßt", 12, "Spieler grü", true},
+	} {
+		got, truncated := Truncate(tc.text, tc.limit)
+		if got != tc.want || truncated != tc.truncated {
+			t.Errorf("Truncate(%q, %d) = %q, %v, expected %q, %v", tc.text, tc.limit, got, truncated, tc.want, tc.truncated)
+		}
+	}
+
+	if got := TruncatedText("Server", 15); got != "Server… [truncated, 15 bytes]" {
+		t.Errorf("Unexpected truncated text %q", got)
+	}
+}
+
+func TestTracker_DetectsGapsAndRecovery(t *testing.T) {
+	var tr Tracker
+
+	for _, seq := range []uint64{1, 2, 3} {
+		obs := tr.Observe(seq)
+		if obs.HasGap() || obs.Duplicate || obs.Recovered {
+			t.Fatalf("Unexpected observation for seq %d: %+v", seq, obs)
+		}
+	}
+
+	obs := tr.Observe(6)
+	if obs.GapFrom != 4 || obs.GapTo != 5 {
+		t.Fatalf("Expected gap 4-5, got %+v", obs)
+	}
+
+	if missing := tr.Missing(); len(missing) != 2 || missing[0] != 4 || missing[1] != 5 {
+		t.Errorf("Expected missing [4 5], got %v", missing)
+	}
+
+	obs = tr.Observe(4)
+	if !obs.Recovered {
+		t.Errorf("Expected seq 4 to be recovered, got %+v", obs)
+	}
+
+	obs = tr.Observe(4)
+	if !obs.Duplicate {
+		t.Errorf("Expected seq 4 to be a duplicate, got %+v", obs)
+	}
+
+	tr.Forget(5, 5)
+
+	if missing := tr.Missing(); len(missing) != 0 {
+		t.Errorf("Expected nothing missing after Forget, got %v", missing)
+	}
+
+	if tr.Last() != 6 {
+		t.Errorf("Expected last 6, got %d", tr.Last())
+	}
+}
+
+func TestTracker_Reset(t *testing.T) {
+	var tr Tracker
+
+	tr.Observe(10)
+	tr.Reset(0)
+
+	obs := tr.Observe(1)
+	if obs.HasGap() || obs.Duplicate {
+		t.Errorf("Expected clean observation after reset, got %+v", obs)
+	}
+}
+
+func TestTracker_CapsMissing(t *testing.T) {
+	var tr Tracker
+
+	tr.Observe(1)
+	tr.Observe(1 + maxMissing*5)
+
+	if n := len(tr.Missing()); n != maxMissing {
+		t.Errorf("Expected %d missing entries, got %d", maxMissing, n)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels("owner=alice, environment=prod,location=,")
+	if err != nil {
+		t.Fatalf("ParseLabels failed: %v", err)
+	}
+
+	want := map[string]string{"owner": "alice", "environment": "prod", "location": ""}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("Expected %v, got %v", want, labels)
+	}
+
+	for _, tt := range []string{"owner", "=alice", "own er=alice", "owner/x=alice"} {
+		_, err := ParseLabels(tt)
+		if err == nil {
+			t.Errorf("Expected error for labels %q", tt)
+		}
+	}
+}
+
+func TestHello_Negotiate(t *testing.T) {
+	wrapper := Hello{
+		Software:     "minecraft-server-wrapper",
+		Version:      "1.5.0",
+		Protocol:     Version,
+		Capabilities: []string{CapResume, CapJobs},
+	}
+
+	data, err := Frame{Type: FrameSession, Epoch: "abc", Hello: &wrapper}.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	frame, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	if frame.Hello == nil || !reflect.DeepEqual(*frame.Hello, wrapper) {
+		t.Fatalf("Expected hello %+v, got %+v", wrapper, frame.Hello)
+	}
+
+	if !frame.Hello.Supports(CapJobs) || frame.Hello.Supports(CapSelfUpdate) {
+		t.Errorf("Unexpected capabilities %v", frame.Hello.Capabilities)
+	}
+
+	legacy := LegacyHello()
+
+	if got := Negotiate(wrapper, legacy); got != LegacyVersion {
+		t.Errorf("Expected protocol %d with a legacy wrapper, got %d", LegacyVersion, got)
+	}
+
+	if legacy.Supports(CapJobs) {
+		t.Error("Expected legacy wrappers not to support jobs")
+	}
+}
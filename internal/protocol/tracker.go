@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"sort"
+)
+
+// maxMissing caps how many missing sequence numbers a Tracker remembers, so a
+// huge jump can't grow memory without bound.
+const maxMissing = 1000
+
+// Observation describes a received sequence number relative to the ones
+// seen before.
+type Observation struct {
+	Duplicate bool   // Already received, or known to be lost
+	Recovered bool   // Filled a previously detected gap (arrived out of order)
+	GapFrom   uint64 // First missing sequence number revealed by this frame
+	GapTo     uint64 // Last missing sequence number revealed by this frame
+}
+
+// HasGap reports whether the observation revealed missing frames.
+func (o Observation) HasGap() bool {
+	return o.GapFrom != 0
+}
+
+// Tracker follows the sequence numbers of received frames to detect dropped,
+// duplicated and reordered messages. The zero value is ready to use.
+type Tracker struct {
+	last    uint64
+	missing map[uint64]struct{}
+}
+
+// Observe records a received sequence number.
+func (t *Tracker) Observe(seq uint64) Observation {
+	var obs Observation
+
+	if seq == 0 {
+		return obs
+	}
+
+	if seq <= t.last {
+		if _, ok := t.missing[seq]; ok {
+			delete(t.missing, seq)
+
+			obs.Recovered = true
+
+			return obs
+		}
+
+		obs.Duplicate = true
+
+		return obs
+	}
+
+	if t.last != 0 && seq > t.last+1 {
+		obs.GapFrom = t.last + 1
+		obs.GapTo = seq - 1
+
+		if t.missing == nil {
+			t.missing = make(map[uint64]struct{})
+		}
+
+		from := obs.GapFrom
+		if obs.GapTo-from >= maxMissing {
+			from = obs.GapTo - maxMissing + 1
+		}
+
+		for n := from; n <= obs.GapTo && len(t.missing) < maxMissing; n++ {
+			t.missing[n] = struct{}{}
+		}
+	}
+
+	t.last = seq
+
+	return obs
+}
+
+// Forget drops the given range from the missing set, for frames the sender
+// reported as no longer available.
+func (t *Tracker) Forget(from, to uint64) {
+	for n := range t.missing {
+		if n >= from && n <= to {
+			delete(t.missing, n)
+		}
+	}
+}
+
+// Reset starts tracking again after the given sequence number.
+func (t *Tracker) Reset(last uint64) {
+	t.last = last
+	t.missing = nil
+}
+
+// Last returns the highest sequence number received.
+func (t *Tracker) Last() uint64 {
+	return t.last
+}
+
+// Missing returns the sequence numbers still missing, in ascending order.
+func (t *Tracker) Missing() []uint64 {
+	missing := make([]uint64, 0, len(t.missing))
+	for n := range t.missing {
+		missing = append(missing, n)
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i] < missing[j]
+	})
+
+	return missing
+}
@@ -0,0 +1,284 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// Entry sources. Fleet entries are managed by the central server and
+// replaced as a whole on every sync, local entries only through the wrapper.
+const (
+	SourceLocal = "local"
+	SourceFleet = "fleet"
+)
+
+var ErrInvalidEntry = errors.New("deny list entries must be an IP address, a CIDR range or a numeric XUID")
+
+// Entry is a blocked IP address, CIDR range or XUID.
+type Entry struct {
+	Value  string    `json:"value"`
+	Reason string    `json:"reason,omitempty"`
+	Source string    `json:"source,omitempty"`
+	Added  time.Time `json:"added"`
+}
+
+// IsXUID reports whether the entry blocks a player's XUID rather than an address.
+func (e Entry) IsXUID() bool {
+	return isXUID(e.Value)
+}
+
+// isXUID reports whether value looks like an XUID.
+func isXUID(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// normalize validates an entry value and returns its canonical form.
+func normalize(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	if isXUID(value) {
+		return value, nil
+	}
+
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return "", ErrInvalidEntry
+		}
+
+		return network.String(), nil
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return "", ErrInvalidEntry
+	}
+
+	return ip.String(), nil
+}
+
+// DenyList is a persisted list of blocked addresses and XUIDs.
+type DenyList struct {
+	path     string
+	mu       sync.RWMutex
+	entries  []Entry
+	networks []*net.IPNet // Parsed address entries
+	xuids    map[string]bool
+}
+
+// OpenDenyList loads the deny list from path, starting empty if the file
+// doesn't exist. An empty path keeps the list in memory only.
+func OpenDenyList(path string) (*DenyList, error) {
+	d := &DenyList{path: path}
+
+	if path == "" {
+		d.index()
+		return d, nil
+	}
+
+	err := jsonfile.Load(path, &d.entries)
+	if err != nil {
+		return nil, fmt.Errorf("error loading deny list: %w", err)
+	}
+
+	d.index()
+
+	return d, nil
+}
+
+// index rebuilds the lookup tables. The caller must hold the lock.
+func (d *DenyList) index() {
+	d.networks = d.networks[:0]
+	d.xuids = make(map[string]bool)
+
+	for _, e := range d.entries {
+		if e.IsXUID() {
+			d.xuids[e.Value] = true
+			continue
+		}
+
+		value := e.Value
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err == nil {
+			d.networks = append(d.networks, network)
+		}
+	}
+}
+
+// save writes the deny list to disk. The caller must hold the lock.
+func (d *DenyList) save() error {
+	if d.path == "" {
+		return nil
+	}
+
+	err := jsonfile.Save(d.path, d.entries)
+	if err != nil {
+		return fmt.Errorf("error saving deny list: %w", err)
+	}
+
+	return nil
+}
+
+// Entries returns the entries sorted by value.
+func (d *DenyList) Entries() []Entry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	entries := make([]Entry, len(d.entries))
+	copy(entries, d.entries)
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Value < entries[j].Value
+	})
+
+	return entries
+}
+
+// Add adds an entry, replacing an existing entry with the same value.
+func (d *DenyList) Add(e Entry) (Entry, error) {
+	value, err := normalize(e.Value)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	e.Value = value
+
+	if e.Source == "" {
+		e.Source = SourceLocal
+	}
+
+	if e.Added.IsZero() {
+		e.Added = time.Now().UTC()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.remove(value)
+	d.entries = append(d.entries, e)
+	d.index()
+
+	return e, d.save()
+}
+
+// Remove removes the entry with the given value and reports whether it existed.
+func (d *DenyList) Remove(value string) (bool, error) {
+	value, err := normalize(value)
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.remove(value) {
+		return false, nil
+	}
+
+	d.index()
+
+	return true, d.save()
+}
+
+// remove drops the entry with value. The caller must hold the lock.
+func (d *DenyList) remove(value string) bool {
+	for i, e := range d.entries {
+		if e.Value == value {
+			d.entries = append(d.entries[:i], d.entries[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Replace replaces all entries from source with the given ones, leaving
+// entries from other sources alone.
+func (d *DenyList) Replace(source string, entries []Entry) error {
+	replaced := make([]Entry, 0, len(entries))
+
+	for _, e := range entries {
+		value, err := normalize(e.Value)
+		if err != nil {
+			return fmt.Errorf("%w: %q", err, e.Value)
+		}
+
+		e.Value = value
+		e.Source = source
+
+		if e.Added.IsZero() {
+			e.Added = time.Now().UTC()
+		}
+
+		replaced = append(replaced, e)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	kept := make([]Entry, 0, len(d.entries)+len(replaced))
+
+	for _, e := range d.entries {
+		if e.Source != source {
+			kept = append(kept, e)
+		}
+	}
+
+	// Entries from the replaced source take precedence over duplicates
+	d.entries = kept
+	for _, e := range replaced {
+		d.remove(e.Value)
+		d.entries = append(d.entries, e)
+	}
+
+	d.index()
+
+	return d.save()
+}
+
+// BlockedIP reports whether ip is covered by an address entry.
+func (d *DenyList) BlockedIP(ip net.IP) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, network := range d.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BlockedXUID reports whether xuid has an entry.
+func (d *DenyList) BlockedXUID(xuid string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.xuids[xuid]
+}
@@ -0,0 +1,229 @@
+// Package proxy forwards Bedrock UDP traffic to bedrock_server and drops
+// packets from blocked addresses before they reach it.
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// sessionIdle is how long a client may stay silent before its upstream
+	// socket is closed. RakNet clients ping well within this.
+	sessionIdle = 30 * time.Second
+
+	maxPacketSize = 1500
+)
+
+// Stats describes the proxy's current state.
+type Stats struct {
+	Sessions int   `json:"sessions"`
+	Dropped  int64 `json:"dropped_packets"` // Packets dropped by the deny list
+
+	LastClientPacket  time.Time `json:"last_client_packet,omitempty"`  // Last packet forwarded to the server
+	LastUpstreamReply time.Time `json:"last_upstream_reply,omitempty"` // Last packet the server sent back
+}
+
+// Unanswered reports whether clients have been sending packets for longer
+// than grace without the server replying, meaning players can't join.
+func (st Stats) Unanswered(grace time.Duration) bool {
+	if st.LastClientPacket.IsZero() {
+		return false
+	}
+
+	return st.LastClientPacket.Sub(st.LastUpstreamReply) > grace
+}
+
+// session is a client and the socket its packets are forwarded through.
+type session struct {
+	client   *net.UDPAddr
+	upstream *net.UDPConn
+}
+
+// Proxy forwards UDP packets between clients and an upstream server.
+type Proxy struct {
+	conn     *net.UDPConn
+	upstream *net.UDPAddr
+	deny     *DenyList
+	sessions map[string]*session
+	mu       sync.Mutex
+	dropped  atomic.Int64
+
+	lastClient atomic.Int64 // Unix nanoseconds
+	lastReply  atomic.Int64
+}
+
+// Listen starts listening on addr for packets to forward to upstream.
+func Listen(addr, upstream string, deny *DenyList) (*Proxy, error) {
+	listenAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy address: %w", err)
+	}
+
+	upstreamAddr, err := net.ResolveUDPAddr("udp", upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream address: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error starting proxy: %w", err)
+	}
+
+	return &Proxy{
+		conn:     conn,
+		upstream: upstreamAddr,
+		deny:     deny,
+		sessions: make(map[string]*session),
+	}, nil
+}
+
+// Addr returns the address the proxy listens on.
+func (p *Proxy) Addr() net.Addr {
+	return p.conn.LocalAddr()
+}
+
+// Stats returns the number of open sessions and dropped packets.
+func (p *Proxy) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := Stats{Sessions: len(p.sessions), Dropped: p.dropped.Load()}
+
+	if t := p.lastClient.Load(); t != 0 {
+		stats.LastClientPacket = time.Unix(0, t).UTC()
+	}
+
+	if t := p.lastReply.Load(); t != 0 {
+		stats.LastUpstreamReply = time.Unix(0, t).UTC()
+	}
+
+	return stats
+}
+
+// Serve forwards packets until the proxy is closed.
+func (p *Proxy) Serve() error {
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		n, client, err := p.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("error reading from client: %w", err)
+		}
+
+		if p.deny != nil && p.deny.BlockedIP(client.IP) {
+			p.dropped.Add(1)
+			p.closeSession(client.String())
+
+			continue
+		}
+
+		s, err := p.session(client)
+		if err != nil {
+			fmt.Printf("Error opening proxy session for %s: %v\n", client, err)
+			continue
+		}
+
+		_, err = s.upstream.Write(buf[:n])
+		if err != nil {
+			fmt.Printf("Error forwarding packet from %s: %v\n", client, err)
+			continue
+		}
+
+		p.lastClient.Store(time.Now().UnixNano())
+	}
+}
+
+// session returns the client's session, opening one if needed.
+func (p *Proxy) session(client *net.UDPAddr) (*session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.sessions[client.String()]
+	if ok {
+		return s, nil
+	}
+
+	upstream, err := net.DialUDP("udp", nil, p.upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	s = &session{client: client, upstream: upstream}
+	p.sessions[client.String()] = s
+
+	go p.reply(s)
+
+	return s, nil
+}
+
+// reply forwards the server's packets back to the client until the session
+// is idle or closed.
+func (p *Proxy) reply(s *session) {
+	defer func() {
+		p.mu.Lock()
+		if p.sessions[s.client.String()] == s {
+			delete(p.sessions, s.client.String())
+		}
+		p.mu.Unlock()
+
+		_ = s.upstream.Close()
+	}()
+
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		err := s.upstream.SetReadDeadline(time.Now().Add(sessionIdle))
+		if err != nil {
+			return
+		}
+
+		n, err := s.upstream.Read(buf)
+		if err != nil {
+			return
+		}
+
+		p.lastReply.Store(time.Now().UnixNano())
+
+		_, err = p.conn.WriteToUDP(buf[:n], s.client)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// closeSession closes the session of a client, if any.
+func (p *Proxy) closeSession(key string) {
+	p.mu.Lock()
+	s, ok := p.sessions[key]
+	delete(p.sessions, key)
+	p.mu.Unlock()
+
+	if ok {
+		_ = s.upstream.Close()
+	}
+}
+
+// Close stops the proxy and closes all sessions.
+func (p *Proxy) Close() error {
+	err := p.conn.Close()
+
+	p.mu.Lock()
+	sessions := p.sessions
+	p.sessions = make(map[string]*session)
+	p.mu.Unlock()
+
+	for _, s := range sessions {
+		_ = s.upstream.Close()
+	}
+
+	return err
+}
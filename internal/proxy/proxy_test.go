@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDenyList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.json")
+
+	deny, err := OpenDenyList(path)
+	if err != nil {
+		t.Fatalf("Failed to open deny list: %v", err)
+	}
+
+	for _, value := range []string{"203.0.113.7", "198.51.100.0/24", "2535416409681153"} {
+		_, err = deny.Add(Entry{Value: value})
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", value, err)
+		}
+	}
+
+	_, err = deny.Add(Entry{Value: "Steve"})
+	if err == nil {
+		t.Errorf("Expected an error for an invalid entry")
+	}
+
+	if !deny.BlockedIP(net.ParseIP("203.0.113.7")) || !deny.BlockedIP(net.ParseIP("198.51.100.42")) {
+		t.Errorf("Expected denied addresses to be blocked")
+	}
+
+	if deny.BlockedIP(net.ParseIP("203.0.113.8")) {
+		t.Errorf("Expected 203.0.113.8 not to be blocked")
+	}
+
+	if !deny.BlockedXUID("2535416409681153") {
+		t.Errorf("Expected the XUID to be blocked")
+	}
+
+	// A fleet sync replaces fleet entries only
+	err = deny.Replace(SourceFleet, []Entry{{Value: "192.0.2.1"}})
+	if err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+
+	err = deny.Replace(SourceFleet, []Entry{{Value: "192.0.2.2"}})
+	if err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+
+	if deny.BlockedIP(net.ParseIP("192.0.2.1")) || !deny.BlockedIP(net.ParseIP("192.0.2.2")) {
+		t.Errorf("Expected fleet entries to be replaced")
+	}
+
+	removed, err := deny.Remove("203.0.113.7")
+	if err != nil || !removed {
+		t.Errorf("Expected 203.0.113.7 to be removed, got %v, %v", removed, err)
+	}
+
+	reopened, err := OpenDenyList(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen deny list: %v", err)
+	}
+
+	if len(reopened.Entries()) != 3 || !reopened.BlockedIP(net.ParseIP("198.51.100.1")) {
+		t.Errorf("Unexpected entries after reopening: %+v", reopened.Entries())
+	}
+}
+
+func TestProxy(t *testing.T) {
+	upstream, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to start upstream: %v", err)
+	}
+	defer upstream.Close()
+
+	// Echo server standing in for bedrock_server
+	go func() {
+		buf := make([]byte, maxPacketSize)
+
+		for {
+			n, addr, err := upstream.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			_, _ = upstream.WriteToUDP(buf[:n], addr)
+		}
+	}()
+
+	deny, _ := OpenDenyList("")
+
+	p, err := Listen("127.0.0.1:0", upstream.LocalAddr().String(), deny)
+	if err != nil {
+		t.Fatalf("Failed to start proxy: %v", err)
+	}
+	defer p.Close()
+
+	go func() { _ = p.Serve() }()
+
+	client, err := net.DialUDP("udp", nil, p.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	defer client.Close()
+
+	exchange := func() bool {
+		_, err := client.Write([]byte("ping"))
+		if err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+
+		_ = client.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+
+		buf := make([]byte, 16)
+		n, err := client.Read(buf)
+
+		return err == nil && string(buf[:n]) == "ping"
+	}
+
+	if !exchange() {
+		t.Fatalf("Expected the packet to be forwarded")
+	}
+
+	if stats := p.Stats(); stats.LastUpstreamReply.IsZero() || stats.Unanswered(time.Second) {
+		t.Errorf("Expected the upstream reply to be recorded: %+v", stats)
+	}
+
+	unanswered := Stats{LastClientPacket: time.Now(), LastUpstreamReply: time.Now().Add(-time.Minute)}
+	if !unanswered.Unanswered(10 * time.Second) {
+		t.Errorf("Expected clients without replies to be reported")
+	}
+
+	_, err = deny.Add(Entry{Value: "127.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	if exchange() {
+		t.Errorf("Expected packets from a denied address to be dropped")
+	}
+
+	stats := p.Stats()
+	if stats.Dropped != 1 || stats.Sessions != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
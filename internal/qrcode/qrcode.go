@@ -0,0 +1,536 @@
+// Package qrcode encodes short texts such as pairing codes as QR codes, to
+// be scanned from a terminal or a web page instead of copied by hand. It
+// supports byte mode at error correction level M, versions 1 to 10, which
+// holds up to 213 bytes.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTooLong is returned for data that doesn't fit in the largest version.
+var ErrTooLong = errors.New("data too long for a QR code")
+
+// quietZone is the light border around a code, in modules.
+const quietZone = 4
+
+// version is the block structure of a version at error correction level M.
+type version struct {
+	ecPerBlock int
+	blocks     []int // Data codewords of each block, short ones first
+	alignment  []int // Centers of the alignment patterns on either axis
+}
+
+var versions = []version{
+	1:  {10, []int{16}, nil},
+	2:  {16, []int{28}, []int{6, 18}},
+	3:  {26, []int{44}, []int{6, 22}},
+	4:  {18, []int{32, 32}, []int{6, 26}},
+	5:  {24, []int{43, 43}, []int{6, 30}},
+	6:  {16, []int{27, 27, 27, 27}, []int{6, 34}},
+	7:  {18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	8:  {22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	9:  {22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	10: {26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+func (v version) dataCodewords() int {
+	n := 0
+	for _, b := range v.blocks {
+		n += b
+	}
+
+	return n
+}
+
+// Code is an encoded QR code.
+type Code struct {
+	Version int
+	size    int
+	dark    [][]bool
+	reserve [][]bool // Function patterns, which aren't masked
+}
+
+// Encode encodes data in the smallest version it fits in.
+func Encode(data string) (*Code, error) {
+	for v := 1; v < len(versions); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+
+		if 4+countBits+8*len(data) > 8*versions[v].dataCodewords() {
+			continue
+		}
+
+		c := newCode(v)
+		c.drawFunctionPatterns()
+		c.drawCodewords(interleave(versions[v], encodeData(data, countBits, versions[v].dataCodewords())))
+		c.applyBestMask()
+
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("%w: %d bytes", ErrTooLong, len(data))
+}
+
+func newCode(v int) *Code {
+	size := 17 + 4*v
+
+	c := &Code{Version: v, size: size, dark: make([][]bool, size), reserve: make([][]bool, size)}
+	for y := range size {
+		c.dark[y] = make([]bool, size)
+		c.reserve[y] = make([]bool, size)
+	}
+
+	return c
+}
+
+// Size returns the width of the code in modules, without the quiet zone.
+func (c *Code) Size() int {
+	return c.size
+}
+
+// Dark reports whether the module at column x and row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.dark[y][x]
+}
+
+// String renders the code for a terminal, two rows per line in half
+// blocks. Light modules are drawn, so it reads right on a dark background.
+func (c *Code) String() string {
+	light := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= c.size || y >= c.size {
+			return true
+		}
+
+		return !c.dark[y][x]
+	}
+
+	var b strings.Builder
+
+	for y := -quietZone; y < c.size+quietZone; y += 2 {
+		for x := -quietZone; x < c.size+quietZone; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// SVG renders the code as an SVG image, scale pixels per module.
+func (c *Code) SVG(scale int) string {
+	width := (c.size + 2*quietZone) * scale
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		width, width, c.size+2*quietZone, c.size+2*quietZone)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="`)
+
+	for y := range c.size {
+		for x := range c.size {
+			if c.dark[y][x] {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x+quietZone, y+quietZone)
+			}
+		}
+	}
+
+	b.WriteString(`"/></svg>`)
+
+	return b.String()
+}
+
+// set draws a function module.
+func (c *Code) set(x, y int, dark bool) {
+	c.dark[y][x] = dark
+	c.reserve[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := range c.size {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.size-4, 3)
+	c.drawFinder(3, c.size-4)
+
+	centers := versions[c.Version].alignment
+	last := len(centers) - 1
+
+	for i, x := range centers {
+		for j, y := range centers {
+			// The corners with finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// Reserved now, drawn once the mask is known
+	c.drawFormat(0)
+	c.drawVersion()
+}
+
+// drawFinder draws a finder pattern and its separator around the center.
+func (c *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= c.size || y >= c.size {
+				continue
+			}
+
+			dist := max(abs(dx), abs(dy))
+			c.set(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// formatBits returns the BCH-coded format information of level M with mask.
+func formatBits(mask int) int {
+	data := mask // Level M is 00
+
+	rem := data
+	for range 10 {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *Code) drawFormat(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	// Around the top left finder
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	// Split between the other two
+	for i := range 8 {
+		c.set(c.size-1-i, 8, bit(i))
+	}
+
+	for i := 8; i < 15; i++ {
+		c.set(8, c.size-15+i, bit(i))
+	}
+
+	c.set(8, c.size-8, true)
+}
+
+// versionBits returns the BCH-coded version information.
+func versionBits(v int) int {
+	rem := v
+	for range 12 {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1f25)
+	}
+
+	return v<<12 | rem
+}
+
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+
+	bits := versionBits(c.Version)
+
+	for i := range 18 {
+		dark := (bits>>i)&1 != 0
+		a, b := c.size-11+i%3, i/3
+
+		c.set(a, b, dark)
+		c.set(b, a, dark)
+	}
+}
+
+// encodeData returns the data codewords of data in byte mode, padded to
+// capacity codewords.
+func encodeData(data string, countBits, capacity int) []byte {
+	var w bitWriter
+
+	w.write(0b0100, 4)
+	w.write(len(data), countBits)
+
+	for i := range len(data) {
+		w.write(int(data[i]), 8)
+	}
+
+	w.write(0, min(4, 8*capacity-w.n))
+
+	for w.n%8 != 0 {
+		w.write(0, 1)
+	}
+
+	for pad := 0xec; len(w.bytes) < capacity; pad ^= 0xec ^ 0x11 {
+		w.write(pad, 8)
+	}
+
+	return w.bytes
+}
+
+type bitWriter struct {
+	bytes []byte
+	n     int
+}
+
+func (w *bitWriter) write(value, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.bytes = append(w.bytes, 0)
+		}
+
+		if (value>>i)&1 != 0 {
+			w.bytes[w.n/8] |= 0x80 >> (w.n % 8)
+		}
+
+		w.n++
+	}
+}
+
+// interleave splits data into the version's blocks, adds their error
+// correction and interleaves the codewords.
+func interleave(v version, data []byte) []byte {
+	blocks := make([][]byte, len(v.blocks))
+	ec := make([][]byte, len(v.blocks))
+
+	for i, n := range v.blocks {
+		blocks[i], data = data[:n], data[n:]
+		ec[i] = reedSolomon(blocks[i], v.ecPerBlock)
+	}
+
+	var out []byte
+
+	for i := range v.blocks[len(v.blocks)-1] {
+		for _, block := range blocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+
+	for i := range v.ecPerBlock {
+		for _, block := range ec {
+			out = append(out, block[i])
+		}
+	}
+
+	return out
+}
+
+// drawCodewords places the codewords in the zigzag of two module columns
+// from the bottom right, skipping function patterns.
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+
+	for right := c.size - 1; right >= 1; right -= 2 {
+		// The vertical timing pattern
+		if right == 6 {
+			right = 5
+		}
+
+		upward := (right+1)&2 == 0
+
+		for vert := range c.size {
+			y := vert
+			if upward {
+				y = c.size - 1 - vert
+			}
+
+			for j := range 2 {
+				x := right - j
+				if c.reserve[y][x] {
+					continue
+				}
+
+				// Remainder bits stay light
+				if i < 8*len(codewords) {
+					c.dark[y][x] = codewords[i/8]&(0x80>>(i%8)) != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// applyMask flips the data modules selected by mask; applying it twice
+// undoes it.
+func (c *Code) applyMask(mask int) {
+	for y := range c.size {
+		for x := range c.size {
+			if !c.reserve[y][x] && masked(mask, x, y) {
+				c.dark[y][x] = !c.dark[y][x]
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask with the lowest penalty, which is easiest
+// to scan.
+func (c *Code) applyBestMask() {
+	best, bestPenalty := 0, -1
+
+	for mask := range 8 {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+
+		penalty := c.penalty()
+		if bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+
+		c.applyMask(mask)
+	}
+
+	c.applyMask(best)
+	c.drawFormat(best)
+}
+
+// penalty scores the code by the four rules of the standard: long runs,
+// 2x2 blocks, finder-like patterns and the balance of dark modules.
+func (c *Code) penalty() int {
+	penalty := 0
+	dark := 0
+
+	for y := range c.size {
+		for x := range c.size {
+			if c.dark[y][x] {
+				dark++
+			}
+
+			if x < c.size-1 && y < c.size-1 {
+				d := c.dark[y][x]
+				if c.dark[y][x+1] == d && c.dark[y+1][x] == d && c.dark[y+1][x+1] == d {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	for i := range c.size {
+		row := make([]bool, c.size)
+		col := make([]bool, c.size)
+
+		for j := range c.size {
+			row[j] = c.dark[i][j]
+			col[j] = c.dark[j][i]
+		}
+
+		penalty += linePenalty(row) + linePenalty(col)
+	}
+
+	total := c.size * c.size
+	penalty += abs(dark*100/total-50) / 5 * 10
+
+	return penalty
+}
+
+var finderLike = [][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// linePenalty scores runs and finder-like patterns in a row or column.
+func linePenalty(line []bool) int {
+	penalty := 0
+
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+
+		if run >= 5 {
+			penalty += run - 2
+		}
+
+		run = 1
+	}
+
+	for i := 0; i+11 <= len(line); i++ {
+		for _, pattern := range finderLike {
+			match := true
+
+			for j, dark := range pattern {
+				if line[i+j] != dark {
+					match = false
+					break
+				}
+			}
+
+			if match {
+				penalty += 40
+			}
+		}
+	}
+
+	return penalty
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
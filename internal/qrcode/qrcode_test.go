@@ -0,0 +1,231 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// HELLO WORLD at version 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := reedSolomon(data, 10)
+	if !bytes.Equal(got, want) {
+		t.Errorf("reedSolomon() = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	if got, want := formatBits(0), 0b101010000010010; got != want {
+		t.Errorf("formatBits(0) = %015b, want %015b", got, want)
+	}
+
+	if got, want := formatBits(5), 0b100000011001110; got != want {
+		t.Errorf("formatBits(5) = %015b, want %015b", got, want)
+	}
+
+	if got, want := versionBits(7), 0b000111110010010100; got != want {
+		t.Errorf("versionBits(7) = %018b, want %018b", got, want)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		data    string
+		version int
+	}{
+		{"a", 1},
+		{"ws://192.168.1.20:8080/ws?pair=ABCD-EFGH-JKLM-NPQR", 4},
+		{strings.Repeat("x", 120), 7},
+		{strings.Repeat("y", 213), 10},
+	}
+
+	for _, tt := range tests {
+		c, err := Encode(tt.data)
+		if err != nil {
+			t.Fatalf("Encode(%d bytes) error = %v", len(tt.data), err)
+		}
+
+		if c.Version != tt.version {
+			t.Errorf("Encode(%d bytes) version = %d, want %d", len(tt.data), c.Version, tt.version)
+		}
+
+		if c.Size() != 17+4*tt.version {
+			t.Errorf("Size() = %d, want %d", c.Size(), 17+4*tt.version)
+		}
+
+		got := decode(t, c)
+		if got != tt.data {
+			t.Errorf("decoded %q, want %q", got, tt.data)
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	_, err := Encode(strings.Repeat("z", 214))
+	if !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode() error = %v, want ErrTooLong", err)
+	}
+}
+
+func TestFinderPatterns(t *testing.T) {
+	c, err := Encode("finder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Centers and corners are dark, the rings around the centers light
+	for _, corner := range [][2]int{{0, 0}, {c.Size() - 7, 0}, {0, c.Size() - 7}} {
+		x, y := corner[0], corner[1]
+
+		if !c.Dark(x, y) || !c.Dark(x+3, y+3) || c.Dark(x+1, y+1) || c.Dark(x+5, y+5) {
+			t.Errorf("finder pattern at (%d, %d) is wrong", x, y)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	c, err := Encode("term")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(c.String(), "\n"), "\n")
+
+	width := c.Size() + 2*quietZone
+	if len(lines) != (width+1)/2 {
+		t.Errorf("got %d lines, want %d", len(lines), (width+1)/2)
+	}
+
+	for _, line := range lines {
+		if n := len([]rune(line)); n != width {
+			t.Fatalf("line is %d runes wide, want %d", n, width)
+		}
+	}
+}
+
+// decode reads a code back: the mask from the format information, then the
+// codewords in the zigzag, checking each block's error correction.
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+
+	bits := 0
+	for i := 0; i <= 5; i++ {
+		bits |= b2i(c.Dark(8, i)) << i
+	}
+
+	bits |= b2i(c.Dark(8, 7))<<6 | b2i(c.Dark(8, 8))<<7 | b2i(c.Dark(7, 8))<<8
+
+	for i := 9; i < 15; i++ {
+		bits |= b2i(c.Dark(14-i, 8)) << i
+	}
+
+	mask := -1
+
+	for m := range 8 {
+		if formatBits(m) == bits {
+			mask = m
+		}
+	}
+
+	if mask < 0 {
+		t.Fatalf("format information %015b matches no mask", bits)
+	}
+
+	c.applyMask(mask)
+	defer c.applyMask(mask)
+
+	v := versions[c.Version]
+
+	var raw bitWriter
+
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+
+		upward := (right+1)&2 == 0
+
+		for vert := range c.size {
+			y := vert
+			if upward {
+				y = c.size - 1 - vert
+			}
+
+			for j := range 2 {
+				if !c.reserve[y][right-j] {
+					raw.write(b2i(c.dark[y][right-j]), 1)
+				}
+			}
+		}
+	}
+
+	codewords := raw.bytes
+
+	// Undo the interleaving
+	blocks := make([][]byte, len(v.blocks))
+	pos := 0
+
+	for i := range v.blocks[len(v.blocks)-1] {
+		for b, n := range v.blocks {
+			if i < n {
+				blocks[b] = append(blocks[b], codewords[pos])
+				pos++
+			}
+		}
+	}
+
+	var data []byte
+
+	for b, block := range blocks {
+		ec := make([]byte, v.ecPerBlock)
+		for i := range ec {
+			ec[i] = codewords[pos+i*len(blocks)+b]
+		}
+
+		if !bytes.Equal(reedSolomon(block, v.ecPerBlock), ec) {
+			t.Errorf("block %d error correction doesn't match", b)
+		}
+
+		data = append(data, block...)
+	}
+
+	// Byte mode header, then the count
+	if data[0]>>4 != 0b0100 {
+		t.Fatalf("mode = %04b, want byte mode", data[0]>>4)
+	}
+
+	read := func(bit, n int) int {
+		value := 0
+		for i := range n {
+			value = value<<1 | int(data[(bit+i)/8]>>(7-(bit+i)%8)&1)
+		}
+
+		return value
+	}
+
+	countBits := 8
+	if c.Version >= 10 {
+		countBits = 16
+	}
+
+	n := read(4, countBits)
+	out := make([]byte, n)
+
+	for i := range n {
+		out[i] = byte(read(4+countBits+8*i, 8))
+	}
+
+	return string(out)
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
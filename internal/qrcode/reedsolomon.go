@@ -0,0 +1,71 @@
+package qrcode
+
+// Arithmetic in GF(256) with the QR code polynomial x^8+x^4+x^3+x^2+1.
+var gfExp, gfLog = func() ([512]byte, [256]byte) {
+	var exp [512]byte
+	var log [256]byte
+
+	x := 1
+	for i := range 255 {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+
+	// Products index past 255 without reducing
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// generator returns the coefficients of (x-a^0)(x-a^1)...(x-a^(n-1)),
+// highest degree first, without the leading one.
+func generator(n int) []byte {
+	poly := []byte{1}
+
+	for i := range n {
+		next := make([]byte, len(poly)+1)
+
+		for j, coef := range poly {
+			next[j] ^= coef
+			next[j+1] ^= gfMul(coef, gfExp[i])
+		}
+
+		poly = next
+	}
+
+	return poly[1:]
+}
+
+// reedSolomon returns the n error correction codewords of data.
+func reedSolomon(data []byte, n int) []byte {
+	gen := generator(n)
+	rem := make([]byte, n)
+
+	for _, b := range data {
+		factor := b ^ rem[0]
+
+		copy(rem, rem[1:])
+		rem[n-1] = 0
+
+		for i, coef := range gen {
+			rem[i] ^= gfMul(coef, factor)
+		}
+	}
+
+	return rem
+}
@@ -0,0 +1,225 @@
+package raknet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Packet types of the UT3 (GameSpy 4) query protocol.
+const (
+	queryHandshake byte = 0x09
+	queryStat      byte = 0x00
+)
+
+// queryTimeout bounds a query, both packets included.
+const queryTimeout = 5 * time.Second
+
+var queryMagic = []byte{0xFE, 0xFD}
+
+// ErrQueryResponse is returned for responses that aren't valid query packets.
+var ErrQueryResponse = errors.New("invalid query response")
+
+// Query is the full status reported by the UT3/GameSpy query protocol, which
+// Bedrock servers answer when enable-query is set, on the query port. Unlike
+// the pong it lists the players and the plugins.
+type Query struct {
+	MOTD         string
+	GameType     string // e.g. "SMP"
+	GameID       string // e.g. "MINECRAFTPE"
+	Version      string
+	ServerEngine string   // e.g. "PocketMine-MP 5.0.0", empty for vanilla servers
+	Plugins      []string // Plugins with their versions, e.g. "Essentials v1.2"
+	Map          string   // Level name
+	PlayerCount  int
+	MaxPlayers   int
+	HostPort     int
+	HostIP       string
+	Players      []string
+	Fields       map[string]string // All key/value pairs, including unknown ones
+}
+
+// GetQuery requests the full status of the server at addr with the query
+// protocol.
+func GetQuery(addr string) (Query, error) {
+	var q Query
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return q, fmt.Errorf("error querying %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(queryTimeout))
+	if err != nil {
+		return q, fmt.Errorf("error querying %s: %w", addr, err)
+	}
+
+	session, err := querySession()
+	if err != nil {
+		return q, fmt.Errorf("error querying %s: %w", addr, err)
+	}
+
+	// The handshake returns the challenge token the stat request must carry
+	data, err := queryExchange(conn, queryRequest(queryHandshake, session, nil))
+	if err != nil {
+		return q, fmt.Errorf("error querying %s: %w", addr, err)
+	}
+
+	payload, err := queryPayload(data, queryHandshake, session)
+	if err != nil {
+		return q, fmt.Errorf("error querying %s: %w", addr, err)
+	}
+
+	token, err := strconv.ParseInt(string(bytes.TrimRight(payload, "\x00")), 10, 32)
+	if err != nil {
+		return q, fmt.Errorf("error querying %s: %w: challenge token %q", addr, ErrQueryResponse, payload)
+	}
+
+	// Padding after the token selects the full stat rather than the basic one
+	request := binary.BigEndian.AppendUint32(nil, uint32(token))
+	request = append(request, 0x00, 0x00, 0x00, 0x00)
+
+	data, err = queryExchange(conn, queryRequest(queryStat, session, request))
+	if err != nil {
+		return q, fmt.Errorf("error querying %s: %w", addr, err)
+	}
+
+	payload, err = queryPayload(data, queryStat, session)
+	if err != nil {
+		return q, fmt.Errorf("error querying %s: %w", addr, err)
+	}
+
+	q, err = parseFullStat(payload)
+	if err != nil {
+		return q, fmt.Errorf("error querying %s: %w", addr, err)
+	}
+
+	return q, nil
+}
+
+// querySession returns a random session ID. Only the low 4 bits of each
+// byte are used by servers.
+func querySession() (uint32, error) {
+	b := make([]byte, 4)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return 0, fmt.Errorf("error generating session: %w", err)
+	}
+
+	return binary.BigEndian.Uint32(b) & 0x0F0F0F0F, nil
+}
+
+// queryRequest encodes a request packet.
+func queryRequest(packetType byte, session uint32, payload []byte) []byte {
+	packet := append([]byte{}, queryMagic...)
+	packet = append(packet, packetType)
+	packet = binary.BigEndian.AppendUint32(packet, session)
+
+	return append(packet, payload...)
+}
+
+// queryExchange sends a request and reads the response.
+func queryExchange(conn net.Conn, request []byte) ([]byte, error) {
+	_, err := conn.Write(request)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 65535)
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
+
+// queryPayload checks the type and session of a response and returns the
+// rest of it.
+func queryPayload(data []byte, packetType byte, session uint32) ([]byte, error) {
+	if len(data) < 5 || data[0] != packetType || binary.BigEndian.Uint32(data[1:5]) != session {
+		return nil, ErrQueryResponse
+	}
+
+	return data[5:], nil
+}
+
+// parseFullStat parses the payload of a full stat response: padding, the
+// key/value section ending with an empty key, padding and the player names
+// ending with an empty name, all strings null-terminated.
+func parseFullStat(payload []byte) (Query, error) {
+	var q Query
+
+	// "splitnum\x00\x80\x00"
+	const padding = 11
+
+	if len(payload) < padding {
+		return q, fmt.Errorf("%w: short full stat", ErrQueryResponse)
+	}
+
+	fields, rest, ok := bytes.Cut(payload[padding:], []byte("\x00\x00\x01player_\x00\x00"))
+	if !ok {
+		return q, fmt.Errorf("%w: missing player section", ErrQueryResponse)
+	}
+
+	parts := strings.Split(string(fields), "\x00")
+	if len(parts)%2 != 0 {
+		return q, fmt.Errorf("%w: unpaired key %q", ErrQueryResponse, parts[len(parts)-1])
+	}
+
+	q.Fields = make(map[string]string, len(parts)/2)
+	for i := 0; i < len(parts); i += 2 {
+		q.Fields[parts[i]] = parts[i+1]
+	}
+
+	q.MOTD = q.Fields["hostname"]
+	q.GameType = q.Fields["gametype"]
+	q.GameID = q.Fields["game_id"]
+	q.Version = q.Fields["version"]
+	q.Map = q.Fields["map"]
+	q.HostIP = q.Fields["hostip"]
+	q.PlayerCount, _ = strconv.Atoi(q.Fields["numplayers"])
+	q.MaxPlayers, _ = strconv.Atoi(q.Fields["maxplayers"])
+	q.HostPort, _ = strconv.Atoi(q.Fields["hostport"])
+	q.ServerEngine, q.Plugins = parsePlugins(q.Fields["plugins"])
+
+	q.Players = []string{}
+	for _, name := range strings.Split(string(rest), "\x00") {
+		if name == "" {
+			break
+		}
+
+		q.Players = append(q.Players, name)
+	}
+
+	return q, nil
+}
+
+// parsePlugins splits the plugins field, "<engine>: <plugin>; <plugin>",
+// into the server engine and the plugins.
+func parsePlugins(s string) (string, []string) {
+	plugins := []string{}
+
+	engine, list, ok := strings.Cut(s, ":")
+	if !ok {
+		return strings.TrimSpace(s), plugins
+	}
+
+	for _, plugin := range strings.Split(list, ";") {
+		plugin = strings.TrimSpace(plugin)
+		if plugin != "" {
+			plugins = append(plugins, plugin)
+		}
+	}
+
+	return strings.TrimSpace(engine), plugins
+}
@@ -0,0 +1,119 @@
+package raknet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+const fullStat = "splitnum\x00\x80\x00" +
+	"hostname\x00Dedicated Server\x00gametype\x00SMP\x00game_id\x00MINECRAFTPE\x00" +
+	"version\x001.21.50\x00server_engine\x00\x00" +
+	"plugins\x00PocketMine-MP 5.21.0: Essentials v1.2; WorldGuard v3.0\x00" +
+	"map\x00Bedrock level\x00numplayers\x002\x00maxplayers\x0010\x00" +
+	"whitelist\x00off\x00hostip\x000.0.0.0\x00hostport\x0019132\x00\x00" +
+	"\x01player_\x00\x00Steve\x00Alex\x00\x00"
+
+// serveQuery answers one handshake and one full stat request like a server
+// with enable-query set, returning its address.
+func serveQuery(t *testing.T, stat string) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			packet := buf[:n]
+			if n < 7 || !bytes.Equal(packet[:2], queryMagic) {
+				continue
+			}
+
+			response := append([]byte{packet[2]}, packet[3:7]...)
+
+			switch packet[2] {
+			case queryHandshake:
+				response = append(response, "9513307\x00"...)
+			case queryStat:
+				if n != 15 || binary.BigEndian.Uint32(packet[7:11]) != 9513307 {
+					continue
+				}
+
+				response = append(response, stat...)
+			}
+
+			_, _ = conn.WriteTo(response, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestGetQuery(t *testing.T) {
+	q, err := GetQuery(serveQuery(t, fullStat))
+	if err != nil {
+		t.Fatalf("GetQuery failed: %v", err)
+	}
+
+	if q.MOTD != "Dedicated Server" || q.GameID != "MINECRAFTPE" || q.Version != "1.21.50" || q.Map != "Bedrock level" {
+		t.Errorf("Unexpected query %+v", q)
+	}
+
+	if q.PlayerCount != 2 || q.MaxPlayers != 10 || q.HostPort != 19132 {
+		t.Errorf("Unexpected counts %d/%d, port %d", q.PlayerCount, q.MaxPlayers, q.HostPort)
+	}
+
+	if !reflect.DeepEqual(q.Players, []string{"Steve", "Alex"}) {
+		t.Errorf("Unexpected players %v", q.Players)
+	}
+
+	if q.ServerEngine != "PocketMine-MP 5.21.0" ||
+		!reflect.DeepEqual(q.Plugins, []string{"Essentials v1.2", "WorldGuard v3.0"}) {
+		t.Errorf("Unexpected plugins %q %v", q.ServerEngine, q.Plugins)
+	}
+
+	if value, ok := q.Fields["server_engine"]; !ok || value != "" {
+		t.Errorf("Expected the empty server_engine field, got %q, %v", value, ok)
+	}
+}
+
+func TestGetQuery_Invalid(t *testing.T) {
+	_, err := GetQuery(serveQuery(t, "splitnum\x00\x80\x00hostname\x00Dedicated Server\x00"))
+	if !errors.Is(err, ErrQueryResponse) {
+		t.Errorf("Expected ErrQueryResponse, got %v", err)
+	}
+}
+
+func TestParsePlugins(t *testing.T) {
+	tests := []struct {
+		in      string
+		engine  string
+		plugins []string
+	}{
+		{"", "", []string{}},
+		{"PocketMine-MP 5.21.0", "PocketMine-MP 5.21.0", []string{}},
+		{"PocketMine-MP 5.21.0: ", "PocketMine-MP 5.21.0", []string{}},
+		{"Nukkit: A v1; B v2", "Nukkit", []string{"A v1", "B v2"}},
+	}
+
+	for _, tt := range tests {
+		engine, plugins := parsePlugins(tt.in)
+		if engine != tt.engine || !reflect.DeepEqual(plugins, tt.plugins) {
+			t.Errorf("parsePlugins(%q) = %q, %v, want %q, %v", tt.in, engine, plugins, tt.engine, tt.plugins)
+		}
+	}
+}
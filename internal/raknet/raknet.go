@@ -2,12 +2,22 @@ package raknet
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/sandertv/go-raknet"
 )
 
+// DefaultTimeout bounds a ping attempt unless PingOptions sets a timeout.
+const DefaultTimeout = 5 * time.Second
+
+// ErrPongResponse is returned for pongs missing the required fields.
+var ErrPongResponse = errors.New("invalid pong")
+
 type Pong struct {
 	Edition         string
 	ServerName      string // also called MOTD line 1
@@ -23,30 +33,167 @@ type Pong struct {
 	IPv6Port        int
 }
 
+// Port returns the port the server advertised in the pong for IPv6 or IPv4
+// clients, or zero if it left the field out or it isn't a valid port.
+func (p Pong) Port(ipv6 bool) int {
+	port := p.IPv4Port
+	if ipv6 {
+		port = p.IPv6Port
+	}
+
+	if port <= 0 || port > 65535 {
+		return 0
+	}
+
+	return port
+}
+
+// PingOptions configure GetPongContext, Ping and PingMany.
+type PingOptions struct {
+	Timeout    time.Duration // Of each attempt; DefaultTimeout if zero
+	Retries    int           // Attempts after the first one fails
+	RetryDelay time.Duration // Between attempts
+}
+
+// PingResult is the outcome of pinging an address.
+type PingResult struct {
+	Addr string
+	Pong Pong
+	RTT  time.Duration // Of the successful attempt
+	Err  error
+}
+
+// GetPong pings addr once with DefaultTimeout.
 func GetPong(addr string) (Pong, error) {
-	var msg Pong
+	return GetPongContext(context.Background(), addr, PingOptions{})
+}
+
+// GetPongContext pings addr, retrying failed attempts, until ctx is done.
+func GetPongContext(ctx context.Context, addr string, opts PingOptions) (Pong, error) {
+	result := Ping(ctx, addr, opts)
+
+	return result.Pong, result.Err
+}
+
+// PingMany pings addrs concurrently with at most workers pings in flight and
+// returns the results in the order of addrs. Addresses not pinged before ctx
+// is done fail with its error.
+func PingMany(ctx context.Context, addrs []string, workers int, opts PingOptions) []PingResult {
+	results := make([]PingResult, len(addrs))
+	if len(addrs) == 0 {
+		return results
+	}
+
+	workers = max(1, min(workers, len(addrs)))
+
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				results[i] = Ping(ctx, addrs[i], opts)
+			}
+		}()
+	}
 
-	data, err := raknet.Ping(addr)
-	if err != nil {
-		return msg, fmt.Errorf("error pinging %s: %w", addr, err)
+	for i := range addrs {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			results[i] = PingResult{Addr: addrs[i], Err: fmt.Errorf("error pinging %s: %w", addrs[i], ctx.Err())}
+		}
 	}
 
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// Ping pings addr until an attempt succeeds, the retries are used up or ctx
+// is done.
+func Ping(ctx context.Context, addr string, opts PingOptions) PingResult {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	var err error
+
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 && opts.RetryDelay > 0 {
+			select {
+			case <-time.After(opts.RetryDelay):
+			case <-ctx.Done():
+				return PingResult{Addr: addr, Err: fmt.Errorf("error pinging %s: %w", addr, ctx.Err())}
+			}
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+
+		var data []byte
+
+		data, err = raknet.PingContext(attemptCtx, addr)
+
+		cancel()
+
+		if err == nil {
+			var pong Pong
+
+			pong, err = parsePong(data)
+			if err == nil {
+				return PingResult{Addr: addr, Pong: pong, RTT: time.Since(start)}
+			}
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return PingResult{Addr: addr, Err: fmt.Errorf("error pinging %s: %w", addr, err)}
+}
+
+// parsePong parses the semicolon separated fields of a pong. Servers may
+// leave out the fields after the server ID.
+func parsePong(data []byte) (Pong, error) {
+	var msg Pong
+
 	arr := bytes.Split(data, []byte(";"))
+	if len(arr) < 7 {
+		return msg, fmt.Errorf("%w: %d fields", ErrPongResponse, len(arr))
+	}
+
+	field := func(i int) string {
+		if i < len(arr) {
+			return string(arr[i])
+		}
+
+		return ""
+	}
 
 	msg = Pong{
-		Edition:     string(arr[0]),
-		ServerName:  string(arr[1]),
-		VersionName: string(arr[3]),
-		ServerID:    string(arr[6]),
-		LevelName:   string(arr[7]),
-		GameMode:    string(arr[8]),
-	}
-
-	msg.PlayerCount, _ = strconv.Atoi(string(arr[4]))
-	msg.MaxPlayerCount, _ = strconv.Atoi(string(arr[5]))
-	msg.GameModeInt, _ = strconv.Atoi(string(arr[9]))
-	msg.IPv4Port, _ = strconv.Atoi(string(arr[10]))
-	msg.IPv6Port, _ = strconv.Atoi(string(arr[11]))
+		Edition:     field(0),
+		ServerName:  field(1),
+		VersionName: field(3),
+		ServerID:    field(6),
+		LevelName:   field(7),
+		GameMode:    field(8),
+	}
+
+	msg.ProtocolVersion, _ = strconv.Atoi(field(2))
+	msg.PlayerCount, _ = strconv.Atoi(field(4))
+	msg.MaxPlayerCount, _ = strconv.Atoi(field(5))
+	msg.GameModeInt, _ = strconv.Atoi(field(9))
+	msg.IPv4Port, _ = strconv.Atoi(field(10))
+	msg.IPv6Port, _ = strconv.Atoi(field(11))
 
 	return msg, nil
 }
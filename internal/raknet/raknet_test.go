@@ -0,0 +1,161 @@
+package raknet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sandertv/go-raknet"
+)
+
+const pongData = "MCPE;Dedicated Server;766;1.21.50;3;10;13253860892328930865;Bedrock level;Survival;1;19132;19133;"
+
+// listen starts a RakNet listener answering pings with data.
+func listen(t *testing.T, data string) string {
+	t.Helper()
+
+	l, err := raknet.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	t.Cleanup(func() { _ = l.Close() })
+
+	l.PongData([]byte(data))
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			_ = conn.Close()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// silent returns the address of a UDP socket that never answers.
+func silent(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn.LocalAddr().String()
+}
+
+func TestGetPong(t *testing.T) {
+	pong, err := GetPong(listen(t, pongData))
+	if err != nil {
+		t.Fatalf("GetPong failed: %v", err)
+	}
+
+	want := Pong{
+		Edition:         "MCPE",
+		ServerName:      "Dedicated Server",
+		ProtocolVersion: 766,
+		VersionName:     "1.21.50",
+		PlayerCount:     3,
+		MaxPlayerCount:  10,
+		ServerID:        "13253860892328930865",
+		LevelName:       "Bedrock level",
+		GameMode:        "Survival",
+		GameModeInt:     1,
+		IPv4Port:        19132,
+		IPv6Port:        19133,
+	}
+
+	if pong != want {
+		t.Errorf("Unexpected pong %+v", pong)
+	}
+}
+
+func TestGetPongContext_Timeout(t *testing.T) {
+	start := time.Now()
+
+	_, err := GetPongContext(context.Background(), silent(t), PingOptions{Timeout: 50 * time.Millisecond, Retries: 2})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Expected three attempts of 50ms, took %s", elapsed)
+	}
+}
+
+func TestGetPongContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := GetPongContext(ctx, silent(t), PingOptions{Retries: 5, RetryDelay: time.Second})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestParsePong_Short(t *testing.T) {
+	_, err := parsePong([]byte("MCPE;Dedicated Server;766"))
+	if !errors.Is(err, ErrPongResponse) {
+		t.Errorf("Expected ErrPongResponse, got %v", err)
+	}
+
+	pong, err := parsePong([]byte("MCPE;Dedicated Server;766;1.21.50;3;10;1"))
+	if err != nil || pong.ServerID != "1" || pong.LevelName != "" {
+		t.Errorf("Expected a pong without the optional fields, got %+v, %v", pong, err)
+	}
+}
+
+func TestPongPort(t *testing.T) {
+	pong, err := parsePong([]byte(pongData))
+	if err != nil {
+		t.Fatalf("parsePong failed: %v", err)
+	}
+
+	if pong.Port(false) != 19132 || pong.Port(true) != 19133 {
+		t.Errorf("Expected ports 19132 and 19133, got %d and %d", pong.Port(false), pong.Port(true))
+	}
+
+	pong, err = parsePong([]byte("MCPE;Dedicated Server;766;1.21.50;3;10;1;Bedrock level;Survival;1;70000"))
+	if err != nil || pong.Port(false) != 0 || pong.Port(true) != 0 {
+		t.Errorf("Expected no ports for an invalid or missing field, got %+v, %v", pong, err)
+	}
+}
+
+func TestPingMany(t *testing.T) {
+	up := listen(t, pongData)
+	down := silent(t)
+
+	addrs := []string{up, down, up, up}
+
+	results := PingMany(context.Background(), addrs, 2, PingOptions{Timeout: 200 * time.Millisecond})
+	if len(results) != len(addrs) {
+		t.Fatalf("Expected %d results, got %d", len(addrs), len(results))
+	}
+
+	for i, result := range results {
+		if result.Addr != addrs[i] {
+			t.Errorf("Result %d is for %s, want %s", i, result.Addr, addrs[i])
+		}
+
+		if (result.Err == nil) != (addrs[i] == up) {
+			t.Errorf("Unexpected result for %s: %+v", addrs[i], result)
+		}
+
+		if result.Err == nil && (result.Pong.PlayerCount != 3 || result.RTT <= 0) {
+			t.Errorf("Unexpected pong %+v", result)
+		}
+	}
+
+	if len(PingMany(context.Background(), nil, 4, PingOptions{})) != 0 {
+		t.Error("Expected no results without addresses")
+	}
+}
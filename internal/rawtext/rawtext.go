@@ -0,0 +1,279 @@
+// Package rawtext builds Bedrock tellraw and titleraw commands from
+// structured messages.
+package rawtext
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Displays a message can be shown in.
+const (
+	DisplayChat      = "chat"
+	DisplayTitle     = "title"
+	DisplaySubtitle  = "subtitle"
+	DisplayActionbar = "actionbar"
+)
+
+var ErrInvalid = errors.New("invalid message")
+
+// Colors maps color names to their formatting codes.
+var Colors = map[string]string{
+	"black":              "0",
+	"dark_blue":          "1",
+	"dark_green":         "2",
+	"dark_aqua":          "3",
+	"dark_red":           "4",
+	"dark_purple":        "5",
+	"gold":               "6",
+	"gray":               "7",
+	"dark_gray":          "8",
+	"blue":               "9",
+	"green":              "a",
+	"aqua":               "b",
+	"red":                "c",
+	"light_purple":       "d",
+	"yellow":             "e",
+	"white":              "f",
+	"minecoin_gold":      "g",
+	"material_quartz":    "h",
+	"material_iron":      "i",
+	"material_netherite": "j",
+	"material_redstone":  "m",
+	"material_copper":    "n",
+	"material_gold":      "p",
+	"material_emerald":   "q",
+	"material_diamond":   "s",
+	"material_lapis":     "t",
+	"material_amethyst":  "u",
+}
+
+// selectorPattern matches target selectors like @a or @p[r=10].
+var selectorPattern = regexp.MustCompile(`^@(a|e|p|r|s|initiator)(\[[^\[\]"]*\])?$`)
+
+// Score shows a scoreboard value.
+type Score struct {
+	Name      string `json:"name"`
+	Objective string `json:"objective"`
+}
+
+// Part is a piece of a message: text, a translation key, the names matched
+// by a selector, or a score. Formatting applies to the part only.
+type Part struct {
+	Text       string   `json:"text,omitempty"`
+	Translate  string   `json:"translate,omitempty"`
+	With       []string `json:"with,omitempty"` // Translation arguments
+	Selector   string   `json:"selector,omitempty"`
+	Score      *Score   `json:"score,omitempty"`
+	Color      string   `json:"color,omitempty"`
+	Bold       bool     `json:"bold,omitempty"`
+	Italic     bool     `json:"italic,omitempty"`
+	Obfuscated bool     `json:"obfuscated,omitempty"`
+}
+
+// Times are the title fade in, stay and fade out times in ticks.
+type Times struct {
+	FadeIn  int `json:"fade_in"`
+	Stay    int `json:"stay"`
+	FadeOut int `json:"fade_out"`
+}
+
+// Message is a message for some players.
+type Message struct {
+	Target  string `json:"target,omitempty"`  // Selector or player name, @a if empty
+	Display string `json:"display,omitempty"` // chat if empty
+	Parts   []Part `json:"parts"`
+	Times   *Times `json:"times,omitempty"` // Titles only
+}
+
+// Text returns a message of plain text for everyone in chat.
+func Text(text string) Message {
+	return Message{Parts: []Part{{Text: text}}}
+}
+
+// formatting returns the formatting codes for a part.
+func (p Part) formatting() (string, error) {
+	var codes strings.Builder
+
+	if p.Color != "" {
+		code, ok := Colors[p.Color]
+		if !ok {
+			return "", fmt.Errorf("%w: unknown color %q (known: %s)", ErrInvalid, p.Color, colorNames())
+		}
+
+		codes.WriteString("§" + code)
+	}
+
+	if p.Bold {
+		codes.WriteString("§l")
+	}
+
+	if p.Italic {
+		codes.WriteString("§o")
+	}
+
+	if p.Obfuscated {
+		codes.WriteString("§k")
+	}
+
+	return codes.String(), nil
+}
+
+// component returns the rawtext component for a part.
+func (p Part) component() (map[string]any, error) {
+	kinds := 0
+	for _, set := range []bool{p.Text != "", p.Translate != "", p.Selector != "", p.Score != nil} {
+		if set {
+			kinds++
+		}
+	}
+
+	if kinds != 1 {
+		return nil, fmt.Errorf("%w: a part needs exactly one of text, translate, selector or score", ErrInvalid)
+	}
+
+	switch {
+	case p.Translate != "":
+		c := map[string]any{"translate": p.Translate}
+		if len(p.With) > 0 {
+			c["with"] = p.With
+		}
+
+		return c, nil
+	case p.Selector != "":
+		if !selectorPattern.MatchString(p.Selector) {
+			return nil, fmt.Errorf("%w: invalid selector %q", ErrInvalid, p.Selector)
+		}
+
+		return map[string]any{"selector": p.Selector}, nil
+	case p.Score != nil:
+		if p.Score.Name == "" || p.Score.Objective == "" {
+			return nil, fmt.Errorf("%w: a score needs a name and objective", ErrInvalid)
+		}
+
+		return map[string]any{"score": map[string]string{"name": p.Score.Name, "objective": p.Score.Objective}}, nil
+	default:
+		return map[string]any{"text": p.Text}, nil
+	}
+}
+
+// JSON returns the rawtext JSON of the message parts.
+func (m Message) JSON() (string, error) {
+	if len(m.Parts) == 0 {
+		return "", fmt.Errorf("%w: no parts", ErrInvalid)
+	}
+
+	rawtext := []map[string]any{}
+
+	for _, p := range m.Parts {
+		codes, err := p.formatting()
+		if err != nil {
+			return "", err
+		}
+
+		c, err := p.component()
+		if err != nil {
+			return "", err
+		}
+
+		if codes == "" {
+			rawtext = append(rawtext, c)
+			continue
+		}
+
+		// Formatting carries on until reset, so it's reset after the part
+		if text, ok := c["text"].(string); ok {
+			rawtext = append(rawtext, map[string]any{"text": codes + text + "§r"})
+			continue
+		}
+
+		rawtext = append(rawtext, map[string]any{"text": codes}, c, map[string]any{"text": "§r"})
+	}
+
+	// Line breaks are escaped, so the command stays on one console line
+	data, err := json.Marshal(map[string]any{"rawtext": rawtext})
+	if err != nil {
+		return "", fmt.Errorf("error encoding message: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// target returns the command target for the message.
+func (m Message) target() (string, error) {
+	if m.Target == "" {
+		return "@a", nil
+	}
+
+	if strings.HasPrefix(m.Target, "@") {
+		if !selectorPattern.MatchString(m.Target) {
+			return "", fmt.Errorf("%w: invalid target selector %q", ErrInvalid, m.Target)
+		}
+
+		return m.Target, nil
+	}
+
+	if strings.ContainsAny(m.Target, "\"\\\r\n") {
+		return "", fmt.Errorf("%w: invalid player name %q", ErrInvalid, m.Target)
+	}
+
+	if strings.Contains(m.Target, " ") {
+		return `"` + m.Target + `"`, nil
+	}
+
+	return m.Target, nil
+}
+
+// Commands returns the console commands that send the message: tellraw for
+// chat, or titleraw, after a times command if times are set.
+func (m Message) Commands() ([]string, error) {
+	target, err := m.target()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := m.JSON()
+	if err != nil {
+		return nil, err
+	}
+
+	switch m.Display {
+	case "", DisplayChat:
+		if m.Times != nil {
+			return nil, fmt.Errorf("%w: times only apply to titles", ErrInvalid)
+		}
+
+		return []string{fmt.Sprintf("tellraw %s %s", target, raw)}, nil
+	case DisplayTitle, DisplaySubtitle, DisplayActionbar:
+		var commands []string
+
+		if m.Times != nil {
+			t := m.Times
+			if t.FadeIn < 0 || t.Stay < 0 || t.FadeOut < 0 {
+				return nil, fmt.Errorf("%w: negative times", ErrInvalid)
+			}
+
+			commands = append(commands, fmt.Sprintf("titleraw %s times %d %d %d", target, t.FadeIn, t.Stay, t.FadeOut))
+		}
+
+		return append(commands, fmt.Sprintf("titleraw %s %s %s", target, m.Display, raw)), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown display %q", ErrInvalid, m.Display)
+	}
+}
+
+// colorNames lists the known colors for errors.
+func colorNames() string {
+	names := make([]string, 0, len(Colors))
+	for name := range Colors {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
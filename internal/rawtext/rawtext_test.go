@@ -0,0 +1,78 @@
+package rawtext
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+		want    []string
+	}{
+		{
+			name:    "plain chat",
+			message: Text("Hello\nworld"),
+			want:    []string{`tellraw @a {"rawtext":[{"text":"Hello\nworld"}]}`},
+		},
+		{
+			name: "formatted parts",
+			message: Message{
+				Target: "@p[r=10]",
+				Parts: []Part{
+					{Text: "Welcome ", Color: "gold", Bold: true},
+					{Selector: "@s", Color: "aqua"},
+					{Score: &Score{Name: "@s", Objective: "kills"}},
+				},
+			},
+			want: []string{`tellraw @p[r=10] {"rawtext":[{"text":"§6§lWelcome ` +
+				`§r"},{"text":"§b"},{"selector":"@s"},{"text":"§r"},{"score":{"name":"@s","objective":"kills"}}]}`},
+		},
+		{
+			name: "title with times for a player",
+			message: Message{
+				Target:  "Some Player",
+				Display: DisplayTitle,
+				Parts:   []Part{{Translate: "welcome.%s", With: []string{"friend"}}},
+				Times:   &Times{FadeIn: 10, Stay: 70, FadeOut: 20},
+			},
+			want: []string{
+				`titleraw "Some Player" times 10 70 20`,
+				`titleraw "Some Player" title {"rawtext":[{"translate":"welcome.%s","with":["friend"]}]}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.message.Commands()
+			if err != nil {
+				t.Fatalf("Commands failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Commands() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandsInvalid(t *testing.T) {
+	for _, m := range []Message{
+		{},
+		{Parts: []Part{{Text: "hi", Color: "pink"}}},
+		{Parts: []Part{{Text: "hi", Selector: "@a"}}},
+		{Parts: []Part{{Selector: "@x"}}},
+		{Target: "@a\nstop", Parts: []Part{{Text: "hi"}}},
+		{Target: "bad\"name", Parts: []Part{{Text: "hi"}}},
+		{Display: "bossbar", Parts: []Part{{Text: "hi"}}},
+		{Parts: []Part{{Text: "hi"}}, Times: &Times{}},
+	} {
+		_, err := m.Commands()
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", m, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Package redact hides sensitive parts of console lines, such as player
+// addresses and XUIDs, with regular expression rules.
+package redact
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DefaultReplacement replaces what a rule matches unless it has its own.
+const DefaultReplacement = "[redacted]"
+
+var ErrInvalid = errors.New("invalid redaction rule")
+
+// Presets are rules that can be used by name alone.
+var Presets = map[string]Rule{
+	"ip": {
+		// IPv4, and full or compressed IPv6, unlike Bedrock's 12:00:01:000 times
+		Pattern: `\b(?:\d{1,3}\.){3}\d{1,3}\b|\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b|` +
+			`\b(?:[0-9a-fA-F]{1,4}:){1,6}:(?:[0-9a-fA-F]{1,4}:){0,5}[0-9a-fA-F]{1,4}\b`,
+		Replacement: "[ip]",
+	},
+	"xuid": {
+		Pattern:     `(xuid: ?)\d+`,
+		Replacement: "${1}[xuid]",
+	},
+}
+
+// Rule replaces the matches of a regular expression. The replacement may
+// refer to groups as in regexp.Regexp.ReplaceAllString, e.g. ${1}.
+type Rule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern,omitempty"`     // The preset of the same name if empty
+	Replacement string `json:"replacement,omitempty"` // DefaultReplacement if empty
+}
+
+// Redactor applies rules to lines.
+type Redactor struct {
+	patterns     []*regexp.Regexp
+	replacements []string
+}
+
+// New returns a redactor applying rules in order.
+func New(rules []Rule) (*Redactor, error) {
+	r := &Redactor{}
+	seen := make(map[string]bool)
+
+	for _, rule := range rules {
+		if strings.TrimSpace(rule.Name) == "" {
+			return nil, fmt.Errorf("%w: no name", ErrInvalid)
+		}
+
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("%w: %s is configured twice", ErrInvalid, rule.Name)
+		}
+
+		seen[rule.Name] = true
+
+		if rule.Pattern == "" {
+			preset, ok := Presets[rule.Name]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s has no pattern and isn't a preset", ErrInvalid, rule.Name)
+			}
+
+			rule.Pattern = preset.Pattern
+			if rule.Replacement == "" {
+				rule.Replacement = preset.Replacement
+			}
+		}
+
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalid, rule.Name, err)
+		}
+
+		if rule.Replacement == "" {
+			rule.Replacement = DefaultReplacement
+		}
+
+		r.patterns = append(r.patterns, pattern)
+		r.replacements = append(r.replacements, rule.Replacement)
+	}
+
+	return r, nil
+}
+
+// LoadConfig reads the rules from a JSON file holding a list of them.
+func LoadConfig(path string) (*Redactor, error) {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("error reading redaction config: %w", err)
+	}
+
+	var rules []Rule
+
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing redaction config: %w", err)
+	}
+
+	return New(rules)
+}
+
+// Redact returns line with the matches of every rule replaced. A nil
+// redactor returns it unchanged.
+func (r *Redactor) Redact(line string) string {
+	if r == nil {
+		return line
+	}
+
+	for i, pattern := range r.patterns {
+		line = pattern.ReplaceAllString(line, r.replacements[i])
+	}
+
+	return line
+}
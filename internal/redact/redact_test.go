@@ -0,0 +1,69 @@
+package redact
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	invalid := [][]Rule{
+		{{Pattern: "secret"}},
+		{{Name: "unknown"}},
+		{{Name: "broken", Pattern: "("}},
+		{{Name: "ip"}, {Name: "ip"}},
+	}
+
+	for _, rules := range invalid {
+		_, err := New(rules)
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", rules, err)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	r, err := New([]Rule{{Name: "ip"}, {Name: "xuid"}, {Name: "password", Pattern: `password=\S+`}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := map[string]string{
+		"[2024-06-14 09:02:01:123 INFO] Player connected: Steve, xuid: 2535400000000000, " +
+			"ip: 203.0.113.7|19132": "[2024-06-14 09:02:01:123 INFO] Player connected: Steve, xuid: [xuid], ip: [ip]|19132",
+		"Connection from 2001:db8::1 refused": "Connection from [ip] refused",
+		"login password=hunter2 ok":           "login [redacted] ok",
+		"Server started.":                     "Server started.",
+	}
+
+	for line, want := range tests {
+		if got := r.Redact(line); got != want {
+			t.Errorf("Redact(%q) = %q, expected %q", line, got, want)
+		}
+	}
+
+	var none *Redactor
+	if got := none.Redact("ip: 203.0.113.7"); got != "ip: 203.0.113.7" {
+		t.Errorf("Expected a nil redactor to keep lines, got %q", got)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redact.json")
+
+	err := os.WriteFile(path,
+		[]byte(`[{"name": "xuid"}, {"name": "token", "pattern": "token \\w+", "replacement": "token ***"}]`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if got := r.Redact("xuid: 123 token abc"); got != "xuid: [xuid] token ***" {
+		t.Errorf("Unexpected redaction %q", got)
+	}
+}
@@ -0,0 +1,205 @@
+// Package retention keeps named backup policies assigned to wrappers or
+// groups: how often a server is backed up, how long its backups are kept
+// and where they are copied off-site.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// Grace is how late a backup may be before a server is out of compliance
+// with its policy, leaving room for a backup that takes a while.
+const Grace = time.Hour
+
+var (
+	ErrNotFound = errors.New("policy not found")
+	ErrInvalid  = errors.New("invalid policy")
+
+	namePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// Policy says how the servers it is assigned to are backed up.
+type Policy struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	EveryHours  int    `json:"every_hours"`         // How often a backup is taken
+	KeepLast    int    `json:"keep_last,omitempty"` // Backups kept, all if 0
+	KeepDays    int    `json:"keep_days,omitempty"` // Age after which backups are removed, never if 0
+
+	// Offsite is a directory, such as a mounted network share, the backups
+	// are copied to and pruned in like the backup directory. None if empty.
+	Offsite string `json:"offsite,omitempty"`
+
+	Wrappers []string `json:"wrappers,omitempty"` // Assigned by wrapper ID
+	Groups   []string `json:"groups,omitempty"`   // Assigned by group
+}
+
+// Validate checks a policy.
+func (p Policy) Validate() error {
+	if !namePattern.MatchString(p.Name) {
+		return fmt.Errorf("%w: names may only use letters, digits, _ and -", ErrInvalid)
+	}
+
+	if p.EveryHours <= 0 {
+		return fmt.Errorf("%w: every_hours must be positive", ErrInvalid)
+	}
+
+	if p.KeepLast < 0 || p.KeepDays < 0 {
+		return fmt.Errorf("%w: keep_last and keep_days can't be negative", ErrInvalid)
+	}
+
+	if p.Offsite != "" && !filepath.IsAbs(p.Offsite) {
+		return fmt.Errorf("%w: offsite must be an absolute path", ErrInvalid)
+	}
+
+	return nil
+}
+
+// Interval returns how often a backup is taken.
+func (p Policy) Interval() time.Duration {
+	return time.Duration(p.EveryHours) * time.Hour
+}
+
+// Due reports whether a server last backed up at last needs a backup.
+func (p Policy) Due(last, now time.Time) bool {
+	return last.IsZero() || now.Sub(last) >= p.Interval()
+}
+
+// Compliant reports whether a server last backed up at last is within the
+// policy.
+func (p Policy) Compliant(last, now time.Time) bool {
+	return !last.IsZero() && now.Sub(last) <= p.Interval()+Grace
+}
+
+// Expired reports whether the backup at position i, counting from the
+// newest, taken at createdAt, is past the policy's retention. The newest
+// backup is never expired, so a server always keeps one.
+func (p Policy) Expired(i int, createdAt, now time.Time) bool {
+	if i == 0 {
+		return false
+	}
+
+	if p.KeepLast > 0 && i >= p.KeepLast {
+		return true
+	}
+
+	return p.KeepDays > 0 && now.Sub(createdAt) > time.Duration(p.KeepDays)*24*time.Hour
+}
+
+// Assigned returns the policy of a wrapper: the first by name assigned to
+// it by ID, otherwise the first by name assigned to one of its groups.
+func Assigned(policies []Policy, wrapper string, groups []string) (Policy, bool) {
+	for _, p := range policies {
+		for _, w := range p.Wrappers {
+			if w == wrapper {
+				return p, true
+			}
+		}
+	}
+
+	for _, p := range policies {
+		for _, g := range p.Groups {
+			for _, group := range groups {
+				if g == group {
+					return p, true
+				}
+			}
+		}
+	}
+
+	return Policy{}, false
+}
+
+// Store keeps policies in a JSON file.
+type Store struct {
+	path     string
+	mu       sync.Mutex
+	policies map[string]Policy
+}
+
+// Open loads the store at path, starting empty if it doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, policies: map[string]Policy{}}
+
+	var list []Policy
+
+	err := jsonfile.Load(path, &list)
+	if err != nil {
+		return nil, fmt.Errorf("error loading backup policies: %w", err)
+	}
+
+	for _, p := range list {
+		s.policies[p.Name] = p
+	}
+
+	return s, nil
+}
+
+// list returns the policies sorted by name. The caller must hold the lock.
+func (s *Store) list() []Policy {
+	list := make([]Policy, 0, len(s.policies))
+	for _, p := range s.policies {
+		list = append(list, p)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// save persists the policies; the caller holds s.mu.
+func (s *Store) save() error {
+	err := jsonfile.Save(s.path, s.list())
+	if err != nil {
+		return fmt.Errorf("error saving backup policies: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the policies sorted by name.
+func (s *Store) List() []Policy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list()
+}
+
+// Put adds a policy, or replaces the one with the same name.
+func (s *Store) Put(p Policy) (Policy, error) {
+	err := p.Validate()
+	if err != nil {
+		return Policy{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policies[p.Name] = p
+
+	return p, s.save()
+}
+
+// Delete removes a policy.
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.policies[name]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.policies, name)
+
+	return s.save()
+}
@@ -0,0 +1,120 @@
+package retention
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	for _, p := range []Policy{
+		{Name: "bad name", EveryHours: 24},
+		{Name: "daily"},
+		{Name: "daily", EveryHours: 24, KeepLast: -1},
+		{Name: "daily", EveryHours: 24, Offsite: "relative/dir"},
+	} {
+		err := p.Validate()
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", p, err)
+		}
+	}
+
+	err := (Policy{Name: "daily", EveryHours: 24, KeepLast: 7, Offsite: "/mnt/nas"}).Validate()
+	if err != nil {
+		t.Errorf("Expected a valid policy, got %v", err)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	p := Policy{Name: "daily", EveryHours: 24}
+	now := time.Now()
+
+	if !p.Due(time.Time{}, now) || p.Compliant(time.Time{}, now) {
+		t.Error("Expected a server never backed up to be due and out of compliance")
+	}
+
+	if p.Due(now.Add(-23*time.Hour), now) || !p.Due(now.Add(-24*time.Hour), now) {
+		t.Error("Expected a backup to be due after every_hours")
+	}
+
+	if !p.Compliant(now.Add(-24*time.Hour-Grace), now) || p.Compliant(now.Add(-25*time.Hour-time.Minute), now) {
+		t.Error("Expected compliance to allow the grace period only")
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Now()
+	p := Policy{Name: "weekly", EveryHours: 24, KeepLast: 3, KeepDays: 7}
+
+	for _, c := range []struct {
+		i       int
+		age     time.Duration
+		expired bool
+	}{
+		{0, 30 * 24 * time.Hour, false}, // The newest is always kept
+		{1, time.Hour, false},
+		{2, 8 * 24 * time.Hour, true},
+		{3, time.Hour, true},
+	} {
+		if got := p.Expired(c.i, now.Add(-c.age), now); got != c.expired {
+			t.Errorf("Expired(%d, %v) = %v, want %v", c.i, c.age, got, c.expired)
+		}
+	}
+
+	if (Policy{EveryHours: 1}).Expired(100, now.Add(-365*24*time.Hour), now) {
+		t.Error("Expected a policy without limits to keep everything")
+	}
+}
+
+func TestAssigned(t *testing.T) {
+	policies := []Policy{
+		{Name: "a-groups", Groups: []string{"survival"}},
+		{Name: "b-direct", Wrappers: []string{"w1"}},
+	}
+
+	if p, ok := Assigned(policies, "w1", []string{"survival"}); !ok || p.Name != "b-direct" {
+		t.Errorf("Expected the policy assigned by ID to win, got %q", p.Name)
+	}
+
+	if p, ok := Assigned(policies, "w2", []string{"survival"}); !ok || p.Name != "a-groups" {
+		t.Errorf("Expected the policy assigned by group, got %q", p.Name)
+	}
+
+	if _, ok := Assigned(policies, "w3", nil); ok {
+		t.Error("Expected no policy for an unassigned wrapper")
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	_, err = s.Put(Policy{Name: "daily", EveryHours: 24, Groups: []string{"survival"}})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	if list := s.List(); len(list) != 1 || list[0].Groups[0] != "survival" {
+		t.Errorf("Expected the policy to be saved, got %+v", list)
+	}
+
+	err = s.Delete("hourly")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	err = s.Delete("daily")
+	if err != nil || len(s.List()) != 0 {
+		t.Errorf("Expected the policy to be deleted, got %v", err)
+	}
+}
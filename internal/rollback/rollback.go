@@ -0,0 +1,196 @@
+// Package rollback keeps the safety backups taken before risky changes to a
+// server, such as an upgrade or a restore, as rollback points: verified
+// snapshots that record what was about to change.
+package rollback
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/snapshot"
+)
+
+// Reasons a rollback point is taken.
+const (
+	ReasonUpgrade     = "upgrade"      // New bedrock_server version
+	ReasonRestore     = "restore"      // Snapshot import
+	ReasonWorldImport = "world-import" // New world from a template
+)
+
+// DefaultKeep is how many rollback points are kept by default.
+const DefaultKeep = 5
+
+// indexName is the list of rollback points in the store directory.
+const indexName = "index.json"
+
+var ErrNotFound = errors.New("rollback point not found")
+
+// Point is a safety backup taken before a change.
+type Point struct {
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail,omitempty"` // What was about to change, e.g. "bedrock_server 1.21.50 to 1.21.60"
+	Actor     string    `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	Files     int       `json:"files"` // Read back from the archive when it was verified
+}
+
+// Store keeps rollback points in a directory, the oldest being removed
+// beyond a limit.
+type Store struct {
+	dir    string
+	keep   int
+	mu     sync.Mutex
+	points []Point // Oldest first
+}
+
+// Open loads the store in dir, which is created when the first point is
+// taken. At most keep points are kept, DefaultKeep if it isn't positive.
+func Open(dir string, keep int) (*Store, error) {
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+
+	s := &Store{dir: dir, keep: keep, points: []Point{}}
+
+	err := jsonfile.Load(filepath.Join(dir, indexName), &s.points)
+	if err != nil {
+		return nil, fmt.Errorf("error loading rollback points: %w", err)
+	}
+
+	return s, nil
+}
+
+// List returns the rollback points, newest first.
+func (s *Store) List() []Point {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	points := slices.Clone(s.points)
+	slices.Reverse(points)
+
+	return points
+}
+
+// Get returns a rollback point and the path of its archive.
+func (s *Store) Get(id string) (Point, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.points {
+		if p.ID == id {
+			return p, s.archive(id), nil
+		}
+	}
+
+	return Point{}, "", ErrNotFound
+}
+
+// archive returns the path of a point's archive.
+func (s *Store) archive(id string) string {
+	return filepath.Join(s.dir, id+".zip")
+}
+
+// Take snapshots the server state in appDir, verifies the archive and
+// records it as a rollback point with the given reason, detail and actor.
+// The server should not be writing its world meanwhile.
+func (s *Store) Take(appDir string, p Point) (Point, error) {
+	p.CreatedAt = time.Now().UTC()
+	p.ID = p.CreatedAt.Format("20060102-150405") + "-" + randomSuffix()
+
+	err := os.MkdirAll(s.dir, 0750)
+	if err != nil {
+		return p, fmt.Errorf("error creating rollback directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".point-*")
+	if err != nil {
+		return p, fmt.Errorf("error creating rollback point: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // Clean up if the rename didn't happen
+
+	err = snapshot.Write(appDir, tmp)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+
+	if err != nil {
+		return p, fmt.Errorf("error writing rollback point: %w", err)
+	}
+
+	p.Files, p.Size, err = verify(tmp.Name())
+	if err != nil {
+		return p, fmt.Errorf("error verifying rollback point: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), s.archive(p.ID))
+	if err != nil {
+		return p, fmt.Errorf("error saving rollback point: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.points = append(s.points, p)
+
+	for len(s.points) > s.keep {
+		err = os.Remove(s.archive(s.points[0].ID))
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error removing rollback point %s: %v\n", s.points[0].ID, err)
+		}
+
+		s.points = s.points[1:]
+	}
+
+	return p, s.save()
+}
+
+// save writes the index. The caller must hold the lock.
+func (s *Store) save() error {
+	sort.Slice(s.points, func(i, j int) bool {
+		return s.points[i].CreatedAt.Before(s.points[j].CreatedAt)
+	})
+
+	err := jsonfile.Save(filepath.Join(s.dir, indexName), s.points)
+	if err != nil {
+		return fmt.Errorf("error saving rollback points: %w", err)
+	}
+
+	return nil
+}
+
+// verify reads every file of the archive back, which checks their
+// checksums, and returns the number of files and the archive size.
+func verify(path string) (int, int64, error) {
+	files, err := snapshot.Verify(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return files, info.Size(), nil
+}
+
+// randomSuffix tells apart points taken in the same second.
+func randomSuffix() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
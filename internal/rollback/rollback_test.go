@@ -0,0 +1,87 @@
+package rollback
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTake(t *testing.T) {
+	appDir := t.TempDir()
+	dir := filepath.Join(t.TempDir(), "rollback")
+
+	err := os.MkdirAll(filepath.Join(appDir, "worlds", "Bedrock level"), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create world: %v", err)
+	}
+
+	err = os.WriteFile(filepath.Join(appDir, "worlds", "Bedrock level", "level.dat"), []byte("level"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write world: %v", err)
+	}
+
+	store, err := Open(dir, 2)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	var taken []Point
+
+	for _, detail := range []string{"first", "second", "third"} {
+		p, err := store.Take(appDir, Point{Reason: ReasonUpgrade, Detail: detail})
+		if err != nil {
+			t.Fatalf("Take failed: %v", err)
+		}
+
+		if p.Files != 1 || p.Size == 0 {
+			t.Errorf("Expected a verified archive, got %+v", p)
+		}
+
+		taken = append(taken, p)
+	}
+
+	store, err = Open(dir, 2)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	points := store.List()
+	if len(points) != 2 || points[0].Detail != "third" || points[1].Detail != "second" {
+		t.Fatalf("Expected the newest two points, got %+v", points)
+	}
+
+	_, _, err = store.Get(taken[0].ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the oldest point to be removed, got %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, taken[0].ID+".zip"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected the oldest archive to be removed, got %v", err)
+	}
+
+	_, path, err := store.Get(taken[2].ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	_, _, err = verify(path)
+	if err != nil {
+		t.Errorf("Expected the archive to verify, got %v", err)
+	}
+}
+
+func TestVerifyCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.zip")
+
+	err := os.WriteFile(path, []byte("not a zip"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	_, _, err = verify(path)
+	if err == nil {
+		t.Error("Expected a corrupt archive to fail verification")
+	}
+}
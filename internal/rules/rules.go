@@ -0,0 +1,413 @@
+// Package rules runs actions when server events happen, optionally only
+// after an event has happened a number of times within a window.
+package rules
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// Files the engine keeps in its directory.
+const (
+	File      = "rules.json"
+	StateFile = "rules-state.json"
+)
+
+// idPattern matches the IDs clients may choose for rules.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Events rules trigger on.
+const (
+	EventJoin   = "join"   // A player joined
+	EventLeave  = "leave"  // A player left
+	EventOutput = "output" // A console line was printed
+	EventStart  = "start"  // The server finished starting
+	EventCrash  = "crash"  // The server exited without being stopped
+)
+
+// Actions rules take.
+const (
+	ActionCommand = "command" // Send a console command
+	ActionAlert   = "alert"   // Show a wrapper alert on the console
+	ActionHold    = "hold"    // Don't restart after a crash until released
+)
+
+var (
+	ErrNotFound = errors.New("rule not found")
+	ErrInvalid  = errors.New("invalid rule")
+)
+
+// Action is what a rule does. Commands and messages may use {player},
+// {xuid} and {line}.
+type Action struct {
+	Type    string `json:"type"`
+	Command string `json:"command,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Rule runs actions when an event happens Count times within Window.
+type Rule struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Event   string `json:"event"`
+
+	// Regexp matched against the console line, or the player name of join and leave events
+	Match string `json:"match,omitempty"`
+
+	Count   int      `json:"count,omitempty"`  // Occurrences needed, 1 if 0
+	Window  string   `json:"window,omitempty"` // Go duration the occurrences must fall within
+	Actions []Action `json:"actions"`
+}
+
+// Validate checks a rule.
+func (r Rule) Validate() error {
+	switch r.Event {
+	case EventJoin, EventLeave, EventOutput, EventStart, EventCrash:
+	default:
+		return fmt.Errorf("%w: unknown event %q", ErrInvalid, r.Event)
+	}
+
+	_, err := regexp.Compile(r.Match)
+	if err != nil {
+		return fmt.Errorf("%w: match: %v", ErrInvalid, err)
+	}
+
+	if r.Count < 0 {
+		return fmt.Errorf("%w: negative count", ErrInvalid)
+	}
+
+	if r.Count > 1 {
+		d, err := time.ParseDuration(r.Window)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%w: a count needs a window, e.g. 10m", ErrInvalid)
+		}
+	}
+
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("%w: no actions", ErrInvalid)
+	}
+
+	for _, a := range r.Actions {
+		switch a.Type {
+		case ActionCommand:
+			if strings.TrimSpace(a.Command) == "" || strings.ContainsAny(a.Command, "\r\n") {
+				return fmt.Errorf("%w: commands must be a single non-empty line", ErrInvalid)
+			}
+		case ActionAlert:
+			if a.Message == "" {
+				return fmt.Errorf("%w: alerts need a message", ErrInvalid)
+			}
+		case ActionHold:
+			if r.Event != EventCrash {
+				return fmt.Errorf("%w: only crash rules can hold restarts", ErrInvalid)
+			}
+		default:
+			return fmt.Errorf("%w: unknown action %q", ErrInvalid, a.Type)
+		}
+	}
+
+	return nil
+}
+
+// Event is something that happened on the server.
+type Event struct {
+	Type   string
+	Time   time.Time
+	Player string
+	XUID   string
+	Line   string
+}
+
+// Firing is a rule that fired, with its actions' placeholders filled in.
+type Firing struct {
+	Rule    string
+	Actions []Action
+}
+
+// Engine keeps the rules in a JSON file and when their events last
+// happened in another, so counts survive restarts after crashes.
+type Engine struct {
+	path      string
+	statePath string
+	mu        sync.Mutex
+	rules     []Rule
+	matchers  map[string]*regexp.Regexp
+	history   map[string][]time.Time // Occurrences of each rule's event in its window
+}
+
+// Open loads the rules and their history from dir.
+func Open(dir string) (*Engine, error) {
+	e := &Engine{
+		path:      filepath.Join(dir, File),
+		statePath: filepath.Join(dir, StateFile),
+		rules:     []Rule{},
+		matchers:  map[string]*regexp.Regexp{},
+		history:   map[string][]time.Time{},
+	}
+
+	err := jsonfile.Load(e.path, &e.rules)
+	if err != nil {
+		return nil, fmt.Errorf("error loading rules: %w", err)
+	}
+
+	err = jsonfile.Load(e.statePath, &e.history)
+	if err != nil {
+		return nil, fmt.Errorf("error loading rule history: %w", err)
+	}
+
+	for _, r := range e.rules {
+		e.matchers[r.ID] = regexp.MustCompile(r.Match)
+	}
+
+	return e, nil
+}
+
+// List returns the rules.
+func (e *Engine) List() []Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]Rule{}, e.rules...)
+}
+
+// Put adds a rule, or replaces the one with the same ID. New rules get an ID.
+func (e *Engine) Put(r Rule) (Rule, error) {
+	err := r.Validate()
+	if err != nil {
+		return Rule{}, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if r.ID == "" {
+		b := make([]byte, 6)
+
+		_, err := rand.Read(b)
+		if err != nil {
+			return Rule{}, fmt.Errorf("error generating ID: %w", err)
+		}
+
+		r.ID = hex.EncodeToString(b)
+		e.rules = append(e.rules, r)
+	} else {
+		i := e.index(r.ID)
+		if i < 0 {
+			return Rule{}, ErrNotFound
+		}
+
+		e.rules[i] = r
+	}
+
+	e.matchers[r.ID] = regexp.MustCompile(r.Match)
+	delete(e.history, r.ID)
+
+	err = jsonfile.Save(e.path, e.rules)
+	if err != nil {
+		return Rule{}, fmt.Errorf("error saving rules: %w", err)
+	}
+
+	return r, nil
+}
+
+// Get returns a rule by ID.
+func (e *Engine) Get(id string) (Rule, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	i := e.index(id)
+	if i < 0 {
+		return Rule{}, ErrNotFound
+	}
+
+	return e.rules[i], nil
+}
+
+// Set saves a rule under the ID it has, adding it if there is none with
+// that ID yet, and reports whether it was added. Unlike Put, saving the
+// same rule again changes nothing, so clients can choose stable IDs.
+func (e *Engine) Set(r Rule) (Rule, bool, error) {
+	if !idPattern.MatchString(r.ID) {
+		return Rule{}, false, fmt.Errorf("%w: IDs are up to 64 letters, digits, '.', '_' or '-'", ErrInvalid)
+	}
+
+	err := r.Validate()
+	if err != nil {
+		return Rule{}, false, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	i := e.index(r.ID)
+	if i < 0 {
+		e.rules = append(e.rules, r)
+	} else {
+		e.rules[i] = r
+	}
+
+	e.matchers[r.ID] = regexp.MustCompile(r.Match)
+	delete(e.history, r.ID)
+
+	err = jsonfile.Save(e.path, e.rules)
+	if err != nil {
+		return Rule{}, false, fmt.Errorf("error saving rules: %w", err)
+	}
+
+	return r, i < 0, nil
+}
+
+// Delete removes a rule.
+func (e *Engine) Delete(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	i := e.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	e.rules = append(e.rules[:i], e.rules[i+1:]...)
+	delete(e.matchers, id)
+	delete(e.history, id)
+
+	err := jsonfile.Save(e.path, e.rules)
+	if err != nil {
+		return fmt.Errorf("error saving rules: %w", err)
+	}
+
+	return nil
+}
+
+// index returns the position of a rule, or -1. The caller must hold the lock.
+func (e *Engine) index(id string) int {
+	for i, r := range e.rules {
+		if r.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Handle records an event and returns the rules that fire because of it.
+func (e *Engine) Handle(ev Event) []Firing {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var (
+		firings []Firing
+		changed bool
+	)
+
+	for _, r := range e.rules {
+		if !r.Enabled || r.Event != ev.Type || !e.matches(r, ev) {
+			continue
+		}
+
+		if r.Count > 1 {
+			changed = true
+
+			if !e.counted(r, ev.Time) {
+				continue
+			}
+		}
+
+		firings = append(firings, Firing{Rule: r.Name, Actions: expand(r.Actions, ev)})
+	}
+
+	if changed {
+		err := jsonfile.Save(e.statePath, e.history)
+		if err != nil {
+			fmt.Printf("Error saving rule history: %v\n", err)
+		}
+	}
+
+	return firings
+}
+
+// matches reports whether an event matches a rule's pattern. The caller
+// must hold the lock.
+func (e *Engine) matches(r Rule, ev Event) bool {
+	if r.Match == "" {
+		return true
+	}
+
+	subject := ev.Line
+	if ev.Type == EventJoin || ev.Type == EventLeave {
+		subject = ev.Player
+	}
+
+	return e.matchers[r.ID].MatchString(subject)
+}
+
+// counted records an occurrence for a rule with a count and reports whether
+// the count was reached within the window, starting over if so. The caller
+// must hold the lock.
+func (e *Engine) counted(r Rule, now time.Time) bool {
+	window, _ := time.ParseDuration(r.Window)
+
+	kept := []time.Time{}
+
+	for _, t := range e.history[r.ID] {
+		if now.Sub(t) < window {
+			kept = append(kept, t)
+		}
+	}
+
+	kept = append(kept, now)
+
+	if len(kept) >= r.Count {
+		delete(e.history, r.ID)
+		return true
+	}
+
+	e.history[r.ID] = kept
+
+	return false
+}
+
+// quote quotes player names that contain spaces, as required by command
+// selectors.
+func quote(name string) string {
+	if strings.ContainsAny(name, " \"") {
+		return `"` + strings.ReplaceAll(name, `"`, `\"`) + `"`
+	}
+
+	return name
+}
+
+// expand fills in the placeholders of actions. Line breaks are dropped from
+// values so a command stays a single console line.
+func expand(actions []Action, ev Event) []Action {
+	clean := strings.NewReplacer("\r", "", "\n", " ")
+	replacer := strings.NewReplacer(
+		"{player}", quote(clean.Replace(ev.Player)),
+		"{xuid}", ev.XUID,
+		"{line}", clean.Replace(ev.Line),
+	)
+
+	expanded := make([]Action, 0, len(actions))
+
+	for _, a := range actions {
+		a.Command = replacer.Replace(a.Command)
+		a.Message = replacer.Replace(a.Message)
+		expanded = append(expanded, a)
+	}
+
+	return expanded
+}
@@ -0,0 +1,160 @@
+package rules
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHandle(t *testing.T) {
+	dir := t.TempDir()
+
+	engine, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open engine: %v", err)
+	}
+
+	_, err = engine.Put(Rule{
+		Name:    "welcome",
+		Enabled: true,
+		Event:   EventJoin,
+		Actions: []Action{{Type: ActionCommand, Command: "tellraw {player} welcome"}},
+	})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	_, err = engine.Put(Rule{
+		Name:    "crash loop",
+		Enabled: true,
+		Event:   EventCrash,
+		Count:   3,
+		Window:  "10m",
+		Actions: []Action{{Type: ActionAlert, Message: "crashing"}, {Type: ActionHold}},
+	})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	firings := engine.Handle(Event{Type: EventJoin, Player: "Steve Two"})
+	if len(firings) != 1 || firings[0].Actions[0].Command != `tellraw "Steve Two" welcome` {
+		t.Fatalf("Unexpected firings: %+v", firings)
+	}
+
+	start := time.Now()
+
+	// Crashes spread out don't fire, and the history survives a restart
+	engine.Handle(Event{Type: EventCrash, Time: start})
+	engine.Handle(Event{Type: EventCrash, Time: start.Add(11 * time.Minute)})
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+
+	if firings := reopened.Handle(Event{Type: EventCrash, Time: start.Add(15 * time.Minute)}); len(firings) != 0 {
+		t.Fatalf("Expected two crashes in the window not to fire, got %+v", firings)
+	}
+
+	firings = reopened.Handle(Event{Type: EventCrash, Time: start.Add(16 * time.Minute)})
+	if len(firings) != 1 || len(firings[0].Actions) != 2 || firings[0].Actions[1].Type != ActionHold {
+		t.Fatalf("Expected the crash loop rule to fire, got %+v", firings)
+	}
+
+	if firings := reopened.Handle(Event{Type: EventCrash, Time: start.Add(17 * time.Minute)}); len(firings) != 0 {
+		t.Errorf("Expected the count to start over, got %+v", firings)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	engine, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open engine: %v", err)
+	}
+
+	_, err = engine.Put(Rule{
+		Name:    "errors",
+		Enabled: true,
+		Event:   EventOutput,
+		Match:   `ERROR`,
+		Actions: []Action{{Type: ActionAlert, Message: "Error: {line}"}},
+	})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	if firings := engine.Handle(Event{Type: EventOutput, Line: "[INFO] fine"}); len(firings) != 0 {
+		t.Errorf("Expected no match, got %+v", firings)
+	}
+
+	firings := engine.Handle(Event{Type: EventOutput, Line: "[ERROR] bad"})
+	if len(firings) != 1 || firings[0].Actions[0].Message != "Error: [ERROR] bad" {
+		t.Errorf("Unexpected firings: %+v", firings)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, r := range []Rule{
+		{Event: "boot", Actions: []Action{{Type: ActionAlert, Message: "x"}}},
+		{Event: EventOutput, Match: "(", Actions: []Action{{Type: ActionAlert, Message: "x"}}},
+		{Event: EventCrash, Count: 3, Actions: []Action{{Type: ActionHold}}},
+		{Event: EventJoin, Actions: []Action{{Type: ActionHold}}},
+		{Event: EventJoin, Actions: []Action{{Type: ActionCommand, Command: "say hi\nstop"}}},
+		{Event: EventJoin},
+	} {
+		err := r.Validate()
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", r, err)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	dir := t.TempDir()
+
+	engine, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open engine: %v", err)
+	}
+
+	rule := Rule{
+		ID:      "welcome",
+		Name:    "welcome",
+		Enabled: true,
+		Event:   EventJoin,
+		Actions: []Action{{Type: ActionCommand, Command: "say hi"}},
+	}
+
+	_, added, err := engine.Set(rule)
+	if err != nil || !added {
+		t.Fatalf("Expected the rule to be added, got %v, %v", added, err)
+	}
+
+	rule.Enabled = false
+
+	_, added, err = engine.Set(rule)
+	if err != nil || added {
+		t.Fatalf("Expected the rule to be replaced, got %v, %v", added, err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+
+	got, err := reopened.Get("welcome")
+	if err != nil || got.Enabled || len(reopened.List()) != 1 {
+		t.Errorf("Unexpected rule %+v, %v", got, err)
+	}
+
+	if len(reopened.Handle(Event{Type: EventJoin, Player: "Steve"})) != 0 {
+		t.Error("Expected the disabled rule not to fire")
+	}
+
+	rule.ID = ""
+
+	_, _, err = engine.Set(rule)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected a rule without an ID to be invalid, got %v", err)
+	}
+}
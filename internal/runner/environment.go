@@ -0,0 +1,121 @@
+package runner
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Environment is what a command starts with besides the wrapper's own
+// environment.
+type Environment struct {
+	Vars   map[string]string // Added to, or replacing, the wrapper's variables
+	Limits map[string]Limit  // Resource limits by name, such as "nofile" or "core"
+	Umask  *os.FileMode      // File mode creation mask, the wrapper's if nil
+}
+
+// Unlimited is the value of a limit without a ceiling.
+const Unlimited = math.MaxUint64
+
+// Limit is a soft and hard resource limit.
+type Limit struct {
+	Soft uint64
+	Hard uint64
+}
+
+// ParseLimit parses "soft" or "soft:hard", where either may be "unlimited".
+// A single value sets both.
+func ParseLimit(s string) (Limit, error) {
+	soft, hard, found := strings.Cut(s, ":")
+	if !found {
+		hard = soft
+	}
+
+	var (
+		l   Limit
+		err error
+	)
+
+	l.Soft, err = parseLimitValue(soft)
+	if err != nil {
+		return Limit{}, err
+	}
+
+	l.Hard, err = parseLimitValue(hard)
+	if err != nil {
+		return Limit{}, err
+	}
+
+	if l.Soft > l.Hard {
+		return Limit{}, fmt.Errorf("soft limit above hard limit in %q", s)
+	}
+
+	return l, nil
+}
+
+func parseLimitValue(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if s == "unlimited" || s == "infinity" {
+		return Unlimited, nil
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid limit %q", s)
+	}
+
+	return n, nil
+}
+
+// ParseUmask parses an octal umask such as "0027".
+func ParseUmask(s string) (os.FileMode, error) {
+	n, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil || n > 0777 {
+		return 0, fmt.Errorf("invalid umask %q", s)
+	}
+
+	return os.FileMode(n), nil
+}
+
+// SetEnvironment sets what the command starts with. It must be called
+// before Start, or after Adopt for the command to restart with it.
+func (r *Runner) SetEnvironment(env Environment) error {
+	for name := range env.Limits {
+		if _, ok := limitResources[name]; !ok {
+			return fmt.Errorf("unknown limit %q", name)
+		}
+	}
+
+	r.env = env
+
+	if len(env.Vars) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(env.Vars))
+	for name := range env.Vars {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	vars := make([]string, 0, len(os.Environ())+len(names))
+
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, replaced := env.Vars[name]; !replaced {
+			vars = append(vars, kv)
+		}
+	}
+
+	for _, name := range names {
+		vars = append(vars, name+"="+env.Vars[name])
+	}
+
+	r.cmd.Env = vars
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// limitResources maps limit names, as used by ulimit and limits.conf, to
+// resources.
+var limitResources = map[string]int{
+	"as":      syscall.RLIMIT_AS,
+	"core":    syscall.RLIMIT_CORE,
+	"cpu":     syscall.RLIMIT_CPU,
+	"data":    syscall.RLIMIT_DATA,
+	"fsize":   syscall.RLIMIT_FSIZE,
+	"nofile":  syscall.RLIMIT_NOFILE,
+	"stack":   syscall.RLIMIT_STACK,
+	"nproc":   6, // RLIMIT_NPROC
+	"memlock": 8, // RLIMIT_MEMLOCK
+}
+
+// umaskMu serializes starts that change the wrapper's umask.
+var umaskMu sync.Mutex
+
+// startWithEnvironment starts the command with the configured umask and
+// limits. The umask is inherited at fork, so the wrapper's is swapped for
+// the duration of the start. Limits are set on the new process right after
+// it started, which leaves the wrapper's own limits alone.
+func (r *Runner) startWithEnvironment(cmd *exec.Cmd) error {
+	if r.env.Umask != nil {
+		umaskMu.Lock()
+		old := syscall.Umask(int(*r.env.Umask))
+		err := cmd.Start()
+		syscall.Umask(old)
+		umaskMu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	} else {
+		err := cmd.Start()
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, limit := range r.env.Limits {
+		err := prlimit(cmd.Process.Pid, limitResources[name], &syscall.Rlimit{Cur: limit.Soft, Max: limit.Hard})
+		if err != nil {
+			_ = cmd.Process.Kill()
+			return fmt.Errorf("error setting %s limit: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// prlimit sets a resource limit of another process.
+func prlimit(pid, resource int, limit *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource),
+		uintptr(unsafe.Pointer(limit)), 0, 0, 0) // #nosec G103
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package runner
+
+import "os/exec"
+
+// limitResources is empty, as limits can only be set on Linux.
+var limitResources = map[string]int{}
+
+// startWithEnvironment starts the command, failing if limits or a umask are
+// configured.
+func (r *Runner) startWithEnvironment(cmd *exec.Cmd) error {
+	if len(r.env.Limits) > 0 || r.env.Umask != nil {
+		return ErrUnsupported
+	}
+
+	return cmd.Start()
+}
@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRunner_Environment(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("limits and umask are only applied on Linux")
+	}
+
+	script := filepath.Join(t.TempDir(), "env.sh")
+
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$GREETING $(umask) $(ulimit -c)\"\nsleep 5\n"), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	limit, err := ParseLimit("0")
+	if err != nil {
+		t.Fatalf("Failed to parse limit: %v", err)
+	}
+
+	umask, err := ParseUmask("0027")
+	if err != nil {
+		t.Fatalf("Failed to parse umask: %v", err)
+	}
+
+	r := New(script, "")
+
+	err = r.SetEnvironment(Environment{
+		Vars:   map[string]string{"GREETING": "hello"},
+		Limits: map[string]Limit{"core": limit},
+		Umask:  &umask,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set environment: %v", err)
+	}
+
+	err = r.Start()
+	if err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+
+	defer func() {
+		_ = r.Kill()
+		_ = r.Wait()
+	}()
+
+	select {
+	case line := <-r.GetOutputChan():
+		if line.String() != "hello 0027 0" {
+			t.Errorf("Unexpected environment: %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for output")
+	}
+
+	err = r.SetEnvironment(Environment{Limits: map[string]Limit{"files": limit}})
+	if err == nil {
+		t.Errorf("Expected an unknown limit to be rejected")
+	}
+
+	_, err = ParseLimit("10:5")
+	if err == nil {
+		t.Errorf("Expected a soft limit above the hard limit to be rejected")
+	}
+
+	l, err := ParseLimit("1024:unlimited")
+	if err != nil || l.Soft != 1024 || l.Hard != Unlimited {
+		t.Errorf("Unexpected limit: %+v, %v", l, err)
+	}
+}
@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HandoffEnv passes the command a wrapper hands off to the wrapper it
+// re-executes as, as "<pid>,<stdin>,<stdout>,<stderr>" with the file
+// descriptors of its pipes.
+const HandoffEnv = "GOGO_MC_HANDOFF"
+
+// Adopt takes over the command a previous wrapper handed off, instead of
+// starting it. It reports whether there was one to take over.
+func (r *Runner) Adopt() (bool, error) {
+	value := os.Getenv(HandoffEnv)
+	if value == "" {
+		return false, nil
+	}
+
+	// Processes started later must not think they were handed something
+	_ = os.Unsetenv(HandoffEnv)
+
+	fields := strings.Split(value, ",")
+	if len(fields) != 4 {
+		return false, fmt.Errorf("malformed %s: %q", HandoffEnv, value)
+	}
+
+	numbers := make([]int, len(fields))
+
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return false, fmt.Errorf("malformed %s: %q", HandoffEnv, value)
+		}
+
+		numbers[i] = n
+	}
+
+	process, err := os.FindProcess(numbers[0])
+	if err != nil {
+		return false, fmt.Errorf("error finding handed off process: %v", err)
+	}
+
+	r.cmd.Process = process
+	r.adopted = true
+
+	r.forward(
+		os.NewFile(uintptr(numbers[1]), "stdin"),
+		os.NewFile(uintptr(numbers[2]), "stdout"),
+		os.NewFile(uintptr(numbers[3]), "stderr"),
+	)
+
+	return true, nil
+}
+
+// handoffEnv returns the environment of the new wrapper: the wrapper's own,
+// with the handoff of the command.
+func (r *Runner) handoffEnv(fds []uintptr) []string {
+	var env []string
+
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, HandoffEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	return append(env, fmt.Sprintf("%s=%d,%d,%d,%d", HandoffEnv, r.Pid(), fds[0], fds[1], fds[2]))
+}
@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// HandoffSupported reports whether Handoff is available on this platform.
+const HandoffSupported = true
+
+// Handoff replaces the wrapper with executable, started with args, leaving
+// the command running. The pipes of the command are kept open across the
+// exec and passed on in HandoffEnv, so the new wrapper can Adopt the command
+// as its own child. Output read but not yet consumed is lost. It only
+// returns if the exec failed.
+func (r *Runner) Handoff(executable string, args []string) error {
+	r.mu.Lock()
+	running, files := r.running, r.files
+	r.mu.Unlock()
+
+	if !running {
+		return fmt.Errorf("command not running")
+	}
+
+	fds := make([]uintptr, 0, len(files))
+
+	for _, f := range files {
+		conn, err := f.SyscallConn()
+		if err != nil {
+			return fmt.Errorf("error handing off %s: %v", f.Name(), err)
+		}
+
+		// Clear close-on-exec, without switching the pipe to blocking mode
+		// as Fd would while it is being read
+		var errno syscall.Errno
+
+		err = conn.Control(func(fd uintptr) {
+			fds = append(fds, fd)
+			_, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, 0)
+		})
+		if err == nil && errno != 0 {
+			err = errno
+		}
+
+		if err != nil {
+			return fmt.Errorf("error handing off %s: %v", f.Name(), err)
+		}
+	}
+
+	err := syscall.Exec(executable, args, r.handoffEnv(fds)) // #nosec G204
+
+	// Still here, so keep the pipes from leaking into other processes
+	for _, fd := range fds {
+		syscall.CloseOnExec(int(fd))
+	}
+
+	return fmt.Errorf("error executing %s: %v", executable, err)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package runner
+
+// HandoffSupported reports whether Handoff is available on this platform.
+const HandoffSupported = false
+
+// Handoff is only available on Linux.
+func (r *Runner) Handoff(executable string, args []string) error {
+	return ErrUnsupported
+}
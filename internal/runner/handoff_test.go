@@ -0,0 +1,126 @@
+//go:build linux
+
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunner_Adopt(t *testing.T) {
+	scriptPath := createEchoScript(t)
+
+	// Start the command the way a previous wrapper would have
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(scriptPath)
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+
+	err = cmd.Start()
+	if err != nil {
+		t.Fatalf("Failed to start command: %v", err)
+	}
+
+	closeAll(stdinR, stdoutW, stderrW)
+
+	// The adopting runner owns duplicates, as a new wrapper would
+	fds := make([]int, 3)
+
+	for i, f := range []*os.File{stdinW, stdoutR, stderrR} {
+		fds[i], err = syscall.Dup(int(f.Fd()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.Close()
+	}
+
+	t.Setenv(HandoffEnv, fmt.Sprintf("%d,%d,%d,%d", cmd.Process.Pid, fds[0], fds[1], fds[2]))
+
+	r := New(scriptPath, "")
+
+	adopted, err := r.Adopt()
+	if err != nil {
+		t.Fatalf("Adopt failed: %v", err)
+	}
+
+	if !adopted {
+		t.Fatal("Expected the command to be adopted")
+	}
+
+	if os.Getenv(HandoffEnv) != "" {
+		t.Error("Expected the handoff to be removed from the environment")
+	}
+
+	if r.Pid() != cmd.Process.Pid {
+		t.Errorf("Expected pid %d, got %d", cmd.Process.Pid, r.Pid())
+	}
+
+	r.WriteInput("hello")
+
+	seen := map[string]bool{}
+	timeout := time.After(2 * time.Second)
+
+	for len(seen) < 2 {
+		select {
+		case line := <-r.GetOutputChan():
+			seen[line.String()] = true
+		case <-timeout:
+			t.Fatalf("Timed out waiting for output, got %v", seen)
+		}
+	}
+
+	if !seen["ECHO: hello"] || !seen["[ERR] ERROR: hello"] {
+		t.Errorf("Unexpected output %v", seen)
+	}
+
+	err = r.Kill()
+	if err != nil {
+		t.Fatalf("Kill failed: %v", err)
+	}
+
+	err = r.Wait()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("Expected an exit error after kill, got %v", err)
+	}
+}
+
+func TestRunner_AdoptNone(t *testing.T) {
+	t.Setenv(HandoffEnv, "")
+
+	adopted, err := New("true", "").Adopt()
+	if err != nil || adopted {
+		t.Errorf("Expected nothing to adopt, got %v, %v", adopted, err)
+	}
+}
+
+func TestRunner_AdoptMalformed(t *testing.T) {
+	t.Setenv(HandoffEnv, "123,4")
+
+	_, err := New("true", "").Adopt()
+	if err == nil {
+		t.Error("Expected an error for a malformed handoff")
+	}
+}
@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupported is returned where resource controls aren't available.
+var ErrUnsupported = errors.New("resource controls are only available on Linux")
+
+// I/O scheduling classes.
+const (
+	IOClassRealtime   = "realtime"
+	IOClassBestEffort = "best-effort"
+	IOClassIdle       = "idle"
+)
+
+// Resources limits the CPU and I/O a command may use, so several servers on
+// one host don't starve each other.
+type Resources struct {
+	CPUs     []int   // Cores the command may run on, all if empty
+	Nice     int     // Scheduling niceness, -20 (favored) to 19
+	IOClass  string  // I/O scheduling class, unchanged if empty
+	IOLevel  int     // Priority within the I/O class, 0 (highest) to 7
+	CPUQuota float64 // Cores worth of CPU time, enforced with cgroup v2, unlimited if zero
+}
+
+// Validate checks the resource settings.
+func (res Resources) Validate() error {
+	if res.Nice < -20 || res.Nice > 19 {
+		return fmt.Errorf("nice must be between -20 and 19")
+	}
+
+	switch res.IOClass {
+	case "", IOClassRealtime, IOClassBestEffort, IOClassIdle:
+	default:
+		return fmt.Errorf("unknown I/O class %q", res.IOClass)
+	}
+
+	if res.IOLevel < 0 || res.IOLevel > 7 {
+		return fmt.Errorf("I/O priority must be between 0 and 7")
+	}
+
+	if res.CPUQuota < 0 {
+		return fmt.Errorf("CPU quota can't be negative")
+	}
+
+	return nil
+}
+
+// ParseCPUs parses a CPU list such as "0-3,6".
+func ParseCPUs(s string) ([]int, error) {
+	var cpus []int
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		first, last, isRange := strings.Cut(part, "-")
+
+		from, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("invalid CPU %q", part)
+		}
+
+		to := from
+
+		if isRange {
+			to, err = strconv.Atoi(strings.TrimSpace(last))
+			if err != nil || to < from {
+				return nil, fmt.Errorf("invalid CPU range %q", part)
+			}
+		}
+
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	return cpus, nil
+}
@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/cgroup"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+
+	// cpuPeriod is the cgroup CPU accounting period in microseconds.
+	cpuPeriod = 100000
+)
+
+var ioClasses = map[string]int{
+	IOClassRealtime:   1,
+	IOClassBestEffort: 2,
+	IOClassIdle:       3,
+}
+
+// ApplyResources applies CPU pinning, niceness and I/O priority to every
+// thread of the running command, which its new threads inherit, and moves it
+// into a cgroup for the CPU quota. Every setting is tried; the errors of
+// those that failed are returned together.
+func (r *Runner) ApplyResources(res Resources) error {
+	pid := r.Pid()
+	if pid == 0 {
+		return fmt.Errorf("command not started")
+	}
+
+	tasks, err := os.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return fmt.Errorf("error listing threads: %v", err)
+	}
+
+	var errs []error
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(filepath.Base(task.Name()))
+		if err != nil {
+			continue
+		}
+
+		errs = append(errs, applyThread(tid, res))
+	}
+
+	if res.CPUQuota > 0 {
+		quota := int(res.CPUQuota * cpuPeriod)
+
+		_, err = cgroup.Attach(pid, map[string]string{"cpu.max": fmt.Sprintf("%d %d", quota, cpuPeriod)})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error setting CPU quota: %v", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// applyThread applies the per-thread settings to one thread.
+func applyThread(tid int, res Resources) error {
+	if len(res.CPUs) > 0 {
+		err := setAffinity(tid, res.CPUs)
+		if err != nil {
+			return fmt.Errorf("error pinning thread %d: %v", tid, err)
+		}
+	}
+
+	if res.Nice != 0 {
+		err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, res.Nice)
+		if err != nil {
+			return fmt.Errorf("error setting niceness of thread %d: %v", tid, err)
+		}
+	}
+
+	if res.IOClass != "" {
+		prio := ioClasses[res.IOClass]<<ioprioClassShift | res.IOLevel
+
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio))
+		if errno != 0 {
+			return fmt.Errorf("error setting I/O priority of thread %d: %v", tid, errno)
+		}
+	}
+
+	return nil
+}
+
+// setAffinity pins a thread to the given CPUs.
+func setAffinity(tid int, cpus []int) error {
+	maxCPU := 0
+	for _, cpu := range cpus {
+		maxCPU = max(maxCPU, cpu)
+	}
+
+	mask := make([]uint64, maxCPU/64+1)
+	for _, cpu := range cpus {
+		mask[cpu/64] |= 1 << (cpu % 64)
+	}
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(tid),
+		uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0]))) // #nosec G103
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package runner
+
+// ApplyResources always fails outside Linux.
+func (r *Runner) ApplyResources(res Resources) error {
+	return ErrUnsupported
+}
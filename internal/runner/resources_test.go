@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseCPUs(t *testing.T) {
+	cpus, err := ParseCPUs("0-3, 6")
+	if err != nil || fmt.Sprint(cpus) != "[0 1 2 3 6]" {
+		t.Errorf("Unexpected CPUs: %v, %v", cpus, err)
+	}
+
+	for _, input := range []string{"a", "3-1", "-1"} {
+		_, err := ParseCPUs(input)
+		if err == nil {
+			t.Errorf("Expected ParseCPUs(%q) to fail", input)
+		}
+	}
+
+	err = (Resources{Nice: 20}).Validate()
+	if err == nil {
+		t.Errorf("Expected an invalid niceness to be rejected")
+	}
+
+	err = (Resources{IOClass: "fast"}).Validate()
+	if err == nil {
+		t.Errorf("Expected an unknown I/O class to be rejected")
+	}
+}
+
+func TestRunner_ApplyResources(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource controls are only available on Linux")
+	}
+
+	r := New(createEchoScript(t), "")
+
+	err := r.Start()
+	if err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+
+	defer func() {
+		_ = r.Kill()
+		_ = r.Wait()
+	}()
+
+	// Lowering priority needs no privileges
+	err = r.ApplyResources(Resources{CPUs: []int{0}, Nice: 5, IOClass: IOClassBestEffort, IOLevel: 7})
+	if err != nil {
+		t.Fatalf("Failed to apply resources: %v", err)
+	}
+
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", r.Pid()))
+	if err != nil {
+		t.Fatalf("Failed to read process status: %v", err)
+	}
+
+	if !strings.Contains(string(status), "Cpus_allowed_list:\t0\n") {
+		t.Errorf("Expected the process to be pinned to CPU 0")
+	}
+}
@@ -0,0 +1,232 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"time"
+)
+
+// Restart policies, of when the command is started again once it exits.
+const (
+	RestartNever     = "never"      // It isn't; Wait returns
+	RestartOnFailure = "on-failure" // When it exits with an error or is killed
+	RestartAlways    = "always"     // Whenever it exits, unless Shutdown was called
+)
+
+// RestartPolicies lists the restart policies.
+var RestartPolicies = []string{RestartNever, RestartOnFailure, RestartAlways}
+
+const (
+	// defaultBackoff is the wait before the first restart in a row unless
+	// configured otherwise.
+	defaultBackoff = 5 * time.Second
+
+	// defaultMaxBackoff caps the wait between restarts unless configured
+	// otherwise.
+	defaultMaxBackoff = 5 * time.Minute
+
+	// stableRun is how long a run must last for the wait before the next
+	// restart to go back to the first.
+	stableRun = 10 * time.Minute
+)
+
+// ErrNotRunning is returned when restarting a command that isn't running,
+// such as one waiting to be restarted after a crash.
+var ErrNotRunning = errors.New("command not running")
+
+// RestartConfig is when the command is restarted after it exits, and how
+// long Wait waits before: the backoff, doubled with each restart in a row up
+// to the maximum.
+type RestartConfig struct {
+	Policy     string
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Exited is called when the command exited and will be restarted after
+	// delay, err being how it exited. It may block to hold the restart.
+	Exited func(err error, delay time.Duration)
+
+	// Started is called when the command was restarted.
+	Started func()
+}
+
+// withDefaults fills in the unset fields.
+func (c RestartConfig) withDefaults() RestartConfig {
+	if c.Policy == "" {
+		c.Policy = RestartNever
+	}
+
+	if c.Backoff <= 0 {
+		c.Backoff = defaultBackoff
+	}
+
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+
+	c.MaxBackoff = max(c.MaxBackoff, c.Backoff)
+
+	return c
+}
+
+// Validate checks the policy.
+func (c RestartConfig) Validate() error {
+	if c.Policy == "" || slices.Contains(RestartPolicies, c.Policy) {
+		return nil
+	}
+
+	return fmt.Errorf("unknown restart policy %q, expected %s, %s or %s",
+		c.Policy, RestartNever, RestartOnFailure, RestartAlways)
+}
+
+// restarts reports whether the policy restarts a command that exited with
+// err.
+func (c RestartConfig) restarts(err error) bool {
+	switch c.Policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	}
+
+	return false
+}
+
+// SetRestartConfig sets when the command is restarted. It must be called
+// before Wait.
+func (r *Runner) SetRestartConfig(c RestartConfig) error {
+	err := c.Validate()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.restart = c.withDefaults()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// RestartPolicy returns the restart policy.
+func (r *Runner) RestartPolicy() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.restart.Policy
+}
+
+// Restarts returns how many times the command was restarted.
+func (r *Runner) Restarts() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.restarts
+}
+
+// newCommand returns the command to start again, with the same arguments
+// and environment.
+//
+//nolint:noctx
+func (r *Runner) newCommand() *exec.Cmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cmd := exec.Command(r.cmd.Path, r.cmd.Args[1:]...) // #nosec G204
+	cmd.Env = r.cmd.Env
+
+	return cmd
+}
+
+// next decides, once a run exited with err, whether the command is started
+// again, returning where to send the result of a requested restart.
+func (r *Runner) next(err error) (chan error, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := r.pending
+	r.pending = nil
+
+	select {
+	case <-r.shutdown:
+		if result != nil {
+			result <- ErrNotRunning
+		}
+
+		return nil, false
+	default:
+	}
+
+	if r.outputClosed {
+		return nil, false
+	}
+
+	return result, result != nil || r.restart.restarts(err)
+}
+
+// closeOutput closes the output channel once there are no more runs.
+func (r *Runner) closeOutput() {
+	r.mu.Lock()
+	closed := r.outputClosed
+	r.outputClosed = true
+	r.mu.Unlock()
+
+	if !closed {
+		close(r.outputChan)
+	}
+}
+
+// Restart stops the command by writing "stop" to it, as bedrock_server
+// takes it, killing it if it didn't exit within timeout, and starts it
+// again right away whatever the restart policy. Wait must be running. It
+// returns once the command was started again.
+func (r *Runner) Restart(timeout time.Duration) error {
+	result := make(chan error, 1)
+
+	r.mu.Lock()
+
+	select {
+	case <-r.shutdown:
+		r.mu.Unlock()
+		return ErrNotRunning
+	default:
+	}
+
+	if !r.running || r.outputClosed || r.pending != nil {
+		r.mu.Unlock()
+		return ErrNotRunning
+	}
+
+	r.pending = result
+	exited := r.exited
+	r.mu.Unlock()
+
+	r.WriteInput(stopCommand)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-exited:
+	case <-timer.C:
+		err := r.Kill()
+		if err != nil {
+			return err
+		}
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-r.done:
+		return ErrNotRunning
+	}
+}
+
+// Shutdown makes the next exit of the command the last whatever the restart
+// policy, such as when it's being stopped for good. A restart waiting for
+// its backoff is called off.
+func (r *Runner) Shutdown() {
+	r.shutdownOnce.Do(func() { close(r.shutdown) })
+}
@@ -0,0 +1,131 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRestartConfig_Validate(t *testing.T) {
+	for _, policy := range []string{"", RestartNever, RestartOnFailure, RestartAlways} {
+		err := (RestartConfig{Policy: policy}).Validate()
+		if err != nil {
+			t.Errorf("Expected policy %q to be valid, got %v", policy, err)
+		}
+	}
+
+	err := (RestartConfig{Policy: "sometimes"}).Validate()
+	if err == nil {
+		t.Error("Expected an unknown policy to be rejected")
+	}
+}
+
+func TestRunner_RestartOnFailure(t *testing.T) {
+	// Each run counts itself; the first two fail, the third runs until told
+	// to stop
+	scriptPath := filepath.Join(t.TempDir(), "crash.sh")
+
+	content := `#!/bin/sh
+n=$(cat "$0.count" 2>/dev/null || echo 0)
+n=$((n+1))
+echo $n > "$0.count"
+echo "run $n"
+[ $n -lt 3 ] && exit 1
+while IFS= read -r line; do
+    [ "$line" = stop ] && exit 0
+done
+`
+
+	err := os.WriteFile(scriptPath, []byte(content), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	var exits atomic.Int32
+
+	r := New(scriptPath, "")
+
+	err = r.SetRestartConfig(RestartConfig{
+		Policy:  RestartOnFailure,
+		Backoff: 10 * time.Millisecond,
+		Exited:  func(error, time.Duration) { exits.Add(1) },
+	})
+	if err != nil {
+		t.Fatalf("SetRestartConfig failed: %v", err)
+	}
+
+	err = r.Start()
+	if err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+
+	waited := make(chan error, 1)
+
+	go func() {
+		waited <- r.Wait()
+	}()
+
+	// next returns the next line of output
+	next := func() Line {
+		t.Helper()
+
+		select {
+		case line := <-r.GetOutputChan():
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for output")
+			return Line{}
+		}
+	}
+
+	for _, want := range []string{"run 1", "run 2", "run 3"} {
+		if line := next(); line.Text != want {
+			t.Fatalf("Expected %q, got %+v", want, line)
+		}
+	}
+
+	if r.Restarts() != 2 || exits.Load() != 2 {
+		t.Errorf("Expected 2 restarts after failures, got %d (%d exits)", r.Restarts(), exits.Load())
+	}
+
+	// A requested restart doesn't wait for the backoff or count as a failure
+	err = r.Restart(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+
+	if line := next(); line.Text != "run 4" || line.Seq != 4 {
+		t.Fatalf("Expected the restarted run to carry on the output, got %+v", line)
+	}
+
+	if r.Restarts() != 3 || exits.Load() != 2 {
+		t.Errorf("Expected 3 restarts, got %d (%d exits)", r.Restarts(), exits.Load())
+	}
+
+	// Once shut down, the exit is the last
+	r.Shutdown()
+	r.WriteInput("stop")
+
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Errorf("Expected a clean exit, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the command to exit")
+	}
+
+	if _, ok := <-r.GetOutputChan(); ok {
+		t.Error("Expected the output channel to be closed")
+	}
+
+	err = r.Restart(time.Second)
+	if !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected restarting a stopped command to fail, got %v", err)
+	}
+
+	r.WriteInput("ignored") // Mustn't block once done
+}
@@ -2,19 +2,74 @@ package runner
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"sync"
+	"time"
 )
 
-// Runner manages the execution of a command and its I/O.
+// maxLineSize is the longest output line read from the command, in bytes.
+const maxLineSize = 1 << 20
+
+// Streams a line of output comes from.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Line is a line of output of the command. Lines of both streams go
+// through a single pipeline, numbered and timestamped in the order they
+// arrive.
+type Line struct {
+	Seq    uint64    // Arrival order across both streams, from 1
+	Time   time.Time // When the line was read, in UTC
+	Stream string    // StreamStdout or StreamStderr
+	Text   string
+}
+
+// String returns the text of the line as shown on the console, with an
+// [ERR] prefix for stderr.
+func (l Line) String() string {
+	if l.Stream == StreamStderr {
+		return "[ERR] " + l.Text
+	}
+
+	return l.Text
+}
+
+// Runner manages the execution of a command and its I/O. With a restart
+// policy, Wait starts the command again when it exits, and its output and
+// input carry on across the runs.
 type Runner struct {
 	cmd        *exec.Cmd
 	appDir     string
 	stdin      chan string
-	outputChan chan string   // Channel for streaming output
+	outputChan chan Line     // Channel for streaming output
+	outputMu   sync.Mutex    // Numbers lines and keeps the channel in their order
+	outputSeq  uint64        // Sequence number of the latest line
 	done       chan struct{} // Channel to signal when the command is done
+	doneOnce   sync.Once
+	env        Environment
+	files      []*os.File // Our ends of the stdin, stdout and stderr pipes
+	adopted    bool       // Whether the command was handed off by a previous wrapper
+
+	restart      RestartConfig
+	mu           sync.Mutex    // Guards cmd, files and adopted once started, and the run below
+	running      bool          // Whether the current run hasn't exited yet
+	startedAt    time.Time     // When the current run started
+	exited       chan struct{} // Closed when the current run exited
+	scanned      chan struct{} // Closed when the output of the current run was read
+	pending      chan error    // Result of a requested restart, nil if none
+	outputClosed bool          // Whether the output channel was closed, as there are no more runs
+	restarts     int
+	shutdown     chan struct{} // Closed when the next exit is to be the last
+	shutdownOnce sync.Once
+
+	stateMu      sync.Mutex // Orders changes of state and the calls about them
+	state        Transition // Latest change of state
+	onTransition func(Transition)
 }
 
 // New creates a new Runner instance.
@@ -25,42 +80,100 @@ func New(command string, appDir string, args ...string) *Runner {
 		cmd:        exec.Command(command, args...),
 		appDir:     appDir,
 		stdin:      make(chan string),
-		outputChan: make(chan string, 100), // Buffered channel for output
+		outputChan: make(chan Line, 100), // Buffered channel for output
 		done:       make(chan struct{}),
+		restart:    RestartConfig{}.withDefaults(),
+		shutdown:   make(chan struct{}),
+		state:      Transition{To: StateStopped, Time: time.Now().UTC()},
 	}
 }
 
 // Start begins the command execution and sets up I/O handling.
 func (r *Runner) Start() error {
-	// Create stdin pipe
-	stdin, err := r.cmd.StdinPipe()
+	return r.start(r.cmd)
+}
+
+// start starts cmd as the current run.
+func (r *Runner) start(cmd *exec.Cmd) error {
+	r.setState(StateStarting, nil)
+
+	err := r.startPiped(cmd)
+	if err != nil {
+		r.setState(StateCrashed, err)
+	}
+
+	return err
+}
+
+// startPiped starts cmd with pipes for its input and output.
+func (r *Runner) startPiped(cmd *exec.Cmd) error {
+	// The pipes are created here rather than with cmd.StdinPipe and friends
+	// so they can be handed off to a new wrapper along with the process
+	stdinR, stdinW, err := os.Pipe()
 	if err != nil {
 		return fmt.Errorf("error creating stdin pipe: %v", err)
 	}
 
-	// Create stdout pipe
-	stdout, err := r.cmd.StdoutPipe()
+	stdoutR, stdoutW, err := os.Pipe()
 	if err != nil {
+		closeAll(stdinR, stdinW)
 		return fmt.Errorf("error creating stdout pipe: %v", err)
 	}
 
-	// Create stderr pipe
-	stderr, err := r.cmd.StderrPipe()
+	stderrR, stderrW, err := os.Pipe()
 	if err != nil {
+		closeAll(stdinR, stdinW, stdoutR, stdoutW)
 		return fmt.Errorf("error creating stderr pipe: %v", err)
 	}
 
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+
 	// Start command
-	r.cmd.Dir = r.appDir
+	cmd.Dir = r.appDir
+
+	err = r.startWithEnvironment(cmd)
+
+	// The command has its own copies of its ends now
+	closeAll(stdinR, stdoutW, stderrW)
 
-	err = r.cmd.Start()
 	if err != nil {
+		closeAll(stdinW, stdoutR, stderrR)
 		return fmt.Errorf("error starting command: %v", err)
 	}
 
-	// Create scanners for stdout and stderr
+	r.mu.Lock()
+	r.cmd = cmd
+	r.adopted = false
+	r.mu.Unlock()
+
+	r.forward(stdinW, stdoutR, stderrR)
+
+	return nil
+}
+
+// forward streams the output of the command to the output channel and the
+// input channel to the command, for a new run.
+func (r *Runner) forward(stdin, stdout, stderr *os.File) {
+	exited := make(chan struct{})
+	scanned := make(chan struct{})
+
+	r.mu.Lock()
+	r.files = []*os.File{stdin, stdout, stderr}
+	r.running = true
+	r.startedAt = time.Now()
+	r.exited = exited
+	r.scanned = scanned
+	r.mu.Unlock()
+
+	// Create scanners for stdout and stderr. Lines past the default 64 KiB
+	// limit, such as pack stacks of servers with many addons, would stop them
 	outScanner := bufio.NewScanner(stdout)
+	outScanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
 	errScanner := bufio.NewScanner(stderr)
+	errScanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
 
 	// Create a WaitGroup to coordinate the scanner goroutines
 	var scanners sync.WaitGroup
@@ -69,69 +182,259 @@ func (r *Runner) Start() error {
 	// Start goroutine to scan stdout
 	go func() {
 		defer scanners.Done()
+		defer stdout.Close()
 
 		for outScanner.Scan() {
-			select {
-			case r.outputChan <- outScanner.Text():
-			default:
-				// Channel is full, discard output
-			}
+			r.emit(StreamStdout, outScanner.Text())
 		}
 	}()
 
 	// Start goroutine to scan stderr
 	go func() {
 		defer scanners.Done()
+		defer stderr.Close()
 
 		for errScanner.Scan() {
-			select {
-			case r.outputChan <- "[ERR] " + errScanner.Text():
-			default:
-				// Channel is full, discard output
-			}
+			r.emit(StreamStderr, errScanner.Text())
 		}
 	}()
 
 	// Start goroutine to manage output channel closure
 	go func() {
-		scanners.Wait()     // Wait for both scanners to complete
-		close(r.outputChan) // Then close the output channel
+		scanners.Wait() // Wait for both scanners to complete
+		close(scanned)
+
+		// Then close the output channel, unless the command may be restarted
+		r.mu.Lock()
+		last := r.restart.Policy == RestartNever && r.pending == nil && !r.outputClosed
+		if last {
+			r.outputClosed = true
+		}
+		r.mu.Unlock()
+
+		if last {
+			close(r.outputChan)
+		}
 	}()
 
-	// Start goroutine to forward input to the process
+	// Start goroutine to forward input to the process until it exits
 	go func() {
 		defer stdin.Close() // Ensure stdin is closed when done
 
-		for input := range r.stdin {
-			input += "\n"
+		for {
+			select {
+			case input, ok := <-r.stdin:
+				if !ok {
+					return
+				}
 
-			_, err := stdin.Write([]byte(input))
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error writing to stdin: %v\n", err)
+				_, err := stdin.Write([]byte(input + "\n"))
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing to stdin: %v\n", err)
+					return
+				}
+			case <-exited:
 				return
 			}
 		}
 	}()
 
-	return nil
+	r.setState(StateRunning, nil)
 }
 
-// WriteInput sends input to the running command.
+// emit numbers, timestamps and sends a line read from a stream. The lock
+// makes the order of the channel that of the numbers and timestamps, which
+// the scanners of the two streams would otherwise race on.
+func (r *Runner) emit(stream, text string) {
+	r.outputMu.Lock()
+	defer r.outputMu.Unlock()
+
+	r.outputSeq++
+
+	select {
+	case r.outputChan <- Line{Seq: r.outputSeq, Time: time.Now().UTC(), Stream: stream, Text: text}:
+	default:
+		// Channel is full, discard output
+	}
+}
+
+// closeAll closes files, ignoring errors.
+func closeAll(files ...*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+// WriteInput sends input to the running command. While it's being
+// restarted, the input waits for the next run; once it's done for good, the
+// input is dropped.
 func (r *Runner) WriteInput(input string) {
-	r.stdin <- input
+	_ = r.WriteInputContext(context.Background(), input)
 }
 
-// GetOutputChan returns a channel that receives command output in real-time.
-func (r *Runner) GetOutputChan() <-chan string {
+// WriteInputContext sends input to the running command as WriteInput does,
+// giving up once ctx is done.
+func (r *Runner) WriteInputContext(ctx context.Context, input string) error {
+	select {
+	case r.stdin <- input:
+		if input == stopCommand {
+			r.setState(StateStopping, nil)
+		}
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// GetOutputChan returns a channel that receives command output in real-time,
+// in arrival order across stdout and stderr.
+func (r *Runner) GetOutputChan() <-chan Line {
 	return r.outputChan
 }
 
-// Done returns a channel that's closed when the command completes.
+// Done returns a channel that's closed when the command completes and won't
+// be restarted.
 func (r *Runner) Done() <-chan struct{} {
 	return r.done
 }
 
-// Wait waits for the command to complete.
+// process returns the process of the current run, nil before it started.
+func (r *Runner) process() *os.Process {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cmd.Process
+}
+
+// Pid returns the process ID of the command, or zero before it started.
+func (r *Runner) Pid() int {
+	process := r.process()
+	if process == nil {
+		return 0
+	}
+
+	return process.Pid
+}
+
+// Kill forcibly stops the command, for when it no longer responds to input.
+// With a restart policy, it may be started again.
+func (r *Runner) Kill() error {
+	process := r.process()
+	if process == nil {
+		return fmt.Errorf("command not started")
+	}
+
+	err := process.Kill()
+	if err != nil {
+		return fmt.Errorf("error killing command: %v", err)
+	}
+
+	return nil
+}
+
+// Wait waits for the command to complete, restarting it as the restart
+// policy says, then closes Done. It returns how the last run ended.
 func (r *Runner) Wait() error {
-	return r.cmd.Wait()
+	defer r.doneOnce.Do(func() { close(r.done) })
+
+	backoff := r.restart.Backoff
+
+	for {
+		err := r.waitRun()
+
+		r.mu.Lock()
+
+		if r.exited == nil {
+			// Never started
+			r.mu.Unlock()
+			return err
+		}
+
+		r.running = false
+		close(r.exited)
+		scanned, started := r.scanned, r.startedAt
+		r.mu.Unlock()
+
+		// The output of this run comes before that of the next, and before
+		// its end
+		<-scanned
+
+		if err != nil {
+			r.setState(StateCrashed, err)
+		} else {
+			r.setState(StateStopped, nil)
+		}
+
+		result, restart := r.next(err)
+		if !restart {
+			r.closeOutput()
+			return err
+		}
+
+		if result == nil {
+			if time.Since(started) >= stableRun {
+				backoff = r.restart.Backoff
+			}
+
+			delay := backoff
+			backoff = min(backoff*2, r.restart.MaxBackoff)
+
+			if r.restart.Exited != nil {
+				r.restart.Exited(err, delay)
+			}
+
+			r.setState(StateStarting, nil)
+
+			select {
+			case <-time.After(delay):
+			case <-r.shutdown:
+				r.setState(StateStopped, nil)
+				r.closeOutput()
+				return err
+			}
+		}
+
+		err = r.start(r.newCommand())
+
+		if result != nil {
+			result <- err
+		}
+
+		if err != nil {
+			r.closeOutput()
+			return err
+		}
+
+		r.mu.Lock()
+		r.restarts++
+		r.mu.Unlock()
+
+		if r.restart.Started != nil {
+			r.restart.Started()
+		}
+	}
+}
+
+// waitRun waits for the current run to exit.
+func (r *Runner) waitRun() error {
+	r.mu.Lock()
+	cmd, adopted := r.cmd, r.adopted
+	r.mu.Unlock()
+
+	if !adopted {
+		return cmd.Wait()
+	}
+
+	state, err := cmd.Process.Wait()
+	if err != nil {
+		return err
+	}
+
+	if !state.Success() {
+		return &exec.ExitError{ProcessState: state}
+	}
+
+	return nil
 }
@@ -1,6 +1,8 @@
 package runner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -67,7 +69,7 @@ func TestRunner_BasicIO(t *testing.T) {
 	// Start collecting outputs
 	go func() {
 		for output := range r.GetOutputChan() {
-			outputs = append(outputs, output)
+			outputs = append(outputs, output.String())
 		}
 
 		close(done)
@@ -154,7 +156,8 @@ func TestRunner_LargeInput(t *testing.T) {
 	go func() {
 		defer close(done)
 
-		for output := range r.GetOutputChan() {
+		for line := range r.GetOutputChan() {
+			output := line.String()
 			outputs = append(outputs, output)
 			// Check if we found our input
 			if strings.HasPrefix(output, "ECHO: ") {
@@ -222,7 +225,7 @@ func TestRunner_MultipleWriters(t *testing.T) {
 	// Start collecting outputs
 	go func() {
 		for output := range r.GetOutputChan() {
-			outputs = append(outputs, output)
+			outputs = append(outputs, output.String())
 		}
 
 		close(done)
@@ -284,3 +287,115 @@ func TestRunner_MultipleWriters(t *testing.T) {
 		t.Errorf("Expected %d unique writes, found %d", expectedWrites, len(writesFound))
 	}
 }
+
+func TestRunner_Kill(t *testing.T) {
+	scriptPath := createEchoScript(t)
+
+	r := New(scriptPath, "")
+
+	if r.Pid() != 0 || r.Kill() == nil {
+		t.Fatalf("Expected no process before the runner started")
+	}
+
+	err := r.Start()
+	if err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+
+	if r.Pid() == 0 {
+		t.Errorf("Expected a process ID once started")
+	}
+
+	err = r.Kill()
+	if err != nil {
+		t.Fatalf("Failed to kill runner: %v", err)
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- r.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Expected a killed process to report an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the killed process")
+	}
+
+	select {
+	case <-r.Done():
+	default:
+		t.Error("Expected Done to be closed once the process exited")
+	}
+}
+
+func TestRunner_Interleaving(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "interleave.sh")
+
+	content := "#!/bin/sh\necho one\nsleep 0.05\necho two >&2\nsleep 0.05\necho three\nsleep 0.05\necho four >&2\n"
+
+	err := os.WriteFile(scriptPath, []byte(content), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	r := New(scriptPath, "")
+
+	err = r.Start()
+	if err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+
+	var lines []Line
+	for line := range r.GetOutputChan() {
+		lines = append(lines, line)
+	}
+
+	_ = r.Wait()
+
+	want := []Line{
+		{Seq: 1, Stream: StreamStdout, Text: "one"},
+		{Seq: 2, Stream: StreamStderr, Text: "two"},
+		{Seq: 3, Stream: StreamStdout, Text: "three"},
+		{Seq: 4, Stream: StreamStderr, Text: "four"},
+	}
+
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d lines, got %+v", len(want), lines)
+	}
+
+	for i, line := range lines {
+		if line.Seq != want[i].Seq || line.Stream != want[i].Stream || line.Text != want[i].Text {
+			t.Errorf("Line %d: expected %+v, got %+v", i, want[i], line)
+		}
+
+		if i > 0 && line.Time.Before(lines[i-1].Time) {
+			t.Errorf("Line %d was read before the previous one", i)
+		}
+	}
+
+	if lines[1].String() != "[ERR] two" {
+		t.Errorf("Expected stderr lines to show with [ERR], got %q", lines[1].String())
+	}
+}
+
+func TestRunner_WriteInputContext(t *testing.T) {
+	// Nothing reads the input before the runner is started
+	r := New(createEchoScript(t), "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := r.WriteInputContext(ctx, "stop")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the write to give up, got %v", err)
+	}
+
+	if r.GetState() == StateStopping {
+		t.Errorf("Expected a stop that wasn't written to leave the state alone")
+	}
+}
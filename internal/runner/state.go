@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"slices"
+	"time"
+)
+
+// State is where the command is in its lifecycle.
+type State string
+
+// States of the command.
+const (
+	StateStarting State = "starting" // Being started, or waiting to be restarted
+	StateRunning  State = "running"
+	StateStopping State = "stopping" // Told to stop, saving the world
+	StateStopped  State = "stopped"  // Not started yet, or exited cleanly
+	StateCrashed  State = "crashed"  // Exited with an error, or failed to start
+)
+
+// stopCommand is the input that makes bedrock_server save and exit.
+const stopCommand = "stop"
+
+// transitions are the states each state may change to. A command handed off
+// by a previous wrapper goes from stopped to running directly.
+var transitions = map[State][]State{
+	StateStopped:  {StateStarting, StateRunning},
+	StateStarting: {StateRunning, StateCrashed, StateStopped},
+	StateRunning:  {StateStopping, StateStopped, StateCrashed},
+	StateStopping: {StateStopped, StateCrashed},
+	StateCrashed:  {StateStarting},
+}
+
+// Transition is a change of state of the command.
+type Transition struct {
+	From  State     `json:"from,omitempty"` // Empty for the state when it was subscribed to
+	To    State     `json:"to"`
+	Time  time.Time `json:"time"`
+	Pid   int       `json:"pid,omitempty"`   // Of the process, once running
+	Error string    `json:"error,omitempty"` // How it crashed
+}
+
+// CanTransition reports whether the command may change from one state to
+// another.
+func CanTransition(from, to State) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// GetState returns the state of the command.
+func (r *Runner) GetState() State {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	return r.state.To
+}
+
+// LastTransition returns the latest change of state of the command, with
+// when it happened.
+func (r *Runner) LastTransition() Transition {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	return r.state
+}
+
+// OnTransition calls fn with each change of state of the command, in order,
+// starting right away with the current state. Only one function is called;
+// it must not change the state itself.
+func (r *Runner) OnTransition(fn func(Transition)) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	r.onTransition = fn
+
+	current := r.state
+	current.From = ""
+	fn(current)
+}
+
+// setState changes the state of the command, if it may, with the error it
+// crashed with.
+func (r *Runner) setState(to State, err error) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	if !CanTransition(r.state.To, to) {
+		return
+	}
+
+	t := Transition{From: r.state.To, To: to, Time: time.Now().UTC()}
+
+	if to == StateRunning {
+		t.Pid = r.Pid()
+	}
+
+	if err != nil && to == StateCrashed {
+		t.Error = err.Error()
+	}
+
+	r.state = t
+
+	if r.onTransition != nil {
+		r.onTransition(t)
+	}
+}
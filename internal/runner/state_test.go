@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to State
+		want     bool
+	}{
+		{StateStopped, StateStarting, true},
+		{StateStopped, StateRunning, true}, // Adopted
+		{StateStarting, StateRunning, true},
+		{StateRunning, StateStopping, true},
+		{StateRunning, StateCrashed, true},
+		{StateStopping, StateStopped, true},
+		{StateCrashed, StateStarting, true},
+		{StateStopped, StateStopping, false},
+		{StateStopping, StateRunning, false},
+		{StateCrashed, StateRunning, false},
+		{StateRunning, StateRunning, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestRunner_States(t *testing.T) {
+	// Fails its first run, then runs until told to stop
+	scriptPath := filepath.Join(t.TempDir(), "states.sh")
+
+	content := `#!/bin/sh
+[ -f "$0.ran" ] || { touch "$0.ran"; exit 3; }
+while IFS= read -r line; do
+    [ "$line" = stop ] && exit 0
+done
+`
+
+	err := os.WriteFile(scriptPath, []byte(content), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	var (
+		mu          sync.Mutex
+		transitions []Transition
+	)
+
+	r := New(scriptPath, "")
+
+	if r.GetState() != StateStopped {
+		t.Fatalf("Expected a new runner to be stopped, got %s", r.GetState())
+	}
+
+	r.OnTransition(func(t Transition) {
+		mu.Lock()
+		transitions = append(transitions, t)
+		mu.Unlock()
+	})
+
+	err = r.SetRestartConfig(RestartConfig{Policy: RestartOnFailure, Backoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("SetRestartConfig failed: %v", err)
+	}
+
+	err = r.Start()
+	if err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+
+	waited := make(chan error, 1)
+
+	go func() {
+		waited <- r.Wait()
+	}()
+
+	// Wait for the restarted run
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Restarts() == 0 || r.GetState() != StateRunning {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for the restart, state %s", r.GetState())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if pid := r.LastTransition().Pid; pid == 0 || pid != r.Pid() {
+		t.Errorf("Expected the running state to carry the pid %d, got %d", r.Pid(), pid)
+	}
+
+	r.Shutdown()
+	r.WriteInput("stop")
+
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the command to exit")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	states := []State{}
+	for _, transition := range transitions {
+		states = append(states, transition.To)
+	}
+
+	want := []State{
+		StateStopped, // Current state when subscribed
+		StateStarting, StateRunning, StateCrashed,
+		StateStarting, StateRunning, StateStopping, StateStopped,
+	}
+
+	if !slices.Equal(states, want) {
+		t.Fatalf("Expected states %v, got %v", want, states)
+	}
+
+	if transitions[0].From != "" {
+		t.Errorf("Expected the current state to have no previous state, got %s", transitions[0].From)
+	}
+
+	if crash := transitions[3]; crash.From != StateRunning || crash.Error == "" {
+		t.Errorf("Expected the crash to come from running with its error, got %+v", crash)
+	}
+}
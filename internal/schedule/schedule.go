@@ -0,0 +1,646 @@
+// Package schedule changes server settings on a calendar, such as hard
+// difficulty on weekends or peaceful overnight, and works out when they
+// start and when to revert them.
+package schedule
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notices"
+)
+
+var (
+	ErrNotFound = errors.New("schedule not found")
+	ErrInvalid  = errors.New("invalid schedule")
+)
+
+// Settings a schedule can change, with their values. Each is saved in
+// server.properties and applied to the running server with a command.
+var Settings = map[string][]string{
+	"difficulty": {"peaceful", "easy", "normal", "hard"},
+	"gamemode":   {"survival", "creative", "adventure"},
+}
+
+// defaults are the values of settings missing from server.properties.
+var defaults = map[string]string{
+	"difficulty": "easy",
+	"gamemode":   "survival",
+}
+
+// settingCommands are the commands that apply settings to the running
+// server. The gamemode property is the default game mode of new players.
+var settingCommands = map[string]string{
+	"difficulty": "difficulty",
+	"gamemode":   "defaultgamemode",
+}
+
+// idPattern matches the IDs clients may choose for schedules.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// days are the names of the days of the week in Schedule.Days.
+var days = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Schedule changes settings and runs commands from Start to End on some
+// days, reverting the settings afterwards.
+type Schedule struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	Days  []string `json:"days,omitempty"` // "mon".."sun", the day a window starts; every day if empty
+	Start string   `json:"start"`          // HH:MM, in the wrapper's timezone
+
+	// HH:MM, the next day if not after Start; a whole day if equal
+	End string `json:"end"`
+
+	Settings       map[string]string `json:"settings,omitempty"`
+	Commands       []string          `json:"commands,omitempty"`        // Run at the start
+	RevertCommands []string          `json:"revert_commands,omitempty"` // Run at the end
+	Announce       string            `json:"announce,omitempty"`        // Said in-game at the start
+	AnnounceEnd    string            `json:"announce_end,omitempty"`    // Said in-game at the end
+	Enabled        bool              `json:"enabled"`
+
+	// Restart restarts the server once in each window, as soon as no player
+	// is online, and at the end of the window at the latest
+	Restart *Restart `json:"restart,omitempty"`
+}
+
+// restartLate is how long after the end of a window its deadline restart
+// is still made.
+const restartLate = 5 * time.Minute
+
+// DefaultCountdown are the seconds before a restart at the end of a window
+// that players are warned at.
+var DefaultCountdown = []int{600, 300, 60, 30, 10}
+
+// Restart defers a scheduled restart until the server has been empty for a
+// while within the window, falling back to a restart at the end of the
+// window with a countdown.
+type Restart struct {
+	EmptyMinutes int `json:"empty_minutes"` // How long no player must be online
+
+	// Seconds before the deadline players are warned at, DefaultCountdown if empty
+	Countdown []int `json:"countdown,omitempty"`
+
+	// Templates of the notices said in-game, with the placeholders of the
+	// notices package, replacing the wrapper's countdown and restart
+	// notices if set
+	Message string `json:"message,omitempty"` // With the time left
+	Notice  string `json:"notice,omitempty"`  // Right before restarting
+}
+
+// RestartStep is what a deferred restart calls for.
+type RestartStep struct {
+	Schedule string        `json:"schedule"` // ID
+	Name     string        `json:"name"`
+	Restart  bool          `json:"restart"` // Restart now, the server being empty
+	Warn     time.Duration `json:"warn"`    // Warn players of a restart in this long, if not zero
+	Message  string        `json:"message"` // Template of the warning, the wrapper's countdown notice if empty
+	Notice   string        `json:"notice"`  // Template of the restart notice, the wrapper's if empty
+}
+
+// Validate checks a schedule.
+func (s *Schedule) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("%w: no name", ErrInvalid)
+	}
+
+	_, err := time.Parse("15:04", s.Start)
+	if err != nil {
+		return fmt.Errorf("%w: start %q isn't HH:MM", ErrInvalid, s.Start)
+	}
+
+	_, err = time.Parse("15:04", s.End)
+	if err != nil {
+		return fmt.Errorf("%w: end %q isn't HH:MM", ErrInvalid, s.End)
+	}
+
+	for _, day := range s.Days {
+		if dayIndex(day) < 0 {
+			return fmt.Errorf("%w: unknown day %q, expected one of %s", ErrInvalid, day, strings.Join(days, ", "))
+		}
+	}
+
+	if len(s.Settings) == 0 && len(s.Commands) == 0 && s.Restart == nil {
+		return fmt.Errorf("%w: no settings, commands or restart", ErrInvalid)
+	}
+
+	if r := s.Restart; r != nil {
+		if r.EmptyMinutes <= 0 {
+			return fmt.Errorf("%w: empty_minutes must be positive", ErrInvalid)
+		}
+
+		for _, seconds := range r.Countdown {
+			if seconds <= 0 {
+				return fmt.Errorf("%w: countdown seconds must be positive", ErrInvalid)
+			}
+		}
+	}
+
+	for key, value := range s.Settings {
+		values, ok := Settings[key]
+		if !ok {
+			return fmt.Errorf("%w: unknown setting %q", ErrInvalid, key)
+		}
+
+		if !contains(values, value) {
+			return fmt.Errorf("%w: %s must be one of %s", ErrInvalid, key, strings.Join(values, ", "))
+		}
+	}
+
+	// A line break would end the console command early and run the rest as
+	// another command
+	for _, lines := range [][]string{s.Commands, s.RevertCommands, {s.Announce, s.AnnounceEnd}} {
+		for _, line := range lines {
+			if strings.ContainsAny(line, "\r\n") {
+				return fmt.Errorf("%w: commands and announcements must be single lines", ErrInvalid)
+			}
+		}
+	}
+
+	if r := s.Restart; r != nil {
+		for _, template := range []string{r.Message, r.Notice} {
+			err := notices.ValidateTemplate(template)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalid, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// activeAt returns when the window containing t started, or the zero time
+// if t is outside the schedule's windows. Windows start on the listed days
+// and may end the next day, so windows on consecutive days with the same
+// start and end join up.
+func (s Schedule) activeAt(t time.Time) time.Time {
+	start, length, ok := s.window()
+	if !ok {
+		return time.Time{}
+	}
+
+	// A window containing t started today or, past midnight, yesterday
+	for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+		from := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, t.Location())
+
+		if s.onDay(from.Weekday()) && !t.Before(from) && t.Before(from.Add(length)) {
+			return from
+		}
+	}
+
+	return time.Time{}
+}
+
+// window returns the start time of the schedule's windows and their
+// length.
+func (s Schedule) window() (time.Time, time.Duration, bool) {
+	start, err := time.Parse("15:04", s.Start)
+	if err != nil {
+		return start, 0, false
+	}
+
+	end, err := time.Parse("15:04", s.End)
+	if err != nil {
+		return start, 0, false
+	}
+
+	length := end.Sub(start)
+	if length <= 0 {
+		length += 24 * time.Hour
+	}
+
+	return start, length, true
+}
+
+// onDay reports whether windows start on a day.
+func (s Schedule) onDay(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+
+	for _, d := range s.Days {
+		if dayIndex(d) == int(day) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Change is a schedule starting or ending: the settings to save and apply,
+// and the commands to run, the announcement included.
+type Change struct {
+	Schedule string            `json:"schedule"` // ID
+	Name     string            `json:"name"`
+	Start    bool              `json:"start"` // Whether the schedule starts or ends
+	Settings map[string]string `json:"settings,omitempty"`
+	Commands []string          `json:"commands,omitempty"`
+
+	// Restart is set when a window with a deferred restart ends without the
+	// server having been empty long enough: it restarts at this deadline,
+	// saying Notice if set instead of the wrapper's restart notice
+	Restart bool   `json:"restart,omitempty"`
+	Notice  string `json:"notice,omitempty"`
+}
+
+// Active is a schedule in a window, with the settings it replaced.
+type Active struct {
+	Since    time.Time         `json:"since"`
+	Baseline map[string]string `json:"baseline"` // Settings before the schedule started
+
+	// Restarted is set once the server restarted in the window, Warned is
+	// the last countdown warning given, in seconds
+	Restarted bool `json:"restarted,omitempty"`
+	Warned    int  `json:"warned,omitempty"`
+}
+
+// file is the JSON stored by a Store.
+type file struct {
+	Schedules []Schedule         `json:"schedules"`
+	Active    map[string]*Active `json:"active"` // By schedule ID
+}
+
+// Store keeps schedules, and those in a window, in a JSON file so settings
+// are still reverted after a restart.
+type Store struct {
+	path string
+	mu   sync.Mutex
+	data file
+}
+
+// Open loads the store at path, starting empty if it doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, data: file{Schedules: []Schedule{}, Active: map[string]*Active{}}}
+
+	err := jsonfile.Load(path, &s.data)
+	if err != nil {
+		return nil, fmt.Errorf("error loading schedules: %w", err)
+	}
+
+	if s.data.Schedules == nil {
+		s.data.Schedules = []Schedule{}
+	}
+
+	if s.data.Active == nil {
+		s.data.Active = map[string]*Active{}
+	}
+
+	return s, nil
+}
+
+// save persists the schedules and the active changes, with s.mu held.
+func (s *Store) save() error {
+	err := jsonfile.Save(s.path, s.data)
+	if err != nil {
+		return fmt.Errorf("error saving schedules: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the schedules.
+func (s *Store) List() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Schedule{}, s.data.Schedules...)
+}
+
+// Active returns the schedules in a window, by ID.
+func (s *Store) Active() map[string]Active {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active := make(map[string]Active, len(s.data.Active))
+	for id, a := range s.data.Active {
+		active[id] = *a
+	}
+
+	return active
+}
+
+// Put adds a schedule, or replaces the one with the same ID. New schedules
+// get an ID. A schedule in a window keeps the settings it replaced, so
+// they are still reverted at the end.
+func (s *Store) Put(schedule Schedule) (Schedule, error) {
+	err := schedule.Validate()
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if schedule.ID == "" {
+		b := make([]byte, 6)
+
+		_, err := rand.Read(b)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("error generating ID: %w", err)
+		}
+
+		schedule.ID = hex.EncodeToString(b)
+		s.data.Schedules = append(s.data.Schedules, schedule)
+	} else {
+		i := s.index(schedule.ID)
+		if i < 0 {
+			return Schedule{}, ErrNotFound
+		}
+
+		s.data.Schedules[i] = schedule
+	}
+
+	return schedule, s.save()
+}
+
+// Get returns a schedule by ID.
+func (s *Store) Get(id string) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i < 0 {
+		return Schedule{}, ErrNotFound
+	}
+
+	return s.data.Schedules[i], nil
+}
+
+// Set saves a schedule under the ID it has, adding it if there is none
+// with that ID yet, and reports whether it was added. Unlike Put, saving
+// the same schedule again changes nothing, so clients can choose stable
+// IDs.
+func (s *Store) Set(schedule Schedule) (Schedule, bool, error) {
+	if !idPattern.MatchString(schedule.ID) {
+		return Schedule{}, false, fmt.Errorf("%w: IDs are up to 64 letters, digits, '.', '_' or '-'", ErrInvalid)
+	}
+
+	err := schedule.Validate()
+	if err != nil {
+		return Schedule{}, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(schedule.ID)
+	if i < 0 {
+		s.data.Schedules = append(s.data.Schedules, schedule)
+	} else {
+		s.data.Schedules[i] = schedule
+	}
+
+	return schedule, i < 0, s.save()
+}
+
+// Delete removes a schedule. If it is in a window, its settings are
+// reverted by the next Due.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	s.data.Schedules = append(s.data.Schedules[:i], s.data.Schedules[i+1:]...)
+
+	return s.save()
+}
+
+// index returns the position of a schedule, or -1. The caller must hold the
+// lock.
+func (s *Store) index(id string) int {
+	for i, schedule := range s.data.Schedules {
+		if schedule.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Due returns the schedules starting and ending at now. Starting schedules
+// remember the current value of the settings they change, read from
+// current (server.properties), and ending ones, including those disabled
+// or deleted in a window, restore them. Ends come first so a schedule
+// taking over from another sees the reverted settings.
+func (s *Store) Due(now time.Time, current map[string]string) ([]Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []Change
+
+	ending := make([]string, 0, len(s.data.Active))
+	for id := range s.data.Active {
+		i := s.index(id)
+		if i < 0 || !s.data.Schedules[i].Enabled || s.data.Schedules[i].activeAt(now).IsZero() {
+			ending = append(ending, id)
+		}
+	}
+
+	sort.Strings(ending)
+
+	for _, id := range ending {
+		change := Change{Schedule: id, Settings: s.data.Active[id].Baseline}
+
+		if i := s.index(id); i >= 0 {
+			schedule := s.data.Schedules[i]
+			change.Name = schedule.Name
+			change.Commands = endCommands(schedule, change.Settings)
+
+			// Deadline of a restart that was deferred all window long. One
+			// missed while the wrapper was down isn't made up for, the
+			// server started afresh since.
+			_, length, _ := schedule.window()
+			late := now.Sub(s.data.Active[id].Since.Add(length))
+			change.Restart = schedule.Enabled && schedule.Restart != nil && !s.data.Active[id].Restarted && late < restartLate
+
+			if change.Restart {
+				change.Notice = schedule.Restart.Notice
+			}
+		} else {
+			change.Commands = settingsCommands(change.Settings)
+		}
+
+		delete(s.data.Active, id)
+
+		changes = append(changes, change)
+	}
+
+	for _, schedule := range s.data.Schedules {
+		if !schedule.Enabled || s.data.Active[schedule.ID] != nil {
+			continue
+		}
+
+		since := schedule.activeAt(now)
+		if since.IsZero() {
+			continue
+		}
+
+		baseline := make(map[string]string, len(schedule.Settings))
+
+		for key := range schedule.Settings {
+			value, ok := current[key]
+			if !ok {
+				value = defaults[key]
+			}
+
+			// A setting reverted by an ending schedule
+			for _, change := range changes {
+				if v, ok := change.Settings[key]; ok && !change.Start {
+					value = v
+				}
+			}
+
+			baseline[key] = value
+		}
+
+		s.data.Active[schedule.ID] = &Active{Since: since.UTC(), Baseline: baseline}
+
+		changes = append(changes, Change{
+			Schedule: schedule.ID,
+			Name:     schedule.Name,
+			Start:    true,
+			Settings: schedule.Settings,
+			Commands: startCommands(schedule),
+		})
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	return changes, s.save()
+}
+
+// RestartDue returns the step a deferred restart of a schedule in a window
+// calls for at now, given how long no player has been online (zero if some
+// are): a restart once the server was empty long enough, or a warning as
+// the end of the window nears. Only one restart is tracked at a time, the
+// first schedule's.
+func (s *Store) RestartDue(now time.Time, empty time.Duration) (RestartStep, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, schedule := range s.data.Schedules {
+		active := s.data.Active[schedule.ID]
+		if !schedule.Enabled || schedule.Restart == nil || active == nil || active.Restarted {
+			continue
+		}
+
+		step := RestartStep{
+			Schedule: schedule.ID,
+			Name:     schedule.Name,
+			Message:  schedule.Restart.Message,
+			Notice:   schedule.Restart.Notice,
+		}
+
+		if empty >= time.Duration(schedule.Restart.EmptyMinutes)*time.Minute {
+			active.Restarted = true
+			step.Restart = true
+
+			return step, true, s.save()
+		}
+
+		_, length, _ := schedule.window()
+		left := active.Since.Add(length).Sub(now)
+
+		countdown := schedule.Restart.Countdown
+		if len(countdown) == 0 {
+			countdown = DefaultCountdown
+		}
+
+		// The closest warning not given yet that the time left is within
+		warn := 0
+
+		for _, seconds := range countdown {
+			if left <= time.Duration(seconds)*time.Second && (warn == 0 || seconds < warn) {
+				warn = seconds
+			}
+		}
+
+		if warn == 0 || (active.Warned != 0 && warn >= active.Warned) {
+			return RestartStep{}, false, nil
+		}
+
+		active.Warned = warn
+		step.Warn = left.Round(time.Second)
+
+		return step, true, s.save()
+	}
+
+	return RestartStep{}, false, nil
+}
+
+// startCommands returns the commands run when a schedule starts.
+func startCommands(s Schedule) []string {
+	commands := settingsCommands(s.Settings)
+	commands = append(commands, s.Commands...)
+
+	if s.Announce != "" {
+		commands = append(commands, "say "+s.Announce)
+	}
+
+	return commands
+}
+
+// endCommands returns the commands run when a schedule ends, restoring
+// baseline.
+func endCommands(s Schedule, baseline map[string]string) []string {
+	commands := settingsCommands(baseline)
+	commands = append(commands, s.RevertCommands...)
+
+	if s.AnnounceEnd != "" {
+		commands = append(commands, "say "+s.AnnounceEnd)
+	}
+
+	return commands
+}
+
+// settingsCommands returns the commands applying settings to the running
+// server, in key order.
+func settingsCommands(settings map[string]string) []string {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	commands := make([]string, 0, len(keys))
+	for _, key := range keys {
+		commands = append(commands, settingCommands[key]+" "+settings[key])
+	}
+
+	return commands
+}
+
+func dayIndex(day string) int {
+	for i, d := range days {
+		if strings.EqualFold(d, day) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
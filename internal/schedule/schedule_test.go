@@ -0,0 +1,319 @@
+package schedule
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	for _, s := range []Schedule{
+		{Start: "08:00", End: "20:00", Settings: map[string]string{"difficulty": "hard"}},
+		{Name: "x", Start: "8am", End: "20:00", Settings: map[string]string{"difficulty": "hard"}},
+		{
+			Name:     "x",
+			Start:    "08:00",
+			End:      "20:00",
+			Days:     []string{"someday"},
+			Settings: map[string]string{"difficulty": "hard"},
+		},
+		{Name: "x", Start: "08:00", End: "20:00", Settings: map[string]string{"difficulty": "insane"}},
+		{Name: "x", Start: "08:00", End: "20:00", Settings: map[string]string{"pvp": "true"}},
+		{Name: "x", Start: "08:00", End: "20:00"},
+		{Name: "x", Start: "08:00", End: "20:00", Commands: []string{"gamerule pvp false\nstop"}},
+		{Name: "x", Start: "03:00", End: "06:00", Restart: &Restart{}},
+		{Name: "x", Start: "03:00", End: "06:00", Restart: &Restart{EmptyMinutes: 10, Countdown: []int{0}}},
+		{Name: "x", Start: "03:00", End: "06:00", Restart: &Restart{EmptyMinutes: 10, Message: "Restart in {hours}"}},
+	} {
+		err := s.Validate()
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %+v to be invalid, got %v", s, err)
+		}
+	}
+
+	s := Schedule{
+		Name:     "weekend",
+		Days:     []string{"Sat", "sun"},
+		Start:    "00:00",
+		End:      "00:00",
+		Commands: []string{"gamerule pvp true"},
+	}
+
+	err := s.Validate()
+	if err != nil {
+		t.Errorf("Expected a valid schedule, got %v", err)
+	}
+
+	s = Schedule{Name: "nightly restart", Start: "03:00", End: "06:00", Restart: &Restart{EmptyMinutes: 10}}
+
+	err = s.Validate()
+	if err != nil {
+		t.Errorf("Expected a restart-only schedule to be valid, got %v", err)
+	}
+}
+
+func TestActiveAt(t *testing.T) {
+	// Saturday 22:00 to Sunday 06:00
+	s := Schedule{Days: []string{"sat"}, Start: "22:00", End: "06:00"}
+
+	saturday := time.Date(2024, 1, 6, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		at     time.Time
+		active bool
+	}{
+		{saturday.Add(21 * time.Hour), false},
+		{saturday.Add(22 * time.Hour), true},
+		{saturday.Add(29 * time.Hour), true},  // Sunday 05:00
+		{saturday.Add(30 * time.Hour), false}, // Sunday 06:00
+		{saturday.Add(46 * time.Hour), false}, // Sunday 22:00
+	}
+
+	for _, tt := range tests {
+		if active := !s.activeAt(tt.at).IsZero(); active != tt.active {
+			t.Errorf("activeAt(%s) = %v, want %v", tt.at.Format(time.DateTime), active, tt.active)
+		}
+	}
+}
+
+func TestDue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	hard, err := store.Put(Schedule{
+		Name:        "weekend hard mode",
+		Days:        []string{"sat", "sun"},
+		Start:       "00:00",
+		End:         "00:00",
+		Settings:    map[string]string{"difficulty": "hard"},
+		Announce:    "Hard mode is on for the weekend",
+		AnnounceEnd: "Hard mode is over",
+		Enabled:     true,
+	})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	current := map[string]string{"difficulty": "normal"}
+	friday := time.Date(2024, 1, 5, 12, 0, 0, 0, time.Local)
+
+	changes, err := store.Due(friday, current)
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("Expected no changes on Friday, got %+v, %v", changes, err)
+	}
+
+	changes, err = store.Due(friday.Add(24*time.Hour), current)
+	if err != nil {
+		t.Fatalf("Due failed: %v", err)
+	}
+
+	want := []Change{{
+		Schedule: hard.ID,
+		Name:     "weekend hard mode",
+		Start:    true,
+		Settings: map[string]string{"difficulty": "hard"},
+		Commands: []string{"difficulty hard", "say Hard mode is on for the weekend"},
+	}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Unexpected start %+v", changes)
+	}
+
+	// Still active into Sunday, so nothing happens again
+	for _, at := range []time.Time{friday.Add(25 * time.Hour), friday.Add(36 * time.Hour), friday.Add(50 * time.Hour)} {
+		changes, _ = store.Due(at, map[string]string{"difficulty": "hard"})
+		if len(changes) != 0 {
+			t.Errorf("Expected no changes at %s, got %+v", at.Format(time.DateTime), changes)
+		}
+	}
+
+	// The active schedule survives a restart
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	if active := store.Active(); active[hard.ID].Baseline["difficulty"] != "normal" {
+		t.Errorf("Expected the baseline to be kept, got %+v", active)
+	}
+
+	// Monday reverts
+	changes, err = store.Due(time.Date(2024, 1, 8, 0, 0, 10, 0, time.Local), map[string]string{"difficulty": "hard"})
+	if err != nil {
+		t.Fatalf("Due failed: %v", err)
+	}
+
+	want = []Change{{
+		Schedule: hard.ID,
+		Name:     "weekend hard mode",
+		Settings: map[string]string{"difficulty": "normal"},
+		Commands: []string{"difficulty normal", "say Hard mode is over"},
+	}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Unexpected end %+v", changes)
+	}
+
+	if len(store.Active()) != 0 {
+		t.Error("Expected no active schedules")
+	}
+}
+
+func TestDue_Deleted(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "schedules.json"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	night, err := store.Put(Schedule{
+		Name:     "peaceful nights",
+		Start:    "23:00",
+		End:      "07:00",
+		Settings: map[string]string{"difficulty": "peaceful"},
+		Enabled:  true,
+	})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	midnight := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+
+	changes, _ := store.Due(midnight, map[string]string{})
+	if len(changes) != 1 || !changes[0].Start {
+		t.Fatalf("Expected the schedule to start, got %+v", changes)
+	}
+
+	err = store.Delete(night.ID)
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	// The setting missing from server.properties reverts to its default
+	changes, _ = store.Due(midnight.Add(time.Minute), map[string]string{"difficulty": "peaceful"})
+	if len(changes) != 1 || changes[0].Start || !reflect.DeepEqual(changes[0].Commands, []string{"difficulty easy"}) {
+		t.Errorf("Expected the deleted schedule to revert, got %+v", changes)
+	}
+}
+
+func TestSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	weekends := Schedule{
+		ID:       "weekends",
+		Name:     "hard weekends",
+		Days:     []string{"sat"},
+		Start:    "00:00",
+		End:      "00:00",
+		Settings: map[string]string{"difficulty": "hard"},
+	}
+
+	_, added, err := store.Set(weekends)
+	if err != nil || !added {
+		t.Fatalf("Expected the schedule to be added, got %v, %v", added, err)
+	}
+
+	weekends.Name = "weekends"
+
+	_, added, err = store.Set(weekends)
+	if err != nil || added {
+		t.Fatalf("Expected the schedule to be replaced, got %v, %v", added, err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	got, err := reopened.Get("weekends")
+	if err != nil || got.Name != "weekends" || len(reopened.List()) != 1 {
+		t.Errorf("Unexpected schedule %+v, %v", got, err)
+	}
+
+	_, _, err = store.Set(Schedule{ID: "../x", Name: "x", Start: "00:00", End: "01:00"})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an invalid ID, got %v", err)
+	}
+
+	_, err = store.Get("missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a missing schedule, got %v", err)
+	}
+}
+
+func TestRestartDue(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "schedules.json"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	nightly, err := store.Put(Schedule{
+		Name:    "nightly restart",
+		Start:   "03:00",
+		End:     "06:00",
+		Restart: &Restart{EmptyMinutes: 10, Countdown: []int{300, 60}},
+		Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	night := time.Date(2024, 1, 5, 3, 0, 0, 0, time.Local)
+
+	if _, ok, _ := store.RestartDue(night, time.Hour); ok {
+		t.Error("Expected no restart before the window started")
+	}
+
+	_, _ = store.Due(night, nil)
+
+	if _, ok, _ := store.RestartDue(night.Add(time.Hour), 5*time.Minute); ok {
+		t.Error("Expected the restart to be deferred while the server wasn't empty long enough")
+	}
+
+	// Warned at 300 and 60 seconds before the end, once each
+	for _, c := range []struct {
+		at   time.Duration
+		warn time.Duration
+	}{
+		{2*time.Hour + 50*time.Minute, 0},
+		{2*time.Hour + 56*time.Minute, 4 * time.Minute},
+		{2*time.Hour + 57*time.Minute, 0},
+		{2*time.Hour + 59*time.Minute + 30*time.Second, 30 * time.Second},
+	} {
+		step, ok, err := store.RestartDue(night.Add(c.at), 0)
+		if err != nil || ok != (c.warn != 0) || step.Warn != c.warn || step.Restart {
+			t.Errorf("At +%s expected a warning of %s, got %+v, %v, %v", c.at, c.warn, step, ok, err)
+		}
+	}
+
+	// Nobody left, the deadline restarts the server
+	changes, _ := store.Due(night.Add(3*time.Hour), nil)
+	if len(changes) != 1 || !changes[0].Restart {
+		t.Errorf("Expected a restart at the deadline, got %+v", changes)
+	}
+
+	// The next night the server empties out in time
+	_, _ = store.Due(night.Add(24*time.Hour), nil)
+
+	step, ok, err := store.RestartDue(night.Add(25*time.Hour), 10*time.Minute)
+	if err != nil || !ok || !step.Restart || step.Schedule != nightly.ID {
+		t.Fatalf("Expected a restart once empty, got %+v, %v, %v", step, ok, err)
+	}
+
+	if _, ok, _ := store.RestartDue(night.Add(26*time.Hour), time.Hour); ok {
+		t.Error("Expected a single restart per window")
+	}
+
+	changes, _ = store.Due(night.Add(27*time.Hour), nil)
+	if len(changes) != 1 || changes[0].Restart {
+		t.Errorf("Expected no deadline restart after restarting, got %+v", changes)
+	}
+}
@@ -0,0 +1,169 @@
+package scripting
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// memoryCheckInterval is how many instructions run between walks of
+	// everything a script keeps.
+	memoryCheckInterval = 256
+
+	// Rough sizes of Lua values besides their strings, in bytes.
+	tableSize    = 64
+	entrySize    = 32
+	functionSize = 64
+)
+
+// meter is the context of a running script. The Lua VM asks for Done before
+// each instruction, which checks the script's memory: the strings in the
+// registers of the running function every time, as one instruction can
+// double a string, and every memoryCheckInterval instructions the globals,
+// locals and upvalues it can reach. A script over the limit is stopped as
+// if it timed out.
+type meter struct {
+	context.Context
+
+	cancel context.CancelFunc
+	state  *lua.LState
+	limit  int
+	steps  int
+	err    error // Why the script was stopped, nil unless over the limit
+}
+
+// newMeter returns a meter for a call to the state, with a timeout.
+func newMeter(state *lua.LState, limits Limits) *meter {
+	ctx, cancel := context.WithTimeout(context.Background(), limits.Timeout)
+
+	return &meter{Context: ctx, cancel: cancel, state: state, limit: limits.Memory}
+}
+
+// Done checks the memory of the script before returning the channel the VM
+// selects on.
+func (m *meter) Done() <-chan struct{} {
+	if m.err == nil && m.limit > 0 {
+		m.check()
+	}
+
+	return m.Context.Done()
+}
+
+// check stops the script if it holds more than the limit.
+func (m *meter) check() {
+	size := 0
+
+	for i := 1; i <= m.state.GetTop(); i++ {
+		if s, ok := m.state.Get(i).(lua.LString); ok {
+			size += len(s)
+		}
+	}
+
+	m.steps++
+	if size <= m.limit && m.steps%memoryCheckInterval == 0 {
+		size = m.reachable()
+	}
+
+	if size > m.limit {
+		m.err = fmt.Errorf("script uses more than %d bytes of memory", m.limit)
+		m.cancel()
+	}
+}
+
+// reachable returns the size of the values the script can reach, or
+// something over the limit once it's known to be. Strings are counted for
+// each reference to them.
+func (m *meter) reachable() int {
+	w := walker{seen: map[any]bool{}, limit: m.limit}
+
+	w.add(m.state.G.Global)
+
+	for level := 0; ; level++ {
+		dbg, ok := m.state.GetStack(level)
+		if !ok {
+			break
+		}
+
+		fn, err := m.state.GetInfo("f", dbg, lua.LNil)
+		if err == nil {
+			w.add(fn)
+		}
+
+		for n := 1; ; n++ {
+			name, value := m.state.GetLocal(dbg, n)
+			if name == "" {
+				break
+			}
+
+			w.add(value)
+		}
+	}
+
+	for i := 1; i <= m.state.GetTop(); i++ {
+		w.add(m.state.Get(i))
+	}
+
+	return w.size
+}
+
+// callError returns the error of a call stopped by the meter or its
+// timeout, or err.
+func (m *meter) callError(err error, timeout time.Duration) error {
+	switch {
+	case m.err != nil:
+		return m.err
+	case m.Err() != nil:
+		return fmt.Errorf("script ran longer than %v", timeout)
+	default:
+		return err
+	}
+}
+
+// walker adds up the size of Lua values, visiting tables and functions
+// once.
+type walker struct {
+	seen  map[any]bool
+	size  int
+	limit int
+}
+
+// add adds the size of a value and of what it refers to.
+func (w *walker) add(value lua.LValue) {
+	if w.size > w.limit {
+		return
+	}
+
+	switch value := value.(type) {
+	case lua.LString:
+		w.size += len(value)
+	case *lua.LTable:
+		if w.seen[value] {
+			return
+		}
+
+		w.seen[value] = true
+		w.size += tableSize
+
+		value.ForEach(func(k, v lua.LValue) {
+			w.size += entrySize
+			w.add(k)
+			w.add(v)
+		})
+
+		w.add(value.Metatable)
+	case *lua.LFunction:
+		if w.seen[value] {
+			return
+		}
+
+		w.seen[value] = true
+		w.size += functionSize
+
+		for _, upvalue := range value.Upvalues {
+			w.add(upvalue.Value())
+		}
+	}
+}
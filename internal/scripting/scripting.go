@@ -0,0 +1,283 @@
+// Package scripting runs user Lua scripts on server events in a sandbox.
+// Scripts define on_event(event) and may queue console commands and
+// webhooks, log lines, and hide or rewrite console lines.
+package scripting
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// File is the file the scripts are kept in.
+const File = "scripts.json"
+
+// maxFailures disables a script after this many errors in a row.
+const maxFailures = 10
+
+var (
+	ErrNotFound = errors.New("script not found")
+	ErrInvalid  = errors.New("invalid script")
+)
+
+// Script is a Lua event handler.
+type Script struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source"`
+}
+
+// Event is something that happened on the server: a console line
+// ("output"), a player joining or leaving ("join", "leave"), the server
+// starting ("start") or crashing ("crash").
+type Event struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Player string    `json:"player,omitempty"`
+	XUID   string    `json:"xuid,omitempty"`
+	Line   string    `json:"line,omitempty"`
+}
+
+// loaded is an enabled script and its VM.
+type loaded struct {
+	script   Script
+	vm       *vm
+	failures int
+}
+
+// Engine keeps scripts in a JSON file and runs the enabled ones.
+type Engine struct {
+	path    string
+	limits  Limits
+	mu      sync.Mutex
+	scripts []Script
+	loaded  map[string]*loaded
+}
+
+// Open loads the scripts in dir and compiles the enabled ones. Scripts that
+// fail to compile are logged and left disabled until fixed.
+func Open(dir string, limits Limits) (*Engine, error) {
+	e := &Engine{
+		path:    filepath.Join(dir, File),
+		limits:  limits,
+		scripts: []Script{},
+		loaded:  map[string]*loaded{},
+	}
+
+	err := jsonfile.Load(e.path, &e.scripts)
+	if err != nil {
+		return nil, fmt.Errorf("error loading scripts: %w", err)
+	}
+
+	for _, s := range e.scripts {
+		if !s.Enabled {
+			continue
+		}
+
+		v, err := compile(s.Source, limits)
+		if err != nil {
+			fmt.Printf("Error loading script %s: %v\n", s.Name, err)
+			continue
+		}
+
+		e.loaded[s.ID] = &loaded{script: s, vm: v}
+	}
+
+	return e, nil
+}
+
+// save writes the scripts. The caller must hold the lock.
+func (e *Engine) save() error {
+	err := jsonfile.Save(e.path, e.scripts)
+	if err != nil {
+		return fmt.Errorf("error saving scripts: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the scripts.
+func (e *Engine) List() []Script {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]Script{}, e.scripts...)
+}
+
+// Put adds a script, or replaces the one with the same ID, after checking
+// that it compiles. New scripts get an ID.
+func (e *Engine) Put(s Script) (Script, error) {
+	if s.Name == "" {
+		return Script{}, fmt.Errorf("%w: a name is required", ErrInvalid)
+	}
+
+	v, err := compile(s.Source, e.limits)
+	if err != nil {
+		return Script{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if s.ID == "" {
+		b := make([]byte, 6)
+
+		_, err := rand.Read(b)
+		if err != nil {
+			v.close()
+			return Script{}, fmt.Errorf("error generating ID: %w", err)
+		}
+
+		s.ID = hex.EncodeToString(b)
+		e.scripts = append(e.scripts, s)
+	} else {
+		i := e.index(s.ID)
+		if i < 0 {
+			v.close()
+			return Script{}, ErrNotFound
+		}
+
+		e.scripts[i] = s
+	}
+
+	e.unload(s.ID)
+
+	if s.Enabled {
+		e.loaded[s.ID] = &loaded{script: s, vm: v}
+	} else {
+		v.close()
+	}
+
+	return s, e.save()
+}
+
+// Delete removes a script.
+func (e *Engine) Delete(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	i := e.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	e.scripts = append(e.scripts[:i], e.scripts[i+1:]...)
+	e.unload(id)
+
+	return e.save()
+}
+
+// index returns the position of a script, or -1. The caller must hold the
+// lock.
+func (e *Engine) index(id string) int {
+	for i, s := range e.scripts {
+		if s.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// unload closes the VM of a script. The caller must hold the lock.
+func (e *Engine) unload(id string) {
+	if l, ok := e.loaded[id]; ok {
+		l.vm.close()
+		delete(e.loaded, id)
+	}
+}
+
+// Handle runs the enabled scripts on an event, in the order they were
+// added. A script failing maxFailures times in a row is disabled; its last
+// result says so.
+func (e *Engine) Handle(ev Event) []Result {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var results []Result
+
+	for _, s := range e.scripts {
+		l, ok := e.loaded[s.ID]
+		if !ok {
+			continue
+		}
+
+		result := l.vm.call(ev)
+		result.Script = s.Name
+
+		if result.Error == "" {
+			l.failures = 0
+		} else {
+			l.failures++
+
+			// A failed call may leave the state half changed, so the
+			// script starts over
+			e.reload(l)
+
+			if l.failures >= maxFailures {
+				result.Error += fmt.Sprintf("; disabled after %d errors in a row", maxFailures)
+				e.disable(s.ID)
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// reload replaces a script's VM with a fresh one. The caller must hold the
+// lock.
+func (e *Engine) reload(l *loaded) {
+	v, err := compile(l.script.Source, e.limits)
+	if err != nil {
+		return
+	}
+
+	l.vm.close()
+	l.vm = v
+}
+
+// disable turns a script off. The caller must hold the lock.
+func (e *Engine) disable(id string) {
+	e.unload(id)
+
+	i := e.index(id)
+	if i < 0 {
+		return
+	}
+
+	e.scripts[i].Enabled = false
+
+	err := e.save()
+	if err != nil {
+		fmt.Printf("Error disabling script: %v\n", err)
+	}
+}
+
+// Eval runs a script on an event in a fresh sandbox without keeping it, for
+// trying scripts out. Nothing it queues is carried out.
+func Eval(source string, ev Event, limits Limits) Result {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+
+	v, err := compile(source, limits)
+	if err != nil {
+		return Result{Commands: []string{}, Webhooks: []Webhook{}, Logs: []string{}, Error: err.Error()}
+	}
+	defer v.close()
+
+	return v.call(ev)
+}
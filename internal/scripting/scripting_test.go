@@ -0,0 +1,163 @@
+package scripting
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const welcome = `
+joins = 0
+
+function on_event(event)
+  if event.type == "join" then
+    joins = joins + 1
+    command("tellraw " .. event.player .. " " .. json({rawtext = {{text = "Welcome #" .. joins}}}))
+    webhook("https://example.com/hook", {player = event.player})
+  end
+
+  if event.type == "output" and event.line:find("secret") then
+    return false
+  end
+
+  if event.type == "output" and event.line:find("Steve") then
+    return (event.line:gsub("Steve", "S."))
+  end
+end
+`
+
+func TestHandle(t *testing.T) {
+	dir := t.TempDir()
+
+	engine, err := Open(dir, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Failed to open engine: %v", err)
+	}
+
+	_, err = engine.Put(Script{Name: "welcome", Enabled: true, Source: welcome})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	engine.Handle(Event{Type: "join", Player: "Alex"})
+
+	results := engine.Handle(Event{Type: "join", Player: "Steve"})
+	if len(results) != 1 || results[0].Error != "" {
+		t.Fatalf("Unexpected results: %+v", results)
+	}
+
+	// Globals are kept between events
+	if got := results[0].Commands; len(got) != 1 || got[0] != `tellraw Steve {"rawtext":[{"text":"Welcome #2"}]}` {
+		t.Errorf("Unexpected commands: %q", got)
+	}
+
+	if got := results[0].Webhooks; len(got) != 1 || got[0].Body != `{"player":"Steve"}` {
+		t.Errorf("Unexpected webhooks: %+v", got)
+	}
+
+	if r := engine.Handle(Event{Type: "output", Line: "the secret is"}); !r[0].Drop {
+		t.Errorf("Expected the line to be dropped, got %+v", r[0])
+	}
+
+	if r := engine.Handle(Event{Type: "output", Line: "Steve joined"}); r[0].Replace == nil ||
+		*r[0].Replace != "S. joined" {
+		t.Errorf("Expected the line to be rewritten, got %+v", r[0])
+	}
+
+	if r := engine.Handle(Event{Type: "output", Line: "nothing"}); r[0].Drop || r[0].Replace != nil {
+		t.Errorf("Expected the line to be left alone, got %+v", r[0])
+	}
+
+	reopened, err := Open(dir, DefaultLimits)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+
+	if r := reopened.Handle(Event{Type: "join", Player: "Alex"}); len(r) != 1 ||
+		!strings.Contains(r[0].Commands[0], "#1") {
+		t.Errorf("Expected the script to be loaded again, got %+v", r)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	for name, source := range map[string]string{
+		"infinite loop":  `function on_event(e) while true do end end`,
+		"file access":    `function on_event(e) dofile("/etc/passwd") end`,
+		"os library":     `function on_event(e) os.execute("id") end`,
+		"large string":   `function on_event(e) local s = string.rep("x", 1e9) end`,
+		"command flood":  `function on_event(e) for i = 1, 100 do command("say " .. i) end end`,
+		"multi-line":     `function on_event(e) command("say hi\nstop") end`,
+		"bad webhook":    `function on_event(e) webhook("file:///etc/passwd", "") end`,
+		"deep recursion": `function f(n) return f(n + 1) + 1 end function on_event(e) f(1) end`,
+	} {
+		result := Eval(source, Event{Type: "output"}, DefaultLimits)
+		if result.Error == "" {
+			t.Errorf("%s: expected an error", name)
+		}
+
+		if len(result.Commands) != 0 {
+			t.Errorf("%s: expected no commands from a failed call, got %q", name, result.Commands)
+		}
+	}
+
+	_, err := compile(`x = 1`, DefaultLimits)
+	if !errors.Is(err, errNoHandler) {
+		t.Errorf("Expected scripts without on_event to be refused, got %v", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	// The timeout is long enough that only the memory limit stops them
+	limits := DefaultLimits
+	limits.Timeout = 10 * time.Second
+
+	for name, source := range map[string]string{
+		"doubling":      `function on_event(e) local s = ("x"):rep(1) while true do s = s .. s end end`,
+		"kept":          `t = {} function on_event(e) for i = 1, 1e9 do t[#t + 1] = ("x"):rep(1000) .. i end end`,
+		"table.concat":  `function on_event(e) local s = ("x"):rep(60000) return table.concat({s, s}) end`,
+		"string.format": `function on_event(e) local s = ("x"):rep(60000) return string.format("%s%s", s, s) end`,
+	} {
+		start := time.Now()
+
+		result := Eval(source, Event{Type: "output"}, limits)
+		if !strings.Contains(result.Error, "bytes") {
+			t.Errorf("%s: expected a memory error, got %q", name, result.Error)
+		}
+
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: expected the script to be stopped early, it ran %v", name, elapsed)
+		}
+	}
+
+	// Strings built within the limits are fine
+	result := Eval(`function on_event(e) local s = ("x"):rep(1) for i = 1, 10 do s = s .. s end return s end`,
+		Event{Type: "output"}, limits)
+	if result.Error != "" || result.Replace == nil || len(*result.Replace) != 1024 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+func TestDisableAfterFailures(t *testing.T) {
+	engine, err := Open(t.TempDir(), DefaultLimits)
+	if err != nil {
+		t.Fatalf("Failed to open engine: %v", err)
+	}
+
+	_, err = engine.Put(Script{Name: "broken", Enabled: true, Source: `function on_event(e) error("boom") end`})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	for i := 0; i < maxFailures; i++ {
+		engine.Handle(Event{Type: "output"})
+	}
+
+	if list := engine.List(); list[0].Enabled {
+		t.Errorf("Expected the script to be disabled")
+	}
+
+	if r := engine.Handle(Event{Type: "output"}); len(r) != 0 {
+		t.Errorf("Expected disabled scripts not to run, got %+v", r)
+	}
+}
@@ -0,0 +1,419 @@
+package scripting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Limits bound what a script may do when handling an event.
+type Limits struct {
+	Timeout   time.Duration // Run time of a call
+	Commands  int           // Commands queued by a call
+	Webhooks  int           // Webhooks queued by a call
+	Logs      int           // Log lines of a call
+	MaxString int           // Size of strings built with library functions and of queued values
+	CallStack int           // Lua call depth
+	Registry  int           // Lua value stack size
+	Memory    int           // Bytes of strings and tables a script holds, zero is unlimited
+}
+
+// DefaultLimits are the limits of scripts handling events.
+var DefaultLimits = Limits{
+	Timeout:   50 * time.Millisecond,
+	Commands:  10,
+	Webhooks:  2,
+	Logs:      20,
+	MaxString: 64 << 10,
+	CallStack: 64,
+	Registry:  64 << 10,
+	Memory:    4 << 20,
+}
+
+// unsafeGlobals can reach the file system, load code or change other
+// functions' environments, so scripts don't get them.
+var unsafeGlobals = []string{
+	"dofile", "loadfile", "load", "loadstring", "require", "module",
+	"collectgarbage", "getfenv", "setfenv", "newproxy", "_printregs", "print",
+}
+
+// Webhook is an HTTP POST a script asked for.
+type Webhook struct {
+	URL  string `json:"url"`
+	Body string `json:"body"`
+}
+
+// Result is what a script did with an event. Actions are only queued; the
+// caller carries them out.
+type Result struct {
+	Script   string        `json:"script,omitempty"`
+	Drop     bool          `json:"drop,omitempty"`    // Hide the console line
+	Replace  *string       `json:"replace,omitempty"` // Show this instead of the console line
+	Commands []string      `json:"commands"`
+	Webhooks []Webhook     `json:"webhooks"`
+	Logs     []string      `json:"logs"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// vm is a compiled script with its own Lua state, which keeps globals
+// between events.
+type vm struct {
+	mu     sync.Mutex
+	state  *lua.LState
+	limits Limits
+	result *Result // Collects the actions of the running call
+}
+
+// errNoHandler is returned for scripts without an on_event function.
+var errNoHandler = errors.New("script must define function on_event(event)")
+
+// compile runs a script's top level in a fresh sandbox and checks that it
+// defines on_event.
+func compile(source string, limits Limits) (*vm, error) {
+	v := &vm{limits: limits}
+
+	v.state = lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   limits.CallStack,
+		RegistrySize:    1024,
+		RegistryMaxSize: limits.Registry,
+	})
+
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		v.state.Push(v.state.NewFunction(lib.open))
+		v.state.Push(lua.LString(lib.name))
+		v.state.Call(1, 0)
+	}
+
+	for _, name := range unsafeGlobals {
+		v.state.SetGlobal(name, lua.LNil)
+	}
+
+	str, ok := v.state.GetGlobal("string").(*lua.LTable)
+	if ok {
+		str.RawSetString("rep", v.state.NewFunction(v.rep))
+		v.wrap(str, "format", v.checkFormat)
+	}
+
+	table, ok := v.state.GetGlobal("table").(*lua.LTable)
+	if ok {
+		v.wrap(table, "concat", v.checkConcat)
+	}
+
+	v.state.SetGlobal("command", v.state.NewFunction(v.command))
+	v.state.SetGlobal("webhook", v.state.NewFunction(v.webhook))
+	v.state.SetGlobal("log", v.state.NewFunction(v.log))
+	v.state.SetGlobal("json", v.state.NewFunction(v.json))
+
+	m := newMeter(v.state, limits)
+	defer m.cancel()
+
+	v.state.SetContext(m)
+	defer v.state.RemoveContext()
+
+	err := v.state.DoString(source)
+	if err != nil {
+		v.state.Close()
+		return nil, fmt.Errorf("error loading script: %w", m.callError(err, limits.Timeout))
+	}
+
+	if _, ok := v.state.GetGlobal("on_event").(*lua.LFunction); !ok {
+		v.state.Close()
+		return nil, errNoHandler
+	}
+
+	return v, nil
+}
+
+// close releases the Lua state.
+func (v *vm) close() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.state.Close()
+}
+
+// call runs on_event with an event. A string result replaces a console
+// line and false drops it.
+func (v *vm) call(e Event) Result {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	result := Result{Commands: []string{}, Webhooks: []Webhook{}, Logs: []string{}}
+	v.result = &result
+
+	defer func() { v.result = nil }()
+
+	m := newMeter(v.state, v.limits)
+	defer m.cancel()
+
+	v.state.SetContext(m)
+	defer v.state.RemoveContext()
+
+	start := time.Now()
+
+	err := v.state.CallByParam(lua.P{
+		Fn:      v.state.GetGlobal("on_event"),
+		NRet:    1,
+		Protect: true,
+	}, v.event(e))
+
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		err = m.callError(err, v.limits.Timeout)
+
+		// Only the actions of calls that finish count
+		return Result{
+			Commands: []string{},
+			Webhooks: []Webhook{},
+			Logs:     result.Logs,
+			Error:    err.Error(),
+			Duration: result.Duration,
+		}
+	}
+
+	ret := v.state.Get(-1)
+	v.state.Pop(1)
+
+	switch ret := ret.(type) {
+	case lua.LBool:
+		result.Drop = !bool(ret)
+	case lua.LString:
+		s := string(ret)
+		result.Replace = &s
+	}
+
+	return result
+}
+
+// event converts an event to a Lua table.
+func (v *vm) event(e Event) *lua.LTable {
+	t := v.state.NewTable()
+	t.RawSetString("type", lua.LString(e.Type))
+	t.RawSetString("time", lua.LNumber(e.Time.Unix()))
+	t.RawSetString("player", lua.LString(e.Player))
+	t.RawSetString("xuid", lua.LString(e.XUID))
+	t.RawSetString("line", lua.LString(e.Line))
+
+	return t
+}
+
+// checkCall raises an error for actions outside on_event.
+func (v *vm) checkCall(L *lua.LState) {
+	if v.result == nil {
+		L.RaiseError("actions are only allowed in on_event")
+	}
+}
+
+// checkString raises an error for values that are too large.
+func (v *vm) checkString(L *lua.LState, s string, what string) {
+	if len(s) > v.limits.MaxString {
+		L.RaiseError("%s is longer than %d bytes", what, v.limits.MaxString)
+	}
+}
+
+// command(text) queues a console command.
+func (v *vm) command(L *lua.LState) int {
+	v.checkCall(L)
+
+	text := strings.TrimSpace(L.CheckString(1))
+
+	v.checkString(L, text, "command")
+
+	if text == "" || strings.ContainsAny(text, "\r\n") {
+		L.RaiseError("commands must be a single non-empty line")
+	}
+
+	if len(v.result.Commands) >= v.limits.Commands {
+		L.RaiseError("more than %d commands", v.limits.Commands)
+	}
+
+	v.result.Commands = append(v.result.Commands, text)
+
+	return 0
+}
+
+// webhook(url, body) queues an HTTP POST; tables are sent as JSON.
+func (v *vm) webhook(L *lua.LState) int {
+	v.checkCall(L)
+
+	target := L.CheckString(1)
+
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		L.RaiseError("webhooks need an http or https URL")
+	}
+
+	body := ""
+
+	switch arg := L.Get(2).(type) {
+	case *lua.LTable:
+		data, err := json.Marshal(toGo(arg, 0))
+		if err != nil {
+			L.RaiseError("error encoding webhook body: %v", err)
+		}
+
+		body = string(data)
+	case lua.LString:
+		body = string(arg)
+	case *lua.LNilType:
+	default:
+		L.ArgError(2, "string or table expected")
+	}
+
+	v.checkString(L, body, "webhook body")
+
+	if len(v.result.Webhooks) >= v.limits.Webhooks {
+		L.RaiseError("more than %d webhooks", v.limits.Webhooks)
+	}
+
+	v.result.Webhooks = append(v.result.Webhooks, Webhook{URL: target, Body: body})
+
+	return 0
+}
+
+// log(text) adds a line to the script's log.
+func (v *vm) log(L *lua.LState) int {
+	text := L.CheckString(1)
+
+	v.checkString(L, text, "log line")
+
+	if v.result != nil && len(v.result.Logs) < v.limits.Logs {
+		v.result.Logs = append(v.result.Logs, text)
+	}
+
+	return 0
+}
+
+// json(value) encodes a table or value as JSON.
+func (v *vm) json(L *lua.LState) int {
+	data, err := json.Marshal(toGo(L.CheckAny(1), 0))
+	if err != nil {
+		L.RaiseError("error encoding JSON: %v", err)
+	}
+
+	v.checkString(L, string(data), "JSON")
+	L.Push(lua.LString(data))
+
+	return 1
+}
+
+// rep is string.rep with a size limit.
+func (v *vm) rep(L *lua.LState) int {
+	s := L.CheckString(1)
+	n := L.CheckInt(2)
+
+	if n > 0 && len(s)*n > v.limits.MaxString {
+		L.RaiseError("string.rep result is longer than %d bytes", v.limits.MaxString)
+	}
+
+	if n <= 0 {
+		L.Push(lua.LString(""))
+		return 1
+	}
+
+	L.Push(lua.LString(strings.Repeat(s, n)))
+
+	return 1
+}
+
+// wrap replaces the library function name of lib by one that runs check
+// first, which raises an error for calls building strings that are too
+// large.
+func (v *vm) wrap(lib *lua.LTable, name string, check func(L *lua.LState)) {
+	fn, ok := lib.RawGetString(name).(*lua.LFunction)
+	if !ok || !fn.IsG {
+		return
+	}
+
+	lib.RawSetString(name, v.state.NewFunction(func(L *lua.LState) int {
+		check(L)
+
+		return fn.GFunction(L)
+	}))
+}
+
+// checkFormat bounds string.format: its result is at most the format and
+// the arguments as strings, padded to a width of up to 99.
+func (v *vm) checkFormat(L *lua.LState) {
+	size := len(L.CheckString(1))
+
+	for i := 2; i <= L.GetTop(); i++ {
+		size += len(L.Get(i).String()) + 99
+	}
+
+	if size > v.limits.MaxString {
+		L.RaiseError("string.format result may be longer than %d bytes", v.limits.MaxString)
+	}
+}
+
+// checkConcat bounds table.concat by the size of the items and separators
+// it joins.
+func (v *vm) checkConcat(L *lua.LState) {
+	t := L.CheckTable(1)
+	sep := L.OptString(2, "")
+	from := L.OptInt(3, 1)
+	to := L.OptInt(4, t.Len())
+
+	size := 0
+
+	for i := from; i <= to && size <= v.limits.MaxString; i++ {
+		size += len(t.RawGetInt(i).String()) + len(sep)
+	}
+
+	if size > v.limits.MaxString {
+		L.RaiseError("table.concat result is longer than %d bytes", v.limits.MaxString)
+	}
+}
+
+// toGo converts a Lua value to a Go value for JSON. Tables with only
+// consecutive integer keys become arrays.
+func toGo(value lua.LValue, depth int) any {
+	if depth > 32 {
+		return nil
+	}
+
+	switch value := value.(type) {
+	case lua.LBool:
+		return bool(value)
+	case lua.LNumber:
+		return float64(value)
+	case lua.LString:
+		return string(value)
+	case *lua.LTable:
+		if n := value.Len(); n > 0 {
+			list := make([]any, 0, n)
+			for i := 1; i <= n; i++ {
+				list = append(list, toGo(value.RawGetInt(i), depth+1))
+			}
+
+			return list
+		}
+
+		m := map[string]any{}
+
+		value.ForEach(func(k, v lua.LValue) {
+			m[k.String()] = toGo(v, depth+1)
+		})
+
+		return m
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,341 @@
+// Package selfupdate finds new builds of the wrapper among the GitHub
+// releases of the project, and downloads and verifies them.
+package selfupdate
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRepository is where releases of the wrapper are published.
+	DefaultRepository = "jsandas/gogo-mc-bedrock-server"
+
+	// githubAPI is the GitHub REST API.
+	githubAPI = "https://api.github.com"
+
+	// maxBinarySize caps the size of a downloaded build.
+	maxBinarySize = 256 << 20
+
+	// checksumsSuffix ends the name of the checksums file of a release.
+	checksumsSuffix = "checksums.txt"
+)
+
+var (
+	// ErrNoAsset is returned when a release has no build for this platform.
+	ErrNoAsset = errors.New("release has no build for this platform")
+
+	// ErrChecksum is returned when a build doesn't match its checksum.
+	ErrChecksum = errors.New("checksum mismatch")
+
+	// ErrSignature is returned when the checksums file isn't signed by the
+	// configured key.
+	ErrSignature = errors.New("invalid signature")
+)
+
+// Config configures where new builds come from and how they are verified.
+type Config struct {
+	Repository string            // owner/name of the GitHub repository
+	Binary     string            // Name of the binary, assets are <binary>_<os>_<arch>
+	Current    string            // Version running, "dev" for builds that aren't releases
+	PublicKey  ed25519.PublicKey // Verifies <checksums>.sig when set
+	APIURL     string            // Optional URL to query instead of the GitHub API (used for testing)
+}
+
+// Release is a published release and its build for this platform.
+type Release struct {
+	Version   string    `json:"version"`
+	URL       string    `json:"url"`
+	Published time.Time `json:"published_at"`
+	Newer     bool      `json:"newer"` // Whether it is newer than the running version
+
+	asset     string // Download URLs
+	checksums string
+	signature string
+}
+
+// Check returns the latest release of the repository.
+func (c Config) Check(ctx context.Context) (Release, error) {
+	api := c.APIURL
+	if api == "" {
+		api = githubAPI
+	}
+
+	resp, err := get(ctx, fmt.Sprintf("%s/repos/%s/releases/latest", api, c.Repository))
+	if err != nil {
+		return Release{}, err
+	}
+	defer resp.Body.Close()
+
+	var latest struct {
+		TagName     string    `json:"tag_name"`
+		HTMLURL     string    `json:"html_url"`
+		PublishedAt time.Time `json:"published_at"`
+		Assets      []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&latest)
+	if err != nil {
+		return Release{}, fmt.Errorf("error parsing release: %w", err)
+	}
+
+	rel := Release{
+		Version:   strings.TrimPrefix(latest.TagName, "v"),
+		URL:       latest.HTMLURL,
+		Published: latest.PublishedAt,
+	}
+
+	rel.Newer = compareVersions(rel.Version, strings.TrimPrefix(c.Current, "v")) > 0
+
+	assetName := c.assetName()
+
+	for _, asset := range latest.Assets {
+		switch {
+		case asset.Name == assetName:
+			rel.asset = asset.URL
+		case strings.HasSuffix(asset.Name, checksumsSuffix):
+			rel.checksums = asset.URL
+		case strings.HasSuffix(asset.Name, checksumsSuffix+".sig"):
+			rel.signature = asset.URL
+		}
+	}
+
+	return rel, nil
+}
+
+// assetName returns the name of the build for this platform.
+func (c Config) assetName() string {
+	return fmt.Sprintf("%s_%s_%s", c.Binary, runtime.GOOS, runtime.GOARCH)
+}
+
+// Download downloads the build of a release next to dest and replaces dest
+// with it once it matches its checksum, and the checksums their signature
+// when a public key is configured.
+func (c Config) Download(ctx context.Context, rel Release, dest string) error {
+	if rel.asset == "" {
+		return fmt.Errorf("%w: %s", ErrNoAsset, c.assetName())
+	}
+
+	if rel.checksums == "" {
+		return fmt.Errorf("%w: release has no checksums file", ErrChecksum)
+	}
+
+	checksums, err := download(ctx, rel.checksums, 1<<20)
+	if err != nil {
+		return err
+	}
+
+	if c.PublicKey != nil {
+		if rel.signature == "" {
+			return fmt.Errorf("%w: release has no signature of its checksums", ErrSignature)
+		}
+
+		sig, err := download(ctx, rel.signature, 1<<10)
+		if err != nil {
+			return err
+		}
+
+		err = verifySignature(c.PublicKey, checksums, sig)
+		if err != nil {
+			return err
+		}
+	}
+
+	want, ok := findChecksum(string(checksums), c.assetName())
+	if !ok {
+		return fmt.Errorf("%w: no checksum for %s", ErrChecksum, c.assetName())
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(dest), ".update-*")
+	if err != nil {
+		return fmt.Errorf("error creating temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name()) // Clean up temp file if the rename didn't happen
+
+	resp, err := get(ctx, rel.asset)
+	if err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	defer resp.Body.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(tmpFile, hash), io.LimitReader(resp.Body, maxBinarySize))
+	if err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("error downloading build: %w", err)
+	}
+
+	err = tmpFile.Close()
+	if err != nil {
+		return fmt.Errorf("error closing temp file: %w", err)
+	}
+
+	got := hex.EncodeToString(hash.Sum(nil))
+	if got != want {
+		return fmt.Errorf("%w: %s is %s, expected %s", ErrChecksum, c.assetName(), got, want)
+	}
+
+	err = os.Chmod(tmpFile.Name(), 0755) // #nosec G302 -- the build is executed
+	if err != nil {
+		return fmt.Errorf("error making build executable: %w", err)
+	}
+
+	err = os.Rename(tmpFile.Name(), dest)
+	if err != nil {
+		return fmt.Errorf("error replacing %s: %w", dest, err)
+	}
+
+	return nil
+}
+
+// verifySignature checks an ed25519 signature of the checksums, either raw
+// or base64 encoded.
+func verifySignature(key ed25519.PublicKey, checksums, sig []byte) error {
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrSignature, err)
+		}
+
+		sig = decoded
+	}
+
+	if !ed25519.Verify(key, checksums, sig) {
+		return ErrSignature
+	}
+
+	return nil
+}
+
+// ParsePublicKey parses a base64 encoded ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding public key: %w", err)
+	}
+
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key is %d bytes, expected %d", len(key), ed25519.PublicKeySize)
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+// findChecksum returns the SHA-256 of a file from a checksums file in the
+// format of sha256sum.
+func findChecksum(checksums, name string) (string, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(checksums))
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), true
+		}
+	}
+
+	return "", false
+}
+
+// compareVersions compares versions such as 1.4.0, ignoring pre-release
+// suffixes, returning -1, 0 or 1. A version that isn't a release, like
+// "dev", is older than any release.
+func compareVersions(a, b string) int {
+	parse := func(v string) []int {
+		v, _, _ = strings.Cut(v, "-")
+
+		var parts []int
+
+		for _, s := range strings.Split(v, ".") {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil
+			}
+
+			parts = append(parts, n)
+		}
+
+		return parts
+	}
+
+	as, bs := parse(a), parse(b)
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+
+		if i < len(as) {
+			x = as[i]
+		}
+
+		if i < len(bs) {
+			y = bs[i]
+		}
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// download returns the body at url, up to limit bytes.
+func download(ctx context.Context, url string, limit int64) ([]byte, error) {
+	resp, err := get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", url, err)
+	}
+
+	return data, nil
+}
+
+// get requests url, failing unless the response is 200 OK.
+func get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "gogo-mc-bedrock-server")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting %s: %w", url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error requesting %s, status code: %d", url, resp.StatusCode)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,233 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// releaseServer serves a latest release with a build for this platform and
+// its checksums, signed with key when given.
+func releaseServer(t *testing.T, build []byte, checksum string, key ed25519.PrivateKey) *httptest.Server {
+	t.Helper()
+
+	asset := fmt.Sprintf("minecraft-server-wrapper_%s_%s", runtime.GOOS, runtime.GOARCH)
+	checksums := fmt.Sprintf("%s  minecraft-server-center_linux_amd64\n%s  %s\n", checksum, checksum, asset)
+
+	var ts *httptest.Server
+
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/jsandas/gogo-mc-bedrock-server/releases/latest":
+			fmt.Fprintf(w, `{"tag_name":"v1.5.0","html_url":"https://example.com/v1.5.0","assets":[
+				{"name":"%s","browser_download_url":"%s/build"},
+				{"name":"gogo-mc-bedrock-server_1.5.0_checksums.txt","browser_download_url":"%s/checksums"},
+				{"name":"gogo-mc-bedrock-server_1.5.0_checksums.txt.sig","browser_download_url":"%s/sig"}
+			]}`, asset, ts.URL, ts.URL, ts.URL)
+		case "/build":
+			_, _ = w.Write(build)
+		case "/checksums":
+			_, _ = w.Write([]byte(checksums))
+		case "/sig":
+			if key == nil {
+				http.NotFound(w, r)
+				return
+			}
+
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(checksums)))))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return ts
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCheck(t *testing.T) {
+	ts := releaseServer(t, nil, "", nil)
+	defer ts.Close()
+
+	tests := []struct {
+		current string
+		newer   bool
+	}{
+		{"1.4.2", true},
+		{"v1.4.2", true},
+		{"1.5.0", false},
+		{"1.10.0", false},
+		{"dev", true},
+	}
+
+	for _, tt := range tests {
+		c := Config{Repository: DefaultRepository, Binary: "minecraft-server-wrapper", Current: tt.current, APIURL: ts.URL}
+
+		rel, err := c.Check(context.Background())
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+
+		if rel.Version != "1.5.0" {
+			t.Errorf("Expected version 1.5.0, got %s", rel.Version)
+		}
+
+		if rel.Newer != tt.newer {
+			t.Errorf("Current %s: expected newer %v, got %v", tt.current, tt.newer, rel.Newer)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	build := []byte("#!/bin/sh\necho new\n")
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := releaseServer(t, build, sha256Hex(build), priv)
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "minecraft-server-wrapper")
+
+	err = os.WriteFile(dest, []byte("old"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := Config{
+		Repository: DefaultRepository,
+		Binary:     "minecraft-server-wrapper",
+		Current:    "1.4.0",
+		PublicKey:  pub,
+		APIURL:     ts.URL,
+	}
+
+	rel, err := c.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	err = c.Download(context.Background(), rel, dest)
+	if err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != string(build) {
+		t.Errorf("Expected the new build, got %q", data)
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Expected the build to be executable, mode %v", info.Mode())
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	ts := releaseServer(t, []byte("tampered"), sha256Hex([]byte("original")), nil)
+	defer ts.Close()
+
+	dest := filepath.Join(t.TempDir(), "minecraft-server-wrapper")
+
+	err := os.WriteFile(dest, []byte("old"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := Config{Repository: DefaultRepository, Binary: "minecraft-server-wrapper", Current: "1.4.0", APIURL: ts.URL}
+
+	rel, err := c.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	err = c.Download(context.Background(), rel, dest)
+	if !errors.Is(err, ErrChecksum) {
+		t.Fatalf("Expected ErrChecksum, got %v", err)
+	}
+
+	data, _ := os.ReadFile(dest)
+	if string(data) != "old" {
+		t.Errorf("Expected the old build to be kept, got %q", data)
+	}
+}
+
+func TestDownloadBadSignature(t *testing.T) {
+	build := []byte("build")
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := releaseServer(t, build, sha256Hex(build), priv)
+	defer ts.Close()
+
+	c := Config{
+		Repository: DefaultRepository,
+		Binary:     "minecraft-server-wrapper",
+		Current:    "1.4.0",
+		PublicKey:  other,
+		APIURL:     ts.URL,
+	}
+
+	rel, err := c.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	err = c.Download(context.Background(), rel, filepath.Join(t.TempDir(), "minecraft-server-wrapper"))
+	if !errors.Is(err, ErrSignature) {
+		t.Fatalf("Expected ErrSignature, got %v", err)
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParsePublicKey(base64.StdEncoding.EncodeToString(pub))
+	if err != nil {
+		t.Fatalf("ParsePublicKey failed: %v", err)
+	}
+
+	if !key.Equal(pub) {
+		t.Error("Expected the parsed key to equal the original")
+	}
+
+	_, err = ParsePublicKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	if err == nil {
+		t.Error("Expected an error for a short key")
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/buildinfo"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+// About is the build of the wrapper, and the central server managing it.
+type About struct {
+	buildinfo.Info
+	Central *protocol.Hello `json:"central,omitempty"` // nil until a central server sent its hello
+}
+
+// CentralAbout is the build of the central server, and of the wrappers
+// the user can view.
+type CentralAbout struct {
+	buildinfo.Info
+	Wrappers []WrapperAbout `json:"wrappers"`
+}
+
+// WrapperAbout is the build a wrapper announced in its hello.
+type WrapperAbout struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Software  string `json:"software"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	Protocol  int    `json:"protocol"`
+}
+
+// handleAbout reports the version, commit and build date of the wrapper,
+// for support questions.
+func (s *Server) handleAbout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(About{Info: s.build, Central: s.central.Load()})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleAbout reports the build of the central server and of each wrapper
+// the user can view.
+func (s *CentralServer) handleAbout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conns, err := s.visibleConnections(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	about := CentralAbout{Info: s.manager.build, Wrappers: make([]WrapperAbout, 0, len(conns))}
+
+	for _, wConn := range conns {
+		hello := wConn.Hello()
+
+		about.Wrappers = append(about.Wrappers, WrapperAbout{
+			ID:        wConn.ID,
+			Name:      wConn.Name,
+			Software:  hello.Software,
+			Version:   hello.Version,
+			Commit:    hello.Commit,
+			BuildDate: hello.BuildDate,
+			Protocol:  hello.Protocol,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(about)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/announce"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+)
+
+const (
+	// announcementsName is the announcements file in the app directory.
+	announcementsName = "announcements.json"
+
+	// announceInterval is how often announcements are checked.
+	announceInterval = 15 * time.Second
+)
+
+// openAnnouncements loads the announcements.
+func (s *Server) openAnnouncements() {
+	store, err := announce.Open(filepath.Join(s.appDir, announcementsName))
+	if err != nil {
+		fmt.Printf("Error opening announcements: %v\n", err)
+		return
+	}
+
+	s.announcements = store
+}
+
+// RunAnnouncements sends announcements when they are due in the wrapper's
+// timezone, until the server exits.
+func (s *Server) RunAnnouncements() {
+	if s.announcements == nil {
+		return
+	}
+
+	ticker := time.NewTicker(announceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.runner.Done():
+			return
+		case now := <-ticker.C:
+			for _, command := range s.announcements.Due(now.In(s.location)) {
+				s.runner.WriteInput(command)
+			}
+		}
+	}
+}
+
+// handleAnnouncements lists announcements (GET), adds or updates one
+// (POST, without an ID to add) and deletes one (DELETE ?id=). Changes are
+// recorded in the audit log.
+func (s *Server) handleAnnouncements(w http.ResponseWriter, r *http.Request) {
+	if s.announcements == nil {
+		http.Error(w, "Announcements are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var result any
+
+	switch r.Method {
+	case http.MethodGet:
+		result = s.announcements.List()
+	case http.MethodPost:
+		var a announce.Announcement
+
+		err := json.NewDecoder(r.Body).Decode(&a)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		a, err = s.announcements.Put(a)
+		if err != nil {
+			announcementError(w, err)
+			return
+		}
+
+		s.auditAnnouncement(r, "announcement.update", a.Name)
+
+		result = a
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+
+		err := s.announcements.Delete(id)
+		if err != nil {
+			announcementError(w, err)
+			return
+		}
+
+		s.auditAnnouncement(r, "announcement.delete", id)
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// announcementError reports an announcement API error with a matching
+// status.
+func announcementError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, announce.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, announce.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// auditAnnouncement records a change to the announcements.
+func (s *Server) auditAnnouncement(r *http.Request, action, target string) {
+	err := s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: action,
+		Target: target,
+	})
+	if err != nil {
+		fmt.Printf("Error recording announcement change: %v\n", err)
+	}
+}
@@ -11,11 +11,14 @@ var (
 	ErrInvalidAuthKey = errors.New("invalid authentication key")
 )
 
-// authMiddleware checks for the presence and validity of the pre-shared key.
+// authMiddleware checks for the presence and validity of the pre-shared key,
+// or the central server's key, which marks the request as the central
+// server's. Requests over a Unix socket need none, its permissions are the
+// boundary.
 func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Skip auth check for the index page
-		if r.URL.Path == "/" {
+		// Skip auth check for the index page and local clients
+		if r.URL.Path == "/" || isLocal(r) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -32,11 +35,16 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		// Use constant-time comparison to prevent timing attacks
-		if subtle.ConstantTimeCompare([]byte(authKey), []byte(s.authKey)) != 1 {
-			http.Error(w, ErrInvalidAuthKey.Error(), http.StatusUnauthorized)
+		if subtle.ConstantTimeCompare([]byte(authKey), []byte(s.authKey)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if s.centralKey != "" && subtle.ConstantTimeCompare([]byte(authKey), []byte(s.centralKey)) == 1 {
+			next.ServeHTTP(w, withCentral(r))
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		http.Error(w, ErrInvalidAuthKey.Error(), http.StatusUnauthorized)
 	}
 }
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/autoscale"
+)
+
+// provisionTimeout bounds starting an instance, which may take a while
+// with a provisioning command such as terraform apply.
+const provisionTimeout = 15 * time.Minute
+
+// Autoscale samples the players of all wrappers every interval and starts
+// instances for the autoscale policies that are due, until the manager is
+// shut down.
+func (m *ConnectionManager) Autoscale(interval time.Duration) {
+	if m.autoscale == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			conns := m.ListConnections()
+
+			var servers []autoscale.Server
+
+			for i, ping := range pingServers(conns) {
+				if !ping.online {
+					continue
+				}
+
+				servers = append(servers, autoscale.Server{
+					ID:         conns[i].ID,
+					Name:       conns[i].Name,
+					Labels:     conns[i].Labels(),
+					Players:    ping.pong.PlayerCount,
+					MaxPlayers: ping.pong.MaxPlayerCount,
+				})
+			}
+
+			for _, t := range m.autoscale.Observe(now, servers) {
+				go m.launch(t)
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// launch starts an instance for an autoscale trigger, records it and
+// announces its address on the console of the full server and on Discord.
+func (m *ConnectionManager) launch(t autoscale.Trigger) {
+	ctx, cancel := context.WithTimeout(context.Background(), provisionTimeout)
+	defer cancel()
+
+	fmt.Printf("Autoscale policy %s: %s full since %s, starting an instance\n", t.Policy.Name, t.Server.ID,
+		t.Since.Format(time.RFC3339))
+
+	var launched *autoscale.Instance
+
+	instance, err := t.Policy.Provisioner.Provision(ctx, autoscale.Request{
+		Policy:   t.Policy.Name,
+		Template: t.Policy.Template,
+		Server:   t.Server,
+	})
+	if err == nil {
+		launched = &instance
+	}
+
+	saveErr := m.autoscale.Launched(t, time.Now().UTC(), launched, err)
+	if saveErr != nil {
+		fmt.Printf("Error recording autoscale launch: %v\n", saveErr)
+	}
+
+	var text string
+
+	if err != nil {
+		fmt.Printf("Error starting an instance for autoscale policy %s: %v\n", t.Policy.Name, err)
+		text = fmt.Sprintf("Autoscale: %s is full but starting another server failed: %v", t.Server.Name, err)
+	} else {
+		fmt.Printf("Autoscale policy %s started %s\n", t.Policy.Name, instance.Address)
+		text = fmt.Sprintf("Autoscale: %s is full, another server is starting at %s", t.Server.Name, instance.Address)
+	}
+
+	if wConn, ok := m.GetConnection(t.Server.ID); ok {
+		wConn.broadcast([]byte("[central] " + text))
+	}
+
+	if t.Policy.Discord == "" || err != nil {
+		return
+	}
+
+	err = autoscale.PostDiscord(ctx, webhookClient, t.Policy.Discord, text)
+	if err != nil {
+		fmt.Printf("Error announcing autoscale launch: %v\n", err)
+	}
+}
+
+// handleAutoscale returns the autoscale policies, the servers they have
+// seen full and the instances they started.
+func (s *CentralServer) handleAutoscale(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(s.manager.autoscale.Status())
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
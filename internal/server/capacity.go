@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/capacity"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/events"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/raknet"
+)
+
+const (
+	// capacityName is the soft player limit policy in the app directory.
+	capacityName = "capacity.json"
+
+	// capacityInterval is how often the players online are checked with a
+	// ping, counting players who joined before the wrapper started.
+	capacityInterval = time.Minute
+)
+
+// openCapacity loads the soft player limit policy.
+func (s *Server) openCapacity() {
+	monitor, err := capacity.Open(filepath.Join(s.appDir, capacityName))
+	if err != nil {
+		fmt.Printf("Error opening capacity policy: %v\n", err)
+		return
+	}
+
+	s.capacity = monitor
+}
+
+// enforceCapacity counts players joining and leaving, warning or kicking
+// players who join over the soft limit.
+func (s *Server) enforceCapacity(line string) {
+	if s.capacity == nil {
+		return
+	}
+
+	if strings.Contains(line, startedLine) {
+		s.capacity.Reset()
+		return
+	}
+
+	e, ok := events.Parse(line)
+	if !ok {
+		return
+	}
+
+	if e.Type == events.TypeLeave {
+		s.capacity.Leave(e.Player)
+		return
+	}
+
+	allowlisted, err := capacity.Allowlisted(filepath.Join(s.appDir, "allowlist.json"), e.Player, e.XUID)
+	if err != nil {
+		fmt.Printf("Error checking the allowlist for %s: %v\n", e.Player, err)
+	}
+
+	d, err := s.capacity.Join(e.Player, e.XUID, allowlisted)
+	if err != nil {
+		fmt.Printf("Error applying capacity policy: %v\n", err)
+	}
+
+	s.applyCapacity(d)
+}
+
+// applyCapacity runs the commands of a capacity decision and alerts.
+func (s *Server) applyCapacity(d capacity.Decision) {
+	for _, command := range d.Commands {
+		s.runner.WriteInput(command)
+	}
+
+	if d.Alert != "" {
+		s.alert("[wrapper] " + d.Alert)
+	}
+}
+
+// RunCapacity pings bedrock_server at address for the players online,
+// alerting when they are over the soft limit, until the server exits.
+func (s *Server) RunCapacity(address string) {
+	if s.capacity == nil || address == "" {
+		return
+	}
+
+	ticker := time.NewTicker(capacityInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.runner.Done():
+			return
+		case <-ticker.C:
+			result := raknet.Ping(context.Background(), address, raknet.PingOptions{Timeout: pingTimeout})
+			if result.Err != nil {
+				continue
+			}
+
+			s.applyCapacity(s.capacity.Observe(result.Pong.PlayerCount))
+		}
+	}
+}
+
+// handleCapacity returns the soft player limit policy with the players
+// online (GET) or replaces the policy (PUT). Changes are recorded in the
+// audit log.
+func (s *Server) handleCapacity(w http.ResponseWriter, r *http.Request) {
+	if s.capacity == nil {
+		http.Error(w, "Capacity policy is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var policy capacity.Policy
+
+		err := json.NewDecoder(r.Body).Decode(&policy)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		old, _ := json.MarshalIndent(s.capacity.Status().Policy, "", "  ")
+
+		policy, err = s.capacity.SetPolicy(policy)
+		if err != nil {
+			capacityError(w, err)
+			return
+		}
+
+		data, _ := json.MarshalIndent(policy, "", "  ")
+
+		err = s.audit.Record(audit.Entry{
+			Actor:  actor(r),
+			Action: "capacity.update",
+			Target: capacityName,
+			Diff:   audit.Diff(capacityName, old, data),
+		})
+		if err != nil {
+			fmt.Printf("Error recording capacity change: %v\n", err)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(s.capacity.Status())
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// capacityError reports a capacity API error with a matching status.
+func capacityError(w http.ResponseWriter, err error) {
+	if errors.Is(err, capacity.ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -5,62 +5,350 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"runtime"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/activity"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/allowlist"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/cloud"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/macros"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/preferences"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/retention"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/timeline"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/tokens"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/transfer"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/twofactor"
 )
 
 // CentralServerConfig holds configuration for the central server.
 type CentralServerConfig struct {
-	Manager *ConnectionManager
-	AuthKey string
+	Manager  *ConnectionManager
+	AuthKey  string
+	Activity *activity.Store // Player activity reports, nil if disabled
+	Users    []User          // Users with their own keys besides the master key
+	Tokens   *tokens.Store   // API tokens for automation, nil if disabled
+	Macros   *macros.Store   // Command macros, nil if disabled
+
+	// Allowlists are shared lists of players synced to the wrappers, nil if
+	// disabled
+	Allowlists *allowlist.Store
+
+	// Preferences holds the web console settings of each user, nil if
+	// disabled
+	Preferences *preferences.Store
+
+	// TwoFactor holds TOTP enrollments. When set, users who can send commands
+	// or change configuration only get view access until they verify a code.
+	TwoFactor *twofactor.Store
+
+	StatusPage *StatusPageConfig // Public status page, nil if disabled
+	Headers    SecurityHeadersConfig
+	HTTP       HTTPConfig // Timeouts and TLS of the web server
+
+	// LatestVersion is the Bedrock version servers are compared with. It's
+	// looked up from the download site when empty.
+	LatestVersion string
+
+	JobWorkers int    // Targets of fleet jobs worked on at once, 4 if zero
+	BackupDir  string // Where backup jobs save snapshots, empty disables them
+
+	// BackupIndex records where each snapshot in BackupDir came from
+	BackupIndex *transfer.Index
+
+	// BackupPolicies say how often each wrapper is backed up and how long
+	// its backups are kept, nil if disabled
+	BackupPolicies *retention.Store
+
+	// ConfigPath and DataDir are where the central server keeps its state,
+	// exported and imported as a single archive. Empty disables it.
+	ConfigPath string
+	DataDir    string
+
+	// IdleTimeout disconnects browser consoles whose user didn't interact
+	// with the page this long, zero never does
+	IdleTimeout time.Duration
+
+	ClientLimits ClientLimits // Consoles of each wrapper at once
+
+	// Restart shuts the central server down so its supervisor starts it
+	// again, applying an imported state. Nil if imports wait for a restart.
+	Restart func()
+
+	// Discovery lets admins browse the LAN for wrappers advertised over mDNS
+	// and add them with their shared key. SaveWrapper saves those to the
+	// config file; if nil they're only kept until the next restart.
+	Discovery   bool
+	SaveWrapper func(NewWrapper) error
 }
 
 // CentralServer represents the central management server.
 type CentralServer struct {
-	manager    *ConnectionManager
-	server     *http.Server
-	upgrader   websocket.Upgrader
-	clients    map[*websocket.Conn]bool
-	clientsMux sync.RWMutex
-	authKey    string
+	manager     *ConnectionManager
+	server      *http.Server
+	upgrader    websocket.Upgrader
+	clients     map[*websocket.Conn]bool
+	clientsMux  sync.RWMutex
+	authKey     string
+	migrations  migrations
+	promotions  promotions
+	activity    *activity.Store
+	statusPage  *statusCache
+	headers     SecurityHeadersConfig
+	http        HTTPConfig
+	users       []User
+	tokens      *tokens.Store
+	macros      *macros.Store
+	allowlists  *allowlist.Store
+	preferences *preferences.Store
+	latest      *latestVersion
+	jobs        *jobs.Manager
+	jobWatch    jobWatchers
+	pool        *workerPool // Works on the targets of fleet jobs
+	backupDir   string
+	backupIndex *transfer.Index
+	retention   *retention.Store
+	policyRuns  policyRuns
+	configPath  string
+	dataDir     string
+	restart     func()
+	idleTimeout time.Duration
+
+	discovery   *discovery // Wrappers found on the LAN, nil if disabled
+	saveWrapper func(NewWrapper) error
+
+	clientLimits   ClientLimits
+	clientLimiters map[string]*clientLimiter // By wrapper ID, guarded by clientsMux
+
+	sessions          *sessionStore
+	twoFactor         *twofactor.Store
+	twoFactorAttempts *twoFactorAttempts
 }
 
 // NewCentralServer creates a new central server instance.
 func NewCentralServer(config CentralServerConfig) *CentralServer {
-	return &CentralServer{
+	s := &CentralServer{
 		manager: config.Manager,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins for now
 			},
 		},
-		clients: make(map[*websocket.Conn]bool),
-		authKey: config.AuthKey,
+		clients:     make(map[*websocket.Conn]bool),
+		authKey:     config.AuthKey,
+		idleTimeout: config.IdleTimeout,
+		activity:    config.Activity,
+		users:       config.Users,
+		headers:     config.Headers,
+		http:        config.HTTP,
+		tokens:      config.Tokens,
+		macros:      config.Macros,
+		allowlists:  config.Allowlists,
+		preferences: config.Preferences,
+		latest:      &latestVersion{pinned: config.LatestVersion},
+		pool:        newWorkerPool(config.JobWorkers),
+
+		clientLimits:   config.ClientLimits,
+		clientLimiters: make(map[string]*clientLimiter),
+
+		backupDir:  config.BackupDir,
+		configPath: config.ConfigPath,
+		dataDir:    config.DataDir,
+		restart:    config.Restart,
+
+		saveWrapper: config.SaveWrapper,
+		backupIndex: config.BackupIndex,
+		retention:   config.BackupPolicies,
+
+		sessions:          newSessionStore(),
+		twoFactor:         config.TwoFactor,
+		twoFactorAttempts: newTwoFactorAttempts(),
 	}
+
+	s.jobs = jobs.NewManager(s.jobWatch.publish)
+
+	if config.Discovery {
+		s.discovery = &discovery{}
+	}
+
+	for i := range s.users {
+		s.users[i].account = true
+	}
+
+	if config.StatusPage != nil {
+		s.statusPage = &statusCache{config: *config.StatusPage}
+	}
+
+	return s
 }
 
-// Start starts the HTTP server.
-func (s *CentralServer) Start(addr string) error {
+// Start starts the HTTP server on all listen addresses.
+func (s *CentralServer) Start(addrs []string) error {
 	mux := http.NewServeMux()
 
 	// Public routes
 	mux.Handle("/", http.FileServer(http.Dir("web")))
+	mux.HandleFunc("/api/i18n", s.handleI18n)
+
+	// Relay links of wrappers, which authenticate with their shared key
+	mux.HandleFunc("/api/relay", s.handleRelay)
+	mux.HandleFunc("/api/relay/accept", s.handleRelayAccept)
+
+	if s.statusPage != nil {
+		mux.HandleFunc("/status", s.handleStatusPage)
+		mux.HandleFunc("/status.json", s.handleStatusJSON)
+		mux.HandleFunc("/status/badge.svg", s.handleStatusBadge)
+		mux.HandleFunc("/status/badge.json", s.handleStatusBadge)
+	}
 
 	// Protected routes
 	mux.HandleFunc("/api/wrappers", s.authMiddleware(s.handleWrappers))
-	mux.HandleFunc("/api/retry", s.authMiddleware(s.handleRetry))
-	mux.HandleFunc("/api/serverstatus", s.authMiddleware(s.handleServerStatus))
-	mux.HandleFunc("/ws", s.authMiddleware(s.handleWebSocket))
+	mux.HandleFunc("/api/users", s.authMiddleware(s.requireAdmin(s.handleUsers)))
+	mux.HandleFunc("/api/pairing", s.authMiddleware(s.requireAdmin(s.handlePairing)))
+	mux.HandleFunc("/api/overview", s.authMiddleware(s.handleOverview))
+	mux.HandleFunc("/api/versions", s.authMiddleware(s.handleVersions))
+	mux.HandleFunc("/api/about", s.authMiddleware(s.handleAbout))
+	mux.HandleFunc("/api/jobs", s.authMiddleware(s.handleJobs))
+	mux.HandleFunc("/api/jobs/ws", s.authMiddleware(s.handleJobsWebSocket))
+	mux.HandleFunc("/api/host", s.authMiddleware(s.requireWrapper(AccessView, s.handleHost)))
+	mux.HandleFunc("/api/retry", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleRetry)))
+	mux.HandleFunc("/api/serverstatus", s.authMiddleware(s.requireWrapper(AccessView, s.handleServerStatus)))
+	mux.HandleFunc("/api/debug", s.authMiddleware(s.requireAdmin(s.handleDebug)))
+	mux.HandleFunc("/api/migrations", s.authMiddleware(s.requireScope(tokens.ScopeManageBackups, s.handleMigrations)))
+	mux.HandleFunc("/api/backups", s.authMiddleware(s.requireScope(tokens.ScopeManageBackups, s.handleBackups)))
+	mux.HandleFunc("/api/backups/download",
+		s.authMiddleware(s.requireScope(tokens.ScopeManageBackups, s.handleBackupDownload)))
+	mux.HandleFunc("/api/backups/verify",
+		s.authMiddleware(s.requireScope(tokens.ScopeManageBackups, s.handleBackupVerify)))
+	mux.HandleFunc("/api/backups/restore",
+		s.authMiddleware(s.requireScope(tokens.ScopeManageBackups, s.handleBackupRestore)))
+
+	if s.retention != nil && s.backupIndex != nil {
+		mux.HandleFunc("/api/backups/policies", s.authMiddleware(s.requireAdmin(s.handleBackupPolicies)))
+		mux.HandleFunc("/api/backups/compliance",
+			s.authMiddleware(s.requireScope(tokens.ScopeManageBackups, s.handleBackupCompliance)))
+	}
+
+	mux.HandleFunc("/api/clones", s.authMiddleware(s.requireScope(tokens.ScopeManageBackups, s.handleClones)))
+	mux.HandleFunc("/api/promotions", s.authMiddleware(s.requireAdmin(s.handlePromotions)))
+	mux.HandleFunc("/api/files", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/audit", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/config/history", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/config/revision", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/config/rollback", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/announcements", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/schedules", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/capacity", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/notices", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/server/restart", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/server/status", s.authMiddleware(s.requireWrapper(AccessView, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/messages", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/functions", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/functions/validate", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/functions/run", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/rules", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/rules/hold", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/messages/compose", s.authMiddleware(handleMessageCompose))
+	mux.HandleFunc("/api/motd", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/motd/preview", s.authMiddleware(handleMOTDPreview))
+	mux.HandleFunc("/api/pregen", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/rollback", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/trash", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/trash/undo", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/worlds", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/packs", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/scripts", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/scripts/eval", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/plugins", s.authMiddleware(s.requireWrapper(AccessView, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/plugins/", s.authMiddleware(s.requireWrapper(AccessOperate, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/version", s.authMiddleware(s.requireWrapper(AccessView, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/update", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/update/restart", s.authMiddleware(s.requireAdmin(s.handleWrapperAPI)))
+	mux.HandleFunc("/api/lock", s.authMiddleware(s.requireWrapper(AccessView, s.handleWrapperAPI)))
+	mux.HandleFunc("/api/readonly", s.authMiddleware(s.handleReadOnly))
+	mux.HandleFunc("/metrics", s.authMiddleware(s.requireScope(tokens.ScopeReadStatus, s.handleMetrics)))
+	mux.HandleFunc("/api/grafana/dashboard",
+		s.authMiddleware(s.requireScope(tokens.ScopeReadStatus, s.handleGrafanaDashboard)))
+	mux.HandleFunc("/api/sessions", s.authMiddleware(s.handleSessions))
+	mux.HandleFunc("/api/csrf", s.authMiddleware(s.handleCSRF))
+	mux.HandleFunc("/ws", s.authMiddleware(s.requireWrapper(AccessView, s.handleWebSocket)))
+
+	if s.tokens != nil {
+		mux.HandleFunc("/api/tokens", s.authMiddleware(s.requireAdmin(s.handleTokens)))
+	}
+
+	if s.preferences != nil {
+		mux.HandleFunc("/api/preferences", s.authMiddleware(s.handlePreferences))
+	}
+
+	if s.manager.notifications != nil {
+		mux.HandleFunc("/api/notifications", s.authMiddleware(s.requireAdmin(s.handleNotifications)))
+	}
+
+	if s.macros != nil {
+		mux.HandleFunc("/api/macros", s.authMiddleware(s.handleMacros))
+		mux.HandleFunc("/api/macros/run", s.authMiddleware(s.handleMacroRun))
+	}
+
+	if s.manager.operators != nil {
+		mux.HandleFunc("/api/operators", s.authMiddleware(s.requireAdmin(s.handleOperators)))
+		mux.HandleFunc("/api/operators/drift", s.authMiddleware(s.requireAdmin(s.handleOperatorDrift)))
+	}
+
+	if s.allowlists != nil {
+		mux.HandleFunc("/api/allowlists", s.authMiddleware(s.handleAllowlists))
+		mux.HandleFunc("/api/allowlists/sync", s.authMiddleware(s.handleAllowlistSync))
+	}
 
-	s.server = &http.Server{
-		Addr:              addr,
-		Handler:           mux,
-		ReadHeaderTimeout: 3 * time.Second,
+	if s.twoFactor != nil {
+		mux.HandleFunc("/api/2fa", s.authMiddleware(s.handleTwoFactor))
+		mux.HandleFunc("/api/2fa/", s.authMiddleware(s.handleTwoFactor))
 	}
 
-	return s.server.ListenAndServe()
+	if s.activity != nil {
+		mux.HandleFunc("/api/activity/players", s.authMiddleware(s.requireAdmin(s.handleActivityPlayers)))
+		mux.HandleFunc("/api/activity/top", s.authMiddleware(s.requireWrapper(AccessView, s.handleActivityTop)))
+		mux.HandleFunc("/api/activity/origins", s.authMiddleware(s.requireAdmin(s.handleActivityOrigins)))
+		mux.HandleFunc("/api/activity/export", s.authMiddleware(s.requireAdmin(s.handleActivityExport)))
+	}
+
+	if s.manager.denyList != nil {
+		mux.HandleFunc("/api/denylist", s.authMiddleware(s.requireAdmin(s.handleDenyList)))
+	}
+
+	if s.manager.timeline != nil {
+		mux.HandleFunc("/api/timeline", s.authMiddleware(s.handleTimeline))
+	}
+
+	if s.manager.uptime != nil {
+		mux.HandleFunc("/api/uptime", s.authMiddleware(s.requireAdmin(s.handleUptime)))
+		mux.HandleFunc("/api/uptime/export", s.authMiddleware(s.requireAdmin(s.handleUptimeExport)))
+	}
+
+	if s.configPath != "" {
+		mux.HandleFunc("/api/state/export", s.authMiddleware(s.requireAdmin(s.handleStateExport)))
+		mux.HandleFunc("/api/state/import", s.authMiddleware(s.requireAdmin(s.handleStateImport)))
+	}
+
+	if s.manager.usage != nil {
+		mux.HandleFunc("/api/usage", s.authMiddleware(s.requireAdmin(s.handleUsage)))
+	}
+
+	if s.manager.autoscale != nil {
+		mux.HandleFunc("/api/autoscale", s.authMiddleware(s.requireAdmin(s.handleAutoscale)))
+	}
+
+	if s.discovery != nil {
+		mux.HandleFunc("/api/discovery", s.authMiddleware(s.requireAdmin(s.handleDiscovery)))
+	}
+
+	s.server = s.http.newServer(securityHeaders(s.headers, mux))
+
+	return s.http.serve(s.server, addrs)
 }
 
 // Stop gracefully shuts down the server.
@@ -68,23 +356,107 @@ func (s *CentralServer) Stop() error {
 	return s.server.Shutdown(context.Background())
 }
 
-// handleWrappers handles requests for wrapper information.
+// WrapperListing is a wrapper as listed to a user.
+type WrapperListing struct {
+	*WrapperConnection
+
+	Stats    ConnectionStats   `json:"stats"` // With rates and errors, shadowing the live counters
+	Groups   []string          `json:"groups,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Hello    protocol.Hello    `json:"hello"` // Software, protocol and capabilities of the wrapper
+	Features Features          `json:"features"`
+	Access   Access            `json:"access"`
+	Host     *cloud.Status     `json:"host,omitempty"` // State of the VM hosting the wrapper, if managed
+}
+
+// handleWrappers lists the wrappers the user can view, only those with the
+// labels given as ?labels=key=value,... if any, or returns the one with
+// ?id=.
 func (s *CentralServer) handleWrappers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	wrappers := s.manager.ListConnections()
+	conns, err := s.visibleConnections(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user := requestUser(r)
+	wrappers := []WrapperListing{}
+
+	for _, wConn := range conns {
+		wrappers = append(wrappers, WrapperListing{
+			WrapperConnection: wConn,
+			Stats:             wConn.statsSnapshot(),
+			Groups:            wConn.Groups(),
+			Labels:            wConn.Labels(),
+			Hello:             wConn.Hello(),
+			Features:          wConn.Features(),
+			Access:            user.Access(wConn),
+			Host:              wConn.hostStatus(),
+		})
+	}
 
-	err := json.NewEncoder(w).Encode(wrappers)
+	var result any = wrappers
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		i := slices.IndexFunc(wrappers, func(l WrapperListing) bool { return l.ID == id })
+		if i < 0 {
+			http.Error(w, "Wrapper not found", http.StatusNotFound)
+			return
+		}
+
+		result = wrappers[i]
+	}
+
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// handleDebug reports goroutine counts per wrapper connection and any
+// violated cleanup invariants.
+func (s *CentralServer) handleDebug(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.clientsMux.RLock()
+	clients := len(s.clients)
+	s.clientsMux.RUnlock()
+
+	reports := s.manager.Reports()
+	for _, report := range reports {
+		for _, v := range report.Violations {
+			fmt.Printf("Warning: wrapper %s (%s): %s\n", report.Name, report.ID, v)
+		}
+	}
+
+	debug := struct {
+		Goroutines int             `json:"goroutines"`
+		Clients    int             `json:"clients"`
+		Wrappers   []RoutineReport `json:"wrappers"`
+	}{
+		Goroutines: runtime.NumGoroutine(),
+		Clients:    clients,
+		Wrappers:   reports,
+	}
+
+	err := json.NewEncoder(w).Encode(debug)
 	if err != nil {
 		fmt.Printf("Error sending JSON response: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
-// handleServerStatus handles requests for Minecraft server status.
+// handleServerStatus handles requests for Minecraft server status, with
+// ?query=true including the players and plugins from the query protocol.
 func (s *CentralServer) handleServerStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -109,6 +481,15 @@ func (s *CentralServer) handleServerStatus(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// The query protocol lists players and plugins, but only answers when
+	// the server has it enabled
+	if r.URL.Query().Get("query") == "true" {
+		err = wConn.GetServerQuery(status)
+		if err != nil {
+			status["queryError"] = err.Error()
+		}
+	}
+
 	err = json.NewEncoder(w).Encode(status)
 	if err != nil {
 		fmt.Printf("Error sending JSON response: %v\n", err)
@@ -158,19 +539,36 @@ func (s *CentralServer) handleWebSocket(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	canOperate := requestUser(r).Access(wConn).Allows(AccessOperate)
+
+	release, ok := s.clientLimiter(wrapperId).admit(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
 	ws, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
 	}
 
+	defer wConn.routines.track(routineClient)()
+
 	// Add client to both central server and wrapper connection
 	s.clientsMux.Lock()
 	s.clients[ws] = true
 	s.clientsMux.Unlock()
 	wConn.AddClient(ws)
 
+	active := newIdleTracker(r)
+	stop := make(chan struct{})
+
+	go s.evictIdle(ws, active, stop)
+
 	// Ensure cleanup on exit
 	defer func() {
+		close(stop)
+
 		s.clientsMux.Lock()
 		delete(s.clients, ws)
 		s.clientsMux.Unlock()
@@ -193,6 +591,12 @@ func (s *CentralServer) handleWebSocket(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
+		active.touch()
+
+		if isActivity(message) {
+			continue
+		}
+
 		// Check if wrapper is still connected before forwarding
 		if wConn.Status != StatusConnected {
 			err := ws.WriteMessage(websocket.TextMessage,
@@ -204,6 +608,15 @@ func (s *CentralServer) handleWebSocket(w http.ResponseWriter, r *http.Request)
 			continue
 		}
 
+		if !canOperate {
+			err := ws.WriteMessage(websocket.TextMessage, []byte("Error: You may only view this server"))
+			if err != nil {
+				fmt.Printf("Error sending WebSocket message: %v\n", err)
+			}
+
+			continue
+		}
+
 		// Forward message to wrapper with timeout handling
 		err = wConn.SendMessage(message)
 		if err != nil {
@@ -216,5 +629,7 @@ func (s *CentralServer) handleWebSocket(w http.ResponseWriter, r *http.Request)
 
 			continue
 		}
+
+		wConn.recordEvent(timeline.Event{Type: timeline.TypeCommand, Actor: requestUser(r).Name, Text: string(message)})
 	}
 }
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const defaultTopPlayers = 10
+
+// handleActivityPlayers returns the activity report of every player, or of
+// a single player with ?name=.
+func (s *CentralServer) handleActivityPlayers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result interface{} = s.activity.Players()
+
+	name := r.URL.Query().Get("name")
+	if name != "" {
+		report, ok := s.activity.Player(name)
+		if !ok {
+			http.Error(w, "Player not found", http.StatusNotFound)
+			return
+		}
+
+		result = report
+	}
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// handleActivityTop returns the players with the most playtime on a wrapper.
+func (s *CentralServer) handleActivityTop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	wrapperId := r.URL.Query().Get("wrapper")
+	if wrapperId == "" {
+		http.Error(w, "Wrapper ID is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultTopPlayers
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		limit = n
+	}
+
+	err := json.NewEncoder(w).Encode(s.activity.Top(wrapperId, limit))
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// handleActivityOrigins returns the countries players connected from, for
+// all wrappers or a single one with ?wrapper=.
+func (s *CentralServer) handleActivityOrigins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(s.activity.Origins(r.URL.Query().Get("wrapper")))
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// handleActivityExport returns playtime per player and wrapper as CSV.
+func (s *CentralServer) handleActivityExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="player-activity.csv"`)
+
+	err := s.activity.WriteCSV(w)
+	if err != nil {
+		fmt.Printf("Error writing activity CSV: %v\n", err)
+	}
+}
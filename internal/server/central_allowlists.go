@@ -0,0 +1,305 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/allowlist"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+const (
+	// allowlistTimeout bounds reading and writing the allowlist of a single
+	// wrapper.
+	allowlistTimeout = 10 * time.Second
+
+	// maxAllowlistSize limits the allowlist.json read from a wrapper.
+	maxAllowlistSize = 4 << 20
+)
+
+// AllowlistSyncRequest is the body of an allowlist sync. The players of the
+// named lists are written to the allowlist of the listed wrappers and those
+// in the listed groups that the user can operate.
+type AllowlistSyncRequest struct {
+	Lists    []string `json:"lists"`
+	Wrappers []string `json:"wrappers,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	Keep     bool     `json:"keep_others,omitempty"` // Leave players only on a wrapper's allowlist on it
+	DryRun   bool     `json:"dry_run,omitempty"`     // Report the differences without changing anything
+}
+
+// AllowlistResult is the outcome of an allowlist sync on a wrapper.
+type AllowlistResult struct {
+	Wrapper string          `json:"wrapper"`
+	Diff    *allowlist.Diff `json:"diff,omitempty"`
+	Applied bool            `json:"applied"` // The allowlist was written and reloaded
+	Error   string          `json:"error,omitempty"`
+}
+
+// allowlistError reports an allowlist API error with a matching status.
+func allowlistError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, allowlist.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, allowlist.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleAllowlists lists the shared allowlists (GET, or one with ?name=)
+// and, for admins, adds or replaces (POST, or PUT ?name=) and deletes
+// (DELETE ?name=) them.
+func (s *CentralServer) handleAllowlists(w http.ResponseWriter, r *http.Request) {
+	u := requestUser(r)
+
+	if r.Method != http.MethodGet && !u.Admin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var result any
+
+	status := http.StatusOK
+	name := r.URL.Query().Get("name")
+
+	switch r.Method {
+	case http.MethodGet:
+		if name == "" {
+			result = s.allowlists.List()
+			break
+		}
+
+		l, err := s.allowlists.Get(name)
+		if err != nil {
+			allowlistError(w, err)
+			return
+		}
+
+		result = l
+	case http.MethodPost, http.MethodPut:
+		var l allowlist.List
+
+		err := json.NewDecoder(r.Body).Decode(&l)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			if l.Name != "" && l.Name != name {
+				http.Error(w, "Invalid request body, the name must match ?name=", http.StatusBadRequest)
+				return
+			}
+
+			l.Name = name
+		}
+
+		l, added, err := s.allowlists.Set(l)
+		if err != nil {
+			allowlistError(w, err)
+			return
+		}
+
+		if added && r.Method == http.MethodPut {
+			status = http.StatusCreated
+		}
+
+		result = l
+	case http.MethodDelete:
+		err := s.allowlists.Delete(name)
+		if err != nil {
+			allowlistError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleAllowlistSync writes the players of shared allowlists to the
+// allowlist.json of wrappers and reloads it, reporting the differences for
+// each wrapper. Wrappers the user may not operate are reported as not found
+// or forbidden and skipped.
+func (s *CentralServer) handleAllowlistSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AllowlistSyncRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Lists) == 0 {
+		http.Error(w, "No allowlists given", http.StatusBadRequest)
+		return
+	}
+
+	lists := make([]allowlist.List, 0, len(req.Lists))
+
+	for _, name := range req.Lists {
+		l, err := s.allowlists.Get(name)
+		if err != nil {
+			allowlistError(w, fmt.Errorf("%w: %s", err, name))
+			return
+		}
+
+		lists = append(lists, l)
+	}
+
+	wanted := allowlist.Merge(lists...)
+
+	targets, missing := s.targetWrappers(req.Wrappers, req.Groups)
+	if len(targets)+len(missing) == 0 {
+		http.Error(w, "No wrappers or groups given", http.StatusBadRequest)
+		return
+	}
+
+	u := requestUser(r)
+	results := []AllowlistResult{}
+
+	for _, id := range missing {
+		results = append(results, AllowlistResult{Wrapper: id, Error: "wrapper not found"})
+	}
+
+	for _, wConn := range targets {
+		result := AllowlistResult{Wrapper: wConn.ID}
+		access := u.Access(wConn)
+
+		switch {
+		case !access.Allows(AccessView):
+			// Not revealed, like unknown IDs; wrappers only matched by group
+			// are left out
+			if contains(req.Wrappers, wConn.ID) {
+				results = append(results, AllowlistResult{Wrapper: wConn.ID, Error: "wrapper not found"})
+			}
+
+			continue
+		case !access.Allows(AccessOperate):
+			result.Error = "forbidden"
+		default:
+			ctx, cancel := context.WithTimeout(withActor(r.Context(), u.Name), allowlistTimeout)
+
+			err = wConn.syncAllowlist(ctx, wanted, req.Keep, req.DryRun, &result)
+			if err != nil {
+				result.Error = err.Error()
+			}
+
+			cancel()
+
+			if result.Applied {
+				fmt.Printf("Allowlist synced by %s on wrapper %s\n", u.Name, wConn.ID)
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	err = json.NewEncoder(w).Encode(results)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// syncAllowlist compares the wrapper's allowlist.json with the wanted
+// players and, unless dryRun, writes it and has bedrock_server reload it.
+func (w *WrapperConnection) syncAllowlist(ctx context.Context, wanted []allowlist.Entry, keep, dryRun bool,
+	result *AllowlistResult) error {
+	err := w.requireCapability(protocol.CapFiles)
+	if err != nil {
+		return err
+	}
+
+	path := "/api/files?path=" + url.QueryEscape(allowlist.File)
+
+	current, err := w.readAllowlist(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	diff, entries := allowlist.Compare(current, wanted, keep)
+	result.Diff = &diff
+
+	if dryRun || diff.Empty() {
+		return nil
+	}
+
+	// Only write an allowlist that can be reloaded right away
+	if w.readOnly.Load() {
+		return ErrReadOnly
+	}
+
+	if w.Status != StatusConnected {
+		return fmt.Errorf("wrapper is not connected (status: %s)", w.Status)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding allowlist: %w", err)
+	}
+
+	resp, err := w.apiRequest(ctx, http.MethodPut, path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error writing allowlist: %w", err)
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	err = w.SendMessage([]byte("allowlist reload"))
+	if err != nil {
+		return fmt.Errorf("allowlist written, error reloading it: %w", err)
+	}
+
+	result.Applied = true
+
+	return nil
+}
+
+// readAllowlist reads the wrapper's allowlist.json. A missing one is empty.
+func (w *WrapperConnection) readAllowlist(ctx context.Context, path string) ([]allowlist.Entry, error) {
+	resp, err := w.apiRequest(ctx, http.MethodGet, path, nil)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading allowlist: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAllowlistSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading allowlist: %w", err)
+	}
+
+	return allowlist.Parse(data)
+}
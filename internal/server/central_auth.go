@@ -1,43 +1,66 @@
 package server
 
 import (
-	"crypto/subtle"
 	"net/http"
 )
 
 // authMiddleware wraps an http.HandlerFunc with authentication.
 func (s *CentralServer) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Try to get auth key from different sources
-		var authKey string
+		authKey, viaCookie := requestKey(r)
 
-		// Check Authorization Bearer token
-		authHeader := r.Header.Get("Authorization")
-		if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-			authKey = authHeader[7:]
-		}
-
-		// Check X-Auth-Key header
 		if authKey == "" {
-			authKey = r.Header.Get("X-Auth-Key")
+			s.httpError(w, r, "error.missing_key", http.StatusUnauthorized)
+			return
 		}
 
-		// Check query parameter
-		if authKey == "" {
-			authKey = r.URL.Query().Get("auth")
+		// Keys are compared in constant time to prevent timing attacks
+		user, ok := s.authenticate(authKey)
+		if !ok {
+			s.httpError(w, r, "error.invalid_key", http.StatusUnauthorized)
+			return
 		}
 
-		if authKey == "" {
-			http.Error(w, "Missing authentication key", http.StatusUnauthorized)
+		if viaCookie && (user.session == "" || !s.checkCSRF(r, user)) {
+			s.httpError(w, r, "error.invalid_csrf", http.StatusForbidden)
 			return
 		}
 
-		// Use constant-time comparison to prevent timing attacks
-		if subtle.ConstantTimeCompare([]byte(authKey), []byte(s.authKey)) != 1 {
-			http.Error(w, "Invalid authentication key", http.StatusUnauthorized)
-			return
+		switch {
+		case user.session != "":
+			s.sessions.seen(user.session, r)
+		case user.token != "":
+			s.tokens.Seen(user.token, clientIP(r), r.UserAgent())
 		}
 
-		next.ServeHTTP(w, r)
+		s.readOnlyMiddleware(next)(w, withUser(r, user))
 	}
 }
+
+// requestKey returns the auth key of a request and whether it came from the
+// session cookie, which needs a CSRF token for changes.
+func requestKey(r *http.Request) (string, bool) {
+	// Check Authorization Bearer token
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
+		return authHeader[7:], false
+	}
+
+	// Check X-Auth-Key header
+	if key := r.Header.Get("X-Auth-Key"); key != "" {
+		return key, false
+	}
+
+	// Check query parameter
+	if key := r.URL.Query().Get("auth"); key != "" {
+		return key, false
+	}
+
+	// Check the session cookie
+	cookie, err := r.Cookie(sessionCookie)
+	if err == nil {
+		return cookie.Value, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,763 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/config"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rollback"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/snapshot"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/timeline"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/transfer"
+)
+
+// transferStatePrefix names the manifest and partial file of a transfer in
+// progress in a wrapper's backup directory, so a later backup can resume it.
+const transferStatePrefix = ".transfer-"
+
+// backup saves a snapshot of a wrapper's server to the backup directory,
+// records where it came from in the backup index and returns its path.
+// Wrappers that stage snapshots have them fetched in verified chunks,
+// resuming a transfer an earlier backup left unfinished; older ones stream
+// the snapshot in one go.
+func (s *CentralServer) backup(ctx context.Context, wConn *WrapperConnection) (string, error) {
+	err := wConn.requireCapability(protocol.CapBackups)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(s.backupDir, wConn.ID)
+
+	err = os.MkdirAll(dir, 0750)
+	if err != nil {
+		return "", fmt.Errorf("error creating backup directory: %w", err)
+	}
+
+	if !wConn.Supports(protocol.CapTransfer) {
+		return s.streamBackup(ctx, wConn, dir)
+	}
+
+	m, ok := resumableTransfer(ctx, wConn, dir)
+	if !ok {
+		err = wConn.apiCall(ctx, http.MethodPost, "/api/migration/transfer?wait=true", nil, &m)
+		if err != nil {
+			return "", fmt.Errorf("error taking snapshot: %w", err)
+		}
+
+		data, err := json.Marshal(m)
+		if err != nil {
+			return "", err
+		}
+
+		err = os.WriteFile(filepath.Join(dir, transferStatePrefix+m.ID+".json"), data, 0600)
+		if err != nil {
+			return "", fmt.Errorf("error saving transfer state: %w", err)
+		}
+	}
+
+	part := filepath.Join(dir, transferStatePrefix+m.ID+".part")
+
+	fetch := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		header := http.Header{}
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+		resp, err := wConn.apiRequestWithHeader(ctx, http.MethodGet, "/api/migration/transfer/data?id="+url.QueryEscape(m.ID),
+			nil, header)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return nil, fmt.Errorf("wrapper ignored the range request (status %d)", resp.StatusCode)
+		}
+
+		return resp.Body, nil
+	}
+
+	err = transfer.Receive(ctx, m, part, fetch, transfer.DefaultAttempts, nil)
+	if errors.Is(err, transfer.ErrChecksum) {
+		// The staged snapshot itself is bad, the next backup takes a new one
+		discardTransfer(dir, m.ID)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error transferring snapshot: %w", err)
+	}
+
+	path := filepath.Join(dir, m.CreatedAt.Format("20060102-150405")+".zip")
+
+	err = os.Rename(part, path)
+	if err != nil {
+		return "", fmt.Errorf("error saving snapshot: %w", err)
+	}
+
+	discardTransfer(dir, m.ID)
+
+	err = wConn.apiCall(ctx, http.MethodDelete, "/api/migration/transfer?id="+url.QueryEscape(m.ID), nil, nil)
+	if err != nil {
+		fmt.Printf("Error removing staged snapshot on wrapper %s: %v\n", wConn.ID, err)
+	}
+
+	s.recordBackup(ctx, path, wConn, transfer.Record{
+		World:     m.World,
+		CreatedAt: m.CreatedAt,
+		Size:      m.Size,
+		SHA256:    m.SHA256,
+		Verified:  true,
+	})
+
+	return path, nil
+}
+
+// resumableTransfer returns the manifest of a transfer an earlier backup
+// left unfinished, if the wrapper still has the snapshot staged. Transfers
+// it no longer has are discarded, those it can't be asked about are kept
+// for a later backup.
+func resumableTransfer(ctx context.Context, wConn *WrapperConnection, dir string) (transfer.Manifest, bool) {
+	states, _ := filepath.Glob(filepath.Join(dir, transferStatePrefix+"*.json"))
+
+	for _, state := range states {
+		id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(state), transferStatePrefix), ".json")
+
+		var m, staged transfer.Manifest
+
+		data, err := os.ReadFile(state) // #nosec G304
+		if err == nil {
+			err = json.Unmarshal(data, &m)
+		}
+
+		if err != nil {
+			discardTransfer(dir, id)
+			continue
+		}
+
+		err = wConn.apiCall(ctx, http.MethodGet, "/api/migration/transfer?id="+url.QueryEscape(id), nil, &staged)
+
+		var apiErr *APIError
+		if err != nil && (!errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound) {
+			continue
+		}
+
+		if err == nil && staged.SHA256 == m.SHA256 {
+			return m, true
+		}
+
+		discardTransfer(dir, id)
+	}
+
+	return transfer.Manifest{}, false
+}
+
+// discardTransfer removes the manifest and partial file of a transfer.
+func discardTransfer(dir, id string) {
+	for _, ext := range []string{".json", ".part"} {
+		err := os.Remove(filepath.Join(dir, transferStatePrefix+id+ext))
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error removing transfer state: %v\n", err)
+		}
+	}
+}
+
+// streamBackup saves a snapshot streamed by a wrapper that can't stage one.
+// Only its SHA-256 as received is recorded.
+func (s *CentralServer) streamBackup(ctx context.Context, wConn *WrapperConnection, dir string) (string, error) {
+	resp, err := wConn.apiRequest(ctx, http.MethodGet, "/api/migration/export?wait=true", nil)
+	if err != nil {
+		return "", fmt.Errorf("error taking snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+
+	createdAt := time.Now().UTC()
+	path := filepath.Join(dir, createdAt.Format("20060102-150405")+".zip")
+
+	tmpFile, err := os.CreateTemp(dir, ".backup-*")
+	if err != nil {
+		return "", fmt.Errorf("error creating backup: %w", err)
+	}
+	defer os.Remove(tmpFile.Name()) // Clean up temp file if the rename didn't happen
+
+	sum := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(tmpFile, sum), resp.Body)
+	if err != nil {
+		_ = tmpFile.Close()
+		return "", fmt.Errorf("error saving snapshot: %w", err)
+	}
+
+	err = tmpFile.Close()
+	if err != nil {
+		return "", fmt.Errorf("error saving snapshot: %w", err)
+	}
+
+	err = os.Rename(tmpFile.Name(), path)
+	if err != nil {
+		return "", fmt.Errorf("error saving snapshot: %w", err)
+	}
+
+	s.recordBackup(ctx, path, wConn, transfer.Record{
+		CreatedAt: createdAt,
+		Size:      size,
+		SHA256:    hex.EncodeToString(sum.Sum(nil)),
+	})
+
+	return path, nil
+}
+
+// recordBackup adds a saved snapshot to the backup index and the fleet
+// timeline.
+func (s *CentralServer) recordBackup(ctx context.Context, path string, wConn *WrapperConnection,
+	record transfer.Record) {
+	wConn.recordEvent(timeline.Event{Type: timeline.TypeBackup, Actor: contextActor(ctx), Text: filepath.Base(path)})
+
+	if s.backupIndex == nil {
+		return
+	}
+
+	rel, err := filepath.Rel(s.backupDir, path)
+	if err != nil {
+		rel = path
+	}
+
+	record.Path = filepath.ToSlash(rel)
+	record.Wrapper = wConn.ID
+	record.Name = wConn.Name
+	record.StoredAt = time.Now().UTC()
+
+	err = s.backupIndex.Add(record)
+	if err != nil {
+		fmt.Printf("Error recording backup: %v\n", err)
+	}
+}
+
+// Sources of the backups listed by the backup browser.
+const (
+	BackupSourceCentral  = "central"  // Saved by a backup job to the central backup directory
+	BackupSourceRollback = "rollback" // A rollback point kept by the wrapper itself
+)
+
+// backupListTimeout bounds listing the rollback points of a single wrapper.
+const backupListTimeout = 10 * time.Second
+
+// BackupEntry is a backup listed by the backup browser. Central backups are
+// identified by their path, rollback points by their wrapper and ID.
+type BackupEntry struct {
+	transfer.Record
+
+	Source string `json:"source"`
+	ID     string `json:"id,omitempty"`     // Of a rollback point
+	Detail string `json:"detail,omitempty"` // What a rollback point was taken before
+}
+
+// BackupVerification is the result of checking a central backup.
+type BackupVerification struct {
+	Path     string `json:"path"`
+	OK       bool   `json:"ok"`
+	SHA256   string `json:"sha256"`
+	Expected string `json:"expected"` // Recorded when the backup was stored
+	Files    int    `json:"files"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BackupRestoreRequest is the body of a request to restore a backup.
+type BackupRestoreRequest struct {
+	Source  string `json:"source"`
+	Path    string `json:"path,omitempty"`    // Of a central backup
+	Wrapper string `json:"wrapper,omitempty"` // Of a rollback point
+	ID      string `json:"id,omitempty"`      // Of a rollback point
+
+	// Target is the wrapper to restore to, the one the backup came from if
+	// empty. A wrapper restoring another's backup keeps its own server-name
+	// and ports. Rollback points are only restored in place.
+	Target string `json:"target,omitempty"`
+}
+
+// backupAccess returns the user's access to the backups of a wrapper. Those
+// of wrappers no longer configured are left to admins.
+func (s *CentralServer) backupAccess(u *User, id string) Access {
+	wConn, exists := s.manager.GetConnection(id)
+	if !exists {
+		if u.Admin {
+			return AccessOperate
+		}
+
+		return AccessNone
+	}
+
+	return u.Access(wConn)
+}
+
+// storedBackup returns the record and file of the central backup at path,
+// if the user may see it.
+func (s *CentralServer) storedBackup(u *User, path string) (transfer.Record, string, bool) {
+	if s.backupIndex == nil {
+		return transfer.Record{}, "", false
+	}
+
+	record, ok := s.backupIndex.Get(path)
+	if !ok || !s.backupAccess(u, record.Wrapper).Allows(AccessView) {
+		return transfer.Record{}, "", false
+	}
+
+	file := filepath.Join(s.backupDir, filepath.FromSlash(record.Path))
+
+	rel, err := filepath.Rel(s.backupDir, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return transfer.Record{}, "", false
+	}
+
+	return record, file, true
+}
+
+// rollbackBackups returns the rollback points of a wrapper as backups.
+func rollbackBackups(ctx context.Context, wConn *WrapperConnection) ([]BackupEntry, error) {
+	var points []rollback.Point
+
+	err := wConn.apiCall(ctx, http.MethodGet, "/api/rollback", nil, &points)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]BackupEntry, 0, len(points))
+
+	for _, p := range points {
+		entries = append(entries, BackupEntry{
+			Record: transfer.Record{
+				Wrapper:   wConn.ID,
+				Name:      wConn.Name,
+				CreatedAt: p.CreatedAt,
+				StoredAt:  p.CreatedAt,
+				Size:      p.Size,
+			},
+			Source: BackupSourceRollback,
+			ID:     p.ID,
+			Detail: strings.TrimSpace(p.Reason + " " + p.Detail),
+		})
+	}
+
+	return entries, nil
+}
+
+// backupFilter matches backups against the search parameters of the backup
+// browser.
+type backupFilter struct {
+	wrapper  string
+	query    string // Case-insensitive, in the wrapper ID or name, world or detail
+	world    string
+	from, to time.Time
+}
+
+// parseBackupFilter reads a backup filter from a query. Dates are RFC 3339
+// timestamps or days, a day in to being included whole.
+func parseBackupFilter(query url.Values) (backupFilter, error) {
+	f := backupFilter{
+		wrapper: query.Get("wrapper"),
+		query:   strings.ToLower(strings.TrimSpace(query.Get("q"))),
+		world:   query.Get("world"),
+	}
+
+	for _, bound := range []struct {
+		param string
+		t     *time.Time
+	}{{"from", &f.from}, {"to", &f.to}} {
+		value := query.Get(bound.param)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, value)
+			if err == nil && bound.param == "to" {
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+		}
+
+		if err != nil {
+			return f, fmt.Errorf("invalid %s %q", bound.param, value)
+		}
+
+		*bound.t = t
+	}
+
+	return f, nil
+}
+
+// matches reports whether a backup matches the filter.
+func (f backupFilter) matches(e BackupEntry) bool {
+	switch {
+	case f.wrapper != "" && e.Wrapper != f.wrapper,
+		f.world != "" && e.World != f.world,
+		!f.from.IsZero() && e.CreatedAt.Before(f.from),
+		!f.to.IsZero() && e.CreatedAt.After(f.to):
+		return false
+	}
+
+	if f.query == "" {
+		return true
+	}
+
+	for _, field := range []string{e.Wrapper, e.Name, e.World, e.Detail} {
+		if strings.Contains(strings.ToLower(field), f.query) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleBackups lists the backups of the fleet the user can see, newest
+// first: the snapshots saved by backups, with where they came from, and the
+// rollback points the wrappers keep. They can be narrowed down by wrapper,
+// world, a search term in q and a date range in from and to.
+func (s *CentralServer) handleBackups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseBackupFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u := requestUser(r)
+	entries := []BackupEntry{}
+
+	if s.backupIndex != nil {
+		for _, record := range s.backupIndex.List(filter.wrapper) {
+			if s.backupAccess(u, record.Wrapper).Allows(AccessView) {
+				entries = append(entries, BackupEntry{Record: record, Source: BackupSourceCentral})
+			}
+		}
+	}
+
+	for _, wConn := range s.manager.ListConnections() {
+		if (filter.wrapper != "" && wConn.ID != filter.wrapper) ||
+			!wConn.Supports(protocol.CapRollback) || !u.Access(wConn).Allows(AccessView) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(withActor(r.Context(), u.Name), backupListTimeout)
+		points, err := rollbackBackups(ctx, wConn)
+		cancel()
+
+		if err != nil {
+			fmt.Printf("Error listing rollback points of wrapper %s: %v\n", wConn.ID, err)
+			continue
+		}
+
+		entries = append(entries, points...)
+	}
+
+	matched := entries[:0]
+
+	for _, e := range entries {
+		if filter.matches(e) {
+			matched = append(matched, e)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(matched)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleBackupDownload serves the central backup in ?path=.
+func (s *CentralServer) handleBackupDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	record, path, ok := s.storedBackup(requestUser(r), r.URL.Query().Get("path"))
+	if !ok {
+		http.Error(w, "Backup not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		http.Error(w, "Backup not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("%s-%s", record.Wrapper, filepath.Base(path))
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// verifyBackup checks that a central backup still has the SHA-256 recorded
+// when it was stored and that every file in it reads back.
+func verifyBackup(record transfer.Record, path string) BackupVerification {
+	v := BackupVerification{Path: record.Path, Expected: record.SHA256}
+
+	sum, err := fileSHA256(path)
+	if err != nil {
+		v.Error = err.Error()
+		return v
+	}
+
+	v.SHA256 = sum
+
+	if record.SHA256 != "" && sum != record.SHA256 {
+		v.Error = transfer.ErrChecksum.Error()
+		return v
+	}
+
+	v.Files, err = snapshot.Verify(path)
+	if err != nil {
+		v.Error = err.Error()
+		return v
+	}
+
+	v.OK = true
+
+	return v
+}
+
+// fileSHA256 returns the hex SHA-256 of a file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+
+	_, err = io.Copy(sum, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// handleBackupVerify verifies the central backup in ?path= (POST).
+func (s *CentralServer) handleBackupVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	record, path, ok := s.storedBackup(requestUser(r), r.URL.Query().Get("path"))
+	if !ok {
+		http.Error(w, "Backup not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(verifyBackup(record, path))
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleBackupRestore restores a backup as a job and responds with the job
+// ID (POST). A central backup is verified before it is imported into its
+// target, which restarts on it; a rollback point is restored by its wrapper.
+func (s *CentralServer) handleBackupRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BackupRestoreRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u := requestUser(r)
+
+	var (
+		target      *WrapperConnection
+		description string
+		run         func(ctx context.Context, h *jobs.Handle) error
+	)
+
+	switch req.Source {
+	case BackupSourceCentral:
+		record, path, ok := s.storedBackup(u, req.Path)
+		if !ok {
+			http.Error(w, "Backup not found", http.StatusNotFound)
+			return
+		}
+
+		if req.Target == "" {
+			req.Target = record.Wrapper
+		}
+
+		target, ok = s.manager.GetConnection(req.Target)
+		if !ok || !u.Access(target).Allows(AccessView) {
+			http.Error(w, "Target wrapper not found", http.StatusNotFound)
+			return
+		}
+
+		err = target.requireCapability(protocol.CapBackups)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", target.Name, err), http.StatusNotImplemented)
+			return
+		}
+
+		description = fmt.Sprintf("%s to %s", record.Path, target.Name)
+		run = func(ctx context.Context, h *jobs.Handle) error {
+			return restoreBackup(ctx, h, record, path, target)
+		}
+	case BackupSourceRollback:
+		if req.Target != "" && req.Target != req.Wrapper {
+			http.Error(w, "Rollback points can only be restored in place", http.StatusBadRequest)
+			return
+		}
+
+		var ok bool
+
+		target, ok = s.manager.GetConnection(req.Wrapper)
+		if !ok || !u.Access(target).Allows(AccessView) {
+			http.Error(w, "Wrapper not found", http.StatusNotFound)
+			return
+		}
+
+		err = target.requireCapability(protocol.CapRollback)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", target.Name, err), http.StatusNotImplemented)
+			return
+		}
+
+		description = fmt.Sprintf("rollback point %s of %s", req.ID, target.Name)
+		run = func(ctx context.Context, h *jobs.Handle) error {
+			h.Logf("restoring rollback point %s", req.ID)
+
+			return target.apiCall(ctx, http.MethodPost, "/api/rollback?wait=true&id="+url.QueryEscape(req.ID), nil, nil)
+		}
+	default:
+		http.Error(w, "Unknown backup source", http.StatusBadRequest)
+		return
+	}
+
+	if !u.Access(target).Allows(AccessOperate) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	job := s.jobs.Start("restore", description, u.Name, func(ctx context.Context, h *jobs.Handle) error {
+		return run(withActor(ctx, u.Name), h)
+	})
+
+	fmt.Printf("Restore of %s started by %s\n", description, u.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+
+	err = json.NewEncoder(w).Encode(map[string]string{"job": job.ID})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// restoreBackup verifies a central backup and imports it into target, which
+// restarts on it. A backup of another wrapper is imported with the target's
+// server-name and ports, so the target keeps its identity.
+func restoreBackup(ctx context.Context, h *jobs.Handle, record transfer.Record, path string,
+	target *WrapperConnection) error {
+	h.Logf("verifying %s", record.Path)
+
+	if v := verifyBackup(record, path); !v.OK {
+		return fmt.Errorf("backup %s failed verification: %s", record.Path, v.Error)
+	}
+
+	importPath := "/api/migration/import?restart=true&wait=true"
+
+	if target.ID != record.Wrapper {
+		props, err := target.readProperties(ctx)
+		if err != nil {
+			return err
+		}
+
+		settings, err := identitySettings(config.ParseProperties(props))
+		if err != nil {
+			return fmt.Errorf("error reading the identity of %s: %w", target.Name, err)
+		}
+
+		importPath += "&" + settings.query().Encode()
+	}
+
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("error opening backup: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("error opening backup: %w", err)
+	}
+
+	h.Logf("importing into %s", target.Name)
+
+	resp, err := target.apiRequest(ctx, http.MethodPut, importPath, h.Reader(f, info.Size()))
+	if err != nil {
+		return fmt.Errorf("error importing backup: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// identitySettings returns the server-name and ports of server.properties.
+func identitySettings(props map[string]string) (CloneSettings, error) {
+	settings := CloneSettings{Name: props["server-name"]}
+
+	port, err := strconv.Atoi(props["server-port"])
+	if err != nil {
+		return settings, fmt.Errorf("invalid server-port %q", props["server-port"])
+	}
+
+	settings.Port = port
+
+	if v6 := props["server-portv6"]; v6 != "" {
+		settings.PortV6, err = strconv.Atoi(v6)
+		if err != nil {
+			return settings, fmt.Errorf("invalid server-portv6 %q", v6)
+		}
+	}
+
+	return settings, nil
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CloneSettings set a cloned server apart from its source.
+type CloneSettings struct {
+	Name   string `json:"name"`             // server-name of the copy
+	Port   int    `json:"port"`             // server-port of the copy
+	PortV6 int    `json:"portv6,omitempty"` // server-portv6 of the copy, unchanged if 0
+}
+
+// query returns the import parameters applying the settings.
+func (c CloneSettings) query() url.Values {
+	query := url.Values{}
+	query.Set("name", c.Name)
+	query.Set("port", strconv.Itoa(c.Port))
+
+	if c.PortV6 != 0 {
+		query.Set("portv6", strconv.Itoa(c.PortV6))
+	}
+
+	return query
+}
+
+// CloneRequest is the body of a request to copy a server to another wrapper,
+// e.g. to try a risky addon on a staging copy. The world, the packs it uses,
+// server.properties, allowlist.json and permissions.json are copied; the
+// source keeps running.
+type CloneRequest struct {
+	Source string `json:"source"` // Wrapper ID of the server to copy
+	Target string `json:"target"` // Wrapper ID that runs the copy, replacing its world
+
+	CloneSettings
+}
+
+// handleClones starts a clone (POST). Clones are migrations that keep their
+// source running and are listed with them. The user must be able to view the
+// source and operate the target, whose world is replaced.
+func (s *CentralServer) handleClones(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CloneRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// The copy's settings are only checked for wrappers the user may clone
+	// between, as those of a migration
+	u := requestUser(r)
+
+	switch {
+	case !s.backupAccess(u, req.Source).Allows(AccessView):
+		http.Error(w, "Source wrapper not found", http.StatusNotFound)
+		return
+	case !s.backupAccess(u, req.Target).Allows(AccessView):
+		http.Error(w, "Target wrapper not found", http.StatusNotFound)
+		return
+	case !s.backupAccess(u, req.Target).Allows(AccessOperate):
+		s.httpError(w, r, "error.forbidden", http.StatusForbidden)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+
+	switch {
+	case req.Name == "" || strings.ContainsAny(req.Name, "\r\n"):
+		http.Error(w, "A name for the copy is required", http.StatusBadRequest)
+		return
+	case req.Port < 1 || req.Port > 65535 || req.PortV6 < 0 || req.PortV6 > 65535:
+		http.Error(w, "A valid port for the copy is required", http.StatusBadRequest)
+		return
+	case req.Source != "" && req.Source == req.Target:
+		// A wrapper supervises a single bedrock_server
+		http.Error(w, "A wrapper runs a single server, clone to another wrapper", http.StatusBadRequest)
+		return
+	}
+
+	s.startMigration(w, r, MigrationRequest{Source: req.Source, Target: req.Target, Clone: &req.CloneSettings})
+}
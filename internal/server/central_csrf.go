@@ -0,0 +1,89 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// sessionCookie holds the session key of browsers signed in with cookies
+	sessionCookie = "mcs_session"
+
+	// csrfHeader carries the CSRF token of cookie-authenticated requests.
+	// WebSocket upgrades can't set headers, so they pass ?csrf= instead.
+	csrfHeader = "X-CSRF-Token"
+)
+
+// setSessionCookie signs the browser in with a session. The cookie can't be
+// read by scripts and isn't sent along with cross-site requests.
+func setSessionCookie(w http.ResponseWriter, r *http.Request, created CreatedSession) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    created.Token,
+		Path:     "/",
+		Expires:  created.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// clearSessionCookie signs the browser out.
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// checkCSRF reports whether a cookie-authenticated request carries the CSRF
+// token of its session. Browsers attach cookies to requests from any page,
+// so changes and WebSocket upgrades, on any path, must prove they come from
+// the dashboard. Keys sent in headers or the query aren't attached
+// automatically and need no token.
+func (s *CentralServer) checkCSRF(r *http.Request, u *User) bool {
+	upgrade := websocket.IsWebSocketUpgrade(r)
+
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+	if safe && !upgrade {
+		return true
+	}
+
+	want, ok := s.sessions.csrfToken(u.session)
+	if !ok {
+		return false
+	}
+
+	got := r.Header.Get(csrfHeader)
+	if got == "" && upgrade {
+		got = r.URL.Query().Get("csrf")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// handleCSRF returns the CSRF token of the current session. Other sites
+// can't read the response, so only the dashboard learns the token.
+func (s *CentralServer) handleCSRF(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.sessions.csrfToken(requestUser(r).session)
+	if !ok {
+		http.Error(w, "CSRF tokens are only issued to browser sessions", http.StatusBadRequest)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(map[string]string{"csrf_token": token})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
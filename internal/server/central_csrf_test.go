@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// cookieRequest returns a request signed in with the session cookie.
+func cookieRequest(method, target, session string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: session})
+
+	return r
+}
+
+// upgrade marks a request as a WebSocket upgrade.
+func upgrade(r *http.Request) *http.Request {
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+
+	return r
+}
+
+func TestCheckCSRF(t *testing.T) {
+	s := newTestCentral(t, false)
+
+	created, err := s.sessions.create("operator", false, false, httptest.NewRequest(http.MethodPost, "/", nil))
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	handler := s.authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	status := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		return w.Code
+	}
+
+	withHeader := cookieRequest(http.MethodPost, "/api/macros", created.Token)
+	withHeader.Header.Set(csrfHeader, created.CSRFToken)
+
+	wrongHeader := cookieRequest(http.MethodPost, "/api/macros", created.Token)
+	wrongHeader.Header.Set(csrfHeader, "guess")
+
+	bearer := httptest.NewRequest(http.MethodPost, "/api/macros", nil)
+	bearer.Header.Set("Authorization", "Bearer "+created.Token)
+
+	master := httptest.NewRequest(http.MethodPost, "/api/macros", nil)
+	master.Header.Set("X-Auth-Key", testMasterKey)
+
+	tests := []struct {
+		name string
+		r    *http.Request
+		want int
+	}{
+		{"cookie read", cookieRequest(http.MethodGet, "/api/macros", created.Token), http.StatusOK},
+		{"cookie change without token", cookieRequest(http.MethodPost, "/api/macros", created.Token), http.StatusForbidden},
+		{"cookie change with token", withHeader, http.StatusOK},
+		{"cookie change with wrong token", wrongHeader, http.StatusForbidden},
+		{"bearer change", bearer, http.StatusOK},
+		{"master key change", master, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		if got := status(tt.r); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+
+	// WebSocket upgrades can't set headers, on any path they need the token
+	// in the query
+	for _, path := range []string{"/ws?wrapper=one", "/api/jobs/ws"} {
+		r := upgrade(cookieRequest(http.MethodGet, path, created.Token))
+		if got := status(r); got != http.StatusForbidden {
+			t.Errorf("%s: expected an upgrade without a token to be refused, got %d", path, got)
+		}
+
+		sep := "?"
+		if r.URL.RawQuery != "" {
+			sep = "&"
+		}
+
+		r = upgrade(cookieRequest(http.MethodGet, path+sep+"csrf="+created.CSRFToken, created.Token))
+		if got := status(r); got != http.StatusOK {
+			t.Errorf("%s: expected an upgrade with the token to be accepted, got %d", path, got)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/proxy"
+)
+
+// denyListTimeout bounds a deny list push to a single wrapper.
+const denyListTimeout = 10 * time.Second
+
+// denyListChanged marks the fleet deny list as changed so that it is pushed
+// to every wrapper again.
+func (m *ConnectionManager) denyListChanged() {
+	m.denyListVersion.Add(1)
+}
+
+// SyncDenyList pushes the fleet deny list to the connected wrappers that
+// don't have the current version yet. Wrappers without the UDP proxy don't
+// serve the deny list API and are skipped until the list changes again.
+func (m *ConnectionManager) SyncDenyList() {
+	if m.denyList == nil {
+		return
+	}
+
+	version := m.denyListVersion.Load()
+
+	data, err := json.Marshal(m.denyList.Entries())
+	if err != nil {
+		fmt.Printf("Error encoding deny list: %v\n", err)
+		return
+	}
+
+	for _, wConn := range m.ListConnections() {
+		if wConn.Status != StatusConnected || wConn.denyListSynced.Load() == version {
+			continue
+		}
+
+		// Wrappers announcing their capabilities without the deny list run
+		// without the UDP proxy
+		if hello := wConn.Hello(); hello.Protocol > protocol.LegacyVersion && !hello.Supports(protocol.CapDenyList) {
+			continue
+		}
+
+		err := wConn.pushDenyList(data)
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			err = nil
+		}
+
+		if err != nil {
+			fmt.Printf("Error syncing deny list to wrapper %s: %v\n", wConn.ID, err)
+			continue
+		}
+
+		wConn.denyListSynced.Store(version)
+	}
+}
+
+// pushDenyList replaces the fleet entries of the wrapper's deny list.
+func (w *WrapperConnection) pushDenyList(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), denyListTimeout)
+	defer cancel()
+
+	resp, err := w.apiRequest(ctx, http.MethodPut, "/api/denylist", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return resp.Body.Close()
+}
+
+// DenyListSync periodically pushes the fleet deny list to wrappers that
+// missed a change, such as ones that were offline, until the manager is shut
+// down.
+func (m *ConnectionManager) DenyListSync(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.SyncDenyList()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// handleDenyList lists (GET), adds (POST) or removes (DELETE ?value=) entries
+// of the deny list shared by all wrappers. Changes are pushed to the
+// wrappers right away.
+func (s *CentralServer) handleDenyList(w http.ResponseWriter, r *http.Request) {
+	deny := s.manager.denyList
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var entry proxy.Entry
+
+		err := json.NewDecoder(io.LimitReader(r.Body, maxDenyListSize)).Decode(&entry)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		entry.Source = proxy.SourceFleet
+
+		_, err = deny.Add(entry)
+		if err != nil {
+			denyListError(w, err)
+			return
+		}
+	case http.MethodDelete:
+		removed, err := deny.Remove(r.URL.Query().Get("value"))
+		if err != nil {
+			denyListError(w, err)
+			return
+		}
+
+		if !removed {
+			http.Error(w, "Entry not found", http.StatusNotFound)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		s.manager.denyListChanged()
+		go s.manager.SyncDenyList()
+	}
+
+	err := json.NewEncoder(w).Encode(deny.Entries())
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
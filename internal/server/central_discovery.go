@@ -0,0 +1,265 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/mdns"
+)
+
+// verifyTimeout bounds the request checking the shared key of a discovered
+// wrapper.
+const verifyTimeout = 10 * time.Second
+
+// NewWrapper is a wrapper found on the LAN that an admin added with its
+// shared key.
+type NewWrapper struct {
+	ID        string
+	Name      string
+	Address   string
+	SharedKey string
+}
+
+// DiscoveredWrapper is a wrapper found on the LAN.
+type DiscoveredWrapper struct {
+	mdns.Instance
+	Address string `json:"address"`         // WebSocket URL the central server would connect to
+	Added   string `json:"added,omitempty"` // ID of the wrapper if it's on the dashboard already
+}
+
+// discovery remembers the wrappers found by the last browse, the only ones
+// that may be added.
+type discovery struct {
+	mu    sync.Mutex
+	found []mdns.Instance
+}
+
+// handleDiscovery browses the LAN for wrappers (GET) or adds a discovered
+// one with its shared key (POST).
+func (s *CentralServer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.browseWrappers(w, r)
+	case http.MethodPost:
+		s.addDiscoveredWrapper(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// browseWrappers lists the wrappers advertised on the LAN, marking those on
+// the dashboard already.
+func (s *CentralServer) browseWrappers(w http.ResponseWriter, r *http.Request) {
+	instances, err := mdns.Browse(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.discovery.mu.Lock()
+	s.discovery.found = instances
+	s.discovery.mu.Unlock()
+
+	conns := s.manager.ListConnections()
+	wrappers := []DiscoveredWrapper{}
+
+	for _, instance := range instances {
+		wrapper := DiscoveredWrapper{Instance: instance, Address: instance.Address()}
+
+		i := slices.IndexFunc(conns, func(wConn *WrapperConnection) bool {
+			return sameHost(wConn.Address, wrapper.Address)
+		})
+		if i >= 0 {
+			wrapper.Added = conns[i].ID
+		}
+
+		wrappers = append(wrappers, wrapper)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(wrappers)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// addDiscoveredWrapper connects to a wrapper found by the last browse once
+// its shared key is confirmed, and saves it to the config file.
+func (s *CentralServer) addDiscoveredWrapper(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Address   string `json:"address"`
+		Name      string `json:"name"`
+		SharedKey string `json:"shared_key"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.SharedKey == "" {
+		http.Error(w, "The wrapper's shared key is required", http.StatusBadRequest)
+		return
+	}
+
+	s.discovery.mu.Lock()
+	i := slices.IndexFunc(s.discovery.found, func(instance mdns.Instance) bool {
+		return instance.Address() == req.Address
+	})
+
+	var instance mdns.Instance
+	if i >= 0 {
+		instance = s.discovery.found[i]
+	}
+	s.discovery.mu.Unlock()
+
+	if i < 0 {
+		http.Error(w, "Wrapper not discovered, browse the LAN again", http.StatusNotFound)
+		return
+	}
+
+	conns := s.manager.ListConnections()
+	if slices.ContainsFunc(conns, func(wConn *WrapperConnection) bool { return sameHost(wConn.Address, req.Address) }) {
+		http.Error(w, "Wrapper already added", http.StatusConflict)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = instance.Name
+	}
+
+	// Check the key before saving a wrapper the central server can't use
+	_, err = verifyWrapper(r.Context(), req.Address, req.SharedKey)
+	if errors.Is(err, ErrKeyRejected) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	wrapper := NewWrapper{
+		ID:        wrapperID(name, conns),
+		Name:      name,
+		Address:   req.Address,
+		SharedKey: req.SharedKey,
+	}
+
+	s.addWrapper(w, r, wrapper, "from the LAN")
+}
+
+// addWrapper saves a wrapper to the config file and connects to it,
+// responding with its ID.
+func (s *CentralServer) addWrapper(w http.ResponseWriter, r *http.Request, wrapper NewWrapper, how string) {
+	// Without a config file the wrapper stays until the central server restarts
+	if s.saveWrapper != nil {
+		err := s.saveWrapper(wrapper)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error saving the wrapper: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err := s.manager.Connect(wrapper.ID, wrapper.Name, wrapper.Address, "", "", wrapper.SharedKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	fmt.Printf("Wrapper %s (%s) at %s added %s by %s\n",
+		wrapper.Name, wrapper.ID, wrapper.Address, how, requestUser(r).Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(map[string]string{"id": wrapper.ID})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// ErrKeyRejected is returned when a wrapper rejects the shared key it's
+// added with.
+var ErrKeyRejected = errors.New("the wrapper rejected the shared key")
+
+// verifyWrapper checks that the wrapper at address accepts sharedKey,
+// returning the versions it reports.
+func verifyWrapper(ctx context.Context, address, sharedKey string) (map[string]any, error) {
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+
+	candidate := &WrapperConnection{Address: address, SharedKey: sharedKey}
+
+	resp, err := candidate.apiRequest(ctx, http.MethodGet, "/api/version", nil)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+		return nil, ErrKeyRejected
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reaching the wrapper: %w", err)
+	}
+	defer resp.Body.Close()
+
+	versions := map[string]any{}
+
+	err = json.NewDecoder(resp.Body).Decode(&versions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version response from the wrapper: %w", err)
+	}
+
+	return versions, nil
+}
+
+// sameHost reports whether two wrapper addresses point at the same host and
+// port.
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(ua.Host, ub.Host)
+}
+
+var idUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// wrapperID derives an ID from a wrapper's name that none of conns has.
+func wrapperID(name string, conns []*WrapperConnection) string {
+	base := strings.Trim(idUnsafe.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if base == "" {
+		base = "wrapper"
+	}
+
+	taken := func(id string) bool {
+		return slices.ContainsFunc(conns, func(wConn *WrapperConnection) bool { return wConn.ID == id })
+	}
+
+	id := base
+	for n := 2; taken(id); n++ {
+		id = base + "-" + strconv.Itoa(n)
+	}
+
+	return id
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type actorContextKey struct{}
+
+// withActor returns a context whose wrapper API requests act for a user, so
+// the wrapper records them in its audit log.
+func withActor(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, name)
+}
+
+// contextActor returns the user a context acts for, empty if none.
+func contextActor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+	return actor
+}
+
+// proxyHeaders are copied from wrapper responses to the dashboard.
+var proxyHeaders = []string{"Content-Type", "Content-Length", "Content-Disposition", "Last-Modified"}
+
+// handleWrapperAPI forwards file manager, config history, announcement,
+// message, function, rule, script, plugin and audit log requests for the
+// wrapper in ?wrapper= to it, acting for the requesting user.
+func (s *CentralServer) handleWrapperAPI(w http.ResponseWriter, r *http.Request) {
+	wConn, exists := s.manager.GetConnection(r.URL.Query().Get("wrapper"))
+	if !exists {
+		http.Error(w, "Wrapper not found", http.StatusNotFound)
+		return
+	}
+
+	if capability, ok := apiCapabilities[r.URL.Path]; ok {
+		err := wConn.requireCapability(capability)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+	}
+
+	query := r.URL.Query()
+	query.Del("wrapper")
+	query.Del("auth")
+
+	target := r.URL.Path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if r.Method == http.MethodPut || r.Method == http.MethodPost || r.Method == http.MethodPatch {
+		body = r.Body
+	}
+
+	ctx := withActor(r.Context(), requestUser(r).Name)
+
+	resp, err := wConn.apiRequest(ctx, r.Method, target, body)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		http.Error(w, apiErr.Message, apiErr.Status)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range proxyHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		fmt.Printf("Error forwarding %s: %v\n", r.URL.Path, err)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/i18n"
+)
+
+// Localization is the language of the web console and its messages.
+type Localization struct {
+	Language  string            `json:"language"`
+	Languages []string          `json:"languages"`
+	Messages  map[string]string `json:"messages"`
+}
+
+// requestLanguage returns the language for messages to the client of r:
+// ?lang=, the one stored with its browser session or in the user's
+// preferences, or the best match of its Accept-Language header.
+func (s *CentralServer) requestLanguage(r *http.Request) string {
+	preferred := r.URL.Query().Get("lang")
+	user := requestUser(r).Name
+
+	if !i18n.Supported(preferred) {
+		preferred = requestUser(r).language
+	}
+
+	if preferred == "" && user == "" {
+		// Requests to public routes, or failing authentication
+		if key, _ := requestKey(r); key != "" {
+			u, ok := s.authenticate(key)
+			if ok {
+				preferred, user = u.language, u.Name
+			}
+		}
+	}
+
+	if preferred == "" && user != "" && s.preferences != nil {
+		preferred = s.preferences.Get(user).Language
+	}
+
+	return i18n.Negotiate(preferred, r.Header.Get("Accept-Language"))
+}
+
+// httpError replies with the message with key in the language of the
+// client.
+func (s *CentralServer) httpError(w http.ResponseWriter, r *http.Request, key string, code int) {
+	http.Error(w, i18n.T(s.requestLanguage(r), key), code)
+}
+
+// handleI18n returns the messages of the web console in the language of the
+// client (GET, open to everyone as the sign-in prompt needs them) or stores
+// the language picked by a signed-in user with their browser session (PUT
+// {"language": "es"}, or "" to follow the browser again).
+func (s *CentralServer) handleI18n(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeLocalization(w, s.requestLanguage(r))
+	case http.MethodPut:
+		s.authMiddleware(s.handleLanguage)(w, r)
+	default:
+		s.httpError(w, r, "error.method_not_allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleLanguage stores the language of the user's browser session.
+func (s *CentralServer) handleLanguage(w http.ResponseWriter, r *http.Request) {
+	u := requestUser(r)
+
+	if u.session == "" {
+		http.Error(w, "Only browser sessions store a language, send Accept-Language instead", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Language string `json:"language"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Language != "" && !i18n.Supported(req.Language) {
+		s.httpError(w, r, "error.unsupported_language", http.StatusBadRequest)
+		return
+	}
+
+	if !s.sessions.setLanguage(u.session, req.Language) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	writeLocalization(w, i18n.Negotiate(req.Language, r.Header.Get("Accept-Language")))
+}
+
+// writeLocalization sends the messages in lang.
+func writeLocalization(w http.ResponseWriter, lang string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Vary", "Accept-Language")
+
+	err := json.NewEncoder(w).Encode(Localization{
+		Language:  lang,
+		Languages: i18n.Languages,
+		Messages:  i18n.Messages(lang),
+	})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
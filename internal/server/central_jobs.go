@@ -0,0 +1,553 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rawtext"
+)
+
+// Fleet job actions.
+const (
+	JobBroadcast = "broadcast" // Send a message to the players of each server
+	JobUpdate    = "update"    // Update each wrapper to the latest release
+	JobBackup    = "backup"    // Save a snapshot of each server on the central server
+)
+
+// Target states.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled" // The job was cancelled before the target was worked on
+)
+
+const (
+	// defaultJobWorkers is how many targets are worked on at once unless
+	// configured.
+	defaultJobWorkers = 4
+
+	// jobTargetTimeout bounds the work on a single target.
+	jobTargetTimeout = 30 * time.Minute
+
+	// jobWatcherBuffer is how many job updates are queued for a WebSocket
+	// client before it is disconnected, enough for the jobs it is sent on
+	// connecting.
+	jobWatcherBuffer = 256
+)
+
+// JobRequest is the body of a request to run an action across wrappers,
+// named by ID or group like macro runs.
+type JobRequest struct {
+	Action   string           `json:"action"`
+	Wrappers []string         `json:"wrappers,omitempty"`
+	Groups   []string         `json:"groups,omitempty"`
+	Message  *rawtext.Message `json:"message,omitempty"` // What a broadcast sends
+}
+
+// JobTarget is the progress of a fleet job on one wrapper, the detail of
+// the job.
+type JobTarget struct {
+	Wrapper    string    `json:"wrapper"`
+	Name       string    `json:"name,omitempty"`
+	State      string    `json:"state"`
+	Result     string    `json:"result,omitempty"` // e.g. where a backup was saved
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+// workerPool runs tasks on a bounded number of goroutines.
+type workerPool struct {
+	tasks chan func()
+}
+
+// newWorkerPool starts a pool of workers.
+func newWorkerPool(workers int) *workerPool {
+	if workers <= 0 {
+		workers = defaultJobWorkers
+	}
+
+	p := &workerPool{tasks: make(chan func())}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+
+	return p
+}
+
+// run queues a task. It is queued from another goroutine so the caller
+// isn't held up while the workers are busy.
+func (p *workerPool) run(task func()) {
+	go func() { p.tasks <- task }()
+}
+
+// runFleetJob runs work on each queued target's wrapper on the worker pool,
+// reporting the targets as the detail of the job and the finished targets
+// as its progress. Targets already finished, such as wrappers that weren't
+// found, are left alone, and targets still queued when the job is cancelled
+// are skipped.
+func (s *CentralServer) runFleetJob(ctx context.Context, h *jobs.Handle, actor string, targets []JobTarget,
+	conns map[string]*WrapperConnection, work func(context.Context, *WrapperConnection) (string, error)) error {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		total    int64
+		finished int64
+	)
+
+	// Called under mu
+	report := func() {
+		h.SetDetail(append([]JobTarget{}, targets...))
+	}
+
+	for _, target := range targets {
+		if _, ok := conns[target.Wrapper]; ok && target.State == JobQueued {
+			total++
+		}
+	}
+
+	mu.Lock()
+	report()
+	h.Progress(0, total)
+	mu.Unlock()
+
+	for i := range targets {
+		wConn, ok := conns[targets[i].Wrapper]
+		if !ok || targets[i].State != JobQueued {
+			continue
+		}
+
+		wg.Add(1)
+
+		target := &targets[i]
+
+		s.pool.run(func() {
+			defer wg.Done()
+
+			mu.Lock()
+
+			if ctx.Err() != nil {
+				target.State = JobCancelled
+				target.FinishedAt = time.Now().UTC()
+				finished++
+				report()
+				mu.Unlock()
+
+				return
+			}
+
+			target.State = JobRunning
+			target.StartedAt = time.Now().UTC()
+			report()
+			mu.Unlock()
+
+			label := target.Name
+			if label == "" {
+				label = target.Wrapper
+			}
+
+			targetCtx, cancel := context.WithTimeout(withActor(ctx, actor), jobTargetTimeout)
+			defer cancel()
+
+			result, err := work(targetCtx, wConn)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			target.FinishedAt = time.Now().UTC()
+			target.Result = result
+			target.State = JobDone
+
+			switch {
+			case err != nil:
+				target.State = JobFailed
+				target.Error = err.Error()
+				h.Logf("%s: %v", label, err)
+			case result != "":
+				h.Logf("%s: %s", label, result)
+			default:
+				h.Logf("%s: done", label)
+			}
+
+			finished++
+			h.Progress(finished, total)
+			report()
+		})
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	failed := 0
+
+	for _, target := range targets {
+		if target.State == JobFailed {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d wrappers failed", failed, len(targets))
+	}
+
+	return nil
+}
+
+// jobWork returns what a job does on each wrapper.
+func (s *CentralServer) jobWork(req JobRequest) (func(context.Context, *WrapperConnection) (string, error), error) {
+	switch req.Action {
+	case JobBroadcast:
+		if req.Message == nil {
+			return nil, fmt.Errorf("a broadcast needs a message")
+		}
+
+		_, err := req.Message.Commands()
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := json.Marshal(req.Message)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(ctx context.Context, wConn *WrapperConnection) (string, error) {
+			return "", wConn.apiCall(ctx, http.MethodPost, "/api/messages", bytes.NewReader(body), nil)
+		}, nil
+	case JobUpdate:
+		return func(ctx context.Context, wConn *WrapperConnection) (string, error) {
+			err := wConn.requireCapability(protocol.CapSelfUpdate)
+			if err != nil {
+				return "", err
+			}
+
+			var rel struct {
+				Version string `json:"version"`
+			}
+
+			err = wConn.apiCall(ctx, http.MethodPost, "/api/update?wait=true", nil, &rel)
+			if err != nil {
+				return "", err
+			}
+
+			return "updating to " + rel.Version, nil
+		}, nil
+	case JobBackup:
+		if s.backupDir == "" {
+			return nil, fmt.Errorf("backups are disabled")
+		}
+
+		return s.backup, nil
+	default:
+		return nil, fmt.Errorf("unknown action %q", req.Action)
+	}
+}
+
+// apiCall sends an API request to the wrapper and decodes the JSON response
+// into result, if given.
+func (w *WrapperConnection) apiCall(ctx context.Context, method, path string, body io.Reader, result any) error {
+	resp, err := w.apiRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// jobWatcher is a WebSocket client receiving job updates.
+type jobWatcher struct {
+	send  chan []byte
+	actor string // Only jobs this user started, all of them if empty
+}
+
+// jobWatchers are the WebSocket clients receiving job updates.
+type jobWatchers struct {
+	mu    sync.Mutex
+	items map[*jobWatcher]bool
+}
+
+func (jw *jobWatchers) add(w *jobWatcher) {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	if jw.items == nil {
+		jw.items = make(map[*jobWatcher]bool)
+	}
+
+	jw.items[w] = true
+}
+
+func (jw *jobWatchers) remove(w *jobWatcher) {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	if jw.items[w] {
+		delete(jw.items, w)
+		close(w.send)
+	}
+}
+
+// publish sends a job update to the watchers that may see the job. It is
+// called under the job manager's lock.
+func (jw *jobWatchers) publish(job jobs.Job) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		fmt.Printf("Error encoding job update: %v\n", err)
+		return
+	}
+
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	for w := range jw.items {
+		if w.actor == "" || w.actor == job.Actor {
+			jw.queue(w, data)
+		}
+	}
+}
+
+// send sends jobs to a single watcher.
+func (jw *jobWatchers) send(w *jobWatcher, list []jobs.Job) {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	for _, job := range list {
+		data, err := json.Marshal(job)
+		if err != nil {
+			fmt.Printf("Error encoding job update: %v\n", err)
+			continue
+		}
+
+		if !jw.queue(w, data) {
+			return
+		}
+	}
+}
+
+// queue queues a message for a watcher without blocking, under the lock.
+// Watchers that can't keep up or are gone are dropped.
+func (jw *jobWatchers) queue(w *jobWatcher, data []byte) bool {
+	if !jw.items[w] {
+		return false
+	}
+
+	select {
+	case w.send <- data:
+		return true
+	default:
+		delete(jw.items, w)
+		close(w.send)
+
+		return false
+	}
+}
+
+// jobActor returns the user whose jobs a request may see and cancel, empty
+// for admins who may see all of them.
+func jobActor(r *http.Request) string {
+	u := requestUser(r)
+	if u.Admin {
+		return ""
+	}
+
+	return u.Name
+}
+
+// handleJobs lists the jobs the user started, all of them for admins, or one
+// with ?id= (GET), starts a fleet job (POST), or cancels a job with ?id=
+// (DELETE). With ?wrapper= the request goes to the jobs of that wrapper,
+// such as snapshot imports and downloads, which are for admins.
+func (s *CentralServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("wrapper") != "" {
+		s.requireAdmin(s.handleWrapperAPI)(w, r)
+		return
+	}
+
+	u := requestUser(r)
+	actor := jobActor(r)
+	id := r.URL.Query().Get("id")
+
+	var result any
+
+	switch r.Method {
+	case http.MethodGet:
+		if id == "" {
+			result = s.jobs.List(actor)
+			break
+		}
+
+		job, ok := s.jobs.Get(id)
+		if !ok || (actor != "" && job.Actor != actor) {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+
+		result = job
+	case http.MethodPost:
+		var req JobRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Anyone operating a server may broadcast to it, updates and
+		// backups are for admins
+		if req.Action != JobBroadcast && !u.Admin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		work, err := s.jobWork(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		found, missing := s.targetWrappers(req.Wrappers, req.Groups)
+		if len(found)+len(missing) == 0 {
+			http.Error(w, "No wrappers or groups given", http.StatusBadRequest)
+			return
+		}
+
+		var targets []JobTarget
+
+		for _, id := range missing {
+			targets = append(targets, JobTarget{Wrapper: id, State: JobFailed, Error: "wrapper not found"})
+		}
+
+		conns := map[string]*WrapperConnection{}
+
+		for _, wConn := range found {
+			target := JobTarget{Wrapper: wConn.ID, Name: wConn.Name, State: JobQueued}
+
+			switch {
+			case !u.Access(wConn).Allows(AccessView):
+				// Not revealed, like unknown IDs; wrappers only matched by
+				// group are left out
+				if contains(req.Wrappers, wConn.ID) {
+					targets = append(targets, JobTarget{Wrapper: wConn.ID, State: JobFailed, Error: "wrapper not found"})
+				}
+
+				continue
+			case !u.Access(wConn).Allows(AccessOperate):
+				target.State = JobFailed
+				target.Error = "forbidden"
+			default:
+				conns[wConn.ID] = wConn
+			}
+
+			targets = append(targets, target)
+		}
+
+		description := fmt.Sprintf("%d wrapper(s)", len(targets))
+
+		job := s.jobs.Start(req.Action, description, u.Name, func(ctx context.Context, h *jobs.Handle) error {
+			return s.runFleetJob(ctx, h, u.Name, targets, conns, work)
+		})
+
+		fmt.Printf("Job %s (%s) started by %s on %d wrapper(s)\n", job.ID, req.Action, u.Name, len(conns))
+
+		result = job
+
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodDelete:
+		job, ok := s.jobs.Get(id)
+		if !ok || (actor != "" && job.Actor != actor) {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+
+		err := s.jobs.Cancel(id)
+		if err != nil {
+			jobError(w, err)
+			return
+		}
+
+		fmt.Printf("Job %s (%s) cancelled by %s\n", job.ID, job.Kind, u.Name)
+
+		w.WriteHeader(http.StatusAccepted)
+
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleJobsWebSocket streams job updates to a web client, each message a
+// JSON encoded job, starting with the jobs it may see. Users other than
+// admins only receive the jobs they started.
+func (s *CentralServer) handleJobsWebSocket(w http.ResponseWriter, r *http.Request) {
+	watcher := &jobWatcher{
+		send:  make(chan []byte, jobWatcherBuffer),
+		actor: jobActor(r),
+	}
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.jobWatch.add(watcher)
+	defer s.jobWatch.remove(watcher)
+
+	go func() {
+		// Closed once the watcher is removed, when the client disconnects
+		// or can't keep up
+		for data := range watcher.send {
+			err := ws.WriteMessage(websocket.TextMessage, data)
+			if err != nil {
+				break
+			}
+		}
+
+		_ = ws.Close()
+	}()
+
+	// Oldest first, like the updates that follow
+	current := s.jobs.List(watcher.actor)
+	for i, j := 0, len(current)-1; i < j; i, j = i+1, j-1 {
+		current[i], current[j] = current[j], current[i]
+	}
+
+	s.jobWatch.send(watcher, current)
+
+	// Nothing is read from the client, reading detects when it's gone
+	for {
+		_, _, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/macros"
+)
+
+// MacroListing is a macro with the variables it needs when run.
+type MacroListing struct {
+	macros.Macro
+	Variables []string `json:"variables"`
+}
+
+// MacroRunRequest is the body of a macro run request. The macro runs on the
+// listed wrappers and those in the listed groups that the user may run it
+// on.
+type MacroRunRequest struct {
+	Name     string            `json:"name"`
+	Wrappers []string          `json:"wrappers,omitempty"`
+	Groups   []string          `json:"groups,omitempty"`
+	Vars     map[string]string `json:"vars,omitempty"`
+}
+
+// MacroResult is the outcome of a macro run on a wrapper.
+type MacroResult struct {
+	Wrapper  string   `json:"wrapper"`
+	Commands []string `json:"commands,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// macroAccess returns the access a user needs to a wrapper to run a macro.
+// Admin macros need an admin, who has operate access everywhere.
+func macroAccess(m macros.Macro) Access {
+	if m.Run == macros.RunView {
+		return AccessView
+	}
+
+	return AccessOperate
+}
+
+// mayRun reports whether a user may run a macro at all.
+func mayRun(u *User, m macros.Macro) bool {
+	if u.Admin {
+		return true
+	}
+
+	return m.Run != macros.RunAdmin && m.Allows(u.Name)
+}
+
+// macroError reports a macro API error with a matching status.
+func macroError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, macros.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, macros.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleMacros lists the macros the user may run (GET, or one with ?name=)
+// and, for admins, adds or replaces (POST, or PUT ?name=), changes with a
+// JSON merge patch (PATCH ?name=) and deletes (DELETE ?name=) macros.
+func (s *CentralServer) handleMacros(w http.ResponseWriter, r *http.Request) {
+	u := requestUser(r)
+
+	if r.Method != http.MethodGet && !u.Admin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var result interface{}
+
+	status := http.StatusOK
+	name := r.URL.Query().Get("name")
+
+	switch r.Method {
+	case http.MethodGet:
+		if name != "" {
+			m, err := s.macros.Get(name)
+			if err == nil && !mayRun(u, m) {
+				err = macros.ErrNotFound
+			}
+
+			if err != nil {
+				macroError(w, err)
+				return
+			}
+
+			result = MacroListing{Macro: m, Variables: m.Variables()}
+
+			break
+		}
+
+		list := []MacroListing{}
+
+		for _, m := range s.macros.List() {
+			if mayRun(u, m) {
+				list = append(list, MacroListing{Macro: m, Variables: m.Variables()})
+			}
+		}
+
+		result = list
+	case http.MethodPost, http.MethodPut:
+		var m macros.Macro
+
+		err := json.NewDecoder(r.Body).Decode(&m)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			if m.Name != "" && m.Name != name {
+				http.Error(w, "Invalid request body, the name must match ?name=", http.StatusBadRequest)
+				return
+			}
+
+			m.Name = name
+		}
+
+		m, added, err := s.macros.Set(m)
+		if err != nil {
+			macroError(w, err)
+			return
+		}
+
+		if added && r.Method == http.MethodPut {
+			status = http.StatusCreated
+		}
+
+		result = MacroListing{Macro: m, Variables: m.Variables()}
+	case http.MethodPatch:
+		m, err := s.macros.Get(name)
+		if err != nil {
+			macroError(w, err)
+			return
+		}
+
+		m, err = readPatch(r, m)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		m.Name = name
+
+		m, _, err = s.macros.Set(m)
+		if err != nil {
+			macroError(w, err)
+			return
+		}
+
+		result = MacroListing{Macro: m, Variables: m.Variables()}
+	case http.MethodDelete:
+		err := s.macros.Delete(name)
+		if err != nil {
+			macroError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// targetWrappers returns the wrappers named by ID or group, and the IDs
+// that weren't found.
+func (s *CentralServer) targetWrappers(wrappers, groupNames []string) ([]*WrapperConnection, []string) {
+	var (
+		targets []*WrapperConnection
+		missing []string
+	)
+
+	seen := map[string]bool{}
+
+	for _, id := range wrappers {
+		wConn, exists := s.manager.GetConnection(id)
+		if !exists {
+			missing = append(missing, id)
+			continue
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			targets = append(targets, wConn)
+		}
+	}
+
+	if len(groupNames) > 0 {
+		groups := Grant{Groups: groupNames}
+
+		for _, wConn := range s.manager.ListConnections() {
+			if !seen[wConn.ID] && groups.matches(wConn.ID, wConn.Groups()) {
+				seen[wConn.ID] = true
+				targets = append(targets, wConn)
+			}
+		}
+	}
+
+	return targets, missing
+}
+
+// handleMacroRun runs a macro on wrappers, filling in its variables for each,
+// and returns the commands sent to each wrapper. Wrappers the user may not
+// run the macro on are reported as not found or forbidden and skipped.
+func (s *CentralServer) handleMacroRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MacroRunRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u := requestUser(r)
+
+	m, err := s.macros.Get(req.Name)
+	if err == nil && !mayRun(u, m) {
+		err = macros.ErrNotFound
+	}
+
+	if err != nil {
+		macroError(w, err)
+		return
+	}
+
+	targets, missing := s.targetWrappers(req.Wrappers, req.Groups)
+	if len(targets)+len(missing) == 0 {
+		http.Error(w, "No wrappers or groups given", http.StatusBadRequest)
+		return
+	}
+
+	results := []MacroResult{}
+
+	for _, id := range missing {
+		results = append(results, MacroResult{Wrapper: id, Error: "wrapper not found"})
+	}
+
+	for _, wConn := range targets {
+		result := MacroResult{Wrapper: wConn.ID}
+		access := u.Access(wConn)
+
+		switch {
+		case !access.Allows(AccessView):
+			// Not revealed, like unknown IDs; wrappers only matched by group
+			// are left out
+			if contains(req.Wrappers, wConn.ID) {
+				results = append(results, MacroResult{Wrapper: wConn.ID, Error: "wrapper not found"})
+			}
+
+			continue
+		case !access.Allows(macroAccess(m)):
+			result.Error = "forbidden"
+		default:
+			result.Commands, err = s.runMacro(wConn, m, req.Vars)
+			if err != nil {
+				result.Error = err.Error()
+			}
+
+			fmt.Printf("Macro %s run by %s on wrapper %s\n", m.Name, u.Name, wConn.ID)
+		}
+
+		results = append(results, result)
+	}
+
+	err = json.NewEncoder(w).Encode(results)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// runMacro sends a macro's commands to a wrapper and returns them.
+func (s *CentralServer) runMacro(wConn *WrapperConnection, m macros.Macro, vars map[string]string) ([]string, error) {
+	all := map[string]string{}
+	for k, v := range vars {
+		all[k] = v
+	}
+
+	all[macros.VarServer] = wConn.Name
+	all[macros.VarWrapper] = wConn.ID
+
+	commands, err := m.Expand(all)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, command := range commands {
+		err = wConn.SendMessage([]byte(command))
+		if err != nil {
+			return commands[:i], err
+		}
+	}
+
+	return commands, nil
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// metricsPrefix starts the names of all exported metrics.
+const metricsPrefix = "gogo_mc_"
+
+// metric is a family of samples in the Prometheus text format.
+type metric struct {
+	name    string
+	kind    string // gauge or counter
+	help    string
+	samples []sample
+}
+
+// sample is a value with its labels, as name and value pairs.
+type sample struct {
+	labels []string
+	value  float64
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// write writes the metric in the Prometheus text exposition format.
+func (m metric) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n", metricsPrefix, m.name, m.help)
+	fmt.Fprintf(w, "# TYPE %s%s %s\n", metricsPrefix, m.name, m.kind)
+
+	for _, s := range m.samples {
+		w.WriteString(metricsPrefix + m.name)
+
+		if len(s.labels) > 0 {
+			w.WriteByte('{')
+
+			for i := 0; i+1 < len(s.labels); i += 2 {
+				if i > 0 {
+					w.WriteByte(',')
+				}
+
+				fmt.Fprintf(w, `%s="%s"`, s.labels[i], labelEscaper.Replace(s.labels[i+1]))
+			}
+
+			w.WriteByte('}')
+		}
+
+		fmt.Fprintf(w, " %g\n", s.value)
+	}
+}
+
+// handleMetrics exports the state of the wrappers and their servers for
+// Prometheus, those the user may view. Servers are pinged on each scrape.
+func (s *CentralServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u := requestUser(r)
+	conns := []*WrapperConnection{}
+
+	for _, wConn := range s.manager.ListConnections() {
+		if u.Access(wConn).Allows(AccessView) {
+			conns = append(conns, wConn)
+		}
+	}
+
+	pings := pingServers(conns)
+
+	up := metric{name: "wrapper_up", kind: "gauge", help: "Whether the central server is connected to the wrapper."}
+	groups := metric{
+		name: "wrapper_group",
+		kind: "gauge",
+		help: "Groups the wrapper belongs to, \"ungrouped\" if none, always 1.",
+	}
+	wrapperLabels := metric{
+		name: "wrapper_label",
+		kind: "gauge",
+		help: "Labels the wrapper reported, such as owner or environment, always 1.",
+	}
+	online := metric{name: "server_online", kind: "gauge", help: "Whether the Minecraft server answers pings."}
+	players := metric{name: "server_players", kind: "gauge", help: "Players online."}
+	maxPlayers := metric{name: "server_max_players", kind: "gauge", help: "Player slots of the server."}
+	sent := metric{name: "wrapper_messages_sent_total", kind: "counter", help: "Messages sent to the wrapper."}
+	received := metric{
+		name: "wrapper_messages_received_total",
+		kind: "counter",
+		help: "Messages received from the wrapper.",
+	}
+	reconnections := metric{name: "wrapper_reconnections_total", kind: "counter", help: "Connections made to the wrapper."}
+	gaps := metric{
+		name: "wrapper_sequence_gaps_total",
+		kind: "counter",
+		help: "Gaps detected in the console line sequence.",
+	}
+	recovered := metric{
+		name: "wrapper_lines_recovered_total",
+		kind: "counter",
+		help: "Missing console lines received through retransmission.",
+	}
+	lost := metric{
+		name: "wrapper_lines_lost_total",
+		kind: "counter",
+		help: "Console lines the wrapper could no longer retransmit.",
+	}
+	bytesSent := metric{name: "wrapper_bytes_sent_total", kind: "counter", help: "Bytes of messages sent to the wrapper."}
+	bytesReceived := metric{
+		name: "wrapper_bytes_received_total",
+		kind: "counter",
+		help: "Bytes of messages received from the wrapper.",
+	}
+	linkRTT := metric{
+		name: "wrapper_link_rtt_seconds",
+		kind: "gauge",
+		help: "Percentiles of recent WebSocket ping round trips to the wrapper.",
+	}
+	pingLatency := metric{
+		name: "server_ping_latency_seconds",
+		kind: "gauge",
+		help: "Percentiles of recent RakNet ping round trips to the game port.",
+	}
+
+	for i, wConn := range conns {
+		labels := []string{"wrapper", wConn.ID, "name", wConn.Name}
+		stats := wConn.statsSnapshot()
+
+		up.samples = append(up.samples, sample{labels, boolValue(wConn.Status == StatusConnected)})
+
+		wrapperGroups := wConn.Groups()
+		if len(wrapperGroups) == 0 {
+			wrapperGroups = []string{"ungrouped"}
+		}
+
+		for _, group := range wrapperGroups {
+			groups.samples = append(groups.samples, sample{[]string{"wrapper", wConn.ID, "group", group}, 1})
+		}
+
+		reported := wConn.Labels()
+
+		keys := make([]string, 0, len(reported))
+		for key := range reported {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			wrapperLabels.samples = append(wrapperLabels.samples, sample{
+				[]string{"wrapper", wConn.ID, "label", key, "value", reported[key]}, 1,
+			})
+		}
+
+		online.samples = append(online.samples, sample{labels, boolValue(pings[i].online)})
+		players.samples = append(players.samples, sample{labels, float64(pings[i].pong.PlayerCount)})
+		maxPlayers.samples = append(maxPlayers.samples, sample{labels, float64(pings[i].pong.MaxPlayerCount)})
+		sent.samples = append(sent.samples, sample{labels, float64(stats.MessagesSent)})
+		received.samples = append(received.samples, sample{labels, float64(stats.MessagesReceived)})
+		reconnections.samples = append(reconnections.samples, sample{labels, float64(stats.Reconnections)})
+		gaps.samples = append(gaps.samples, sample{labels, float64(stats.SequenceGaps)})
+		recovered.samples = append(recovered.samples, sample{labels, float64(stats.LinesRecovered)})
+		lost.samples = append(lost.samples, sample{labels, float64(stats.LinesLost)})
+		bytesSent.samples = append(bytesSent.samples, sample{labels, float64(stats.BytesSent)})
+		bytesReceived.samples = append(bytesReceived.samples, sample{labels, float64(stats.BytesReceived)})
+		linkRTT.samples = append(linkRTT.samples, quantiles(labels, stats.LinkRTT)...)
+		pingLatency.samples = append(pingLatency.samples, quantiles(labels, stats.PingLatency)...)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	out := bufio.NewWriter(w)
+
+	for _, m := range []metric{
+		up, groups, wrapperLabels, online, players, maxPlayers, sent, received, reconnections, gaps, recovered, lost,
+		bytesSent, bytesReceived, linkRTT, pingLatency,
+	} {
+		m.write(out)
+	}
+
+	err := out.Flush()
+	if err != nil {
+		fmt.Printf("Error sending metrics: %v\n", err)
+	}
+}
+
+// quantiles returns the percentiles of a latency in seconds, none if there
+// are no samples yet.
+func quantiles(labels []string, l LatencyStats) []sample {
+	if l.Samples == 0 {
+		return nil
+	}
+
+	q := func(quantile string, ms float64) sample {
+		return sample{append(append([]string{}, labels...), "quantile", quantile), ms / 1000}
+	}
+
+	return []sample{q("0.5", l.P50), q("0.9", l.P90), q("0.99", l.P99)}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// grafanaDashboard returns a Grafana dashboard of the exported metrics. The
+// group and wrapper variables are filled from the wrapper labels, so one
+// dashboard covers the whole fleet or any part of it.
+func grafanaDashboard(title string) map[string]any {
+	selector := `wrapper=~"$wrapper"`
+	panelID := 0
+
+	panel := func(kind, name, expr, legend string, x, y, w, h int) map[string]any {
+		panelID++
+
+		return map[string]any{
+			"id":         panelID,
+			"type":       kind,
+			"title":      name,
+			"datasource": map[string]any{"type": "prometheus", "uid": "${datasource}"},
+			"gridPos":    map[string]any{"x": x, "y": y, "w": w, "h": h},
+			"targets": []map[string]any{{
+				"refId":        "A",
+				"expr":         expr,
+				"legendFormat": legend,
+			}},
+		}
+	}
+
+	variable := func(name, label, query string) map[string]any {
+		return map[string]any{
+			"name":       name,
+			"label":      label,
+			"type":       "query",
+			"datasource": map[string]any{"type": "prometheus", "uid": "${datasource}"},
+			"query":      query,
+			"refresh":    2,
+			"multi":      true,
+			"includeAll": true,
+			"current":    map[string]any{"text": "All", "value": "$__all"},
+			"sort":       1,
+		}
+	}
+
+	return map[string]any{
+		"title":         title,
+		"uid":           "gogo-mc-fleet",
+		"tags":          []string{"minecraft", "gogo-mc-bedrock-server"},
+		"schemaVersion": 39,
+		"refresh":       "30s",
+		"time":          map[string]any{"from": "now-24h", "to": "now"},
+		"templating": map[string]any{
+			"list": []map[string]any{
+				{
+					"name":    "datasource",
+					"label":   "Data source",
+					"type":    "datasource",
+					"query":   "prometheus",
+					"current": map[string]any{},
+				},
+				variable("group", "Group", fmt.Sprintf("label_values(%swrapper_group, group)", metricsPrefix)),
+				variable("wrapper", "Wrapper",
+					fmt.Sprintf(`label_values(%swrapper_group{group=~"$group"}, wrapper)`, metricsPrefix)),
+			},
+		},
+		"panels": []map[string]any{
+			panel("stat", "Players online", fmt.Sprintf(`sum(%sserver_players{%s})`, metricsPrefix, selector), "", 0, 0, 6, 4),
+			panel("stat", "Servers online", fmt.Sprintf(`sum(%sserver_online{%s})`, metricsPrefix, selector), "", 6, 0, 6, 4),
+			panel("stat", "Wrappers connected", fmt.Sprintf(`sum(%swrapper_up{%s})`, metricsPrefix, selector), "", 12, 0, 6, 4),
+			panel("stat", "Player slots", fmt.Sprintf(`sum(%sserver_max_players{%s})`, metricsPrefix, selector),
+				"", 18, 0, 6, 4),
+			panel("timeseries", "Players by server", fmt.Sprintf(`%sserver_players{%s}`, metricsPrefix, selector), "{{name}}",
+				0, 4, 24, 8),
+			panel("state-timeline", "Server online", fmt.Sprintf(`%sserver_online{%s}`, metricsPrefix, selector), "{{name}}",
+				0, 12, 12, 8),
+			panel("state-timeline", "Wrapper connected", fmt.Sprintf(`%swrapper_up{%s}`, metricsPrefix, selector), "{{name}}",
+				12, 12, 12, 8),
+			panel("timeseries", "Reconnections",
+				fmt.Sprintf(`increase(%swrapper_reconnections_total{%s}[$__rate_interval])`, metricsPrefix, selector), "{{name}}",
+				0, 20, 12, 8),
+			panel("timeseries", "Console lines lost",
+				fmt.Sprintf(`increase(%swrapper_lines_lost_total{%s}[$__rate_interval])`, metricsPrefix, selector), "{{name}}",
+				12, 20, 12, 8),
+			panel("timeseries", "Wrapper link round trip (p90)",
+				fmt.Sprintf(`%swrapper_link_rtt_seconds{%s,quantile="0.9"}`, metricsPrefix, selector), "{{name}}", 0, 28, 12, 8),
+			panel("timeseries", "Game port ping (p90)",
+				fmt.Sprintf(`%sserver_ping_latency_seconds{%s,quantile="0.9"}`, metricsPrefix, selector), "{{name}}",
+				12, 28, 12, 8),
+		},
+	}
+}
+
+// handleGrafanaDashboard serves a Grafana dashboard of the metrics, ready to
+// import. ?title= names it.
+func (s *CentralServer) handleGrafanaDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	title := r.URL.Query().Get("title")
+	if title == "" {
+		title = "Minecraft fleet"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="gogo-mc-dashboard.json"`)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(grafanaDashboard(title))
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+// Migration steps.
+const (
+	MigrationSnapshot     = "snapshot"
+	MigrationTransfer     = "transfer"
+	MigrationDecommission = "decommission"
+	MigrationDone         = "done"
+	MigrationFailed       = "failed"
+)
+
+// MigrationRequest is the body of a request to move a server between wrappers.
+type MigrationRequest struct {
+	Source       string `json:"source"`       // Wrapper ID the server is moved from
+	Target       string `json:"target"`       // Wrapper ID the server is moved to
+	Decommission bool   `json:"decommission"` // Stop the source server once the target has started
+
+	// Clone copies the server instead of moving it, see CloneRequest
+	Clone *CloneSettings `json:"clone,omitempty"`
+}
+
+// Migration tracks a server migration between two wrappers.
+type Migration struct {
+	MigrationRequest
+
+	ID          string    `json:"id"`
+	Job         string    `json:"job"` // ID of the job running the migration, to follow or cancel it
+	Step        string    `json:"step"`
+	Error       string    `json:"error,omitempty"`
+	Bytes       int64     `json:"bytes"` // Size of the transferred snapshot
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+}
+
+// migrations holds the migrations started on the central server.
+type migrations struct {
+	items map[string]*Migration
+	mu    sync.RWMutex
+}
+
+// list returns a copy of all migrations, newest first.
+func (m *migrations) list() []Migration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]Migration, 0, len(m.items))
+	for _, migration := range m.items {
+		list = append(list, *migration)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.After(list[j].StartedAt)
+	})
+
+	return list
+}
+
+// add registers a new migration.
+func (m *migrations) add(migration *Migration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.items == nil {
+		m.items = make(map[string]*Migration)
+	}
+
+	m.items[migration.ID] = migration
+}
+
+// update applies a change to a migration under the lock.
+func (m *migrations) update(migration *Migration, change func(*Migration)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	change(migration)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// runMigration snapshots the source wrapper, streams the archive into the
+// target wrapper, which restarts on the imported world, and optionally stops
+// the source server. It runs as a job, reporting the bytes transferred as
+// progress; cancelling it aborts the transfer.
+func (s *CentralServer) runMigration(ctx context.Context, h *jobs.Handle, migration *Migration,
+	source, target *WrapperConnection) error {
+	fail := func(err error) error {
+		fmt.Printf("Migration %s failed: %v\n", migration.ID, err)
+		s.migrations.update(migration, func(m *Migration) {
+			m.Error = err.Error()
+			m.Step = MigrationFailed
+			m.CompletedAt = time.Now().UTC()
+		})
+
+		return err
+	}
+
+	h.Logf("taking snapshot of %s", source.Name)
+
+	exportPath, importPath := "/api/migration/export?wait=true", "/api/migration/import?restart=true&wait=true"
+
+	if c := migration.Clone; c != nil {
+		exportPath += "&packs=true"
+		importPath += "&" + c.query().Encode()
+	}
+
+	resp, err := source.apiRequest(ctx, http.MethodGet, exportPath, nil)
+	if err != nil {
+		return fail(fmt.Errorf("error taking snapshot: %w", err))
+	}
+	defer resp.Body.Close()
+
+	s.migrations.update(migration, func(m *Migration) {
+		m.Step = MigrationTransfer
+	})
+
+	h.Logf("transferring snapshot to %s", target.Name)
+
+	body := &countingReader{r: h.Reader(resp.Body, max(resp.ContentLength, 0))}
+
+	importResp, err := target.apiRequest(ctx, http.MethodPut, importPath, body)
+	if err != nil {
+		return fail(fmt.Errorf("error importing snapshot: %w", err))
+	}
+	importResp.Body.Close()
+
+	s.migrations.update(migration, func(m *Migration) {
+		m.Bytes = body.n
+	})
+
+	h.Logf("transferred %d bytes", body.n)
+
+	if migration.Decommission {
+		s.migrations.update(migration, func(m *Migration) {
+			m.Step = MigrationDecommission
+		})
+
+		h.Logf("decommissioning %s", source.Name)
+
+		stopResp, err := source.apiRequest(ctx, http.MethodPost, "/api/migration/decommission", nil)
+		if err != nil {
+			return fail(fmt.Errorf("error decommissioning source: %w", err))
+		}
+		stopResp.Body.Close()
+	}
+
+	s.migrations.update(migration, func(m *Migration) {
+		m.Step = MigrationDone
+		m.CompletedAt = time.Now().UTC()
+	})
+
+	return nil
+}
+
+// handleMigrations lists the migrations between wrappers the user may view
+// and operate (GET) or starts a new one (POST).
+func (s *CentralServer) handleMigrations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		u := requestUser(r)
+		visible := []Migration{}
+
+		for _, migration := range s.migrations.list() {
+			if s.migrationAllowed(u, migration.Source, migration.Target) {
+				visible = append(visible, migration)
+			}
+		}
+
+		err := json.NewEncoder(w).Encode(visible)
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	case http.MethodPost:
+		var req MigrationRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Clone != nil && req.Decommission {
+			http.Error(w, "A clone can't decommission its source", http.StatusBadRequest)
+			return
+		}
+
+		s.startMigration(w, r, req)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// startMigration starts a migration or clone as a job and responds with it.
+func (s *CentralServer) startMigration(w http.ResponseWriter, r *http.Request, req MigrationRequest) {
+	if req.Source == "" || req.Target == "" || req.Source == req.Target {
+		http.Error(w, "Distinct source and target wrapper IDs are required", http.StatusBadRequest)
+		return
+	}
+
+	u := requestUser(r)
+
+	// Wrappers the user can't view are reported as not found so their IDs
+	// aren't revealed
+	source, exists := s.manager.GetConnection(req.Source)
+	if !exists || !u.Access(source).Allows(AccessView) {
+		http.Error(w, "Source wrapper not found", http.StatusNotFound)
+		return
+	}
+
+	target, exists := s.manager.GetConnection(req.Target)
+	if !exists || !u.Access(target).Allows(AccessView) {
+		http.Error(w, "Target wrapper not found", http.StatusNotFound)
+		return
+	}
+
+	// The target's world is replaced
+	if !u.Access(target).Allows(AccessOperate) {
+		s.httpError(w, r, "error.forbidden", http.StatusForbidden)
+		return
+	}
+
+	for _, wConn := range []*WrapperConnection{source, target} {
+		err := wConn.requireCapability(protocol.CapBackups)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", wConn.Name, err), http.StatusNotImplemented)
+			return
+		}
+	}
+
+	migration := &Migration{
+		MigrationRequest: req,
+		ID:               newMigrationID(),
+		Step:             MigrationSnapshot,
+		StartedAt:        time.Now().UTC(),
+	}
+
+	s.migrations.add(migration)
+
+	kind := "migration"
+	if req.Clone != nil {
+		kind = "clone"
+	}
+
+	description := fmt.Sprintf("%s to %s", source.Name, target.Name)
+
+	job := s.jobs.Start(kind, description, u.Name, func(ctx context.Context, h *jobs.Handle) error {
+		return s.runMigration(ctx, h, migration, source, target)
+	})
+
+	var started Migration
+
+	s.migrations.update(migration, func(m *Migration) {
+		m.Job = job.ID
+		started = *m
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+
+	err := json.NewEncoder(w).Encode(started)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// migrationAllowed reports whether the user may see a migration from source
+// to target: view the source and operate the target, as starting it takes.
+// Those of wrappers no longer configured are left to admins.
+func (s *CentralServer) migrationAllowed(u *User, source, target string) bool {
+	return s.backupAccess(u, source).Allows(AccessView) && s.backupAccess(u, target).Allows(AccessOperate)
+}
+
+// newMigrationID returns a random migration identifier.
+func newMigrationID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
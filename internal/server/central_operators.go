@@ -0,0 +1,279 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notify"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/operators"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+const (
+	// operatorsTimeout bounds checking or reconciling the permissions of a
+	// single wrapper.
+	operatorsTimeout = 10 * time.Second
+
+	// maxPermissionsSize limits the permissions.json read from a wrapper.
+	maxPermissionsSize = 1 << 20
+)
+
+// permissionsPath is the file API path of a wrapper's permissions.json.
+var permissionsPath = "/api/files?path=" + url.QueryEscape(operators.File)
+
+// OperatorDrift is how a wrapper's permissions.json differs from the
+// fleet's operator list.
+type OperatorDrift struct {
+	Wrapper   string         `json:"wrapper"`
+	Name      string         `json:"name"`
+	CheckedAt time.Time      `json:"checked_at"`
+	Drifted   bool           `json:"drifted"`
+	Diff      operators.Diff `json:"diff"`
+	Error     string         `json:"error,omitempty"` // Why the check failed
+}
+
+// CheckOperators compares the permissions.json of the connected wrappers
+// with the operator list, notifying when a wrapper starts to drift.
+func (m *ConnectionManager) CheckOperators() {
+	if m.operators == nil {
+		return
+	}
+
+	ops := m.operators.List()
+
+	for _, wConn := range m.ListConnections() {
+		if wConn.Status != StatusConnected || !wConn.Supports(protocol.CapFiles) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), operatorsTimeout)
+		drift := wConn.checkOperators(ctx, ops)
+		cancel()
+
+		previous := wConn.operatorDrift.Swap(&drift)
+
+		switch {
+		case drift.Error != "":
+			fmt.Printf("Error checking operators of wrapper %s: %s\n", wConn.ID, drift.Error)
+		case drift.Drifted && (previous == nil || !previous.Drifted):
+			fmt.Printf("Operators of wrapper %s drifted from the fleet list: %s\n", wConn.ID, drift.Diff)
+			wConn.alert(notify.SeverityWarning, "Operators drifted from the fleet list: "+drift.Diff.String())
+		}
+	}
+}
+
+// OperatorChecks periodically checks the wrappers for operator drift, until
+// the manager is shut down.
+func (m *ConnectionManager) OperatorChecks(interval time.Duration) {
+	if m.operators == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.CheckOperators()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// checkOperators compares the wrapper's permissions.json with the operators
+// wanted on it.
+func (w *WrapperConnection) checkOperators(ctx context.Context, ops []operators.Operator) OperatorDrift {
+	drift := OperatorDrift{Wrapper: w.ID, Name: w.Name, CheckedAt: time.Now().UTC()}
+
+	current, err := w.readPermissions(ctx)
+	if err != nil {
+		drift.Error = err.Error()
+		return drift
+	}
+
+	drift.Diff = operators.Compare(current, operators.Wanted(ops, w.Groups()))
+	drift.Drifted = !drift.Diff.Empty()
+
+	return drift
+}
+
+// readPermissions reads the wrapper's permissions.json. A missing one has
+// no entries.
+func (w *WrapperConnection) readPermissions(ctx context.Context) ([]operators.Entry, error) {
+	resp, err := w.apiRequest(ctx, http.MethodGet, permissionsPath, nil)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading permissions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPermissionsSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading permissions: %w", err)
+	}
+
+	return operators.Parse(data)
+}
+
+// reconcileOperators writes the operators wanted on the wrapper to its
+// permissions.json and has bedrock_server reload it.
+func (w *WrapperConnection) reconcileOperators(ctx context.Context, ops []operators.Operator) error {
+	err := w.requireCapability(protocol.CapFiles)
+	if err != nil {
+		return err
+	}
+
+	// Only write permissions that can be reloaded right away
+	if w.readOnly.Load() {
+		return ErrReadOnly
+	}
+
+	if w.Status != StatusConnected {
+		return fmt.Errorf("wrapper is not connected (status: %s)", w.Status)
+	}
+
+	data, err := json.MarshalIndent(operators.Wanted(ops, w.Groups()), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding permissions: %w", err)
+	}
+
+	resp, err := w.apiRequest(ctx, http.MethodPut, permissionsPath, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error writing permissions: %w", err)
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	err = w.SendMessage([]byte("permission reload"))
+	if err != nil {
+		return fmt.Errorf("permissions written, error reloading them: %w", err)
+	}
+
+	drift := w.checkOperators(ctx, ops)
+	w.operatorDrift.Store(&drift)
+
+	return nil
+}
+
+// handleOperators returns (GET) or replaces (PUT) the fleet's operator
+// list. Wrappers are checked for drift against a new list right away.
+func (s *CentralServer) handleOperators(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var ops []operators.Operator
+
+		err := json.NewDecoder(r.Body).Decode(&ops)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		_, err = s.manager.operators.Replace(ops)
+		if errors.Is(err, operators.ErrInvalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		go s.manager.CheckOperators()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(s.manager.operators.List())
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleOperatorDrift reports the last operator drift check of each wrapper
+// (GET, with ?refresh=true to check again first) and reconciles the wrapper
+// in ?wrapper=, or every drifted one without it (POST).
+func (s *CentralServer) handleOperatorDrift(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("refresh") == "true" {
+			s.manager.CheckOperators()
+		}
+	case http.MethodPost:
+		targets := s.manager.ListConnections()
+
+		if id := r.URL.Query().Get("wrapper"); id != "" {
+			wConn, exists := s.manager.GetConnection(id)
+			if !exists {
+				http.Error(w, "Wrapper not found", http.StatusNotFound)
+				return
+			}
+
+			targets = []*WrapperConnection{wConn}
+		}
+
+		ops := s.manager.operators.List()
+		user := requestUser(r)
+
+		for _, wConn := range targets {
+			drift := wConn.operatorDrift.Load()
+			if len(targets) > 1 && (drift == nil || !drift.Drifted) {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(withActor(r.Context(), user.Name), operatorsTimeout)
+			err := wConn.reconcileOperators(ctx, ops)
+			cancel()
+
+			if err != nil {
+				failed := OperatorDrift{Wrapper: wConn.ID, Name: wConn.Name, CheckedAt: time.Now().UTC(), Error: err.Error()}
+				if drift != nil {
+					failed.Drifted, failed.Diff = drift.Drifted, drift.Diff
+				}
+
+				wConn.operatorDrift.Store(&failed)
+
+				continue
+			}
+
+			fmt.Printf("Operators reconciled by %s on wrapper %s\n", user.Name, wConn.ID)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := []OperatorDrift{}
+
+	for _, wConn := range s.manager.ListConnections() {
+		if drift := wConn.operatorDrift.Load(); drift != nil {
+			report = append(report, *drift)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
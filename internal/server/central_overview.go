@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/raknet"
+)
+
+// serverPing is the result of pinging the server of a wrapper.
+type serverPing struct {
+	online bool
+	pong   raknet.Pong
+}
+
+// pingServers pings the servers of the connected wrappers concurrently, at
+// most pingWorkers at a time.
+func pingServers(conns []*WrapperConnection) []serverPing {
+	results := make([]serverPing, len(conns))
+
+	var (
+		addrs   []string
+		pending []int // Indexes in conns of addrs
+	)
+
+	for i, wConn := range conns {
+		if wConn.Status != StatusConnected {
+			continue
+		}
+
+		addr, err := wConn.pingAddress()
+		if err != nil {
+			continue
+		}
+
+		addrs = append(addrs, addr)
+		pending = append(pending, i)
+	}
+
+	for j, result := range raknet.PingMany(context.Background(), addrs, pingWorkers, pingOptions) {
+		pong, err := conns[pending[j]].pinged(result)
+		if err == nil {
+			results[pending[j]] = serverPing{online: true, pong: pong}
+		}
+	}
+
+	return results
+}
+
+// OverviewAlert is a problem with a wrapper that needs attention.
+type OverviewAlert struct {
+	Wrapper string            `json:"wrapper"`
+	Name    string            `json:"name"`
+	Labels  map[string]string `json:"labels,omitempty"` // Of the wrapper, to route the alert on
+	Message string            `json:"message"`
+}
+
+// Overview summarizes the wrappers a user can view.
+type Overview struct {
+	Wrappers      int            `json:"wrappers"`
+	Connected     int            `json:"connected"`
+	Erroring      int            `json:"erroring"`
+	ServersOnline int            `json:"servers_online"`
+	Players       int            `json:"players"`
+	MaxPlayers    int            `json:"max_players"`
+	Versions      map[string]int `json:"versions"` // Servers per version in use
+
+	// Servers behind the latest version, or the newest in use if unknown
+	PendingUpgrades int `json:"pending_upgrades"`
+
+	Alerts    []OverviewAlert `json:"alerts"` // Wrappers in error and violated invariants
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// compareVersions compares dotted version numbers such as 1.21.50.07,
+// returning -1, 0 or 1.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// overview builds the overview of the given wrappers.
+func overview(conns []*WrapperConnection, latest string) Overview {
+	o := Overview{
+		Wrappers:  len(conns),
+		Versions:  make(map[string]int),
+		Alerts:    []OverviewAlert{},
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	newest := latest
+
+	for i, ping := range pingServers(conns) {
+		wConn := conns[i]
+
+		switch wConn.Status {
+		case StatusConnected:
+			o.Connected++
+		case StatusError:
+			o.Erroring++
+			o.Alerts = append(o.Alerts, OverviewAlert{
+				Wrapper: wConn.ID,
+				Name:    wConn.Name,
+				Labels:  wConn.Labels(),
+				Message: wConn.Error,
+			})
+		}
+
+		for _, v := range wConn.checkInvariants() {
+			o.Alerts = append(o.Alerts, OverviewAlert{Wrapper: wConn.ID, Name: wConn.Name, Labels: wConn.Labels(), Message: v})
+		}
+
+		if drift := wConn.operatorDrift.Load(); drift != nil && drift.Drifted {
+			o.Alerts = append(o.Alerts, OverviewAlert{
+				Wrapper: wConn.ID,
+				Name:    wConn.Name,
+				Labels:  wConn.Labels(),
+				Message: "Operators drifted from the fleet list: " + drift.Diff.String(),
+			})
+		}
+
+		if !ping.online {
+			continue
+		}
+
+		o.ServersOnline++
+		o.Players += ping.pong.PlayerCount
+		o.MaxPlayers += ping.pong.MaxPlayerCount
+
+		version := ping.pong.VersionName
+		o.Versions[version]++
+
+		if compareVersions(version, newest) > 0 {
+			newest = version
+		}
+	}
+
+	for version, n := range o.Versions {
+		if compareVersions(version, newest) < 0 {
+			o.PendingUpgrades += n
+		}
+	}
+
+	return o
+}
+
+// handleOverview returns the overview of the wrappers the user can view, so
+// the dashboard header needs a single request.
+func (s *CentralServer) handleOverview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conns, err := s.visibleConnections(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Without the latest version, servers are compared with each other
+	latest, _ := s.latest.get()
+
+	err = json.NewEncoder(w).Encode(overview(conns, latest))
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
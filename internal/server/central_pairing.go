@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// handlePairing adds a wrapper with the one-time pairing code it printed,
+// which the wrapper exchanges for its shared key.
+func (s *CentralServer) handlePairing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+		Name string `json:"name"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	address, nonce, err := ParsePairingCode(req.Code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conns := s.manager.ListConnections()
+	if slices.ContainsFunc(conns, func(wConn *WrapperConnection) bool { return sameHost(wConn.Address, address) }) {
+		http.Error(w, "Wrapper already added", http.StatusConflict)
+		return
+	}
+
+	paired, err := pairWrapper(r.Context(), address, nonce)
+
+	switch {
+	case errors.Is(err, ErrPairingRejected):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = paired.Name
+	}
+
+	if name == "" {
+		u, _ := url.Parse(address)
+		name = u.Hostname()
+	}
+
+	wrapper := NewWrapper{
+		ID:        wrapperID(name, conns),
+		Name:      name,
+		Address:   address,
+		SharedKey: paired.SharedKey,
+	}
+
+	s.addWrapper(w, r, wrapper, "by pairing code")
+}
+
+// Errors redeeming a pairing code.
+var (
+	ErrPairingRejected = errors.New("the wrapper rejected the pairing code, open a new one")
+	ErrPairingDisabled = errors.New("pairing isn't enabled on the wrapper")
+)
+
+// pairWrapper redeems the nonce of a pairing code with the wrapper at
+// address for its shared key.
+func pairWrapper(ctx context.Context, address, nonce string) (PairResponse, error) {
+	body, err := json.Marshal(map[string]string{"nonce": nonce})
+	if err != nil {
+		return PairResponse{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+
+	candidate := &WrapperConnection{Address: address}
+
+	resp, err := candidate.apiRequest(ctx, http.MethodPost, "/api/pair", bytes.NewReader(body))
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.Status {
+		case http.StatusForbidden:
+			return PairResponse{}, ErrPairingRejected
+		case http.StatusNotFound:
+			return PairResponse{}, ErrPairingDisabled
+		}
+	}
+
+	if err != nil {
+		return PairResponse{}, fmt.Errorf("error reaching the wrapper: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var paired PairResponse
+
+	err = json.NewDecoder(resp.Body).Decode(&paired)
+	if err != nil || paired.SharedKey == "" {
+		return PairResponse{}, errors.New("invalid pairing response from the wrapper")
+	}
+
+	return paired, nil
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/mergepatch"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/preferences"
+)
+
+// handlePreferences returns (GET), replaces (PUT), merge-patches (PATCH) or
+// resets (DELETE) the web console settings of the user, kept on the central
+// server so they follow the user across devices.
+func (s *CentralServer) handlePreferences(w http.ResponseWriter, r *http.Request) {
+	u := requestUser(r)
+
+	if u.token != "" {
+		http.Error(w, "Preferences aren't available to API tokens", http.StatusForbidden)
+		return
+	}
+
+	p := s.preferences.Get(u.Name)
+
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		p = preferences.Preferences{}
+
+		err = json.NewDecoder(r.Body).Decode(&p)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		p, err = s.preferences.Set(u.Name, p)
+	case http.MethodPatch:
+		p, err = readPatch(r, p)
+		if err == nil {
+			p, err = s.preferences.Set(u.Name, p)
+		}
+	case http.MethodDelete:
+		p, err = s.preferences.Set(u.Name, preferences.Preferences{})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case errors.Is(err, preferences.ErrInvalid), errors.Is(err, mergepatch.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(p)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
@@ -0,0 +1,423 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/config"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/packs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/promote"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+// Promotion steps.
+const (
+	PromotionWaiting    = "waiting" // For the maintenance window
+	PromotionBackup     = "backup"
+	PromotionPacks      = "packs"
+	PromotionProperties = "properties"
+	PromotionRestart    = "restart"
+	PromotionDone       = "done"
+	PromotionFailed     = "failed"
+)
+
+const (
+	// promotionDiffTimeout bounds comparing staging with production.
+	promotionDiffTimeout = 30 * time.Second
+
+	// maxPropertiesSize limits the server.properties read from a wrapper.
+	maxPropertiesSize = 1 << 20
+)
+
+// propertiesPath is the file API path of a wrapper's server.properties.
+var propertiesPath = "/api/files?path=server.properties"
+
+// PromotionRequest is the body of a request to promote the packs and
+// settings of a staging server to production.
+type PromotionRequest struct {
+	Staging     string    `json:"staging"`      // Wrapper ID of the staging server
+	Production  string    `json:"production"`   // Wrapper ID of the production server
+	WindowStart time.Time `json:"window_start"` // Maintenance window to apply the changes in, right away if zero
+	WindowEnd   time.Time `json:"window_end"`   // Give up if the changes can't start before, no limit if zero
+	DryRun      bool      `json:"dry_run"`      // Only report the changes
+}
+
+// Promotion tracks a promotion from staging to production.
+type Promotion struct {
+	PromotionRequest
+
+	ID          string       `json:"id"`
+	Job         string       `json:"job,omitempty"` // ID of the job applying the promotion
+	Step        string       `json:"step,omitempty"`
+	Diff        promote.Diff `json:"diff"`             // As of the request, or as applied once done
+	Backup      string       `json:"backup,omitempty"` // Where production was backed up before the changes
+	Error       string       `json:"error,omitempty"`
+	StartedAt   time.Time    `json:"started_at"`
+	CompletedAt time.Time    `json:"completed_at,omitempty"`
+}
+
+// promotions holds the promotions started on the central server.
+type promotions struct {
+	items map[string]*Promotion
+	mu    sync.RWMutex
+}
+
+// list returns a copy of all promotions, newest first.
+func (p *promotions) list() []Promotion {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	list := make([]Promotion, 0, len(p.items))
+	for _, promotion := range p.items {
+		list = append(list, *promotion)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.After(list[j].StartedAt)
+	})
+
+	return list
+}
+
+// add registers a new promotion.
+func (p *promotions) add(promotion *Promotion) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.items == nil {
+		p.items = make(map[string]*Promotion)
+	}
+
+	p.items[promotion.ID] = promotion
+}
+
+// update applies a change to a promotion under the lock.
+func (p *promotions) update(promotion *Promotion, change func(*Promotion)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	change(promotion)
+}
+
+// readProperties reads the wrapper's server.properties.
+func (w *WrapperConnection) readProperties(ctx context.Context) ([]byte, error) {
+	resp, err := w.apiRequest(ctx, http.MethodGet, propertiesPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error reading server.properties: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPropertiesSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading server.properties: %w", err)
+	}
+
+	return data, nil
+}
+
+// promotionDiff compares the packs the staging world uses and the staging
+// settings with production.
+func promotionDiff(ctx context.Context, staging, production *WrapperConnection) (promote.Diff, error) {
+	var diff promote.Diff
+
+	var stagingPacks, productionPacks []InstalledPack
+
+	err := staging.apiCall(ctx, http.MethodGet, "/api/packs", nil, &stagingPacks)
+	if err != nil {
+		return diff, fmt.Errorf("error listing packs of %s: %w", staging.Name, err)
+	}
+
+	err = production.apiCall(ctx, http.MethodGet, "/api/packs", nil, &productionPacks)
+	if err != nil {
+		return diff, fmt.Errorf("error listing packs of %s: %w", production.Name, err)
+	}
+
+	var used, installed []packs.Pack
+
+	for _, p := range stagingPacks {
+		if p.Used {
+			used = append(used, p.Pack)
+		}
+	}
+
+	for _, p := range productionPacks {
+		installed = append(installed, p.Pack)
+	}
+
+	stagingProps, err := staging.readProperties(ctx)
+	if err != nil {
+		return diff, err
+	}
+
+	productionProps, err := production.readProperties(ctx)
+	if err != nil {
+		return diff, err
+	}
+
+	diff.Packs = promote.ComparePacks(used, installed)
+	diff.Properties = promote.CompareProperties(config.ParseProperties(stagingProps),
+		config.ParseProperties(productionProps))
+
+	return diff, nil
+}
+
+// runPromotion waits for the maintenance window, backs up production,
+// compares it with staging again, installs the new packs, sets the changed
+// properties and restarts production on them. It runs as a job; cancelling
+// it while waiting leaves production untouched.
+func (s *CentralServer) runPromotion(ctx context.Context, h *jobs.Handle, promotion *Promotion,
+	staging, production *WrapperConnection) error {
+	fail := func(err error) error {
+		fmt.Printf("Promotion %s failed: %v\n", promotion.ID, err)
+		s.promotions.update(promotion, func(p *Promotion) {
+			p.Error = err.Error()
+			p.Step = PromotionFailed
+			p.CompletedAt = time.Now().UTC()
+		})
+
+		return err
+	}
+
+	step := func(name string) {
+		s.promotions.update(promotion, func(p *Promotion) {
+			p.Step = name
+		})
+	}
+
+	if wait := time.Until(promotion.WindowStart); wait > 0 {
+		h.Logf("waiting for the maintenance window at %s", promotion.WindowStart.Format(time.RFC3339))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fail(ctx.Err())
+		}
+	}
+
+	if !promotion.WindowEnd.IsZero() && time.Now().After(promotion.WindowEnd) {
+		return fail(fmt.Errorf("the maintenance window ended at %s", promotion.WindowEnd.Format(time.RFC3339)))
+	}
+
+	if production.readOnly.Load() {
+		return fail(ErrReadOnly)
+	}
+
+	step(PromotionBackup)
+	h.Logf("backing up %s", production.Name)
+
+	backup, err := s.backup(ctx, production)
+	if err != nil {
+		return fail(fmt.Errorf("error backing up production: %w", err))
+	}
+
+	s.promotions.update(promotion, func(p *Promotion) {
+		p.Backup = backup
+	})
+
+	// Staging may have changed since the request
+	diff, err := promotionDiff(ctx, staging, production)
+	if err != nil {
+		return fail(err)
+	}
+
+	s.promotions.update(promotion, func(p *Promotion) {
+		p.Diff = diff
+	})
+
+	if diff.Empty() {
+		h.Logf("production already matches staging")
+		step(PromotionDone)
+		s.promotions.update(promotion, func(p *Promotion) {
+			p.CompletedAt = time.Now().UTC()
+		})
+
+		return nil
+	}
+
+	if len(diff.Packs) > 0 {
+		step(PromotionPacks)
+		h.Logf("copying %d packs", len(diff.Packs))
+
+		query := url.Values{}
+		for _, c := range diff.Packs {
+			query.Add("path", c.Pack.Kind+"_packs/"+c.Pack.Dir)
+		}
+
+		resp, err := staging.apiRequest(ctx, http.MethodGet, "/api/packs/export?"+query.Encode(), nil)
+		if err != nil {
+			return fail(fmt.Errorf("error exporting packs: %w", err))
+		}
+
+		err = production.apiCall(ctx, http.MethodPut, "/api/packs/import?wait=true", resp.Body, nil)
+		resp.Body.Close()
+
+		if err != nil {
+			return fail(fmt.Errorf("error importing packs: %w", err))
+		}
+	}
+
+	if len(diff.Properties) > 0 {
+		step(PromotionProperties)
+		h.Logf("setting %d properties", len(diff.Properties))
+
+		data, err := production.readProperties(ctx)
+		if err != nil {
+			return fail(err)
+		}
+
+		data = config.UpdateProperties(data, promote.Settings(diff.Properties))
+
+		err = production.apiCall(ctx, http.MethodPut, propertiesPath, bytes.NewReader(data), nil)
+		if err != nil {
+			return fail(fmt.Errorf("error writing server.properties: %w", err))
+		}
+	}
+
+	step(PromotionRestart)
+	h.Logf("restarting %s", production.Name)
+
+	// The wrapper starts the server again on the new packs and settings
+	err = production.SendMessage([]byte("stop"))
+	if err != nil {
+		return fail(fmt.Errorf("changes applied, error restarting production: %w", err))
+	}
+
+	s.promotions.update(promotion, func(p *Promotion) {
+		p.Step = PromotionDone
+		p.CompletedAt = time.Now().UTC()
+	})
+
+	return nil
+}
+
+// handlePromotions lists promotions (GET) or compares a staging server with
+// production and, unless dry_run, starts applying the changes (POST).
+// Production is backed up to the backup directory first, so promotions need
+// backups enabled.
+func (s *CentralServer) handlePromotions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		err := json.NewEncoder(w).Encode(s.promotions.list())
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+		}
+
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PromotionRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Staging == "" || req.Production == "" || req.Staging == req.Production {
+		http.Error(w, "Distinct staging and production wrapper IDs are required", http.StatusBadRequest)
+		return
+	}
+
+	if !req.WindowEnd.IsZero() && (!req.WindowEnd.After(req.WindowStart) || time.Now().After(req.WindowEnd)) {
+		http.Error(w, "The maintenance window must end after it starts and in the future", http.StatusBadRequest)
+		return
+	}
+
+	if !req.DryRun && s.backupDir == "" {
+		http.Error(w, "Backups are disabled, production can't be backed up before the changes", http.StatusBadRequest)
+		return
+	}
+
+	staging, exists := s.manager.GetConnection(req.Staging)
+	if !exists {
+		http.Error(w, "Staging wrapper not found", http.StatusNotFound)
+		return
+	}
+
+	production, exists := s.manager.GetConnection(req.Production)
+	if !exists {
+		http.Error(w, "Production wrapper not found", http.StatusNotFound)
+		return
+	}
+
+	for _, c := range []struct {
+		wConn *WrapperConnection
+		caps  []string
+	}{
+		{staging, []string{protocol.CapFiles}},
+		{production, []string{protocol.CapFiles, protocol.CapBackups}},
+	} {
+		for _, capability := range c.caps {
+			err := c.wConn.requireCapability(capability)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%s: %v", c.wConn.Name, err), http.StatusNotImplemented)
+				return
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), promotionDiffTimeout)
+	diff, err := promotionDiff(ctx, staging, production)
+	cancel()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	promotion := &Promotion{
+		PromotionRequest: req,
+		ID:               newMigrationID(),
+		Diff:             diff,
+		StartedAt:        time.Now().UTC(),
+	}
+
+	status := http.StatusOK
+
+	if !req.DryRun {
+		promotion.Step = PromotionWaiting
+		s.promotions.add(promotion)
+
+		description := fmt.Sprintf("%s to %s", staging.Name, production.Name)
+		user := requestUser(r).Name
+
+		job := s.jobs.Start("promotion", description, user, func(ctx context.Context, h *jobs.Handle) error {
+			return s.runPromotion(withActor(ctx, user), h, promotion, staging, production)
+		})
+
+		s.promotions.update(promotion, func(p *Promotion) {
+			p.Job = job.ID
+		})
+
+		fmt.Printf("Promotion of %s to %s started by %s\n", staging.ID, production.ID, user)
+
+		status = http.StatusAccepted
+	}
+
+	var started Promotion
+
+	s.promotions.update(promotion, func(p *Promotion) {
+		started = *p
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err = json.NewEncoder(w).Encode(started)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// relayDialTimeout bounds how long a wrapper has to open a connection it
+// was asked for on its relay link.
+const relayDialTimeout = 10 * time.Second
+
+// relayAddress is dialed for relayed wrappers configured without an address.
+// Its host is never resolved, connections go through the relay link.
+const relayAddress = "ws://relay/ws"
+
+// relayHub keeps the relay links wrappers opened to the central server and
+// hands out the connections opened through them.
+type relayHub struct {
+	mu      sync.Mutex
+	links   map[string]*relayLink    // By wrapper ID
+	pending map[string]chan net.Conn // By token of the connection asked for
+}
+
+// relayLink is the WebSocket a wrapper keeps open to be asked for
+// connections.
+type relayLink struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func newRelayHub() *relayHub {
+	return &relayHub{
+		links:   make(map[string]*relayLink),
+		pending: make(map[string]chan net.Conn),
+	}
+}
+
+// send writes a message on the link.
+func (l *relayLink) send(msg relayMessage, wait time.Duration) error {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	_ = l.conn.SetWriteDeadline(time.Now().Add(wait))
+
+	return l.conn.WriteJSON(msg)
+}
+
+// ping sends a keepalive ping on the link.
+func (l *relayLink) ping(wait time.Duration) error {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	return l.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wait))
+}
+
+// register makes link the relay link of the wrapper, closing the one it
+// replaces.
+func (h *relayHub) register(id string, link *relayLink) {
+	h.mu.Lock()
+	old := h.links[id]
+	h.links[id] = link
+	h.mu.Unlock()
+
+	if old != nil {
+		_ = old.conn.Close()
+	}
+}
+
+// unregister removes link unless it was replaced already.
+func (h *relayHub) unregister(id string, link *relayLink) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.links[id] == link {
+		delete(h.links, id)
+	}
+}
+
+// dial asks the wrapper on its relay link to open a connection and waits
+// for it.
+func (h *relayHub) dial(ctx context.Context, id string, wait time.Duration) (net.Conn, error) {
+	h.mu.Lock()
+	link := h.links[id]
+	h.mu.Unlock()
+
+	if link == nil {
+		return nil, fmt.Errorf("wrapper %s has no relay link", id)
+	}
+
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, fmt.Errorf("error generating relay token: %w", err)
+	}
+
+	token := hex.EncodeToString(b)
+	ch := make(chan net.Conn, 1)
+
+	h.mu.Lock()
+	h.pending[token] = ch
+	h.mu.Unlock()
+
+	err = link.send(relayMessage{Type: relayDial, Token: token}, wait)
+	if err != nil {
+		h.cancel(token, ch)
+		return nil, fmt.Errorf("error asking wrapper %s for a connection: %w", id, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, relayDialTimeout)
+	defer cancel()
+
+	select {
+	case conn := <-ch:
+		return conn, nil
+	case <-ctx.Done():
+		h.cancel(token, ch)
+		return nil, fmt.Errorf("error waiting for wrapper %s to connect through the relay: %w", id, ctx.Err())
+	}
+}
+
+// cancel gives up on a connection, closing it if it arrived meanwhile.
+func (h *relayHub) cancel(token string, ch chan net.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.pending[token]; ok {
+		delete(h.pending, token)
+		return
+	}
+
+	// Claimed, so the connection is in the channel already
+	_ = (<-ch).Close()
+}
+
+// claim hands the connection opened for token to the one waiting for it,
+// reporting false if nobody is.
+func (h *relayHub) claim(token string, conn net.Conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch, ok := h.pending[token]
+	if !ok {
+		return false
+	}
+
+	delete(h.pending, token)
+	ch <- conn
+
+	return true
+}
+
+// waiting reports whether a connection is asked for with token.
+func (h *relayHub) waiting(token string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, ok := h.pending[token]
+
+	return ok
+}
+
+// dialContext dials the wrapper through the relay, for HTTP and WebSocket
+// clients.
+func (h *relayHub) dialContext(
+	id string, wait time.Duration,
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return h.dial(ctx, id, wait)
+	}
+}
+
+// relayWrapper returns the relayed wrapper a relay request is from, checking
+// its shared key.
+func (s *CentralServer) relayWrapper(r *http.Request) (*WrapperConnection, bool) {
+	wConn, ok := s.manager.GetConnection(r.URL.Query().Get("wrapper"))
+	if !ok || wConn.relay == nil || wConn.SharedKey == "" {
+		return nil, false
+	}
+
+	key := r.Header.Get("X-Auth-Key")
+
+	return wConn, subtle.ConstantTimeCompare([]byte(key), []byte(wConn.SharedKey)) == 1
+}
+
+// handleRelay keeps the relay link of a wrapper the central server can't
+// connect to, such as one behind CGNAT.
+func (s *CentralServer) handleRelay(w http.ResponseWriter, r *http.Request) {
+	wConn, ok := s.relayWrapper(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Printf("Error upgrading relay link: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	keepalive := s.manager.keepalive
+	link := &relayLink{conn: conn}
+
+	s.manager.relay.register(wConn.ID, link)
+	defer s.manager.relay.unregister(wConn.ID, link)
+
+	fmt.Printf("Relay link from wrapper %s (%s) established\n", wConn.ID, r.RemoteAddr)
+
+	// Connect now rather than at the next retry
+	_ = wConn.Retry()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(keepalive.PingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if link.ping(keepalive.WriteWait) != nil {
+					_ = conn.Close()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(keepalive.PongWait))
+
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(keepalive.PongWait))
+	})
+
+	for {
+		_, _, err := conn.ReadMessage()
+		if err != nil {
+			fmt.Printf("Relay link from wrapper %s lost: %v\n", wConn.ID, err)
+			return
+		}
+	}
+}
+
+// handleRelayAccept takes a connection a wrapper opened because it was
+// asked to on its relay link.
+func (s *CentralServer) handleRelayAccept(w http.ResponseWriter, r *http.Request) {
+	_, ok := s.relayWrapper(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if !s.manager.relay.waiting(token) {
+		http.Error(w, "No connection asked for", http.StatusNotFound)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Printf("Error upgrading relayed connection: %v\n", err)
+		return
+	}
+
+	stream := wsStream(conn)
+	if !s.manager.relay.claim(token, stream) {
+		_ = stream.Close()
+	}
+}
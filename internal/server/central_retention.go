@@ -0,0 +1,418 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notify"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/retention"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/transfer"
+)
+
+const (
+	// retentionActor starts the backups due under backup policies.
+	retentionActor = "retention"
+
+	// retentionRetry is the wait before a failed policy backup is tried
+	// again.
+	retentionRetry = 30 * time.Minute
+)
+
+// PolicyCompliance is whether a wrapper had a successful backup within its
+// backup policy.
+type PolicyCompliance struct {
+	Wrapper    string    `json:"wrapper"`
+	Name       string    `json:"name"`
+	Policy     string    `json:"policy,omitempty"` // None is assigned if empty
+	Backups    int       `json:"backups"`
+	LastBackup time.Time `json:"last_backup,omitempty"`
+	NextDue    time.Time `json:"next_due,omitempty"`
+	Compliant  bool      `json:"compliant"`         // Always true without a policy
+	Error      string    `json:"error,omitempty"`   // Of the last policy backup, if it failed
+	Offsite    int       `json:"offsite,omitempty"` // Backups copied off-site
+}
+
+// policyRun is what the central server knows of the policy backups of a
+// wrapper between checks.
+type policyRun struct {
+	running   bool
+	attempt   time.Time // Last policy backup started
+	err       string    // Why it failed, if it did
+	compliant bool      // At the last check, to notify once when it lapses
+}
+
+// policyRuns holds the policy backup state of each wrapper.
+type policyRuns struct {
+	mu    sync.Mutex
+	items map[string]*policyRun
+}
+
+// get returns the state of a wrapper and whether it was seen before, under
+// the lock.
+func (p *policyRuns) get(id string) (*policyRun, bool) {
+	if p.items == nil {
+		p.items = make(map[string]*policyRun)
+	}
+
+	run, ok := p.items[id]
+	if !ok {
+		run = &policyRun{}
+		p.items[id] = run
+	}
+
+	return run, ok
+}
+
+// wrapperBackups returns the backups of a wrapper, the newest taken first.
+func (s *CentralServer) wrapperBackups(id string) []transfer.Record {
+	records := s.backupIndex.List(id)
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].CreatedAt.After(records[j].CreatedAt)
+	})
+
+	return records
+}
+
+// lastBackup returns when the newest backup of a wrapper was taken and how
+// many it has.
+func (s *CentralServer) lastBackup(id string) (time.Time, int) {
+	records := s.wrapperBackups(id)
+	if len(records) == 0 {
+		return time.Time{}, 0
+	}
+
+	return records[0].CreatedAt, len(records)
+}
+
+// BackupPolicies backs up the wrappers due under their backup policy as a
+// fleet job, copies their backups off-site and prunes them to the policy's
+// retention, checking every interval until the manager is shut down.
+// Wrappers that fall out of compliance are notified once.
+func (s *CentralServer) BackupPolicies(interval time.Duration) {
+	if s.retention == nil || s.backupIndex == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.applyPolicies(time.Now())
+		case <-s.manager.stop:
+			return
+		}
+	}
+}
+
+// applyPolicies starts the backups due under the backup policies and keeps
+// the stored backups in line with them.
+func (s *CentralServer) applyPolicies(now time.Time) {
+	policies := s.retention.List()
+
+	var targets []JobTarget
+
+	conns := map[string]*WrapperConnection{}
+	assigned := map[string]retention.Policy{}
+
+	for _, wConn := range s.manager.ListConnections() {
+		p, ok := retention.Assigned(policies, wConn.ID, wConn.Groups())
+		if !ok {
+			continue
+		}
+
+		s.keepBackups(p, wConn.ID, now)
+
+		last, _ := s.lastBackup(wConn.ID)
+		compliant := p.Compliant(last, now)
+
+		s.policyRuns.mu.Lock()
+		run, seen := s.policyRuns.get(wConn.ID)
+		lapsed := seen && run.compliant && !compliant
+		run.compliant = compliant
+		due := p.Due(last, now) && !run.running && now.Sub(run.attempt) >= retentionRetry
+		s.policyRuns.mu.Unlock()
+
+		if lapsed {
+			fmt.Printf("Wrapper %s has no backup within policy %s\n", wConn.ID, p.Name)
+			wConn.alert(notify.SeverityWarning,
+				fmt.Sprintf("No successful backup within backup policy %s (every %d hours)", p.Name, p.EveryHours))
+		}
+
+		if !due || wConn.Status != StatusConnected || !wConn.Supports(protocol.CapBackups) {
+			continue
+		}
+
+		targets = append(targets, JobTarget{Wrapper: wConn.ID, Name: wConn.Name, State: JobQueued})
+		conns[wConn.ID] = wConn
+		assigned[wConn.ID] = p
+	}
+
+	if len(targets) == 0 {
+		return
+	}
+
+	s.policyRuns.mu.Lock()
+	for id := range conns {
+		run, _ := s.policyRuns.get(id)
+		run.running = true
+		run.attempt = now
+	}
+	s.policyRuns.mu.Unlock()
+
+	work := func(ctx context.Context, wConn *WrapperConnection) (string, error) {
+		p := assigned[wConn.ID]
+
+		path, err := s.backup(ctx, wConn)
+
+		s.policyRuns.mu.Lock()
+		run, _ := s.policyRuns.get(wConn.ID)
+		run.running = false
+		run.err = ""
+		if err != nil {
+			run.err = err.Error()
+		}
+		s.policyRuns.mu.Unlock()
+
+		if err != nil {
+			wConn.alert(notify.SeverityWarning, fmt.Sprintf("Backup under policy %s failed: %v", p.Name, err))
+			return "", err
+		}
+
+		s.keepBackups(p, wConn.ID, time.Now())
+
+		return path, nil
+	}
+
+	description := fmt.Sprintf("%d wrapper(s) due under backup policies", len(targets))
+
+	job := s.jobs.Start(JobBackup, description, retentionActor, func(ctx context.Context, h *jobs.Handle) error {
+		return s.runFleetJob(ctx, h, retentionActor, targets, conns, work)
+	})
+
+	fmt.Printf("Job %s (%s) started by %s on %d wrapper(s)\n", job.ID, JobBackup, retentionActor, len(conns))
+}
+
+// keepBackups copies the backups of a wrapper off-site, if the policy has
+// an off-site target, and removes those past its retention, both from the
+// backup directory and off-site.
+func (s *CentralServer) keepBackups(p retention.Policy, id string, now time.Time) {
+	for i, record := range s.wrapperBackups(id) {
+		if p.Expired(i, record.CreatedAt, now) {
+			s.removeBackup(record)
+			continue
+		}
+
+		if p.Offsite == "" || record.Offsite != "" {
+			continue
+		}
+
+		dest := filepath.Join(p.Offsite, filepath.FromSlash(record.Path))
+
+		err := copyBackup(filepath.Join(s.backupDir, filepath.FromSlash(record.Path)), dest, record.SHA256)
+		if err != nil {
+			fmt.Printf("Error copying backup %s off-site: %v\n", record.Path, err)
+			continue
+		}
+
+		record.Offsite = dest
+
+		err = s.backupIndex.Add(record)
+		if err != nil {
+			fmt.Printf("Error recording backup: %v\n", err)
+		}
+	}
+}
+
+// removeBackup removes a backup past its retention, with its off-site copy.
+func (s *CentralServer) removeBackup(record transfer.Record) {
+	for _, path := range []string{filepath.Join(s.backupDir, filepath.FromSlash(record.Path)), record.Offsite} {
+		if path == "" {
+			continue
+		}
+
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error removing backup %s: %v\n", path, err)
+			return
+		}
+	}
+
+	err := s.backupIndex.Remove(record.Path)
+	if err != nil {
+		fmt.Printf("Error recording backup removal: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Backup %s of wrapper %s removed by its retention policy\n", record.Path, record.Wrapper)
+}
+
+// copyBackup copies a backup to dest, checking the copy has the SHA-256
+// recorded for it, if any.
+func copyBackup(path, dest, sha string) error {
+	src, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	err = os.MkdirAll(filepath.Dir(dest), 0750)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Clean up if the rename didn't happen
+
+	sum := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(tmp, sum), src)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if got := hex.EncodeToString(sum.Sum(nil)); sha != "" && got != sha {
+		return fmt.Errorf("%w: SHA-256 of the copy is %s, expected %s", transfer.ErrChecksum, got, sha)
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
+
+// handleBackupPolicies lists the backup policies (GET), adds or replaces one
+// (PUT) or removes the one in ?name= (DELETE). Backups are left alone when
+// a policy is removed.
+func (s *CentralServer) handleBackupPolicies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var p retention.Policy
+
+		err := json.NewDecoder(r.Body).Decode(&p)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		_, err = s.retention.Put(p)
+		if errors.Is(err, retention.ErrInvalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Printf("Backup policy %s saved by %s\n", p.Name, requestUser(r).Name)
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+
+		err := s.retention.Delete(name)
+		if errors.Is(err, retention.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Printf("Backup policy %s removed by %s\n", name, requestUser(r).Name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(s.retention.List())
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleBackupCompliance reports, for each wrapper the user can see,
+// whether it had a successful backup within its backup policy. Wrappers
+// without a policy are listed too, so they stand out.
+func (s *CentralServer) handleBackupCompliance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u := requestUser(r)
+	policies := s.retention.List()
+	now := time.Now()
+
+	report := []PolicyCompliance{}
+
+	for _, wConn := range s.manager.ListConnections() {
+		if !u.Access(wConn).Allows(AccessView) {
+			continue
+		}
+
+		c := PolicyCompliance{Wrapper: wConn.ID, Name: wConn.Name, Compliant: true}
+		c.LastBackup, c.Backups = s.lastBackup(wConn.ID)
+
+		for _, record := range s.backupIndex.List(wConn.ID) {
+			if record.Offsite != "" {
+				c.Offsite++
+			}
+		}
+
+		if p, ok := retention.Assigned(policies, wConn.ID, wConn.Groups()); ok {
+			c.Policy = p.Name
+			c.Compliant = p.Compliant(c.LastBackup, now)
+			c.NextDue = now
+
+			if !c.LastBackup.IsZero() {
+				c.NextDue = c.LastBackup.Add(p.Interval())
+			}
+
+			s.policyRuns.mu.Lock()
+			if run, ok := s.policyRuns.items[wConn.ID]; ok {
+				c.Error = run.err
+			}
+			s.policyRuns.mu.Unlock()
+		}
+
+		report = append(report, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
@@ -0,0 +1,413 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/tokens"
+)
+
+const (
+	// sessionPrefix marks keys that are browser sessions
+	sessionPrefix = "mcs_"
+
+	sessionLifetime = 12 * time.Hour
+)
+
+// Session types.
+const (
+	SessionBrowser = "session"
+	SessionToken   = "token"
+)
+
+// Session is an active browser session or API token in session listings.
+type Session struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	User      string    `json:"user"`
+	Name      string    `json:"name,omitempty"` // Token name
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	LastSeen  time.Time `json:"last_seen,omitempty"`
+	LastIP    string    `json:"last_ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Verified  bool      `json:"two_factor_verified,omitempty"`
+	Language  string    `json:"language,omitempty"` // Language picked for the web console
+	Current   bool      `json:"current,omitempty"`  // The session of the listing request
+}
+
+// CreatedSession is a new session with its key, which is only shown once,
+// and the CSRF token for requests authenticated with the session cookie.
+type CreatedSession struct {
+	Session
+
+	Token     string `json:"token"`
+	CSRFToken string `json:"csrf_token"`
+}
+
+// session is a browser session. Sessions are kept in memory, so everyone
+// signs in again after the central server restarts.
+type session struct {
+	Session
+
+	master bool   // Signed in with the master auth key
+	csrf   string // Token cookie-authenticated requests must carry
+}
+
+// sessionStore tracks browser sessions by the hash of their key.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]*session)}
+}
+
+func hashSession(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientIP returns the IP address a request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// create starts a session for user from the client of r.
+func (t *sessionStore) create(user string, master, verified bool, r *http.Request) (CreatedSession, error) {
+	b := make([]byte, 48)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return CreatedSession{}, fmt.Errorf("error generating session: %w", err)
+	}
+
+	key := sessionPrefix + hex.EncodeToString(b[:24])
+	h := hashSession(key)
+	now := time.Now().UTC()
+
+	sess := &session{
+		Session: Session{
+			ID:        h[:16],
+			Type:      SessionBrowser,
+			User:      user,
+			CreatedAt: now,
+			ExpiresAt: now.Add(sessionLifetime),
+			LastSeen:  now,
+			LastIP:    clientIP(r),
+			UserAgent: r.UserAgent(),
+			Verified:  verified,
+		},
+		master: master,
+		csrf:   hex.EncodeToString(b[24:]),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for h, s := range t.sessions {
+		if now.After(s.ExpiresAt) {
+			delete(t.sessions, h)
+		}
+	}
+
+	t.sessions[h] = sess
+
+	return CreatedSession{Session: sess.Session, Token: key, CSRFToken: sess.csrf}, nil
+}
+
+// lookup returns the session of a key.
+func (t *sessionStore) lookup(key string) (session, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[hashSession(key)]
+	if !ok || time.Now().After(s.ExpiresAt) {
+		return session{}, false
+	}
+
+	return *s, true
+}
+
+// seen records a request made with a session.
+func (t *sessionStore) seen(id string, r *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.sessions {
+		if s.ID == id {
+			s.LastSeen = time.Now().UTC()
+			s.LastIP = clientIP(r)
+			s.UserAgent = r.UserAgent()
+
+			return
+		}
+	}
+}
+
+// setLanguage stores the language picked in the session with an ID.
+func (t *sessionStore) setLanguage(id, lang string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.sessions {
+		if s.ID == id {
+			s.Language = lang
+			return true
+		}
+	}
+
+	return false
+}
+
+// csrfToken returns the CSRF token of the session with an ID.
+func (t *sessionStore) csrfToken(id string) (string, bool) {
+	if id == "" {
+		return "", false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.sessions {
+		if s.ID == id {
+			return s.csrf, true
+		}
+	}
+
+	return "", false
+}
+
+// get returns the session with an ID.
+func (t *sessionStore) get(id string) (Session, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.sessions {
+		if s.ID == id {
+			return s.Session, true
+		}
+	}
+
+	return Session{}, false
+}
+
+// list returns the active sessions.
+func (t *sessionStore) list() []Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	list := make([]Session, 0, len(t.sessions))
+
+	for _, s := range t.sessions {
+		if now.Before(s.ExpiresAt) {
+			list = append(list, s.Session)
+		}
+	}
+
+	return list
+}
+
+// revoke ends the session with an ID.
+func (t *sessionStore) revoke(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for h, s := range t.sessions {
+		if s.ID == id {
+			delete(t.sessions, h)
+			return true
+		}
+	}
+
+	return false
+}
+
+// revokeUser ends all sessions of a user.
+func (t *sessionStore) revokeUser(user string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for h, s := range t.sessions {
+		if s.User == user && !s.master {
+			delete(t.sessions, h)
+		}
+	}
+}
+
+// sessionUser returns the user a session acts as. Users who need a second
+// factor only get view access until the session is verified.
+func (s *CentralServer) sessionUser(sess session) (*User, bool) {
+	var u User
+
+	if sess.master {
+		u = User{Name: sess.User, Admin: true}
+	} else {
+		account, ok := s.accountUser(sess.User)
+		if !ok {
+			return nil, false
+		}
+
+		u = *account
+		u.verified = sess.Verified
+
+		if s.twoFactor != nil && u.RequiresTwoFactor() && !sess.Verified {
+			u = *u.viewOnly()
+		}
+	}
+
+	u.session = sess.ID
+	u.language = sess.Language
+
+	return &u, true
+}
+
+// handleSessions lists (GET) the active browser sessions and API tokens,
+// signs in (POST, returning a session key to use instead of the user's key,
+// also set as a cookie) or revokes (DELETE ?id=, or the current session
+// without one) them. Users see their own; admins see everyone's and can
+// filter with ?user=.
+func (s *CentralServer) handleSessions(w http.ResponseWriter, r *http.Request) {
+	u := requestUser(r)
+
+	if u.token != "" {
+		http.Error(w, "Sessions aren't available to API tokens", http.StatusForbidden)
+		return
+	}
+
+	var result interface{}
+
+	switch r.Method {
+	case http.MethodGet:
+		user := r.URL.Query().Get("user")
+		if !u.Admin {
+			user = u.Name
+		}
+
+		result = s.listSessions(user, u.session)
+	case http.MethodPost:
+		created, err := s.sessions.create(u.Name, !u.account, u.verified, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		setSessionCookie(w, r, created)
+		w.WriteHeader(http.StatusCreated)
+
+		result = created
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" || id == u.session {
+			id = u.session
+			clearSessionCookie(w, r)
+		}
+
+		err := s.revokeSession(u, id)
+		if errors.Is(err, tokens.ErrNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// listSessions returns the browser sessions and API tokens of user, or of
+// everyone if user is empty, newest first.
+func (s *CentralServer) listSessions(user, current string) []Session {
+	list := []Session{}
+
+	for _, sess := range s.sessions.list() {
+		if user == "" || sess.User == user {
+			sess.Current = sess.ID == current
+			list = append(list, sess)
+		}
+	}
+
+	if s.tokens != nil {
+		now := time.Now()
+
+		for _, t := range s.tokens.List() {
+			if t.Expired(now) || (user != "" && t.CreatedBy != user) {
+				continue
+			}
+
+			list = append(list, Session{
+				ID:        t.ID,
+				Type:      SessionToken,
+				User:      t.CreatedBy,
+				Name:      t.Name,
+				CreatedAt: t.CreatedAt,
+				ExpiresAt: t.ExpiresAt,
+				LastSeen:  t.LastUsed,
+				LastIP:    t.LastIP,
+				UserAgent: t.LastUserAgent,
+			})
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+
+	return list
+}
+
+// revokeSession ends a browser session or revokes an API token. Users may
+// only revoke their own; other users' sessions are reported as not found.
+func (s *CentralServer) revokeSession(u *User, id string) error {
+	sess, ok := s.sessions.get(id)
+	if ok {
+		if !u.Admin && sess.User != u.Name {
+			return tokens.ErrNotFound
+		}
+
+		s.sessions.revoke(id)
+
+		return nil
+	}
+
+	if s.tokens == nil {
+		return tokens.ErrNotFound
+	}
+
+	for _, t := range s.tokens.List() {
+		if t.ID == id && (u.Admin || t.CreatedBy == u.Name) {
+			return s.tokens.Revoke(id)
+		}
+	}
+
+	return tokens.ErrNotFound
+}
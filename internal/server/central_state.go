@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/centralstate"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+const (
+	// maxStateArchiveSize bounds an imported state archive.
+	maxStateArchiveSize = 512 << 20
+
+	// stateScheduleTimeout bounds reading or restoring the schedules of a
+	// wrapper.
+	stateScheduleTimeout = 30 * time.Second
+)
+
+// StateImport is the result of a state import.
+type StateImport struct {
+	Manifest  centralstate.Manifest `json:"manifest"`
+	Schedules map[string]int        `json:"schedules,omitempty"` // Schedules restored on each wrapper
+	Errors    []string              `json:"errors,omitempty"`    // Wrappers whose schedules couldn't be restored
+	Restart   bool                  `json:"restart"`             // Whether the central server is restarting to apply it
+}
+
+// handleStateExport downloads an archive of the central configuration, its
+// data directory (tokens, macros, two-factor enrollments, deny list and
+// reports) and the schedules of the connected wrappers. It holds every key
+// and secret, so only admins can download it.
+func (s *CentralServer) handleStateExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	archive, err := centralstate.Collect(s.configPath, s.dataDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, wConn := range s.manager.ListConnections() {
+		schedules, err := wConn.exportSchedules(r.Context())
+		if err != nil {
+			fmt.Printf("Not exporting the schedules of wrapper %s: %v\n", wConn.ID, err)
+			continue
+		}
+
+		archive.Schedules[wConn.ID] = schedules
+	}
+
+	now := time.Now().UTC()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", "central-state-"+now.Format("20060102-150405")+".zip"))
+
+	err = archive.Write(w, s.manager.hello.Version, now)
+	if err != nil {
+		// Headers are already sent, the truncated archive fails to import
+		fmt.Printf("Error writing state archive: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Central state exported by %s\n", requestUser(r).Name)
+}
+
+// handleStateImport stages an archive written by handleStateExport to
+// replace the configuration and data directory when the central server
+// starts again. With schedules=true the schedules in the archive are
+// restored on the connected wrappers right away, and with restart=true the
+// central server shuts down so its supervisor starts it again.
+func (s *CentralServer) handleStateImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxStateArchiveSize))
+	if err != nil {
+		http.Error(w, "Archive too large or unreadable", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	archive, err := centralstate.Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := StateImport{Manifest: archive.Manifest}
+
+	if r.URL.Query().Get("schedules") == "true" {
+		result.Schedules = make(map[string]int)
+
+		for id, schedules := range archive.Schedules {
+			wConn, exists := s.manager.GetConnection(id)
+			if !exists {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: wrapper not found", id))
+				continue
+			}
+
+			restored, err := wConn.importSchedules(withActor(r.Context(), requestUser(r).Name), schedules)
+			result.Schedules[id] = restored
+
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", id, err))
+			}
+		}
+	}
+
+	err = archive.Stage(s.dataDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result.Restart = r.URL.Query().Get("restart") == "true" && s.restart != nil
+
+	fmt.Printf("Central state from %s staged by %s, applied on the next start\n",
+		archive.Manifest.Created.Format(time.RFC3339), requestUser(r).Name)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+
+	if result.Restart {
+		s.restart()
+	}
+}
+
+// exportSchedules returns the schedules of the wrapper as a JSON array.
+func (w *WrapperConnection) exportSchedules(ctx context.Context) (json.RawMessage, error) {
+	err := w.requireCapability(protocol.CapSchedules)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, stateScheduleTimeout)
+	defer cancel()
+
+	resp, err := w.apiRequest(ctx, http.MethodGet, "/api/schedules", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Schedules json.RawMessage `json:"schedules"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedules response: %w", err)
+	}
+
+	return result.Schedules, nil
+}
+
+// importSchedules saves schedules on the wrapper and returns how many were
+// restored. Schedules the wrapper doesn't have yet are added with a new ID.
+func (w *WrapperConnection) importSchedules(ctx context.Context, schedules json.RawMessage) (int, error) {
+	err := w.requireCapability(protocol.CapSchedules)
+	if err != nil {
+		return 0, err
+	}
+
+	var list []map[string]any
+
+	err = json.Unmarshal(schedules, &list)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schedules: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, stateScheduleTimeout)
+	defer cancel()
+
+	restored := 0
+
+	for _, sc := range list {
+		err = w.putSchedule(ctx, sc)
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			delete(sc, "id")
+			err = w.putSchedule(ctx, sc)
+		}
+
+		if err != nil {
+			return restored, fmt.Errorf("schedule %v: %w", sc["name"], err)
+		}
+
+		restored++
+	}
+
+	return restored, nil
+}
+
+// putSchedule saves a schedule on the wrapper.
+func (w *WrapperConnection) putSchedule(ctx context.Context, sc map[string]any) error {
+	body, err := json.Marshal(sc)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.apiRequest(ctx, http.MethodPost, "/api/schedules", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/timeline"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/uptime"
+)
+
+const (
+	// defaultTimelineDays is how far back the timeline goes unless asked.
+	defaultTimelineDays = 7
+
+	// defaultTimelineLimit caps the events returned unless asked.
+	defaultTimelineLimit = 1000
+)
+
+// recordEvent adds an event about the wrapper to the fleet timeline.
+func (w *WrapperConnection) recordEvent(e timeline.Event) {
+	e.Wrapper = w.ID
+	e.Name = w.Name
+
+	w.timeline.Record(e)
+}
+
+// alert raises a notification about the wrapper and records it in the fleet
+// timeline.
+func (w *WrapperConnection) alert(severity, text string) {
+	w.recordEvent(timeline.Event{Type: timeline.TypeAlert, Severity: severity, Text: text})
+	w.notifications.notify(severity, w.Name, text)
+}
+
+// frameTime returns when a console line was logged, zero if the wrapper
+// didn't say.
+func frameTime(frame protocol.Frame) time.Time {
+	switch {
+	case frame.Logged != nil:
+		return *frame.Logged
+	case frame.Time != nil:
+		return *frame.Time
+	}
+
+	return time.Time{}
+}
+
+// observeTimeline records the server starting or being told to stop, by the
+// console line saying so.
+func (w *WrapperConnection) observeTimeline(frame protocol.Frame) {
+	switch {
+	case strings.Contains(frame.Text, startedLine):
+		w.recordEvent(timeline.Event{Time: frameTime(frame), Type: timeline.TypeStart, Text: "Server started"})
+	case strings.Contains(frame.Text, stopLine):
+		w.recordEvent(timeline.Event{Time: frameTime(frame), Type: timeline.TypeStop, Text: "Server stopping"})
+	}
+}
+
+// observeSample records a crash when the server stops answering pings
+// without being told to stop, and an upgrade when it answers with a new
+// version. version is empty when it's down.
+func (w *WrapperConnection) observeSample(now time.Time, up bool, version string) {
+	if w.sampled && w.wasUp && !up && w.Status == StatusConnected && w.downCause(now) != uptime.CauseManualStop {
+		w.recordEvent(timeline.Event{
+			Time: now,
+			Type: timeline.TypeCrash,
+			Text: "Server stopped answering without being told to stop",
+		})
+	}
+
+	if up && w.lastVersion != "" && version != w.lastVersion {
+		w.recordEvent(timeline.Event{
+			Time: now,
+			Type: timeline.TypeUpgrade,
+			Text: fmt.Sprintf("Bedrock %s → %s", w.lastVersion, version),
+		})
+	}
+
+	if up {
+		w.lastVersion = version
+	}
+
+	w.sampled = true
+	w.wasUp = up
+}
+
+// observeHello records an upgrade when the wrapper reconnects on a new
+// version.
+func (w *WrapperConnection) observeHello(old, hello *protocol.Hello) {
+	if old == nil || hello == nil || old.Version == hello.Version {
+		return
+	}
+
+	w.recordEvent(timeline.Event{
+		Type: timeline.TypeUpgrade,
+		Text: fmt.Sprintf("Wrapper %s → %s", old.Version, hello.Version),
+	})
+}
+
+// parseTimelineFilter reads a timeline filter from the query: the last
+// ?days= (7 by default) or ?from= to ?to= in RFC 3339, ?type= and ?wrapper=
+// as comma-separated lists, ?actor=, ?q= for text and ?limit=.
+func parseTimelineFilter(r *http.Request) (timeline.Filter, error) {
+	query := r.URL.Query()
+	f := timeline.Filter{Actor: query.Get("actor"), Query: query.Get("q"), Limit: defaultTimelineLimit}
+
+	days := defaultTimelineDays
+
+	if value := query.Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return f, fmt.Errorf("invalid days")
+		}
+
+		days = n
+	}
+
+	f.From = time.Now().AddDate(0, 0, -days)
+
+	for name, t := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s, expected RFC 3339", name)
+		}
+
+		*t = parsed
+	}
+
+	if value := query.Get("type"); value != "" {
+		f.Types = strings.Split(value, ",")
+
+		for _, typ := range f.Types {
+			if !slices.Contains(timeline.Types, typ) {
+				return f, fmt.Errorf("unknown type %q", typ)
+			}
+		}
+	}
+
+	if value := query.Get("wrapper"); value != "" {
+		f.Wrappers = strings.Split(value, ",")
+	}
+
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return f, fmt.Errorf("invalid limit")
+		}
+
+		f.Limit = n
+	}
+
+	return f, nil
+}
+
+// handleTimeline returns the significant events across the wrappers the user
+// may view, newest first: starts, stops, crashes, upgrades, backups, alerts
+// and console commands.
+func (s *CentralServer) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	f, err := parseTimelineFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events := []timeline.Event{}
+
+	u := requestUser(r)
+	if !u.Admin {
+		// Events of removed wrappers are only shown to administrators
+		visible := []string{}
+
+		for _, wConn := range s.manager.ListConnections() {
+			if u.Access(wConn).Allows(AccessView) && (len(f.Wrappers) == 0 || slices.Contains(f.Wrappers, wConn.ID)) {
+				visible = append(visible, wConn.ID)
+			}
+		}
+
+		f.Wrappers = visible
+	}
+
+	if u.Admin || len(f.Wrappers) > 0 {
+		events = s.manager.timeline.List(f)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(events)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
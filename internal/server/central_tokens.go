@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/tokens"
+)
+
+// TokenRequest is the body of a request to create an API token. Expiry is
+// either a Go duration in ExpiresIn or a time in ExpiresAt; tokens without
+// either never expire.
+type TokenRequest struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	Wrappers  []string  `json:"wrappers,omitempty"`
+	ExpiresIn string    `json:"expires_in,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// CreatedToken is a new token with its secret, which is only shown once.
+type CreatedToken struct {
+	tokens.Token
+
+	Secret string `json:"token"`
+}
+
+// handleTokens lists (GET, or one with ?id=), creates (POST) or revokes
+// (DELETE ?id=) API tokens. Token hashes are never returned.
+func (s *CentralServer) handleTokens(w http.ResponseWriter, r *http.Request) {
+	var result interface{}
+
+	switch r.Method {
+	case http.MethodGet:
+		list := s.tokens.List()
+		for i := range list {
+			list[i].Hash = ""
+		}
+
+		result = list
+
+		if id := r.URL.Query().Get("id"); id != "" {
+			i := slices.IndexFunc(list, func(t tokens.Token) bool { return t.ID == id })
+			if i < 0 {
+				http.Error(w, tokens.ErrNotFound.Error(), http.StatusNotFound)
+				return
+			}
+
+			result = list[i]
+		}
+	case http.MethodPost:
+		var req TokenRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Name == "" {
+			http.Error(w, "Invalid request body, a name is required", http.StatusBadRequest)
+			return
+		}
+
+		expires := req.ExpiresAt
+
+		if req.ExpiresIn != "" {
+			d, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || d <= 0 {
+				http.Error(w, "Invalid expires_in", http.StatusBadRequest)
+				return
+			}
+
+			expires = time.Now().UTC().Add(d)
+		}
+
+		token, secret, err := s.tokens.Create(tokens.Token{
+			Name:      req.Name,
+			Scopes:    req.Scopes,
+			Wrappers:  req.Wrappers,
+			CreatedBy: requestUser(r).Name,
+			ExpiresAt: expires,
+		})
+		if errors.Is(err, tokens.ErrInvalidScope) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		token.Hash = ""
+		result = CreatedToken{Token: token, Secret: secret}
+
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		err := s.tokens.Revoke(r.URL.Query().Get("id"))
+		if errors.Is(err, tokens.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
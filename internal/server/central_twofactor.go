@@ -0,0 +1,308 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/twofactor"
+)
+
+const (
+	// maxTwoFactorFailures wrong codes lock a user out of verifying for
+	// twoFactorLockout, so codes can't be guessed.
+	maxTwoFactorFailures = 5
+	twoFactorLockout     = 5 * time.Minute
+
+	twoFactorIssuer = "Minecraft Server Manager"
+)
+
+// twoFactorAttempts tracks failed verifications per user.
+type twoFactorAttempts struct {
+	mu       sync.Mutex
+	failures map[string]int
+	locked   map[string]time.Time
+}
+
+func newTwoFactorAttempts() *twoFactorAttempts {
+	return &twoFactorAttempts{
+		failures: make(map[string]int),
+		locked:   make(map[string]time.Time),
+	}
+}
+
+// allow reports whether the user may try a code.
+func (t *twoFactorAttempts) allow(user string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return time.Now().After(t.locked[user])
+}
+
+// result records the outcome of a verification.
+func (t *twoFactorAttempts) result(user string, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ok {
+		delete(t.failures, user)
+		return
+	}
+
+	t.failures[user]++
+	if t.failures[user] >= maxTwoFactorFailures {
+		t.failures[user] = 0
+		t.locked[user] = time.Now().Add(twoFactorLockout)
+	}
+}
+
+// RequiresTwoFactor reports whether the user can send commands or change
+// configuration, which needs a second factor.
+func (u *User) RequiresTwoFactor() bool {
+	if u.Admin {
+		return true
+	}
+
+	for _, grant := range u.Grants {
+		if grant.Access.Allows(AccessOperate) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// viewOnly returns a copy of the user limited to view access, used until
+// the user verifies a second factor.
+func (u *User) viewOnly() *User {
+	restricted := *u
+	restricted.Admin = false
+	restricted.pending = true
+	restricted.Grants = nil
+
+	if u.Admin {
+		restricted.Grants = []Grant{{All: true, Access: AccessView}}
+	}
+
+	for _, grant := range u.Grants {
+		grant.Access = AccessView
+		restricted.Grants = append(restricted.Grants, grant)
+	}
+
+	return &restricted
+}
+
+// accountUser returns the configured user with the given name.
+func (s *CentralServer) accountUser(name string) (*User, bool) {
+	for i := range s.users {
+		if s.users[i].Name == name {
+			return &s.users[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// TwoFactorStatus reports a user's two-factor setup.
+type TwoFactorStatus struct {
+	Required     bool `json:"required"`
+	Enabled      bool `json:"enabled"`
+	Verified     bool `json:"verified"` // Whether this request uses a verified session
+	RecoveryLeft int  `json:"recovery_codes_left"`
+}
+
+// TwoFactorEnrollment is the secret a user adds to their authenticator app.
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// twoFactorCode is the body of requests carrying a TOTP or recovery code.
+type twoFactorCode struct {
+	Code string `json:"code"`
+}
+
+// handleTwoFactor serves /api/2fa and its subpaths for configured users:
+//
+//	GET    /api/2fa          status
+//	POST   /api/2fa/enroll   start enrollment, returning the secret
+//	POST   /api/2fa/confirm  confirm with a code, returning recovery codes
+//	POST   /api/2fa/session  verify a code or recovery code, returning a
+//	                         verified session that replaces the current one
+//	DELETE /api/2fa          disable, from a verified session; admins may
+//	                         reset another user with ?user=
+func (s *CentralServer) handleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	u := requestUser(r)
+
+	if r.Method == http.MethodDelete && r.URL.Query().Get("user") != "" {
+		if !u.Admin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		s.disableTwoFactor(w, r.URL.Query().Get("user"))
+
+		return
+	}
+
+	if !u.account {
+		http.Error(w, "Two-factor authentication is only available to user accounts", http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+
+	switch strings.TrimPrefix(r.URL.Path, "/api/2fa") {
+	case "", "/":
+		switch r.Method {
+		case http.MethodGet:
+			result = TwoFactorStatus{
+				Required:     u.RequiresTwoFactor() || u.pending,
+				Enabled:      s.twoFactor.Enabled(u.Name),
+				Verified:     u.verified,
+				RecoveryLeft: s.twoFactor.RecoveryLeft(u.Name),
+			}
+		case http.MethodDelete:
+			if s.twoFactor.Enabled(u.Name) && !u.verified {
+				http.Error(w, "A verified two-factor session is required", http.StatusForbidden)
+				return
+			}
+
+			s.disableTwoFactor(w, u.Name)
+
+			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	case "/enroll":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		secret, err := s.twoFactor.Enroll(u.Name)
+		if errors.Is(err, twofactor.ErrAlreadyEnrolled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result = TwoFactorEnrollment{Secret: secret, URI: twofactor.URI(twoFactorIssuer, u.Name, secret)}
+	case "/confirm":
+		code, ok := s.readTwoFactorCode(w, r, u.Name)
+		if !ok {
+			return
+		}
+
+		codes, err := s.twoFactor.Confirm(u.Name, code)
+		s.twoFactorAttempts.result(u.Name, err == nil)
+
+		if !s.twoFactorError(w, err) {
+			return
+		}
+
+		result = map[string][]string{"recovery_codes": codes}
+	case "/session":
+		code, ok := s.readTwoFactorCode(w, r, u.Name)
+		if !ok {
+			return
+		}
+
+		err := s.twoFactor.Verify(u.Name, code)
+		s.twoFactorAttempts.result(u.Name, err == nil)
+
+		if !s.twoFactorError(w, err) {
+			return
+		}
+
+		created, err := s.sessions.create(u.Name, false, true, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if u.session != "" {
+			s.sessions.revoke(u.session)
+		}
+
+		setSessionCookie(w, r, created)
+
+		result = created
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// readTwoFactorCode decodes the code of a POST request, refusing users
+// locked out after too many wrong codes.
+func (s *CentralServer) readTwoFactorCode(w http.ResponseWriter, r *http.Request, user string) (string, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+
+	if !s.twoFactorAttempts.allow(user) {
+		http.Error(w, "Too many invalid codes, try again later", http.StatusTooManyRequests)
+		return "", false
+	}
+
+	var body twoFactorCode
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.Code == "" {
+		http.Error(w, "Invalid request body, a code is required", http.StatusBadRequest)
+		return "", false
+	}
+
+	return body.Code, true
+}
+
+// twoFactorError reports a verification error and whether there was none.
+func (s *CentralServer) twoFactorError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, twofactor.ErrInvalidCode):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, twofactor.ErrNotEnrolled), errors.Is(err, twofactor.ErrAlreadyEnrolled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+
+	return false
+}
+
+// disableTwoFactor removes a user's two-factor setup and ends their browser
+// sessions.
+func (s *CentralServer) disableTwoFactor(w http.ResponseWriter, user string) {
+	err := s.twoFactor.Disable(user)
+	if errors.Is(err, twofactor.ErrNotEnrolled) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.sessions.revokeUser(user)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/tokens"
+)
+
+// Access is what a user may do with a wrapper.
+type Access string
+
+const (
+	AccessNone    Access = ""
+	AccessView    Access = "view"    // Console output, status and reports
+	AccessOperate Access = "operate" // Also sending commands and retrying connections
+)
+
+// rank orders access levels.
+func (a Access) rank() int {
+	switch a {
+	case AccessOperate:
+		return 2
+	case AccessView:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Allows reports whether a grants at least the required access.
+func (a Access) Allows(required Access) bool {
+	return a.rank() >= required.rank()
+}
+
+// Grant gives a user access to wrappers listed by ID or by group.
+type Grant struct {
+	All      bool     `json:"all,omitempty"` // Every wrapper
+	Wrappers []string `json:"wrappers,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	Access   Access   `json:"access"`
+}
+
+// User is a central server user. Admins, including whoever uses the master
+// auth key, have full access to every wrapper and the fleet-wide endpoints.
+type User struct {
+	Name   string   `json:"name"`
+	Key    string   `json:"-"`
+	Admin  bool     `json:"admin"`
+	Grants []Grant  `json:"grants,omitempty"`
+	Scopes []string `json:"scopes,omitempty"` // Set for API tokens, which are limited to these scopes
+
+	account  bool   // A configured user, who can set up two-factor authentication
+	pending  bool   // Limited to view access until a second factor is verified
+	verified bool   // Authenticated with a verified two-factor session
+	session  string // ID of the browser session used, if any
+	token    string // ID of the API token used, if any
+	language string // Language stored with the browser session, if any
+}
+
+// HasScope reports whether the user may use endpoints requiring scope.
+// Only API tokens are limited by scopes.
+func (u *User) HasScope(scope string) bool {
+	if u.Scopes == nil {
+		return true
+	}
+
+	for _, s := range u.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Access returns the user's access to a wrapper.
+func (u *User) Access(wConn *WrapperConnection) Access {
+	if u.Admin {
+		return AccessOperate
+	}
+
+	access := AccessNone
+	groups := wConn.Groups()
+
+	for _, grant := range u.Grants {
+		if !grant.matches(wConn.ID, groups) || access.Allows(grant.Access) {
+			continue
+		}
+
+		access = grant.Access
+	}
+
+	return access
+}
+
+// matches reports whether the grant covers a wrapper.
+func (g Grant) matches(id string, groups []string) bool {
+	if g.All {
+		return true
+	}
+
+	for _, w := range g.Wrappers {
+		if w == id {
+			return true
+		}
+	}
+
+	for _, group := range g.Groups {
+		for _, wg := range groups {
+			if group == wg {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type userContextKey struct{}
+
+// requestUser returns the authenticated user of a request.
+func requestUser(r *http.Request) *User {
+	u, _ := r.Context().Value(userContextKey{}).(*User)
+	if u == nil {
+		return &User{}
+	}
+
+	return u
+}
+
+// withUser returns the request with the authenticated user attached.
+func withUser(r *http.Request, u *User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userContextKey{}, u))
+}
+
+// authenticate returns the user a key belongs to.
+func (s *CentralServer) authenticate(key string) (*User, bool) {
+	if subtle.ConstantTimeCompare([]byte(key), []byte(s.authKey)) == 1 {
+		return &User{Name: "admin", Admin: true}, true
+	}
+
+	if strings.HasPrefix(key, sessionPrefix) {
+		sess, ok := s.sessions.lookup(key)
+		if !ok {
+			return nil, false
+		}
+
+		return s.sessionUser(sess)
+	}
+
+	for i := range s.users {
+		u := &s.users[i]
+		if u.Key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(u.Key)) == 1 {
+			// Sending commands and changing configuration needs a second factor
+			if s.twoFactor != nil && u.RequiresTwoFactor() {
+				return u.viewOnly(), true
+			}
+
+			return u, true
+		}
+	}
+
+	if s.tokens != nil {
+		token, ok := s.tokens.Lookup(key)
+		if ok {
+			return tokenUser(token), true
+		}
+	}
+
+	return nil, false
+}
+
+// tokenUser returns the user an API token acts as. Reading status grants
+// view access and sending commands operate access to the token's wrappers.
+func tokenUser(t tokens.Token) *User {
+	u := &User{Name: "token:" + t.Name, Scopes: t.Scopes, token: t.ID}
+
+	access := AccessNone
+
+	if t.HasScope(tokens.ScopeReadStatus) {
+		access = AccessView
+	}
+
+	if t.HasScope(tokens.ScopeSendCommand) {
+		access = AccessOperate
+	}
+
+	if access != AccessNone {
+		u.Grants = []Grant{{All: len(t.Wrappers) == 0, Wrappers: t.Wrappers, Access: access}}
+	}
+
+	return u
+}
+
+// requireAdmin restricts a handler to admins.
+func (s *CentralServer) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requestUser(r).Admin {
+			s.httpError(w, r, "error.forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireScope restricts a handler to admins and API tokens with scope.
+func (s *CentralServer) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := requestUser(r)
+
+		if !u.Admin && (u.Scopes == nil || !u.HasScope(scope)) {
+			s.httpError(w, r, "error.forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireWrapper restricts a handler to users with the given access to the
+// wrapper in ?wrapper=. Wrappers the user can't view are reported as not
+// found so their IDs aren't revealed.
+func (s *CentralServer) requireWrapper(required Access, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("wrapper")
+		if id == "" {
+			// The handler reports the missing ID
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		access := AccessNone
+
+		wConn, exists := s.manager.GetConnection(id)
+		if exists {
+			access = requestUser(r).Access(wConn)
+		}
+
+		if !access.Allows(AccessView) {
+			s.httpError(w, r, "error.wrapper_not_found", http.StatusNotFound)
+			return
+		}
+
+		if !access.Allows(required) {
+			s.httpError(w, r, "error.forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// handleUsers lists the users of the config file (GET, or the one with
+// ?name=). Their keys are never returned.
+func (s *CentralServer) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result any = s.users
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		i := slices.IndexFunc(s.users, func(u User) bool { return u.Name == name })
+		if i < 0 {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		result = s.users[i]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
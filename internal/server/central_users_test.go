@@ -0,0 +1,158 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/tokens"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/twofactor"
+)
+
+const testMasterKey = "master-key"
+
+// newTestCentral returns a central server with the wrappers "one" and "two",
+// a viewer and an operator of both, and token and two-factor stores.
+func newTestCentral(t *testing.T, twoFactor bool) *CentralServer {
+	t.Helper()
+
+	manager := NewConnectionManager(ConnectionManagerConfig{})
+	manager.connections["one"] = &WrapperConnection{ID: "one", Name: "One"}
+	manager.connections["two"] = &WrapperConnection{ID: "two", Name: "Two"}
+
+	tokenStore, err := tokens.Open(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatalf("Failed to open tokens: %v", err)
+	}
+
+	config := CentralServerConfig{
+		Manager: manager,
+		AuthKey: testMasterKey,
+		Users: []User{
+			{Name: "viewer", Key: "viewer-key", Grants: []Grant{{All: true, Access: AccessView}}},
+			{Name: "operator", Key: "operator-key", Grants: []Grant{{All: true, Access: AccessOperate}}},
+		},
+		Tokens: tokenStore,
+	}
+
+	if twoFactor {
+		config.TwoFactor, err = twofactor.Open(filepath.Join(t.TempDir(), "twofactor.json"))
+		if err != nil {
+			t.Fatalf("Failed to open two-factor store: %v", err)
+		}
+	}
+
+	return NewCentralServer(config)
+}
+
+// serve sends a request through the authentication and access checks of a
+// route needing access to the wrapper, returning the status.
+func serve(s *CentralServer, required Access, r *http.Request) int {
+	handler := s.authMiddleware(s.requireWrapper(required, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	return w.Code
+}
+
+// keyRequest returns a request for wrapper sending a key in a header.
+func keyRequest(method, wrapper, key string) *http.Request {
+	r := httptest.NewRequest(method, "/api/console?wrapper="+wrapper, nil)
+	r.Header.Set("X-Auth-Key", key)
+
+	return r
+}
+
+func TestRequireWrapper(t *testing.T) {
+	s := newTestCentral(t, false)
+
+	tests := []struct {
+		name     string
+		key      string
+		wrapper  string
+		required Access
+		want     int
+	}{
+		{"viewer views", "viewer-key", "one", AccessView, http.StatusOK},
+		{"viewer operates", "viewer-key", "one", AccessOperate, http.StatusForbidden},
+		{"operator operates", "operator-key", "one", AccessOperate, http.StatusOK},
+		{"master key operates", testMasterKey, "two", AccessOperate, http.StatusOK},
+		{"unknown wrapper", "operator-key", "three", AccessView, http.StatusNotFound},
+		{"invalid key", "guess", "one", AccessView, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		got := serve(s, tt.required, keyRequest(http.MethodPost, tt.wrapper, tt.key))
+		if got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRequireWrapper_Tokens(t *testing.T) {
+	s := newTestCentral(t, false)
+
+	_, reader, err := s.tokens.Create(tokens.Token{Name: "status", Scopes: []string{tokens.ScopeReadStatus}})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	_, scoped, err := s.tokens.Create(tokens.Token{
+		Name:     "one only",
+		Scopes:   []string{tokens.ScopeSendCommand},
+		Wrappers: []string{"one"},
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if got := serve(s, AccessView, keyRequest(http.MethodGet, "one", reader)); got != http.StatusOK {
+		t.Errorf("Expected a read-status token to view, got %d", got)
+	}
+
+	if got := serve(s, AccessOperate, keyRequest(http.MethodPost, "one", reader)); got != http.StatusForbidden {
+		t.Errorf("Expected a read-status token to be refused operate routes, got %d", got)
+	}
+
+	if got := serve(s, AccessOperate, keyRequest(http.MethodPost, "one", scoped)); got != http.StatusOK {
+		t.Errorf("Expected a token to operate its wrapper, got %d", got)
+	}
+
+	// Other wrappers don't exist as far as the token can tell
+	if got := serve(s, AccessView, keyRequest(http.MethodGet, "two", scoped)); got != http.StatusNotFound {
+		t.Errorf("Expected a token scoped to one wrapper not to reach another, got %d", got)
+	}
+}
+
+func TestRequireWrapper_TwoFactor(t *testing.T) {
+	s := newTestCentral(t, true)
+
+	// Keys alone are downgraded to view access until a second factor
+	if got := serve(s, AccessView, keyRequest(http.MethodGet, "one", "operator-key")); got != http.StatusOK {
+		t.Errorf("Expected a downgraded operator to view, got %d", got)
+	}
+
+	if got := serve(s, AccessOperate, keyRequest(http.MethodPost, "one", "operator-key")); got != http.StatusForbidden {
+		t.Errorf("Expected a downgraded operator to be refused operate routes, got %d", got)
+	}
+
+	if got := serve(s, AccessOperate, keyRequest(http.MethodPost, "one", testMasterKey)); got != http.StatusOK {
+		t.Errorf("Expected the master key to operate, got %d", got)
+	}
+
+	for verified, want := range map[bool]int{false: http.StatusForbidden, true: http.StatusOK} {
+		created, err := s.sessions.create("operator", false, verified, httptest.NewRequest(http.MethodPost, "/", nil))
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		got := serve(s, AccessOperate, keyRequest(http.MethodPost, "one", created.Token))
+		if got != want {
+			t.Errorf("Verified session %v: expected %d, got %d", verified, want, got)
+		}
+	}
+}
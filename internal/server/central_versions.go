@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/downloader"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+const (
+	// latestVersionTTL is how long the latest available version is cached.
+	latestVersionTTL = time.Hour
+
+	// latestVersionTimeout bounds looking up the latest version.
+	latestVersionTimeout = 10 * time.Second
+)
+
+// latestVersion caches the newest Bedrock server version available for
+// download, unless one is pinned in the config.
+type latestVersion struct {
+	pinned  string
+	mu      sync.Mutex
+	version string
+	err     error
+	checked time.Time
+}
+
+// get returns the latest version, looking it up when the cached one is
+// stale. Failed lookups are cached too so an unreachable download site
+// doesn't slow every request down.
+func (l *latestVersion) get() (string, error) {
+	if l.pinned != "" {
+		return l.pinned, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.checked) < latestVersionTTL {
+		return l.version, l.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), latestVersionTimeout)
+	defer cancel()
+
+	version, err := downloader.LatestVersion(ctx, "")
+
+	l.checked = time.Now()
+	l.err = err
+
+	if err == nil {
+		l.version = version
+	}
+
+	return l.version, l.err
+}
+
+// VersionEntry is the Bedrock version a wrapper's server runs, and the
+// build of the wrapper itself.
+type VersionEntry struct {
+	Wrapper        string   `json:"wrapper"`
+	Name           string   `json:"name"`
+	Online         bool     `json:"online"`
+	Version        string   `json:"version,omitempty"`
+	Protocol       int      `json:"protocol,omitempty"` // Network protocol from the RakNet pong
+	OutOfDate      bool     `json:"out_of_date"`
+	WrapperVersion string   `json:"wrapper_version"`
+	WrapperCommit  string   `json:"wrapper_commit,omitempty"`
+	WrapperBuilt   string   `json:"wrapper_built,omitempty"` // RFC 3339
+	Notes          []string `json:"notes,omitempty"`
+}
+
+// isRelease reports whether a wrapper version is a release, as opposed to
+// "dev" or "unknown", so that it can be compared.
+func isRelease(version string) bool {
+	return version != "" && version[0] >= '0' && version[0] <= '9'
+}
+
+// VersionReport compares the versions in the fleet with the latest one
+// available.
+type VersionReport struct {
+	Latest      string         `json:"latest,omitempty"`
+	LatestError string         `json:"latest_error,omitempty"` // Why the latest version is unknown
+	OutOfDate   int            `json:"out_of_date"`
+	Servers     []VersionEntry `json:"servers"`
+}
+
+// versionReport builds the version report of the given wrappers. Without a
+// known latest version, servers are compared with the newest one in the
+// fleet.
+func versionReport(conns []*WrapperConnection, latest string) VersionReport {
+	report := VersionReport{Latest: latest, Servers: make([]VersionEntry, len(conns))}
+	pings := pingServers(conns)
+
+	newest, newestProtocol := latest, 0
+
+	for _, ping := range pings {
+		if !ping.online {
+			continue
+		}
+
+		if compareVersions(ping.pong.VersionName, newest) > 0 {
+			newest = ping.pong.VersionName
+		}
+
+		newestProtocol = max(newestProtocol, ping.pong.ProtocolVersion)
+	}
+
+	hellos := make([]protocol.Hello, len(conns))
+	newestWrapper := ""
+
+	for i, wConn := range conns {
+		hellos[i] = wConn.Hello()
+
+		if isRelease(hellos[i].Version) && compareVersions(hellos[i].Version, newestWrapper) > 0 {
+			newestWrapper = hellos[i].Version
+		}
+	}
+
+	for i, wConn := range conns {
+		entry := VersionEntry{
+			Wrapper:        wConn.ID,
+			Name:           wConn.Name,
+			Online:         pings[i].online,
+			WrapperVersion: hellos[i].Version,
+			WrapperCommit:  hellos[i].Commit,
+			WrapperBuilt:   hellos[i].BuildDate,
+		}
+
+		// Wrappers skewed from the rest of the fleet may lack features or fixes
+		if isRelease(entry.WrapperVersion) && compareVersions(entry.WrapperVersion, newestWrapper) < 0 {
+			entry.Notes = append(entry.Notes,
+				fmt.Sprintf("wrapper %s is older than wrapper %s elsewhere in the fleet", entry.WrapperVersion, newestWrapper))
+		}
+
+		if !entry.Online {
+			entry.Notes = append(entry.Notes, "server not reachable, version unknown")
+			report.Servers[i] = entry
+
+			continue
+		}
+
+		entry.Version = pings[i].pong.VersionName
+		entry.Protocol = pings[i].pong.ProtocolVersion
+
+		switch {
+		case compareVersions(entry.Version, newest) < 0:
+			entry.OutOfDate = true
+			entry.Notes = append(entry.Notes, fmt.Sprintf("behind %s", newest))
+		case latest != "" && compareVersions(entry.Version, latest) > 0:
+			entry.Notes = append(entry.Notes, fmt.Sprintf("newer than the latest release %s, possibly a preview", latest))
+		}
+
+		// Bedrock clients only join servers speaking their protocol
+		if entry.Protocol < newestProtocol {
+			entry.Notes = append(entry.Notes, fmt.Sprintf(
+				"protocol %d is older than protocol %d elsewhere in the fleet, players on updated clients can't join",
+				entry.Protocol, newestProtocol))
+		}
+
+		if entry.OutOfDate {
+			report.OutOfDate++
+		}
+
+		report.Servers[i] = entry
+	}
+
+	return report
+}
+
+// visibleConnections returns the wrappers the user of the request can view,
+// only those with the labels given as ?labels=key=value,... if any.
+func (s *CentralServer) visibleConnections(r *http.Request) ([]*WrapperConnection, error) {
+	user := requestUser(r)
+
+	labels, err := protocol.ParseLabels(r.URL.Query().Get("labels"))
+	if err != nil {
+		return nil, err
+	}
+
+	var conns []*WrapperConnection
+
+	for _, wConn := range s.manager.ListConnections() {
+		if user.Access(wConn).Allows(AccessView) && wConn.HasLabels(labels) {
+			conns = append(conns, wConn)
+		}
+	}
+
+	return conns, nil
+}
+
+// handleVersions reports the Bedrock version of each server the user can
+// view against the latest available one, with the wrapper builds.
+func (s *CentralServer) handleVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conns, err := s.visibleConnections(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	latest, err := s.latest.get()
+	report := versionReport(conns, latest)
+
+	if err != nil {
+		report.LatestError = err.Error()
+	}
+
+	err = json.NewEncoder(w).Encode(report)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// clientRetryAfter is how long clients turned away for being over a limit
+// are asked to wait before reconnecting.
+const clientRetryAfter = 30 * time.Second
+
+type centralContextKey struct{}
+
+// withCentral returns the request marked as the central server's, once
+// authenticated with the central key. Its connection to the wrapper isn't
+// counted against the client limits.
+func withCentral(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), centralContextKey{}, true))
+}
+
+// isCentral reports whether a request authenticated with the central key.
+func isCentral(r *http.Request) bool {
+	central, _ := r.Context().Value(centralContextKey{}).(bool)
+
+	return central
+}
+
+// ClientLimits caps the clients connected to a console at once, browsers and
+// scripts alike. The central server's connection to a wrapper isn't counted
+// once it authenticates with the central key, the consoles it relays are
+// limited by the central server. Zero is unlimited.
+type ClientLimits struct {
+	Max   int // Clients in all
+	PerIP int // Clients from one address
+}
+
+// Validate checks the limits.
+func (l ClientLimits) Validate() error {
+	if l.Max < 0 || l.PerIP < 0 {
+		return fmt.Errorf("client limits must not be negative")
+	}
+
+	return nil
+}
+
+// clientLimiter counts the clients of a console against limits.
+type clientLimiter struct {
+	limits ClientLimits
+
+	mu    sync.Mutex
+	total int
+	byIP  map[string]int
+}
+
+func newClientLimiter(limits ClientLimits) *clientLimiter {
+	return &clientLimiter{limits: limits, byIP: make(map[string]int)}
+}
+
+// acquire counts a client from ip, returning a function that stops
+// counting it, unless that would exceed a limit.
+func (l *clientLimiter) acquire(ip string) (func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if (l.limits.Max > 0 && l.total >= l.limits.Max) || (l.limits.PerIP > 0 && l.byIP[ip] >= l.limits.PerIP) {
+		return nil, false
+	}
+
+	l.total++
+	l.byIP[ip]++
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.total--
+			if l.byIP[ip]--; l.byIP[ip] <= 0 {
+				delete(l.byIP, ip)
+			}
+		})
+	}, true
+}
+
+// admit counts the client of a WebSocket request, turning it away with 503
+// and Retry-After if that would exceed a limit. The returned function stops
+// counting it.
+func (l *clientLimiter) admit(w http.ResponseWriter, r *http.Request) (func(), bool) {
+	release, ok := l.acquire(clientIP(r))
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(clientRetryAfter.Seconds())))
+		http.Error(w, "Too many console connections, close other tabs or try again later", http.StatusServiceUnavailable)
+
+		return nil, false
+	}
+
+	return release, true
+}
+
+// clientLimiter returns the limiter of the consoles of a wrapper.
+func (s *CentralServer) clientLimiter(wrapperID string) *clientLimiter {
+	s.clientsMux.Lock()
+	defer s.clientsMux.Unlock()
+
+	l, ok := s.clientLimiters[wrapperID]
+	if !ok {
+		l = newClientLimiter(s.clientLimits)
+		s.clientLimiters[wrapperID] = l
+	}
+
+	return l
+}
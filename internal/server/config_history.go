@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/history"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/trash"
+)
+
+// historyDirName is the config history in the app directory.
+const historyDirName = "config-history"
+
+// startupConfigFiles are snapshotted when the wrapper starts, so changes
+// made outside the wrapper (including from the environment) show up in the
+// history.
+var startupConfigFiles = []string{"server.properties", "permissions.json", "allowlist.json"}
+
+// openHistory loads the config history and records the current config files.
+func (s *Server) openHistory() {
+	store, err := history.Open(filepath.Join(s.appDir, historyDirName))
+	if err != nil {
+		fmt.Printf("Error opening config history: %v\n", err)
+		return
+	}
+
+	s.history = store
+
+	for _, name := range startupConfigFiles {
+		data, err := os.ReadFile(filepath.Join(s.appDir, name)) // #nosec G304
+		if err != nil {
+			continue
+		}
+
+		_, _, err = store.Track(name, "startup", "", nil, data)
+		if err != nil {
+			fmt.Printf("Error recording %s: %v\n", name, err)
+		}
+	}
+}
+
+// trackConfig records a file change in the config history if the file is
+// tracked.
+func (s *Server) trackConfig(rel, actor, note string, old, new []byte) {
+	if s.history == nil || !history.Tracked(rel) {
+		return
+	}
+
+	_, _, err := s.history.Track(rel, actor, note, old, new)
+	if err != nil {
+		fmt.Printf("Error recording %s: %v\n", rel, err)
+	}
+}
+
+// revision looks up the revision in ?id=, reporting an error if there's no
+// such revision.
+func (s *Server) revision(w http.ResponseWriter, r *http.Request) (history.Revision, []byte, bool) {
+	if s.history == nil {
+		http.Error(w, "Config history is unavailable", http.StatusServiceUnavailable)
+		return history.Revision{}, nil, false
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid revision id", http.StatusBadRequest)
+		return history.Revision{}, nil, false
+	}
+
+	rev, data, err := s.history.Get(id)
+	if errors.Is(err, history.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return history.Revision{}, nil, false
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return history.Revision{}, nil, false
+	}
+
+	return rev, data, true
+}
+
+// handleConfigHistory lists the revisions of a config file (?path=), or of
+// all config files, newest first.
+func (s *Server) handleConfigHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.history == nil {
+		http.Error(w, "Config history is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(s.history.List(r.URL.Query().Get("path")))
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleConfigRevision returns the contents of a revision (?id=).
+func (s *Server) handleConfigRevision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, data, ok := s.revision(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	_, err := w.Write(data)
+	if err != nil {
+		fmt.Printf("Error sending revision: %v\n", err)
+	}
+}
+
+// handleConfigRollback restores a config file to a revision (?id=). The
+// rollback is audited and recorded as a new revision, so it can itself be
+// rolled back, and the replaced file is copied to the trash.
+func (s *Server) handleConfigRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rev, data, ok := s.revision(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := os.Stat(filepath.Join(s.appDir, rev.Path))
+	if err == nil {
+		_, err = s.discard(trash.Item{
+			Kind:    trash.KindConfig,
+			Name:    rev.Path,
+			Actor:   actor(r),
+			Entries: []trash.Entry{{Path: rev.Path, Copy: true}},
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	old, new, err := s.files.Write(rev.Path, bytes.NewReader(data))
+	if err != nil {
+		fileError(w, err)
+		return
+	}
+
+	note := fmt.Sprintf("rollback to revision %d", rev.ID)
+
+	err = s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: "config.rollback",
+		Target: rev.Path,
+		Diff:   audit.Diff(rev.Path, old, new),
+	})
+	if err != nil {
+		fmt.Printf("Error recording rollback: %v\n", err)
+	}
+
+	s.trackConfig(rev.Path, actor(r), note, old, new)
+
+	w.WriteHeader(http.StatusNoContent)
+}
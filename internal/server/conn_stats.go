@@ -0,0 +1,231 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// rateWindow is the period message and byte rates are averaged over.
+	rateWindow = 60
+
+	// maxErrorHistory is how many distinct connection errors are kept.
+	maxErrorHistory = 10
+
+	// latencySamples is how many round trips percentiles are computed over.
+	latencySamples = 100
+)
+
+// LatencyStats summarizes recent round trip times, in milliseconds.
+type LatencyStats struct {
+	Samples int     `json:"samples"`
+	Last    float64 `json:"last_ms"`
+	P50     float64 `json:"p50_ms"`
+	P90     float64 `json:"p90_ms"`
+	P99     float64 `json:"p99_ms"`
+	Max     float64 `json:"max_ms"`
+}
+
+// latencyWindow keeps the last round trip times.
+type latencyWindow struct {
+	samples [latencySamples]time.Duration
+	n       int // Samples recorded, up to the window size
+	next    int
+}
+
+// add records a round trip time.
+func (l *latencyWindow) add(d time.Duration) {
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencySamples
+
+	if l.n < latencySamples {
+		l.n++
+	}
+}
+
+// stats returns the percentiles of the recorded round trip times.
+func (l *latencyWindow) stats() LatencyStats {
+	if l.n == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := make([]time.Duration, l.n)
+	copy(sorted, l.samples[:l.n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	ms := func(d time.Duration) float64 {
+		return float64(d.Microseconds()) / 1000
+	}
+
+	percentile := func(p int) float64 {
+		return ms(sorted[(len(sorted)-1)*p/100])
+	}
+
+	return LatencyStats{
+		Samples: l.n,
+		Last:    ms(l.samples[(l.next+latencySamples-1)%latencySamples]),
+		P50:     percentile(50),
+		P90:     percentile(90),
+		P99:     percentile(99),
+		Max:     ms(sorted[len(sorted)-1]),
+	}
+}
+
+// pingPayload is sent with WebSocket pings so the pong carries the time the
+// ping left.
+func pingPayload(now time.Time) []byte {
+	return []byte(strconv.FormatInt(now.UnixNano(), 10))
+}
+
+// observePong records the round trip of the ping a pong answers.
+func (w *WrapperConnection) observePong(appData string) {
+	sent, err := strconv.ParseInt(appData, 10, 64)
+	if err != nil {
+		return
+	}
+
+	rtt := time.Since(time.Unix(0, sent))
+	if rtt < 0 {
+		return
+	}
+
+	w.statsMu.Lock()
+	w.linkRTT.add(rtt)
+	w.statsMu.Unlock()
+}
+
+// observePing records the latency of a RakNet ping to the game port.
+func (w *WrapperConnection) observePing(d time.Duration) {
+	w.statsMu.Lock()
+	w.pingLatency.add(d)
+	w.statsMu.Unlock()
+}
+
+// ConnectionError is an error of the connection to a wrapper. Repeats of
+// the last error are counted instead of added again.
+type ConnectionError struct {
+	Time    time.Time `json:"time"` // Last occurrence
+	Message string    `json:"message"`
+	Count   int       `json:"count"`
+}
+
+// rateCounter counts messages and bytes in one-second buckets over the rate
+// window.
+type rateCounter struct {
+	buckets [rateWindow]struct {
+		second          int64
+		messages, bytes int64
+	}
+}
+
+// add counts a message of n bytes.
+func (c *rateCounter) add(now time.Time, n int) {
+	second := now.Unix()
+	b := &c.buckets[second%rateWindow]
+
+	if b.second != second {
+		b.second = second
+		b.messages = 0
+		b.bytes = 0
+	}
+
+	b.messages++
+	b.bytes += int64(n)
+}
+
+// rates returns the messages and bytes per second over the window.
+func (c *rateCounter) rates(now time.Time) (messages, bytes float64) {
+	oldest := now.Unix() - rateWindow
+
+	for _, b := range c.buckets {
+		if b.second > oldest {
+			messages += float64(b.messages)
+			bytes += float64(b.bytes)
+		}
+	}
+
+	return messages / rateWindow, bytes / rateWindow
+}
+
+// countSent counts a message of n bytes sent to the wrapper.
+func (w *WrapperConnection) countSent(n int) {
+	now := time.Now().UTC()
+
+	w.statsMu.Lock()
+	w.Stats.MessagesSent++
+	w.Stats.BytesSent += int64(n)
+	w.Stats.LastMessageAt = now
+	w.sent.add(now, n)
+	w.statsMu.Unlock()
+}
+
+// countReceived counts a message of n bytes received from the wrapper.
+func (w *WrapperConnection) countReceived(n int) {
+	now := time.Now().UTC()
+
+	w.statsMu.Lock()
+	w.Stats.MessagesReceived++
+	w.Stats.BytesReceived += int64(n)
+	w.Stats.LastMessageAt = now
+	w.received.add(now, n)
+	w.statsMu.Unlock()
+}
+
+// setError sets the current error of the connection and adds it to the
+// error history.
+func (w *WrapperConnection) setError(message string) {
+	w.Error = message
+
+	now := time.Now().UTC()
+
+	w.statsMu.Lock()
+	defer w.statsMu.Unlock()
+
+	if n := len(w.errors); n > 0 && w.errors[n-1].Message == message {
+		w.errors[n-1].Time = now
+		w.errors[n-1].Count++
+
+		return
+	}
+
+	w.errors = append(w.errors, ConnectionError{Time: now, Message: message, Count: 1})
+	if len(w.errors) > maxErrorHistory {
+		w.errors = w.errors[len(w.errors)-maxErrorHistory:]
+	}
+}
+
+// statsSnapshot returns a copy of the connection statistics with the
+// current rates and error history.
+func (w *WrapperConnection) statsSnapshot() ConnectionStats {
+	now := time.Now()
+
+	w.statsMu.RLock()
+	defer w.statsMu.RUnlock()
+
+	stats := w.Stats
+	stats.SendRate, stats.SendByteRate = w.sent.rates(now)
+	stats.ReceiveRate, stats.ReceiveByteRate = w.received.rates(now)
+	stats.Errors = append([]ConnectionError{}, w.errors...)
+	stats.LinkRTT = w.linkRTT.stats()
+	stats.PingLatency = w.pingLatency.stats()
+
+	return stats
+}
+
+// LatencySamples pings the servers of all connected wrappers every interval
+// until the manager is shut down, so ping latencies are tracked even when no
+// one looks at them.
+func (m *ConnectionManager) LatencySamples(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			go pingServers(m.ListConnections())
+		case <-m.stop:
+			return
+		}
+	}
+}
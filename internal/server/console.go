@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/i18n"
+)
+
+// The console page is a template, localized for each request; its style
+// sheet and script are served as they are from /static/.
+//
+//go:embed web/console.html web/static
+var consoleFiles embed.FS
+
+var (
+	consoleTemplate = template.Must(template.ParseFS(consoleFiles, "web/console.html"))
+	staticFiles     = mustSub(consoleFiles, "web/static")
+
+	// assetVersion is a hash of the static files. Pages link them with
+	// ?v=assetVersion, so browsers cache them until the wrapper is upgraded.
+	assetVersion = hashFiles(staticFiles)
+)
+
+// staticMaxAge is how long browsers cache static files requested with the
+// current version.
+const staticMaxAge = 365 * 24 * time.Hour
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
+
+// hashFiles returns a short hash of the contents of every file in fsys.
+func hashFiles(fsys fs.FS) string {
+	h := sha256.New()
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(data))
+		h.Write(data)
+
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// consolePage is the data of the console page, in the language of ?lang= or
+// of the browser.
+type consolePage struct {
+	Lang     string
+	Version  string            // Version of the static files
+	Messages map[string]string // Messages the script shows
+}
+
+// T returns the message with key in the language of the page.
+func (p consolePage) T(key string) string {
+	return i18n.T(p.Lang, key)
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	lang := i18n.Negotiate(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
+	page := consolePage{Lang: lang, Version: assetVersion, Messages: make(map[string]string)}
+
+	for key, msg := range i18n.Messages(lang) {
+		if strings.HasPrefix(key, "console.") || strings.HasPrefix(key, "addons.") {
+			page.Messages[key] = msg
+		}
+	}
+
+	var buf bytes.Buffer
+
+	err := consoleTemplate.Execute(&buf, page)
+	if err != nil {
+		fmt.Printf("Error rendering template: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+
+		return
+	}
+
+	// The page is small and localized, so it's revalidated every time
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Vary", "Accept-Language")
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		fmt.Printf("Error sending console page: %v\n", err)
+	}
+}
+
+// handleStatic serves the style sheet and script of the console page.
+func handleStatic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean(r.URL.Path[len("/static/"):])
+
+	data, err := fs.ReadFile(staticFiles, name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.URL.Query().Get("v") == assetVersion {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(staticMaxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	// ServeContent answers If-None-Match with the ETag and sets the type
+	w.Header().Set("ETag", `"`+assetVersion+`"`)
+
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/events"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/proxy"
+)
+
+// maxDenyListSize bounds the body of a deny list request.
+const maxDenyListSize = 1 << 20
+
+// DenyListStatus is the deny list with the proxy's statistics.
+type DenyListStatus struct {
+	Entries []proxy.Entry `json:"entries"`
+	Proxy   proxy.Stats   `json:"proxy"`
+}
+
+// denyListError maps deny list errors to HTTP responses.
+func denyListError(w http.ResponseWriter, err error) {
+	if errors.Is(err, proxy.ErrInvalidEntry) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// handleDenyList lists (GET), adds (POST) or removes (DELETE ?value=) deny
+// list entries. PUT replaces the fleet entries and is used by the central
+// server to keep all wrappers in sync.
+func (s *Server) handleDenyList(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var entry proxy.Entry
+
+		err := json.NewDecoder(io.LimitReader(r.Body, maxDenyListSize)).Decode(&entry)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		entry.Source = proxy.SourceLocal
+
+		_, err = s.denyList.Add(entry)
+		if err != nil {
+			denyListError(w, err)
+			return
+		}
+	case http.MethodPut:
+		var entries []proxy.Entry
+
+		err := json.NewDecoder(io.LimitReader(r.Body, maxDenyListSize)).Decode(&entries)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		err = s.denyList.Replace(proxy.SourceFleet, entries)
+		if err != nil {
+			denyListError(w, err)
+			return
+		}
+	case http.MethodDelete:
+		removed, err := s.denyList.Remove(r.URL.Query().Get("value"))
+		if err != nil {
+			denyListError(w, err)
+			return
+		}
+
+		if !removed {
+			http.Error(w, "Entry not found", http.StatusNotFound)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := DenyListStatus{Entries: s.denyList.Entries()}
+	if s.proxy != nil {
+		status.Proxy = s.proxy.Stats()
+	}
+
+	err := json.NewEncoder(w).Encode(status)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// enforceDenyList kicks players with a denied XUID as they join. XUIDs are
+// only visible once the player has logged in, so they can't be dropped by
+// the proxy like addresses.
+func (s *Server) enforceDenyList(line string) {
+	if s.denyList == nil {
+		return
+	}
+
+	e, ok := events.Parse(line)
+	if !ok || e.Type != events.TypeJoin || !s.denyList.BlockedXUID(e.XUID) {
+		return
+	}
+
+	fmt.Printf("Kicking %s: XUID %s is on the deny list\n", e.Player, e.XUID)
+	s.runner.WriteInput(fmt.Sprintf("kick %q You are not allowed on this server", e.Player))
+}
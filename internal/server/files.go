@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/downloader"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/files"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rules"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/scripting"
+)
+
+const (
+	// auditLogName is the audit log in the app directory, which the file
+	// API can't touch.
+	auditLogName = "audit.log"
+
+	// actorHeader names who a request acts for. The central server sets it to
+	// the dashboard user; direct API calls are recorded as "api".
+	actorHeader = "X-Audit-Actor"
+)
+
+// internalFiles are kept by the wrapper in the app directory and can't be
+// touched through the file API.
+var internalFiles = []string{
+	auditLogName, historyDirName, announcementsName, schedulesName, capacityName, noticesName, RollbackDir, TrashDir,
+	TransferDir, rules.File, rules.StateFile, scripting.File, downloader.ManifestFile,
+}
+
+// actor returns who a request acts for.
+func actor(r *http.Request) string {
+	if a := r.Header.Get(actorHeader); a != "" {
+		return a
+	}
+
+	return "api"
+}
+
+// fileError reports a file API error with a matching status.
+func fileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, files.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, files.ErrDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, files.ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, files.ErrInvalidPath), errors.Is(err, files.ErrIsDir):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleFiles lists a directory or downloads a file (GET ?path=, with
+// download=true for an attachment) and uploads or edits a file (PUT ?path=)
+// in the app directory. Every write is recorded in the audit log with a
+// diff, and config files also in the config history.
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	rel := r.URL.Query().Get("path")
+
+	switch r.Method {
+	case http.MethodGet:
+		dir, err := s.files.IsDir(rel)
+		if err != nil {
+			fileError(w, err)
+			return
+		}
+
+		if dir {
+			entries, err := s.files.List(rel)
+			if err != nil {
+				fileError(w, err)
+				return
+			}
+
+			err = json.NewEncoder(w).Encode(entries)
+			if err != nil {
+				fmt.Printf("Error sending JSON response: %v\n", err)
+			}
+
+			return
+		}
+
+		f, info, err := s.files.Open(rel)
+		if err != nil {
+			fileError(w, err)
+			return
+		}
+		defer f.Close()
+
+		if r.URL.Query().Get("download") == "true" {
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(rel)))
+		}
+
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	case http.MethodPut:
+		old, new, err := s.files.Write(rel, r.Body)
+		if err != nil {
+			fileError(w, err)
+			return
+		}
+
+		err = s.audit.Record(audit.Entry{
+			Actor:  actor(r),
+			Action: "file.write",
+			Target: rel,
+			Diff:   audit.Diff(rel, old, new),
+		})
+		if err != nil {
+			fmt.Printf("Error recording file change: %v\n", err)
+		}
+
+		s.trackConfig(rel, actor(r), "", old, new)
+
+		if old == nil {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAudit returns the newest audit log entries (?limit=, default 100).
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 100
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		limit = n
+	}
+
+	entries, err := s.audit.Entries(limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(entries)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
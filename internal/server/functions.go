@@ -0,0 +1,285 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/mcfunction"
+)
+
+const (
+	// functionResultWait is how long a command gets to print its first
+	// result line.
+	functionResultWait = time.Second
+
+	// functionResultQuiet ends a command's result once the console has been
+	// quiet this long.
+	functionResultQuiet = 100 * time.Millisecond
+)
+
+// FunctionResult is the console output of a function command.
+type FunctionResult struct {
+	mcfunction.Line
+	Output []string `json:"output"`
+}
+
+// FunctionRun is the result of running a function.
+type FunctionRun struct {
+	Name     string           `json:"name"`
+	Results  []FunctionResult `json:"results"`
+	Complete bool             `json:"complete"` // False if the run was cancelled or the server exited
+}
+
+// tapOutput passes console lines to ch until the returned function is
+// called.
+func (s *Server) tapOutput(ch chan string) func() {
+	s.tapMu.Lock()
+	s.tap = ch
+	s.tapMu.Unlock()
+
+	return func() {
+		s.tapMu.Lock()
+		s.tap = nil
+		s.tapMu.Unlock()
+	}
+}
+
+// tapLine passes a console line to the tap, if any, without blocking.
+func (s *Server) tapLine(text string) {
+	s.tapMu.Lock()
+	defer s.tapMu.Unlock()
+
+	if s.tap == nil {
+		return
+	}
+
+	select {
+	case s.tap <- text:
+	default:
+	}
+}
+
+// runFunction runs commands one at a time, capturing the console output
+// that follows each. Other console activity during a run may be captured
+// too. Runs stop early when done is closed or the server exits.
+func (s *Server) runFunction(name string, lines []mcfunction.Line, done <-chan struct{}) FunctionRun {
+	s.functionMu.Lock()
+	defer s.functionMu.Unlock()
+
+	output := make(chan string, 256)
+	defer s.tapOutput(output)()
+
+	run := FunctionRun{Name: name, Results: []FunctionResult{}}
+
+	for _, line := range lines {
+		// Drop anything printed since the last command's result
+		for len(output) > 0 {
+			<-output
+		}
+
+		s.runner.WriteInput(line.Command)
+
+		result := FunctionResult{Line: line, Output: []string{}}
+		timer := time.NewTimer(functionResultWait)
+
+	collect:
+		for {
+			select {
+			case text := <-output:
+				result.Output = append(result.Output, text)
+				timer.Reset(functionResultQuiet)
+			case <-timer.C:
+				break collect
+			case <-done:
+				timer.Stop()
+				run.Results = append(run.Results, result)
+				return run
+			case <-s.runner.Done():
+				timer.Stop()
+				run.Results = append(run.Results, result)
+				return run
+			}
+		}
+
+		run.Results = append(run.Results, result)
+	}
+
+	run.Complete = true
+
+	return run
+}
+
+// functionError reports a function API error with a matching status.
+// Validation errors list the problems by line.
+func functionError(w http.ResponseWriter, err error) {
+	var verr *mcfunction.ValidationError
+
+	switch {
+	case errors.As(err, &verr):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+
+		err = json.NewEncoder(w).Encode(verr)
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+		}
+	case errors.Is(err, mcfunction.ErrInvalidName):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, mcfunction.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, mcfunction.ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleFunctions lists the function library (GET), downloads a function
+// (GET ?name=), uploads one after validating it (PUT ?name=) and deletes one
+// (DELETE ?name=). Uploads and deletions are recorded in the audit log.
+func (s *Server) handleFunctions(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	switch r.Method {
+	case http.MethodGet:
+		if name != "" {
+			data, err := mcfunction.Read(s.appDir, name)
+			if err != nil {
+				functionError(w, err)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+			_, err = w.Write(data)
+			if err != nil {
+				fmt.Printf("Error sending function: %v\n", err)
+			}
+
+			return
+		}
+
+		functions, err := mcfunction.List(s.appDir)
+		if err != nil {
+			functionError(w, err)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(functions)
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+		}
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		old, err := mcfunction.Save(s.appDir, name, data)
+		if err != nil {
+			functionError(w, err)
+			return
+		}
+
+		s.auditFunction(r, "function.write", name, audit.Diff(name+".mcfunction", old, data))
+
+		if old == nil {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		err := mcfunction.Delete(s.appDir, name)
+		if err != nil {
+			functionError(w, err)
+			return
+		}
+
+		s.auditFunction(r, "function.delete", name, "")
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleFunctionValidate checks a function in the request body without
+// saving it, returning its commands.
+func (s *Server) handleFunctionValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	lines, err := mcfunction.Parse(data)
+	if err != nil {
+		functionError(w, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(lines)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleFunctionRun runs a function from the library (POST ?name=) through
+// the console and returns the output of each command. Runs are one at a
+// time and are recorded in the audit log.
+func (s *Server) handleFunctionRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+
+	data, err := mcfunction.Read(s.appDir, name)
+	if err != nil {
+		functionError(w, err)
+		return
+	}
+
+	// The library may have been edited through the file API, so the
+	// function is checked again
+	lines, err := mcfunction.Parse(data)
+	if err != nil {
+		functionError(w, err)
+		return
+	}
+
+	s.auditFunction(r, "function.run", name, "")
+
+	run := s.runFunction(name, lines, r.Context().Done())
+
+	err = json.NewEncoder(w).Encode(run)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// auditFunction records a change to or run of a function.
+func (s *Server) auditFunction(r *http.Request, action, name, diff string) {
+	err := s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: action,
+		Target: name,
+		Diff:   diff,
+	})
+	if err != nil {
+		fmt.Printf("Error recording function change: %v\n", err)
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/events"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/geoip"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notify"
+)
+
+// RegionAlerts configures warnings for players connecting from unexpected
+// countries. Countries are ISO 3166-1 codes such as "DE".
+type RegionAlerts struct {
+	Allowed []string // Alert on connections from any other country, if set
+	Denied  []string // Alert on connections from these countries
+}
+
+// alert returns the reason a connection from loc should be reported, or an
+// empty string.
+func (r RegionAlerts) alert(loc geoip.Location) string {
+	if loc.Country == "" {
+		return ""
+	}
+
+	for _, country := range r.Denied {
+		if strings.EqualFold(country, loc.Country) {
+			return "denied country"
+		}
+	}
+
+	if len(r.Allowed) == 0 {
+		return ""
+	}
+
+	for _, country := range r.Allowed {
+		if strings.EqualFold(country, loc.Country) {
+			return ""
+		}
+	}
+
+	return "country not allowed"
+}
+
+// locate resolves where a joining player connects from, records it with the
+// player's session and raises a region alert if needed. Nothing happens
+// unless a GeoIP database is configured and the join line included an address.
+func (w *WrapperConnection) locate(e events.Event) {
+	if w.geoip == nil || e.Type != events.TypeJoin || e.IP == "" {
+		return
+	}
+
+	loc, ok := w.geoip.Lookup(net.ParseIP(e.IP))
+	if !ok {
+		return
+	}
+
+	if w.activity != nil {
+		w.activity.Locate(w.ID, e.Player, loc)
+	}
+
+	reason := w.regionAlerts.alert(loc)
+	if reason == "" {
+		return
+	}
+
+	fmt.Printf("Warning: wrapper %s (%s): %s connected from %s (%s)\n", w.Name, w.ID, e.Player, loc.Country, reason)
+	w.broadcast([]byte(fmt.Sprintf("[central] Region alert: %s connected from %s (%s)", e.Player, loc.Country, reason)))
+	w.alert(notify.SeverityWarning, fmt.Sprintf("Region alert: %s connected from %s (%s)", e.Player, loc.Country, reason))
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/buildinfo"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/runner"
+)
+
+// hello describes the wrapper to the central server in session frames.
+func (s *Server) hello() *protocol.Hello {
+	capabilities := []string{
+		protocol.CapResume,
+		protocol.CapChannels,
+		protocol.CapJobs,
+		protocol.CapLocks,
+		protocol.CapLabels,
+		protocol.CapMOTD,
+		protocol.CapCapacity,
+		protocol.CapTruncation,
+		protocol.CapStreams,
+		protocol.CapLogTime,
+		protocol.CapRestart,
+		protocol.CapState,
+	}
+
+	if s.fileManager {
+		capabilities = append(capabilities, protocol.CapFiles)
+	}
+
+	if s.backups {
+		capabilities = append(capabilities, protocol.CapBackups, protocol.CapTransfer)
+	}
+
+	if s.schedules != nil {
+		capabilities = append(capabilities, protocol.CapSchedules)
+	}
+
+	if s.proxy != nil {
+		capabilities = append(capabilities, protocol.CapProxy)
+	}
+
+	if s.rollback != nil {
+		capabilities = append(capabilities, protocol.CapRollback)
+	}
+
+	if s.trash != nil {
+		capabilities = append(capabilities, protocol.CapTrash)
+	}
+
+	if s.notices != nil {
+		capabilities = append(capabilities, protocol.CapNotices)
+	}
+
+	if s.update != nil && runner.HandoffSupported {
+		capabilities = append(capabilities, protocol.CapSelfUpdate)
+	}
+
+	if s.denyList != nil {
+		capabilities = append(capabilities, protocol.CapDenyList)
+	}
+
+	if s.templates != nil {
+		capabilities = append(capabilities, protocol.CapWorlds)
+	}
+
+	return &protocol.Hello{
+		Software:     "minecraft-server-wrapper",
+		Version:      s.version,
+		Commit:       s.build.Commit,
+		BuildDate:    s.build.Date,
+		Protocol:     protocol.Version,
+		Capabilities: capabilities,
+		Timezone:     s.location.String(),
+	}
+}
+
+// centralHello records the hello the central server replied with.
+func (s *Server) centralHello(hello *protocol.Hello) {
+	if hello == nil {
+		return
+	}
+
+	if previous := s.central.Swap(hello); previous == nil || previous.Version != hello.Version {
+		fmt.Printf("Central server %s %s connected (protocol %d)\n", hello.Software, hello.Version, hello.Protocol)
+	}
+}
+
+// centralHello describes the central server to the wrappers.
+func centralHello(build buildinfo.Info) *protocol.Hello {
+	version := build.Version
+	if version == "" {
+		version = "dev"
+	}
+
+	return &protocol.Hello{
+		Software:     "minecraft-server-center",
+		Version:      version,
+		Commit:       build.Commit,
+		BuildDate:    build.Date,
+		Protocol:     protocol.Version,
+		Capabilities: []string{protocol.CapResume, protocol.CapLabels, protocol.CapJobs, protocol.CapMetrics},
+	}
+}
+
+// sendHello replies to the hello of a wrapper with the central server's.
+// Wrappers that predate the handshake are never sent one.
+func (w *WrapperConnection) sendHello() {
+	data, err := protocol.Frame{Type: protocol.FrameHello, Hello: w.hello}.Encode()
+	if err != nil {
+		fmt.Printf("Error encoding hello: %v\n", err)
+		return
+	}
+
+	select {
+	case w.sendChan <- data:
+	default:
+		fmt.Printf("Error sending hello to wrapper %s: message buffer full\n", w.ID)
+	}
+}
+
+// Hello returns what the wrapper announced in its session frame, or what a
+// wrapper that predates the handshake is assumed to support.
+func (w *WrapperConnection) Hello() protocol.Hello {
+	w.groupsMu.RLock()
+	defer w.groupsMu.RUnlock()
+
+	if w.peer == nil {
+		return protocol.LegacyHello()
+	}
+
+	return *w.peer
+}
+
+// Supports reports whether the wrapper supports a capability, so features
+// it lacks fail cleanly instead of sending it requests it doesn't know.
+func (w *WrapperConnection) Supports(capability string) bool {
+	return w.Hello().Supports(capability)
+}
+
+// Features are the optional subsystems a wrapper has enabled, for the
+// central UI to hide what a wrapper lacks instead of failing at click time.
+type Features struct {
+	Files     bool `json:"files"`
+	Backups   bool `json:"backups"`
+	Schedules bool `json:"schedules"`
+	Proxy     bool `json:"proxy"`
+	Rollback  bool `json:"rollback"`
+	Trash     bool `json:"trash"`
+}
+
+// Features reports the optional subsystems the wrapper announced.
+func (w *WrapperConnection) Features() Features {
+	hello := w.Hello()
+
+	return Features{
+		Files:     hello.Supports(protocol.CapFiles),
+		Backups:   hello.Supports(protocol.CapBackups),
+		Schedules: hello.Supports(protocol.CapSchedules),
+		Proxy:     hello.Supports(protocol.CapProxy),
+		Rollback:  hello.Supports(protocol.CapRollback),
+		Trash:     hello.Supports(protocol.CapTrash),
+	}
+}
+
+// errUnsupported is returned for requests a wrapper lacks the capability for.
+var errUnsupported = errors.New("not supported by the wrapper")
+
+// requireCapability returns an error naming the capability if the wrapper
+// doesn't support it.
+func (w *WrapperConnection) requireCapability(capability string) error {
+	if w.Supports(capability) {
+		return nil
+	}
+
+	hello := w.Hello()
+
+	return fmt.Errorf("%w: %s (wrapper %s, protocol %d)", errUnsupported, capability, hello.Version, hello.Protocol)
+}
+
+// apiCapabilities are the capabilities wrapper API paths forwarded by the
+// central server need.
+var apiCapabilities = map[string]string{
+	"/api/capacity":       protocol.CapCapacity,
+	"/api/files":          protocol.CapFiles,
+	"/api/jobs":           protocol.CapJobs,
+	"/api/lock":           protocol.CapLocks,
+	"/api/motd":           protocol.CapMOTD,
+	"/api/notices":        protocol.CapNotices,
+	"/api/packs":          protocol.CapFiles,
+	"/api/rollback":       protocol.CapRollback,
+	"/api/schedules":      protocol.CapSchedules,
+	"/api/server/restart": protocol.CapRestart,
+	"/api/server/status":  protocol.CapState,
+	"/api/trash":          protocol.CapTrash,
+	"/api/trash/undo":     protocol.CapTrash,
+	"/api/update":         protocol.CapSelfUpdate,
+	"/api/update/restart": protocol.CapSelfUpdate,
+	"/api/worlds":         protocol.CapWorlds,
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/raknet"
+)
+
+// HangConfig configures detection of a bedrock_server process that is still
+// running but no longer serving players.
+type HangConfig struct {
+	Silence      time.Duration // Time without console output before the server may be hung, zero disables
+	PingAddress  string        // Where bedrock_server answers RakNet pings
+	PingFailures int           // Consecutive failed pings before the server may be hung
+	Interval     time.Duration // Time between checks
+	JoinGrace    time.Duration // How long proxied clients may go unanswered
+}
+
+// withDefaults fills in unset values.
+func (c HangConfig) withDefaults() HangConfig {
+	if c.PingFailures <= 0 {
+		c.PingFailures = 3
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = time.Minute
+	}
+
+	if c.JoinGrace <= 0 {
+		c.JoinGrace = 30 * time.Second
+	}
+
+	return c
+}
+
+// HangReport describes why the server was considered hung. It's the summary
+// of the diagnostic bundle.
+type HangReport struct {
+	DetectedAt   time.Time `json:"detected_at"`
+	LastOutput   time.Time `json:"last_output"`
+	PingFailures int       `json:"ping_failures"`
+	PingError    string    `json:"ping_error"`
+	JoinsBlocked string    `json:"joins_blocked"` // How blocked joins were established
+	Pid          int       `json:"pid"`
+}
+
+// WatchHangs checks bedrock_server until it exits and force restarts it when
+// it is hung: no console output for the silence period AND RakNet pings
+// failing AND players unable to join. With the UDP proxy, players can't join
+// when their packets go unanswered; without it, failing pings stand in for
+// that. A diagnostic bundle is written to <app-dir>/diagnostics before the
+// process is killed, and the wrapper exits with it so its supervisor starts
+// a fresh one.
+func (s *Server) WatchHangs(config HangConfig) {
+	if config.Silence <= 0 {
+		return
+	}
+
+	config = config.withDefaults()
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	failures := 0
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.runner.Done():
+			return
+		}
+
+		_, pingErr := raknet.GetPong(config.PingAddress)
+		if pingErr == nil {
+			failures = 0
+			continue
+		}
+
+		failures++
+
+		lastOutput := time.Unix(0, s.lastOutput.Load())
+		if time.Since(lastOutput) < config.Silence || failures < config.PingFailures {
+			continue
+		}
+
+		joins := "ping failing (UDP proxy disabled)"
+
+		if s.proxy != nil {
+			stats := s.proxy.Stats()
+			if !stats.Unanswered(config.JoinGrace) {
+				continue
+			}
+
+			joins = fmt.Sprintf("clients unanswered since %s", stats.LastUpstreamReply.Format(time.RFC3339))
+		}
+
+		s.restartHung(HangReport{
+			DetectedAt:   time.Now().UTC(),
+			LastOutput:   lastOutput.UTC(),
+			PingFailures: failures,
+			PingError:    pingErr.Error(),
+			JoinsBlocked: joins,
+			Pid:          s.runner.Pid(),
+		})
+
+		return
+	}
+}
+
+// restartHung alerts clients, captures diagnostics and kills the hung server.
+func (s *Server) restartHung(report HangReport) {
+	alert := fmt.Sprintf("[wrapper] Server hung: no output since %s, %d failed pings, %s; force restarting",
+		report.LastOutput.Format(time.RFC3339), report.PingFailures, report.JoinsBlocked)
+
+	s.alert(alert)
+
+	path, err := s.writeHangBundle(report)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing hang diagnostics: %v\n", err)
+	} else {
+		s.publish("[wrapper] Hang diagnostics saved to " + path)
+	}
+
+	err = s.runner.Kill()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error restarting hung server: %v\n", err)
+	}
+}
+
+// writeHangBundle writes a gzipped tarball with the hang summary, the
+// buffered console, the process state from /proc and the wrapper's
+// goroutines, and returns its path.
+func (s *Server) writeHangBundle(report HangReport) (string, error) {
+	dir := filepath.Join(s.appDir, "diagnostics")
+
+	err := os.MkdirAll(dir, 0750)
+	if err != nil {
+		return "", fmt.Errorf("error creating diagnostics directory: %w", err)
+	}
+
+	path := filepath.Join(dir, "hang-"+report.DetectedAt.Format("20060102-150405")+".tar.gz")
+
+	f, err := os.Create(path) // #nosec G304
+	if err != nil {
+		return "", fmt.Errorf("error creating diagnostic bundle: %w", err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	files := map[string][]byte{}
+
+	files["summary.json"], _ = json.MarshalIndent(report, "", "  ")
+
+	s.connLock.RLock()
+	var console strings.Builder
+	for _, line := range s.console.lines {
+		console.WriteString(line.text + "\n")
+	}
+	s.connLock.RUnlock()
+
+	files["console.log"] = []byte(console.String())
+
+	// Unreadable entries, such as the kernel stack without privileges, are
+	// left out
+	if report.Pid != 0 {
+		proc := fmt.Sprintf("/proc/%d", report.Pid)
+
+		for _, name := range []string{"status", "stat", "wchan", "stack", "io", "limits"} {
+			data, err := os.ReadFile(filepath.Join(proc, name)) // #nosec G304
+			if err == nil {
+				files["process/"+name] = data
+			}
+		}
+
+		var threads strings.Builder
+
+		tasks, _ := filepath.Glob(filepath.Join(proc, "task", "*", "stat"))
+		for _, task := range tasks {
+			data, err := os.ReadFile(task) // #nosec G304
+			if err == nil {
+				threads.Write(data)
+			}
+		}
+
+		files["process/threads"] = []byte(threads.String())
+	}
+
+	var goroutines strings.Builder
+
+	err = pprof.Lookup("goroutine").WriteTo(&goroutines, 2)
+	if err == nil {
+		files["wrapper-goroutines.txt"] = []byte(goroutines.String())
+	}
+
+	for name, data := range files {
+		err = tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: report.DetectedAt,
+		})
+		if err == nil {
+			_, err = tw.Write(data)
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("error writing diagnostic bundle: %w", err)
+		}
+	}
+
+	err = tw.Close()
+	if err == nil {
+		err = gz.Close()
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error writing diagnostic bundle: %w", err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/cloud"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notify"
+)
+
+const (
+	// hostTimeout bounds a cloud provider request.
+	hostTimeout = 30 * time.Second
+
+	// hostActor is the actor of actions taken by host policies.
+	hostActor = "policy"
+)
+
+// SetHost sets the VM hosting the wrapper, powered on and off through a
+// cloud provider.
+func (w *WrapperConnection) SetHost(host *cloud.Host) {
+	w.groupsMu.Lock()
+	w.host = host
+	w.groupsMu.Unlock()
+}
+
+// Host returns the VM hosting the wrapper, or nil if it isn't managed.
+func (w *WrapperConnection) Host() *cloud.Host {
+	w.groupsMu.RLock()
+	defer w.groupsMu.RUnlock()
+
+	return w.host
+}
+
+// hostStatus returns the state of the VM hosting the wrapper, or nil if it
+// isn't managed.
+func (w *WrapperConnection) hostStatus() *cloud.Status {
+	host := w.Host()
+	if host == nil {
+		return nil
+	}
+
+	status := host.Status(time.Now())
+
+	return &status
+}
+
+// manageHost refreshes the state of the VM hosting the wrapper and takes
+// the action its policy calls for.
+func (w *WrapperConnection) manageHost(now time.Time, players int) {
+	host := w.Host()
+	if host == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hostTimeout)
+	defer cancel()
+
+	host.Refresh(ctx)
+
+	action := host.Due(now, players)
+	if action == "" {
+		return
+	}
+
+	err := host.Apply(ctx, now, action, hostActor)
+	if err != nil {
+		fmt.Printf("Error taking host action %s for wrapper %s: %v\n", action, w.ID, err)
+		w.alert(notify.SeverityWarning, fmt.Sprintf("Host %s by policy failed: %v", action, err))
+
+		return
+	}
+
+	fmt.Printf("Host of wrapper %s (%s): %s by policy\n", w.Name, w.ID, action)
+	w.broadcast([]byte(fmt.Sprintf("[central] Host %s by policy",
+		map[string]string{cloud.ActionStart: "starting", cloud.ActionStop: "stopping"}[action])))
+}
+
+// Hosts manages the VMs hosting wrappers every interval until the manager
+// is shut down: their state is refreshed, and they are powered on for
+// sessions and off when idle.
+func (m *ConnectionManager) Hosts(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			var managed []*WrapperConnection
+
+			for _, wConn := range m.ListConnections() {
+				if wConn.Host() != nil {
+					managed = append(managed, wConn)
+				}
+			}
+
+			pings := pingServers(managed)
+
+			var wg sync.WaitGroup
+
+			for i, wConn := range managed {
+				players := -1
+				if pings[i].online {
+					players = pings[i].pong.PlayerCount
+				}
+
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					wConn.manageHost(now, players)
+				}()
+			}
+
+			wg.Wait()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// handleHost returns the state of the VM hosting a wrapper (GET) or powers
+// it on or off with ?action=start or stop (POST).
+func (s *CentralServer) handleHost(w http.ResponseWriter, r *http.Request) {
+	wConn, exists := s.manager.GetConnection(r.URL.Query().Get("wrapper"))
+	if !exists {
+		http.Error(w, "Wrapper not found", http.StatusNotFound)
+		return
+	}
+
+	host := wConn.Host()
+	if host == nil {
+		http.Error(w, "The wrapper's host isn't managed", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if requestUser(r).Access(wConn) != AccessOperate {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), hostTimeout)
+		defer cancel()
+
+		action := r.URL.Query().Get("action")
+
+		err := host.Apply(ctx, time.Now(), action, requestUser(r).Name)
+		if err != nil {
+			hostError(w, err)
+			return
+		}
+
+		fmt.Printf("Host of wrapper %s (%s): %s by %s\n", wConn.Name, wConn.ID, action, requestUser(r).Name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(host.Status(time.Now()))
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// hostError reports a host API error with a matching status.
+func hostError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, cloud.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, cloud.ErrProvider):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 10 * time.Minute // Long enough to upload a world snapshot
+	defaultWriteTimeout      = 10 * time.Minute // Long enough to download one
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultSocketMode        = 0o660 // Owner and group may connect
+)
+
+// HTTPConfig holds the timeouts of a web server and its TLS certificate.
+// Zero timeouts are replaced by the defaults. WebSocket connections aren't
+// bound by them once upgraded.
+type HTTPConfig struct {
+	ReadHeaderTimeout time.Duration // Deadline for the headers of a request, which stops slowloris clients
+	ReadTimeout       time.Duration // Deadline for a whole request, including its body
+	WriteTimeout      time.Duration // Deadline for a whole response, from the end of the request headers
+	IdleTimeout       time.Duration // How long idle keep-alive connections are kept open
+
+	// TLSCert and TLSKey are PEM files to serve HTTPS with, and HTTP/2 for
+	// clients that support it. Plain HTTP/1.1 is served if empty.
+	TLSCert string
+	TLSKey  string
+
+	// SocketMode and SocketGroup are the permissions and the group (name or
+	// ID) of Unix sockets, which decide who may connect to them. The mode is
+	// 0660 if zero and the group is left alone if empty.
+	SocketMode  fs.FileMode
+	SocketGroup string
+}
+
+// DefaultHTTP returns the default web server settings.
+func DefaultHTTP() HTTPConfig {
+	return HTTPConfig{
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		ReadTimeout:       defaultReadTimeout,
+		WriteTimeout:      defaultWriteTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+		SocketMode:        defaultSocketMode,
+	}
+}
+
+// withDefaults returns a copy of the config with zero values replaced by defaults.
+func (c HTTPConfig) withDefaults() HTTPConfig {
+	def := DefaultHTTP()
+
+	if c.ReadHeaderTimeout <= 0 {
+		c.ReadHeaderTimeout = def.ReadHeaderTimeout
+	}
+
+	if c.ReadTimeout <= 0 {
+		c.ReadTimeout = def.ReadTimeout
+	}
+
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = def.WriteTimeout
+	}
+
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = def.IdleTimeout
+	}
+
+	if c.SocketMode == 0 {
+		c.SocketMode = def.SocketMode
+	}
+
+	return c
+}
+
+// Validate checks that the web server settings are consistent.
+func (c HTTPConfig) Validate() error {
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("a TLS certificate and key must be given together")
+	}
+
+	c = c.withDefaults()
+
+	if c.ReadHeaderTimeout > c.ReadTimeout {
+		return fmt.Errorf("read header timeout (%s) must not be longer than read timeout (%s)",
+			c.ReadHeaderTimeout, c.ReadTimeout)
+	}
+
+	if c.SocketMode&^fs.ModePerm != 0 {
+		return fmt.Errorf("invalid socket mode %o", uint32(c.SocketMode))
+	}
+
+	if c.SocketGroup != "" {
+		_, err := lookupGroup(c.SocketGroup)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lookupGroup returns the ID of a group given by name or ID.
+func lookupGroup(group string) (int, error) {
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		g, err = user.LookupGroupId(group)
+		if err != nil {
+			return 0, fmt.Errorf("unknown socket group %q", group)
+		}
+	}
+
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing ID of group %q: %w", group, err)
+	}
+
+	return gid, nil
+}
+
+// scheme returns the URL scheme the server is reached with.
+func (c HTTPConfig) scheme() string {
+	if c.TLSCert != "" {
+		return "https"
+	}
+
+	return "http"
+}
+
+// newServer returns a web server for handler, speaking HTTP/2 as well as
+// HTTP/1.1 with TLS. WebSocket clients still upgrade over HTTP/1.1.
+func (c HTTPConfig) newServer(handler http.Handler) *http.Server {
+	c = c.withDefaults()
+
+	var protocols http.Protocols
+
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(c.TLSCert != "")
+
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		Protocols:         &protocols,
+		ConnContext:       markLocal,
+	}
+}
+
+// localKey is the context key marking requests that came over a Unix socket.
+type localKey struct{}
+
+// markLocal marks the requests of connections over a Unix socket.
+func markLocal(ctx context.Context, conn net.Conn) context.Context {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+
+	if _, ok := conn.(*net.UnixConn); ok {
+		return context.WithValue(ctx, localKey{}, true)
+	}
+
+	return ctx
+}
+
+// isLocal reports whether r came over a Unix socket, where the permissions
+// of the socket already decided who may connect.
+func isLocal(r *http.Request) bool {
+	local, _ := r.Context().Value(localKey{}).(bool)
+
+	return local
+}
+
+// SplitListen splits a comma-separated list of listen addresses, such as
+// ":8080,[::1]:8080,/run/wrapper.sock".
+func SplitListen(list string) []string {
+	var addrs []string
+
+	for _, addr := range strings.Split(list, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs
+}
+
+// IsUnixSocket reports whether a listen address is the path of a Unix socket
+// rather than a TCP address.
+func IsUnixSocket(addr string) bool {
+	return strings.ContainsRune(addr, '/')
+}
+
+// listen opens a listener on a TCP address, e.g. ":8080" for all IPv4 and
+// IPv6 addresses or "[::1]:8080", or on a Unix socket path. A socket file
+// left behind by an earlier run is replaced.
+func (c HTTPConfig) listen(addr string) (net.Listener, error) {
+	if !IsUnixSocket(addr) {
+		return net.Listen("tcp", addr)
+	}
+
+	info, err := os.Lstat(addr)
+	if err == nil && info.Mode()&fs.ModeSocket != 0 {
+		err = os.Remove(addr)
+		if err != nil {
+			return nil, fmt.Errorf("error removing stale socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.secureSocket(addr)
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// secureSocket sets the permissions and the group of a Unix socket.
+func (c HTTPConfig) secureSocket(path string) error {
+	c = c.withDefaults()
+
+	err := os.Chmod(path, c.SocketMode)
+	if err != nil {
+		return fmt.Errorf("error setting socket permissions: %w", err)
+	}
+
+	if c.SocketGroup == "" {
+		return nil
+	}
+
+	gid, err := lookupGroup(c.SocketGroup)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chown(path, -1, gid)
+	if err != nil {
+		return fmt.Errorf("error setting socket group: %w", err)
+	}
+
+	return nil
+}
+
+// listenURL returns how a listen address is reached, for log messages.
+func (c HTTPConfig) listenURL(addr string) string {
+	if IsUnixSocket(addr) {
+		return "unix:" + addr
+	}
+
+	return c.scheme() + "://" + addr
+}
+
+// serve serves HTTP, or HTTPS with the configured certificate, on all addrs
+// and the extra listeners until one of them fails or the server is shut
+// down. All addresses are opened before serving so a bad one fails the
+// start.
+func (c HTTPConfig) serve(server *http.Server, addrs []string, extra ...net.Listener) error {
+	if len(addrs) == 0 && len(extra) == 0 {
+		return errors.New("no listen address")
+	}
+
+	listeners := make([]net.Listener, 0, len(addrs)+len(extra))
+
+	for _, addr := range addrs {
+		l, err := c.listen(addr)
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+
+			return fmt.Errorf("error listening on %s: %w", addr, err)
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	listeners = append(listeners, extra...)
+
+	errs := make(chan error, len(listeners))
+
+	for _, l := range listeners {
+		go func() {
+			if c.TLSCert != "" {
+				errs <- server.ServeTLS(l, c.TLSCert, c.TLSKey)
+				return
+			}
+
+			errs <- server.Serve(l)
+		}()
+	}
+
+	// The other listeners are closed with the server when one fails
+	err := <-errs
+	if !errors.Is(err, http.ErrServerClosed) {
+		_ = server.Close()
+	}
+
+	return err
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+// idleChecks is how many times per idle timeout the central server looks
+// for idle browser consoles.
+const idleChecks = 6
+
+// idleTracker records when a browser client's user last interacted with
+// it. Other clients, such as the central server connecting to a wrapper,
+// are never idle.
+type idleTracker struct {
+	browser bool
+	last    atomic.Int64 // Unix nanoseconds
+}
+
+// isBrowser reports whether a WebSocket request comes from a browser, which
+// always sends an Origin header with the handshake.
+func isBrowser(r *http.Request) bool {
+	return r.Header.Get("Origin") != ""
+}
+
+// newIdleTracker returns a tracker for a client connecting with r.
+func newIdleTracker(r *http.Request) *idleTracker {
+	t := &idleTracker{browser: isBrowser(r)}
+	t.touch()
+
+	return t
+}
+
+// touch records an interaction.
+func (t *idleTracker) touch() {
+	t.last.Store(time.Now().UnixNano())
+}
+
+// idle reports whether a browser client went without interaction for
+// timeout. A zero timeout disables it.
+func (t *idleTracker) idle(timeout time.Duration, now time.Time) bool {
+	return timeout > 0 && t.browser && now.Sub(time.Unix(0, t.last.Load())) >= timeout
+}
+
+// closeIdle disconnects an idle client with a reason the web console
+// shows. Reading from the client fails once it acknowledges the close, or
+// doesn't within writeWait.
+func closeIdle(conn *websocket.Conn, timeout, writeWait time.Duration) {
+	reason := fmt.Sprintf("Disconnected after %s without activity", timeout)
+	deadline := time.Now().Add(writeWait)
+
+	err := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(protocol.CloseIdle, reason), deadline)
+	if err != nil {
+		fmt.Printf("Error closing idle client: %v\n", err)
+	}
+
+	_ = conn.SetReadDeadline(deadline)
+}
+
+// isActivity reports whether a message from a browser console of the
+// central server is an activity frame rather than a command.
+func isActivity(message []byte) bool {
+	if len(message) == 0 || message[0] != '{' {
+		return false
+	}
+
+	frame, err := protocol.Decode(message)
+
+	return err == nil && frame.Type == protocol.FrameActivity
+}
+
+// evictIdle disconnects a browser console once it's idle, until stop is
+// closed.
+func (s *CentralServer) evictIdle(ws *websocket.Conn, active *idleTracker, stop <-chan struct{}) {
+	if s.idleTimeout <= 0 || !active.browser {
+		return
+	}
+
+	ticker := time.NewTicker(max(s.idleTimeout/idleChecks, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if active.idle(s.idleTimeout, now) {
+				closeIdle(ws, s.idleTimeout, defaultWriteWait)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+)
+
+// publishJob buffers a job update and broadcasts it to the clients
+// subscribed to the jobs channel. It is called under the job manager's lock.
+func (s *Server) publishJob(job jobs.Job) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		fmt.Printf("Error encoding job update: %v\n", err)
+		return
+	}
+
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+
+	line := s.jobUpdates.append(string(data), "", time.Now().UTC(), time.Time{})
+
+	for c := range s.connections {
+		if c.structured && c.wants(line.channel) {
+			s.queue(c, c.encode(line))
+		}
+	}
+}
+
+// handleJobs lists the jobs of the wrapper, or returns one with ?id= (GET),
+// or cancels one (DELETE).
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	var result any
+
+	switch r.Method {
+	case http.MethodGet:
+		if id == "" {
+			result = s.jobs.List("")
+			break
+		}
+
+		job, ok := s.jobs.Get(id)
+		if !ok {
+			http.Error(w, jobs.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		result = job
+	case http.MethodDelete:
+		err := s.jobs.Cancel(id)
+		if err != nil {
+			jobError(w, err)
+			return
+		}
+
+		err = s.audit.Record(audit.Entry{Actor: actor(r), Action: "job.cancel", Target: id})
+		if err != nil {
+			fmt.Printf("Error recording job cancellation: %v\n", err)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// jobError reports a job API error with a matching status.
+func jobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, jobs.ErrFinished):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
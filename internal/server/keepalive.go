@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultPingInterval     = 54 * time.Second
+	defaultPongWait         = 60 * time.Second
+	defaultWriteWait        = 10 * time.Second
+	defaultHandshakeTimeout = 10 * time.Second
+)
+
+// KeepaliveConfig holds the WebSocket keepalive and deadline settings.
+// Zero values are replaced by the defaults.
+type KeepaliveConfig struct {
+	PingInterval     time.Duration // How often pings are sent to the peer
+	PongWait         time.Duration // How long to wait for any message (or pong) before giving up
+	WriteWait        time.Duration // Deadline for a single write
+	HandshakeTimeout time.Duration // Deadline for the WebSocket handshake
+
+	// IdleTimeout disconnects browser clients whose user didn't interact
+	// with the page this long, zero never does
+	IdleTimeout time.Duration
+}
+
+// DefaultKeepalive returns the default keepalive settings.
+func DefaultKeepalive() KeepaliveConfig {
+	return KeepaliveConfig{
+		PingInterval:     defaultPingInterval,
+		PongWait:         defaultPongWait,
+		WriteWait:        defaultWriteWait,
+		HandshakeTimeout: defaultHandshakeTimeout,
+	}
+}
+
+// withDefaults returns a copy of the config with zero values replaced by defaults.
+func (k KeepaliveConfig) withDefaults() KeepaliveConfig {
+	def := DefaultKeepalive()
+
+	if k.PingInterval <= 0 {
+		k.PingInterval = def.PingInterval
+	}
+
+	if k.PongWait <= 0 {
+		k.PongWait = def.PongWait
+	}
+
+	if k.WriteWait <= 0 {
+		k.WriteWait = def.WriteWait
+	}
+
+	if k.HandshakeTimeout <= 0 {
+		k.HandshakeTimeout = def.HandshakeTimeout
+	}
+
+	return k
+}
+
+// Validate checks that the keepalive settings are consistent.
+func (k KeepaliveConfig) Validate() error {
+	k = k.withDefaults()
+
+	if k.PingInterval >= k.PongWait {
+		return fmt.Errorf("ping interval (%s) must be shorter than pong wait (%s)", k.PingInterval, k.PongWait)
+	}
+
+	if k.IdleTimeout < 0 {
+		return fmt.Errorf("idle timeout (%s) must not be negative", k.IdleTimeout)
+	}
+
+	return nil
+}
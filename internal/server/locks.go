@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/oplock"
+)
+
+// acquire takes the operation lock for a request. With ?wait=true the
+// request queues behind the operation holding it, noting that in the log
+// of its job if it has one, and otherwise it is rejected.
+func (s *Server) acquire(ctx context.Context, h *jobs.Handle, r *http.Request, operation string) (func(), error) {
+	wait := r.URL.Query().Get("wait") == "true"
+
+	if holder := s.ops.Status().Holder; wait && holder != nil && h != nil {
+		h.Logf("waiting for %s to finish", holder.Operation)
+	}
+
+	return s.ops.Acquire(ctx, operation, actor(r), wait)
+}
+
+// lockError reports an error taking the operation lock with a matching
+// status.
+func lockError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, oplock.ErrBusy):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleLock reports the operation holding the lock, such as a backup or an
+// upgrade, and the operations queued behind it.
+func (s *Server) handleLock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(s.ops.Status())
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
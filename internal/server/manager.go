@@ -1,16 +1,36 @@
 package server
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/activity"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/autoscale"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/buildinfo"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/cloud"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/events"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/geoip"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notify"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/operators"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/proxy"
 	"github.com/jsandas/gogo-mc-bedrock-server/internal/raknet"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/timeline"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/uptime"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/usage"
 )
 
 // WrapperStatus represents the current status of a wrapper connection.
@@ -36,6 +56,22 @@ type ConnectionStats struct {
 	MessagesSent     int64     `json:"messages_sent"`
 	MessagesReceived int64     `json:"messages_received"`
 	Reconnections    int       `json:"reconnections"`
+	SequenceGaps     int64     `json:"sequence_gaps"`   // Gaps detected in the console line sequence
+	LinesRecovered   int64     `json:"lines_recovered"` // Missing lines received through retransmission
+	LinesLost        int64     `json:"lines_lost"`      // Lines the wrapper could no longer retransmit
+	BytesSent        int64     `json:"bytes_sent"`
+	BytesReceived    int64     `json:"bytes_received"`
+
+	// Averages over the last minute, per second
+	SendRate        float64 `json:"send_rate"`
+	ReceiveRate     float64 `json:"receive_rate"`
+	SendByteRate    float64 `json:"send_byte_rate"`
+	ReceiveByteRate float64 `json:"receive_byte_rate"`
+
+	Errors []ConnectionError `json:"errors,omitempty"` // Recent connection errors, oldest first
+
+	LinkRTT     LatencyStats `json:"link_rtt"`     // WebSocket ping round trips to the wrapper
+	PingLatency LatencyStats `json:"ping_latency"` // RakNet pings to the game port
 }
 
 // WrapperConnection represents a connection to a remote Minecraft server wrapper.
@@ -59,23 +95,147 @@ type WrapperConnection struct {
 	reconnectSignal chan struct{}
 	reconnectMu     sync.Mutex
 	statsMu         sync.RWMutex
+	sent            rateCounter
+	received        rateCounter
+	errors          []ConnectionError
+	linkRTT         latencyWindow
+	pingLatency     latencyWindow
+	routines        *routineTracker
+	keepalive       KeepaliveConfig
+	epoch           string           // Session epoch reported by the wrapper
+	tracker         protocol.Tracker // Sequence numbers of received console lines
+	resumeMu        sync.Mutex
+	activity        *activity.Store // Player activity storage, nil if disabled
+	playtimeRules   []activity.Rule
+	rulesMu         sync.RWMutex
+	geoip           *geoip.Reader // Locates player connections, nil if disabled
+	regionAlerts    RegionAlerts
+	denyListSynced  atomic.Uint64     // Version of the fleet deny list the wrapper has
+	uptime          *uptime.Store     // Status samples, nil if disabled
+	usage           *usage.Store      // Power and player samples, nil if disabled
+	stoppedAt       atomic.Int64      // When the server last logged that it's stopping, in Unix nanoseconds
+	pongIPv4Port    atomic.Int32      // Port the server advertised for IPv4 in its last pong, zero if unknown
+	pongIPv6Port    atomic.Int32      // Port the server advertised for IPv6 in its last pong, zero if unknown
+	readOnly        *atomic.Bool      // Shared with the manager, blocks sending commands
+	groups          []string          // Groups used to grant users access
+	labels          map[string]string // Metadata reported by the wrapper in its session frame
+	peer            *protocol.Hello   // Hello of the wrapper, nil if it predates the handshake
+	host            *cloud.Host       // VM hosting the wrapper, nil if it isn't managed
+	rate            usage.Rate        // What running the wrapper's host costs
+	groupsMu        sync.RWMutex      // Guards groups, labels, peer, host and rate
+	hello           *protocol.Hello   // Hello of the central server
+	notifications   *notifications    // Shared with the manager, nil without channels
+	relay           *relayHub         // Shared with the manager, nil unless reached through a relay link
+
+	// operatorDrift is the last check of permissions.json against the
+	// fleet's operator list, nil until the first
+	operatorDrift atomic.Pointer[OperatorDrift]
+
+	// timeline records the wrapper's significant events, shared with the
+	// manager, nil if disabled. The last uptime sample is kept to notice
+	// crashes and upgrades, only touched by sampleUptime.
+	timeline    *timeline.Store
+	sampled     bool
+	wasUp       bool
+	lastVersion string
+}
+
+// ConnectionManagerConfig holds configuration for the connection manager.
+type ConnectionManagerConfig struct {
+	Keepalive KeepaliveConfig
+	Activity  *activity.Store // Records player joins and leaves seen on the consoles
+
+	GeoIP        *geoip.Reader // Local database locating player connections, nil to disable
+	RegionAlerts RegionAlerts
+
+	DenyList  *proxy.DenyList   // Fleet-wide deny list pushed to the wrappers, nil to disable
+	Uptime    *uptime.Store     // Records status samples for uptime reports, nil to disable
+	Usage     *usage.Store      // Records power and player samples for usage reports, nil to disable
+	Autoscale *autoscale.Scaler // Starts instances when servers stay full, nil to disable
+	ReadOnly  bool              // Start with sending commands blocked
+	Build     buildinfo.Info    // Version, commit and build date of the central server, sent to wrappers in its hello
+	Notifier  *notify.Notifier  // Sends alerts to notification channels, nil to disable
+	Operators *operators.Store  // Canonical permissions.json of the wrappers, nil to disable drift checks
+	Timeline  *timeline.Store   // Records significant events of the fleet, nil to disable
 }
 
 // ConnectionManager manages multiple wrapper connections.
 type ConnectionManager struct {
-	connections map[string]*WrapperConnection
-	mu          sync.RWMutex
+	connections  map[string]*WrapperConnection
+	mu           sync.RWMutex
+	stop         chan struct{}
+	stopOnce     sync.Once
+	keepalive    KeepaliveConfig
+	activity     *activity.Store
+	geoip        *geoip.Reader
+	regionAlerts RegionAlerts
+
+	denyList        *proxy.DenyList
+	denyListVersion atomic.Uint64
+	uptime          *uptime.Store
+	usage           *usage.Store
+	autoscale       *autoscale.Scaler
+	readOnly        atomic.Bool
+	hello           *protocol.Hello // Sent to wrappers that speak the handshake
+	build           buildinfo.Info  // Reported by /api/about
+	notifications   *notifications  // nil without notification channels
+	relay           *relayHub       // Relay links of wrappers behind NAT
+	operators       *operators.Store
+	timeline        *timeline.Store
 }
 
 // NewConnectionManager creates a new connection manager.
-func NewConnectionManager() *ConnectionManager {
-	return &ConnectionManager{
-		connections: make(map[string]*WrapperConnection),
+func NewConnectionManager(config ConnectionManagerConfig) *ConnectionManager {
+	m := &ConnectionManager{
+		connections:  make(map[string]*WrapperConnection),
+		stop:         make(chan struct{}),
+		keepalive:    config.Keepalive.withDefaults(),
+		activity:     config.Activity,
+		geoip:        config.GeoIP,
+		regionAlerts: config.RegionAlerts,
+		denyList:     config.DenyList,
+		uptime:       config.Uptime,
+		usage:        config.Usage,
+		autoscale:    config.Autoscale,
+		hello:        centralHello(config.Build),
+		build:        config.Build,
+
+		notifications: newNotifications(config.Notifier),
+		relay:         newRelayHub(),
+		operators:     config.Operators,
+		timeline:      config.Timeline,
 	}
+
+	m.readOnly.Store(config.ReadOnly)
+
+	// Wrappers start out at version zero, so the list is pushed to each once
+	m.denyListVersion.Store(1)
+
+	return m
 }
 
 // Connect establishes a connection to a remote wrapper.
 func (m *ConnectionManager) Connect(id, name, address, username, password, sharedKey string) error {
+	return m.connect(id, name, address, username, password, sharedKey, nil)
+}
+
+// ConnectRelayed establishes a connection to a wrapper the central server
+// can't reach, such as one behind CGNAT, through the relay link the wrapper
+// opens to it. The address only sets the path and scheme; if empty it
+// defaults to a plain WebSocket at /ws.
+func (m *ConnectionManager) ConnectRelayed(id, name, address, username, password, sharedKey string) error {
+	if sharedKey == "" {
+		return fmt.Errorf("relayed wrapper %s needs a shared key", id)
+	}
+
+	if address == "" {
+		address = relayAddress
+	}
+
+	return m.connect(id, name, address, username, password, sharedKey, m.relay)
+}
+
+func (m *ConnectionManager) connect(id, name, address, username, password, sharedKey string, relay *relayHub) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -98,6 +258,18 @@ func (m *ConnectionManager) Connect(id, name, address, username, password, share
 		clients:         make(map[*websocket.Conn]bool),
 		done:            make(chan struct{}),
 		reconnectSignal: make(chan struct{}),
+		routines:        newRoutineTracker(),
+		keepalive:       m.keepalive,
+		activity:        m.activity,
+		geoip:           m.geoip,
+		regionAlerts:    m.regionAlerts,
+		uptime:          m.uptime,
+		usage:           m.usage,
+		readOnly:        &m.readOnly,
+		hello:           m.hello,
+		notifications:   m.notifications,
+		relay:           relay,
+		timeline:        m.timeline,
 	}
 
 	m.connections[id] = wConn
@@ -153,6 +325,44 @@ func (w *WrapperConnection) Retry() error {
 	}
 }
 
+// SetGroups sets the groups the wrapper belongs to.
+func (w *WrapperConnection) SetGroups(groups []string) {
+	w.groupsMu.Lock()
+	w.groups = groups
+	w.groupsMu.Unlock()
+}
+
+// Groups returns the groups the wrapper belongs to.
+func (w *WrapperConnection) Groups() []string {
+	w.groupsMu.RLock()
+	defer w.groupsMu.RUnlock()
+
+	return w.groups
+}
+
+// Labels returns the labels the wrapper reported, such as its owner or
+// environment.
+func (w *WrapperConnection) Labels() map[string]string {
+	w.groupsMu.RLock()
+	defer w.groupsMu.RUnlock()
+
+	return w.labels
+}
+
+// HasLabels reports whether the wrapper has all the given labels.
+func (w *WrapperConnection) HasLabels(want map[string]string) bool {
+	labels := w.Labels()
+
+	for key, value := range want {
+		v, ok := labels[key]
+		if !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
 // AddClient adds a web client connection to this wrapper.
 func (w *WrapperConnection) AddClient(client *websocket.Conn) {
 	w.clientsMu.Lock()
@@ -169,6 +379,10 @@ func (w *WrapperConnection) RemoveClient(client *websocket.Conn) {
 
 // SendMessage sends a message to the wrapper.
 func (w *WrapperConnection) SendMessage(message []byte) error {
+	if w.readOnly.Load() {
+		return ErrReadOnly
+	}
+
 	if w.Status != StatusConnected {
 		return fmt.Errorf("wrapper is not connected (status: %s)", w.Status)
 	}
@@ -185,48 +399,159 @@ func (w *WrapperConnection) SendMessage(message []byte) error {
 
 // GetServerStatus gets the current Minecraft server status using GetPong.
 func (w *WrapperConnection) GetServerStatus() (map[string]interface{}, error) {
-	// Extract host from the address
-	addr := w.Address
-	if addr == "" {
-		return nil, fmt.Errorf("wrapper address is empty")
+	pong, err := w.ping()
+	if err != nil {
+		return nil, err
 	}
 
-	// Convert from ws:// to regular address and extract host
-	addr = strings.TrimPrefix(addr, "ws://")
-	addr = strings.TrimSuffix(addr, "/ws")
+	return map[string]interface{}{
+		"serverName":     pong.ServerName,
+		"versionName":    pong.VersionName,
+		"levelName":      pong.LevelName,
+		"gameMode":       pong.GameMode,
+		"playerCount":    pong.PlayerCount,
+		"maxPlayerCount": pong.MaxPlayerCount,
+	}, nil
+}
 
-	// Split host and port
-	host := addr
-	if idx := strings.LastIndex(addr, ":"); idx != -1 {
-		host = addr[:idx]
+// GetServerQuery adds the players and plugins reported by the query
+// protocol to the server status. Servers must have enable-query set.
+func (w *WrapperConnection) GetServerQuery(status map[string]interface{}) error {
+	q, err := w.query()
+	if err != nil {
+		return err
 	}
 
-	if host == "localhost" {
-		host = "127.0.0.1"
+	status["players"] = q.Players
+	status["plugins"] = q.Plugins
+	status["serverEngine"] = q.ServerEngine
+
+	return nil
+}
+
+// Pings of the Minecraft servers on wrapper hosts.
+const (
+	pingTimeout = 3 * time.Second // Of each attempt
+	pingRetries = 1               // Attempts after a lost pong
+	pingWorkers = 16              // Pings in flight when polling all wrappers
+)
+
+// pingOptions are the options of pings of the Minecraft servers.
+var pingOptions = raknet.PingOptions{Timeout: pingTimeout, Retries: pingRetries}
+
+// ping pings the Minecraft server on the wrapper's host.
+func (w *WrapperConnection) ping() (raknet.Pong, error) {
+	mcAddr, err := w.pingAddress()
+	if err != nil {
+		return raknet.Pong{}, err
 	}
 
-	// Check if we have a custom port from environment
-	serverPort := "19132" // Default Minecraft Bedrock port
-	if port := os.Getenv("CFG_SERVER_PORT"); port != "" {
-		serverPort = port
+	return w.pinged(raknet.Ping(context.Background(), mcAddr, pingOptions))
+}
+
+// pinged records the latency of a successful ping of the wrapper's server
+// and the ports it advertised.
+func (w *WrapperConnection) pinged(result raknet.PingResult) (raknet.Pong, error) {
+	if result.Err != nil {
+		return result.Pong, fmt.Errorf("error getting server status from %s: %v", result.Addr, result.Err)
 	}
 
-	// Combine host and Minecraft server port
-	mcAddr := fmt.Sprintf("%s:%s", host, serverPort)
+	w.observePing(result.RTT)
+	w.pongIPv4Port.Store(int32(result.Pong.Port(false))) // #nosec G115
+	w.pongIPv6Port.Store(int32(result.Pong.Port(true)))  // #nosec G115
 
-	pong, err := raknet.GetPong(mcAddr)
+	return result.Pong, nil
+}
+
+// pingAddress returns the address of the Minecraft server on the wrapper's
+// host. The port is the one in CFG_SERVER_PORT, or CFG_SERVER_PORTV6 for an
+// IPv6 host, else the one the server advertised in its last pong, else the
+// default one.
+func (w *WrapperConnection) pingAddress() (string, error) {
+	host, err := w.minecraftHost()
 	if err != nil {
-		return nil, fmt.Errorf("error getting server status from %s: %v", mcAddr, err)
+		return "", err
 	}
 
-	return map[string]interface{}{
-		"serverName":     pong.ServerName,
-		"versionName":    pong.VersionName,
-		"levelName":      pong.LevelName,
-		"gameMode":       pong.GameMode,
-		"playerCount":    pong.PlayerCount,
-		"maxPlayerCount": pong.MaxPlayerCount,
-	}, nil
+	if isIPv6(host) {
+		return net.JoinHostPort(host, w.serverPort("CFG_SERVER_PORTV6", int(w.pongIPv6Port.Load()), "19133")), nil
+	}
+
+	return net.JoinHostPort(host, w.serverPort("CFG_SERVER_PORT", int(w.pongIPv4Port.Load()), "19132")), nil
+}
+
+// serverPort returns the port in the env variable, else the advertised port,
+// else the default one.
+func (w *WrapperConnection) serverPort(env string, advertised int, def string) string {
+	if port := os.Getenv(env); port != "" {
+		return port
+	}
+
+	if advertised > 0 {
+		return strconv.Itoa(advertised)
+	}
+
+	return def
+}
+
+// query requests the full status of the Minecraft server on the wrapper's
+// host with the GameSpy query protocol, which lists the players and plugins.
+// It is sent to the port in CFG_QUERY_PORT, or the server port.
+func (w *WrapperConnection) query() (raknet.Query, error) {
+	queryPort := os.Getenv("CFG_QUERY_PORT")
+	if queryPort == "" {
+		mcAddr, err := w.pingAddress()
+		if err != nil {
+			return raknet.Query{}, err
+		}
+
+		return raknet.GetQuery(mcAddr)
+	}
+
+	host, err := w.minecraftHost()
+	if err != nil {
+		return raknet.Query{}, err
+	}
+
+	return raknet.GetQuery(net.JoinHostPort(host, queryPort))
+}
+
+// minecraftHost returns the host of the wrapper, as an IPv4 or IPv6 address
+// or a host name.
+func (w *WrapperConnection) minecraftHost() (string, error) {
+	addr := w.Address
+	if addr == "" {
+		return "", fmt.Errorf("wrapper address is empty")
+	}
+
+	// The address is a ws:// or wss:// URL, or a bare host and port
+	if !strings.Contains(addr, "://") {
+		addr = "ws://" + addr
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", fmt.Errorf("error parsing wrapper address: %w", err)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return "", fmt.Errorf("wrapper address %q has no host", w.Address)
+	}
+
+	if host == "localhost" {
+		host = "127.0.0.1"
+	}
+
+	return host, nil
+}
+
+// isIPv6 reports whether host is an IPv6 address rather than an IPv4 one or
+// a host name. Bedrock answers IPv6 clients on a port of its own.
+func isIPv6(host string) bool {
+	ip, err := netip.ParseAddr(host)
+
+	return err == nil && ip.Is6() && !ip.Is4In6()
 }
 
 // DisconnectAll closes all wrapper connections.
@@ -234,6 +559,10 @@ func (m *ConnectionManager) DisconnectAll() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+
 	for id, wConn := range m.connections {
 		if wConn.conn != nil {
 			err := wConn.conn.Close()
@@ -245,11 +574,15 @@ func (m *ConnectionManager) DisconnectAll() {
 		close(wConn.done)
 		delete(m.connections, id)
 		fmt.Printf("Disconnected from wrapper %s (%s)\n", wConn.Name, wConn.ID)
+
+		go wConn.verifyCleanup(cleanupGrace)
 	}
 }
 
 // manage handles the connection lifecycle including automatic reconnection.
 func (w *WrapperConnection) manage() {
+	defer w.routines.track(routineManage)()
+
 	var reconnectAttempts int
 
 	for {
@@ -275,7 +608,7 @@ func (w *WrapperConnection) manage() {
 				continue
 			default:
 				if reconnectAttempts >= maxReconnectAttempts {
-					w.Error = "max reconnection attempts reached. Click retry to try again."
+					w.setError("max reconnection attempts reached. Click retry to try again.")
 					// Wait for manual retry
 					select {
 					case <-w.done:
@@ -323,22 +656,15 @@ func (w *WrapperConnection) connect() error {
 	w.reconnectMu.Lock()
 	defer w.reconnectMu.Unlock()
 
-	// Create auth header if credentials are provided
-	header := http.Header{}
-
-	if w.Username != "" {
-		auth := base64.StdEncoding.EncodeToString([]byte(w.Username + ":" + w.Password))
-		header.Set("Authorization", "Basic "+auth)
-	}
-
-	// Add the shared key header
-	if w.SharedKey != "" {
-		header.Set("X-Auth-Key", w.SharedKey)
-	}
+	header := w.authHeader()
 
 	// Connect to the wrapper
 	dialer := websocket.Dialer{
-		HandshakeTimeout: 10 * time.Second,
+		HandshakeTimeout: w.keepalive.HandshakeTimeout,
+	}
+
+	if w.relay != nil {
+		dialer.NetDialContext = w.relay.dialContext(w.ID, w.keepalive.WriteWait)
 	}
 
 	// Check if there's already an active connection
@@ -351,21 +677,29 @@ func (w *WrapperConnection) connect() error {
 		w.conn = nil
 	}
 
-	conn, resp, err := dialer.Dial(w.Address, header)
+	address, err := w.dialURL()
+	if err != nil {
+		w.Status = StatusError
+		w.setError(err.Error())
+
+		return err
+	}
+
+	conn, resp, err := dialer.Dial(address, header)
 	if err != nil {
 		w.Status = StatusError
 		errMsg := err.Error()
 
 		if resp != nil {
 			if resp.StatusCode == http.StatusUnauthorized {
-				w.Error = StatusAuthFailed
+				w.setError(StatusAuthFailed)
 				return fmt.Errorf("%s", StatusAuthFailed)
 			}
 
 			errMsg = fmt.Sprintf("%v (HTTP Status: %d)", err, resp.StatusCode)
 		}
 
-		w.Error = errMsg
+		w.setError(errMsg)
 
 		return fmt.Errorf("failed to connect to wrapper: %v", errMsg)
 	}
@@ -373,10 +707,15 @@ func (w *WrapperConnection) connect() error {
 	w.conn = conn
 	w.Status = StatusConnected
 	w.statsMu.Lock()
-	w.Stats.ConnectedAt = time.Now()
+	w.Stats.ConnectedAt = time.Now().UTC()
 	w.Stats.Reconnections++
+	reconnected := w.Stats.Reconnections > 1
 	w.statsMu.Unlock()
 
+	if reconnected {
+		w.alert(notify.SeverityInfo, "connection restored")
+	}
+
 	// Start message handling goroutines
 	go w.readPump()
 	go w.writePump()
@@ -386,8 +725,17 @@ func (w *WrapperConnection) connect() error {
 
 // readPump pumps messages from the wrapper connection to all connected clients.
 func (w *WrapperConnection) readPump() {
+	defer w.routines.track(routineReadPump)()
+
 	defer func() {
 		w.Status = StatusDisconnected
+
+		select {
+		case <-w.done:
+		default:
+			w.alert(notify.SeverityWarning, "connection lost")
+		}
+
 		if w.conn != nil {
 			err := w.conn.Close()
 			if err != nil {
@@ -402,20 +750,22 @@ func (w *WrapperConnection) readPump() {
 	}()
 
 	if w.conn == nil {
-		w.Error = "connection is nil"
+		w.setError("connection is nil")
 
 		return
 	}
 
-	err := w.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	err := w.conn.SetReadDeadline(time.Now().Add(w.keepalive.PongWait))
 	if err != nil {
 		fmt.Printf("Error setting read deadline: %v\n", err)
 		return
 	}
 
-	w.conn.SetPongHandler(func(string) error {
+	w.conn.SetPongHandler(func(appData string) error {
+		w.observePong(appData)
+
 		if w.conn != nil {
-			err := w.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+			err := w.conn.SetReadDeadline(time.Now().Add(w.keepalive.PongWait))
 			if err != nil {
 				fmt.Printf("Error setting read deadline: %v\n", err)
 				return err
@@ -433,45 +783,297 @@ func (w *WrapperConnection) readPump() {
 			}
 
 			w.Status = StatusError
-			w.Error = fmt.Sprintf("read error: %v", err)
+			w.setError(fmt.Sprintf("read error: %v", err))
+
+			return
+		}
+
+		w.countReceived(len(message))
+
+		// Older wrappers send plain text lines instead of frames
+		frame, err := protocol.Decode(message)
+		if err != nil {
+			w.broadcast(message)
+			continue
+		}
+
+		w.handleFrame(frame)
+	}
+}
+
+// handleFrame processes a structured frame received from the wrapper.
+func (w *WrapperConnection) handleFrame(frame protocol.Frame) {
+	switch frame.Type {
+	case protocol.FrameSession:
+		w.resumeMu.Lock()
+
+		if frame.Epoch != w.epoch {
+			// The wrapper restarted, so it replays its whole buffer
+			w.epoch = frame.Epoch
+			w.tracker.Reset(0)
 
+			// A restarted wrapper may have lost its deny list
+			w.denyListSynced.Store(0)
+		}
+
+		w.resumeMu.Unlock()
+
+		w.groupsMu.Lock()
+		w.labels = frame.Labels
+		old := w.peer
+		w.peer = frame.Hello
+		w.groupsMu.Unlock()
+
+		w.observeHello(old, frame.Hello)
+
+		if frame.Hello != nil {
+			w.sendHello()
+		}
+
+		if w.activity != nil {
+			w.activity.ServerEpoch(w.ID, frame.Epoch)
+		}
+
+	case protocol.FrameLine:
+		// Only the console channel is relayed to web clients
+		if frame.Channel != "" {
+			return
+		}
+
+		w.resumeMu.Lock()
+		obs := w.tracker.Observe(frame.Seq)
+		w.resumeMu.Unlock()
+
+		if obs.Duplicate {
 			return
 		}
 
-		// Update stats
 		w.statsMu.Lock()
-		w.Stats.MessagesReceived++
-		w.Stats.LastMessageAt = time.Now()
+
+		if obs.Recovered {
+			w.Stats.LinesRecovered++
+		}
+
+		if obs.HasGap() {
+			w.Stats.SequenceGaps++
+		}
+
 		w.statsMu.Unlock()
 
-		// Broadcast message to all connected clients
-		w.clientsMu.RLock()
+		if obs.HasGap() {
+			w.requestResend(obs.GapFrom, obs.GapTo)
+		}
 
-		for client := range w.clients {
-			err := client.WriteMessage(websocket.TextMessage, message)
-			if err != nil {
-				fmt.Printf("Error writing to client: %v\n", err)
+		w.observeStop(frame.Text)
+		w.observeTimeline(frame)
+		w.wrapperAlert(frame)
 
-				err = client.Close()
-				if err != nil {
-					fmt.Printf("Error closing client connection: %v\n", err)
-				}
+		e, ok := events.Parse(frame.Text)
+		if ok {
+			// The timestamp in the text is in the wrapper's timezone, which
+			// needn't be ours
+			if frame.Logged != nil {
+				e.Time = *frame.Logged
+			}
 
-				w.RemoveClient(client)
+			if w.activity != nil {
+				w.activity.Record(w.ID, e)
 			}
+
+			w.locate(e)
+		}
+
+		// Web clients of the central server get plain text, so trimmed lines
+		// carry the marker the wrapper sends its own plain text clients
+		if frame.Length > 0 {
+			w.broadcast([]byte(protocol.TruncatedText(frame.Text, frame.Length)))
+		} else {
+			w.broadcast([]byte(frame.Text))
 		}
 
-		w.clientsMu.RUnlock()
+	case protocol.FrameGap:
+		w.resumeMu.Lock()
+		w.tracker.Forget(frame.From, frame.To)
+		w.resumeMu.Unlock()
+
+		w.statsMu.Lock()
+		w.Stats.LinesLost += int64(frame.To - frame.From + 1)
+		w.statsMu.Unlock()
+
+		w.broadcast([]byte(fmt.Sprintf("[central] %d console line(s) were lost while disconnected",
+			frame.To-frame.From+1)))
 	}
 }
 
+// requestResend asks the wrapper to retransmit the given range of console lines.
+func (w *WrapperConnection) requestResend(from, to uint64) {
+	data, err := protocol.Frame{Type: protocol.FrameResend, From: from, To: to}.Encode()
+	if err != nil {
+		fmt.Printf("Error encoding resend request: %v\n", err)
+		return
+	}
+
+	select {
+	case w.sendChan <- data:
+	default:
+		fmt.Printf("Error requesting resend from wrapper %s: message buffer full\n", w.ID)
+	}
+}
+
+// broadcast sends a message to all connected web clients, dropping clients
+// that can't be written to.
+func (w *WrapperConnection) broadcast(message []byte) {
+	var failed []*websocket.Conn
+
+	w.clientsMu.RLock()
+
+	for client := range w.clients {
+		err := client.WriteMessage(websocket.TextMessage, message)
+		if err != nil {
+			fmt.Printf("Error writing to client: %v\n", err)
+
+			failed = append(failed, client)
+		}
+	}
+
+	w.clientsMu.RUnlock()
+
+	for _, client := range failed {
+		err := client.Close()
+		if err != nil {
+			fmt.Printf("Error closing client connection: %v\n", err)
+		}
+
+		w.RemoveClient(client)
+	}
+}
+
+// dialURL returns the wrapper address with the query parameters requesting
+// structured frames and, after a reconnect, only the missed console lines.
+func (w *WrapperConnection) dialURL() (string, error) {
+	u, err := url.Parse(w.Address)
+	if err != nil {
+		return "", fmt.Errorf("invalid wrapper address: %v", err)
+	}
+
+	query := u.Query()
+	query.Set("format", protocol.FormatJSON)
+
+	w.resumeMu.Lock()
+
+	if w.epoch != "" {
+		query.Set("resume", protocol.ResumeToken{Epoch: w.epoch, Seq: w.tracker.Last()}.String())
+	}
+
+	w.resumeMu.Unlock()
+
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// authHeader returns the headers authenticating requests to the wrapper.
+func (w *WrapperConnection) authHeader() http.Header {
+	header := http.Header{}
+
+	// Create auth header if credentials are provided
+	if w.Username != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(w.Username + ":" + w.Password))
+		header.Set("Authorization", "Basic "+auth)
+	}
+
+	// Add the shared key header
+	if w.SharedKey != "" {
+		header.Set("X-Auth-Key", w.SharedKey)
+	}
+
+	return header
+}
+
+// APIError is an error response from a wrapper's API.
+type APIError struct {
+	Method  string
+	Path    string
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: %s (HTTP Status: %d)", e.Method, e.Path, e.Message, e.Status)
+}
+
+// apiRequest sends an HTTP request to the wrapper's API, which is served on
+// the same host as its WebSocket endpoint.
+func (w *WrapperConnection) apiRequest(ctx context.Context, method, path string,
+	body io.Reader) (*http.Response, error) {
+	return w.apiRequestWithHeader(ctx, method, path, body, nil)
+}
+
+// apiRequestWithHeader is apiRequest with extra request headers, such as a
+// Range.
+func (w *WrapperConnection) apiRequestWithHeader(ctx context.Context, method, path string, body io.Reader,
+	header http.Header) (*http.Response, error) {
+	u, err := url.Parse(w.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapper address: %v", err)
+	}
+
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	default:
+		u.Scheme = "http"
+	}
+
+	u.Path, u.RawQuery, _ = strings.Cut(path, "?")
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = w.authHeader()
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	if actor := contextActor(ctx); actor != "" {
+		req.Header.Set(actorHeader, actor)
+	}
+
+	client := http.DefaultClient
+
+	// Each request gets its own connection through the relay
+	if w.relay != nil {
+		client = &http.Client{Transport: &http.Transport{
+			DialContext:       w.relay.dialContext(w.ID, w.keepalive.WriteWait),
+			DisableKeepAlives: true,
+		}}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+
+		return nil, &APIError{Method: method, Path: path, Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+
+	return resp, nil
+}
+
 // sendWithDeadline sends a message with a write deadline.
 func (w *WrapperConnection) sendWithDeadline(messageType int, data []byte) error {
 	if w.conn == nil {
 		return fmt.Errorf("connection is nil")
 	}
 
-	err := w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	err := w.conn.SetWriteDeadline(time.Now().Add(w.keepalive.WriteWait))
 	if err != nil {
 		return fmt.Errorf("set write deadline: %w", err)
 	}
@@ -479,14 +1081,6 @@ func (w *WrapperConnection) sendWithDeadline(messageType int, data []byte) error
 	return w.conn.WriteMessage(messageType, data)
 }
 
-// updateMessageStats updates the connection statistics after sending a message.
-func (w *WrapperConnection) updateMessageStats() {
-	w.statsMu.Lock()
-	w.Stats.MessagesSent++
-	w.Stats.LastMessageAt = time.Now()
-	w.statsMu.Unlock()
-}
-
 // cleanupConnection handles the connection cleanup and status update.
 func (w *WrapperConnection) cleanupConnection() {
 	if w.conn != nil {
@@ -505,7 +1099,9 @@ func (w *WrapperConnection) cleanupConnection() {
 
 // writePump pumps messages from the clients to the wrapper connection.
 func (w *WrapperConnection) writePump() {
-	ticker := time.NewTicker(54 * time.Second)
+	defer w.routines.track(routineWritePump)()
+
+	ticker := time.NewTicker(w.keepalive.PingInterval)
 
 	defer func() {
 		ticker.Stop()
@@ -521,14 +1117,14 @@ func (w *WrapperConnection) writePump() {
 
 			err := w.sendWithDeadline(websocket.TextMessage, message)
 			if err != nil {
-				w.Error = fmt.Sprintf("write error: %v", err)
+				w.setError(fmt.Sprintf("write error: %v", err))
 				return
 			}
 
-			w.updateMessageStats()
+			w.countSent(len(message))
 
 		case <-ticker.C:
-			err := w.sendWithDeadline(websocket.PingMessage, nil)
+			err := w.sendWithDeadline(websocket.PingMessage, pingPayload(time.Now()))
 			if err != nil {
 				fmt.Printf("Ping failed: %v\n", err)
 				return
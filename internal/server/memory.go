@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/memlimit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notices"
+)
+
+// MemoryConfig configures the memory watch of bedrock_server. Thresholds are
+// fractions of the limiter's limit.
+type MemoryConfig struct {
+	Warn     float64       // Alert above this share of the limit
+	Restart  float64       // Save and restart above this share of the limit
+	Interval time.Duration // Time between checks
+}
+
+// withDefaults fills in unset values.
+func (c MemoryConfig) withDefaults() MemoryConfig {
+	if c.Warn <= 0 {
+		c.Warn = 0.85
+	}
+
+	if c.Restart <= 0 {
+		c.Restart = 0.95
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+
+	return c
+}
+
+// WatchMemory checks the memory of bedrock_server until it exits. Above the
+// warning threshold clients are alerted; above the restart threshold the
+// server is told to stop, which saves the world, before the kernel OOM-kills
+// it mid-write. Its supervisor then starts a fresh one.
+func (s *Server) WatchMemory(limiter *memlimit.Limiter, config MemoryConfig) {
+	config = config.withDefaults()
+	limit := float64(limiter.Limit())
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	warned := false
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.runner.Done():
+			return
+		}
+
+		usage, err := limiter.Usage()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error checking server memory: %v\n", err)
+			continue
+		}
+
+		share := float64(usage) / limit
+
+		switch {
+		case share >= config.Restart:
+			s.alert(fmt.Sprintf("[wrapper] Memory at %s of %s, saving and restarting the server",
+				memlimit.FormatSize(usage), memlimit.FormatSize(limiter.Limit())))
+			s.sayNotice(notices.Restart, "", notices.Values{Reason: notices.ReasonMemory})
+			s.runner.WriteInput("stop")
+
+			return
+		case share >= config.Warn && !warned:
+			warned = true
+
+			s.alert(fmt.Sprintf("[wrapper] Memory warning: %s of %s in use",
+				memlimit.FormatSize(usage), memlimit.FormatSize(limiter.Limit())))
+		case share < config.Warn:
+			warned = false
+		}
+	}
+}
+
+// alert logs a wrapper alert and shows it on the console of all clients.
+func (s *Server) alert(text string) {
+	fmt.Fprintln(os.Stderr, text)
+	s.publish(text)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rawtext"
+)
+
+// ComposedMessage is the commands that send a message.
+type ComposedMessage struct {
+	Commands []string `json:"commands"`
+}
+
+// composeMessage decodes a message from a POST body and returns the commands
+// that send it, reporting an error if it can't.
+func composeMessage(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	var m rawtext.Message
+
+	err := json.NewDecoder(r.Body).Decode(&m)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	commands, err := m.Commands()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return commands, true
+}
+
+// handleMessageCompose returns the tellraw or titleraw commands for a
+// structured message without sending it.
+func handleMessageCompose(w http.ResponseWriter, r *http.Request) {
+	commands, ok := composeMessage(w, r)
+	if !ok {
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(ComposedMessage{Commands: commands})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleMessages sends a structured message to the server and returns the
+// commands used.
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
+	commands, ok := composeMessage(w, r)
+	if !ok {
+		return
+	}
+
+	for _, command := range commands {
+		s.runner.WriteInput(command)
+	}
+
+	err := json.NewEncoder(w).Encode(ComposedMessage{Commands: commands})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
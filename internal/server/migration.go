@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/config"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notices"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/oplock"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/packs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rollback"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/snapshot"
+)
+
+// saveHoldWait is how long the server is given to flush the world to disk
+// after "save hold" before the snapshot is taken.
+const saveHoldWait = 5 * time.Second
+
+// handleMigrationExport streams a snapshot of the worlds and configuration,
+// with packs=true also the installed packs the world uses. Saving is held
+// while the archive is written so the world files are consistent. The
+// snapshot is a backup under the operation lock.
+func (s *Server) handleMigrationExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	written := false
+
+	err := s.jobs.Run(r.Context(), "export", "snapshot", actor(r), func(ctx context.Context, h *jobs.Handle) error {
+		release, err := s.acquire(ctx, h, r, oplock.Backup)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="snapshot.zip"`)
+
+		err = s.writeSnapshot(ctx, h, h.Writer(w, 0), r.URL.Query().Get("packs") == "true", func() { written = true })
+		if err != nil && written {
+			// Headers are already sent, the truncated archive fails to import
+			fmt.Printf("Error writing snapshot: %v\n", err)
+		}
+
+		return err
+	})
+	if err != nil && !written {
+		lockError(w, err)
+	}
+}
+
+// writeSnapshot writes a snapshot of the worlds and configuration to w, with
+// withPacks also the installed packs the world uses. Saving is held while
+// the archive is written so the world files are consistent, and ready is
+// called once they are flushed, right before writing starts. The caller
+// holds the operation lock.
+func (s *Server) writeSnapshot(ctx context.Context, h *jobs.Handle, w io.Writer, withPacks bool, ready func()) error {
+	s.runner.WriteInput("save hold")
+	defer s.runner.WriteInput("save resume")
+
+	h.Logf("holding saves")
+
+	select {
+	case <-time.After(saveHoldWait):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var extra []string
+
+	if withPacks {
+		used, err := packs.WorldPacks(s.appDir, s.levelName())
+		if err != nil {
+			return err
+		}
+
+		for _, pack := range used {
+			extra = append(extra, pack.Path())
+		}
+	}
+
+	ready()
+
+	h.Logf("writing snapshot")
+
+	return snapshot.Write(s.appDir, w, extra...)
+}
+
+// handleMigrationImport restores a snapshot into the app directory. The
+// server-name, server-port and server-portv6 of the imported properties are
+// replaced by the name, port and portv6 parameters when given, so a clone
+// doesn't pose as its source. A rollback point is taken first, if enabled.
+// With restart=true the server is stopped
+// afterwards so its supervisor starts it again on the imported world. The
+// import is a restore under the operation lock.
+func (s *Server) handleMigrationImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	overrides, err := importOverrides(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	locked := false
+
+	err = s.jobs.Run(r.Context(), "import", "snapshot", actor(r), func(ctx context.Context, h *jobs.Handle) error {
+		release, err := s.acquire(ctx, h, r, oplock.Restore)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		locked = true
+
+		err = s.takeRollbackPoint(ctx, h, rollback.ReasonRestore, "snapshot import", actor(r))
+		if err != nil {
+			return err
+		}
+
+		err = snapshot.Restore(s.appDir, h.Reader(r.Body, max(r.ContentLength, 0)))
+		if err != nil || len(overrides) == 0 {
+			return err
+		}
+
+		h.Logf("setting %d properties", len(overrides))
+
+		return config.EnsureProperties(s.appDir, overrides)
+	})
+	if err != nil && !locked {
+		lockError(w, err)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("restart") == "true" {
+		s.sayNotice(notices.Maintenance, "", notices.Values{Reason: notices.ReasonImport})
+		s.runner.WriteInput("stop")
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// importOverrides returns the properties an import replaces, from its name,
+// port and portv6 parameters.
+func importOverrides(query url.Values) (map[string]string, error) {
+	overrides := map[string]string{}
+
+	if name := strings.TrimSpace(query.Get("name")); name != "" {
+		if strings.ContainsAny(name, "\r\n") {
+			return nil, fmt.Errorf("invalid server name")
+		}
+
+		overrides["server-name"] = name
+	}
+
+	for param, key := range map[string]string{"port": "server-port", "portv6": "server-portv6"} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid %s %q", param, value)
+		}
+
+		overrides[key] = strconv.Itoa(port)
+	}
+
+	return overrides, nil
+}
+
+// handleMigrationDecommission stops the server after its world has been
+// migrated elsewhere.
+func (s *Server) handleMigrationDecommission(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.runner.Shutdown()
+	s.sayNotice(notices.Stop, "", notices.Values{})
+	s.runner.WriteInput("stop")
+
+	w.WriteHeader(http.StatusAccepted)
+}
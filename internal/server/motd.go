@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/config"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/motd"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notices"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/oplock"
+)
+
+// defaultServerName is the server-name of a new server.properties.
+const defaultServerName = "Dedicated Server"
+
+// MOTDResponse is the MOTD with its preview. After an update it reports
+// whether the server is restarting to show it, and whether the new
+// level-name starts a new world.
+type MOTDResponse struct {
+	motd.MOTD
+	Preview         motd.Preview `json:"preview"`
+	Error           string       `json:"error,omitempty"` // Why the MOTD can't be used (preview)
+	Restarting      bool         `json:"restarting,omitempty"`
+	RestartRequired bool         `json:"restart_required,omitempty"`
+	NewWorld        bool         `json:"new_world,omitempty"`
+}
+
+// currentMOTD returns the MOTD in server.properties.
+func (s *Server) currentMOTD() motd.MOTD {
+	m := motd.MOTD{ServerName: defaultServerName, LevelName: s.levelName()}
+
+	props, err := config.ReadProperties(s.appDir)
+	if err == nil && props["server-name"] != "" {
+		m.ServerName = props["server-name"]
+	}
+
+	return m
+}
+
+// handleMOTD returns the server-name and level-name shown in the server list
+// (GET) or sets them (PUT). Bedrock reads both only at startup, so with
+// ?restart=true the server is stopped to be restarted by its supervisor;
+// otherwise the change shows after the next restart.
+func (s *Server) handleMOTD(w http.ResponseWriter, r *http.Request) {
+	var result MOTDResponse
+
+	switch r.Method {
+	case http.MethodGet:
+		result.MOTD = s.currentMOTD()
+	case http.MethodPut:
+		var m motd.MOTD
+
+		err := json.NewDecoder(r.Body).Decode(&m)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		result, err = s.updateMOTD(r, m)
+		if err != nil {
+			motdError(w, err)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result.Preview = result.MOTD.Preview()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleMOTDPreview renders an MOTD like the server list without saving it,
+// reporting why it can't be used, for a live preview while editing.
+func handleMOTDPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var m motd.MOTD
+
+	err := json.NewDecoder(r.Body).Decode(&m)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result := MOTDResponse{MOTD: m, Preview: m.Preview()}
+
+	err = m.Validate()
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// updateMOTD validates and saves an MOTD, restarting the server if asked to.
+func (s *Server) updateMOTD(r *http.Request, m motd.MOTD) (MOTDResponse, error) {
+	result := MOTDResponse{MOTD: m}
+
+	err := m.Validate()
+	if err != nil {
+		return result, err
+	}
+
+	current := s.currentMOTD()
+	if m == current {
+		return result, nil
+	}
+
+	restart := r.URL.Query().Get("restart") == "true"
+
+	// Keep a restart from stopping the server during a backup or upgrade
+	release := func() {}
+	if restart {
+		release, err = s.acquire(r.Context(), nil, r, oplock.Restart)
+		if err != nil {
+			return result, err
+		}
+	}
+	defer release()
+
+	path := filepath.Join(s.appDir, "server.properties")
+
+	old, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return result, fmt.Errorf("error reading server.properties: %w", err)
+	}
+
+	err = config.EnsureProperties(s.appDir, map[string]string{"server-name": m.ServerName, "level-name": m.LevelName})
+	if err != nil {
+		return result, err
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return result, fmt.Errorf("error reading server.properties: %w", err)
+	}
+
+	s.trackConfig("server.properties", actor(r), "MOTD", old, data)
+
+	err = s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: "motd.update",
+		Target: "server.properties",
+		Diff:   audit.Diff("server.properties", old, data),
+	})
+	if err != nil {
+		fmt.Printf("Error recording MOTD update: %v\n", err)
+	}
+
+	// A level-name without a world directory makes the server create one
+	if m.LevelName != current.LevelName {
+		_, err = os.Stat(filepath.Join(s.appDir, "worlds", m.LevelName))
+		result.NewWorld = errors.Is(err, os.ErrNotExist)
+	}
+
+	if !restart {
+		result.RestartRequired = true
+		return result, nil
+	}
+
+	s.sayNotice(notices.Restart, "", notices.Values{Reason: notices.ReasonServerName})
+	s.runner.WriteInput("stop")
+
+	result.Restarting = true
+
+	return result, nil
+}
+
+// motdError reports an MOTD update error with a matching status, including
+// errors taking the operation lock.
+func motdError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, motd.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		lockError(w, err)
+	}
+}
@@ -0,0 +1,427 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/memlimit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/raknet"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rules"
+)
+
+const (
+	// mqttTimeout bounds how long a publish may wait for the broker.
+	mqttTimeout = 5 * time.Second
+
+	// mqttEventBuffer is how many events may wait to be published; more are
+	// dropped so a slow broker never holds up the console.
+	mqttEventBuffer = 64
+)
+
+// MQTTConfig configures publishing of server status and player events to an
+// MQTT broker. Under the topic prefix the wrapper publishes:
+//
+//	<topic>/availability  "online" or "offline" (retained, offline is the will)
+//	<topic>/status        MQTTStatus as JSON (retained)
+//	<topic>/events        join, leave, start and crash events as JSON
+//
+// With a discovery prefix, Home Assistant sensors for the status are
+// announced as well.
+type MQTTConfig struct {
+	Broker      string // e.g. tcp://broker:1883 or ssl://broker:8883
+	ClientID    string
+	Username    string
+	Password    string
+	Topic       string        // Prefix of the published topics
+	Discovery   string        // Home Assistant discovery prefix, empty disables discovery
+	Name        string        // Device name in Home Assistant
+	Interval    time.Duration // Time between status updates
+	PingAddress string        // Where bedrock_server answers RakNet pings
+	Memory      *memlimit.Limiter
+	Running     bool // Whether bedrock_server already started, as when handed over by a previous wrapper
+}
+
+// withDefaults fills in unset values.
+func (c MQTTConfig) withDefaults() MQTTConfig {
+	if c.Topic == "" {
+		c.Topic = "gogo-mc-bedrock"
+	}
+
+	if c.Name == "" {
+		c.Name = "Minecraft server"
+	}
+
+	if c.ClientID == "" {
+		host, _ := os.Hostname()
+		c.ClientID = "gogo-mc-bedrock-" + host
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = time.Minute
+	}
+
+	return c
+}
+
+// MQTTStatus is the state of the server published to <topic>/status.
+type MQTTStatus struct {
+	Online        bool      `json:"online"` // Whether the server answers pings
+	State         string    `json:"state"`  // starting, running, stopped or crashed
+	Players       int       `json:"players"`
+	MaxPlayers    int       `json:"max_players"`
+	PlayerNames   []string  `json:"player_names"`
+	Version       string    `json:"version,omitempty"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	MemoryBytes   int64     `json:"memory_bytes,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// MQTTEvent is a player or server event published to <topic>/events.
+type MQTTEvent struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Player string    `json:"player,omitempty"`
+	XUID   string    `json:"xuid,omitempty"`
+	Error  string    `json:"error,omitempty"` // Why the server crashed
+}
+
+// mqttPublisher keeps what the status is built from between updates.
+type mqttPublisher struct {
+	client  mqtt.Client
+	config  MQTTConfig
+	mu      sync.Mutex
+	state   string
+	started time.Time
+	players map[string]bool
+	pong    raknet.Pong
+	online  bool
+	events  chan MQTTEvent
+}
+
+var unsafeTopic = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// StartMQTT connects to the broker, retrying in the background until it is
+// reachable, and publishes the status every interval until bedrock_server
+// exits.
+func (s *Server) StartMQTT(config MQTTConfig) {
+	config = config.withDefaults()
+
+	p := &mqttPublisher{
+		config:  config,
+		state:   "starting",
+		players: make(map[string]bool),
+		events:  make(chan MQTTEvent, mqttEventBuffer),
+	}
+
+	if config.Running {
+		p.state = "running"
+		p.started = time.Now()
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(config.Topic+"/availability", "offline", 1, true).
+		SetOnConnectHandler(func(mqtt.Client) {
+			fmt.Printf("Connected to MQTT broker %s\n", config.Broker)
+			s.mqttAnnounce()
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			fmt.Printf("Lost connection to MQTT broker: %v\n", err)
+		})
+
+	p.client = mqtt.NewClient(opts)
+	s.mqtt = p
+
+	// Connects in the background since ConnectRetry is set
+	p.client.Connect()
+
+	go s.runMQTT()
+}
+
+// runMQTT publishes events as they happen, each followed by the status, and
+// pings the server and publishes its status every interval.
+func (s *Server) runMQTT() {
+	ticker := time.NewTicker(s.mqtt.config.Interval)
+	defer ticker.Stop()
+
+	s.mqttPing()
+	s.mqttPublishStatus()
+
+	for {
+		select {
+		case e := <-s.mqtt.events:
+			s.mqttPublish("events", e, false)
+			s.mqttPublishStatus()
+		case <-ticker.C:
+			s.mqttPing()
+			s.mqttPublishStatus()
+		case <-s.runner.Done():
+			return
+		}
+	}
+}
+
+// StopMQTT publishes the final status and disconnects from the broker.
+func (s *Server) StopMQTT() {
+	if s.mqtt == nil {
+		return
+	}
+
+	s.mqtt.mu.Lock()
+	if s.mqtt.state != "crashed" {
+		s.mqtt.state = "stopped"
+	}
+	s.mqtt.online = false
+	s.mqtt.players = make(map[string]bool)
+	s.mqtt.mu.Unlock()
+
+	s.mqttPublishStatus()
+	s.mqttPublish("availability", "offline", true)
+
+	s.mqtt.client.Disconnect(250)
+}
+
+// mqttDetach disconnects from the broker without publishing that the server
+// went offline, for a new wrapper to take over the status.
+func (s *Server) mqttDetach() {
+	if s.mqtt != nil {
+		s.mqtt.client.Disconnect(250)
+	}
+}
+
+// mqttReattach connects to the broker again after mqttDetach.
+func (s *Server) mqttReattach() {
+	if s.mqtt != nil {
+		s.mqtt.client.Connect()
+	}
+}
+
+// mqttAnnounce publishes the availability, the Home Assistant discovery
+// configs and the current status on every (re)connect.
+func (s *Server) mqttAnnounce() {
+	s.mqttPublish("availability", "online", true)
+
+	if s.mqtt.config.Discovery != "" {
+		for _, d := range s.mqttDiscovery() {
+			s.mqttPublishTo(d.topic, d.config, true)
+		}
+	}
+
+	s.mqttPublishStatus()
+}
+
+// discoveryConfig is a Home Assistant MQTT discovery message.
+type discoveryConfig struct {
+	topic  string
+	config map[string]any
+}
+
+// mqttDiscovery returns the Home Assistant entities of the status: whether
+// the server is online, the players online with their names as attributes,
+// its memory and its uptime.
+func (s *Server) mqttDiscovery() []discoveryConfig {
+	c := s.mqtt.config
+	node := unsafeTopic.ReplaceAllString(c.Topic, "_")
+	device := map[string]any{
+		"identifiers":  []string{node},
+		"name":         c.Name,
+		"manufacturer": "gogo-mc-bedrock-server",
+	}
+
+	entity := func(component, id, name string, extra map[string]any) discoveryConfig {
+		config := map[string]any{
+			"name":               name,
+			"unique_id":          node + "_" + id,
+			"state_topic":        c.Topic + "/status",
+			"availability_topic": c.Topic + "/availability",
+			"device":             device,
+		}
+
+		for k, v := range extra {
+			config[k] = v
+		}
+
+		return discoveryConfig{topic: fmt.Sprintf("%s/%s/%s/%s/config", c.Discovery, component, node, id), config: config}
+	}
+
+	return []discoveryConfig{
+		entity("binary_sensor", "online", "Online", map[string]any{
+			"device_class":   "connectivity",
+			"value_template": "{{ 'ON' if value_json.online else 'OFF' }}",
+		}),
+		entity("sensor", "players", "Players online", map[string]any{
+			"state_class":           "measurement",
+			"unit_of_measurement":   "players",
+			"value_template":        "{{ value_json.players }}",
+			"json_attributes_topic": c.Topic + "/status",
+			"json_attributes_template": "{{ {'names': value_json.player_names, 'max_players': value_json.max_players} | " +
+				"tojson }}",
+		}),
+		entity("sensor", "state", "State", map[string]any{
+			"value_template": "{{ value_json.state }}",
+		}),
+		entity("sensor", "memory", "Memory", map[string]any{
+			"device_class":        "data_size",
+			"unit_of_measurement": "B",
+			"state_class":         "measurement",
+			"value_template":      "{{ value_json.memory_bytes }}",
+		}),
+		entity("sensor", "uptime", "Uptime", map[string]any{
+			"device_class":        "duration",
+			"unit_of_measurement": "s",
+			"value_template":      "{{ value_json.uptime_seconds }}",
+		}),
+	}
+}
+
+// mqttPing refreshes whether the server answers pings and what it reports.
+func (s *Server) mqttPing() {
+	if s.mqtt.config.PingAddress == "" {
+		return
+	}
+
+	pong, err := raknet.GetPong(s.mqtt.config.PingAddress)
+
+	s.mqtt.mu.Lock()
+	s.mqtt.online = err == nil
+	if err == nil {
+		s.mqtt.pong = pong
+	}
+	s.mqtt.mu.Unlock()
+}
+
+// mqttStatus builds the status from the players seen joining and leaving
+// and the last ping.
+func (s *Server) mqttStatus() MQTTStatus {
+	p := s.mqtt
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := MQTTStatus{
+		Online:      p.online,
+		State:       p.state,
+		Players:     len(p.players),
+		MaxPlayers:  p.pong.MaxPlayerCount,
+		PlayerNames: make([]string, 0, len(p.players)),
+		Version:     p.pong.VersionName,
+		UpdatedAt:   time.Now().UTC(),
+	}
+
+	for name := range p.players {
+		status.PlayerNames = append(status.PlayerNames, name)
+	}
+
+	sort.Strings(status.PlayerNames)
+
+	if p.state == "running" {
+		status.UptimeSeconds = int64(time.Since(p.started).Seconds())
+	}
+
+	if p.config.Memory != nil && p.state != "stopped" && p.state != "crashed" {
+		usage, err := p.config.Memory.Usage()
+		if err == nil {
+			status.MemoryBytes = usage
+		}
+	}
+
+	return status
+}
+
+// mqttPublishStatus publishes the current status.
+func (s *Server) mqttPublishStatus() {
+	s.mqttPublish("status", s.mqttStatus(), true)
+}
+
+// mqttConsoleEvents updates the status from the events in a console line and
+// queues them to be published.
+func (s *Server) mqttConsoleEvents(text string) {
+	if s.mqtt == nil {
+		return
+	}
+
+	for _, e := range consoleEvents(text) {
+		p := s.mqtt
+
+		p.mu.Lock()
+		switch e.Type {
+		case rules.EventJoin:
+			p.players[e.Player] = true
+		case rules.EventLeave:
+			delete(p.players, e.Player)
+		case rules.EventStart:
+			p.state = "running"
+			p.started = time.Now()
+			p.players = make(map[string]bool)
+		default:
+			p.mu.Unlock()
+			continue
+		}
+		p.mu.Unlock()
+
+		select {
+		case p.events <- MQTTEvent{Type: e.Type, Time: time.Now().UTC(), Player: e.Player, XUID: e.XUID}:
+		default:
+			fmt.Printf("Dropped MQTT %s event, too many waiting\n", e.Type)
+		}
+	}
+}
+
+// mqttCrashed publishes that bedrock_server crashed.
+func (s *Server) mqttCrashed(err error) {
+	if s.mqtt == nil {
+		return
+	}
+
+	s.mqtt.mu.Lock()
+	s.mqtt.state = "crashed"
+	s.mqtt.mu.Unlock()
+
+	s.mqttPublish("events", MQTTEvent{Type: rules.EventCrash, Time: time.Now().UTC(), Error: err.Error()}, false)
+}
+
+// mqttPublish publishes to a topic below the prefix.
+func (s *Server) mqttPublish(topic string, payload any, retain bool) {
+	s.mqttPublishTo(s.mqtt.config.Topic+"/"+topic, payload, retain)
+}
+
+// mqttPublishTo publishes a string as is and anything else as JSON. Nothing
+// is published while the broker is unreachable; the status is published
+// again on reconnect.
+func (s *Server) mqttPublishTo(topic string, payload any, retain bool) {
+	if !s.mqtt.client.IsConnectionOpen() {
+		return
+	}
+
+	data, ok := payload.(string)
+	if !ok {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			fmt.Printf("Error encoding MQTT message: %v\n", err)
+			return
+		}
+
+		data = string(encoded)
+	}
+
+	token := s.mqtt.client.Publish(topic, 1, retain, data)
+	if !token.WaitTimeout(mqttTimeout) {
+		fmt.Printf("Error publishing to %s: timed out\n", topic)
+		return
+	}
+
+	if token.Error() != nil {
+		fmt.Printf("Error publishing to %s: %v\n", topic, token.Error())
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/config"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/i18n"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notices"
+)
+
+// noticesName is the wording of the in-game notices in the app directory.
+const noticesName = "notices.json"
+
+// Notices is the wording of the in-game notices with what it may use.
+type Notices struct {
+	Config       notices.Config    `json:"config"`
+	Defaults     map[string]string `json:"defaults"` // Templates by kind in the configured language
+	Languages    []string          `json:"languages"`
+	Placeholders []string          `json:"placeholders"`
+}
+
+// openNotices loads the wording of the in-game notices.
+func (s *Server) openNotices() {
+	store, err := notices.Open(filepath.Join(s.appDir, noticesName))
+	if err != nil {
+		fmt.Printf("Error opening notices: %v\n", err)
+		return
+	}
+
+	s.notices = store
+}
+
+// sayNotice says a notice in-game, worded from override if set, such as a
+// schedule's own, otherwise as configured. {server} is the server-name.
+func (s *Server) sayNotice(kind, override string, v notices.Values) {
+	s.runner.WriteInput(s.noticeCommand(kind, override, v))
+}
+
+// noticeCommand returns the console command saying a notice.
+func (s *Server) noticeCommand(kind, override string, v notices.Values) string {
+	if v.Server == "" {
+		properties, err := config.ReadProperties(s.appDir)
+		if err == nil {
+			v.Server = properties["server-name"]
+		}
+	}
+
+	return "say " + s.notices.Render(kind, override, v)
+}
+
+// noticesStatus returns the wording of the in-game notices.
+func (s *Server) noticesStatus() Notices {
+	c := s.notices.Config()
+
+	return Notices{
+		Config:       c,
+		Defaults:     c.Defaults(),
+		Languages:    i18n.Languages,
+		Placeholders: notices.Placeholders,
+	}
+}
+
+// handleNotices returns the wording of the countdown, restart, stop and
+// maintenance notices said in-game (GET) or replaces it (PUT). Changes are
+// recorded in the audit log.
+func (s *Server) handleNotices(w http.ResponseWriter, r *http.Request) {
+	if s.notices == nil {
+		http.Error(w, "Notices are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var c notices.Config
+
+		err := json.NewDecoder(r.Body).Decode(&c)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		old, _ := json.MarshalIndent(s.notices.Config(), "", "  ")
+
+		c, err = s.notices.Set(c)
+		if err != nil {
+			noticesError(w, err)
+			return
+		}
+
+		data, _ := json.MarshalIndent(c, "", "  ")
+
+		err = s.audit.Record(audit.Entry{
+			Actor:  actor(r),
+			Action: "notices.update",
+			Target: noticesName,
+			Diff:   audit.Diff(noticesName, old, data),
+		})
+		if err != nil {
+			fmt.Printf("Error recording notices change: %v\n", err)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(s.noticesStatus())
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// noticesError reports a notices API error with a matching status.
+func noticesError(w http.ResponseWriter, err error) {
+	if errors.Is(err, notices.ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
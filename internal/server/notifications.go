@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notify"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/timeline"
+)
+
+const (
+	// notificationTimeout bounds a notification webhook request.
+	notificationTimeout = 10 * time.Second
+
+	// maxQueuedNotifications is how many messages may wait to be sent;
+	// more are dropped.
+	maxQueuedNotifications = 64
+
+	// wrapperAlertPrefix starts the alerts wrappers show on their console.
+	wrapperAlertPrefix = "[wrapper] "
+)
+
+// criticalAlerts start the wrapper alerts that are critical. Other wrapper
+// alerts are warnings.
+var criticalAlerts = []string{"Server crashed", "Server hung", "Memory at"}
+
+var notificationClient = &http.Client{Timeout: notificationTimeout}
+
+// notifications delivers the notifications of the central server and its
+// wrappers to the channels.
+type notifications struct {
+	notifier *notify.Notifier
+	outbox   chan notify.Message
+}
+
+// newNotifications returns nil if there are no channels.
+func newNotifications(notifier *notify.Notifier) *notifications {
+	if notifier == nil {
+		return nil
+	}
+
+	return &notifications{notifier: notifier, outbox: make(chan notify.Message, maxQueuedNotifications)}
+}
+
+// notify raises a notification about a wrapper, by name, or the central
+// server if wrapper is empty. It does nothing without channels.
+func (n *notifications) notify(severity, wrapper, text string) {
+	if n == nil {
+		return
+	}
+
+	n.queue(n.notifier.Notify(notify.Notification{
+		Time:     time.Now().UTC(),
+		Severity: severity,
+		Wrapper:  wrapper,
+		Text:     text,
+	}))
+}
+
+// queue queues messages to send.
+func (n *notifications) queue(messages []notify.Message) {
+	for _, msg := range messages {
+		select {
+		case n.outbox <- msg:
+		default:
+			fmt.Printf("Dropped notification to %s, too many queued\n", msg.Channel)
+		}
+	}
+}
+
+// send delivers a message to its channel.
+func (n *notifications) send(msg notify.Message) {
+	for _, c := range n.notifier.Channels() {
+		if c.Name != msg.Channel {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+		defer cancel()
+
+		err := c.Send(ctx, notificationClient, msg)
+		if err != nil {
+			fmt.Printf("Error notifying %s: %v\n", c.Name, err)
+		}
+
+		return
+	}
+}
+
+// Notifications sends the queued notifications, and the digests due every
+// interval, until the manager is shut down.
+func (m *ConnectionManager) Notifications(interval time.Duration) {
+	if m.notifications == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			m.notifications.queue(m.notifications.notifier.Due(now))
+		case msg := <-m.notifications.outbox:
+			m.notifications.send(msg)
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// wrapperAlert raises a notification for an alert the wrapper showed on its
+// console, and records it in the fleet timeline at the time it was shown.
+func (w *WrapperConnection) wrapperAlert(frame protocol.Frame) {
+	text, ok := strings.CutPrefix(frame.Text, wrapperAlertPrefix)
+	if !ok {
+		return
+	}
+
+	severity := notify.SeverityWarning
+
+	for _, prefix := range criticalAlerts {
+		if strings.HasPrefix(text, prefix) {
+			severity = notify.SeverityCritical
+			break
+		}
+	}
+
+	w.recordEvent(timeline.Event{Time: frameTime(frame), Type: timeline.TypeAlert, Severity: severity, Text: text})
+	w.notifications.notify(severity, w.Name, text)
+}
+
+// handleNotifications returns the state of the notification channels (GET)
+// or sends a test notification to one right away, regardless of its quiet
+// hours and digests (POST ?channel=).
+func (s *CentralServer) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	n := s.manager.notifications
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		name := r.URL.Query().Get("channel")
+		found := false
+
+		for _, c := range n.notifier.Channels() {
+			found = found || c.Name == name
+		}
+
+		if !found {
+			http.Error(w, "Channel not found", http.StatusNotFound)
+			return
+		}
+
+		test := notify.Notification{
+			Time:     time.Now().UTC(),
+			Severity: notify.SeverityInfo,
+			Text:     "Test notification from " + requestUser(r).Name,
+		}
+
+		n.queue([]notify.Message{{Channel: name, Text: test.Text, Notifications: []notify.Notification{test}}})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(n.notifier.Status(time.Now()))
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
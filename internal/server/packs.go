@@ -0,0 +1,351 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/config"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/contentlog"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/oplock"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/packs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/snapshot"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/trash"
+)
+
+const (
+	defaultLevelName = "Bedrock level"
+
+	// reloadWait is how long script output is collected after a reload.
+	reloadWait = 5 * time.Second
+)
+
+// ReloadResult is the outcome of a pack reload.
+type ReloadResult struct {
+	Changes []packs.Change     `json:"changes"`
+	Errors  []contentlog.Entry `json:"errors"`
+}
+
+// InstalledPack is an installed pack and whether the world uses it.
+type InstalledPack struct {
+	packs.Pack
+
+	Used bool `json:"used"`
+}
+
+// PackInstall is the outcome of a pack import.
+type PackInstall struct {
+	Installed []packs.Pack   `json:"installed"`
+	Changes   []packs.Change `json:"changes"` // Of the world's pack lists
+}
+
+// levelName returns the world name configured in server.properties.
+func (s *Server) levelName() string {
+	props, err := config.ReadProperties(s.appDir)
+	if err != nil || props["level-name"] == "" {
+		return defaultLevelName
+	}
+
+	return props["level-name"]
+}
+
+// handlePacksReload re-scans the pack directories, updates the world's pack
+// lists, issues the "reload" command and reports script errors logged
+// shortly afterwards.
+func (s *Server) handlePacksReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	changes, err := packs.SyncWorld(s.appDir, s.levelName())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Remember where the script output was so only new errors are reported
+	s.connLock.RLock()
+	since := s.script.seq
+	s.connLock.RUnlock()
+
+	s.runner.WriteInput("reload")
+
+	select {
+	case <-time.After(reloadWait):
+	case <-r.Context().Done():
+		return
+	}
+
+	result := ReloadResult{
+		Changes: changes,
+		Errors:  []contentlog.Entry{},
+	}
+
+	s.connLock.RLock()
+
+	for _, line := range s.script.between(since+1, s.script.seq) {
+		entry, ok := contentlog.Parse(line.text)
+		if ok && entry.Level == contentlog.LevelError {
+			result.Errors = append(result.Errors, entry)
+		}
+	}
+
+	s.connLock.RUnlock()
+
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// installedPacks returns the behavior and resource packs installed, marking
+// those the world uses.
+func (s *Server) installedPacks() ([]InstalledPack, error) {
+	used, err := packs.WorldPacks(s.appDir, s.levelName())
+	if err != nil {
+		return nil, err
+	}
+
+	list := []InstalledPack{}
+
+	for _, kind := range []string{packs.KindBehavior, packs.KindResource} {
+		installed, err := packs.Scan(s.appDir, kind)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pack := range installed {
+			p := InstalledPack{Pack: pack}
+
+			for _, u := range used {
+				p.Used = p.Used || u.Path() == pack.Path()
+			}
+
+			list = append(list, p)
+		}
+	}
+
+	return list, nil
+}
+
+// handlePacks lists the installed packs (GET) or removes the one in ?path=,
+// e.g. path=behavior_packs/addon (DELETE).
+func (s *Server) handlePacks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		s.handleRemovePack(w, r)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := s.installedPacks()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(list)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleRemovePack moves an installed pack to the trash and takes it off the
+// world's pack list, keeping a copy of the list so both are put back on
+// undo. The server drops the pack on its next restart.
+func (s *Server) handleRemovePack(w http.ResponseWriter, r *http.Request) {
+	list, err := s.installedPacks()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	path := r.URL.Query().Get("path")
+
+	i := slices.IndexFunc(list, func(p InstalledPack) bool { return filepath.ToSlash(p.Path()) == path })
+	if i < 0 {
+		http.Error(w, fmt.Sprintf("Pack %s not installed", path), http.StatusNotFound)
+		return
+	}
+
+	pack := list[i]
+
+	release, err := s.acquire(r.Context(), nil, r, oplock.Delete)
+	if err != nil {
+		lockError(w, err)
+		return
+	}
+	defer release()
+
+	level := s.levelName()
+	entries := []trash.Entry{{Path: pack.Path()}}
+
+	if pack.Used {
+		entries = append(entries, trash.Entry{Path: packs.WorldFile(level, pack.Kind), Copy: true})
+	}
+
+	item, err := s.discard(trash.Item{
+		Kind:    trash.KindPack,
+		Name:    fmt.Sprintf("%s %d.%d.%d", pack.Name, pack.Version[0], pack.Version[1], pack.Version[2]),
+		Actor:   actor(r),
+		Entries: entries,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if pack.Used {
+		_, err = packs.Unlink(s.appDir, level, pack.Pack)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: "packs.remove",
+		Target: item.Name,
+	})
+	if err != nil {
+		fmt.Printf("Error recording pack removal: %v\n", err)
+	}
+
+	err = json.NewEncoder(w).Encode(item)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handlePacksExport streams a zip archive of the installed packs in the
+// path parameters, e.g. path=behavior_packs/addon, for a pack import
+// elsewhere.
+func (s *Server) handlePacksExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := s.installedPacks()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	paths := r.URL.Query()["path"]
+	if len(paths) == 0 {
+		http.Error(w, "No packs given", http.StatusBadRequest)
+		return
+	}
+
+	// Only whole installed packs, nothing else of the app directory
+	for _, path := range paths {
+		found := false
+
+		for _, p := range list {
+			found = found || filepath.ToSlash(p.Path()) == path
+		}
+
+		if !found {
+			http.Error(w, fmt.Sprintf("Pack %s not installed", path), http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="packs.zip"`)
+
+	err = snapshot.WritePaths(s.appDir, w, paths...)
+	if err != nil {
+		// Headers are already sent, the truncated archive fails to import
+		fmt.Printf("Error writing packs: %v\n", err)
+	}
+}
+
+// handlePacksImport installs the packs in an uploaded zip archive of pack
+// directories, as written by a pack export, replacing installed versions,
+// and adds them to the world's pack lists. The server picks them up on its
+// next restart. The import is a restore under the operation lock.
+func (s *Server) handlePacksImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result PackInstall
+
+	locked := false
+
+	err := s.jobs.Run(r.Context(), "import", "packs", actor(r), func(ctx context.Context, h *jobs.Handle) error {
+		release, err := s.acquire(ctx, h, r, oplock.Restore)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		locked = true
+
+		// Unpacked next to the packs so they can be moved into place
+		tmpDir, err := os.MkdirTemp(s.appDir, ".packs-*")
+		if err != nil {
+			return fmt.Errorf("error creating temp directory: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		err = snapshot.Restore(tmpDir, h.Reader(r.Body, max(r.ContentLength, 0)))
+		if err != nil {
+			return err
+		}
+
+		result.Installed, err = packs.Install(s.appDir, tmpDir)
+		if err != nil {
+			return err
+		}
+
+		result.Changes, err = packs.SyncWorld(s.appDir, s.levelName())
+
+		return err
+	})
+	if err != nil && !locked {
+		lockError(w, err)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	names := make([]string, 0, len(result.Installed))
+	for _, pack := range result.Installed {
+		names = append(names, fmt.Sprintf("%s %d.%d.%d", pack.Name, pack.Version[0], pack.Version[1], pack.Version[2]))
+	}
+
+	err = s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: "packs.install",
+		Target: strings.Join(names, ", "),
+	})
+	if err != nil {
+		fmt.Printf("Error recording pack install: %v\n", err)
+	}
+
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
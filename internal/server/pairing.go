@@ -0,0 +1,216 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/qrcode"
+)
+
+const (
+	// PairingTTL is how long a pairing code can be redeemed.
+	PairingTTL = 10 * time.Minute
+
+	// pairingAttempts wrong nonces discard a pairing code.
+	pairingAttempts = 5
+
+	// pairingParam carries the nonce in a pairing code.
+	pairingParam = "pair"
+)
+
+// ErrNoPairing is returned when no pairing code is open.
+var ErrNoPairing = errors.New("no pairing code open")
+
+// PairingConfig lets the central server add the wrapper with a one-time
+// pairing code instead of a copied shared key.
+type PairingConfig struct {
+	Address string // WebSocket URL the central server connects to; empty disables pairing
+	Name    string // Name the wrapper is added under
+}
+
+// PairingCode is a one-time code the central server redeems for the
+// wrapper's shared key. The code is the wrapper's address with a nonce.
+type PairingCode struct {
+	Code    string       `json:"code"`
+	Expires time.Time    `json:"expires"`
+	QR      *qrcode.Code `json:"-"`
+	SVG     string       `json:"qr_svg"`
+}
+
+// pairing holds the open pairing code, at most one.
+type pairing struct {
+	config   PairingConfig
+	mu       sync.Mutex
+	nonce    string
+	expires  time.Time
+	failures int
+}
+
+// ParsePairingCode splits a pairing code into the wrapper's address and the
+// nonce.
+func ParsePairingCode(code string) (address, nonce string, err error) {
+	u, err := url.Parse(strings.TrimSpace(code))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid pairing code: %w", err)
+	}
+
+	if u.Scheme != "ws" && u.Scheme != "wss" || u.Host == "" {
+		return "", "", errors.New("invalid pairing code: not a wrapper address")
+	}
+
+	query := u.Query()
+
+	nonce = query.Get(pairingParam)
+	if nonce == "" {
+		return "", "", errors.New("invalid pairing code: no nonce")
+	}
+
+	query.Del(pairingParam)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nonce, nil
+}
+
+// NewPairingCode opens a new pairing code, replacing the previous one.
+func (s *Server) NewPairingCode() (PairingCode, error) {
+	if s.pairing == nil {
+		return PairingCode{}, errors.New("pairing is disabled")
+	}
+
+	b := make([]byte, 10)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return PairingCode{}, fmt.Errorf("error generating pairing code: %w", err)
+	}
+
+	nonce := base32.StdEncoding.EncodeToString(b)
+	nonce = nonce[0:4] + "-" + nonce[4:8] + "-" + nonce[8:12] + "-" + nonce[12:16]
+
+	u, err := url.Parse(s.pairing.config.Address)
+	if err != nil {
+		return PairingCode{}, fmt.Errorf("invalid pairing address: %w", err)
+	}
+
+	query := u.Query()
+	query.Set(pairingParam, nonce)
+	u.RawQuery = query.Encode()
+
+	code := PairingCode{Code: u.String(), Expires: time.Now().Add(PairingTTL)}
+
+	code.QR, err = qrcode.Encode(code.Code)
+	if err != nil {
+		return PairingCode{}, fmt.Errorf("error encoding pairing code: %w", err)
+	}
+
+	code.SVG = code.QR.SVG(4)
+
+	s.pairing.mu.Lock()
+	s.pairing.nonce = nonce
+	s.pairing.expires = code.Expires
+	s.pairing.failures = 0
+	s.pairing.mu.Unlock()
+
+	return code, nil
+}
+
+// redeem closes the pairing code if nonce matches it.
+func (p *pairing) redeem(nonce string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.nonce == "" || time.Now().After(p.expires) {
+		p.nonce = ""
+		return ErrNoPairing
+	}
+
+	normalize := func(s string) []byte {
+		return []byte(strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s)))
+	}
+
+	if subtle.ConstantTimeCompare(normalize(nonce), normalize(p.nonce)) != 1 {
+		p.failures++
+		if p.failures >= pairingAttempts {
+			p.nonce = ""
+		}
+
+		return errors.New("wrong pairing code")
+	}
+
+	p.nonce = ""
+
+	return nil
+}
+
+// handlePairing opens a new pairing code (POST) for an authenticated user
+// to show the central server's admin.
+func (s *Server) handlePairing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code, err := s.NewPairingCode()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("Pairing code opened from %s, valid until %s\n", r.RemoteAddr, code.Expires.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(code)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// PairResponse is what the central server gets for a pairing code.
+type PairResponse struct {
+	Name      string `json:"name"`
+	SharedKey string `json:"shared_key"`
+}
+
+// handlePair hands the shared key to the central server for the nonce of
+// the open pairing code. It needs no auth key, the nonce stands in for it.
+func (s *Server) handlePair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Nonce string `json:"nonce"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Nonce == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = s.pairing.redeem(req.Nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	fmt.Printf("Paired with the central server at %s\n", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(PairResponse{Name: s.pairing.config.Name, SharedKey: s.sharedKey()})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
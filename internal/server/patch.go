@@ -0,0 +1,23 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/mergepatch"
+)
+
+// maxPatchSize bounds the JSON merge patch of a PATCH request.
+const maxPatchSize = 1 << 20
+
+// readPatch applies the JSON merge patch in the request body to a copy of a
+// resource and returns it.
+func readPatch[T any](r *http.Request, current T) (T, error) {
+	patch, err := io.ReadAll(io.LimitReader(r.Body, maxPatchSize))
+	if err != nil {
+		return current, fmt.Errorf("error reading patch: %w", err)
+	}
+
+	return mergepatch.Resource(current, patch)
+}
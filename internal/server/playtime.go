@@ -0,0 +1,56 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/activity"
+)
+
+// SetPlaytimeRules sets the commands run when a player's playtime on this
+// wrapper reaches a threshold.
+func (w *WrapperConnection) SetPlaytimeRules(rules []activity.Rule) {
+	w.rulesMu.Lock()
+	w.playtimeRules = rules
+	w.rulesMu.Unlock()
+}
+
+// runPlaytimeRules sends the commands of rules that became due.
+func (w *WrapperConnection) runPlaytimeRules() {
+	w.rulesMu.RLock()
+	rules := w.playtimeRules
+	w.rulesMu.RUnlock()
+
+	if w.activity == nil || w.Status != StatusConnected || w.readOnly.Load() {
+		return
+	}
+
+	for _, trigger := range w.activity.Due(w.ID, rules) {
+		err := w.SendMessage([]byte(trigger.Command))
+		if err != nil {
+			fmt.Printf("Error running playtime rule %s for %s on wrapper %s: %v\n", trigger.Rule, trigger.Player, w.ID, err)
+			return
+		}
+
+		fmt.Printf("Playtime rule %s fired for %s on wrapper %s\n", trigger.Rule, trigger.Player, w.ID)
+		w.activity.Fired(w.ID, trigger)
+	}
+}
+
+// PlaytimeHooks periodically runs the playtime rules of all wrappers until
+// the manager is shut down.
+func (m *ConnectionManager) PlaytimeHooks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, wConn := range m.ListConnections() {
+				wConn.runPlaytimeRules()
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/plugins"
+)
+
+// maxPluginBody caps the body of a request passed to a plugin.
+const maxPluginBody = 1 << 20
+
+// pluginHost carries out what plugins ask the wrapper to do.
+type pluginHost struct {
+	s *Server
+}
+
+func (h pluginHost) Command(plugin, command string) {
+	h.s.runner.WriteInput(command)
+}
+
+func (h pluginHost) Log(plugin, message string) {
+	fmt.Printf("[plugin %s] %s\n", plugin, message)
+}
+
+// startPlugins starts the configured plugins.
+func (s *Server) startPlugins(configs []plugins.Config) {
+	if len(configs) == 0 {
+		return
+	}
+
+	s.plugins = plugins.Start(configs, pluginHost{s: s})
+}
+
+// StopPlugins stops the plugins, letting them handle the events sent to
+// them so far.
+func (s *Server) StopPlugins() {
+	if s.plugins != nil {
+		s.plugins.Stop()
+	}
+}
+
+// publishPluginEvents passes the events in a console line to the plugins.
+func (s *Server) publishPluginEvents(text string) {
+	if s.plugins == nil {
+		return
+	}
+
+	for _, e := range consoleEvents(text) {
+		s.plugins.Publish(plugins.Event{Type: e.Type, Player: e.Player, XUID: e.XUID, Line: text})
+	}
+}
+
+// handlePlugins lists the plugins and what they registered.
+func (s *Server) handlePlugins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list := []plugins.Status{}
+	if s.plugins != nil {
+		list = s.plugins.List()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(list)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handlePluginRoute passes a request for /api/plugins/<name>/<route> to the
+// plugin serving the route and writes its response.
+func (s *Server) handlePluginRoute(w http.ResponseWriter, r *http.Request) {
+	if s.plugins == nil {
+		http.Error(w, "No plugins are configured", http.StatusNotFound)
+		return
+	}
+
+	name, route, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/plugins/"), "/")
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPluginBody))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	query.Del("auth")
+
+	resp, err := s.plugins.Serve(name, plugins.Request{
+		Method: r.Method,
+		Route:  route,
+		Query:  query,
+		Actor:  actor(r),
+		Body:   string(body),
+	})
+
+	switch {
+	case errors.Is(err, plugins.ErrNotFound), errors.Is(err, plugins.ErrNoRoute):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, plugins.ErrUnavailable):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, plugins.ErrTimeout):
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+
+	if resp.Status < 200 || resp.Status > 599 {
+		http.Error(w, fmt.Sprintf("Plugin sent invalid status %d", resp.Status), http.StatusBadGateway)
+		return
+	}
+
+	if resp.ContentType == "" {
+		resp.ContentType = "application/json"
+	}
+
+	w.Header().Set("Content-Type", resp.ContentType)
+	w.WriteHeader(resp.Status)
+
+	_, err = io.WriteString(w, resp.Body)
+	if err != nil {
+		fmt.Printf("Error sending plugin response: %v\n", err)
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/pregen"
+)
+
+const (
+	// pregenArea is the name of the ticking area loading each tile.
+	pregenArea = "wrapper_pregen"
+
+	// defaultPregenInterval is how long each tile stays loaded, giving
+	// bedrock_server time to generate it before the next one.
+	defaultPregenInterval = 10 * time.Second
+
+	// minPregenInterval and maxPregenInterval bound the throttling.
+	minPregenInterval = time.Second
+	maxPregenInterval = 10 * time.Minute
+)
+
+// PregenRequest is the body of a request to pregenerate the terrain around
+// a point, usually the world spawn.
+type PregenRequest struct {
+	X        int `json:"x"`
+	Z        int `json:"z"`
+	Radius   int `json:"radius"`   // In blocks
+	Interval int `json:"interval"` // Seconds each tile stays loaded, 10 if zero
+}
+
+// runPregen loads the tiles one at a time as a ticking area, reporting the
+// tiles done as progress, until all are done, the job is cancelled or the
+// server exits.
+func (s *Server) runPregen(ctx context.Context, h *jobs.Handle, tiles []pregen.Tile, interval time.Duration) error {
+	defer s.pregen.Store(false)
+
+	// Left over if the wrapper stopped during a previous run
+	s.runner.WriteInput(pregen.Remove(pregenArea))
+
+	h.Logf("pregenerating %d tiles of up to %dx%d chunks, %s each", len(tiles),
+		pregen.TileChunks, pregen.TileChunks, interval)
+	h.Progress(0, int64(len(tiles)))
+
+	for i, tile := range tiles {
+		s.runner.WriteInput(tile.Add(pregenArea))
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			s.runner.WriteInput(pregen.Remove(pregenArea))
+			return ctx.Err()
+		case <-s.runner.Done():
+			return errors.New("the server exited")
+		}
+
+		s.runner.WriteInput(pregen.Remove(pregenArea))
+
+		h.Progress(int64(i+1), int64(len(tiles)))
+	}
+
+	h.Logf("pregenerated %d tiles", len(tiles))
+
+	return nil
+}
+
+// handlePregen starts pregenerating the terrain around a point as a job
+// (POST), which can be followed and cancelled through /api/jobs. Only one
+// pregeneration runs at a time.
+func (s *Server) handlePregen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PregenRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tiles, err := pregen.Plan(req.X, req.Z, req.Radius)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	interval := defaultPregenInterval
+	if req.Interval != 0 {
+		interval = time.Duration(req.Interval) * time.Second
+	}
+
+	if interval < minPregenInterval || interval > maxPregenInterval {
+		http.Error(w, fmt.Sprintf("The interval must be between %s and %s", minPregenInterval, maxPregenInterval),
+			http.StatusBadRequest)
+		return
+	}
+
+	if !s.pregen.CompareAndSwap(false, true) {
+		http.Error(w, "A pregeneration is already running", http.StatusConflict)
+		return
+	}
+
+	description := fmt.Sprintf("%d blocks around %d, %d", req.Radius, req.X, req.Z)
+
+	job := s.jobs.Start("pregen", description, actor(r), func(ctx context.Context, h *jobs.Handle) error {
+		return s.runPregen(ctx, h, tiles, interval)
+	})
+
+	err = s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: "world.pregen",
+		Target: description,
+	})
+	if err != nil {
+		fmt.Printf("Error recording pregeneration: %v\n", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+
+	err = json.NewEncoder(w).Encode(job)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
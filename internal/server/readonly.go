@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var ErrReadOnly = errors.New("central server is in read-only mode")
+
+// SetReadOnly blocks (or allows again) sending commands to any wrapper.
+func (m *ConnectionManager) SetReadOnly(readOnly bool) {
+	m.readOnly.Store(readOnly)
+}
+
+// ReadOnly reports whether the central server is in read-only mode.
+func (m *ConnectionManager) ReadOnly() bool {
+	return m.readOnly.Load()
+}
+
+// readOnlyMiddleware rejects requests that change anything while the central
+// server is in read-only mode. Only reads, composing messages, the switch
+// itself, signing in and out and personal preferences such as the language
+// get through; console commands are refused by the wrapper connections.
+func (s *CentralServer) readOnlyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		safe := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+
+		exempt := r.URL.Path == "/api/readonly" || r.URL.Path == "/api/sessions" || r.URL.Path == "/api/messages/compose" ||
+			r.URL.Path == "/api/i18n" ||
+			r.URL.Path == "/api/preferences" ||
+			strings.HasPrefix(r.URL.Path, "/api/2fa")
+
+		if !safe && s.manager.ReadOnly() && !exempt {
+			http.Error(w, ErrReadOnly.Error(), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// ReadOnlyState is the body of read-only mode requests and responses.
+type ReadOnlyState struct {
+	ReadOnly bool `json:"read_only"`
+}
+
+// handleReadOnly reports (GET) or switches (PUT or POST, admins only)
+// read-only mode.
+func (s *CentralServer) handleReadOnly(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		if !requestUser(r).Admin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		var state ReadOnlyState
+
+		err := json.NewDecoder(r.Body).Decode(&state)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if state.ReadOnly != s.manager.ReadOnly() {
+			fmt.Printf("Read-only mode %s\n", map[bool]string{true: "enabled", false: "disabled"}[state.ReadOnly])
+		}
+
+		s.manager.SetReadOnly(state.ReadOnly)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(ReadOnlyState{ReadOnly: s.manager.ReadOnly()})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
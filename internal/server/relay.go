@@ -0,0 +1,314 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reconnect backoff of the relay link of a wrapper.
+const (
+	relayRetryMin = 5 * time.Second
+	relayRetryMax = time.Minute
+)
+
+// relayDial asks a wrapper on its relay link to open a connection, which it
+// does by connecting to the accept endpoint with the token.
+const relayDial = "dial"
+
+// relayMessage is sent by the central server on the relay link of a wrapper.
+type relayMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token,omitempty"` // Of the connection to open
+}
+
+// RelayConfig lets a wrapper that can't accept connections, such as one
+// behind CGNAT, be reached through a relay it connects to. Each connection
+// the central server opens to the wrapper is then carried by a WebSocket
+// the wrapper opens to the relay.
+type RelayConfig struct {
+	URL string // Relay endpoint, e.g. wss://central.example.com/api/relay; empty disables the relay
+	ID  string // ID of the wrapper in the central server's config
+}
+
+// Validate checks that the relay endpoint is a WebSocket URL.
+func (c RelayConfig) Validate() error {
+	if c.URL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid relay URL: %w", err)
+	}
+
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return fmt.Errorf("relay URL %q must start with ws:// or wss://", c.URL)
+	}
+
+	if c.ID == "" {
+		return errors.New("the relay needs the wrapper's ID in the central server's config")
+	}
+
+	return nil
+}
+
+// endpoint returns the URL of the relay link, or of the accept endpoint if
+// token is set.
+func (c RelayConfig) endpoint(token string) string {
+	u, _ := url.Parse(c.URL) // Checked by Validate
+
+	query := u.Query()
+	query.Set("wrapper", c.ID)
+
+	if token != "" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/accept"
+		query.Set("token", token)
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// relayListener hands the connections opened through the relay to the web
+// server, which serves them like the ones it accepts itself.
+type relayListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+	addr  relayAddr
+}
+
+// relayAddr is the address of connections through a relay.
+type relayAddr string
+
+func (a relayAddr) Network() string { return "relay" }
+func (a relayAddr) String() string  { return string(a) }
+
+func newRelayListener(endpoint string) *relayListener {
+	return &relayListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+		addr:  relayAddr(endpoint),
+	}
+}
+
+func (l *relayListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *relayListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *relayListener) Addr() net.Addr {
+	return l.addr
+}
+
+// runRelay keeps the relay link of the wrapper open, opening a connection
+// through the relay whenever the central server asks for one, until the
+// listener is closed.
+func (s *Server) runRelay(l *relayListener) {
+	delay := relayRetryMin
+
+	for {
+		start := time.Now()
+
+		err := s.relayLink(l)
+
+		select {
+		case <-l.done:
+			return
+		default:
+		}
+
+		// A link that stayed up a while was fine, retry quickly
+		if time.Since(start) > relayRetryMax {
+			delay = relayRetryMin
+		}
+
+		fmt.Printf("Relay link lost: %v; reconnecting in %s\n", err, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-l.done:
+			return
+		}
+
+		delay = min(delay*2, relayRetryMax)
+	}
+}
+
+// relayLink connects to the relay and serves its requests until the link
+// fails.
+func (s *Server) relayLink(l *relayListener) error {
+	dialer := websocket.Dialer{HandshakeTimeout: s.keepalive.HandshakeTimeout}
+
+	conn, resp, err := dialer.Dial(s.relay.endpoint(""), s.relayHeader())
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("error connecting to relay: %w (HTTP Status: %d)", err, resp.StatusCode)
+		}
+
+		return fmt.Errorf("error connecting to relay: %w", err)
+	}
+	defer conn.Close()
+
+	fmt.Printf("Relay link to %s established\n", s.relay.URL)
+
+	// The link is dead once pongs to the wrapper's pings stop
+	_ = conn.SetReadDeadline(time.Now().Add(s.keepalive.PongWait))
+
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(s.keepalive.PongWait))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(s.keepalive.PingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.keepalive.WriteWait))
+				if err != nil {
+					_ = conn.Close()
+					return
+				}
+			case <-l.done:
+				_ = conn.Close()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		var msg relayMessage
+
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			return err
+		}
+
+		if msg.Type == relayDial && msg.Token != "" {
+			go s.acceptRelayed(l, msg.Token)
+		}
+	}
+}
+
+// acceptRelayed opens the connection the central server asked for with the
+// token and hands it to the web server.
+func (s *Server) acceptRelayed(l *relayListener, token string) {
+	dialer := websocket.Dialer{HandshakeTimeout: s.keepalive.HandshakeTimeout}
+
+	conn, _, err := dialer.Dial(s.relay.endpoint(token), s.relayHeader())
+	if err != nil {
+		fmt.Printf("Error opening relayed connection: %v\n", err)
+		return
+	}
+
+	select {
+	case l.conns <- wsStream(conn):
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+// relayHeader authenticates the wrapper to the relay with its shared key.
+func (s *Server) relayHeader() http.Header {
+	header := http.Header{}
+	header.Set("X-Auth-Key", s.sharedKey())
+
+	return header
+}
+
+// sharedKey returns the key the central server knows the wrapper by: the
+// central key if set, or the auth key.
+func (s *Server) sharedKey() string {
+	if s.centralKey != "" {
+		return s.centralKey
+	}
+
+	return s.authKey
+}
+
+// wsStream returns a connection carrying a byte stream in the binary
+// messages of a WebSocket. A pipe in between gives it the deadlines HTTP
+// servers and clients rely on, which WebSocket connections can't recover
+// from.
+func wsStream(ws *websocket.Conn) net.Conn {
+	local, remote := net.Pipe()
+
+	// WebSocket to pipe
+	go func() {
+		defer remote.Close()
+
+		for {
+			typ, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if typ != websocket.BinaryMessage {
+				continue
+			}
+
+			_, err = remote.Write(data)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Pipe to WebSocket
+	go func() {
+		defer ws.Close()
+
+		buf := make([]byte, 32*1024)
+
+		for {
+			n, err := remote.Read(buf)
+			if n > 0 {
+				if ws.WriteMessage(websocket.BinaryMessage, buf[:n]) != nil {
+					return
+				}
+			}
+
+			if err != nil {
+				_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+					time.Now().Add(time.Second))
+				return
+			}
+		}
+	}()
+
+	return &streamConn{Conn: local, local: ws.LocalAddr(), remote: ws.RemoteAddr()}
+}
+
+// streamConn is a pipe with the addresses of the WebSocket it's carried by.
+type streamConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *streamConn) LocalAddr() net.Addr  { return c.local }
+func (c *streamConn) RemoteAddr() net.Addr { return c.remote }
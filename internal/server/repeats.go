@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// repeatCheckInterval is how often repeats held back are checked for a
+// summary that is due.
+const repeatCheckInterval = 5 * time.Second
+
+// logConsoleLine appends a line of bedrock_server, as read, to the
+// persistent console log, if any.
+func (s *Server) logConsoleLine(text string, t time.Time) {
+	if s.consoleLog == nil {
+		return
+	}
+
+	err := s.consoleLog.Write(t, text)
+	if err != nil {
+		fmt.Printf("Error logging console line: %v\n", err)
+	}
+}
+
+// publishCollapsed publishes a line of bedrock_server like publishLine,
+// holding back repeats of the previous line when collapsing is enabled.
+func (s *Server) publishCollapsed(text, stream string, t, logged time.Time) {
+	if s.repeats != nil {
+		summary, repeated := s.repeats.Add(text, t)
+		if summary != "" {
+			s.publishLine(summary, "", t, time.Time{})
+		}
+
+		if repeated {
+			return
+		}
+	}
+
+	s.publishLine(text, stream, t, logged)
+}
+
+// RunRepeats summarizes lines repeating without end, or held back with no
+// line after them, once per collapse window, until the server exits.
+func (s *Server) RunRepeats() {
+	if s.repeats == nil {
+		return
+	}
+
+	ticker := time.NewTicker(repeatCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.runner.Done():
+			return
+		case now := <-ticker.C:
+			if summary := s.repeats.Due(now); summary != "" {
+				s.publish(summary)
+			}
+		}
+	}
+}
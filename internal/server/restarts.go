@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notices"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/raknet"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rules"
+)
+
+// presence tracks the players online from the console, for restarts
+// deferred until the server is empty.
+type presence struct {
+	mu         sync.Mutex
+	players    map[string]bool
+	emptySince time.Time // Zero while players are online or before the server started
+}
+
+// track updates the players online from the events in a console line.
+func (p *presence) track(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range consoleEvents(text) {
+		switch e.Type {
+		case rules.EventJoin:
+			p.players[e.Player] = true
+			p.emptySince = time.Time{}
+		case rules.EventLeave:
+			delete(p.players, e.Player)
+
+			if len(p.players) == 0 {
+				p.emptySince = time.Now()
+			}
+		case rules.EventStart:
+			p.players = make(map[string]bool)
+			p.emptySince = time.Now()
+		}
+	}
+}
+
+// empty returns how long no player has been online.
+func (p *presence) empty(now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.players) > 0 || p.emptySince.IsZero() {
+		return 0
+	}
+
+	return now.Sub(p.emptySince)
+}
+
+// trackPresence passes a console line to the presence tracker.
+func (s *Server) trackPresence(text string) {
+	if s.presence != nil {
+		s.presence.track(text)
+	}
+}
+
+// emptyFor returns how long the server has been empty. A ping at address,
+// if known, confirms it, since a player missed on the console would
+// otherwise be kicked by the restart.
+func (s *Server) emptyFor(now time.Time, address string) time.Duration {
+	if s.presence == nil {
+		return 0
+	}
+
+	empty := s.presence.empty(now)
+	if empty == 0 || address == "" {
+		return empty
+	}
+
+	result := raknet.Ping(context.Background(), address, raknet.PingOptions{Timeout: pingTimeout})
+	if result.Err == nil && result.Pong.PlayerCount > 0 {
+		return 0
+	}
+
+	return empty
+}
+
+// runRestarts restarts the server for a schedule in a window once it has
+// been empty long enough, and otherwise counts down to the deadline at the
+// end of the window.
+func (s *Server) runRestarts(now time.Time, address string) {
+	step, ok, err := s.schedules.RestartDue(now.In(s.location), s.emptyFor(now, address))
+	if err != nil {
+		fmt.Printf("Error updating schedules: %v\n", err)
+	}
+
+	if !ok {
+		return
+	}
+
+	if step.Restart {
+		s.restartScheduled(step.Name, "no player online", step.Notice)
+		return
+	}
+
+	s.sayNotice(notices.Countdown, step.Message, notices.Values{Left: step.Warn, Reason: notices.ReasonSchedule})
+}
+
+// restartScheduled restarts the server for a schedule, for why, saying the
+// restart notice or the schedule's own, notice, if set.
+func (s *Server) restartScheduled(name, why, notice string) {
+	s.alert(fmt.Sprintf("[wrapper] Schedule %q restarting the server: %s", name, why))
+
+	err := s.audit.Record(audit.Entry{
+		Actor:  scheduleActor,
+		Action: "schedule.restart",
+		Target: name,
+	})
+	if err != nil {
+		fmt.Printf("Error recording scheduled restart: %v\n", err)
+	}
+
+	s.sayNotice(notices.Restart, notice, notices.Values{Reason: notices.ReasonSchedule})
+	s.runner.WriteInput("stop")
+}
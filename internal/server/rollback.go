@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notices"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/oplock"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rollback"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/snapshot"
+)
+
+// RollbackDir is the directory of the rollback points in the app directory.
+const RollbackDir = "rollback"
+
+// takeRollbackPoint saves a verified safety backup before a change, holding
+// saves meanwhile so the world files are consistent. Without rollback
+// points it does nothing. The caller holds the operation lock.
+func (s *Server) takeRollbackPoint(ctx context.Context, h *jobs.Handle, reason, detail, actor string) error {
+	if s.rollback == nil {
+		return nil
+	}
+
+	s.runner.WriteInput("save hold")
+	defer s.runner.WriteInput("save resume")
+
+	if h != nil {
+		h.Logf("holding saves for a safety backup")
+	}
+
+	select {
+	case <-time.After(saveHoldWait):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	p, err := s.rollback.Take(s.appDir, rollback.Point{Reason: reason, Detail: detail, Actor: actor})
+	if err != nil {
+		return fmt.Errorf("safety backup failed, nothing was changed: %w", err)
+	}
+
+	fmt.Printf("Rollback point %s taken before %s\n", p.ID, reason)
+
+	if h != nil {
+		h.Logf("safety backup %s verified, %d files", p.ID, p.Files)
+	}
+
+	return nil
+}
+
+// handleRollback lists the rollback points (GET) or restores the one in ?id=
+// and restarts the server on it (POST). Files added since the point was
+// taken, such as a new world, are left in place. A rollback is a restore
+// under the operation lock.
+func (s *Server) handleRollback(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		err := json.NewEncoder(w).Encode(s.rollback.List())
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+		}
+
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p, path, err := s.rollback.Get(r.URL.Query().Get("id"))
+	if errors.Is(err, rollback.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	locked := false
+
+	err = s.jobs.Run(r.Context(), "rollback", fmt.Sprintf("before %s %s", p.Reason, p.Detail), actor(r),
+		func(ctx context.Context, h *jobs.Handle) error {
+			release, err := s.acquire(ctx, h, r, oplock.Restore)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			locked = true
+
+			f, err := os.Open(path) // #nosec G304
+			if err != nil {
+				return fmt.Errorf("error opening rollback point: %w", err)
+			}
+			defer f.Close()
+
+			h.Logf("restoring %s", p.ID)
+
+			return snapshot.Restore(s.appDir, f)
+		})
+	if err != nil && !locked {
+		lockError(w, err)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: "rollback",
+		Target: fmt.Sprintf("%s (before %s %s)", p.ID, p.Reason, p.Detail),
+	})
+	if err != nil {
+		fmt.Printf("Error recording rollback: %v\n", err)
+	}
+
+	s.sayNotice(notices.Maintenance, "", notices.Values{Reason: notices.ReasonRollback})
+	s.runner.WriteInput("stop")
+
+	w.WriteHeader(http.StatusOK)
+}
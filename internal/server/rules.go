@@ -0,0 +1,320 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/events"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/plugins"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rules"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/scripting"
+)
+
+// startedLine is logged by bedrock_server once it accepts players.
+const startedLine = "Server started."
+
+// RestartHold is whether restarts after a crash are held by a rule.
+type RestartHold struct {
+	Held    bool      `json:"held"`
+	Rule    string    `json:"rule,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+	Waiting bool      `json:"waiting"` // The server crashed and the wrapper waits for the release
+}
+
+// openRules loads the automation rules.
+func (s *Server) openRules() {
+	engine, err := rules.Open(s.appDir)
+	if err != nil {
+		fmt.Printf("Error opening rules: %v\n", err)
+		return
+	}
+
+	s.rules = engine
+}
+
+// consoleEvent is an event parsed from a console line, with the event
+// names shared by rules and scripts.
+type consoleEvent struct {
+	Type   string
+	Player string
+	XUID   string
+}
+
+// consoleEvents returns the events in a console line: the line itself, a
+// player joining or leaving, or the server having started.
+func consoleEvents(text string) []consoleEvent {
+	list := []consoleEvent{{Type: rules.EventOutput}}
+
+	if e, ok := events.Parse(text); ok {
+		typ := rules.EventJoin
+		if e.Type == events.TypeLeave {
+			typ = rules.EventLeave
+		}
+
+		list = append(list, consoleEvent{Type: typ, Player: e.Player, XUID: e.XUID})
+	}
+
+	if strings.Contains(text, startedLine) {
+		list = append(list, consoleEvent{Type: rules.EventStart})
+	}
+
+	return list
+}
+
+// handleRuleLine passes the events in a console line to the rules.
+func (s *Server) handleRuleLine(text string) {
+	if s.rules == nil {
+		return
+	}
+
+	for _, e := range consoleEvents(text) {
+		s.runRules(rules.Event{Type: e.Type, Player: e.Player, XUID: e.XUID, Line: text})
+	}
+}
+
+// runRules handles an event and takes the actions of the rules that fire.
+func (s *Server) runRules(e rules.Event) {
+	for _, firing := range s.rules.Handle(e) {
+		for _, action := range firing.Actions {
+			switch action.Type {
+			case rules.ActionCommand:
+				s.runner.WriteInput(action.Command)
+			case rules.ActionAlert:
+				s.alert(fmt.Sprintf("[wrapper] Rule %s: %s", firing.Rule, action.Message))
+			case rules.ActionHold:
+				s.holdMu.Lock()
+				if !s.hold.Held {
+					s.hold = RestartHold{Held: true, Rule: firing.Rule, Since: time.Now().UTC()}
+				}
+				s.holdMu.Unlock()
+			}
+		}
+	}
+}
+
+// Crashed reports that bedrock_server exited without being stopped to the
+// clients, scripts, plugins, MQTT and rules. If a rule holds restarts, it alerts and blocks until
+// the hold is released through the API, keeping the web console up
+// meanwhile.
+func (s *Server) Crashed(err error) {
+	s.alert(fmt.Sprintf("[wrapper] Server crashed: %v", err))
+
+	if s.scripts != nil {
+		s.runScripts(scripting.Event{Type: rules.EventCrash, Line: err.Error()})
+		s.waitWebhooks()
+	}
+
+	if s.plugins != nil {
+		s.plugins.Publish(plugins.Event{Type: rules.EventCrash, Line: err.Error()})
+	}
+
+	s.mqttCrashed(err)
+
+	if s.rules == nil {
+		return
+	}
+
+	s.runRules(rules.Event{Type: rules.EventCrash, Line: err.Error()})
+
+	s.holdMu.Lock()
+	held := s.hold
+	s.hold.Waiting = held.Held
+	release := s.holdRelease
+	s.holdMu.Unlock()
+
+	if !held.Held {
+		return
+	}
+
+	s.alert(fmt.Sprintf("[wrapper] Rule %s holds restarts after a crash; release it through /api/rules/hold to restart",
+		held.Rule))
+
+	<-release
+}
+
+// handleRules lists the automation rules (GET, or one with ?id=), adds or updates one
+// (POST, without an ID to add), creates or replaces one with the ID of its
+// choice (PUT ?id=), changes some fields of one with a JSON merge patch
+// (PATCH ?id=) and deletes one (DELETE ?id=). Changes are recorded in the
+// audit log.
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	if s.rules == nil {
+		http.Error(w, "Rules are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var result any
+
+	status := http.StatusOK
+	id := r.URL.Query().Get("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		if id == "" {
+			result = s.rules.List()
+			break
+		}
+
+		rule, err := s.rules.Get(id)
+		if err != nil {
+			ruleError(w, err)
+			return
+		}
+
+		result = rule
+	case http.MethodPost:
+		var rule rules.Rule
+
+		err := json.NewDecoder(r.Body).Decode(&rule)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		rule, err = s.rules.Put(rule)
+		if err != nil {
+			ruleError(w, err)
+			return
+		}
+
+		s.auditRule(r, "rule.update", rule.Name)
+
+		result = rule
+	case http.MethodPut:
+		var rule rules.Rule
+
+		err := json.NewDecoder(r.Body).Decode(&rule)
+		if err != nil || (rule.ID != "" && rule.ID != id) {
+			http.Error(w, "Invalid request body, the ID must match ?id=", http.StatusBadRequest)
+			return
+		}
+
+		rule.ID = id
+
+		rule, added, err := s.rules.Set(rule)
+		if err != nil {
+			ruleError(w, err)
+			return
+		}
+
+		if added {
+			status = http.StatusCreated
+		}
+
+		s.auditRule(r, "rule.update", rule.Name)
+
+		result = rule
+	case http.MethodPatch:
+		rule, err := s.rules.Get(id)
+		if err != nil {
+			ruleError(w, err)
+			return
+		}
+
+		rule, err = readPatch(r, rule)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rule.ID = id
+
+		rule, _, err = s.rules.Set(rule)
+		if err != nil {
+			ruleError(w, err)
+			return
+		}
+
+		s.auditRule(r, "rule.update", rule.Name)
+
+		result = rule
+	case http.MethodDelete:
+		err := s.rules.Delete(id)
+		if err != nil {
+			ruleError(w, err)
+			return
+		}
+
+		s.auditRule(r, "rule.delete", id)
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleRestartHold reports (GET) or releases (DELETE) a restart hold. If
+// the wrapper waits after a crash, releasing the hold lets it exit so it is
+// restarted.
+func (s *Server) handleRestartHold(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.holdMu.Lock()
+		hold := s.hold
+		s.holdMu.Unlock()
+
+		err := json.NewEncoder(w).Encode(hold)
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+		}
+	case http.MethodDelete:
+		s.holdMu.Lock()
+		hold := s.hold
+		s.hold = RestartHold{}
+
+		if hold.Waiting {
+			// A restarted server may be held again after its next crash
+			close(s.holdRelease)
+			s.holdRelease = make(chan struct{})
+		}
+		s.holdMu.Unlock()
+
+		if hold.Held {
+			s.auditRule(r, "rule.release", hold.Rule)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ruleError reports a rules API error with a matching status.
+func ruleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rules.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, rules.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// auditRule records a change to the rules.
+func (s *Server) auditRule(r *http.Request, action, target string) {
+	err := s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: action,
+		Target: target,
+	})
+	if err != nil {
+		fmt.Printf("Error recording rule change: %v\n", err)
+	}
+}
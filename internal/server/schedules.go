@@ -0,0 +1,297 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/config"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/schedule"
+)
+
+const (
+	// schedulesName is the settings schedules file in the app directory.
+	schedulesName = "schedules.json"
+
+	// scheduleInterval is how often schedules are checked.
+	scheduleInterval = 15 * time.Second
+
+	// scheduleActor is the audit log actor of scheduled changes.
+	scheduleActor = "schedule"
+)
+
+// Schedules are the settings schedules and those in a window.
+type Schedules struct {
+	Schedules []schedule.Schedule        `json:"schedules"`
+	Active    map[string]schedule.Active `json:"active"`   // By schedule ID
+	Settings  map[string][]string        `json:"settings"` // Settings schedules can change, with their values
+	Timezone  string                     `json:"timezone"` // IANA name of the timezone of start and end times
+}
+
+// openSchedules loads the settings schedules.
+func (s *Server) openSchedules() {
+	store, err := schedule.Open(filepath.Join(s.appDir, schedulesName))
+	if err != nil {
+		fmt.Printf("Error opening schedules: %v\n", err)
+		return
+	}
+
+	s.schedules = store
+	s.presence = &presence{players: make(map[string]bool)}
+}
+
+// RunSchedules starts and ends settings schedules when they are due, and
+// makes their deferred restarts, until the server exits. Whether the server
+// is empty is confirmed by pinging bedrock_server at pingAddress, if set.
+func (s *Server) RunSchedules(pingAddress string) {
+	if s.schedules == nil {
+		return
+	}
+
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.runner.Done():
+			return
+		case now := <-ticker.C:
+			s.runSchedules(now)
+			s.runRestarts(now, pingAddress)
+		}
+	}
+}
+
+// runSchedules applies the schedules starting and ending at now, in the
+// wrapper's timezone: their settings are saved in server.properties, so
+// they survive a restart, and applied to the running server with commands.
+func (s *Server) runSchedules(now time.Time) {
+	current, err := config.ReadProperties(s.appDir)
+	if err != nil {
+		fmt.Printf("Error reading settings for schedules: %v\n", err)
+		return
+	}
+
+	changes, err := s.schedules.Due(now.In(s.location), current)
+	if err != nil {
+		fmt.Printf("Error updating schedules: %v\n", err)
+	}
+
+	for _, change := range changes {
+		err = s.applySettings(change)
+		if err != nil {
+			fmt.Printf("Error applying schedule %s: %v\n", change.Name, err)
+		}
+
+		for _, command := range change.Commands {
+			s.runner.WriteInput(command)
+		}
+
+		state := "ended"
+		if change.Start {
+			state = "started"
+		}
+
+		s.alert(fmt.Sprintf("[wrapper] Schedule %q %s", change.Name, state))
+
+		if change.Restart {
+			s.restartScheduled(change.Name, "its window ended", change.Notice)
+		}
+	}
+}
+
+// applySettings saves the settings of a schedule change in
+// server.properties, recording the change.
+func (s *Server) applySettings(change schedule.Change) error {
+	if len(change.Settings) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(s.appDir, "server.properties")
+
+	old, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("error reading server.properties: %w", err)
+	}
+
+	err = config.EnsureProperties(s.appDir, change.Settings)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("error reading server.properties: %w", err)
+	}
+
+	action := "schedule.end"
+	if change.Start {
+		action = "schedule.start"
+	}
+
+	s.trackConfig("server.properties", scheduleActor, change.Name, old, data)
+
+	return s.audit.Record(audit.Entry{
+		Actor:  scheduleActor,
+		Action: action,
+		Target: change.Name,
+		Diff:   audit.Diff("server.properties", old, data),
+	})
+}
+
+// handleSchedules lists settings schedules (GET, or one with ?id=), adds or
+// updates one (POST, without an ID to add), creates or replaces one with
+// the ID of its choice (PUT ?id=), changes some fields of one with a JSON
+// merge patch (PATCH ?id=) and deletes one (DELETE ?id=). Changes are
+// recorded in the audit log.
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	if s.schedules == nil {
+		http.Error(w, "Schedules are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var result any
+
+	status := http.StatusOK
+	id := r.URL.Query().Get("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		if id != "" {
+			sc, err := s.schedules.Get(id)
+			if err != nil {
+				scheduleError(w, err)
+				return
+			}
+
+			result = sc
+
+			break
+		}
+
+		result = Schedules{
+			Schedules: s.schedules.List(),
+			Active:    s.schedules.Active(),
+			Settings:  schedule.Settings,
+			Timezone:  s.location.String(),
+		}
+	case http.MethodPost:
+		var sc schedule.Schedule
+
+		err := json.NewDecoder(r.Body).Decode(&sc)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		sc, err = s.schedules.Put(sc)
+		if err != nil {
+			scheduleError(w, err)
+			return
+		}
+
+		s.auditSchedule(r, "schedule.update", sc.Name)
+
+		result = sc
+	case http.MethodPut:
+		var sc schedule.Schedule
+
+		err := json.NewDecoder(r.Body).Decode(&sc)
+		if err != nil || (sc.ID != "" && sc.ID != id) {
+			http.Error(w, "Invalid request body, the ID must match ?id=", http.StatusBadRequest)
+			return
+		}
+
+		sc.ID = id
+
+		sc, added, err := s.schedules.Set(sc)
+		if err != nil {
+			scheduleError(w, err)
+			return
+		}
+
+		if added {
+			status = http.StatusCreated
+		}
+
+		s.auditSchedule(r, "schedule.update", sc.Name)
+
+		result = sc
+	case http.MethodPatch:
+		sc, err := s.schedules.Get(id)
+		if err != nil {
+			scheduleError(w, err)
+			return
+		}
+
+		sc, err = readPatch(r, sc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sc.ID = id
+
+		sc, _, err = s.schedules.Set(sc)
+		if err != nil {
+			scheduleError(w, err)
+			return
+		}
+
+		s.auditSchedule(r, "schedule.update", sc.Name)
+
+		result = sc
+	case http.MethodDelete:
+		err := s.schedules.Delete(id)
+		if err != nil {
+			scheduleError(w, err)
+			return
+		}
+
+		s.auditSchedule(r, "schedule.delete", id)
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// scheduleError reports a schedule API error with a matching status.
+func scheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, schedule.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, schedule.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// auditSchedule records a change to the settings schedules.
+func (s *Server) auditSchedule(r *http.Request, action, target string) {
+	err := s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: action,
+		Target: target,
+	})
+	if err != nil {
+		fmt.Printf("Error recording schedule change: %v\n", err)
+	}
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rules"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/scripting"
+)
+
+const (
+	// webhookTimeout bounds a script webhook request.
+	webhookTimeout = 10 * time.Second
+
+	// maxWebhooks is how many script webhooks may be in flight; more are
+	// dropped.
+	maxWebhooks = 4
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// ScriptEvalRequest is the body of a dry run: a script and the event to run
+// it on.
+type ScriptEvalRequest struct {
+	Source string          `json:"source"`
+	Event  scripting.Event `json:"event"`
+}
+
+// openScripts loads the event scripts.
+func (s *Server) openScripts() {
+	engine, err := scripting.Open(s.appDir, scripting.DefaultLimits)
+	if err != nil {
+		fmt.Printf("Error opening scripts: %v\n", err)
+		return
+	}
+
+	s.scripts = engine
+	s.webhooks = make(chan struct{}, maxWebhooks)
+}
+
+// scriptLine passes the events in a console line to the scripts and returns
+// the line to show, or false if a script hid it.
+func (s *Server) scriptLine(text string) (string, bool) {
+	if s.scripts == nil {
+		return text, true
+	}
+
+	show := true
+
+	for _, e := range consoleEvents(text) {
+		results := s.runScripts(scripting.Event{Type: e.Type, Player: e.Player, XUID: e.XUID, Line: text})
+
+		if e.Type != rules.EventOutput {
+			continue
+		}
+
+		for _, r := range results {
+			if r.Drop {
+				show = false
+			}
+
+			if r.Replace != nil {
+				text = *r.Replace
+			}
+		}
+	}
+
+	return text, show
+}
+
+// runScripts runs the scripts on an event and carries out what they queued.
+func (s *Server) runScripts(e scripting.Event) []scripting.Result {
+	results := s.scripts.Handle(e)
+
+	for _, r := range results {
+		for _, line := range r.Logs {
+			fmt.Printf("[script %s] %s\n", r.Script, line)
+		}
+
+		if r.Error != "" {
+			if strings.Contains(r.Error, "disabled after") {
+				s.alert(fmt.Sprintf("[wrapper] Script %s: %s", r.Script, r.Error))
+			} else {
+				fmt.Printf("Error in script %s: %s\n", r.Script, r.Error)
+			}
+		}
+
+		for _, command := range r.Commands {
+			s.runner.WriteInput(command)
+		}
+
+		for _, hook := range r.Webhooks {
+			select {
+			case s.webhooks <- struct{}{}:
+				go s.postWebhook(r.Script, hook)
+			default:
+				fmt.Printf("Dropped webhook of script %s, too many in flight\n", r.Script)
+			}
+		}
+	}
+
+	return results
+}
+
+// postWebhook sends a script webhook.
+func (s *Server) postWebhook(script string, hook scripting.Webhook) {
+	defer func() { <-s.webhooks }()
+
+	contentType := "text/plain; charset=utf-8"
+	if json.Valid([]byte(hook.Body)) {
+		contentType = "application/json"
+	}
+
+	resp, err := webhookClient.Post(hook.URL, contentType, bytes.NewReader([]byte(hook.Body))) // #nosec G107
+	if err != nil {
+		fmt.Printf("Error sending webhook of script %s: %v\n", script, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		fmt.Printf("Webhook of script %s failed: %s\n", script, resp.Status)
+	}
+}
+
+// waitWebhooks waits for the script webhooks in flight to finish, so they
+// are sent before the wrapper exits.
+func (s *Server) waitWebhooks() {
+	deadline := time.After(webhookTimeout)
+	acquired := 0
+
+	defer func() {
+		for ; acquired > 0; acquired-- {
+			<-s.webhooks
+		}
+	}()
+
+	for acquired < maxWebhooks {
+		select {
+		case s.webhooks <- struct{}{}:
+			acquired++
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// handleScripts lists the event scripts (GET), adds or updates one after
+// checking it compiles (POST, without an ID to add) and deletes one (DELETE
+// ?id=). Changes are recorded in the audit log.
+func (s *Server) handleScripts(w http.ResponseWriter, r *http.Request) {
+	if s.scripts == nil {
+		http.Error(w, "Scripts are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var result any
+
+	switch r.Method {
+	case http.MethodGet:
+		result = s.scripts.List()
+	case http.MethodPost:
+		var script scripting.Script
+
+		err := json.NewDecoder(r.Body).Decode(&script)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		old := ""
+
+		for _, existing := range s.scripts.List() {
+			if existing.ID == script.ID {
+				old = existing.Source
+			}
+		}
+
+		script, err = s.scripts.Put(script)
+		if err != nil {
+			scriptError(w, err)
+			return
+		}
+
+		s.auditScript(r, "script.update", script.Name, audit.Diff(script.Name+".lua", []byte(old), []byte(script.Source)))
+
+		result = script
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+
+		err := s.scripts.Delete(id)
+		if err != nil {
+			scriptError(w, err)
+			return
+		}
+
+		s.auditScript(r, "script.delete", id, "")
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleScriptEval runs a script on an event in a sandbox of its own and
+// returns what it would do, without doing it.
+func (s *Server) handleScriptEval(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ScriptEvalRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(scripting.Eval(req.Source, req.Event, scripting.DefaultLimits))
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// scriptError reports a scripts API error with a matching status.
+func scriptError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, scripting.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, scripting.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// auditScript records a change to the scripts.
+func (s *Server) auditScript(r *http.Request, action, target, diff string) {
+	err := s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: action,
+		Target: target,
+		Diff:   diff,
+	})
+	if err != nil {
+		fmt.Printf("Error recording script change: %v\n", err)
+	}
+}
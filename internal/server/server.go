@@ -1,107 +1,533 @@
 package server
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"html/template"
+	"net"
 	"net/http"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/announce"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/buildinfo"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/capacity"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/consolelog"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/contentlog"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/files"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/history"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/logtime"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notices"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/oplock"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/plugins"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/proxy"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/redact"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rollback"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rules"
 	"github.com/jsandas/gogo-mc-bedrock-server/internal/runner"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/schedule"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/scripting"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/selfupdate"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/trash"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/worlds"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for now, should be configured in production
-	},
+const clientSendBuffer = 256
+
+// client is a web client connected to the wrapper.
+type client struct {
+	conn       *websocket.Conn
+	send       chan []byte
+	structured bool            // Whether the client asked for structured frames
+	channels   map[string]bool // Extra channels the client subscribed to (structured clients only)
+	maxLine    int             // Console lines longer than this are trimmed, zero keeps them whole
+	active     *idleTracker
+}
+
+// wants reports whether the client receives lines from the given channel.
+func (c *client) wants(channel string) bool {
+	return channel == "" || c.channels[channel]
+}
+
+// encode returns the message sent to the client for an output line.
+func (c *client) encode(line outputLine) []byte {
+	text, truncated := line.text, false
+
+	// Only console lines are trimmed, job updates must stay valid JSON
+	if line.channel == "" {
+		text, truncated = protocol.Truncate(line.text, c.maxLine)
+	}
+
+	if !c.structured {
+		if truncated {
+			return []byte(protocol.TruncatedText(text, len(line.text)))
+		}
+
+		return []byte(text)
+	}
+
+	frame := line.frame()
+	frame.Text = text
+
+	if truncated {
+		frame.Length = len(line.text)
+	}
+
+	data, err := frame.Encode()
+	if err != nil {
+		return []byte(line.text)
+	}
+
+	return data
 }
 
 // Server handles the HTTP endpoints and web UI.
 type Server struct {
-	runner       *runner.Runner
-	connections  map[*websocket.Conn]bool
-	connLock     sync.RWMutex
-	outputBuffer []string
-	authKey      string // Pre-shared key for authentication
+	runner        *runner.Runner
+	appDir        string
+	templates     *worlds.Catalog
+	connections   map[*client]bool
+	connLock      sync.RWMutex
+	console       *outputStream // Console output, numbered for resume and retransmission
+	script        *outputStream // Script engine (GameTest/@minecraft/server) output
+	jobUpdates    *outputStream // Job updates, JSON encoded
+	stateUpdates  *outputStream // Changes of state of bedrock_server, JSON encoded
+	jobs          *jobs.Manager // Long-running operations such as snapshot imports and downloads
+	epoch         string        // Identifies this process so resume tokens don't cross restarts
+	authKey       string        // Pre-shared key for authentication
+	centralKey    string        // Key of the central server, empty if it uses the auth key
+	routines      *routineTracker
+	keepalive     KeepaliveConfig
+	upgrader      websocket.Upgrader
+	contentLog    contentlog.Log
+	ops           oplock.Lock // Keeps backups, restores, upgrades and restarts from overlapping
+	denyList      *proxy.DenyList
+	proxy         *proxy.Proxy
+	headers       SecurityHeadersConfig
+	http          HTTPConfig
+	files         *files.Root
+	audit         *audit.Log
+	history       *history.Store
+	announcements *announce.Store
+	schedules     *schedule.Store
+	capacity      *capacity.Monitor
+	notices       *notices.Store
+	presence      *presence  // Players online, for restarts deferred until the server is empty
+	functionMu    sync.Mutex // Serializes function runs
+	tapMu         sync.Mutex
+	tap           chan string // Receives console lines during a function run
+	rules         *rules.Engine
+	holdMu        sync.Mutex
+	hold          RestartHold
+	holdRelease   chan struct{} // Closed when a hold the wrapper waits on is released
+	scripts       *scripting.Engine
+	webhooks      chan struct{} // Limits the script webhooks in flight
+	plugins       *plugins.Manager
+	pluginConfigs []plugins.Config
+	mqtt          *mqttPublisher    // nil unless MQTT publishing is enabled
+	lastOutput    atomic.Int64      // Unix nanoseconds of the last console line
+	version       string            // Version of the wrapper
+	build         buildinfo.Info    // Reported by /api/about and in the hello
+	fileManager   bool              // Serves /api/files
+	backups       bool              // Serves /api/migration
+	labels        map[string]string // Reported in session frames
+
+	// Console lines longer than this are trimmed for clients, zero keeps them whole
+	maxLine int
+
+	location    *time.Location                 // Timezone of schedule and announcement times
+	logClock    *logtime.Clock                 // Reconciles Bedrock's timestamps with when lines are read
+	consoleLog  *consolelog.Log                // Every line of bedrock_server, nil if disabled
+	repeats     *consolelog.Collapser          // Holds back repeated lines, nil if disabled
+	redactor    *redact.Redactor               // Applied to console lines before they're buffered, nil if disabled
+	clientLimit *clientLimiter                 // Caps the clients of the console
+	relay       RelayConfig                    // Link to a relay, disabled if its URL is empty
+	pairing     *pairing                       // Open pairing code, nil if pairing is disabled
+	central     atomic.Pointer[protocol.Hello] // Hello of the central server, once it sent one
+	update      *selfupdate.Config             // nil unless self-update is enabled
+	pregen      atomic.Bool                    // Set while terrain is pregenerated
+	rollback    *rollback.Store                // Safety backups before risky changes, nil if disabled
+
+	// Removed worlds and packs and replaced config files, nil removes them for good
+	trash *trash.Store
+
+	stopTimeout time.Duration // How long a stop waits for bedrock_server to exit
+	stopping    stopRequests  // Stop requests still answering once bedrock_server exited
 }
 
 // ServerConfig holds configuration for the server.
 type ServerConfig struct {
-	Runner  *runner.Runner
-	AuthKey string
+	Runner    *runner.Runner
+	AppDir    string // Directory containing the minecraft server
+	AuthKey   string
+	Keepalive KeepaliveConfig
+	Templates *worlds.Catalog
+	DenyList  *proxy.DenyList // Blocked addresses and XUIDs, nil if the UDP proxy is disabled
+	Proxy     *proxy.Proxy
+	Headers   SecurityHeadersConfig
+	HTTP      HTTPConfig         // Timeouts and TLS of the web server
+	Plugins   []plugins.Config   // External plugin processes to start
+	Update    *selfupdate.Config // Where new wrapper builds come from, nil disables self-update
+	Build     buildinfo.Info     // Version, commit and build date of the wrapper
+	Labels    map[string]string  // Metadata such as owner or environment, reported to the central server
+	Location  *time.Location     // Timezone of schedule and announcement times, time.Local if nil
+
+	// ConsoleLog keeps every line of bedrock_server, nil disables it
+	ConsoleLog *consolelog.Log
+
+	// CollapseRepeats is how often repeats of a console line held back
+	// from clients are summarized, zero disables collapsing
+	CollapseRepeats time.Duration
+
+	// Redactor hides parts of console lines from clients, and so from the
+	// central server, nil disables it. The console log keeps them whole.
+	Redactor *redact.Redactor
+
+	// MaxLineLength is the length in bytes past which console lines are
+	// trimmed for clients: zero for protocol.DefaultMaxLineLength, negative
+	// to keep them whole
+	MaxLineLength int
+
+	ClientLimits ClientLimits // Clients of the console at once
+
+	// CentralKey authenticates the central server apart from other clients,
+	// so its connection isn't counted against the client limits. Empty
+	// counts it like any other.
+	CentralKey string
+
+	// Relay reaches the wrapper through a relay it connects to, for when
+	// the central server can't connect to it
+	Relay RelayConfig
+
+	Pairing PairingConfig // One-time codes the central server adds the wrapper with
+
+	// Rollback keeps a verified safety backup taken before each snapshot
+	// import and world import, nil disables them
+	Rollback *rollback.Store
+
+	// Trash keeps deleted worlds, removed packs and config files replaced
+	// by a rollback until they expire, nil deletes them right away
+	Trash *trash.Store
+
+	// StopTimeout is how long /api/server/stop waits for bedrock_server to
+	// save the world and exit, defaultStopTimeout if zero
+	StopTimeout time.Duration
+
+	// Optional subsystems that can be turned off. The hello only announces
+	// those enabled, so the central server hides what a wrapper lacks.
+	DisableFiles     bool // File manager through /api/files
+	DisableBackups   bool // Snapshot export and import through /api/migration
+	DisableSchedules bool // Settings schedules through /api/schedules
 }
 
 // New creates a new Server instance.
 func New(config ServerConfig) *Server {
+	keepalive := config.Keepalive.withDefaults()
+
 	srv := &Server{
 		runner:      config.Runner,
-		connections: make(map[*websocket.Conn]bool),
+		appDir:      config.AppDir,
+		templates:   config.Templates,
+		denyList:    config.DenyList,
+		proxy:       config.Proxy,
+		headers:     config.Headers,
+		http:        config.HTTP,
+		files:       files.New(config.AppDir, append(append([]string{}, internalFiles...), files.DefaultDeny...)),
+		audit:       audit.Open(filepath.Join(config.AppDir, auditLogName)),
+		connections: make(map[*client]bool),
+		console:     newOutputStream("", consoleBufferSize),
+		script:      newOutputStream(protocol.ChannelScript, scriptBufferSize),
+		jobUpdates:  newOutputStream(protocol.ChannelJobs, jobsBufferSize),
+		epoch:       newEpoch(),
 		authKey:     config.AuthKey,
+		centralKey:  config.CentralKey,
+		routines:    newRoutineTracker(),
+		keepalive:   keepalive,
+		holdRelease: make(chan struct{}),
+		update:      config.Update,
+		version:     config.Build.Version,
+		build:       config.Build,
+		fileManager: !config.DisableFiles,
+		backups:     !config.DisableBackups,
+		labels:      config.Labels,
+		maxLine:     config.MaxLineLength,
+		location:    config.Location,
+		logClock:    logtime.NewClock(nil), // bedrock_server inherits the wrapper's timezone
+		consoleLog:  config.ConsoleLog,
+		redactor:    config.Redactor,
+		clientLimit: newClientLimiter(config.ClientLimits),
+		relay:       config.Relay,
+		rollback:    config.Rollback,
+		trash:       config.Trash,
+		stopTimeout: config.StopTimeout,
+		upgrader: websocket.Upgrader{
+			HandshakeTimeout: keepalive.HandshakeTimeout,
+			ReadBufferSize:   1024,
+			WriteBufferSize:  1024,
+			CheckOrigin: func(r *http.Request) bool {
+				return true // Allow all origins for now, should be configured in production
+			},
+		},
+	}
+
+	switch {
+	case srv.maxLine == 0:
+		srv.maxLine = protocol.DefaultMaxLineLength
+	case srv.maxLine < 0:
+		srv.maxLine = 0
+	}
+
+	if srv.location == nil {
+		srv.location = time.Local
 	}
 
+	if srv.stopTimeout <= 0 {
+		srv.stopTimeout = defaultStopTimeout
+	}
+
+	if config.Pairing.Address != "" {
+		srv.pairing = &pairing{config: config.Pairing}
+	}
+
+	if config.CollapseRepeats > 0 {
+		srv.repeats = consolelog.NewCollapser(config.CollapseRepeats)
+	}
+
+	srv.jobs = jobs.NewManager(srv.publishJob)
+
+	srv.stateUpdates = newOutputStream(protocol.ChannelState, stateBufferSize)
+	srv.runner.OnTransition(srv.publishState)
+
+	// Silence is measured from startup until the first line
+	srv.lastOutput.Store(time.Now().UnixNano())
+
+	srv.openHistory()
+	srv.openAnnouncements()
+	srv.openCapacity()
+	srv.openNotices()
+	srv.openRules()
+	srv.openScripts()
+
+	if !config.DisableSchedules {
+		srv.openSchedules()
+	}
+
+	srv.pluginConfigs = config.Plugins
+	srv.startPlugins(config.Plugins)
+
 	// Start goroutine to handle runner output
 	go srv.handleRunnerOutput()
 
 	return srv
 }
 
-// Start begins the HTTP server.
-func (s *Server) Start(addr string) error {
+// newEpoch returns a random identifier for the current output session.
+func newEpoch() string {
+	b := make([]byte, 8)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// Start begins the HTTP server on all listen addresses.
+func (s *Server) Start(addrs []string) error {
 	// Create a new ServeMux for our routes
 	mux := http.NewServeMux()
 
-	// Index page doesn't require auth
+	// Index page and its assets don't require auth
 	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/static/", handleStatic)
 
 	// Protected routes with auth middleware
 	mux.HandleFunc("/ws", s.authMiddleware(s.handleWebSocket))
+	mux.HandleFunc("/api/debug", s.authMiddleware(s.handleDebug))
+	mux.HandleFunc("/api/addons/issues", s.authMiddleware(s.handleAddonIssues))
+	mux.HandleFunc("/api/console/line", s.authMiddleware(s.handleConsoleLine))
+	mux.HandleFunc("/api/scripts/log", s.authMiddleware(s.handleScriptLog))
+	mux.HandleFunc("/api/packs/reload", s.authMiddleware(s.handlePacksReload))
+	mux.HandleFunc("/api/structures", s.authMiddleware(s.handleStructures))
+	mux.HandleFunc("/api/structures/file", s.authMiddleware(s.handleStructureFile))
+	mux.HandleFunc("/api/structures/save", s.authMiddleware(s.handleStructureCommand))
+	mux.HandleFunc("/api/structures/load", s.authMiddleware(s.handleStructureCommand))
+	mux.HandleFunc("/api/audit", s.authMiddleware(s.handleAudit))
+	mux.HandleFunc("/api/config/history", s.authMiddleware(s.handleConfigHistory))
+	mux.HandleFunc("/api/config/revision", s.authMiddleware(s.handleConfigRevision))
+	mux.HandleFunc("/api/config/rollback", s.authMiddleware(s.handleConfigRollback))
+	mux.HandleFunc("/api/announcements", s.authMiddleware(s.handleAnnouncements))
+	mux.HandleFunc("/api/schedules", s.authMiddleware(s.handleSchedules))
+	mux.HandleFunc("/api/capacity", s.authMiddleware(s.handleCapacity))
+	mux.HandleFunc("/api/notices", s.authMiddleware(s.handleNotices))
+	mux.HandleFunc("/api/messages", s.authMiddleware(s.handleMessages))
+	mux.HandleFunc("/api/functions", s.authMiddleware(s.handleFunctions))
+	mux.HandleFunc("/api/rules", s.authMiddleware(s.handleRules))
+	mux.HandleFunc("/api/rules/hold", s.authMiddleware(s.handleRestartHold))
+	mux.HandleFunc("/api/scripts", s.authMiddleware(s.handleScripts))
+	mux.HandleFunc("/api/scripts/eval", s.authMiddleware(s.handleScriptEval))
+	mux.HandleFunc("/api/plugins", s.authMiddleware(s.handlePlugins))
+	mux.HandleFunc("/api/plugins/", s.authMiddleware(s.handlePluginRoute))
+	mux.HandleFunc("/api/version", s.authMiddleware(s.handleVersion))
+	mux.HandleFunc("/api/about", s.authMiddleware(s.handleAbout))
+	mux.HandleFunc("/api/update", s.authMiddleware(s.handleUpdate))
+	mux.HandleFunc("/api/update/restart", s.authMiddleware(s.handleRestart))
+	mux.HandleFunc("/api/jobs", s.authMiddleware(s.handleJobs))
+	mux.HandleFunc("/api/lock", s.authMiddleware(s.handleLock))
+	mux.HandleFunc("/api/functions/validate", s.authMiddleware(s.handleFunctionValidate))
+	mux.HandleFunc("/api/functions/run", s.authMiddleware(s.handleFunctionRun))
+	mux.HandleFunc("/api/messages/compose", s.authMiddleware(handleMessageCompose))
+	mux.HandleFunc("/api/motd", s.authMiddleware(s.handleMOTD))
+	mux.HandleFunc("/api/motd/preview", s.authMiddleware(handleMOTDPreview))
+	mux.HandleFunc("/api/pregen", s.authMiddleware(s.handlePregen))
+	mux.HandleFunc("/api/server/stop", s.authMiddleware(s.handleStop))
+	mux.HandleFunc("/api/server/restart", s.authMiddleware(s.handleServerRestart))
+	mux.HandleFunc("/api/server/status", s.authMiddleware(s.handleServerStatus))
+
+	if s.backups {
+		mux.HandleFunc("/api/migration/export", s.authMiddleware(s.handleMigrationExport))
+		mux.HandleFunc("/api/migration/import", s.authMiddleware(s.handleMigrationImport))
+		mux.HandleFunc("/api/migration/decommission", s.authMiddleware(s.handleMigrationDecommission))
+		mux.HandleFunc("/api/migration/transfer", s.authMiddleware(s.handleTransfer))
+		mux.HandleFunc("/api/migration/transfer/data", s.authMiddleware(s.handleTransferData))
+	}
+
+	if s.fileManager {
+		mux.HandleFunc("/api/files", s.authMiddleware(s.handleFiles))
+		mux.HandleFunc("/api/packs", s.authMiddleware(s.handlePacks))
+		mux.HandleFunc("/api/packs/export", s.authMiddleware(s.handlePacksExport))
+		mux.HandleFunc("/api/packs/import", s.authMiddleware(s.handlePacksImport))
+	}
+
+	if s.templates != nil {
+		mux.HandleFunc("/api/worlds", s.authMiddleware(s.handleWorlds))
+		mux.HandleFunc("/api/worlds/templates", s.authMiddleware(s.handleTemplates))
+		mux.HandleFunc("/api/worlds/templates/fetch", s.authMiddleware(s.handleTemplatesFetch))
+	}
+
+	if s.denyList != nil {
+		mux.HandleFunc("/api/denylist", s.authMiddleware(s.handleDenyList))
+	}
+
+	if s.rollback != nil {
+		mux.HandleFunc("/api/rollback", s.authMiddleware(s.handleRollback))
+	}
+
+	if s.trash != nil {
+		mux.HandleFunc("/api/trash", s.authMiddleware(s.handleTrash))
+		mux.HandleFunc("/api/trash/undo", s.authMiddleware(s.handleTrashUndo))
+	}
+
+	// Redeeming a pairing code takes its nonce instead of the auth key
+	if s.pairing != nil {
+		mux.HandleFunc("/api/pairing", s.authMiddleware(s.handlePairing))
+		mux.HandleFunc("/api/pair", s.handlePair)
+	}
+
+	for _, addr := range addrs {
+		fmt.Printf("Web server started at %s\n", s.http.listenURL(addr))
+	}
+
+	var relayed []net.Listener
+
+	if s.relay.URL != "" {
+		l := newRelayListener(s.relay.URL)
+		relayed = append(relayed, l)
 
-	fmt.Printf("Web server started at http://%s\n", addr)
+		go s.runRelay(l)
 
-	server := &http.Server{
-		Addr:              addr,
-		Handler:           mux,
-		ReadHeaderTimeout: 3 * time.Second,
+		fmt.Printf("Web server reachable through the relay at %s\n", s.relay.URL)
 	}
 
-	return server.ListenAndServe()
+	return s.http.serve(s.http.newServer(securityHeaders(s.headers, mux)), addrs, relayed...)
 }
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	structured := r.URL.Query().Get("format") == protocol.FormatJSON
+
+	// A resume token lets a reconnecting client receive only the lines it missed
+	var resume *protocol.ResumeToken
+
+	if token := r.URL.Query().Get("resume"); token != "" {
+		t, err := protocol.ParseResumeToken(token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resume = &t
+	}
+
+	// The central server's connection carries consoles it limits itself
+	if !isCentral(r) {
+		release, ok := s.clientLimit.admit(w, r)
+		if !ok {
+			return
+		}
+		defer release()
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		fmt.Printf("Error upgrading to WebSocket: %v\n", err)
 		return
 	}
 	defer conn.Close()
 
-	// Register connection
+	defer s.routines.track(routineClient)()
+
+	err = conn.SetReadDeadline(time.Now().Add(s.keepalive.PongWait))
+	if err != nil {
+		fmt.Printf("Error setting read deadline: %v\n", err)
+		return
+	}
+
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(s.keepalive.PongWait))
+	})
+
+	c := &client{
+		conn:       conn,
+		send:       make(chan []byte, clientSendBuffer),
+		structured: structured,
+		channels:   make(map[string]bool),
+		maxLine:    s.maxLine,
+		active:     newIdleTracker(r),
+	}
+
+	if structured {
+		for _, channel := range strings.Split(r.URL.Query().Get("channels"), ",") {
+			c.channels[strings.TrimSpace(channel)] = true
+		}
+	}
+
+	// Register the client and take the backlog under the same lock so that no
+	// line is lost or sent twice between the replay and the live stream
 	s.connLock.Lock()
-	s.connections[conn] = true
+	backlog := s.backlog(c, resume)
+	s.connections[c] = true
 	s.connLock.Unlock()
 
 	// Clean up on disconnect
 	defer func() {
 		s.connLock.Lock()
-		delete(s.connections, conn)
+		delete(s.connections, c)
+		close(c.send)
 		s.connLock.Unlock()
 	}()
 
-	// Send initial buffer
-	s.connLock.RLock()
-
-	for _, line := range s.outputBuffer {
-		err := conn.WriteMessage(websocket.TextMessage, []byte(line))
-		if err != nil {
-			s.connLock.RUnlock()
-			return
-		}
-	}
-
-	s.connLock.RUnlock()
+	go s.writePump(c, backlog)
 
 	// Handle incoming messages (stdin)
 	for {
@@ -110,211 +536,394 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
-		// Check if this is the authentication message
+		err = conn.SetReadDeadline(time.Now().Add(s.keepalive.PongWait))
+		if err != nil {
+			break
+		}
+
+		// Structured clients may send control frames; anything else starting
+		// with '{' is the auth message, which is already handled by the middleware
 		if len(message) > 0 && message[0] == '{' {
-			continue // Skip the auth message as it's already handled by the middleware
+			frame, err := protocol.Decode(message)
+			if err != nil {
+				continue
+			}
+
+			switch frame.Type {
+			case protocol.FrameResend:
+				s.resend(c, frame.From, frame.To)
+			case protocol.FrameHello:
+				s.centralHello(frame.Hello)
+			case protocol.FrameActivity:
+				c.active.touch()
+			}
+
+			continue
 		}
 
+		c.active.touch()
 		s.runner.WriteInput(string(message))
 	}
 }
 
+// backlog returns the buffered messages a newly connected client should
+// receive. Must be called with connLock held.
+func (s *Server) backlog(c *client, resume *protocol.ResumeToken) [][]byte {
+	messages := make([][]byte, 0, len(s.console.lines)+2)
+
+	if !c.structured {
+		for _, line := range s.console.lines {
+			messages = append(messages, c.encode(line))
+		}
+
+		return messages
+	}
+
+	session, err := protocol.Frame{
+		Type:          protocol.FrameSession,
+		Epoch:         s.epoch,
+		Seq:           s.console.seq,
+		MaxLines:      s.console.size,
+		MaxLineLength: s.maxLine,
+		Labels:        s.labels,
+		Hello:         s.hello(),
+	}.Encode()
+	if err == nil {
+		messages = append(messages, session)
+	}
+
+	// Extra channels are always replayed in full
+	if c.wants(protocol.ChannelScript) {
+		for _, line := range s.script.lines {
+			messages = append(messages, c.encode(line))
+		}
+	}
+
+	if c.wants(protocol.ChannelJobs) {
+		for _, line := range s.jobUpdates.lines {
+			messages = append(messages, c.encode(line))
+		}
+	}
+
+	if c.wants(protocol.ChannelState) {
+		for _, line := range s.stateUpdates.lines {
+			messages = append(messages, c.encode(line))
+		}
+	}
+
+	// Replay everything unless the client is resuming within this session
+	var after uint64
+	if resume != nil && resume.Epoch == s.epoch && resume.Seq <= s.console.seq {
+		after = resume.Seq
+	}
+
+	if oldest := s.console.oldest(); after > 0 && oldest > after+1 {
+		gap, err := protocol.Frame{Type: protocol.FrameGap, From: after + 1, To: oldest - 1}.Encode()
+		if err == nil {
+			messages = append(messages, gap)
+		}
+	}
+
+	for _, line := range s.console.between(after+1, s.console.seq) {
+		messages = append(messages, c.encode(line))
+	}
+
+	return messages
+}
+
+// resend queues the buffered console line frames in the range from..to for a
+// client, preceded by a gap frame for lines that are no longer buffered.
+func (s *Server) resend(c *client, from, to uint64) {
+	if !c.structured || from == 0 || to < from {
+		return
+	}
+
+	s.connLock.RLock()
+	defer s.connLock.RUnlock()
+
+	to = min(to, s.console.seq)
+	if to < from {
+		return
+	}
+
+	var messages [][]byte
+
+	if oldest := s.console.oldest(); oldest == 0 || oldest > from {
+		last := to
+		if oldest != 0 && oldest <= to {
+			last = oldest - 1
+		}
+
+		gap, err := protocol.Frame{Type: protocol.FrameGap, From: from, To: last}.Encode()
+		if err == nil {
+			messages = append(messages, gap)
+		}
+	}
+
+	for _, line := range s.console.between(from, to) {
+		messages = append(messages, c.encode(line))
+	}
+
+	for _, message := range messages {
+		s.queue(c, message)
+	}
+}
+
 func (s *Server) handleRunnerOutput() {
-	for line := range s.runner.GetOutputChan() {
-		// Store in buffer
-		s.connLock.Lock()
-		s.outputBuffer = append(s.outputBuffer, line)
-		// Keep buffer size reasonable
-		if len(s.outputBuffer) > 1000 {
-			s.outputBuffer = s.outputBuffer[len(s.outputBuffer)-1000:]
+	defer s.routines.track(routineOutput)()
+
+	for out := range s.runner.GetOutputChan() {
+		text := out.String()
+
+		s.lastOutput.Store(time.Now().UnixNano())
+		s.logConsoleLine(text, out.Time)
+		s.contentLog.AddLine(text)
+		s.enforceDenyList(text)
+		s.enforceCapacity(text)
+		s.trackPresence(text)
+		s.tapLine(text)
+		s.handleRuleLine(text)
+		s.publishPluginEvents(text)
+		s.mqttConsoleEvents(text)
+
+		// Scripts may hide or rewrite lines shown on the console
+		if text, ok := s.scriptLine(text); ok {
+			logged, _ := s.logClock.Reconcile(out.Text, out.Time)
+			s.publishCollapsed(text, out.Stream, out.Time, logged)
 		}
+	}
+}
 
-		s.connLock.Unlock()
+// publish buffers a console line of the wrapper and broadcasts it to all
+// clients.
+func (s *Server) publish(text string) {
+	s.publishLine(text, "", time.Now().UTC(), time.Time{})
+}
 
-		// Broadcast to all connections
-		s.connLock.RLock()
+// publishLine buffers a console line read from a stream at t, and logged at
+// logged if it had a timestamp, and broadcasts it to all clients, redacted.
+func (s *Server) publishLine(text, stream string, t, logged time.Time) {
+	text = s.redactor.Redact(text)
 
-		for conn := range s.connections {
-			err := conn.WriteMessage(websocket.TextMessage, []byte(line))
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+
+	// Store in buffer
+	lines := []outputLine{s.console.append(text, stream, t, logged)}
+
+	// Script engine output is also streamed on its own channel
+	if contentlog.IsScriptLine(text) {
+		lines = append(lines, s.script.append(text, stream, t, logged))
+	}
+
+	// Broadcast to all connections
+	for c := range s.connections {
+		for _, line := range lines {
+			if c.wants(line.channel) {
+				s.queue(c, c.encode(line))
+			}
+		}
+	}
+}
+
+// queue queues a message for a client without blocking. Clients that can't
+// keep up are disconnected so they reconnect and resume.
+func (s *Server) queue(c *client, message []byte) {
+	select {
+	case c.send <- message:
+	default:
+		err := c.conn.Close()
+		if err != nil {
+			fmt.Printf("Error closing connection: %v\n", err)
+		}
+	}
+}
+
+// writePump writes the backlog and then queued messages to a client, pinging
+// it periodically so that dead connections are detected and idle proxies
+// keep the connection open, and disconnecting idle browser clients.
+func (s *Server) writePump(c *client, backlog [][]byte) {
+	defer s.routines.track(routineWritePump)()
+
+	ticker := time.NewTicker(s.keepalive.PingInterval)
+
+	defer func() {
+		ticker.Stop()
+
+		_ = c.conn.Close()
+	}()
+
+	for _, message := range backlog {
+		err := s.writeMessage(c.conn, message)
+		if err != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				return
+			}
+
+			err := s.writeMessage(c.conn, message)
 			if err != nil {
-				err := conn.Close()
-				if err != nil {
-					fmt.Printf("Error closing connection: %v\n", err)
-				}
+				return
+			}
+		case now := <-ticker.C:
+			if c.active.idle(s.keepalive.IdleTimeout, now) {
+				closeIdle(c.conn, s.keepalive.IdleTimeout, s.keepalive.WriteWait)
+				return
+			}
 
-				delete(s.connections, conn)
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.keepalive.WriteWait))
+			if err != nil {
+				return
 			}
 		}
+	}
+}
+
+// writeMessage writes a text message to a client with a write deadline.
+func (s *Server) writeMessage(conn *websocket.Conn, data []byte) error {
+	err := conn.SetWriteDeadline(time.Now().Add(s.keepalive.WriteWait))
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// handleAddonIssues lists the behavior/resource pack problems parsed from the
+// content log, or clears them on DELETE.
+func (s *Server) handleAddonIssues(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		issues := struct {
+			Counts map[string]int     `json:"counts"`
+			Issues []contentlog.Issue `json:"issues"`
+		}{
+			Counts: s.contentLog.Counts(),
+			Issues: s.contentLog.Issues(),
+		}
+
+		err := json.NewEncoder(w).Encode(issues)
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	case http.MethodDelete:
+		s.contentLog.Clear()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleConsoleLine returns the whole console line with ?seq= as a line
+// frame, for lines trimmed in the stream. With ?epoch= the line must be from
+// that session of the wrapper.
+func (s *Server) handleConsoleLine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	seq, err := strconv.ParseUint(r.URL.Query().Get("seq"), 10, 64)
+	if err != nil || seq == 0 {
+		http.Error(w, "Invalid or missing seq", http.StatusBadRequest)
+		return
+	}
+
+	s.connLock.RLock()
+	lines := s.console.between(seq, seq)
+	epoch := s.epoch
+	s.connLock.RUnlock()
+
+	if len(lines) == 0 || (r.URL.Query().Get("epoch") != "" && r.URL.Query().Get("epoch") != epoch) {
+		http.Error(w, "Line no longer buffered", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 
-		s.connLock.RUnlock()
+	frame := lines[0].frame()
+	frame.Epoch = epoch
+
+	err = json.NewEncoder(w).Encode(frame)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
 	}
 }
 
-func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.New("index").Parse(htmlTemplate))
+// handleScriptLog returns the buffered script engine output.
+func (s *Server) handleScriptLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.connLock.RLock()
+
+	frames := make([]protocol.Frame, 0, len(s.script.lines))
+	for _, line := range s.script.lines {
+		frames = append(frames, protocol.Frame{
+			Type:    protocol.FrameLine,
+			Channel: line.channel,
+			Seq:     line.seq,
+			Text:    line.text,
+		})
+	}
 
-	err := tmpl.Execute(w, nil)
+	s.connLock.RUnlock()
+
+	err := json.NewEncoder(w).Encode(frames)
 	if err != nil {
-		fmt.Printf("Error rendering template: %v\n", err)
+		fmt.Printf("Error sending JSON response: %v\n", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
-//nolint:lll
-const htmlTemplate = `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Minecraft Server Output</title>
-    <style>
-        body {
-            font-family: monospace;
-            background: #1e1e1e;
-            color: #d4d4d4;
-            padding: 20px;
-        }
-        #output {
-            white-space: pre-wrap;
-            padding: 10px;
-            background: #2d2d2d;
-            border-radius: 5px;
-            margin-bottom: 20px;
-            height: 400px;
-            overflow-y: auto;
-        }
-        .stdout { color: #6A9955; }
-        .stderr { color: #F44747; }
-        .disconnected { color: #F44747; font-style: italic; }
-        #input-container {
-            display: flex;
-            gap: 10px;
-        }
-        #command-input {
-            flex-grow: 1;
-            padding: 8px;
-            background: #2d2d2d;
-            border: 1px solid #3d3d3d;
-            border-radius: 4px;
-            color: #d4d4d4;
-            font-family: monospace;
-        }
-        button {
-            padding: 8px 16px;
-            background: #0e639c;
-            border: none;
-            border-radius: 4px;
-            color: white;
-            cursor: pointer;
-        }
-        button:hover {
-            background: #1177bb;
-        }
-        .status {
-            position: fixed;
-            top: 10px;
-            right: 10px;
-            padding: 5px 10px;
-            border-radius: 4px;
-            font-size: 12px;
-        }
-        .status.connected { background: #6A9955; }
-        .status.disconnected { background: #F44747; }
-    </style>
-    <script>
-        let ws;
-        let reconnectAttempts = 0;
-        const maxReconnectAttempts = 5;
-
-        function connect() {
-            const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-            let authKey = localStorage.getItem('authKey');
-            if (!authKey) {
-                authKey = prompt('Please enter your authentication key:');
-                if (authKey) {
-                    localStorage.setItem('authKey', authKey);
-                } else {
-                    console.error('Authentication key is required');
-                    return;
-                }
-            }
-            
-            // Add auth key as a query parameter
-            const wsUrl = new URL(protocol + '//' + window.location.host + '/ws');
-            wsUrl.searchParams.append('auth', authKey);
-            ws = new WebSocket(wsUrl.toString());
-
-            ws.onopen = function() {
-                console.log('Connected to server');
-                const status = document.getElementById('status');
-                status.textContent = 'Connected';
-                status.className = 'status connected';
-                reconnectAttempts = 0;
-            };
-
-            ws.onclose = function(event) {
-                console.log('Disconnected from server:', event.code);
-                const status = document.getElementById('status');
-                status.textContent = 'Disconnected';
-                status.className = 'status disconnected';
-
-                // Check if it was an auth error (code 1008 is policy violation)
-                if (event.code === 1008) {
-                    localStorage.removeItem('authKey'); // Clear invalid key
-                    const output = document.getElementById('output');
-                    output.innerHTML += '<div class="disconnected">Authentication failed. Please refresh the page to try again.</div>';
-                } else if (reconnectAttempts < maxReconnectAttempts) {
-                    reconnectAttempts++;
-                    setTimeout(connect, 1000 * reconnectAttempts);
-                } else {
-                    const output = document.getElementById('output');
-                    output.innerHTML += '<div class="disconnected">Connection lost. Please refresh the page to reconnect.</div>';
-                }
-            };
-
-            ws.onmessage = function(event) {
-                const line = event.data;
-                const output = document.getElementById('output');
-                const div = document.createElement('div');
-                div.className = line.startsWith('[ERR]') ? 'stderr' : 'stdout';
-                div.textContent = line;
-                output.appendChild(div);
-                output.scrollTop = output.scrollHeight;
-            };
-
-            ws.onerror = function(error) {
-                console.error('WebSocket error:', error);
-            };
-        }
-
-        function sendCommand() {
-            const input = document.getElementById('command-input');
-            const command = input.value;
-            if (command.trim() === '' || !ws || ws.readyState !== WebSocket.OPEN) return;
-
-            ws.send(command);
-            input.value = '';
-        }
-
-        document.addEventListener('DOMContentLoaded', function() {
-            const input = document.getElementById('command-input');
-            input.addEventListener('keypress', function(e) {
-                if (e.key === 'Enter') {
-                    e.preventDefault();
-                    sendCommand();
-                }
-            });
-            connect();
-        });
-    </script>
-</head>
-<body>
-    <div id="status" class="status disconnected">Disconnected</div>
-    <h1>Minecraft Server Output</h1>
-    <div id="output"></div>
-    <div id="input-container">
-        <input type="text" id="command-input" placeholder="Type a command and press Enter">
-        <button onclick="sendCommand()">Send</button>
-    </div>
-</body>
-</html>
-`
+// handleDebug reports goroutine counts for the web server and any violated
+// cleanup invariants.
+func (s *Server) handleDebug(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.connLock.RLock()
+	clients := len(s.connections)
+	s.connLock.RUnlock()
+
+	report := RoutineReport{
+		Routines: s.routines.snapshot(),
+		Clients:  clients,
+	}
+
+	if clients > report.Routines[routineClient] {
+		report.Violations = append(report.Violations,
+			fmt.Sprintf("%d client(s) registered but only %d client handler(s) running",
+				clients, report.Routines[routineClient]))
+	}
+
+	for _, v := range report.Violations {
+		fmt.Printf("Warning: %s\n", v)
+	}
+
+	debug := struct {
+		RoutineReport
+
+		Goroutines int `json:"goroutines"`
+	}{
+		Goroutines:    runtime.NumGoroutine(),
+		RoutineReport: report,
+	}
+
+	err := json.NewEncoder(w).Encode(debug)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
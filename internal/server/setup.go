@@ -0,0 +1,311 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/i18n"
+)
+
+// MinSetupKeyLength is the shortest key the setup wizard accepts for the
+// admin user.
+const MinSetupKeyLength = 12
+
+// setupShutdownTimeout bounds how long the setup wizard waits for its last
+// requests when it's done.
+const setupShutdownTimeout = 5 * time.Second
+
+// TLS modes of the setup wizard.
+const (
+	TLSModeNone  = "none"  // Plain HTTP, e.g. on a LAN
+	TLSModeFiles = "files" // HTTPS with a certificate and key on disk
+	TLSModeProxy = "proxy" // A proxy in front terminates TLS, so HSTS is sent
+)
+
+// SetupResult is what the first-run setup wizard collected.
+type SetupResult struct {
+	AdminName string
+	AdminKey  string
+	TLSMode   string
+	TLSCert   string // With TLSModeFiles
+	TLSKey    string
+	Wrapper   *NewWrapper // First wrapper, nil if skipped
+}
+
+// SetupConfig configures the first-run setup wizard.
+type SetupConfig struct {
+	HTTP HTTPConfig
+
+	// Token is printed to the console for the operator to open the wizard
+	// with, so nobody else who reaches the port first can finish it.
+	Token string
+
+	// Save writes the config file; the wizard is done once it succeeds.
+	Save func(SetupResult) error
+}
+
+// SetupServer serves the first-run setup wizard while no config file
+// exists.
+type SetupServer struct {
+	config SetupConfig
+	server *http.Server
+
+	mu      sync.Mutex
+	wrapper *NewWrapper // Tested by the wizard, saved when it finishes
+
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// NewSetupServer creates the setup wizard.
+func NewSetupServer(config SetupConfig) *SetupServer {
+	return &SetupServer{config: config, done: make(chan struct{})}
+}
+
+// Start serves the wizard on all listen addresses until Stop.
+func (s *SetupServer) Start(addrs []string) error {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", s.handlePage)
+	mux.HandleFunc("/api/i18n", handleSetupI18n)
+	mux.HandleFunc("/api/setup/wrapper", s.requireToken(s.handleWrapper))
+	mux.HandleFunc("/api/setup/finish", s.requireToken(s.handleFinish))
+
+	s.server = s.config.HTTP.newServer(securityHeaders(SecurityHeadersConfig{}, mux))
+
+	return s.config.HTTP.serve(s.server, addrs)
+}
+
+// Done is closed once the config file is saved.
+func (s *SetupServer) Done() <-chan struct{} {
+	return s.done
+}
+
+// Stop shuts the wizard down, letting it answer the last requests.
+func (s *SetupServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), setupShutdownTimeout)
+	defer cancel()
+
+	return s.server.Shutdown(ctx)
+}
+
+// handlePage serves the wizard, which takes the token from its URL.
+func (s *SetupServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeFile(w, r, "web/setup.html")
+}
+
+// handleSetupI18n returns the messages of the wizard in the language of
+// the browser.
+func handleSetupI18n(w http.ResponseWriter, r *http.Request) {
+	writeLocalization(w, i18n.Negotiate(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language")))
+}
+
+// requireToken rejects requests without the setup token.
+func (s *SetupServer) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Setup-Token")
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) != 1 {
+			http.Error(w, "Invalid setup token, open the link printed by the central server", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// handleWrapper tests the connection to the first wrapper, with its shared
+// key or a pairing code, and keeps it for when the wizard finishes.
+func (s *SetupServer) handleWrapper(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Name      string `json:"name"`
+		Address   string `json:"address"`
+		SharedKey string `json:"shared_key"`
+		Code      string `json:"code"` // Pairing code, instead of address and key
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	wrapper := NewWrapper{
+		Name:      strings.TrimSpace(req.Name),
+		Address:   strings.TrimSpace(req.Address),
+		SharedKey: req.SharedKey,
+	}
+
+	if req.Code != "" {
+		address, nonce, err := ParsePairingCode(req.Code)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		paired, err := pairWrapper(r.Context(), address, nonce)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		wrapper.Address, wrapper.SharedKey = address, paired.SharedKey
+
+		if wrapper.Name == "" {
+			wrapper.Name = paired.Name
+		}
+	}
+
+	u, err := url.Parse(wrapper.Address)
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		http.Error(w, "The address must be a ws:// or wss:// URL, e.g. ws://192.168.1.20:8080/ws", http.StatusBadRequest)
+		return
+	}
+
+	if wrapper.SharedKey == "" {
+		http.Error(w, "The wrapper's shared key is required", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := verifyWrapper(r.Context(), wrapper.Address, wrapper.SharedKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if wrapper.Name == "" {
+		wrapper.Name = u.Hostname()
+	}
+
+	wrapper.ID = wrapperID(wrapper.Name, nil)
+
+	s.mu.Lock()
+	s.wrapper = &wrapper
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(map[string]any{
+		"id":       wrapper.ID,
+		"name":     wrapper.Name,
+		"address":  wrapper.Address,
+		"versions": versions,
+	})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleFinish checks the admin user and TLS mode, then saves the config.
+func (s *SetupServer) handleFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		AdminName   string `json:"admin_name"`
+		AdminKey    string `json:"admin_key"`
+		TLSMode     string `json:"tls_mode"`
+		TLSCert     string `json:"tls_cert"`
+		TLSKey      string `json:"tls_key"`
+		SkipWrapper bool   `json:"skip_wrapper"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result := SetupResult{
+		AdminName: strings.TrimSpace(req.AdminName),
+		AdminKey:  req.AdminKey,
+		TLSMode:   req.TLSMode,
+	}
+
+	err = result.validate(req.TLSCert, req.TLSKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !req.SkipWrapper {
+		s.mu.Lock()
+		result.Wrapper = s.wrapper
+		s.mu.Unlock()
+
+		if result.Wrapper == nil {
+			http.Error(w, "Test the connection to the wrapper first, or skip it", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = s.config.Save(result)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error saving the configuration: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("Setup finished by %s, admin user %s created\n", r.RemoteAddr, result.AdminName)
+
+	scheme := "http"
+	if result.TLSMode == TLSModeFiles {
+		scheme = "https"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(map[string]string{"url": scheme + "://" + r.Host + "/"})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+
+	s.doneOnce.Do(func() { close(s.done) })
+}
+
+// validate checks the admin user and TLS mode, loading the certificate of
+// TLSModeFiles so a typo doesn't keep the central server from starting.
+func (r *SetupResult) validate(cert, key string) error {
+	if r.AdminName == "" {
+		return errors.New("the admin user needs a name")
+	}
+
+	if len(r.AdminKey) < MinSetupKeyLength {
+		return fmt.Errorf("the admin key must be at least %d characters", MinSetupKeyLength)
+	}
+
+	switch r.TLSMode {
+	case TLSModeNone, TLSModeProxy:
+	case TLSModeFiles:
+		_, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return fmt.Errorf("error loading the certificate: %w", err)
+		}
+
+		r.TLSCert, r.TLSKey = cert, key
+	default:
+		return fmt.Errorf("the TLS mode must be %q, %q or %q", TLSModeNone, TLSModeFiles, TLSModeProxy)
+	}
+
+	return nil
+}
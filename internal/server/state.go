@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/runner"
+)
+
+// publishState buffers a change of state of bedrock_server and broadcasts
+// it to the clients subscribed to the state channel. It is called in order
+// of the changes, under the runner's state lock.
+func (s *Server) publishState(t runner.Transition) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		fmt.Printf("Error encoding state change: %v\n", err)
+		return
+	}
+
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+
+	line := s.stateUpdates.append(string(data), "", t.Time, time.Time{})
+
+	for c := range s.connections {
+		if c.structured && c.wants(line.channel) {
+			s.queue(c, c.encode(line))
+		}
+	}
+}
+
+// ServerStatus is the state of bedrock_server, since when, and its restart
+// policy and count.
+type ServerStatus struct {
+	State runner.State `json:"state"`
+	Since time.Time    `json:"since"`
+	Pid   int          `json:"pid,omitempty"`   // While running
+	Error string       `json:"error,omitempty"` // How it crashed
+	RestartStatus
+}
+
+// handleServerStatus returns the state of bedrock_server: starting,
+// running, stopping, stopped or crashed.
+func (s *Server) handleServerStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	t := s.runner.LastTransition()
+
+	status := ServerStatus{State: t.To, Since: t.Time, Error: t.Error, RestartStatus: s.restartStatus()}
+
+	if t.To == runner.StateRunning || t.To == runner.StateStopping {
+		status.Pid = s.runner.Pid()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(status)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
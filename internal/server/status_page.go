@@ -0,0 +1,315 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultStatusRefresh = 30 * time.Second
+
+// StatusPageConfig configures the public status page. It only shows what
+// players can already see in the server list, never consoles or wrapper
+// details.
+type StatusPageConfig struct {
+	Title    string
+	Wrappers []string      // IDs of the wrappers shown, all if empty
+	Refresh  time.Duration // How long results are cached, so visitors can't flood the servers with pings
+}
+
+// PublicStatus is the public state of a single server.
+type PublicStatus struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Online     bool   `json:"online"`
+	Players    int    `json:"players"`
+	MaxPlayers int    `json:"max_players"`
+	MOTD       string `json:"motd,omitempty"`
+	Version    string `json:"version,omitempty"`
+}
+
+// StatusPage is the public status of all listed servers.
+type StatusPage struct {
+	Title     string         `json:"title"`
+	Servers   []PublicStatus `json:"servers"`
+	Players   int            `json:"players"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// statusCache holds the last status page so servers are pinged at most once
+// per refresh interval.
+type statusCache struct {
+	config StatusPageConfig
+	page   StatusPage
+	mu     sync.Mutex
+}
+
+// status returns the cached status page, refreshing it when it is stale.
+func (s *CentralServer) status() StatusPage {
+	c := s.statusPage
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	refresh := c.config.Refresh
+	if refresh <= 0 {
+		refresh = defaultStatusRefresh
+	}
+
+	if time.Since(c.page.UpdatedAt) < refresh {
+		return c.page
+	}
+
+	conns := s.manager.ListConnections()
+
+	if len(c.config.Wrappers) > 0 {
+		conns = make([]*WrapperConnection, 0, len(c.config.Wrappers))
+
+		for _, id := range c.config.Wrappers {
+			wConn, ok := s.manager.GetConnection(id)
+			if ok {
+				conns = append(conns, wConn)
+			}
+		}
+	}
+
+	page := StatusPage{
+		Title:     c.config.Title,
+		Servers:   make([]PublicStatus, len(conns)),
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	if page.Title == "" {
+		page.Title = "Server Status"
+	}
+
+	pings := pingServers(conns)
+
+	for i, wConn := range conns {
+		page.Servers[i] = PublicStatus{ID: wConn.ID, Name: wConn.Name}
+
+		if !pings[i].online {
+			continue
+		}
+
+		pong := pings[i].pong
+		page.Servers[i].Online = true
+		page.Servers[i].Players = pong.PlayerCount
+		page.Servers[i].MaxPlayers = pong.MaxPlayerCount
+		page.Servers[i].MOTD = pong.ServerName
+		page.Servers[i].Version = pong.VersionName
+	}
+
+	for _, status := range page.Servers {
+		page.Players += status.Players
+	}
+
+	c.page = page
+
+	return page
+}
+
+// handleStatusPage renders the public status page.
+func (s *CentralServer) handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmpl := template.Must(template.New("status").Parse(statusTemplate))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err := tmpl.Execute(w, s.status())
+	if err != nil {
+		fmt.Printf("Error rendering status page: %v\n", err)
+	}
+}
+
+// handleStatusJSON returns the public status as JSON, optionally for a single
+// server with ?wrapper=.
+func (s *CentralServer) handleStatusJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result interface{} = s.status()
+
+	if id := r.URL.Query().Get("wrapper"); id != "" {
+		status, ok := s.serverStatus(id)
+		if !ok {
+			http.Error(w, "Server not found", http.StatusNotFound)
+			return
+		}
+
+		result = status
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// serverStatus returns the public status of a listed server.
+func (s *CentralServer) serverStatus(id string) (PublicStatus, bool) {
+	for _, status := range s.status().Servers {
+		if status.ID == id {
+			return status, true
+		}
+	}
+
+	return PublicStatus{}, false
+}
+
+// Badge is a shields.io endpoint badge.
+type Badge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// badge returns the badge for a server, or for all servers if id is empty.
+func (s *CentralServer) badge(id string) (Badge, bool) {
+	badge := Badge{SchemaVersion: 1, Label: "players", Color: "brightgreen"}
+
+	if id == "" {
+		badge.Message = fmt.Sprintf("%d online", s.status().Players)
+		return badge, true
+	}
+
+	status, ok := s.serverStatus(id)
+	if !ok {
+		return badge, false
+	}
+
+	badge.Label = status.Name
+	if badge.Label == "" {
+		badge.Label = status.ID
+	}
+
+	if !status.Online {
+		badge.Message = "offline"
+		badge.Color = "red"
+
+		return badge, true
+	}
+
+	badge.Message = fmt.Sprintf("%d/%d online", status.Players, status.MaxPlayers)
+
+	return badge, true
+}
+
+// handleStatusBadge returns a badge for a server (?wrapper=) or the whole
+// fleet, as SVG or, for /status/badge.json, as a shields.io endpoint.
+func (s *CentralServer) handleStatusBadge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	badge, ok := s.badge(r.URL.Query().Get("wrapper"))
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if r.URL.Path == "/status/badge.json" {
+		w.Header().Set("Content-Type", "application/json")
+
+		err := json.NewEncoder(w).Encode(badge)
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+
+	_, err := w.Write([]byte(badgeSVG(badge)))
+	if err != nil {
+		fmt.Printf("Error sending badge: %v\n", err)
+	}
+}
+
+// badgeColors maps badge colors to the hex values shields.io uses.
+var badgeColors = map[string]string{
+	"brightgreen": "#4c1",
+	"red":         "#e05d44",
+}
+
+// badgeSVG renders a flat shields.io style badge. Text widths are estimated,
+// which is close enough for the short labels used here.
+func badgeSVG(b Badge) string {
+	const charWidth, padding = 7, 10
+
+	labelWidth := len([]rune(b.Label))*charWidth + padding
+	messageWidth := len([]rune(b.Message))*charWidth + padding
+	width := labelWidth + messageWidth
+
+	label := html.EscapeString(b.Label)
+	message := html.EscapeString(b.Message)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`+
+		`<rect width="%d" height="20" fill="#555"/>`+
+		`<rect x="%d" width="%d" height="20" fill="%s"/>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%d" y="14">%s</text><text x="%d" y="14">%s</text></g></svg>`,
+		width, label, message,
+		labelWidth,
+		labelWidth, messageWidth, badgeColors[b.Color],
+		labelWidth/2, label, labelWidth+messageWidth/2, message)
+}
+
+//nolint:lll
+const statusTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta http-equiv="refresh" content="60">
+    <title>{{.Title}}</title>
+    <style>
+        body { font-family: Arial, sans-serif; max-width: 800px; margin: 0 auto; padding: 20px; }
+        .server { border: 1px solid #ccc; border-radius: 5px; padding: 10px 15px; margin-bottom: 10px; }
+        .server h2 { margin: 0 0 5px 0; font-size: 1.2em; }
+        .state { display: inline-block; width: 10px; height: 10px; border-radius: 50%; margin-right: 8px; }
+        .online { background-color: #90EE90; }
+        .offline { background-color: #FFB6C6; }
+        .details { color: #555; }
+        .updated { color: #888; font-size: 0.8em; }
+    </style>
+</head>
+<body>
+    <h1>{{.Title}}</h1>
+    {{range .Servers}}
+    <div class="server">
+        <h2><span class="state {{if .Online}}online{{else}}offline{{end}}"></span>{{.Name}}</h2>
+        {{if .Online}}
+        <div class="details">{{.MOTD}}</div>
+        <div class="details">{{.Players}}/{{.MaxPlayers}} players &middot; version {{.Version}}</div>
+        {{else}}
+        <div class="details">Offline</div>
+        {{end}}
+    </div>
+    {{else}}
+    <p>No servers.</p>
+    {{end}}
+    <p class="updated">Updated {{.UpdatedAt.Format "2006-01-02 15:04:05 MST"}}</p>
+</body>
+</html>
+`
@@ -0,0 +1,289 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/notices"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/oplock"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/runner"
+)
+
+const (
+	// defaultStopTimeout is how long a stop waits for bedrock_server to
+	// exit unless configured otherwise.
+	defaultStopTimeout = time.Minute
+
+	// stopResponseWait is how long the wrapper waits, once bedrock_server
+	// exited, for stop requests to be answered before it exits too.
+	stopResponseWait = 5 * time.Second
+)
+
+// StopResult reports a graceful stop of bedrock_server.
+type StopResult struct {
+	Stopped  bool   `json:"stopped"`
+	Duration string `json:"duration"` // How long bedrock_server took to exit
+}
+
+// handleStop stops bedrock_server gracefully (POST): "stop" is written to
+// its console, which saves the world, and the response is sent once the
+// process exited, waiting for ?timeout= (e.g. 90s) or the configured stop
+// timeout. The wrapper exits along with bedrock_server. The stop is
+// recorded in the audit log.
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	timeout := s.stopTimeout
+
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid timeout, e.g. 90s", http.StatusBadRequest)
+			return
+		}
+
+		timeout = d
+	}
+
+	select {
+	case <-s.runner.Done():
+		http.Error(w, "bedrock_server isn't running", http.StatusConflict)
+		return
+	default:
+	}
+
+	release, err := s.acquire(r.Context(), nil, r, oplock.Stop)
+	if err != nil {
+		lockError(w, err)
+		return
+	}
+	defer release()
+
+	finish, ok := s.stopping.begin()
+	if !ok {
+		http.Error(w, "bedrock_server isn't running", http.StatusConflict)
+		return
+	}
+	defer finish()
+
+	err = s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: "server.stop",
+		Target: "bedrock_server",
+	})
+	if err != nil {
+		fmt.Printf("Error recording stop: %v\n", err)
+	}
+
+	s.alert(fmt.Sprintf("[wrapper] Stopping the server for %s", actor(r)))
+
+	start := time.Now()
+
+	// The timeout covers writing to the console too, which blocks while
+	// bedrock_server doesn't read it
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	// Whatever the restart policy, bedrock_server stays down
+	s.runner.Shutdown()
+
+	err = s.stopRunner(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("bedrock_server didn't exit within %s", timeout), http.StatusGatewayTimeout)
+		return
+	}
+
+	data, err := json.Marshal(StopResult{Stopped: true, Duration: time.Since(start).Round(time.Millisecond).String()})
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		return
+	}
+
+	// The whole response is flushed now, since the wrapper is about to exit
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+
+	_, err = w.Write(data)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// stopRunner says the stop notice and writes "stop" to the console, then
+// waits for bedrock_server to exit, giving up once ctx is done.
+func (s *Server) stopRunner(ctx context.Context) error {
+	err := s.runner.WriteInputContext(ctx, s.noticeCommand(notices.Stop, "", notices.Values{}))
+	if err != nil {
+		return err
+	}
+
+	err = s.runner.WriteInputContext(ctx, "stop")
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-s.runner.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RestartStatus is the restart policy of bedrock_server and how often it
+// was restarted, after crashes or on request.
+type RestartStatus struct {
+	Policy   string `json:"policy"`
+	Restarts int    `json:"restarts"`
+}
+
+// restartStatus returns the restart policy and count.
+func (s *Server) restartStatus() RestartStatus {
+	return RestartStatus{Policy: s.runner.RestartPolicy(), Restarts: s.runner.Restarts()}
+}
+
+// handleServerRestart returns the restart policy and count (GET) or restarts
+// bedrock_server without the wrapper (POST): "stop" is written to its
+// console, which saves the world, it's killed if it didn't exit within the
+// stop timeout, and started again. The response is sent once it started.
+// The restart is recorded in the audit log.
+func (s *Server) handleServerRestart(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		release, err := s.acquire(r.Context(), nil, r, oplock.Reboot)
+		if err != nil {
+			lockError(w, err)
+			return
+		}
+		defer release()
+
+		err = s.audit.Record(audit.Entry{
+			Actor:  actor(r),
+			Action: "server.restart",
+			Target: "bedrock_server",
+		})
+		if err != nil {
+			fmt.Printf("Error recording restart: %v\n", err)
+		}
+
+		s.alert(fmt.Sprintf("[wrapper] Restarting the server for %s", actor(r)))
+		s.sayNotice(notices.Restart, "", notices.Values{Reason: notices.ReasonOperator})
+
+		err = s.runner.Restart(s.stopTimeout)
+		if errors.Is(err, runner.ErrNotRunning) {
+			http.Error(w, "bedrock_server isn't running", http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error restarting bedrock_server: %v", err), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(s.restartStatus())
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// Restarting reports that bedrock_server exited and will be restarted after
+// delay under the restart policy. A crash is reported as such first, which
+// blocks while a rule holds restarts.
+func (s *Server) Restarting(err error, delay time.Duration) {
+	if err != nil {
+		s.Crashed(err)
+	}
+
+	s.alert(fmt.Sprintf("[wrapper] Server exited, restarting it in %s (restart %d)", delay, s.runner.Restarts()+1))
+}
+
+// WaitStopRequests waits a little for stop requests to be answered, once
+// bedrock_server exited, so their clients learn it stopped before the
+// wrapper exits. Stop requests arriving meanwhile are turned away.
+func (s *Server) WaitStopRequests() {
+	s.stopping.wait(stopResponseWait)
+}
+
+// stopRequests counts the stop requests being answered. Unlike a WaitGroup,
+// it may be waited on while requests come in: those arriving once the
+// wrapper waits to exit are refused rather than counted.
+type stopRequests struct {
+	mu      sync.Mutex
+	count   int
+	closing bool
+	done    chan struct{} // Closed once closing and no request is left
+}
+
+// begin counts a stop request, returning a function that stops counting it,
+// unless the wrapper already waits to exit.
+func (t *stopRequests) begin() (func(), bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closing {
+		return nil, false
+	}
+
+	t.count++
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			t.count--
+			if t.closing && t.count == 0 {
+				close(t.done)
+			}
+		})
+	}, true
+}
+
+// wait refuses further stop requests and waits up to timeout for those
+// counted to be answered.
+func (t *stopRequests) wait(timeout time.Duration) {
+	t.mu.Lock()
+
+	if !t.closing {
+		t.closing = true
+		t.done = make(chan struct{})
+
+		if t.count == 0 {
+			close(t.done)
+		}
+	}
+
+	done := t.done
+	t.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+)
+
+const (
+	consoleBufferSize = 1000
+	scriptBufferSize  = 500
+	jobsBufferSize    = 200
+	stateBufferSize   = 50
+)
+
+// outputLine is an output line with its sequence number within its channel.
+type outputLine struct {
+	seq     uint64
+	text    string
+	channel string    // Empty for the console channel
+	stream  string    // runner.StreamStdout or StreamStderr for lines of bedrock_server, empty for the wrapper's
+	time    time.Time // When the line was read or written, in UTC
+	logged  time.Time // When bedrock_server logged the line, in UTC, if it had a timestamp
+}
+
+// frame returns the line frame of a line.
+func (line outputLine) frame() protocol.Frame {
+	frame := protocol.Frame{
+		Type:    protocol.FrameLine,
+		Seq:     line.seq,
+		Text:    line.text,
+		Channel: line.channel,
+		Stream:  line.stream,
+	}
+
+	if !line.time.IsZero() {
+		t := line.time
+		frame.Time = &t
+	}
+
+	if !line.logged.IsZero() {
+		logged := line.logged
+		frame.Logged = &logged
+	}
+
+	return frame
+}
+
+// outputStream is a bounded buffer of numbered output lines for one channel.
+// It is not safe for concurrent use; the Server guards it with connLock.
+type outputStream struct {
+	channel string
+	size    int
+	lines   []outputLine
+	seq     uint64 // Sequence number of the latest line
+}
+
+func newOutputStream(channel string, size int) *outputStream {
+	return &outputStream{
+		channel: channel,
+		size:    size,
+	}
+}
+
+// append numbers and buffers a line from a stream, read at t and logged at
+// logged, dropping the oldest line when full.
+func (st *outputStream) append(text, stream string, t, logged time.Time) outputLine {
+	st.seq++
+	line := outputLine{seq: st.seq, text: text, channel: st.channel, stream: stream, time: t, logged: logged}
+
+	st.lines = append(st.lines, line)
+	// Keep buffer size reasonable
+	if len(st.lines) > st.size {
+		st.lines = st.lines[len(st.lines)-st.size:]
+	}
+
+	return line
+}
+
+// oldest returns the sequence number of the oldest buffered line, or zero
+// when the buffer is empty.
+func (st *outputStream) oldest() uint64 {
+	if len(st.lines) == 0 {
+		return 0
+	}
+
+	return st.lines[0].seq
+}
+
+// between returns the buffered lines with from <= seq <= to.
+func (st *outputStream) between(from, to uint64) []outputLine {
+	var lines []outputLine
+
+	for _, line := range st.lines {
+		if line.seq >= from && line.seq <= to {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/packs"
+)
+
+// StructureRequest is the body of a structure save or load request.
+type StructureRequest struct {
+	Name     string  `json:"name"`
+	From     *[3]int `json:"from,omitempty"`     // First corner (save)
+	To       *[3]int `json:"to,omitempty"`       // Opposite corner (save)
+	Position *[3]int `json:"position,omitempty"` // Where to place the structure (load)
+}
+
+// structureError maps structure errors to HTTP responses.
+func structureError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, packs.ErrInvalidStructureName):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, packs.ErrStructureNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, packs.ErrStructureTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleStructures lists the structures in the wrapper's structure pack.
+func (s *Server) handleStructures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	structures, err := packs.ListStructures(s.appDir)
+	if err != nil {
+		structureError(w, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(structures)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// handleStructureFile downloads (GET) or uploads (PUT) a .mcstructure file.
+// Uploaded structures are added to the world's behavior packs and become
+// loadable after the next restart.
+func (s *Server) handleStructureFile(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+
+	switch r.Method {
+	case http.MethodGet:
+		f, err := packs.OpenStructure(s.appDir, name)
+		if err != nil {
+			structureError(w, err)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".mcstructure"))
+
+		_, err = io.Copy(w, f)
+		if err != nil {
+			fmt.Printf("Error sending structure: %v\n", err)
+		}
+	case http.MethodPut:
+		err := packs.SaveStructure(s.appDir, name, r.Body)
+		if err != nil {
+			structureError(w, err)
+			return
+		}
+
+		_, err = packs.SyncWorld(s.appDir, s.levelName())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleStructureCommand saves a region of the world as a structure or loads
+// a structure into the world through the console.
+func (s *Server) handleStructureCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req StructureRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Name == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !packs.ValidStructureName(req.Name) {
+		structureError(w, packs.ErrInvalidStructureName)
+		return
+	}
+
+	var command string
+
+	switch r.URL.Path {
+	case "/api/structures/save":
+		if req.From == nil || req.To == nil {
+			http.Error(w, "from and to are required", http.StatusBadRequest)
+			return
+		}
+
+		command = fmt.Sprintf("structure save %s %d %d %d %d %d %d disk", req.Name,
+			req.From[0], req.From[1], req.From[2], req.To[0], req.To[1], req.To[2])
+	default:
+		if req.Position == nil {
+			http.Error(w, "position is required", http.StatusBadRequest)
+			return
+		}
+
+		command = fmt.Sprintf("structure load %s %d %d %d", req.Name,
+			req.Position[0], req.Position[1], req.Position[2])
+	}
+
+	s.runner.WriteInput(command)
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/oplock"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/transfer"
+)
+
+// TransferDir holds the snapshots staged for a verified transfer in the app
+// directory.
+const TransferDir = "transfers"
+
+// transferTTL is how long a staged snapshot is kept for the central server
+// to fetch, or resume fetching.
+const transferTTL = 24 * time.Hour
+
+// transferPath returns the path of a staged snapshot or its manifest (ext
+// ".json"), or false if the id is malformed.
+func (s *Server) transferPath(id, ext string) (string, bool) {
+	_, err := hex.DecodeString(id)
+	if err != nil || id == "" {
+		return "", false
+	}
+
+	return filepath.Join(s.appDir, TransferDir, id+ext), true
+}
+
+// readTransfer returns the manifest of a staged snapshot.
+func (s *Server) readTransfer(id string) (transfer.Manifest, bool) {
+	var m transfer.Manifest
+
+	path, ok := s.transferPath(id, ".json")
+	if !ok {
+		return m, false
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return m, false
+	}
+
+	return m, json.Unmarshal(data, &m) == nil
+}
+
+// purgeTransfers removes the staged snapshots older than transferTTL.
+func (s *Server) purgeTransfers(now time.Time) {
+	entries, err := os.ReadDir(filepath.Join(s.appDir, TransferDir))
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < transferTTL {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(s.appDir, TransferDir, entry.Name()))
+		if err != nil {
+			fmt.Printf("Error removing staged snapshot %s: %v\n", entry.Name(), err)
+		}
+	}
+}
+
+// stageTransfer writes a snapshot into the transfer directory and its
+// manifest next to it.
+func (s *Server) stageTransfer(ctx context.Context, h *jobs.Handle, withPacks bool) (transfer.Manifest, error) {
+	var m transfer.Manifest
+
+	dir := filepath.Join(s.appDir, TransferDir)
+
+	err := os.MkdirAll(dir, 0750)
+	if err != nil {
+		return m, fmt.Errorf("error creating transfer directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".snapshot-*")
+	if err != nil {
+		return m, fmt.Errorf("error creating snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // Clean up if the rename didn't happen
+
+	createdAt := time.Now().UTC()
+
+	err = s.writeSnapshot(ctx, h, tmp, withPacks, func() {})
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+
+	if err != nil {
+		return m, fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	h.Logf("computing checksums")
+
+	m, err = transfer.Describe(tmp.Name(), transfer.DefaultChunkSize)
+	if err != nil {
+		return m, err
+	}
+
+	m.ID = newEpoch()
+	m.World = s.levelName()
+	m.CreatedAt = createdAt
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return m, err
+	}
+
+	path, _ := s.transferPath(m.ID, ".zip")
+	manifest, _ := s.transferPath(m.ID, ".json")
+
+	err = os.Rename(tmp.Name(), path)
+	if err == nil {
+		err = os.WriteFile(manifest, data, 0600)
+	}
+
+	if err != nil {
+		return m, fmt.Errorf("error staging snapshot: %w", err)
+	}
+
+	h.Logf("staged %s, %d bytes in %d chunks", m.ID, m.Size, len(m.Chunks))
+
+	return m, nil
+}
+
+// handleTransfer stages a snapshot for a verified transfer and returns its
+// manifest (POST, with packs=true also the installed packs the world uses),
+// returns the manifest of the staged snapshot in ?id= (GET) or removes it
+// once it was received (DELETE). Staging a snapshot is a backup under the
+// operation lock. Staged snapshots are removed after a day.
+func (s *Server) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		m, ok := s.readTransfer(id)
+		if !ok {
+			http.Error(w, "Staged snapshot not found", http.StatusNotFound)
+			return
+		}
+
+		err := json.NewEncoder(w).Encode(m)
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+		}
+	case http.MethodPost:
+		s.handleTransferStage(w, r)
+	case http.MethodDelete:
+		if _, ok := s.readTransfer(id); !ok {
+			http.Error(w, "Staged snapshot not found", http.StatusNotFound)
+			return
+		}
+
+		for _, ext := range []string{".zip", ".json"} {
+			path, _ := s.transferPath(id, ext)
+
+			err := os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTransferStage stages a snapshot for a verified transfer.
+func (s *Server) handleTransferStage(w http.ResponseWriter, r *http.Request) {
+	var m transfer.Manifest
+
+	locked := false
+
+	err := s.jobs.Run(r.Context(), "export", "snapshot for transfer", actor(r),
+		func(ctx context.Context, h *jobs.Handle) error {
+			release, err := s.acquire(ctx, h, r, oplock.Backup)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			locked = true
+
+			s.purgeTransfers(time.Now())
+
+			m, err = s.stageTransfer(ctx, h, r.URL.Query().Get("packs") == "true")
+
+			return err
+		})
+	if err != nil && !locked {
+		lockError(w, err)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(m)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleTransferData serves the staged snapshot in ?id=, honouring Range
+// requests so it can be fetched in chunks and resumed.
+func (s *Server) handleTransferData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path, ok := s.transferPath(r.URL.Query().Get("id"), ".zip")
+	if !ok {
+		http.Error(w, "Staged snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		http.Error(w, "Staged snapshot not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), f)
+}
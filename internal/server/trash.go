@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/history"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/oplock"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/trash"
+)
+
+// TrashDir is the directory of the trash in the app directory.
+const TrashDir = "trash"
+
+// trashPurgeInterval is how often expired items are purged from the trash.
+const trashPurgeInterval = time.Hour
+
+// discard moves what a destructive operation removes to the trash, and
+// copies there the files it changes in place. Without a trash the removed
+// entries are deleted right away.
+func (s *Server) discard(item trash.Item) (trash.Item, error) {
+	if s.trash == nil {
+		for _, e := range item.Entries {
+			if e.Copy {
+				continue
+			}
+
+			err := os.RemoveAll(filepath.Join(s.appDir, e.Path))
+			if err != nil {
+				return item, fmt.Errorf("error removing %s: %w", e.Path, err)
+			}
+		}
+
+		return item, nil
+	}
+
+	item, err := s.trash.Put(s.appDir, item)
+	if err != nil {
+		return item, err
+	}
+
+	fmt.Printf("Moved %s %s to the trash as %s\n", item.Kind, item.Name, item.ID)
+
+	return item, nil
+}
+
+// RunTrash purges expired items from the trash until bedrock_server exits.
+func (s *Server) RunTrash() {
+	if s.trash == nil {
+		return
+	}
+
+	s.purgeTrash(time.Now())
+
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.runner.Done():
+			return
+		case now := <-ticker.C:
+			s.purgeTrash(now)
+		}
+	}
+}
+
+// purgeTrash removes the items expired at now from the trash.
+func (s *Server) purgeTrash(now time.Time) {
+	purged, err := s.trash.Purge(now)
+	if err != nil {
+		fmt.Printf("Error purging the trash: %v\n", err)
+	}
+
+	for _, item := range purged {
+		fmt.Printf("Purged %s %s from the trash\n", item.Kind, item.Name)
+	}
+}
+
+// handleTrash lists the trashed items (GET) or purges the one in ?id= right
+// away (DELETE).
+func (s *Server) handleTrash(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		err := json.NewEncoder(w).Encode(s.trash.List())
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+		}
+	case http.MethodDelete:
+		item, err := s.trash.Delete(r.URL.Query().Get("id"))
+		if errors.Is(err, trash.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = s.audit.Record(audit.Entry{
+			Actor:  actor(r),
+			Action: "trash.purge",
+			Target: fmt.Sprintf("%s %s", item.Kind, item.Name),
+		})
+		if err != nil {
+			fmt.Printf("Error recording trash purge: %v\n", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTrashUndo puts the trashed item in ?id= back. A deleted world or
+// pack isn't restored over one created since; config files are, and the
+// undo is recorded in the config history. Changes take effect on the next
+// restart of the server.
+func (s *Server) handleTrashUndo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	item, err := s.trash.Get(r.URL.Query().Get("id"))
+	if errors.Is(err, trash.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	release, err := s.acquire(r.Context(), nil, r, oplock.Delete)
+	if err != nil {
+		lockError(w, err)
+		return
+	}
+	defer release()
+
+	// What the undo replaces, for the config history
+	replaced := map[string][]byte{}
+
+	for _, e := range item.Entries {
+		if e.Copy && history.Tracked(e.Path) {
+			replaced[e.Path], _ = os.ReadFile(filepath.Join(s.appDir, e.Path)) // #nosec G304
+		}
+	}
+
+	item, err = s.trash.Restore(s.appDir, item.ID)
+
+	switch {
+	case errors.Is(err, trash.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, trash.ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for rel, old := range replaced {
+		data, err := os.ReadFile(filepath.Join(s.appDir, rel)) // #nosec G304
+		if err == nil {
+			s.trackConfig(rel, actor(r), "restored from the trash", old, data)
+		}
+	}
+
+	err = s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: "trash.undo",
+		Target: fmt.Sprintf("%s %s", item.Kind, item.Name),
+	})
+	if err != nil {
+		fmt.Printf("Error recording trash undo: %v\n", err)
+	}
+
+	err = json.NewEncoder(w).Encode(item)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
@@ -0,0 +1,307 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/downloader"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/oplock"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/protocol"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/runner"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/selfupdate"
+)
+
+const (
+	// updateTimeout bounds checking for and downloading a new wrapper build.
+	updateTimeout = 5 * time.Minute
+
+	// handoffDelay leaves time for the response to an update to be sent
+	// before the wrapper re-executes.
+	handoffDelay = time.Second
+)
+
+// UpdateStatus is the running wrapper version and the latest release.
+type UpdateStatus struct {
+	Current   string              `json:"current"`
+	Latest    *selfupdate.Release `json:"latest,omitempty"`
+	Error     string              `json:"error,omitempty"` // Why the latest release is unknown
+	Supported bool                `json:"supported"`       // Whether updates can keep bedrock_server running
+}
+
+// VersionInfo is what the wrapper runs, and the central server managing it.
+type VersionInfo struct {
+	Wrapper string               `json:"wrapper"`
+	Server  *downloader.Manifest `json:"server"`            // nil if the installed version wasn't recorded
+	Central *protocol.Hello      `json:"central,omitempty"` // nil until a central server sent its hello
+}
+
+// handleVersion reports the versions of the wrapper and of the installed
+// bedrock_server.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info := VersionInfo{Wrapper: s.version, Central: s.central.Load()}
+
+	manifest, err := downloader.ReadManifest(s.appDir)
+	if err == nil {
+		info.Server = &manifest
+	} else if !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Error reading installed version: %v\n", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(info)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleUpdate reports whether a newer wrapper is released on GET, and on
+// POST installs it and re-executes the wrapper as the new build, handing
+// bedrock_server over so players stay connected. ?force=true installs the
+// latest release even if it isn't newer, and ?wait=true waits for an
+// operation such as a backup to finish instead of failing.
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	if s.update == nil {
+		http.Error(w, "self-update is disabled", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ctx, cancel := context.WithTimeout(r.Context(), updateTimeout)
+		defer cancel()
+
+		status := UpdateStatus{Current: s.update.Current, Supported: runner.HandoffSupported}
+
+		rel, err := s.update.Check(ctx)
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Latest = &rel
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		err = json.NewEncoder(w).Encode(status)
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+		}
+	case http.MethodPost:
+		if !runner.HandoffSupported {
+			http.Error(w, "self-update is only available on Linux", http.StatusNotImplemented)
+			return
+		}
+
+		release, err := s.acquire(r.Context(), nil, r, oplock.Upgrade)
+		if err != nil {
+			lockError(w, err)
+			return
+		}
+
+		rel, executable, err := s.installUpdate(r)
+		if err != nil {
+			release()
+			updateError(w, err)
+
+			return
+		}
+
+		err = s.audit.Record(audit.Entry{
+			Actor:  actor(r),
+			Action: "wrapper.update",
+			Target: fmt.Sprintf("%s -> %s", s.update.Current, rel.Version),
+		})
+		if err != nil {
+			fmt.Printf("Error recording update: %v\n", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+
+		err = json.NewEncoder(w).Encode(rel)
+		if err != nil {
+			fmt.Printf("Error sending JSON response: %v\n", err)
+		}
+
+		time.AfterFunc(handoffDelay, func() {
+			defer release()
+			_ = s.handoff(executable)
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRestart re-executes the wrapper in place, keeping bedrock_server
+// running, so changed config files and a build installed over the
+// executable take effect.
+func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !runner.HandoffSupported {
+		http.Error(w, "restarting the wrapper in place is only available on Linux", http.StatusNotImplemented)
+		return
+	}
+
+	executable, err := wrapperExecutable()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	release, err := s.acquire(r.Context(), nil, r, oplock.Restart)
+	if err != nil {
+		lockError(w, err)
+		return
+	}
+
+	err = s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: "wrapper.restart",
+		Target: executable,
+	})
+	if err != nil {
+		fmt.Printf("Error recording restart: %v\n", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	time.AfterFunc(handoffDelay, func() {
+		defer release()
+		_ = s.handoff(executable)
+	})
+}
+
+// Restart re-executes the wrapper in place like handleRestart, for a
+// signal. It only returns if the wrapper couldn't be re-executed.
+func (s *Server) Restart() error {
+	if !runner.HandoffSupported {
+		return runner.ErrUnsupported
+	}
+
+	executable, err := wrapperExecutable()
+	if err != nil {
+		return err
+	}
+
+	release, err := s.ops.Acquire(context.Background(), oplock.Restart, "signal", false)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return s.handoff(executable)
+}
+
+// errUpToDate is returned when updating to a release that isn't newer.
+var errUpToDate = errors.New("already running the latest release")
+
+// wrapperExecutable returns the file the wrapper runs from, following
+// symlinks such as /usr/bin/... After a package upgrade replaced it, this
+// is the path of the new build.
+func wrapperExecutable() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("error finding the wrapper executable: %w", err)
+	}
+
+	// Linux marks an executable that was replaced while running
+	executable = strings.TrimSuffix(executable, " (deleted)")
+
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return "", fmt.Errorf("error finding the wrapper executable: %w", err)
+	}
+
+	return executable, nil
+}
+
+// installUpdate replaces the wrapper executable with the latest release and
+// returns the release and the path of the executable.
+func (s *Server) installUpdate(r *http.Request) (selfupdate.Release, string, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), updateTimeout)
+	defer cancel()
+
+	rel, err := s.update.Check(ctx)
+	if err != nil {
+		return rel, "", err
+	}
+
+	if !rel.Newer && r.URL.Query().Get("force") != "true" {
+		return rel, "", fmt.Errorf("%w %s", errUpToDate, rel.Version)
+	}
+
+	executable, err := wrapperExecutable()
+	if err != nil {
+		return rel, "", err
+	}
+
+	fmt.Printf("Updating wrapper from %s to %s\n", s.update.Current, rel.Version)
+
+	description := fmt.Sprintf("wrapper %s", rel.Version)
+
+	err = s.jobs.Run(ctx, "download", description, actor(r), func(ctx context.Context, h *jobs.Handle) error {
+		h.Logf("downloading %s", rel.URL)
+		return s.update.Download(ctx, rel, executable)
+	})
+	if err != nil {
+		return rel, "", err
+	}
+
+	return rel, executable, nil
+}
+
+// updateError reports a self-update error with a matching status.
+func updateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUpToDate):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, selfupdate.ErrNoAsset):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, selfupdate.ErrChecksum), errors.Is(err, selfupdate.ErrSignature):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handoff re-executes the wrapper as executable with the same arguments,
+// leaving bedrock_server running for the new wrapper to adopt. Plugins
+// are stopped rather than orphaned, and the MQTT connection is closed
+// without marking the server offline. Players connected through the UDP
+// proxy have to reconnect, as its sockets don't survive the exec. If the
+// exec fails, plugins and MQTT are started again and the wrapper carries on.
+// Flags and environment variables are passed on unchanged. The caller holds
+// the operation lock.
+func (s *Server) handoff(executable string) error {
+	fmt.Printf("Handing bedrock_server over to %s\n", executable)
+
+	s.StopPlugins()
+	s.mqttDetach()
+
+	err := s.runner.Handoff(executable, os.Args)
+
+	fmt.Fprintf(os.Stderr, "Error re-executing wrapper: %v\n", err)
+
+	s.startPlugins(s.pluginConfigs)
+	s.mqttReattach()
+
+	return err
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/uptime"
+)
+
+const (
+	// stopLine is logged by bedrock_server when it is told to stop.
+	stopLine = "Stopping server..."
+
+	// stopWindow is how long after a stop was logged downtime counts as a
+	// manual stop rather than a crash.
+	stopWindow = 10 * time.Minute
+)
+
+// observeStop remembers when the server was last told to stop.
+func (w *WrapperConnection) observeStop(line string) {
+	if strings.Contains(line, stopLine) {
+		w.stoppedAt.Store(time.Now().UnixNano())
+	}
+}
+
+// downCause returns the likely reason the server is down.
+func (w *WrapperConnection) downCause(now time.Time) string {
+	stopped := w.stoppedAt.Load()
+	if stopped != 0 && now.Sub(time.Unix(0, stopped)) < stopWindow {
+		return uptime.CauseManualStop
+	}
+
+	return uptime.CauseCrash
+}
+
+// sampleUptime records whether the wrapper's server is up, and its usage. A
+// server is up when its wrapper is connected and it answers pings.
+func (w *WrapperConnection) sampleUptime(now time.Time) {
+	if w.Status == StatusConnected {
+		pong, err := w.ping()
+		if err == nil {
+			if w.uptime != nil {
+				w.uptime.Record(w.ID, now, true, "", pong.VersionName)
+			}
+
+			w.observeSample(now, true, pong.VersionName)
+
+			w.sampleUsage(now, true, pong.PlayerCount)
+
+			return
+		}
+	}
+
+	if w.uptime != nil {
+		w.uptime.Record(w.ID, now, false, w.downCause(now), "")
+	}
+
+	w.observeSample(now, false, "")
+
+	w.sampleUsage(now, false, 0)
+}
+
+// UptimeSamples records the status and usage of all wrappers every interval
+// until the manager is shut down.
+func (m *ConnectionManager) UptimeSamples(interval time.Duration) {
+	if m.uptime == nil && m.usage == nil && m.timeline == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			var wg sync.WaitGroup
+
+			for _, wConn := range m.ListConnections() {
+				wg.Add(1)
+
+				go func(wConn *WrapperConnection) {
+					defer wg.Done()
+
+					wConn.sampleUptime(now)
+				}(wConn)
+			}
+
+			wg.Wait()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// reportMonth returns the month in ?month=, the current month by default.
+func reportMonth(r *http.Request) (time.Time, error) {
+	value := r.URL.Query().Get("month")
+	if value == "" {
+		return time.Now().UTC(), nil
+	}
+
+	month, err := time.Parse(uptime.MonthLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month, expected YYYY-MM")
+	}
+
+	return month, nil
+}
+
+// uptimeReports returns the reports for the month in ?month= (the current
+// month by default), limited to ?wrapper= if given.
+func (s *CentralServer) uptimeReports(r *http.Request) ([]uptime.Report, error) {
+	month, err := reportMonth(r)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := s.manager.uptime.Reports(month)
+
+	if id := r.URL.Query().Get("wrapper"); id != "" {
+		filtered := []uptime.Report{}
+
+		for _, report := range reports {
+			if report.Server == id {
+				filtered = append(filtered, report)
+			}
+		}
+
+		reports = filtered
+	}
+
+	return reports, nil
+}
+
+// handleUptime returns the monthly uptime reports as JSON.
+func (s *CentralServer) handleUptime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reports, err := s.uptimeReports(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(reports)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// handleUptimeExport downloads the monthly uptime reports. ?format=json
+// returns JSON, otherwise CSV with one row per wrapper, or per incident with
+// ?incidents=true.
+func (s *CentralServer) handleUptimeExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reports, err := s.uptimeReports(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := "uptime"
+	if r.URL.Query().Get("incidents") == "true" {
+		name = "uptime-incidents"
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".json"))
+
+		err = json.NewEncoder(w).Encode(reports)
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+
+		if name == "uptime" {
+			err = uptime.WriteCSV(w, reports)
+		} else {
+			err = uptime.WriteIncidentsCSV(w, reports)
+		}
+	}
+
+	if err != nil {
+		fmt.Printf("Error writing uptime export: %v\n", err)
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/cloud"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/usage"
+)
+
+// SetRate sets what running the wrapper's host costs, used to estimate
+// energy use and costs in usage reports.
+func (w *WrapperConnection) SetRate(rate usage.Rate) {
+	w.groupsMu.Lock()
+	w.rate = rate
+	w.groupsMu.Unlock()
+}
+
+// Rate returns what running the wrapper's host costs.
+func (w *WrapperConnection) Rate() usage.Rate {
+	w.groupsMu.RLock()
+	defer w.groupsMu.RUnlock()
+
+	return w.rate
+}
+
+// powered reports whether the wrapper's host is on. Hosts that aren't
+// managed are taken to be always on, and a host in an unknown state to be on
+// if its server is up.
+func (w *WrapperConnection) powered(now time.Time, up bool) bool {
+	host := w.Host()
+	if host == nil {
+		return true
+	}
+
+	switch host.Status(now).State {
+	case cloud.StateStopped:
+		return false
+	case cloud.StateUnknown:
+		return up
+	default:
+		return true
+	}
+}
+
+// sampleUsage records whether the wrapper's host is powered and players are
+// online.
+func (w *WrapperConnection) sampleUsage(now time.Time, up bool, players int) {
+	if w.usage == nil {
+		return
+	}
+
+	w.usage.Record(w.ID, now, usage.Sample{Powered: w.powered(now, up), Up: up, Players: players})
+}
+
+// handleUsage returns the monthly usage reports of the month in ?month= (the
+// current month by default), limited to ?wrapper= if given, as JSON or as
+// CSV with ?format=csv.
+func (s *CentralServer) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	month, err := reportMonth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rates := make(map[string]usage.Rate)
+	for _, wConn := range s.manager.ListConnections() {
+		rates[wConn.ID] = wConn.Rate()
+	}
+
+	reports := s.manager.usage.Reports(month, rates)
+
+	if id := r.URL.Query().Get("wrapper"); id != "" {
+		filtered := []usage.Report{}
+
+		for _, report := range reports {
+			if report.Server == id {
+				filtered = append(filtered, report)
+			}
+		}
+
+		reports = filtered
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "usage.csv"))
+
+		err = usage.WriteCSV(w, reports)
+		if err != nil {
+			fmt.Printf("Error writing usage export: %v\n", err)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(reports)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
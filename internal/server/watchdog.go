@@ -0,0 +1,210 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	routineManage    = "manage"
+	routineReadPump  = "readPump"
+	routineWritePump = "writePump"
+	routineClient    = "client"
+	routineOutput    = "output"
+
+	// cleanupGrace is how long goroutines get to exit after a connection is closed
+	// before they are reported as leaked.
+	cleanupGrace = 15 * time.Second
+
+	// cleanupPoll is how often goroutines are counted during the grace
+	// period.
+	cleanupPoll = 100 * time.Millisecond
+)
+
+// routineTracker counts live goroutines by role so that leaks can be detected.
+type routineTracker struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newRoutineTracker() *routineTracker {
+	return &routineTracker{
+		counts: make(map[string]int),
+	}
+}
+
+// track records that a goroutine with the given role has started and returns
+// a function that must be called when it exits.
+func (t *routineTracker) track(role string) func() {
+	t.mu.Lock()
+	t.counts[role]++
+	t.mu.Unlock()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			t.counts[role]--
+			t.mu.Unlock()
+		})
+	}
+}
+
+// snapshot returns a copy of the live goroutine counts by role.
+func (t *routineTracker) snapshot() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := make(map[string]int, len(t.counts))
+	for role, n := range t.counts {
+		counts[role] = n
+	}
+
+	return counts
+}
+
+// total returns the number of live goroutines across all roles.
+func (t *routineTracker) total() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var total int
+	for _, n := range t.counts {
+		total += n
+	}
+
+	return total
+}
+
+// RoutineReport describes the tracked goroutines of a single connection.
+type RoutineReport struct {
+	ID         string         `json:"id,omitempty"`
+	Name       string         `json:"name,omitempty"`
+	Routines   map[string]int `json:"routines"`
+	Clients    int            `json:"clients"`
+	Violations []string       `json:"violations,omitempty"`
+}
+
+// checkInvariants returns a description of every cleanup invariant that is
+// currently violated by the wrapper connection.
+func (w *WrapperConnection) checkInvariants() []string {
+	var violations []string
+
+	closed := false
+
+	select {
+	case <-w.done:
+		closed = true
+	default:
+	}
+
+	counts := w.routines.snapshot()
+
+	roles := make([]string, 0, len(counts))
+	for role := range counts {
+		roles = append(roles, role)
+	}
+
+	sort.Strings(roles)
+
+	for _, role := range roles {
+		n := counts[role]
+
+		switch {
+		case n < 0:
+			violations = append(violations, fmt.Sprintf("%s count is negative (%d)", role, n))
+		case closed && n > 0:
+			violations = append(violations, fmt.Sprintf("%d %s goroutine(s) alive after done was closed", n, role))
+		case role != routineClient && n > 1:
+			violations = append(violations, fmt.Sprintf("%d %s goroutines running concurrently", n, role))
+		}
+	}
+
+	w.clientsMu.RLock()
+	clients := len(w.clients)
+	w.clientsMu.RUnlock()
+
+	if clients > counts[routineClient] {
+		violations = append(violations,
+			fmt.Sprintf("%d client(s) registered but only %d client handler(s) running", clients, counts[routineClient]))
+	}
+
+	return violations
+}
+
+// report returns the goroutine report for the wrapper connection.
+func (w *WrapperConnection) report() RoutineReport {
+	w.clientsMu.RLock()
+	clients := len(w.clients)
+	w.clientsMu.RUnlock()
+
+	return RoutineReport{
+		ID:         w.ID,
+		Name:       w.Name,
+		Routines:   w.routines.snapshot(),
+		Clients:    clients,
+		Violations: w.checkInvariants(),
+	}
+}
+
+// verifyCleanup waits up to the grace period for the connection's goroutines
+// to exit and logs a warning if any are still running. It returns as soon as
+// they all exited, rather than outliving the connection for the whole grace
+// period.
+func (w *WrapperConnection) verifyCleanup(grace time.Duration) {
+	deadline := time.After(grace)
+
+	ticker := time.NewTicker(cleanupPoll)
+	defer ticker.Stop()
+
+	for w.routines.total() > 0 {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			for _, v := range w.checkInvariants() {
+				fmt.Printf("Warning: wrapper %s (%s): %s\n", w.Name, w.ID, v)
+			}
+
+			return
+		}
+	}
+}
+
+// Watchdog periodically checks all connections for violated cleanup invariants
+// and logs a warning for each one until the manager is shut down.
+func (m *ConnectionManager) Watchdog(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, wConn := range m.ListConnections() {
+				for _, v := range wConn.checkInvariants() {
+					fmt.Printf("Warning: wrapper %s (%s): %s\n", wConn.Name, wConn.ID, v)
+				}
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Reports returns the goroutine reports of all wrapper connections.
+func (m *ConnectionManager) Reports() []RoutineReport {
+	conns := m.ListConnections()
+
+	reports := make([]RoutineReport, 0, len(conns))
+	for _, wConn := range conns {
+		reports = append(reports, wConn.report())
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].ID < reports[j].ID
+	})
+
+	return reports
+}
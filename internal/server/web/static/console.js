@@ -0,0 +1,366 @@
+// Console of the wrapper. The page defines messages, the translated strings.
+
+const ROW_HEIGHT = 18; // --row-height in console.css
+const MAX_LINES = 10000; // Lines kept unless the wrapper hints otherwise
+const OVERSCAN = 20; // Rows rendered above and below the visible ones
+const MAX_HISTORY = 50; // Commands kept for the up and down keys
+const maxReconnectAttempts = 5;
+const ACTIVITY_INTERVAL = 30000; // Least time between activity frames, in ms
+const CLOSE_IDLE = 4000; // Close code of consoles disconnected for being idle
+
+let ws;
+let reconnectAttempts = 0;
+let lastActivity = 0; // When the wrapper was last told of user activity
+let idleClosed = false; // Disconnected for being idle, until the user is back
+
+// The wrapper's session and the last console line received, to resume
+// after a reconnect without replaying what is already shown
+let epoch = '';
+let lastSeq = 0;
+
+// Output lines as {text, className, seq, length}, length set for lines the
+// wrapper trimmed. Phones slow to a crawl with a DOM node per line after
+// hours of output, so only the rows in view are rendered, and no more lines
+// are kept than the wrapper buffers, as its session frame hints.
+let lines = [];
+let maxLines = MAX_LINES;
+let follow = true; // Keep the latest line in view
+let renderPending = false;
+
+function t(key, vars = {}) {
+    return (messages[key] || key).replace(/\{(\w+)\}/g, (match, name) => name in vars ? vars[name] : match);
+}
+
+function appendLine(text, className, seq = 0, length = 0, time = '', logged = '') {
+    lines.push({ text, className, seq, length, time, logged });
+
+    // Drop old lines in batches rather than on every line
+    if (lines.length > maxLines + Math.ceil(maxLines / 10)) {
+        const removed = lines.length - maxLines;
+        lines = lines.slice(removed);
+
+        if (!follow) {
+            document.getElementById('output').scrollTop -= removed * ROW_HEIGHT;
+        }
+    }
+
+    scheduleRender();
+}
+
+function scheduleRender() {
+    if (renderPending) return;
+    renderPending = true;
+    requestAnimationFrame(render);
+}
+
+function render() {
+    renderPending = false;
+
+    const output = document.getElementById('output');
+    const spacer = document.getElementById('output-spacer');
+    const rows = document.getElementById('output-rows');
+
+    spacer.style.height = (lines.length * ROW_HEIGHT) + 'px';
+    if (follow) {
+        output.scrollTop = output.scrollHeight;
+    }
+
+    const first = Math.max(0, Math.floor(output.scrollTop / ROW_HEIGHT) - OVERSCAN);
+    const last = Math.min(lines.length, Math.ceil((output.scrollTop + output.clientHeight) / ROW_HEIGHT) + OVERSCAN);
+
+    rows.style.top = (first * ROW_HEIGHT) + 'px';
+
+    const fragment = document.createDocumentFragment();
+    for (let i = first; i < last; i++) {
+        const line = lines[i];
+        const div = document.createElement('div');
+        div.className = 'line ' + line.className;
+        div.textContent = line.text;
+
+        if (line.time) {
+            div.title = 'Read ' + new Date(line.time).toLocaleString();
+            if (line.logged) {
+                div.title += '\nLogged ' + new Date(line.logged).toLocaleString();
+            }
+        }
+
+        if (line.length > 0) {
+            div.textContent += '… ';
+
+            const more = document.createElement('button');
+            more.className = 'show-full';
+            more.textContent = t('console.show_full');
+            more.addEventListener('click', () => showFullLine(line));
+            div.appendChild(more);
+        }
+
+        fragment.appendChild(div);
+    }
+    rows.replaceChildren(fragment);
+
+    document.getElementById('jump').hidden = follow;
+}
+
+function onScroll() {
+    const output = document.getElementById('output');
+    follow = output.scrollTop + output.clientHeight >= output.scrollHeight - ROW_HEIGHT;
+    scheduleRender();
+}
+
+function jumpToLatest() {
+    follow = true;
+    scheduleRender();
+}
+
+function clearOutput() {
+    lines = [];
+    follow = true;
+    scheduleRender();
+}
+
+// showFullLine replaces a trimmed line with the whole line, which the
+// wrapper keeps while it is buffered
+function showFullLine(line) {
+    const params = new URLSearchParams({ seq: line.seq, epoch });
+
+    fetch('/api/console/line?' + params, { headers: { 'X-Auth-Key': localStorage.getItem('authKey') } })
+        .then(function(response) {
+            if (!response.ok) throw new Error('HTTP ' + response.status);
+            return response.json();
+        })
+        .then(function(frame) {
+            line.text = frame.text;
+            line.length = 0;
+            scheduleRender();
+        })
+        .catch(function(error) {
+            console.error('Error loading full line:', error);
+            alert(t('console.line_gone'));
+        });
+}
+
+function handleFrame(frame) {
+    switch (frame.type) {
+    case 'session':
+        epoch = frame.epoch;
+        maxLines = frame.max_lines || MAX_LINES;
+        break;
+    case 'line':
+        if (frame.channel === 'state') {
+            setServerState(JSON.parse(frame.text));
+            break;
+        }
+        lastSeq = frame.seq;
+        // Lines of the wrapper itself have no stream
+        appendLine(frame.text || '', frame.stream === 'stderr' ? 'stderr' : 'stdout', frame.seq, frame.length || 0, frame.time, frame.logged);
+        break;
+    case 'gap':
+        appendLine(t('console.lines_lost', { count: frame.to - frame.from + 1 }), 'disconnected');
+        break;
+    }
+}
+
+function setStatus(connected) {
+    const status = document.getElementById('status');
+    status.textContent = t(connected ? 'console.connected' : 'console.disconnected');
+    status.className = 'status ' + (connected ? 'connected' : 'disconnected');
+}
+
+// setServerState shows the state of bedrock_server, as the wrapper tracks it
+// rather than guessed from its output
+function setServerState(transition) {
+    const state = document.getElementById('server-state');
+    state.textContent = t('console.state.' + transition.to);
+    state.title = t('console.state.since', { since: new Date(transition.time).toLocaleString() }) +
+        (transition.error ? '\n' + transition.error : '');
+    state.className = 'status state-' + transition.to;
+    state.hidden = false;
+}
+
+function connect() {
+    const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+    let authKey = localStorage.getItem('authKey');
+    if (!authKey) {
+        authKey = prompt(t('console.auth_prompt'));
+        if (authKey) {
+            localStorage.setItem('authKey', authKey);
+        } else {
+            console.error('Authentication key is required');
+            return;
+        }
+    }
+
+    // Add auth key as a query parameter, and ask for structured frames
+    // resuming after the last line shown
+    const wsUrl = new URL(protocol + '//' + window.location.host + '/ws');
+    wsUrl.searchParams.append('auth', authKey);
+    wsUrl.searchParams.append('format', 'json');
+    wsUrl.searchParams.append('channels', 'state');
+    if (epoch) {
+        wsUrl.searchParams.append('resume', epoch + ':' + lastSeq);
+    }
+    ws = new WebSocket(wsUrl.toString());
+
+    ws.onopen = function() {
+        console.log('Connected to server');
+        setStatus(true);
+        reconnectAttempts = 0;
+    };
+
+    ws.onclose = function(event) {
+        console.log('Disconnected from server:', event.code);
+        setStatus(false);
+
+        // Check if it was an auth error (code 1008 is policy violation)
+        if (event.code === CLOSE_IDLE) {
+            idleClosed = true;
+            appendLine(t('console.idle_closed'), 'disconnected');
+        } else if (event.code === 1008) {
+            localStorage.removeItem('authKey'); // Clear invalid key
+            appendLine(t('console.auth_failed'), 'disconnected');
+        } else if (reconnectAttempts < maxReconnectAttempts) {
+            reconnectAttempts++;
+            setTimeout(connect, 1000 * reconnectAttempts);
+        } else {
+            appendLine(t('console.connection_lost'), 'disconnected');
+        }
+    };
+
+    ws.onmessage = function(event) {
+        try {
+            handleFrame(JSON.parse(event.data));
+        } catch (error) {
+            console.error('Invalid frame:', error);
+        }
+    };
+
+    ws.onerror = function(error) {
+        console.error('WebSocket error:', error);
+    };
+}
+
+// onActivity tells the wrapper the user is at the page, at most every
+// ACTIVITY_INTERVAL, so the console isn't disconnected as idle, and
+// reconnects a console that was
+function onActivity() {
+    if (idleClosed) {
+        idleClosed = false;
+        reconnectAttempts = 0;
+        connect();
+        return;
+    }
+
+    const now = Date.now();
+    if (now - lastActivity < ACTIVITY_INTERVAL || !ws || ws.readyState !== WebSocket.OPEN) return;
+
+    lastActivity = now;
+    ws.send(JSON.stringify({ type: 'activity' }));
+}
+
+// Commands sent before, newest last, for the up and down keys
+let commandHistory = JSON.parse(localStorage.getItem('commandHistory') || '[]');
+let historyIndex = commandHistory.length;
+
+function sendCommand(command) {
+    if (command.trim() === '' || !ws || ws.readyState !== WebSocket.OPEN) return false;
+
+    ws.send(command);
+    jumpToLatest();
+    return true;
+}
+
+function submitCommand(event) {
+    event.preventDefault();
+
+    const input = document.getElementById('command-input');
+    const command = input.value;
+    if (!sendCommand(command)) return;
+
+    if (commandHistory[commandHistory.length - 1] !== command) {
+        commandHistory.push(command);
+        commandHistory = commandHistory.slice(-MAX_HISTORY);
+        localStorage.setItem('commandHistory', JSON.stringify(commandHistory));
+    }
+    historyIndex = commandHistory.length;
+    input.value = '';
+}
+
+function browseHistory(event) {
+    if (event.key !== 'ArrowUp' && event.key !== 'ArrowDown') return;
+    event.preventDefault();
+
+    historyIndex += event.key === 'ArrowUp' ? -1 : 1;
+    historyIndex = Math.max(0, Math.min(commandHistory.length, historyIndex));
+    event.target.value = commandHistory[historyIndex] || '';
+}
+
+function loadAddonIssues() {
+    const authKey = localStorage.getItem('authKey');
+    if (!authKey) return;
+
+    fetch('/api/addons/issues', { headers: { 'X-Auth-Key': authKey } })
+        .then(function(response) {
+            if (!response.ok) throw new Error('HTTP ' + response.status);
+            return response.json();
+        })
+        .then(function(data) {
+            document.getElementById('addon-counts').textContent =
+                t('addons.counts', { errors: data.counts.ERROR, warnings: data.counts.WARN });
+
+            const list = document.getElementById('addon-issues');
+            list.innerHTML = '';
+            if (data.issues.length === 0) {
+                list.textContent = t('addons.none');
+                return;
+            }
+
+            data.issues.forEach(function(issue) {
+                const div = document.createElement('div');
+                div.className = 'issue-' + issue.level;
+                div.textContent = '[' + issue.area + '] ' + issue.message + ' ';
+
+                const count = document.createElement('span');
+                count.className = 'issue-count';
+                count.textContent = 'x' + issue.count;
+                div.appendChild(count);
+
+                list.appendChild(div);
+            });
+        })
+        .catch(function(error) {
+            console.error('Error loading addon issues:', error);
+        });
+}
+
+function clearAddonIssues() {
+    const authKey = localStorage.getItem('authKey');
+    if (!authKey) return;
+
+    fetch('/api/addons/issues', { method: 'DELETE', headers: { 'X-Auth-Key': authKey } })
+        .then(loadAddonIssues);
+}
+
+document.addEventListener('DOMContentLoaded', function() {
+    const output = document.getElementById('output');
+    output.addEventListener('scroll', onScroll, { passive: true });
+    window.addEventListener('resize', scheduleRender);
+
+    document.getElementById('jump').addEventListener('click', jumpToLatest);
+    document.getElementById('clear-output').addEventListener('click', clearOutput);
+    document.getElementById('input-container').addEventListener('submit', submitCommand);
+    document.getElementById('command-input').addEventListener('keydown', browseHistory);
+    document.querySelectorAll('#quick-actions [data-command]').forEach(function(button) {
+        button.addEventListener('click', function() {
+            sendCommand(button.dataset.command);
+        });
+    });
+    document.getElementById('addon-refresh').addEventListener('click', loadAddonIssues);
+    document.getElementById('addon-clear').addEventListener('click', clearAddonIssues);
+    ['keydown', 'pointerdown', 'wheel', 'touchstart'].forEach(function(type) {
+        document.addEventListener(type, onActivity, { passive: true });
+    });
+
+    connect();
+    loadAddonIssues();
+    setInterval(loadAddonIssues, 30000);
+});
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/audit"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/config"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jobs"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/oplock"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/rollback"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/trash"
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/worlds"
+)
+
+// CreateWorldRequest is the body of a request to create a world from a template.
+type CreateWorldRequest struct {
+	Template string `json:"template"`
+	Name     string `json:"name"`
+	Activate bool   `json:"activate"` // Set level-name so the world is loaded on the next restart
+}
+
+// handleTemplates lists the world templates in the catalog.
+func (s *Server) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	templates, err := s.templates.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(templates)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// handleTemplatesFetch downloads the configured template URLs that are not
+// in the catalog yet.
+func (s *Server) handleTemplatesFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var added []string
+
+	err := s.jobs.Run(r.Context(), "download", "world templates", actor(r),
+		func(ctx context.Context, h *jobs.Handle) error {
+			var err error
+
+			added, err = s.templates.Fetch(ctx)
+			for _, name := range added {
+				h.Logf("added template %s", name)
+			}
+
+			return err
+		})
+
+	result := struct {
+		Added []string `json:"added"`
+		Error string   `json:"error,omitempty"`
+	}{
+		Added: added,
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
+
+// handleWorlds creates a world from a template (POST) or deletes the world
+// in ?name= (DELETE).
+func (s *Server) handleWorlds(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.handleCreateWorld(w, r)
+	case http.MethodDelete:
+		s.handleDeleteWorld(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCreateWorld creates a new world from a template.
+func (s *Server) handleCreateWorld(w http.ResponseWriter, r *http.Request) {
+	var req CreateWorldRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	release, err := s.acquire(r.Context(), nil, r, oplock.WorldCreate)
+	if err != nil {
+		lockError(w, err)
+		return
+	}
+	defer release()
+
+	// Activating the world replaces the running one
+	if req.Activate {
+		err = s.takeRollbackPoint(r.Context(), nil, rollback.ReasonWorldImport,
+			fmt.Sprintf("world %s from template %s", req.Name, req.Template), actor(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = s.templates.CreateWorld(s.appDir, req.Template, req.Name)
+
+	switch {
+	case errors.Is(err, worlds.ErrInvalidName):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, worlds.ErrTemplateNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, worlds.ErrWorldExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.Activate {
+		err = config.EnsureProperties(s.appDir, map[string]string{"level-name": req.Name})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleDeleteWorld moves a world other than the active one to the trash,
+// from where it can be put back until it expires.
+func (s *Server) handleDeleteWorld(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if !worlds.ValidName(name) {
+		http.Error(w, worlds.ErrInvalidName.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if name == s.levelName() {
+		http.Error(w, fmt.Sprintf("World %s is the active world", name), http.StatusConflict)
+		return
+	}
+
+	rel := filepath.Join("worlds", name)
+
+	info, err := os.Stat(filepath.Join(s.appDir, rel))
+	if err != nil || !info.IsDir() {
+		http.Error(w, fmt.Sprintf("World %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	release, err := s.acquire(r.Context(), nil, r, oplock.Delete)
+	if err != nil {
+		lockError(w, err)
+		return
+	}
+	defer release()
+
+	item, err := s.discard(trash.Item{
+		Kind:    trash.KindWorld,
+		Name:    name,
+		Actor:   actor(r),
+		Entries: []trash.Entry{{Path: rel}},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.audit.Record(audit.Entry{
+		Actor:  actor(r),
+		Action: "world.delete",
+		Target: name,
+	})
+	if err != nil {
+		fmt.Printf("Error recording world deletion: %v\n", err)
+	}
+
+	err = json.NewEncoder(w).Encode(item)
+	if err != nil {
+		fmt.Printf("Error sending JSON response: %v\n", err)
+	}
+}
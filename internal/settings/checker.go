@@ -0,0 +1,174 @@
+package settings
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Problem is a setting that failed a check.
+type Problem struct {
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Path + " " + p.Message
+}
+
+// Errors lists every problem found, so all of them can be fixed at once.
+type Errors []Problem
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, p := range e {
+		lines[i] = p.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Checker collects problems with settings.
+type Checker struct {
+	problems Errors
+}
+
+// Add records a problem with the setting at path.
+func (c *Checker) Add(path, format string, args ...any) {
+	c.problems = append(c.problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns the problems found as Errors, nil if there are none.
+func (c *Checker) Err() error {
+	if len(c.problems) == 0 {
+		return nil
+	}
+
+	return c.problems
+}
+
+// Invalid records err, from parsing the setting at path, as a problem.
+func (c *Checker) Invalid(path string, err error) bool {
+	if err == nil {
+		return true
+	}
+
+	c.Add(path, "is invalid: %v", err)
+
+	return false
+}
+
+// Required checks that value isn't empty.
+func (c *Checker) Required(path, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		c.Add(path, "is required")
+		return false
+	}
+
+	return true
+}
+
+// URL checks that value, if set, is a URL with a host and one of schemes.
+func (c *Checker) URL(path, value string, schemes ...string) bool {
+	if value == "" {
+		return true
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || !slices.Contains(schemes, u.Scheme) {
+		c.Add(path, "must start with %s", joinOr(schemes, "://"))
+		return false
+	}
+
+	if u.Host == "" {
+		c.Add(path, "must include a host")
+		return false
+	}
+
+	return true
+}
+
+// Duration checks that value, if set, is a duration of at least min, as
+// time.ParseDuration reads them.
+func (c *Checker) Duration(path, value string, min time.Duration) bool {
+	if value == "" {
+		return true
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		c.Add(path, "must be a duration such as 30s or 5m, got %q", value)
+		return false
+	}
+
+	if d < min {
+		c.Add(path, "must be at least %s, got %s", min, value)
+		return false
+	}
+
+	return true
+}
+
+// Range checks that value is between min and max, inclusive.
+func (c *Checker) Range(path string, value, min, max int) bool {
+	if value < min || value > max {
+		c.Add(path, "must be between %d and %d, got %d", min, max, value)
+		return false
+	}
+
+	return true
+}
+
+// NotNegative checks that value isn't below zero.
+func (c *Checker) NotNegative(path string, value float64) bool {
+	if value < 0 {
+		c.Add(path, "must not be negative, got %v", value)
+		return false
+	}
+
+	return true
+}
+
+// OneOf checks that value, if set, is one of values.
+func (c *Checker) OneOf(path, value string, values ...string) bool {
+	if value == "" || slices.Contains(values, value) {
+		return true
+	}
+
+	c.Add(path, "must be %s, got %q", joinOr(values, ""), value)
+
+	return false
+}
+
+// Unique checks that value wasn't seen before at another path, recording
+// it in seen.
+func (c *Checker) Unique(path, value string, seen map[string]string) bool {
+	if value == "" {
+		return true
+	}
+
+	if other, ok := seen[value]; ok {
+		c.Add(path, "%q is already used by %s", value, other)
+		return false
+	}
+
+	seen[value] = path
+
+	return true
+}
+
+// joinOr lists values as "a, b or c", each with suffix.
+func joinOr(values []string, suffix string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = v + suffix
+	}
+
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
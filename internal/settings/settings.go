@@ -0,0 +1,266 @@
+// Package settings resolves the effective configuration of the wrapper and
+// the central server from flags, environment variables and config files,
+// checks it with messages naming the offending setting, and prints where
+// each value came from.
+package settings
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Source is where a setting's value came from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFlag    Source = "flag"
+	SourceEnv     Source = "env"
+	SourceFile    Source = "file"
+)
+
+// masked replaces secret values in the table.
+const masked = "********"
+
+// Setting is a resolved value and where it came from.
+type Setting struct {
+	Name   string
+	Value  string
+	Source Source
+	Origin string // Environment variable or file of the value, if any
+	Secret bool   // Masked in the table
+}
+
+// Flags sets the flags not given on the command line from the environment
+// variables mapped to them, then returns every flag with its source. Call
+// it after fs.Parse. Values the flags reject are reported by variable.
+func Flags(fs *flag.FlagSet, env map[string]string, lookup func(string) (string, bool),
+	secret ...string) ([]Setting, error) {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	origin := map[string]string{}
+
+	var c Checker
+
+	// Sorted so the problems come in a stable order
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		flagName := env[name]
+		if given[flagName] {
+			continue
+		}
+
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			continue
+		}
+
+		err := fs.Set(flagName, value)
+		if err != nil {
+			c.Add(name, "must be %s for -%s, got %q", expected(fs.Lookup(flagName)), flagName, value)
+			continue
+		}
+
+		origin[flagName] = name
+	}
+
+	var settings []Setting
+
+	fs.VisitAll(func(f *flag.Flag) {
+		s := Setting{Name: f.Name, Value: f.Value.String(), Source: SourceDefault, Secret: slices.Contains(secret, f.Name)}
+
+		switch {
+		case given[f.Name]:
+			s.Source = SourceFlag
+		case origin[f.Name] != "":
+			s.Source, s.Origin = SourceEnv, origin[f.Name]
+		}
+
+		settings = append(settings, s)
+	})
+
+	return settings, c.Err()
+}
+
+// expected describes the values a flag takes, for messages about values
+// it rejected.
+func expected(f *flag.Flag) string {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return "a valid value"
+	}
+
+	switch getter.Get().(type) {
+	case bool:
+		return "true or false"
+	case time.Duration:
+		return "a duration such as 30s or 5m"
+	case int, int64, uint, uint64:
+		return "a whole number"
+	case float64:
+		return "a number"
+	default:
+		return "a valid value"
+	}
+}
+
+// File flattens a config as loaded from a file into dotted settings such as
+// wrappers[0].address. Values present in raw, the file's JSON, come from the
+// file; the rest are defaults. Settings named in secret, by their last
+// part, are masked.
+func File(config any, raw []byte, origin string, secret ...string) ([]Setting, error) {
+	effective, err := toTree(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var present any
+
+	err = json.Unmarshal(raw, &present)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", origin, err)
+	}
+
+	var settings []Setting
+
+	var walk func(path string, value, file any)
+	walk = func(path string, value, file any) {
+		switch v := value.(type) {
+		case map[string]any:
+			fileMap, _ := file.(map[string]any)
+
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				walk(join(path, key), v[key], fileMap[key])
+			}
+		case []any:
+			fileList, _ := file.([]any)
+
+			for i, item := range v {
+				var child any
+				if i < len(fileList) {
+					child = fileList[i]
+				}
+
+				walk(path+"["+strconv.Itoa(i)+"]", item, child)
+			}
+		default:
+			s := Setting{Name: path, Value: scalar(v), Source: SourceDefault, Secret: slices.Contains(secret, lastPart(path))}
+			if file != nil {
+				s.Source, s.Origin = SourceFile, origin
+			}
+
+			settings = append(settings, s)
+		}
+	}
+
+	walk("", effective, present)
+
+	return settings, nil
+}
+
+// Override replaces the value and source of a setting, adding it if
+// missing.
+func Override(settings []Setting, s Setting) []Setting {
+	i := slices.IndexFunc(settings, func(existing Setting) bool { return existing.Name == s.Name })
+	if i < 0 {
+		return append(settings, s)
+	}
+
+	s.Secret = s.Secret || settings[i].Secret
+	settings[i] = s
+
+	return settings
+}
+
+// Print writes the settings as a table of names, values and sources.
+func Print(w io.Writer, settings []Setting) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+
+	for _, s := range settings {
+		value := s.Value
+		if s.Secret && value != "" {
+			value = masked
+		}
+
+		if value == "" {
+			value = `""`
+		}
+
+		source := string(s.Source)
+		if s.Origin != "" {
+			source += " (" + s.Origin + ")"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Name, oneLine(value), source)
+	}
+
+	_ = tw.Flush()
+}
+
+// toTree converts a config to the generic form JSON decodes into.
+func toTree(config any) (any, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding config: %w", err)
+	}
+
+	var tree any
+
+	err = json.Unmarshal(data, &tree)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding config: %w", err)
+	}
+
+	return tree, nil
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// lastPart returns the field name at the end of a dotted path.
+func lastPart(path string) string {
+	path = path[strings.LastIndex(path, ".")+1:]
+	if i := strings.IndexByte(path, '['); i >= 0 {
+		path = path[:i]
+	}
+
+	return path
+}
+
+func scalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// oneLine keeps long or multi-line values, such as policies, from breaking
+// the table.
+func oneLine(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > 80 {
+		s = s[:77] + "..."
+	}
+
+	return s
+}
@@ -0,0 +1,250 @@
+package settings
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("listen", ":8080", "")
+	fs.String("auth-key", "", "")
+	fs.Duration("wait", time.Second, "")
+	fs.Int("nice", 0, "")
+
+	return fs
+}
+
+func lookupIn(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func find(settings []Setting, name string) Setting {
+	for _, s := range settings {
+		if s.Name == name {
+			return s
+		}
+	}
+
+	return Setting{}
+}
+
+func TestFlags_Sources(t *testing.T) {
+	fs := newFlagSet()
+
+	err := fs.Parse([]string{"-listen", ":9000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envFlags := map[string]string{"LISTEN_ADDRESS": "listen", "AUTH_KEY": "auth-key", "WAIT": "wait"}
+	env := map[string]string{"LISTEN_ADDRESS": ":7000", "AUTH_KEY": "secret", "WAIT": ""}
+
+	settings, err := Flags(fs, envFlags, lookupIn(env), "auth-key")
+	if err != nil {
+		t.Fatalf("Flags failed: %v", err)
+	}
+
+	if s := find(settings, "listen"); s.Value != ":9000" || s.Source != SourceFlag {
+		t.Errorf("The command line should win over the environment, got %+v", s)
+	}
+
+	if s := find(settings, "auth-key"); s.Value != "secret" || s.Source != SourceEnv || s.Origin != "AUTH_KEY" ||
+		!s.Secret {
+		t.Errorf("Unexpected auth-key %+v", s)
+	}
+
+	if s := find(settings, "wait"); s.Value != "1s" || s.Source != SourceDefault {
+		t.Errorf("An empty variable should leave the default, got %+v", s)
+	}
+}
+
+func TestFlags_InvalidEnv(t *testing.T) {
+	fs := newFlagSet()
+
+	err := fs.Parse(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envFlags := map[string]string{"WAIT": "wait", "NICE": "nice"}
+	env := map[string]string{"WAIT": "soon", "NICE": "low"}
+
+	_, err = Flags(fs, envFlags, lookupIn(env))
+
+	var problems Errors
+	if !errors.As(err, &problems) || len(problems) != 2 {
+		t.Fatalf("Expected two problems, got %v", err)
+	}
+
+	want := []string{
+		`NICE must be a whole number for -nice, got "low"`,
+		`WAIT must be a duration such as 30s or 5m for -wait, got "soon"`,
+	}
+
+	for i, p := range problems {
+		if p.String() != want[i] {
+			t.Errorf("Problem %d is %q, want %q", i, p, want[i])
+		}
+	}
+}
+
+type testWrapper struct {
+	ID        string `json:"id"`
+	Address   string `json:"address"`
+	SharedKey string `json:"shared_key"`
+	Relay     bool   `json:"relay,omitempty"`
+}
+
+type testConfig struct {
+	DataDir  string            `json:"data_dir,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Wrappers []testWrapper     `json:"wrappers"`
+}
+
+func TestFile(t *testing.T) {
+	raw := []byte(`{"wrappers": [{"id": "s1", "address": "ws://a/ws", "shared_key": "k"}]}`)
+
+	config := testConfig{DataDir: "data", Wrappers: []testWrapper{{ID: "s1", Address: "ws://a/ws", SharedKey: "k"}}}
+
+	settings, err := File(config, raw, "config.json", "shared_key")
+	if err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+
+	if s := find(settings, "data_dir"); s.Value != "data" || s.Source != SourceDefault {
+		t.Errorf("Unexpected data_dir %+v", s)
+	}
+
+	if s := find(settings, "wrappers[0].address"); s.Value != "ws://a/ws" || s.Source != SourceFile ||
+		s.Origin != "config.json" {
+		t.Errorf("Unexpected address %+v", s)
+	}
+
+	if s := find(settings, "wrappers[0].shared_key"); !s.Secret {
+		t.Errorf("The shared key should be secret, got %+v", s)
+	}
+
+	settings = Override(settings, Setting{Name: "data_dir", Value: "/srv", Source: SourceEnv, Origin: "DATA_DIR"})
+
+	if s := find(settings, "data_dir"); s.Value != "/srv" || s.Source != SourceEnv {
+		t.Errorf("Override not applied, got %+v", s)
+	}
+}
+
+func TestPrint_MasksSecrets(t *testing.T) {
+	var buf bytes.Buffer
+
+	Print(&buf, []Setting{
+		{Name: "auth-key", Value: "hunter2", Source: SourceEnv, Origin: "AUTH_KEY", Secret: true},
+		{Name: "listen", Value: "", Source: SourceDefault},
+	})
+
+	out := buf.String()
+
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, masked) {
+		t.Errorf("Secret not masked:\n%s", out)
+	}
+
+	if !strings.Contains(out, "env (AUTH_KEY)") || !strings.Contains(out, `""`) {
+		t.Errorf("Unexpected table:\n%s", out)
+	}
+}
+
+func TestChecker(t *testing.T) {
+	var c Checker
+
+	c.URL("wrappers[2].address", "localhost:8080", "ws", "wss")
+	c.URL("wrappers[3].address", "ws://", "ws", "wss")
+	c.URL("relay", "", "ws", "wss")
+	c.Duration("keepalive.pong_wait", "1m", 0)
+	c.Duration("idle_timeout", "-5s", 0)
+	c.Required("users[0].key", " ")
+	c.Range("nice", 20, -20, 19)
+	c.OneOf("access", "admin", "view", "operate")
+
+	seen := map[string]string{}
+	c.Unique("wrappers[0].id", "s1", seen)
+	c.Unique("wrappers[1].id", "s1", seen)
+
+	c.Invalid("timezone", errors.New("unknown timezone"))
+	c.Invalid("keepalive", nil)
+
+	want := []string{
+		"wrappers[2].address must start with ws:// or wss://",
+		"wrappers[3].address must include a host",
+		"idle_timeout must be at least 0s, got -5s",
+		"users[0].key is required",
+		"nice must be between -20 and 19, got 20",
+		`access must be view or operate, got "admin"`,
+		`wrappers[1].id "s1" is already used by wrappers[0].id`,
+		"timezone is invalid: unknown timezone",
+	}
+
+	var problems Errors
+	if !errors.As(c.Err(), &problems) {
+		t.Fatalf("Expected problems, got %v", c.Err())
+	}
+
+	if len(problems) != len(want) {
+		t.Fatalf("Expected %d problems, got:\n%v", len(want), problems)
+	}
+
+	for i, p := range problems {
+		if p.String() != want[i] {
+			t.Errorf("Problem %d is %q, want %q", i, p, want[i])
+		}
+	}
+}
+
+func TestChecker_NoProblems(t *testing.T) {
+	var c Checker
+
+	c.Required("id", "s1")
+	c.URL("address", "wss://example.com/ws", "ws", "wss")
+
+	err := c.Err()
+	if err != nil {
+		t.Errorf("Expected no problems, got %v", err)
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	raw := []byte(`{
+		"data_dir": "data",
+		"datadir": "typo",
+		"headers": {"Authorization": "Bearer x"},
+		"wrappers": [{"id": "s1", "Address": "ws://a/ws"}, {"id": "s2", "sharedkey": "k"}]
+	}`)
+
+	var c Checker
+
+	c.Unknown(testConfig{}, raw)
+
+	var problems Errors
+	if !errors.As(c.Err(), &problems) {
+		t.Fatalf("Expected problems, got %v", c.Err())
+	}
+
+	want := []string{
+		"datadir is not a known setting",
+		"wrappers[1].sharedkey is not a known setting",
+	}
+
+	if len(problems) != len(want) {
+		t.Fatalf("Expected %d problems, got:\n%v", len(want), problems)
+	}
+
+	for i, p := range problems {
+		if p.String() != want[i] {
+			t.Errorf("Problem %d is %q, want %q", i, p, want[i])
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package settings
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Unknown records the fields of raw, a config file's JSON, that config's
+// type has no field for, which json.Unmarshal would silently drop. Typos
+// such as "sharedkey" would otherwise leave the setting at its default.
+func (c *Checker) Unknown(config any, raw []byte) {
+	var tree any
+
+	err := json.Unmarshal(raw, &tree)
+	if err != nil {
+		return
+	}
+
+	c.unknown("", reflect.TypeOf(config), tree)
+}
+
+func (c *Checker) unknown(path string, t reflect.Type, value any) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				field, ok := lookupField(fields, key)
+				if !ok {
+					c.Add(join(path, key), "is not a known setting")
+					continue
+				}
+
+				c.unknown(join(path, key), field, v[key])
+			}
+		case reflect.Map:
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				c.unknown(join(path, key), t.Elem(), v[key])
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, child := range v {
+				c.unknown(path+"["+strconv.Itoa(i)+"]", t.Elem(), child)
+			}
+		}
+	}
+}
+
+// jsonFields returns the types of a struct's fields by their JSON names,
+// including those of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for key, field := range jsonFields(f.Type) {
+				fields[key] = field
+			}
+
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields[name] = f.Type
+	}
+
+	return fields
+}
+
+// lookupField finds a field the way json.Unmarshal does, preferring an
+// exact match over a case-insensitive one.
+func lookupField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if field, ok := fields[key]; ok {
+		return field, true
+	}
+
+	for name, field := range fields {
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+
+	return nil, false
+}
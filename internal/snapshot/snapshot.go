@@ -0,0 +1,160 @@
+// Package snapshot archives and restores the state of a Bedrock server: its
+// worlds and configuration files.
+package snapshot
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/downloader"
+)
+
+// Paths are the files and directories, relative to the app directory, that
+// make up a server's state. Missing entries are skipped.
+var Paths = []string{
+	"worlds",
+	"server.properties",
+	"allowlist.json",
+	"permissions.json",
+}
+
+// Write writes a zip archive of the server state in appDir to w, along with
+// any extra paths, such as pack directories.
+func Write(appDir string, w io.Writer, extra ...string) error {
+	return WritePaths(appDir, w, append(slices.Clone(Paths), extra...)...)
+}
+
+// WritePaths writes a zip archive of the given paths in appDir to w.
+func WritePaths(appDir string, w io.Writer, paths ...string) error {
+	zw := zip.NewWriter(w)
+
+	for _, path := range paths {
+		err := addPath(zw, appDir, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		return fmt.Errorf("error finishing snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// addPath adds a file or directory tree to the archive.
+func addPath(zw *zip.Writer, appDir, path string) error {
+	root := filepath.Join(appDir, path)
+
+	err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == root {
+				return nil
+			}
+
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(appDir, file)
+		if err != nil {
+			return err
+		}
+
+		return addFile(zw, file, filepath.ToSlash(rel))
+	})
+	if err != nil {
+		return fmt.Errorf("error adding %s to snapshot: %w", path, err)
+	}
+
+	return nil
+}
+
+// addFile copies a single file into the archive.
+func addFile(zw *zip.Writer, file, name string) error {
+	src, err := os.Open(file) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+
+	header.Name = name
+	header.Method = zip.Deflate
+
+	dest, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dest, src)
+
+	return err
+}
+
+// Restore extracts a snapshot read from r into appDir, replacing the files
+// it contains.
+func Restore(appDir string, r io.Reader) error {
+	tmpFile, err := os.CreateTemp("", "snapshot-*.zip")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = io.Copy(tmpFile, r)
+	if err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("failed to receive snapshot: %w", err)
+	}
+
+	err = tmpFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	return downloader.Extract(tmpFile.Name(), appDir)
+}
+
+// Verify reads every file of the snapshot at path back, which checks their
+// CRC-32, and returns the number of files.
+func Verify(path string) (int, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+
+	return len(zr.File), nil
+}
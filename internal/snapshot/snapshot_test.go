@@ -0,0 +1,111 @@
+package snapshot
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteRestore(t *testing.T) {
+	source := t.TempDir()
+
+	files := map[string]string{
+		"server.properties":               "level-name=Bedrock level\n",
+		"worlds/Bedrock level/level.dat":  "level",
+		"worlds/Bedrock level/db/CURRENT": "MANIFEST-000001\n",
+		"behavior_packs/addon/pack.json":  "addon",
+		"bedrock_server":                  "not part of the snapshot",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(source, filepath.FromSlash(name))
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		err = os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	err := Write(source, &buf, "behavior_packs/addon")
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	dest := t.TempDir()
+
+	err = Restore(dest, &buf)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "worlds", "Bedrock level", "db", "CURRENT"))
+	if err != nil || string(data) != "MANIFEST-000001\n" {
+		t.Errorf("Expected world files to be restored, got %q, %v", data, err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dest, "server.properties"))
+	if err != nil || string(data) != files["server.properties"] {
+		t.Errorf("Expected server.properties to be restored, got %q, %v", data, err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dest, "behavior_packs", "addon", "pack.json"))
+	if err != nil || string(data) != "addon" {
+		t.Errorf("Expected extra paths to be restored, got %q, %v", data, err)
+	}
+
+	_, err = os.Stat(filepath.Join(dest, "bedrock_server"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected files outside the snapshot paths to be skipped, got %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	source := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(source, "server.properties"), []byte("level-name=Bedrock level\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	var buf bytes.Buffer
+
+	err = Write(source, &buf)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.zip")
+
+	err = os.WriteFile(path, buf.Bytes(), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+
+	files, err := Verify(path)
+	if err != nil || files != 1 {
+		t.Errorf("Expected 1 file to verify, got %d, %v", files, err)
+	}
+
+	// Flip a byte of the stored file's contents
+	data := buf.Bytes()
+	i := bytes.Index(data, []byte("level-name"))
+	data[i] ^= 0xff
+
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+
+	_, err = Verify(path)
+	if err == nil {
+		t.Error("Expected a corrupt snapshot to fail verification")
+	}
+}
@@ -0,0 +1,191 @@
+// Package timeline records significant events across the fleet, such as
+// servers starting, stopping and crashing, upgrades, backups, alerts and
+// commands sent by administrators, so what happened to all servers over a
+// week can be read in one place.
+package timeline
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// Event types.
+const (
+	TypeStart   = "start"   // The server started
+	TypeStop    = "stop"    // The server was told to stop
+	TypeCrash   = "crash"   // The server went down without being told to
+	TypeUpgrade = "upgrade" // The server or its wrapper came back on a new version
+	TypeBackup  = "backup"  // A backup was saved
+	TypeAlert   = "alert"   // An alert of the wrapper or the central server
+	TypeCommand = "command" // A console command sent by a user
+)
+
+// Types lists the event types.
+var Types = []string{TypeStart, TypeStop, TypeCrash, TypeUpgrade, TypeBackup, TypeAlert, TypeCommand}
+
+const (
+	// retention is how long events are kept.
+	retention = 90 * 24 * time.Hour
+
+	// maxEvents caps the events kept, dropping the oldest, so a noisy
+	// server can't grow the file without bound.
+	maxEvents = 50000
+)
+
+// Event is something that happened on a server.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Wrapper  string    `json:"wrapper"` // ID
+	Name     string    `json:"name,omitempty"`
+	Actor    string    `json:"actor,omitempty"`    // Who caused it, if known
+	Severity string    `json:"severity,omitempty"` // Of alerts
+	Text     string    `json:"text"`
+}
+
+// Filter selects events. Zero fields select everything.
+type Filter struct {
+	From     time.Time
+	To       time.Time
+	Types    []string
+	Wrappers []string // IDs
+	Actor    string
+	Query    string // Case-insensitive text the event mentions
+	Limit    int    // Newest events returned at most
+}
+
+// Match reports whether an event is selected by the filter.
+func (f Filter) Match(e Event) bool {
+	if (!f.From.IsZero() && e.Time.Before(f.From)) || (!f.To.IsZero() && e.Time.After(f.To)) {
+		return false
+	}
+
+	if len(f.Types) > 0 && !slices.Contains(f.Types, e.Type) {
+		return false
+	}
+
+	if len(f.Wrappers) > 0 && !slices.Contains(f.Wrappers, e.Wrapper) {
+		return false
+	}
+
+	if f.Actor != "" && !strings.EqualFold(f.Actor, e.Actor) {
+		return false
+	}
+
+	if f.Query != "" {
+		q := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(e.Text), q) && !strings.Contains(strings.ToLower(e.Name), q) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Store records events and persists them to a JSON file.
+type Store struct {
+	path   string
+	mu     sync.RWMutex
+	events []Event // Oldest first
+}
+
+// Open loads the store from path, starting empty if the file doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+
+	err := jsonfile.Load(path, &s.events)
+	if err != nil {
+		return nil, fmt.Errorf("error loading timeline: %w", err)
+	}
+
+	return s, nil
+}
+
+// save writes the events out, under the lock.
+func (s *Store) save() {
+	if s.path == "" {
+		return
+	}
+
+	err := jsonfile.SaveCompact(s.path, s.events)
+	if err != nil {
+		fmt.Printf("Error saving timeline: %v\n", err)
+	}
+}
+
+// Record adds an event, at the current time unless it has one. Events are
+// kept in time order, so one recorded late still lands in its place. An
+// event already recorded at the same time is skipped, such as a console
+// line a wrapper sends again to a restarted central server.
+func (s *Store) Record(e Event) {
+	if s == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	e.Time = e.Time.UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := len(s.events)
+	for i > 0 && s.events[i-1].Time.After(e.Time) {
+		i--
+	}
+
+	for j := i - 1; j >= 0 && s.events[j].Time.Equal(e.Time); j-- {
+		if s.events[j] == e {
+			return
+		}
+	}
+
+	s.events = slices.Insert(s.events, i, e)
+
+	s.prune(time.Now())
+	s.save()
+}
+
+// prune drops events past the retention window, and the oldest over
+// maxEvents. The caller must hold the lock.
+func (s *Store) prune(now time.Time) {
+	cutoff := now.Add(-retention)
+
+	i := 0
+	for i < len(s.events) && s.events[i].Time.Before(cutoff) {
+		i++
+	}
+
+	i = max(i, len(s.events)-maxEvents)
+
+	if i > 0 {
+		s.events = slices.Delete(s.events, 0, i)
+	}
+}
+
+// List returns the events selected by a filter, newest first.
+func (s *Store) List(f Filter) []Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []Event{}
+
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if f.Limit > 0 && len(list) >= f.Limit {
+			break
+		}
+
+		if f.Match(s.events[i]) {
+			list = append(list, s.events[i])
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,67 @@
+package timeline
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	now := time.Now()
+	e := Event{Time: now, Type: TypeCommand, Wrapper: "w1", Name: "Survival", Actor: "alice", Text: "gamerule pvp false"}
+
+	for _, c := range []struct {
+		filter Filter
+		match  bool
+	}{
+		{Filter{}, true},
+		{Filter{From: now.Add(-time.Hour), To: now.Add(time.Hour)}, true},
+		{Filter{From: now.Add(time.Minute)}, false},
+		{Filter{To: now.Add(-time.Minute)}, false},
+		{Filter{Types: []string{TypeCommand, TypeAlert}}, true},
+		{Filter{Types: []string{TypeCrash}}, false},
+		{Filter{Wrappers: []string{"w2"}}, false},
+		{Filter{Actor: "Alice"}, true},
+		{Filter{Actor: "bob"}, false},
+		{Filter{Query: "PVP"}, true},
+		{Filter{Query: "survival"}, true},
+		{Filter{Query: "difficulty"}, false},
+	} {
+		if got := c.filter.Match(e); got != c.match {
+			t.Errorf("Match(%+v) = %v, want %v", c.filter, got, c.match)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timeline.json")
+	now := time.Now().UTC()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	s.Record(Event{Time: now.Add(-2 * time.Hour), Type: TypeStart, Wrapper: "w1", Text: "Server started"})
+	s.Record(Event{Time: now, Type: TypeBackup, Wrapper: "w2", Text: "w2/backup.zip"})
+	s.Record(Event{Time: now.Add(-time.Hour), Type: TypeCrash, Wrapper: "w1", Text: "Server went down"})
+	s.Record(Event{Time: now.Add(-2 * time.Hour), Type: TypeStart, Wrapper: "w1", Text: "Server started"})
+	s.Record(Event{Time: now.Add(-retention - time.Hour), Type: TypeStop, Wrapper: "w1", Text: "Expired"})
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	list := s.List(Filter{})
+	if len(list) != 3 || list[0].Type != TypeBackup || list[1].Type != TypeCrash || list[2].Type != TypeStart {
+		t.Fatalf("Expected the kept events newest first, got %+v", list)
+	}
+
+	if list := s.List(Filter{Wrappers: []string{"w1"}, Limit: 1}); len(list) != 1 || list[0].Type != TypeCrash {
+		t.Errorf("Expected the newest event of w1, got %+v", list)
+	}
+
+	var missing *Store
+	missing.Record(Event{Type: TypeAlert}) // A disabled timeline records nothing
+}
@@ -0,0 +1,63 @@
+// Package timezone loads the timezone schedules and host sessions are
+// evaluated in, under an IANA name that browsers understand too.
+package timezone
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// Timezones load on hosts without a zoneinfo database too
+	_ "time/tzdata"
+)
+
+var ErrInvalid = errors.New("invalid timezone")
+
+// zoneinfo is where the system timezone database lives, and localtime the
+// link to the system timezone in it.
+var (
+	zoneinfo  = "/usr/share/zoneinfo/"
+	localtime = "/etc/localtime"
+)
+
+// Load returns the timezone with an IANA name such as Europe/Berlin, or the
+// system's if name is empty. The system timezone is named after $TZ or the
+// target of /etc/localtime; if neither names it, it is time.Local, whose
+// name is "Local".
+func Load(name string) (*time.Location, error) {
+	if name == "" {
+		return system(), nil
+	}
+
+	// "Local" means nothing to browsers, which render times in the zone
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalid, name)
+	}
+
+	return loc, nil
+}
+
+// system returns the system timezone, under its IANA name if it has one.
+func system() *time.Location {
+	name := strings.TrimPrefix(os.Getenv("TZ"), ":")
+
+	if name == "" {
+		target, err := filepath.EvalSymlinks(localtime)
+		if err == nil && strings.HasPrefix(target, zoneinfo) {
+			name = strings.TrimPrefix(target, zoneinfo)
+		}
+	}
+
+	if name != "" && name != "Local" {
+		loc, err := time.LoadLocation(name)
+		if err == nil {
+			return loc
+		}
+	}
+
+	return time.Local
+}
@@ -0,0 +1,80 @@
+package timezone
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	loc, err := Load("America/Sao_Paulo")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if loc.String() != "America/Sao_Paulo" {
+		t.Errorf("Expected America/Sao_Paulo, got %s", loc)
+	}
+
+	for _, name := range []string{"Mars/Olympus_Mons", "Local"} {
+		_, err := Load(name)
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %q to be invalid, got %v", name, err)
+		}
+	}
+}
+
+func TestLoadSystem(t *testing.T) {
+	t.Setenv("TZ", "Asia/Tokyo")
+
+	loc, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if loc.String() != "Asia/Tokyo" {
+		t.Errorf("Expected the zone in $TZ, got %s", loc)
+	}
+
+	// Without $TZ, the zone is named after the target of /etc/localtime
+	dir := t.TempDir()
+	zoneinfo, localtime = dir+"/zoneinfo/", filepath.Join(dir, "localtime")
+
+	t.Cleanup(func() {
+		zoneinfo, localtime = "/usr/share/zoneinfo/", "/etc/localtime"
+	})
+
+	target := filepath.Join(dir, "zoneinfo", "Europe", "Berlin")
+
+	err = os.MkdirAll(filepath.Dir(target), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(target, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Symlink(target, localtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TZ", "")
+
+	if loc, _ = Load(""); loc.String() != "Europe/Berlin" {
+		t.Errorf("Expected the zone /etc/localtime links to, got %s", loc)
+	}
+
+	err = os.Remove(localtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loc, _ = Load(""); loc != time.Local {
+		t.Errorf("Expected time.Local for an unnamed system zone, got %s", loc)
+	}
+}
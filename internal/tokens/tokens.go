@@ -0,0 +1,249 @@
+// Package tokens issues scoped API tokens for automation. Only a hash of each
+// token is stored; the token itself is shown once when it is created.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// Scopes.
+const (
+	ScopeReadStatus    = "read-status"
+	ScopeSendCommand   = "send-command"
+	ScopeManageBackups = "manage-backups"
+)
+
+// Scopes lists the valid scopes.
+var Scopes = []string{ScopeReadStatus, ScopeSendCommand, ScopeManageBackups}
+
+// prefix marks tokens issued by this package, which helps secret scanners.
+const prefix = "mcw_"
+
+var (
+	ErrInvalidScope = errors.New("invalid scope")
+	ErrNotFound     = errors.New("token not found")
+)
+
+// Token is an issued API token.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []string  `json:"scopes"`
+	Wrappers  []string  `json:"wrappers,omitempty"` // Wrappers the token is limited to, all if empty
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // Never expires if zero
+	LastUsed  time.Time `json:"last_used,omitempty"`
+
+	LastIP        string `json:"last_ip,omitempty"`
+	LastUserAgent string `json:"last_user_agent,omitempty"`
+}
+
+// Expired reports whether the token has expired at now.
+func (t Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// HasScope reports whether the token was issued with scope.
+func (t Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hash returns the stored form of a token.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes as hex.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Store keeps the issued tokens in a JSON file.
+type Store struct {
+	path   string
+	mu     sync.RWMutex
+	tokens []Token
+	now    func() time.Time
+}
+
+// Open loads the store from path, starting empty if the file doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, now: time.Now}
+
+	err := jsonfile.Load(path, &s.tokens)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tokens: %w", err)
+	}
+
+	return s, nil
+}
+
+// save writes the hashed tokens, under s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	err := jsonfile.Save(s.path, s.tokens)
+	if err != nil {
+		return fmt.Errorf("error saving tokens: %w", err)
+	}
+
+	return nil
+}
+
+// Create issues a token and returns it with its secret, which is not stored.
+func (s *Store) Create(t Token) (Token, string, error) {
+	if len(t.Scopes) == 0 {
+		return Token{}, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+
+	for _, scope := range t.Scopes {
+		valid := false
+
+		for _, known := range Scopes {
+			valid = valid || scope == known
+		}
+
+		if !valid {
+			return Token{}, "", fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+
+	id, err := randomHex(6)
+	if err != nil {
+		return Token{}, "", fmt.Errorf("error generating token: %w", err)
+	}
+
+	random, err := randomHex(24)
+	if err != nil {
+		return Token{}, "", fmt.Errorf("error generating token: %w", err)
+	}
+
+	secret := prefix + id + "_" + random
+
+	t.ID = id
+	t.Hash = hash(secret)
+	t.CreatedAt = s.now().UTC()
+	t.LastUsed = time.Time{}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = append(s.tokens, t)
+
+	err = s.save()
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	return t, secret, nil
+}
+
+// List returns the issued tokens, newest first.
+func (s *Store) List() []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Token, len(s.tokens))
+	copy(list, s.tokens)
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+
+	return list
+}
+
+// Revoke deletes a token.
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range s.tokens {
+		if t.ID == id {
+			s.tokens = append(s.tokens[:i], s.tokens[i+1:]...)
+			return s.save()
+		}
+	}
+
+	return ErrNotFound
+}
+
+// Lookup returns the token for a secret unless it is unknown or expired.
+func (s *Store) Lookup(secret string) (Token, bool) {
+	if !strings.HasPrefix(secret, prefix) {
+		return Token{}, false
+	}
+
+	h := hash(secret)
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.tokens {
+		t := &s.tokens[i]
+		if t.Hash != h || t.Expired(now) {
+			continue
+		}
+
+		// Only persisted occasionally to avoid a write on every request
+		if now.Sub(t.LastUsed) > time.Hour {
+			t.LastUsed = now.UTC()
+
+			err := s.save()
+			if err != nil {
+				fmt.Printf("Error saving token usage: %v\n", err)
+			}
+		} else {
+			t.LastUsed = now.UTC()
+		}
+
+		return *t, true
+	}
+
+	return Token{}, false
+}
+
+// Seen records the client that last used a token. It's saved along with the
+// next usage update.
+func (s *Store) Seen(id, ip, userAgent string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.tokens {
+		if s.tokens[i].ID == id {
+			s.tokens[i].LastIP = ip
+			s.tokens[i].LastUserAgent = userAgent
+
+			return
+		}
+	}
+}
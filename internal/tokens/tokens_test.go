@@ -0,0 +1,79 @@
+package tokens
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	now := time.Date(2024, 6, 14, 9, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	token, secret, err := store.Create(Token{Name: "ci", Scopes: []string{ScopeReadStatus}, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	_, _, err = store.Create(Token{Name: "bad", Scopes: []string{"everything"}})
+	if !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Expected ErrInvalidScope, got %v", err)
+	}
+
+	// Only the hash is stored
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read store: %v", err)
+	}
+
+	if strings.Contains(string(data), secret) || !strings.Contains(string(data), token.Hash) {
+		t.Errorf("Expected only the token hash to be stored")
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	reopened.now = store.now
+
+	found, ok := reopened.Lookup(secret)
+	if !ok || found.ID != token.ID || !found.HasScope(ScopeReadStatus) || found.HasScope(ScopeSendCommand) {
+		t.Errorf("Unexpected lookup result: %+v, %v", found, ok)
+	}
+
+	reopened.Seen(token.ID, "203.0.113.7", "curl/8.0")
+
+	if list := reopened.List(); list[0].LastIP != "203.0.113.7" || list[0].LastUserAgent != "curl/8.0" {
+		t.Errorf("Expected the last client to be recorded, got %+v", list[0])
+	}
+
+	if _, ok := reopened.Lookup(secret + "x"); ok {
+		t.Errorf("Expected an unknown token not to be found")
+	}
+
+	now = now.Add(time.Hour)
+
+	if _, ok := reopened.Lookup(secret); ok {
+		t.Errorf("Expected an expired token not to be found")
+	}
+
+	err = reopened.Revoke(token.ID)
+	if err != nil || len(reopened.List()) != 0 {
+		t.Errorf("Expected the token to be revoked, got %v, %+v", err, reopened.List())
+	}
+
+	if !errors.Is(reopened.Revoke(token.ID), ErrNotFound) {
+		t.Errorf("Expected ErrNotFound revoking twice")
+	}
+}
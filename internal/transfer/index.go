@@ -0,0 +1,127 @@
+package transfer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// Record is a stored file and where it came from.
+type Record struct {
+	Path      string    `json:"path"` // Relative to the directory of the index
+	Wrapper   string    `json:"wrapper"`
+	Name      string    `json:"name,omitempty"` // Of the wrapper when the file was stored
+	World     string    `json:"world,omitempty"`
+	CreatedAt time.Time `json:"created_at"` // When the wrapper took it
+	StoredAt  time.Time `json:"stored_at"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	Verified  bool      `json:"verified"` // Received in chunks checked against the wrapper's manifest
+
+	// Offsite is where the file was copied off-site, if it was
+	Offsite string `json:"offsite,omitempty"`
+}
+
+// Index lists the files stored in a directory with their provenance.
+type Index struct {
+	path    string
+	mu      sync.Mutex
+	records []Record // Oldest first
+}
+
+// OpenIndex loads the index at path, which is created when the first
+// record is added.
+func OpenIndex(path string) (*Index, error) {
+	x := &Index{path: path, records: []Record{}}
+
+	err := jsonfile.Load(path, &x.records)
+	if err != nil {
+		return nil, fmt.Errorf("error loading storage index: %w", err)
+	}
+
+	return x, nil
+}
+
+// Add records a stored file, replacing a record of the same path.
+func (x *Index) Add(r Record) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	kept := x.records[:0]
+
+	for _, old := range x.records {
+		if old.Path != r.Path {
+			kept = append(kept, old)
+		}
+	}
+
+	x.records = append(kept, r)
+
+	sort.SliceStable(x.records, func(i, j int) bool {
+		return x.records[i].StoredAt.Before(x.records[j].StoredAt)
+	})
+
+	return x.save()
+}
+
+// Remove drops the record of the file at path.
+func (x *Index) Remove(path string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	kept := x.records[:0]
+
+	for _, old := range x.records {
+		if old.Path != path {
+			kept = append(kept, old)
+		}
+	}
+
+	x.records = kept
+
+	return x.save()
+}
+
+// save writes the index to disk. The caller must hold the lock.
+func (x *Index) save() error {
+	err := jsonfile.Save(x.path, x.records)
+	if err != nil {
+		return fmt.Errorf("error saving storage index: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the records of a wrapper, or of all wrappers if it's empty,
+// newest first.
+func (x *Index) List(wrapper string) []Record {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	list := []Record{}
+
+	for i := len(x.records) - 1; i >= 0; i-- {
+		if wrapper == "" || x.records[i].Wrapper == wrapper {
+			list = append(list, x.records[i])
+		}
+	}
+
+	return list
+}
+
+// Get returns the record of the file at path.
+func (x *Index) Get(path string) (Record, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, r := range x.records {
+		if r.Path == path {
+			return r, true
+		}
+	}
+
+	return Record{}, false
+}
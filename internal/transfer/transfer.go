@@ -0,0 +1,257 @@
+// Package transfer moves large files, such as snapshots, from a wrapper to
+// the central server in checksummed chunks, so a corrupted chunk is fetched
+// again and an interrupted transfer resumes where it stopped. The whole file
+// is verified with SHA-256 at the end.
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultChunkSize is the size of the chunks a file is verified and
+// fetched in.
+const DefaultChunkSize = 4 << 20
+
+// DefaultAttempts is how often a chunk is fetched before a transfer fails.
+const DefaultAttempts = 5
+
+// retryDelay is the wait before fetching a chunk again, times the attempt.
+const retryDelay = time.Second
+
+var ErrChecksum = errors.New("checksum mismatch")
+
+// Manifest describes a file offered for transfer.
+type Manifest struct {
+	ID        string    `json:"id"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	ChunkSize int64     `json:"chunk_size"`
+	Chunks    []uint32  `json:"chunks"` // Adler-32 of each chunk, the rolling checksum rsync uses
+	World     string    `json:"world,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Describe reads the file at path and returns its size and checksums in
+// chunks of chunkSize, DefaultChunkSize if it isn't positive.
+func Describe(path string, chunkSize int64) (Manifest, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	m := Manifest{ChunkSize: chunkSize, Chunks: []uint32{}}
+
+	f, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	buf := make([]byte, chunkSize)
+
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			m.Chunks = append(m.Chunks, adler32.Checksum(buf[:n]))
+			m.Size += int64(n)
+			sum.Write(buf[:n])
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+
+		if err != nil {
+			return m, fmt.Errorf("error reading %s: %w", path, err)
+		}
+	}
+
+	m.SHA256 = hex.EncodeToString(sum.Sum(nil))
+
+	return m, nil
+}
+
+// Chunk returns the offset and length of chunk i.
+func (m Manifest) Chunk(i int) (int64, int64) {
+	off := int64(i) * m.ChunkSize
+
+	return off, min(m.ChunkSize, m.Size-off)
+}
+
+// Validate checks that the chunk checksums cover the file.
+func (m Manifest) Validate() error {
+	if m.ChunkSize <= 0 || m.Size < 0 {
+		return fmt.Errorf("invalid transfer manifest %s", m.ID)
+	}
+
+	if want := (m.Size + m.ChunkSize - 1) / m.ChunkSize; int64(len(m.Chunks)) != want {
+		return fmt.Errorf("transfer manifest %s has %d chunk checksums, expected %d", m.ID, len(m.Chunks), want)
+	}
+
+	return nil
+}
+
+// Fetcher returns length bytes of the file starting at offset.
+type Fetcher func(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+
+// Receive fetches the file described by m into the partial file part. Chunks
+// already in part that verify are kept, so a transfer interrupted earlier
+// resumes after them. A chunk that fails to fetch or verify is tried again
+// up to attempts times, DefaultAttempts if it isn't positive. progress, if
+// given, is called with the bytes received so far. If the whole file
+// doesn't match its SHA-256, part is emptied and ErrChecksum returned.
+func Receive(ctx context.Context, m Manifest, part string, fetch Fetcher, attempts int,
+	progress func(done, total int64)) error {
+	err := m.Validate()
+	if err != nil {
+		return err
+	}
+
+	if attempts <= 0 {
+		attempts = DefaultAttempts
+	}
+
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0600) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("error opening partial transfer: %w", err)
+	}
+	defer f.Close()
+
+	next, err := resumeAt(f, m)
+	if err != nil {
+		return err
+	}
+
+	for i := next; i < len(m.Chunks); i++ {
+		off, _ := m.Chunk(i)
+
+		if progress != nil {
+			progress(off, m.Size)
+		}
+
+		data, err := fetchChunk(ctx, m, i, fetch, attempts)
+		if err != nil {
+			return err
+		}
+
+		_, err = f.WriteAt(data, off)
+		if err != nil {
+			return fmt.Errorf("error writing chunk %d: %w", i, err)
+		}
+	}
+
+	if progress != nil {
+		progress(m.Size, m.Size)
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("error verifying transfer: %w", err)
+	}
+
+	sum := sha256.New()
+
+	_, err = io.Copy(sum, f)
+	if err != nil {
+		return fmt.Errorf("error verifying transfer: %w", err)
+	}
+
+	if got := hex.EncodeToString(sum.Sum(nil)); got != m.SHA256 {
+		_ = f.Truncate(0)
+		return fmt.Errorf("%w: SHA-256 of %s is %s, expected %s", ErrChecksum, m.ID, got, m.SHA256)
+	}
+
+	return f.Sync()
+}
+
+// resumeAt returns the first chunk of the partial file that is missing or
+// doesn't verify, truncating the file there.
+func resumeAt(f *os.File, m Manifest) (int, error) {
+	buf := make([]byte, m.ChunkSize)
+
+	i := 0
+
+	for ; i < len(m.Chunks); i++ {
+		off, n := m.Chunk(i)
+
+		read, err := f.ReadAt(buf[:n], off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("error reading partial transfer: %w", err)
+		}
+
+		if int64(read) < n || adler32.Checksum(buf[:n]) != m.Chunks[i] {
+			break
+		}
+	}
+
+	off, _ := m.Chunk(i)
+
+	err := f.Truncate(off)
+	if err != nil {
+		return 0, fmt.Errorf("error truncating partial transfer: %w", err)
+	}
+
+	return i, nil
+}
+
+// fetchChunk fetches chunk i until it verifies or the attempts run out.
+func fetchChunk(ctx context.Context, m Manifest, i int, fetch Fetcher, attempts int) ([]byte, error) {
+	off, n := m.Chunk(i)
+
+	var err error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(time.Duration(attempt-1) * retryDelay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		var data []byte
+
+		data, err = readChunk(ctx, fetch, off, n)
+		if err == nil && adler32.Checksum(data) != m.Chunks[i] {
+			err = fmt.Errorf("%w: chunk %d", ErrChecksum, i)
+		}
+
+		if err == nil {
+			return data, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, fmt.Errorf("error fetching chunk %d after %d attempts: %w", i, attempts, err)
+}
+
+// readChunk fetches n bytes at off.
+func readChunk(ctx context.Context, fetch Fetcher, off, n int64) ([]byte, error) {
+	rc, err := fetch(ctx, off, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, n+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) != n {
+		return nil, fmt.Errorf("received %d bytes at offset %d, expected %d", len(data), off, n)
+	}
+
+	return data, nil
+}
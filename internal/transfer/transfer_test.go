@@ -0,0 +1,194 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// source writes data to a file and returns its manifest.
+func source(t *testing.T, data []byte, chunkSize int64) Manifest {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "snapshot.zip")
+
+	err := os.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+
+	m, err := Describe(path, chunkSize)
+	if err != nil {
+		t.Fatalf("Describe failed: %v", err)
+	}
+
+	m.ID = "test"
+
+	return m
+}
+
+// fetcher serves data, counting requests per offset and corrupting the
+// first response at the offsets in corrupt.
+func fetcher(data []byte, requests map[int64]int, corrupt map[int64]bool) Fetcher {
+	return func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		requests[offset]++
+
+		chunk := bytes.Clone(data[offset : offset+length])
+		if corrupt[offset] && requests[offset] == 1 {
+			chunk[0] ^= 0xff
+		}
+
+		return io.NopCloser(bytes.NewReader(chunk)), nil
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	m := source(t, []byte("0123456789"), 4)
+
+	if m.Size != 10 || len(m.Chunks) != 3 || m.Validate() != nil {
+		t.Fatalf("Expected 3 chunks of 10 bytes, got %+v", m)
+	}
+
+	if off, n := m.Chunk(2); off != 8 || n != 2 {
+		t.Errorf("Expected the last chunk at 8 with 2 bytes, got %d, %d", off, n)
+	}
+}
+
+func TestReceiveRetriesCorruptChunk(t *testing.T) {
+	data := []byte("chunked snapshot archive")
+	m := source(t, data, 5)
+	part := filepath.Join(t.TempDir(), "snapshot.part")
+	requests := map[int64]int{}
+
+	err := Receive(context.Background(), m, part, fetcher(data, requests, map[int64]bool{10: true}), 3, nil)
+	if err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(part)
+	if !bytes.Equal(got, data) {
+		t.Errorf("Expected the file to be received whole, got %q", got)
+	}
+
+	if requests[10] != 2 || requests[0] != 1 {
+		t.Errorf("Expected only the corrupt chunk to be fetched again, got %v", requests)
+	}
+}
+
+func TestReceiveResumes(t *testing.T) {
+	data := []byte("chunked snapshot archive")
+	m := source(t, data, 5)
+	part := filepath.Join(t.TempDir(), "snapshot.part")
+
+	// An earlier transfer stopped in the third chunk
+	err := os.WriteFile(part, data[:12], 0600)
+	if err != nil {
+		t.Fatalf("Failed to write partial file: %v", err)
+	}
+
+	requests := map[int64]int{}
+
+	err = Receive(context.Background(), m, part, fetcher(data, requests, nil), 1, nil)
+	if err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+
+	if requests[0] != 0 || requests[5] != 0 || requests[10] != 1 {
+		t.Errorf("Expected the transfer to resume at the third chunk, got %v", requests)
+	}
+
+	got, _ := os.ReadFile(part)
+	if !bytes.Equal(got, data) {
+		t.Errorf("Expected the file to be received whole, got %q", got)
+	}
+}
+
+func TestReceiveGivesUp(t *testing.T) {
+	data := []byte("chunked snapshot archive")
+	m := source(t, data, 5)
+	part := filepath.Join(t.TempDir(), "snapshot.part")
+
+	fail := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		return nil, errors.New("connection reset")
+	}
+
+	err := Receive(context.Background(), m, part, fail, 1, nil)
+	if err == nil {
+		t.Fatal("Expected the transfer to fail")
+	}
+}
+
+func TestReceiveChecksum(t *testing.T) {
+	data := []byte("chunked snapshot archive")
+	m := source(t, data, 5)
+	m.SHA256 = "0000"
+	part := filepath.Join(t.TempDir(), "snapshot.part")
+
+	err := Receive(context.Background(), m, part, fetcher(data, map[int64]int{}, nil), 1, nil)
+	if !errors.Is(err, ErrChecksum) {
+		t.Fatalf("Expected a checksum error, got %v", err)
+	}
+
+	info, err := os.Stat(part)
+	if err != nil || info.Size() != 0 {
+		t.Errorf("Expected the partial file to be emptied, got %v", err)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+
+	x, err := OpenIndex(path)
+	if err != nil {
+		t.Fatalf("OpenIndex failed: %v", err)
+	}
+
+	now := time.Now().UTC()
+
+	for i, r := range []Record{
+		{Path: "w1/a.zip", Wrapper: "w1", StoredAt: now},
+		{Path: "w2/b.zip", Wrapper: "w2", StoredAt: now.Add(time.Minute)},
+		{Path: "w1/c.zip", Wrapper: "w1", StoredAt: now.Add(2 * time.Minute)},
+	} {
+		err = x.Add(r)
+		if err != nil {
+			t.Fatalf("Add %d failed: %v", i, err)
+		}
+	}
+
+	x, err = OpenIndex(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	list := x.List("w1")
+	if len(list) != 2 || list[0].Path != "w1/c.zip" || list[1].Path != "w1/a.zip" {
+		t.Errorf("Expected the wrapper's records newest first, got %+v", list)
+	}
+
+	if all := x.List(""); len(all) != 3 {
+		t.Errorf("Expected all records, got %+v", all)
+	}
+
+	if r, ok := x.Get("w2/b.zip"); !ok || r.Wrapper != "w2" {
+		t.Errorf("Expected the record of w2/b.zip, got %+v, %v", r, ok)
+	}
+
+	if _, ok := x.Get("w3/d.zip"); ok {
+		t.Error("Expected no record of an unknown path")
+	}
+
+	err = x.Remove("w1/a.zip")
+	if err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	if list := x.List("w1"); len(list) != 1 || list[0].Path != "w1/c.zip" {
+		t.Errorf("Expected the record to be removed, got %+v", list)
+	}
+}
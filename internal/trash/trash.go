@@ -0,0 +1,340 @@
+// Package trash keeps what destructive operations remove from a server, such
+// as a deleted world or the config file a rollback replaces, so it can be put
+// back until it expires and is purged.
+package trash
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// Kinds of trashed items.
+const (
+	KindWorld  = "world"  // Deleted world directory
+	KindPack   = "pack"   // Removed behavior or resource pack
+	KindConfig = "config" // Config file replaced by a rollback
+)
+
+// DefaultTTL is how long trashed items are kept by default.
+const DefaultTTL = 7 * 24 * time.Hour
+
+// indexName is the list of trashed items in the store directory.
+const indexName = "index.json"
+
+var (
+	ErrNotFound = errors.New("trash item not found")
+	ErrConflict = errors.New("restoring would overwrite an existing file")
+)
+
+// Entry is a path of the app directory kept by a trashed item.
+type Entry struct {
+	Path string `json:"path"`           // Relative to the app directory
+	Copy bool   `json:"copy,omitempty"` // Copied before being changed in place, rather than moved out
+}
+
+// Item is what one destructive operation removed.
+type Item struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"` // What was removed, e.g. the world name
+	Actor     string    `json:"actor,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Entries   []Entry   `json:"entries"`
+}
+
+// Store keeps trashed items in a directory until they expire.
+type Store struct {
+	dir   string
+	ttl   time.Duration
+	mu    sync.Mutex
+	items []Item // Oldest first
+}
+
+// Open loads the store in dir, which is created when the first item is
+// trashed. Items expire after ttl, DefaultTTL if it isn't positive.
+func Open(dir string, ttl time.Duration) (*Store, error) {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	s := &Store{dir: dir, ttl: ttl, items: []Item{}}
+
+	err := jsonfile.Load(filepath.Join(dir, indexName), &s.items)
+	if err != nil {
+		return nil, fmt.Errorf("error loading trash: %w", err)
+	}
+
+	return s, nil
+}
+
+// List returns the trashed items, newest first.
+func (s *Store) List() []Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := slices.Clone(s.items)
+	slices.Reverse(items)
+
+	return items
+}
+
+// Get returns a trashed item.
+func (s *Store) Get(id string) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(id)
+	if i < 0 {
+		return Item{}, ErrNotFound
+	}
+
+	return s.items[i], nil
+}
+
+// find returns the index of an item, or -1. The caller must hold the lock.
+func (s *Store) find(id string) int {
+	return slices.IndexFunc(s.items, func(item Item) bool { return item.ID == id })
+}
+
+// Put trashes the entries of item under appDir: files to copy are copied
+// first, then the others are moved out of appDir, which should be on the
+// same filesystem as the store. If anything fails, what was moved is put
+// back.
+func (s *Store) Put(appDir string, item Item) (Item, error) {
+	item.DeletedAt = time.Now().UTC()
+	item.ExpiresAt = item.DeletedAt.Add(s.ttl)
+	item.ID = item.DeletedAt.Format("20060102-150405") + "-" + randomSuffix()
+
+	itemDir := filepath.Join(s.dir, item.ID)
+
+	err := os.MkdirAll(itemDir, 0750)
+	if err != nil {
+		return item, fmt.Errorf("error creating trash directory: %w", err)
+	}
+
+	for _, e := range item.Entries {
+		if !e.Copy {
+			continue
+		}
+
+		err = copyFile(filepath.Join(appDir, e.Path), filepath.Join(itemDir, e.Path))
+		if err != nil {
+			_ = os.RemoveAll(itemDir)
+			return item, fmt.Errorf("error copying %s to the trash: %w", e.Path, err)
+		}
+	}
+
+	var moved []Entry
+
+	for _, e := range item.Entries {
+		if e.Copy {
+			continue
+		}
+
+		err = move(filepath.Join(appDir, e.Path), filepath.Join(itemDir, e.Path))
+		if err != nil {
+			for _, m := range moved {
+				_ = os.Rename(filepath.Join(itemDir, m.Path), filepath.Join(appDir, m.Path))
+			}
+
+			_ = os.RemoveAll(itemDir)
+
+			return item, fmt.Errorf("error moving %s to the trash: %w", e.Path, err)
+		}
+
+		moved = append(moved, e)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items = append(s.items, item)
+
+	return item, s.save()
+}
+
+// Restore puts a trashed item back under appDir and removes it from the
+// trash. Moved entries are never restored over something created since, in
+// which case ErrConflict is returned and nothing changes; copied files
+// replace the current ones.
+func (s *Store) Restore(appDir, id string) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(id)
+	if i < 0 {
+		return Item{}, ErrNotFound
+	}
+
+	item := s.items[i]
+	itemDir := filepath.Join(s.dir, item.ID)
+
+	for _, e := range item.Entries {
+		if e.Copy {
+			continue
+		}
+
+		_, err := os.Lstat(filepath.Join(appDir, e.Path))
+		if err == nil {
+			return item, fmt.Errorf("%w: %s", ErrConflict, e.Path)
+		}
+	}
+
+	for _, e := range item.Entries {
+		var err error
+
+		if e.Copy {
+			err = copyFile(filepath.Join(itemDir, e.Path), filepath.Join(appDir, e.Path))
+		} else {
+			err = move(filepath.Join(itemDir, e.Path), filepath.Join(appDir, e.Path))
+		}
+
+		if err != nil {
+			return item, fmt.Errorf("error restoring %s: %w", e.Path, err)
+		}
+	}
+
+	err := os.RemoveAll(itemDir)
+	if err != nil {
+		fmt.Printf("Error removing restored trash item %s: %v\n", item.ID, err)
+	}
+
+	s.items = slices.Delete(s.items, i, i+1)
+
+	return item, s.save()
+}
+
+// Delete removes a trashed item for good.
+func (s *Store) Delete(id string) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.find(id)
+	if i < 0 {
+		return Item{}, ErrNotFound
+	}
+
+	item := s.items[i]
+
+	err := os.RemoveAll(filepath.Join(s.dir, item.ID))
+	if err != nil {
+		return item, fmt.Errorf("error removing trash item: %w", err)
+	}
+
+	s.items = slices.Delete(s.items, i, i+1)
+
+	return item, s.save()
+}
+
+// Purge removes the items expired at now and returns them.
+func (s *Store) Purge(now time.Time) ([]Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged []Item
+
+	kept := s.items[:0]
+
+	for _, item := range s.items {
+		if now.Before(item.ExpiresAt) {
+			kept = append(kept, item)
+			continue
+		}
+
+		err := os.RemoveAll(filepath.Join(s.dir, item.ID))
+		if err != nil {
+			fmt.Printf("Error purging trash item %s: %v\n", item.ID, err)
+			kept = append(kept, item)
+
+			continue
+		}
+
+		purged = append(purged, item)
+	}
+
+	s.items = kept
+
+	if len(purged) == 0 {
+		return nil, nil
+	}
+
+	return purged, s.save()
+}
+
+// save writes the index. The caller must hold the lock.
+func (s *Store) save() error {
+	sort.Slice(s.items, func(i, j int) bool {
+		return s.items[i].DeletedAt.Before(s.items[j].DeletedAt)
+	})
+
+	err := jsonfile.Save(filepath.Join(s.dir, indexName), s.items)
+	if err != nil {
+		return fmt.Errorf("error saving trash: %w", err)
+	}
+
+	return nil
+}
+
+// move renames src to dst, creating the parent directories of dst.
+func move(src, dst string) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0750)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(src, dst)
+}
+
+// copyFile copies the regular file src to dst through a temporary file, so
+// dst is replaced whole.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	err = os.MkdirAll(filepath.Dir(dst), 0750)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".trash-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Clean up if the rename didn't happen
+
+	_, err = io.Copy(tmp, in)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
+
+// randomSuffix tells apart items trashed in the same second.
+func randomSuffix() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,209 @@
+package trash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFile creates a file under dir with its parent directories.
+func writeFile(t *testing.T, dir, rel, content string) {
+	t.Helper()
+
+	path := filepath.Join(dir, rel)
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	err = os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write %s: %v", rel, err)
+	}
+}
+
+// readFile returns the content of a file under dir, or "" if it's missing.
+func readFile(t *testing.T, dir, rel string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, rel))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to read %s: %v", rel, err)
+	}
+
+	return string(data)
+}
+
+func TestPutRestore(t *testing.T) {
+	appDir := t.TempDir()
+	dir := filepath.Join(appDir, "trash")
+
+	writeFile(t, appDir, "behavior_packs/addon/manifest.json", "manifest")
+	writeFile(t, appDir, "worlds/level/world_behavior_packs.json", "listed")
+
+	store, err := Open(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	item, err := store.Put(appDir, Item{
+		Kind: KindPack,
+		Name: "addon",
+		Entries: []Entry{
+			{Path: "behavior_packs/addon"},
+			{Path: "worlds/level/world_behavior_packs.json", Copy: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(appDir, "behavior_packs", "addon"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected the pack to be moved out, got %v", err)
+	}
+
+	if got := readFile(t, appDir, "worlds/level/world_behavior_packs.json"); got != "listed" {
+		t.Errorf("Expected the copied file to stay, got %q", got)
+	}
+
+	// The caller changes the copied file in place
+	writeFile(t, appDir, "worlds/level/world_behavior_packs.json", "unlisted")
+
+	store, err = Open(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	if items := store.List(); len(items) != 1 || items[0].ID != item.ID {
+		t.Fatalf("Expected the item to be listed, got %+v", items)
+	}
+
+	_, err = store.Restore(appDir, item.ID)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if got := readFile(t, appDir, "behavior_packs/addon/manifest.json"); got != "manifest" {
+		t.Errorf("Expected the pack to be moved back, got %q", got)
+	}
+
+	if got := readFile(t, appDir, "worlds/level/world_behavior_packs.json"); got != "listed" {
+		t.Errorf("Expected the copied file to be restored, got %q", got)
+	}
+
+	_, err = store.Get(item.ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the item to leave the trash, got %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, item.ID))
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected the item directory to be removed, got %v", err)
+	}
+}
+
+func TestRestoreConflict(t *testing.T) {
+	appDir := t.TempDir()
+
+	writeFile(t, appDir, "worlds/level/level.dat", "old")
+
+	store, err := Open(filepath.Join(appDir, "trash"), time.Hour)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	item, err := store.Put(appDir, Item{Kind: KindWorld, Name: "level", Entries: []Entry{{Path: "worlds/level"}}})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// A new world of the same name is never overwritten
+	writeFile(t, appDir, "worlds/level/level.dat", "new")
+
+	_, err = store.Restore(appDir, item.ID)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected a conflict, got %v", err)
+	}
+
+	if got := readFile(t, appDir, "worlds/level/level.dat"); got != "new" {
+		t.Errorf("Expected the new world to be left alone, got %q", got)
+	}
+
+	_, err = store.Get(item.ID)
+	if err != nil {
+		t.Errorf("Expected the item to stay in the trash, got %v", err)
+	}
+}
+
+func TestPutMissing(t *testing.T) {
+	appDir := t.TempDir()
+
+	writeFile(t, appDir, "behavior_packs/addon/manifest.json", "manifest")
+
+	store, err := Open(filepath.Join(appDir, "trash"), time.Hour)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	_, err = store.Put(appDir, Item{
+		Kind:    KindPack,
+		Name:    "addon",
+		Entries: []Entry{{Path: "behavior_packs/addon"}, {Path: "behavior_packs/missing"}},
+	})
+	if err == nil {
+		t.Fatal("Expected an error for a missing path")
+	}
+
+	if got := readFile(t, appDir, "behavior_packs/addon/manifest.json"); got != "manifest" {
+		t.Errorf("Expected the moved pack to be put back, got %q", got)
+	}
+
+	if items := store.List(); len(items) != 0 {
+		t.Errorf("Expected nothing in the trash, got %+v", items)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	appDir := t.TempDir()
+	dir := filepath.Join(appDir, "trash")
+
+	writeFile(t, appDir, "worlds/old/level.dat", "old")
+
+	store, err := Open(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	item, err := store.Put(appDir, Item{Kind: KindWorld, Name: "old", Entries: []Entry{{Path: "worlds/old"}}})
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	purged, err := store.Purge(time.Now())
+	if err != nil || len(purged) != 0 {
+		t.Fatalf("Expected nothing to expire yet, got %+v, %v", purged, err)
+	}
+
+	purged, err = store.Purge(item.ExpiresAt)
+	if err != nil || len(purged) != 1 || purged[0].ID != item.ID {
+		t.Fatalf("Expected the item to be purged, got %+v, %v", purged, err)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, item.ID))
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected the item directory to be removed, got %v", err)
+	}
+
+	store, err = Open(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	if items := store.List(); len(items) != 0 {
+		t.Errorf("Expected the purge to be saved, got %+v", items)
+	}
+}
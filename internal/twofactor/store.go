@@ -0,0 +1,205 @@
+package twofactor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// recoveryCodes is how many recovery codes are issued on enrollment.
+const recoveryCodes = 10
+
+var (
+	ErrNotEnrolled     = errors.New("two-factor authentication is not set up")
+	ErrAlreadyEnrolled = errors.New("two-factor authentication is already enabled")
+	ErrInvalidCode     = errors.New("invalid two-factor code")
+)
+
+// Enrollment is a user's two-factor setup.
+type Enrollment struct {
+	Secret    string    `json:"secret"`
+	Enabled   bool      `json:"enabled"`   // Set once the user confirmed a code
+	Recovery  []string  `json:"recovery"`  // SHA-256 hashes of unused recovery codes
+	LastStep  int64     `json:"last_step"` // Newest accepted time step, against replays
+	EnabledAt time.Time `json:"enabled_at,omitempty"`
+}
+
+// Store keeps the two-factor enrollments of users in a JSON file.
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	users map[string]*Enrollment
+	now   func() time.Time
+}
+
+// Open loads the store from path, starting empty if the file doesn't exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, users: make(map[string]*Enrollment), now: time.Now}
+
+	err := jsonfile.Load(path, &s.users)
+	if err != nil {
+		return nil, fmt.Errorf("error loading two-factor store: %w", err)
+	}
+
+	return s, nil
+}
+
+// save writes the enrolled secrets and recovery codes. s.mu must be held.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	err := jsonfile.Save(s.path, s.users)
+	if err != nil {
+		return fmt.Errorf("error saving two-factor store: %w", err)
+	}
+
+	return nil
+}
+
+// hashCode returns the stored form of a recovery code.
+func hashCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Enabled reports whether the user has confirmed two-factor authentication.
+func (s *Store) Enabled(user string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.users[user]
+
+	return ok && e.Enabled
+}
+
+// Enroll starts enrollment with a new secret, replacing an unconfirmed one.
+func (s *Store) Enroll(user string) (string, error) {
+	secret, err := NewSecret()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.users[user]; ok && e.Enabled {
+		return "", ErrAlreadyEnrolled
+	}
+
+	s.users[user] = &Enrollment{Secret: secret}
+
+	return secret, s.save()
+}
+
+// Confirm enables two-factor authentication once the user proves their app
+// generates valid codes, and returns the recovery codes. Only their hashes
+// are kept, so they can't be shown again.
+func (s *Store) Confirm(user, input string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.users[user]
+	if !ok {
+		return nil, ErrNotEnrolled
+	}
+
+	if e.Enabled {
+		return nil, ErrAlreadyEnrolled
+	}
+
+	matched, ok := Verify(e.Secret, input, s.now(), e.LastStep)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes := make([]string, 0, recoveryCodes)
+	e.Recovery = make([]string, 0, recoveryCodes)
+
+	for i := 0; i < recoveryCodes; i++ {
+		b := make([]byte, 5)
+
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, fmt.Errorf("error generating recovery codes: %w", err)
+		}
+
+		code := hex.EncodeToString(b)
+		code = code[:5] + "-" + code[5:]
+
+		codes = append(codes, code)
+		e.Recovery = append(e.Recovery, hashCode(code))
+	}
+
+	e.Enabled = true
+	e.LastStep = matched
+	e.EnabledAt = s.now().UTC()
+
+	return codes, s.save()
+}
+
+// Verify checks a TOTP code or, failing that, a recovery code, which is
+// used up.
+func (s *Store) Verify(user, input string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.users[user]
+	if !ok || !e.Enabled {
+		return ErrNotEnrolled
+	}
+
+	matched, ok := Verify(e.Secret, input, s.now(), e.LastStep)
+	if ok {
+		e.LastStep = matched
+		return s.save()
+	}
+
+	h := hashCode(input)
+
+	for i, recovery := range e.Recovery {
+		if recovery == h {
+			e.Recovery = append(e.Recovery[:i], e.Recovery[i+1:]...)
+			return s.save()
+		}
+	}
+
+	return ErrInvalidCode
+}
+
+// RecoveryLeft returns how many recovery codes the user has left.
+func (s *Store) RecoveryLeft(user string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.users[user]
+	if !ok {
+		return 0
+	}
+
+	return len(e.Recovery)
+}
+
+// Disable removes the user's two-factor setup.
+func (s *Store) Disable(user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user]; !ok {
+		return ErrNotEnrolled
+	}
+
+	delete(s.users, user)
+
+	return s.save()
+}
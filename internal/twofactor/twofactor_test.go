@@ -0,0 +1,111 @@
+package twofactor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	// RFC 6238 test vector for SHA-1, truncated to six digits
+	secret := encoding.EncodeToString([]byte("12345678901234567890"))
+
+	got, err := Code(secret, time.Unix(59, 0))
+	if err != nil || got != "287082" {
+		t.Errorf("Expected 287082, got %q (%v)", got, err)
+	}
+
+	got, _ = Code(secret, time.Unix(1111111109, 0))
+	if got != "081804" {
+		t.Errorf("Expected 081804, got %q", got)
+	}
+
+	now := time.Unix(1111111109, 0)
+
+	matched, ok := Verify(secret, "081804", now.Add(30*time.Second), 0)
+	if !ok {
+		t.Fatalf("Expected a code from the previous period to be accepted")
+	}
+
+	if _, ok := Verify(secret, "081804", now, matched); ok {
+		t.Errorf("Expected a used code to be rejected")
+	}
+
+	if !strings.HasPrefix(URI("MC Central", "alice", secret), "otpauth://totp/MC%20Central:alice?") {
+		t.Errorf("Unexpected URI: %s", URI("MC Central", "alice", secret))
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "twofactor.json")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	now := time.Date(2024, 6, 14, 9, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	secret, err := store.Enroll("alice")
+	if err != nil {
+		t.Fatalf("Enroll failed: %v", err)
+	}
+
+	if store.Enabled("alice") {
+		t.Errorf("Expected two-factor to be disabled until confirmed")
+	}
+
+	_, err = store.Confirm("alice", "000000")
+	if !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Expected ErrInvalidCode, got %v", err)
+	}
+
+	code, _ := Code(secret, now)
+
+	codes, err := store.Confirm("alice", code)
+	if err != nil || len(codes) != recoveryCodes || !store.Enabled("alice") {
+		t.Fatalf("Confirm failed: %v, %v", codes, err)
+	}
+
+	// The confirmation code can't be replayed
+	if !errors.Is(store.Verify("alice", code), ErrInvalidCode) {
+		t.Errorf("Expected a replayed code to be rejected")
+	}
+
+	now = now.Add(time.Minute)
+	code, _ = Code(secret, now)
+
+	err = store.Verify("alice", code)
+	if err != nil {
+		t.Errorf("Expected the current code to be accepted, got %v", err)
+	}
+
+	// Recovery codes are stored hashed and work once
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), codes[0]) {
+		t.Errorf("Expected recovery codes to be stored hashed")
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	err = reopened.Verify("alice", strings.ToUpper(codes[0]))
+	if err != nil {
+		t.Errorf("Expected the recovery code to be accepted, got %v", err)
+	}
+
+	if !errors.Is(reopened.Verify("alice", codes[0]), ErrInvalidCode) ||
+		reopened.RecoveryLeft("alice") != recoveryCodes-1 {
+		t.Errorf("Expected the recovery code to be used up")
+	}
+
+	if !errors.Is(reopened.Verify("bob", "123456"), ErrNotEnrolled) {
+		t.Errorf("Expected ErrNotEnrolled for a user without two-factor")
+	}
+}
@@ -0,0 +1,320 @@
+// Package uptime records periodic server status samples and computes monthly
+// uptime reports with a breakdown of downtime incidents by cause.
+package uptime
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// Downtime causes.
+const (
+	CauseCrash      = "crash"
+	CauseUpgrade    = "upgrade"
+	CauseManualStop = "manual_stop"
+)
+
+// Causes lists the downtime causes in report order.
+var Causes = []string{CauseCrash, CauseUpgrade, CauseManualStop}
+
+// retention is how long samples are kept.
+const retention = 400 * 24 * time.Hour
+
+// MonthLayout is the format of report months, e.g. "2024-06".
+const MonthLayout = "2006-01"
+
+// Period is a stretch of consecutive samples in which a server was in the
+// same state. Time between samples that are further apart than the maximum
+// gap, such as while the central server was down, is not measured.
+type Period struct {
+	Server  string    `json:"server"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Up      bool      `json:"up"`
+	Cause   string    `json:"cause,omitempty"`   // Why the server was down
+	Version string    `json:"version,omitempty"` // Server version while up
+}
+
+// Store records status samples and persists them to a JSON file.
+type Store struct {
+	path    string
+	maxGap  time.Duration
+	mu      sync.RWMutex
+	periods []Period
+}
+
+// Open loads the store from path, starting empty if the file doesn't exist.
+// Samples are expected every interval.
+func Open(path string, interval time.Duration) (*Store, error) {
+	s := &Store{path: path, maxGap: 2 * interval}
+
+	err := jsonfile.Load(path, &s.periods)
+	if err != nil {
+		return nil, fmt.Errorf("error loading uptime samples: %w", err)
+	}
+
+	return s, nil
+}
+
+// save persists the status periods; call it with s.mu held.
+func (s *Store) save() {
+	if s.path == "" {
+		return
+	}
+
+	err := jsonfile.SaveCompact(s.path, s.periods)
+	if err != nil {
+		fmt.Printf("Error saving uptime samples: %v\n", err)
+	}
+}
+
+// last returns the index of the server's latest period, or -1.
+func (s *Store) last(server string) int {
+	for i := len(s.periods) - 1; i >= 0; i-- {
+		if s.periods[i].Server == server {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Record adds a status sample. The cause is only used when the server goes
+// down; a server that comes back on a different version than before was
+// down for an upgrade.
+func (s *Store) Record(server string, t time.Time, up bool, cause, version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.last(server)
+	if i >= 0 && (t.Before(s.periods[i].End) || t.Sub(s.periods[i].End) > s.maxGap) {
+		i = -1
+	}
+
+	switch {
+	case i < 0:
+		s.periods = append(s.periods, Period{Server: server, Start: t, End: t, Up: up})
+	case s.periods[i].Up == up && (!up || s.periods[i].Version == version):
+		s.periods[i].End = t
+	default:
+		if up && !s.periods[i].Up {
+			s.classify(i, version)
+		}
+
+		s.periods = append(s.periods, Period{Server: server, Start: s.periods[i].End, End: t, Up: up})
+	}
+
+	p := &s.periods[len(s.periods)-1]
+	if up {
+		p.Version = version
+	} else if p.Cause == "" {
+		p.Cause = cause
+	}
+
+	s.prune(t)
+	s.save()
+}
+
+// classify marks the down period at i as an upgrade if the server came back
+// on a different version than it ran before. The caller must hold the lock.
+func (s *Store) classify(i int, version string) {
+	down := s.periods[i]
+
+	for j := i - 1; j >= 0; j-- {
+		p := s.periods[j]
+		if p.Server != down.Server || !p.Up {
+			continue
+		}
+
+		if p.Version != "" && version != "" && p.Version != version {
+			s.periods[i].Cause = CauseUpgrade
+		}
+
+		return
+	}
+}
+
+// prune drops periods that ended before the retention window. The caller
+// must hold the lock.
+func (s *Store) prune(now time.Time) {
+	cutoff := now.Add(-retention)
+
+	kept := s.periods[:0]
+	for _, p := range s.periods {
+		if !p.End.Before(cutoff) {
+			kept = append(kept, p)
+		}
+	}
+
+	s.periods = kept
+}
+
+// Incident is a period a server was down.
+type Incident struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Seconds int64     `json:"seconds"`
+	Cause   string    `json:"cause"`
+}
+
+// Report is a server's uptime in one month.
+type Report struct {
+	Server    string           `json:"server"`
+	Month     string           `json:"month"`
+	Monitored int64            `json:"monitored_seconds"` // Time covered by samples
+	Downtime  int64            `json:"downtime_seconds"`
+	Uptime    float64          `json:"uptime_percent"`
+	Causes    map[string]int64 `json:"downtime_by_cause"` // Seconds of downtime per cause
+	Incidents []Incident       `json:"incidents"`
+}
+
+// clip returns the part of start..end that lies within from..to.
+func clip(start, end, from, to time.Time) (time.Time, time.Time, bool) {
+	if start.Before(from) {
+		start = from
+	}
+
+	if end.After(to) {
+		end = to
+	}
+
+	return start, end, end.After(start)
+}
+
+// Reports returns the uptime of every sampled server in the month starting
+// at month, sorted by server.
+func (s *Store) Reports(month time.Time) []Report {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	to := from.AddDate(0, 1, 0)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reports := make(map[string]*Report)
+
+	for _, p := range s.periods {
+		start, end, ok := clip(p.Start, p.End, from, to)
+		if !ok {
+			continue
+		}
+
+		report, ok := reports[p.Server]
+		if !ok {
+			report = &Report{
+				Server:    p.Server,
+				Month:     from.Format(MonthLayout),
+				Causes:    make(map[string]int64),
+				Incidents: []Incident{},
+			}
+			reports[p.Server] = report
+		}
+
+		seconds := int64(end.Sub(start).Seconds())
+		report.Monitored += seconds
+
+		if p.Up {
+			continue
+		}
+
+		cause := p.Cause
+		if cause == "" {
+			cause = CauseCrash
+		}
+
+		report.Downtime += seconds
+		report.Causes[cause] += seconds
+		report.Incidents = append(report.Incidents, Incident{Start: start, End: end, Seconds: seconds, Cause: cause})
+	}
+
+	list := make([]Report, 0, len(reports))
+
+	for _, report := range reports {
+		report.Uptime = 100
+		if report.Monitored > 0 {
+			report.Uptime = float64(report.Monitored-report.Downtime) / float64(report.Monitored) * 100
+		}
+
+		list = append(list, *report)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Server < list[j].Server
+	})
+
+	return list
+}
+
+// WriteCSV writes one row per server with its uptime and downtime per cause.
+func WriteCSV(w io.Writer, reports []Report) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"server", "month", "monitored_seconds", "downtime_seconds", "uptime_percent", "incidents"}
+	for _, cause := range Causes {
+		header = append(header, cause+"_seconds")
+	}
+
+	err := cw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range reports {
+		row := []string{
+			r.Server,
+			r.Month,
+			strconv.FormatInt(r.Monitored, 10),
+			strconv.FormatInt(r.Downtime, 10),
+			strconv.FormatFloat(r.Uptime, 'f', 3, 64),
+			strconv.Itoa(len(r.Incidents)),
+		}
+
+		for _, cause := range Causes {
+			row = append(row, strconv.FormatInt(r.Causes[cause], 10))
+		}
+
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// WriteIncidentsCSV writes one row per downtime incident.
+func WriteIncidentsCSV(w io.Writer, reports []Report) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"server", "start", "end", "seconds", "cause"})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range reports {
+		for _, incident := range r.Incidents {
+			err = cw.Write([]string{
+				r.Server,
+				incident.Start.Format(time.RFC3339),
+				incident.End.Format(time.RFC3339),
+				strconv.FormatInt(incident.Seconds, 10),
+				incident.Cause,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,92 @@
+package uptime
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uptime.json")
+
+	store, err := Open(path, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time { return base.Add(time.Duration(minute) * time.Minute) }
+
+	sample := func(server string, from, to int, up bool, cause, version string) {
+		for m := from; m <= to; m++ {
+			store.Record(server, at(m), up, cause, version)
+		}
+	}
+
+	// s1: up for 60 minutes, crashes for 10, then a manual stop for 10
+	// and finally an upgrade for 20
+	sample("s1", 0, 60, true, "", "1.21.0")
+	sample("s1", 61, 70, false, CauseCrash, "")
+	sample("s1", 71, 71, true, "", "1.21.0")
+	sample("s1", 72, 72, false, CauseManualStop, "")
+	sample("s1", 73, 81, false, CauseCrash, "")
+	sample("s1", 82, 83, true, "", "1.21.0")
+	sample("s1", 84, 103, false, CauseCrash, "")
+	sample("s1", 104, 104, true, "", "1.21.1")
+
+	// s2: samples with a gap while the central server was down
+	store.Record("s2", at(0), true, "", "1.21.0")
+	store.Record("s2", at(10), true, "", "1.21.0")
+	store.Record("s2", at(11), true, "", "1.21.0")
+
+	reopened, err := Open(path, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	reports := reopened.Reports(base)
+	if len(reports) != 2 {
+		t.Fatalf("Expected 2 reports, got %+v", reports)
+	}
+
+	s1 := reports[0]
+	if s1.Monitored != 104*60 || s1.Downtime != 40*60 || len(s1.Incidents) != 3 {
+		t.Errorf("Unexpected report for s1: %+v", s1)
+	}
+
+	if s1.Causes[CauseCrash] != 10*60 || s1.Causes[CauseManualStop] != 10*60 || s1.Causes[CauseUpgrade] != 20*60 {
+		t.Errorf("Unexpected downtime causes: %+v", s1.Causes)
+	}
+
+	if s2 := reports[1]; s2.Monitored != 60 || s2.Uptime != 100 {
+		t.Errorf("Unexpected report for s2: %+v", s2)
+	}
+
+	if len(reopened.Reports(base.AddDate(0, 1, 0))) != 0 {
+		t.Errorf("Expected no reports for the next month")
+	}
+
+	var buf bytes.Buffer
+
+	err = WriteCSV(&buf, reports)
+	if err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "\ns1,2024-06,6240,2400,61.538,3,600,1200,600\n") {
+		t.Errorf("Unexpected CSV: %q", buf.String())
+	}
+
+	buf.Reset()
+
+	err = WriteIncidentsCSV(&buf, reports)
+	if err != nil {
+		t.Fatalf("WriteIncidentsCSV failed: %v", err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 4 {
+		t.Errorf("Unexpected incidents CSV: %q", buf.String())
+	}
+}
@@ -0,0 +1,382 @@
+// Package usage records whether the hosts of servers are powered and whether
+// players are online, and computes monthly reports of the hours servers ran
+// against the hours they were played, with what stopping idle hosts sooner
+// would have saved.
+package usage
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/jsonfile"
+)
+
+// ErrInvalid is returned for invalid rates.
+var ErrInvalid = errors.New("invalid rate")
+
+// retention is how long samples are kept.
+const retention = 400 * 24 * time.Hour
+
+// MonthLayout is the format of report months, e.g. "2024-06".
+const MonthLayout = "2006-01"
+
+// IdleStops lists the idle-stop periods savings are estimated for.
+var IdleStops = []time.Duration{15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour}
+
+// Sample is the state of a server at one point in time.
+type Sample struct {
+	Powered bool // The host is on, whether or not the server runs
+	Up      bool // The server answers pings
+	Players int  // Players online
+}
+
+// Period is a stretch of consecutive samples in which a server was in the
+// same state. Time between samples that are further apart than the maximum
+// gap, such as while the central server was down, is not measured.
+type Period struct {
+	Server   string    `json:"server"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Powered  bool      `json:"powered"`
+	Up       bool      `json:"up"`
+	Occupied bool      `json:"occupied"` // Players were online
+}
+
+// idle reports whether the host was powered without players online.
+func (p Period) idle() bool {
+	return p.Powered && !p.Occupied
+}
+
+// Store records samples and persists them to a JSON file.
+type Store struct {
+	path    string
+	maxGap  time.Duration
+	mu      sync.RWMutex
+	periods []Period
+}
+
+// Open loads the store from path, starting empty if the file doesn't exist.
+// Samples are expected every interval.
+func Open(path string, interval time.Duration) (*Store, error) {
+	s := &Store{path: path, maxGap: 2 * interval}
+
+	err := jsonfile.Load(path, &s.periods)
+	if err != nil {
+		return nil, fmt.Errorf("error loading usage samples: %w", err)
+	}
+
+	return s, nil
+}
+
+// save persists the recorded periods, with s.mu held.
+func (s *Store) save() {
+	if s.path == "" {
+		return
+	}
+
+	err := jsonfile.SaveCompact(s.path, s.periods)
+	if err != nil {
+		fmt.Printf("Error saving usage samples: %v\n", err)
+	}
+}
+
+// last returns the index of the server's latest period, or -1.
+func (s *Store) last(server string) int {
+	for i := len(s.periods) - 1; i >= 0; i-- {
+		if s.periods[i].Server == server {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Record adds a sample.
+func (s *Store) Record(server string, t time.Time, sample Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := Period{Server: server, Start: t, End: t, Powered: sample.Powered, Up: sample.Up, Occupied: sample.Players > 0}
+
+	i := s.last(server)
+	if i >= 0 && (t.Before(s.periods[i].End) || t.Sub(s.periods[i].End) > s.maxGap) {
+		i = -1
+	}
+
+	switch {
+	case i < 0:
+		s.periods = append(s.periods, next)
+	case s.periods[i].Powered == next.Powered && s.periods[i].Up == next.Up && s.periods[i].Occupied == next.Occupied:
+		s.periods[i].End = t
+	default:
+		next.Start = s.periods[i].End
+		s.periods = append(s.periods, next)
+	}
+
+	s.prune(t)
+	s.save()
+}
+
+// prune drops periods that ended before the retention window. The caller
+// must hold the lock.
+func (s *Store) prune(now time.Time) {
+	cutoff := now.Add(-retention)
+
+	kept := s.periods[:0]
+	for _, p := range s.periods {
+		if !p.End.Before(cutoff) {
+			kept = append(kept, p)
+		}
+	}
+
+	s.periods = kept
+}
+
+// Rate is what running a server's host costs. Energy is estimated from the
+// power draw, for hosts at home, and cost from the electricity price and an
+// hourly price, for cloud VMs.
+type Rate struct {
+	Watts       float64 `json:"watts,omitempty"`         // Average power draw of the host
+	PricePerKWh float64 `json:"price_per_kwh,omitempty"` // Electricity price
+	CostPerHour float64 `json:"cost_per_hour,omitempty"` // Hourly price of the host, e.g. of a VM
+}
+
+// Validate checks the rate.
+func (r Rate) Validate() error {
+	if r.Watts < 0 || r.PricePerKWh < 0 || r.CostPerHour < 0 {
+		return fmt.Errorf("%w: watts and prices can't be negative", ErrInvalid)
+	}
+
+	return nil
+}
+
+// energy returns the energy used in seconds, in kWh.
+func (r Rate) energy(seconds int64) float64 {
+	return round(float64(seconds) / 3600 * r.Watts / 1000)
+}
+
+// cost returns the cost of seconds.
+func (r Rate) cost(seconds int64) float64 {
+	return round(float64(seconds)/3600*r.CostPerHour + r.energy(seconds)*r.PricePerKWh)
+}
+
+// round rounds to three decimals.
+func round(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
+
+// Saving is what stopping a host after an idle period would have saved.
+type Saving struct {
+	IdleStop string  `json:"idle_stop"`
+	Stops    int     `json:"stops"`   // Times the host would have been powered off
+	Seconds  int64   `json:"seconds"` // Powered time saved
+	Energy   float64 `json:"energy_kwh,omitempty"`
+	Cost     float64 `json:"cost,omitempty"`
+}
+
+// Report is the usage of a server in one month.
+type Report struct {
+	Server      string   `json:"server"`
+	Month       string   `json:"month"`
+	Monitored   int64    `json:"monitored_seconds"` // Time covered by samples
+	Powered     int64    `json:"powered_seconds"`   // Time the host was on
+	Up          int64    `json:"up_seconds"`        // Time the server answered pings
+	Occupied    int64    `json:"occupied_seconds"`  // Time players were online
+	Idle        int64    `json:"idle_seconds"`      // Time the host was on without players online
+	Utilization float64  `json:"utilization_percent"`
+	Energy      float64  `json:"energy_kwh,omitempty"`
+	Cost        float64  `json:"cost,omitempty"`
+	Savings     []Saving `json:"idle_stop_savings"`
+
+	stretches []int64 // Lengths of idle stretches, in seconds
+}
+
+// clip returns the part of start..end that lies within from..to.
+func clip(start, end, from, to time.Time) (time.Time, time.Time, bool) {
+	if start.Before(from) {
+		start = from
+	}
+
+	if end.After(to) {
+		end = to
+	}
+
+	return start, end, end.After(start)
+}
+
+// Reports returns the usage of every sampled server in the month starting
+// at month, sorted by server. Costs use the server's rate in rates, if any.
+// Idle stretches spanning the start or end of the month only count the part
+// within it.
+func (s *Store) Reports(month time.Time, rates map[string]Rate) []Report {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	to := from.AddDate(0, 1, 0)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reports := make(map[string]*Report)
+	idleEnd := make(map[string]time.Time) // End of each server's current idle stretch
+
+	for _, p := range s.periods {
+		start, end, ok := clip(p.Start, p.End, from, to)
+		if !ok {
+			continue
+		}
+
+		report, ok := reports[p.Server]
+		if !ok {
+			report = &Report{Server: p.Server, Month: from.Format(MonthLayout)}
+			reports[p.Server] = report
+		}
+
+		seconds := int64(end.Sub(start).Seconds())
+		report.Monitored += seconds
+
+		if p.Powered {
+			report.Powered += seconds
+		}
+
+		if p.Up {
+			report.Up += seconds
+		}
+
+		if p.Occupied {
+			report.Occupied += seconds
+		}
+
+		if !p.idle() {
+			delete(idleEnd, p.Server)
+			continue
+		}
+
+		report.Idle += seconds
+
+		if last, ok := idleEnd[p.Server]; ok && last.Equal(start) {
+			report.stretches[len(report.stretches)-1] += seconds
+		} else {
+			report.stretches = append(report.stretches, seconds)
+		}
+
+		idleEnd[p.Server] = end
+	}
+
+	list := make([]Report, 0, len(reports))
+
+	for _, report := range reports {
+		rate := rates[report.Server]
+
+		if report.Powered > 0 {
+			report.Utilization = round(float64(report.Occupied) / float64(report.Powered) * 100)
+		}
+
+		report.Energy = rate.energy(report.Powered)
+		report.Cost = rate.cost(report.Powered)
+		report.Savings = savings(report.stretches, rate)
+
+		list = append(list, *report)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Server < list[j].Server
+	})
+
+	return list
+}
+
+// savings estimates what stopping the host after each of IdleStops would
+// have saved over the idle stretches.
+func savings(stretches []int64, rate Rate) []Saving {
+	list := make([]Saving, 0, len(IdleStops))
+
+	for _, idleStop := range IdleStops {
+		saving := Saving{IdleStop: formatDuration(idleStop)}
+		threshold := int64(idleStop.Seconds())
+
+		for _, length := range stretches {
+			if length > threshold {
+				saving.Stops++
+				saving.Seconds += length - threshold
+			}
+		}
+
+		saving.Energy = rate.energy(saving.Seconds)
+		saving.Cost = rate.cost(saving.Seconds)
+
+		list = append(list, saving)
+	}
+
+	return list
+}
+
+// formatDuration formats a duration without trailing zero units, e.g. "1h"
+// rather than "1h0m0s".
+func formatDuration(d time.Duration) string {
+	s := strings.TrimSuffix(d.String(), "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+
+	return s
+}
+
+// hours formats seconds as hours.
+func hours(seconds int64) string {
+	return strconv.FormatFloat(float64(seconds)/3600, 'f', 2, 64)
+}
+
+// WriteCSV writes one row per server with its hours and, for each of
+// IdleStops, the hours and cost stopping idle hosts would have saved.
+func WriteCSV(w io.Writer, reports []Report) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{
+		"server", "month", "monitored_hours", "powered_hours", "up_hours", "occupied_hours", "idle_hours",
+		"utilization_percent", "energy_kwh", "cost",
+	}
+	for _, idleStop := range IdleStops {
+		name := formatDuration(idleStop)
+		header = append(header, "idle_stop_"+name+"_saved_hours", "idle_stop_"+name+"_saved_cost")
+	}
+
+	err := cw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range reports {
+		row := []string{
+			r.Server,
+			r.Month,
+			hours(r.Monitored),
+			hours(r.Powered),
+			hours(r.Up),
+			hours(r.Occupied),
+			hours(r.Idle),
+			strconv.FormatFloat(r.Utilization, 'f', 3, 64),
+			strconv.FormatFloat(r.Energy, 'f', 3, 64),
+			strconv.FormatFloat(r.Cost, 'f', 3, 64),
+		}
+
+		for _, saving := range r.Savings {
+			row = append(row, hours(saving.Seconds), strconv.FormatFloat(saving.Cost, 'f', 3, 64))
+		}
+
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,123 @@
+package usage
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+
+	store, err := Open(path, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int) time.Time { return base.Add(time.Duration(minute) * time.Minute) }
+
+	sample := func(server string, from, to int, s Sample) {
+		for m := from; m <= to; m++ {
+			store.Record(server, at(m), s)
+		}
+	}
+
+	idle := Sample{Powered: true, Up: true}
+	played := Sample{Powered: true, Up: true, Players: 3}
+
+	// s1: idle for 20 minutes, played for an hour, idle for 100 minutes
+	// with the server down for part of it, then powered off
+	sample("s1", 0, 20, idle)
+	sample("s1", 21, 80, played)
+	sample("s1", 81, 130, idle)
+	sample("s1", 131, 150, Sample{Powered: true})
+	sample("s1", 151, 180, idle)
+	sample("s1", 181, 240, Sample{})
+
+	// s2: played, then samples with a gap while the central server was down
+	store.Record("s2", at(0), played)
+	store.Record("s2", at(1), played)
+	store.Record("s2", at(10), played)
+	store.Record("s2", at(11), played)
+
+	reopened, err := Open(path, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+
+	reports := reopened.Reports(base, map[string]Rate{"s1": {Watts: 100, PricePerKWh: 0.3}})
+	if len(reports) != 2 {
+		t.Fatalf("Expected 2 reports, got %+v", reports)
+	}
+
+	s1 := reports[0]
+	if s1.Monitored != 240*60 || s1.Powered != 180*60 || s1.Up != 160*60 || s1.Occupied != 60*60 || s1.Idle != 120*60 {
+		t.Errorf("Unexpected report for s1: %+v", s1)
+	}
+
+	if s1.Energy != 0.3 || s1.Cost != 0.09 {
+		t.Errorf("Unexpected energy and cost for s1: %v kWh, %v", s1.Energy, s1.Cost)
+	}
+
+	// Idle stretches of 20 and 100 minutes
+	expected := map[string][2]int64{"15m": {2, 5 + 85}, "30m": {1, 70}, "1h": {1, 40}, "2h": {0, 0}}
+	for _, saving := range s1.Savings {
+		want := expected[saving.IdleStop]
+		if int64(saving.Stops) != want[0] || saving.Seconds != want[1]*60 {
+			t.Errorf("Unexpected savings for an idle stop of %s: %+v", saving.IdleStop, saving)
+		}
+	}
+
+	s2 := reports[1]
+	if s2.Monitored != 2*60 || s2.Utilization != 100 || s2.Cost != 0 {
+		t.Errorf("Unexpected report for s2: %+v", s2)
+	}
+
+	if other := reopened.Reports(base.AddDate(0, 1, 0), nil); len(other) != 0 {
+		t.Errorf("Expected no reports for July, got %+v", other)
+	}
+}
+
+func TestRate_Validate(t *testing.T) {
+	err := (Rate{Watts: -5}).Validate()
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected a negative power draw to be invalid, got %v", err)
+	}
+
+	err = (Rate{CostPerHour: 0.05}).Validate()
+	if err != nil {
+		t.Errorf("Expected an hourly price to be valid, got %v", err)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	reports := []Report{{
+		Server:   "s1",
+		Month:    "2024-06",
+		Powered:  7200,
+		Occupied: 3600,
+		Idle:     3600,
+		Savings:  savings([]int64{3600}, Rate{CostPerHour: 0.1}),
+	}}
+
+	var buf bytes.Buffer
+
+	err := WriteCSV(&buf, reports)
+	if err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "idle_stop_30m_saved_hours") {
+		t.Fatalf("Unexpected CSV:\n%s", buf.String())
+	}
+
+	if !strings.HasPrefix(lines[1], "s1,2024-06,0.00,2.00,0.00,1.00,1.00,") ||
+		!strings.HasSuffix(lines[1], "0.75,0.075,0.50,0.050,0.00,0.000,0.00,0.000") {
+		t.Errorf("Unexpected row %s", lines[1])
+	}
+}
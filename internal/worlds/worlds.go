@@ -0,0 +1,186 @@
+// Package worlds manages a catalog of world templates (.mcworld files) and
+// creates new worlds from them.
+package worlds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jsandas/gogo-mc-bedrock-server/internal/downloader"
+)
+
+const templateExt = ".mcworld"
+
+var (
+	ErrInvalidName      = errors.New("invalid name")
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrWorldExists      = errors.New("world already exists")
+)
+
+// Template is a world template in the catalog.
+type Template struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	Source string `json:"source,omitempty"` // URL the template was fetched from
+}
+
+// Catalog is a directory of .mcworld templates, optionally populated from a
+// list of URLs.
+type Catalog struct {
+	dir  string
+	urls []string
+}
+
+// NewCatalog creates a catalog stored in dir that fetches templates from urls.
+func NewCatalog(dir string, urls []string) *Catalog {
+	return &Catalog{
+		dir:  dir,
+		urls: urls,
+	}
+}
+
+// ValidName reports whether name can be used as a template or world directory
+// name.
+func ValidName(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".")
+}
+
+// templateName returns the catalog name of a template URL.
+func templateName(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSuffix(path.Base(u.Path), templateExt)
+	if !ValidName(name) {
+		return "", fmt.Errorf("%w: can't derive a template name from %s", ErrInvalidName, rawURL)
+	}
+
+	return name, nil
+}
+
+// List returns the templates available in the catalog.
+func (c *Catalog) List() ([]Template, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Template{}, nil
+		}
+
+		return nil, fmt.Errorf("error reading templates directory: %w", err)
+	}
+
+	sources := make(map[string]string)
+
+	for _, u := range c.urls {
+		name, err := templateName(u)
+		if err == nil {
+			sources[name] = u
+		}
+	}
+
+	templates := []Template{}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), templateExt) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), templateExt)
+		templates = append(templates, Template{
+			Name:   name,
+			File:   entry.Name(),
+			Size:   info.Size(),
+			Source: sources[name],
+		})
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	return templates, nil
+}
+
+// Fetch downloads the configured template URLs that aren't in the catalog
+// yet and returns the names of the templates that were added.
+func (c *Catalog) Fetch(ctx context.Context) ([]string, error) {
+	err := os.MkdirAll(c.dir, 0750)
+	if err != nil {
+		return nil, fmt.Errorf("error creating templates directory: %w", err)
+	}
+
+	var (
+		added []string
+		errs  []error
+	)
+
+	for _, u := range c.urls {
+		name, err := templateName(u)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		dest := filepath.Join(c.dir, name+templateExt)
+
+		_, err = os.Stat(dest)
+		if err == nil {
+			continue
+		}
+
+		err = downloader.DownloadFile(ctx, u, dest)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("template %s: %w", name, err))
+			continue
+		}
+
+		added = append(added, name)
+	}
+
+	return added, errors.Join(errs...)
+}
+
+// CreateWorld creates the world appDir/worlds/<world> from the named template.
+func (c *Catalog) CreateWorld(appDir, template, world string) error {
+	if !ValidName(template) || !ValidName(world) {
+		return ErrInvalidName
+	}
+
+	src := filepath.Join(c.dir, template+templateExt)
+
+	_, err := os.Stat(src)
+	if err != nil {
+		return ErrTemplateNotFound
+	}
+
+	dest := filepath.Join(appDir, "worlds", world)
+
+	_, err = os.Stat(dest)
+	if err == nil {
+		return ErrWorldExists
+	}
+
+	err = downloader.Extract(src, dest)
+	if err != nil {
+		_ = os.RemoveAll(dest)
+		return fmt.Errorf("error extracting template %s: %w", template, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package worlds
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTemplate creates a minimal .mcworld file.
+func writeTemplate(t *testing.T, path string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+
+	w, err := zw.Create("levelname.txt")
+	if err != nil {
+		t.Fatalf("Failed to add file to template: %v", err)
+	}
+
+	_, err = w.Write([]byte("Skyblock"))
+	if err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	err = zw.Close()
+	if err != nil {
+		t.Fatalf("Failed to close template: %v", err)
+	}
+}
+
+func TestCatalog_CreateWorld(t *testing.T) {
+	templatesDir := t.TempDir()
+	appDir := t.TempDir()
+
+	writeTemplate(t, filepath.Join(templatesDir, "skyblock.mcworld"))
+
+	catalog := NewCatalog(templatesDir, nil)
+
+	templates, err := catalog.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	if len(templates) != 1 || templates[0].Name != "skyblock" {
+		t.Fatalf("Unexpected templates: %+v", templates)
+	}
+
+	err = catalog.CreateWorld(appDir, "skyblock", "event1")
+	if err != nil {
+		t.Fatalf("CreateWorld failed: %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(appDir, "worlds", "event1", "levelname.txt"))
+	if err != nil {
+		t.Errorf("Expected world files to be extracted: %v", err)
+	}
+
+	err = catalog.CreateWorld(appDir, "skyblock", "event1")
+	if !errors.Is(err, ErrWorldExists) {
+		t.Errorf("Expected ErrWorldExists, got %v", err)
+	}
+
+	err = catalog.CreateWorld(appDir, "missing", "event2")
+	if !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+	}
+
+	err = catalog.CreateWorld(appDir, "skyblock", "../escape")
+	if !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Expected ErrInvalidName, got %v", err)
+	}
+}
+
+func TestCatalog_Fetch(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "source.mcworld")
+	writeTemplate(t, source)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, source)
+	}))
+	defer ts.Close()
+
+	catalog := NewCatalog(t.TempDir(), []string{ts.URL + "/templates/parkour.mcworld"})
+
+	added, err := catalog.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	if len(added) != 1 || added[0] != "parkour" {
+		t.Fatalf("Expected parkour to be added, got %v", added)
+	}
+
+	templates, err := catalog.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	if len(templates) != 1 || templates[0].Source == "" {
+		t.Errorf("Expected fetched template with source, got %+v", templates)
+	}
+
+	// Already present templates are not downloaded again
+	added, err = catalog.Fetch(context.Background())
+	if err != nil || len(added) != 0 {
+		t.Errorf("Expected nothing to fetch, got %v, %v", added, err)
+	}
+}